@@ -0,0 +1,1057 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	batchValidated = "validated"
+	batchInvalid   = "invalid"
+	batchApplying  = "applying"
+	batchCompleted = "completed"
+
+	batchRowValid   = "valid"
+	batchRowInvalid = "invalid"
+	batchRowApplied = "applied"
+	batchRowSkipped = "skipped"
+	batchRowFailed  = "failed"
+
+	batchTypeDeposit = "deposit"
+	batchTypePayout  = "payout"
+
+	// batchChunkSize -> rows applied between two saves of their results
+	batchChunkSize = 100
+
+	batchMaxRows = 50000
+	batchMaxBody = 10 << 20
+
+	// batchMaxErrors -> invalid rows listed in a batch response, the result file has them all
+	batchMaxErrors = 100
+)
+
+// batchColumns -> the header a batch file must have, in any order
+var batchColumns = []string{"customer_xid", "amount", "reference_id", "type"}
+
+// batchRowStatuses -> order of the counts in a batch response
+var batchRowStatuses = []string{batchRowValid, batchRowInvalid, batchRowApplied, batchRowSkipped, batchRowFailed}
+
+// Batch -> an uploaded file of deposits and payouts
+type Batch struct {
+	ID         string    `db:"id"`
+	Status     string    `db:"status"`
+	CreateTime time.Time `db:"create_time"`
+	UpdateTime time.Time `db:"update_time"`
+}
+
+// BatchRow -> one line of a batch file, fields are kept as uploaded
+type BatchRow struct {
+	BatchID       string `db:"batch_id"`
+	Line          int    `db:"line"`
+	CustomerXID   string `db:"customer_xid"`
+	Amount        string `db:"amount"`
+	ReferenceID   string `db:"reference_id"`
+	Type          string `db:"type"`
+	Status        string `db:"status"`
+	Error         string `db:"error"`
+	TransactionID string `db:"transaction_id"`
+}
+
+// transactionType -> deposit or withdrawal, payouts are withdrawals
+func (r BatchRow) transactionType() int {
+	if r.Type == batchTypePayout {
+		return withdrawalType
+	}
+
+	return depositType
+}
+
+const (
+	createBatchTable = `
+		CREATE TABLE IF NOT EXISTS batch (
+			id TEXT NOT NULL PRIMARY KEY,
+			status TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createBatchRowTable = `
+		CREATE TABLE IF NOT EXISTS batch_row (
+			batch_id TEXT NOT NULL,
+			line INTEGER NOT NULL,
+			customer_xid TEXT NOT NULL,
+			amount TEXT NOT NULL,
+			reference_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			PRIMARY KEY (batch_id, line)
+		);
+	`
+
+	insertBatchSQL = `
+		INSERT INTO batch
+			(id, status, create_time, update_time)
+		VALUES
+			(?,?,?,?)
+		;
+	`
+
+	insertBatchRowSQL = `
+		INSERT INTO batch_row
+			(batch_id, line, customer_xid, amount, reference_id, type, status, error, transaction_id)
+		VALUES
+			(?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getBatchSQL = `
+		SELECT
+			id,
+			status,
+			create_time,
+			update_time
+		FROM
+			batch
+		WHERE
+			id = $1
+	`
+
+	getBatchesByStatusSQL = `
+		SELECT
+			id,
+			status,
+			create_time,
+			update_time
+		FROM
+			batch
+		WHERE
+			status = $1
+	`
+
+	updateBatchStatusSQL = `
+		UPDATE
+			batch
+		SET
+			status = $1,
+			update_time = $2
+		WHERE
+			id = $3
+	`
+
+	countBatchRowsSQL = `
+		SELECT
+			status,
+			COUNT(*)
+		FROM
+			batch_row
+		WHERE
+			batch_id = $1
+		GROUP BY
+			status
+	`
+
+	getBatchRowsSQL = `
+		SELECT
+			batch_id,
+			line,
+			customer_xid,
+			amount,
+			reference_id,
+			type,
+			status,
+			error,
+			transaction_id
+		FROM
+			batch_row
+		WHERE
+			batch_id = $1 AND
+			($2 = '' OR status = $2) AND
+			line > $3
+		ORDER BY
+			line
+		LIMIT $4
+	`
+
+	updateBatchRowSQL = `
+		UPDATE
+			batch_row
+		SET
+			status = $1,
+			error = $2,
+			transaction_id = $3
+		WHERE
+			batch_id = $4 AND
+			line = $5
+	`
+)
+
+// insertBatch -> store the batch and all of its rows in one transaction
+func insertBatch(ctx context.Context, db *sql.DB, batch Batch, rows []BatchRow) (err error) {
+	defer observeQuery("insertBatch", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertBatch")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertBatch BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, insertBatchSQL, batch.ID, batch.Status, batch.CreateTime, batch.UpdateTime)
+	if err != nil {
+		logError(ctx, "insertBatch ExecContext", err)
+		return
+	}
+
+	stmt, err := tx.PrepareContext(ctx, insertBatchRowSQL)
+	if err != nil {
+		logError(ctx, "insertBatch PrepareContext", err)
+		return
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		_, err = stmt.ExecContext(ctx, batch.ID, row.Line, row.CustomerXID, row.Amount, row.ReferenceID, row.Type, row.Status, row.Error, row.TransactionID)
+		if err != nil {
+			logError(ctx, "insertBatch insert row", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertBatch Commit", err)
+	}
+
+	return
+}
+
+func getBatch(ctx context.Context, db *sql.DB, batchID string) (batch Batch, err error) {
+	defer observeQuery("getBatch", time.Now())
+	ctx, span := startQuerySpan(ctx, "getBatch")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getBatchSQL, batchID).Scan(&batch.ID, &batch.Status, &batch.CreateTime, &batch.UpdateTime)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getBatch Scan", err)
+	}
+
+	return
+}
+
+func getBatchesByStatus(ctx context.Context, db *sql.DB, status string) (batches []Batch, err error) {
+	defer observeQuery("getBatchesByStatus", time.Now())
+	ctx, span := startQuerySpan(ctx, "getBatchesByStatus")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getBatchesByStatusSQL, status)
+	if err != nil {
+		logError(ctx, "getBatchesByStatus QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var batch Batch
+		err = rows.Scan(&batch.ID, &batch.Status, &batch.CreateTime, &batch.UpdateTime)
+		if err != nil {
+			logError(ctx, "getBatchesByStatus Scan", err)
+			return
+		}
+
+		batches = append(batches, batch)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func updateBatchStatus(ctx context.Context, db *sql.DB, batchID, status string) (err error) {
+	defer observeQuery("updateBatchStatus", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateBatchStatus")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, updateBatchStatusSQL, status, time.Now(), batchID)
+	if err != nil {
+		logError(ctx, "updateBatchStatus ExecContext", err)
+	}
+
+	return
+}
+
+func countBatchRows(ctx context.Context, db *sql.DB, batchID string) (counts map[string]int, err error) {
+	defer observeQuery("countBatchRows", time.Now())
+	ctx, span := startQuerySpan(ctx, "countBatchRows")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, countBatchRowsSQL, batchID)
+	if err != nil {
+		logError(ctx, "countBatchRows QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	counts = map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		err = rows.Scan(&status, &count)
+		if err != nil {
+			logError(ctx, "countBatchRows Scan", err)
+			return
+		}
+
+		counts[status] = count
+	}
+
+	err = rows.Err()
+	return
+}
+
+// getBatchRows -> up to limit rows after line, only those in status unless it is empty
+func getBatchRows(ctx context.Context, db *sql.DB, batchID, status string, afterLine, limit int) (batchRows []BatchRow, err error) {
+	defer observeQuery("getBatchRows", time.Now())
+	ctx, span := startQuerySpan(ctx, "getBatchRows")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getBatchRowsSQL, batchID, status, afterLine, limit)
+	if err != nil {
+		logError(ctx, "getBatchRows QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row BatchRow
+		err = rows.Scan(
+			&row.BatchID,
+			&row.Line,
+			&row.CustomerXID,
+			&row.Amount,
+			&row.ReferenceID,
+			&row.Type,
+			&row.Status,
+			&row.Error,
+			&row.TransactionID,
+		)
+		if err != nil {
+			logError(ctx, "getBatchRows Scan", err)
+			return
+		}
+
+		batchRows = append(batchRows, row)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// updateBatchRows -> save the results of a chunk in one transaction
+func updateBatchRows(ctx context.Context, db *sql.DB, batchID string, rows []BatchRow) (err error) {
+	defer observeQuery("updateBatchRows", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateBatchRows")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "updateBatchRows BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		_, err = tx.ExecContext(ctx, updateBatchRowSQL, row.Status, row.Error, row.TransactionID, batchID, row.Line)
+		if err != nil {
+			logError(ctx, "updateBatchRows ExecContext", err)
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, updateBatchStatusSQL, batchApplying, time.Now(), batchID)
+	if err != nil {
+		logError(ctx, "updateBatchRows touch batch", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "updateBatchRows Commit", err)
+	}
+
+	return
+}
+
+// parseBatchFile -> rows of a batch csv, with a header naming batchColumns. Problems with
+// the file as a whole are validation errors of the "file" field, problems with single
+// rows are left for validateBatchRows.
+func parseBatchFile(r io.Reader) (rows []BatchRow, errs validationErrors) {
+	errs = validationErrors{}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		errs.add("file", "File is empty.")
+		return
+	}
+	if err != nil {
+		errs.add("file", "Not a valid csv file: "+err.Error())
+		return
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, column := range batchColumns {
+		if _, ok := index[column]; !ok {
+			errs.add("file", "Missing column "+column+".")
+		}
+	}
+	if len(errs) > 0 {
+		return
+	}
+
+	field := func(record []string, column string) string {
+		if i := index[column]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs.add("file", "Not a valid csv file: "+err.Error())
+			return
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+
+		rows = append(rows, BatchRow{
+			Line:        line,
+			CustomerXID: field(record, "customer_xid"),
+			Amount:      field(record, "amount"),
+			ReferenceID: field(record, "reference_id"),
+			Type:        strings.ToLower(field(record, "type")),
+			Status:      batchRowValid,
+		})
+
+		if len(rows) > batchMaxRows {
+			errs.add("file", fmt.Sprintf("More than %d rows.", batchMaxRows))
+			return
+		}
+	}
+
+	if len(rows) == 0 {
+		errs.add("file", "File has no rows.")
+	}
+
+	return
+}
+
+// validateBatchRows -> the dry run: mark every row valid or invalid as if the batch were
+// applied now, in file order. Payouts are checked against the balance the rows before
+// them would leave. A reference_id already applied to the same wallet with the same amount
+// stays valid, applying it again is skipped.
+func validateBatchRows(ctx context.Context, rows []BatchRow) (err error) {
+	type walletState struct {
+		wallet  Wallet
+		err     error
+		balance int
+	}
+	wallets := map[string]*walletState{}
+	references := map[string]int{}
+
+	for i := range rows {
+		row := &rows[i]
+
+		invalid := func(message string) {
+			row.Status = batchRowInvalid
+			row.Error = message
+		}
+
+		amount, convErr := strconv.Atoi(row.Amount)
+		switch {
+		case row.CustomerXID == "":
+			invalid("customer_xid: " + msgRequired)
+			continue
+		case row.Amount == "":
+			invalid("amount: " + msgRequired)
+			continue
+		case convErr != nil:
+			invalid("amount: " + msgInvalidInteger)
+			continue
+		case amount <= 0:
+			invalid("amount: Must be greater than 0.")
+			continue
+		case row.ReferenceID == "":
+			invalid("reference_id: " + msgRequired)
+			continue
+		case row.Type != batchTypeDeposit && row.Type != batchTypePayout:
+			invalid("type: Must be one of: deposit, payout.")
+			continue
+		}
+
+		key := row.Type + "\x00" + row.ReferenceID
+		if line, ok := references[key]; ok {
+			invalid(fmt.Sprintf("reference_id: Already used on line %d.", line))
+			continue
+		}
+		references[key] = row.Line
+
+		state, ok := wallets[row.CustomerXID]
+		if !ok {
+			state = &walletState{}
+			state.wallet, state.err = viewBalance(ctx, row.CustomerXID)
+			if state.err == nil {
+				var main Pocket
+				main, state.err = pocketOf(ctx, state.wallet, "")
+				state.balance = main.Balance
+			}
+			wallets[row.CustomerXID] = state
+		}
+		if state.err != nil {
+			if errorCodeOf(state.err) == codeInternal {
+				return state.err
+			}
+			invalid(state.err.Error())
+			continue
+		}
+
+		existing, lookupErr := getTransactionByReferenceID(ctx, database, row.ReferenceID, row.transactionType())
+		if lookupErr != nil && lookupErr != sql.ErrNoRows {
+			return lookupErr
+		}
+		if existing.ID != "" {
+			if existing.WalletID != state.wallet.ID || existing.Amount != amount {
+				invalid(errDuplicateReference.Error())
+			}
+			continue
+		}
+
+		if row.Type == batchTypePayout {
+			// payouts are withdrawals and pay their fee
+			fee, feeErr := quoteFee(ctx, state.wallet, feeTransactionWithdrawal, amount, time.Now())
+			if feeErr != nil {
+				return feeErr
+			}
+
+			if amount+fee.Amount > state.balance {
+				invalid(errInsufficientFunds.Error())
+				continue
+			}
+			state.balance -= amount + fee.Amount
+		} else {
+			state.balance += amount
+		}
+	}
+
+	return
+}
+
+// CreateBatch -> store an uploaded file after a dry run of every row
+func CreateBatch(ctx context.Context, rows []BatchRow) (batch Batch, err error) {
+	ctx = withOperation(ctx, "create_batch")
+	ctx, span := startSpan(ctx, "CreateBatch", spanKindInternal)
+	span.setAttribute("rows", len(rows))
+	defer func() {
+		span.finish(err)
+	}()
+
+	err = validateBatchRows(ctx, rows)
+	if err != nil {
+		logError(ctx, "CreateBatch validateBatchRows", err)
+		return
+	}
+
+	batch = Batch{
+		ID:         generateUUID(),
+		Status:     batchValidated,
+		CreateTime: time.Now(),
+	}
+	batch.UpdateTime = batch.CreateTime
+
+	for _, row := range rows {
+		if row.Status == batchRowInvalid {
+			batch.Status = batchInvalid
+			break
+		}
+	}
+
+	err = insertBatch(ctx, database, batch, rows)
+	return
+}
+
+// GetBatch -> a batch with its rows counted by status
+func GetBatch(ctx context.Context, batchID string) (batch Batch, counts map[string]int, err error) {
+	batch, err = getBatch(ctx, database, batchID)
+	if err == sql.ErrNoRows {
+		err = errBatchNotFound
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	counts, err = countBatchRows(ctx, database, batchID)
+	return
+}
+
+// batchWorkers -> batches being applied by this process, one worker per batch
+var batchWorkers = struct {
+	sync.Mutex
+	running map[string]bool
+}{running: map[string]bool{}}
+
+// ApplyBatch -> start applying a validated batch in the background. Applying a batch
+// that is already applying resumes it when no worker has it, e.g. after a crash, and
+// applying a completed batch changes nothing.
+func ApplyBatch(ctx context.Context, batchID string) (batch Batch, err error) {
+	ctx = withOperation(ctx, "apply_batch")
+	ctx, span := startSpan(ctx, "ApplyBatch", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	batch, err = getBatch(ctx, database, batchID)
+	if err == sql.ErrNoRows {
+		err = errBatchNotFound
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	switch batch.Status {
+	case batchInvalid:
+		err = errBatchInvalid
+		return
+	case batchCompleted:
+		return
+	case batchValidated:
+		err = updateBatchStatus(ctx, database, batch.ID, batchApplying)
+		if err != nil {
+			return
+		}
+		batch.Status = batchApplying
+	}
+
+	startBatchWorker(batch.ID)
+	return
+}
+
+func startBatchWorker(batchID string) {
+	batchWorkers.Lock()
+	defer batchWorkers.Unlock()
+
+	if batchWorkers.running[batchID] {
+		return
+	}
+	batchWorkers.running[batchID] = true
+
+	go func() {
+		defer func() {
+			batchWorkers.Lock()
+			delete(batchWorkers.running, batchID)
+			batchWorkers.Unlock()
+		}()
+
+		ctx := withOperation(context.Background(), "apply_batch")
+		err := applyBatch(ctx, batchID)
+		if err != nil {
+			logError(ctx, "applyBatch", err, "batch_id", batchID)
+		}
+	}()
+}
+
+// applyBatch -> apply the valid rows chunk by chunk until none are left. Results are saved
+// per chunk, so a crash repeats at most one chunk, and repeating a row is harmless because
+// its reference_id is found already applied.
+func applyBatch(ctx context.Context, batchID string) (err error) {
+	for {
+		var rows []BatchRow
+		rows, err = getBatchRows(ctx, database, batchID, batchRowValid, 0, batchChunkSize)
+		if err != nil {
+			return
+		}
+
+		if len(rows) == 0 {
+			err = updateBatchStatus(ctx, database, batchID, batchCompleted)
+			if err == nil {
+				logInfo(ctx, "batch completed", "batch_id", batchID)
+			}
+			return
+		}
+
+		err = applyBatchChunk(ctx, batchID, rows)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func applyBatchChunk(ctx context.Context, batchID string, rows []BatchRow) (err error) {
+	ctx, span := startSpan(ctx, "ApplyBatchChunk", spanKindInternal)
+	span.setAttribute("rows", len(rows))
+	defer func() {
+		span.finish(err)
+	}()
+
+	done := rows[:0]
+	for _, row := range rows {
+		var rowErr error
+		row, rowErr = applyBatchRow(ctx, row)
+		if rowErr != nil {
+			// the store is failing, save what is done and leave the rest for a resume
+			err = rowErr
+			break
+		}
+		done = append(done, row)
+	}
+
+	saveErr := updateBatchRows(ctx, database, batchID, done)
+	if err == nil {
+		err = saveErr
+	}
+
+	return
+}
+
+// applyBatchRow -> the row with its result, err only when the row could not be tried.
+// The reference_id is looked up first, so a row applied before a crash is skipped
+// whatever the balance is now.
+func applyBatchRow(ctx context.Context, row BatchRow) (result BatchRow, err error) {
+	result = row
+	amount, _ := strconv.Atoi(row.Amount)
+
+	result, done, err := skipAppliedRow(ctx, result, amount)
+	if err != nil || done {
+		return
+	}
+
+	var transaction WalletTransaction
+	if row.transactionType() == withdrawalType {
+		transaction, err = Withdrawal(ctx, row.CustomerXID, row.ReferenceID, amount)
+	} else {
+		transaction, err = Deposit(ctx, row.CustomerXID, row.ReferenceID, amount)
+	}
+
+	// applied by someone else since the lookup
+	if errors.Is(err, errDuplicateReference) {
+		result, _, err = skipAppliedRow(ctx, result, amount)
+		return
+	}
+
+	switch {
+	case err == nil:
+		result.Status = batchRowApplied
+		result.TransactionID = transaction.ID
+	case errorCodeOf(err) != codeInternal:
+		result.Status = batchRowFailed
+		result.Error = err.Error()
+		err = nil
+	}
+
+	return
+}
+
+// skipAppliedRow -> done when the reference_id of the row is already used: skipped when
+// it was this row, failed when it was another wallet or amount
+func skipAppliedRow(ctx context.Context, row BatchRow, amount int) (result BatchRow, done bool, err error) {
+	result = row
+
+	existing, err := getTransactionByReferenceID(ctx, database, row.ReferenceID, row.transactionType())
+	if err == sql.ErrNoRows {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	done = true
+	wallet, err := getWalletByUserID(ctx, database, row.CustomerXID)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = nil
+
+	if existing.WalletID == wallet.ID && existing.Amount == amount {
+		result.Status = batchRowSkipped
+		result.Error = "Already applied"
+		result.TransactionID = existing.ID
+		return
+	}
+
+	result.Status = batchRowFailed
+	result.Error = errDuplicateReference.Error()
+
+	return
+}
+
+// resumeBatches -> restart the workers of batches that were applying when the process stopped
+func resumeBatches(ctx context.Context) {
+	batches, err := getBatchesByStatus(ctx, database, batchApplying)
+	if err != nil {
+		logError(ctx, "resumeBatches getBatchesByStatus", err)
+		return
+	}
+
+	for _, batch := range batches {
+		logInfo(ctx, "resuming batch", "batch_id", batch.ID)
+		startBatchWorker(batch.ID)
+	}
+}
+
+// writeBatchResults -> every row of the batch with its status, as csv
+func writeBatchResults(ctx context.Context, w io.Writer, batchID string) (err error) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"line", "customer_xid", "amount", "reference_id", "type", "status", "transaction_id", "error"})
+
+	line := 0
+	for {
+		var rows []BatchRow
+		rows, err = getBatchRows(ctx, database, batchID, "", line, batchChunkSize*10)
+		if err != nil || len(rows) == 0 {
+			break
+		}
+
+		for _, row := range rows {
+			out.Write([]string{
+				strconv.Itoa(row.Line),
+				row.CustomerXID,
+				row.Amount,
+				row.ReferenceID,
+				row.Type,
+				row.Status,
+				row.TransactionID,
+				row.Error,
+			})
+			line = row.Line
+		}
+	}
+
+	out.Flush()
+	if err == nil {
+		err = out.Error()
+	}
+
+	return
+}
+
+// HandleCreateBatch -> Admin: upload a csv of deposits and payouts, every row is validated
+func HandleCreateBatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	file, errs, err := batchFile(w, r)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	rows, errs := parseBatchFile(file)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	batch, err := CreateBatch(r.Context(), rows)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Status]++
+	}
+
+	response.Data = batchResponse(batch, counts, rows)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// batchFile -> the uploaded csv, sent as the body or as the file field of a form
+func batchFile(w http.ResponseWriter, r *http.Request) (file io.Reader, errs validationErrors, err error) {
+	errs = validationErrors{}
+	r.Body = http.MaxBytesReader(w, r.Body, batchMaxBody)
+
+	var readErr error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case contentTypeCSV:
+		var body []byte
+		body, readErr = io.ReadAll(r.Body)
+		file = bytes.NewReader(body)
+	case "multipart/form-data":
+		file, _, readErr = r.FormFile("file")
+	default:
+		err = errBatchMediaType
+		return
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case readErr == nil:
+	case errors.As(readErr, &tooLarge):
+		errs.add("file", fmt.Sprintf("Must be at most %d MB.", batchMaxBody>>20))
+	case errors.Is(readErr, http.ErrMissingFile):
+		errs.add("file", msgRequired)
+	default:
+		errs.add("file", "Could not read the upload: "+readErr.Error())
+	}
+
+	return
+}
+
+// HandleGetBatch -> Admin: status of a batch and its rows counted by status
+func HandleGetBatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	batch, counts, err := GetBatch(r.Context(), ps.ByName("batch_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	var invalid []BatchRow
+	if batch.Status == batchInvalid {
+		invalid, err = getBatchRows(r.Context(), database, batch.ID, batchRowInvalid, 0, batchMaxErrors)
+		if err != nil {
+			writeError(w, r, &response, err)
+			return
+		}
+	}
+
+	response.Data = batchResponse(batch, counts, invalid)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleApplyBatch -> Admin: apply a validated batch in the background, or resume it
+func HandleApplyBatch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	_, err := ApplyBatch(r.Context(), ps.ByName("batch_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	batch, counts, err := GetBatch(r.Context(), ps.ByName("batch_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = batchResponse(batch, counts, nil)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleGetBatchResults -> Admin: download every row of a batch with its result as csv
+func HandleGetBatchResults(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	batch, _, err := GetBatch(r.Context(), ps.ByName("batch_id"))
+	if err != nil {
+		abortError(w, r, err)
+		return
+	}
+
+	var out bytes.Buffer
+	err = writeBatchResults(r.Context(), &out, batch.ID)
+	if err != nil {
+		abortError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeCSV+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="batch-%s.csv"`, batch.ID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(out.Bytes())
+}
+
+// batchResponse -> rows are listed only when they are invalid, at most batchMaxErrors
+func batchResponse(batch Batch, counts map[string]int, rows []BatchRow) ResponseBatch {
+	response := ResponseBatch{
+		ID:        batch.ID,
+		Status:    batch.Status,
+		Counts:    map[string]int{},
+		Errors:    []ResponseBatchError{},
+		CreatedAt: batch.CreateTime,
+		UpdatedAt: batch.UpdateTime,
+	}
+
+	for _, status := range batchRowStatuses {
+		response.Counts[status] = counts[status]
+		response.Rows += counts[status]
+	}
+
+	for _, row := range rows {
+		if row.Status != batchRowInvalid || len(response.Errors) == batchMaxErrors {
+			continue
+		}
+		response.Errors = append(response.Errors, ResponseBatchError{Line: row.Line, Error: row.Error})
+	}
+
+	return response
+}
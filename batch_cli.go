@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/azzafirdaus/wallet/client"
+)
+
+const batchUsage = `usage: wallet batch [-url URL] <command>
+
+commands:
+  import [-apply] [-out FILE] FILE.csv   upload and validate a batch, -apply also applies it
+  apply [-out FILE] BATCH_ID             apply or resume a validated batch and wait for it
+  status BATCH_ID                        show the status of a batch
+  results [-out FILE] BATCH_ID           download the result file of a batch
+
+The admin token is read from ADMIN_TOKEN, the service URL from -url or WALLET_URL.
+`
+
+// batchPollInterval -> how often the cli checks a batch that is applying
+const batchPollInterval = time.Second
+
+// runBatchCommand -> `wallet batch ...`, returns the exit code
+func runBatchCommand(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, batchUsage) }
+
+	baseURL := os.Getenv("WALLET_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+	flags.StringVar(&baseURL, "url", baseURL, "wallet service url")
+
+	if flags.Parse(args) != nil || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	c := client.New(baseURL, client.WithToken(os.Getenv("ADMIN_TOKEN")))
+
+	var err error
+	command, rest := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "import":
+		err = batchImport(ctx, c, rest)
+	case "apply":
+		err = batchApply(ctx, c, rest)
+	case "status":
+		err = batchStatus(ctx, c, rest)
+	case "results":
+		err = batchResults(ctx, c, rest)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if err == flag.ErrHelp {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// batchArgs -> parse the flags of a command that takes exactly one argument
+func batchArgs(name string, args []string, setup func(*flag.FlagSet)) (arg string, err error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, batchUsage) }
+	if setup != nil {
+		setup(flags)
+	}
+
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		err = flag.ErrHelp
+		return
+	}
+	arg = flags.Arg(0)
+
+	return
+}
+
+func batchImport(ctx context.Context, c *client.Client, args []string) (err error) {
+	var apply bool
+	var out string
+	path, err := batchArgs("import", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&apply, "apply", false, "apply the batch when every row is valid")
+		flags.StringVar(&out, "out", "", "write the result file here")
+	})
+	if err != nil {
+		return
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	batch, err := c.CreateBatch(ctx, file)
+	if err != nil {
+		return
+	}
+	printBatch(batch)
+
+	if batch.Status == batchInvalid {
+		for _, e := range batch.Errors {
+			fmt.Printf("  line %d: %s\n", e.Line, e.Error)
+		}
+		if len(batch.Errors) < batch.Counts[batchRowInvalid] {
+			fmt.Printf("  ... %d more, see the result file\n", batch.Counts[batchRowInvalid]-len(batch.Errors))
+		}
+		if out != "" {
+			err = saveBatchResults(ctx, c, batch.ID, out)
+		}
+		if err == nil {
+			err = fmt.Errorf("batch %s has invalid rows", batch.ID)
+		}
+		return
+	}
+
+	if !apply {
+		fmt.Printf("dry run ok, apply with: wallet batch apply %s\n", batch.ID)
+		return
+	}
+
+	return applyAndWait(ctx, c, batch.ID, out)
+}
+
+func batchApply(ctx context.Context, c *client.Client, args []string) (err error) {
+	var out string
+	batchID, err := batchArgs("apply", args, func(flags *flag.FlagSet) {
+		flags.StringVar(&out, "out", "", "write the result file here")
+	})
+	if err != nil {
+		return
+	}
+
+	return applyAndWait(ctx, c, batchID, out)
+}
+
+// applyAndWait -> apply the batch, poll it until it is completed and save the result file
+func applyAndWait(ctx context.Context, c *client.Client, batchID, out string) (err error) {
+	batch, err := c.ApplyBatch(ctx, batchID)
+	if err != nil {
+		return
+	}
+
+	for batch.Status != batchCompleted {
+		printBatch(batch)
+		time.Sleep(batchPollInterval)
+
+		batch, err = c.Batch(ctx, batchID)
+		if err != nil {
+			return
+		}
+	}
+	printBatch(batch)
+
+	if out == "" {
+		out = "batch-" + batchID + ".csv"
+	}
+
+	return saveBatchResults(ctx, c, batchID, out)
+}
+
+func batchStatus(ctx context.Context, c *client.Client, args []string) (err error) {
+	batchID, err := batchArgs("status", args, nil)
+	if err != nil {
+		return
+	}
+
+	batch, err := c.Batch(ctx, batchID)
+	if err != nil {
+		return
+	}
+	printBatch(batch)
+
+	for _, e := range batch.Errors {
+		fmt.Printf("  line %d: %s\n", e.Line, e.Error)
+	}
+
+	return
+}
+
+func batchResults(ctx context.Context, c *client.Client, args []string) (err error) {
+	var out string
+	batchID, err := batchArgs("results", args, func(flags *flag.FlagSet) {
+		flags.StringVar(&out, "out", "", "write the result file here instead of stdout")
+	})
+	if err != nil {
+		return
+	}
+
+	if out != "" {
+		return saveBatchResults(ctx, c, batchID, out)
+	}
+
+	content, err := c.BatchResults(ctx, batchID)
+	if err != nil {
+		return
+	}
+
+	_, err = os.Stdout.Write(content)
+	return
+}
+
+func saveBatchResults(ctx context.Context, c *client.Client, batchID, path string) (err error) {
+	content, err := c.BatchResults(ctx, batchID)
+	if err != nil {
+		return
+	}
+
+	err = os.WriteFile(path, content, 0644)
+	if err == nil {
+		fmt.Println("results written to", path)
+	}
+
+	return
+}
+
+func printBatch(batch *client.Batch) {
+	fmt.Printf("batch %s %s: %d rows", batch.ID, batch.Status, batch.Rows)
+	for _, status := range batchRowStatuses {
+		if batch.Counts[status] > 0 {
+			fmt.Printf(", %d %s", batch.Counts[status], status)
+		}
+	}
+	fmt.Println()
+}
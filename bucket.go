@@ -0,0 +1,661 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Buckets split the balance of a wallet by where the money came from. Promo and refund
+// credits are buckets of their own, with an expiry or none, and the rest of the balance
+// is cash. Every debit takes from the bucket that expires first, then from the ones that
+// never do, then from cash. The expiry sweep debits what is left of an expired bucket as
+// an expiry transaction into the breakage system account.
+
+const (
+	bucketSourceCash   = "cash"
+	bucketSourcePromo  = "promo"
+	bucketSourceRefund = "refund"
+
+	creditReferencePrefix = "credit:"
+	expiryReferencePrefix = "expiry:"
+
+	maxCreditDays = 3650
+
+	// bucketExpiryPoll -> how often expired buckets are swept
+	bucketExpiryPoll = 5 * time.Minute
+)
+
+// creditTypes -> the transaction type a credit of each source is written as
+var creditTypes = map[string]int{
+	bucketSourcePromo:  promoType,
+	bucketSourceRefund: depositType,
+}
+
+// BalanceBucket -> a credit of Amount to a wallet, Remaining of it not spent yet. ExpireTime
+// is zero for a credit that does not expire.
+type BalanceBucket struct {
+	ID            string    `db:"id"`
+	WalletID      string    `db:"wallet_id"`
+	Source        string    `db:"source"`
+	Amount        int       `db:"amount"`
+	Remaining     int       `db:"remaining"`
+	ExpireTime    time.Time `db:"expire_time"`
+	TransactionID string    `db:"transaction_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// Expires -> the bucket has an expiry
+func (b BalanceBucket) Expires() bool {
+	return !b.ExpireTime.IsZero()
+}
+
+const (
+	createBalanceBucketTable = `
+		CREATE TABLE IF NOT EXISTS balance_bucket (
+			id TEXT NOT NULL PRIMARY KEY,
+			wallet_id TEXT NOT NULL,
+			source TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			remaining INTEGER NOT NULL,
+			expire_time DATETIME,
+			transaction_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertBalanceBucketSQL = `
+		INSERT INTO balance_bucket
+			(id, wallet_id, source, amount, remaining, expire_time, transaction_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	selectBalanceBucketSQL = `
+		SELECT
+			id,
+			wallet_id,
+			source,
+			amount,
+			remaining,
+			expire_time,
+			transaction_id,
+			create_time
+		FROM
+			balance_bucket
+	`
+
+	// getBucketsToUseSQL -> buckets with money left, soonest expiry first and the ones that
+	// never expire last
+	getBucketsToUseSQL = selectBalanceBucketSQL + `
+		WHERE
+			wallet_id = $1 AND
+			remaining > 0
+		ORDER BY
+			expire_time IS NULL,
+			julianday(expire_time),
+			julianday(create_time),
+			rowid
+	`
+
+	getExpiredBucketsSQL = selectBalanceBucketSQL + `
+		WHERE
+			wallet_id = $1 AND
+			remaining > 0 AND
+			julianday(expire_time) <= julianday($2)
+		ORDER BY
+			julianday(expire_time),
+			rowid
+	`
+
+	getWalletsWithExpiredBucketsSQL = `
+		SELECT DISTINCT
+			wallet_id
+		FROM
+			balance_bucket
+		WHERE
+			remaining > 0 AND
+			julianday(expire_time) <= julianday($1)
+	`
+
+	useBalanceBucketSQL = `
+		UPDATE
+			balance_bucket
+		SET
+			remaining = remaining - $1
+		WHERE
+			id = $2
+	`
+
+	getWalletBalanceSQL = `
+		SELECT
+			balance
+		FROM
+			wallet
+		WHERE
+			id = $1
+	`
+
+	// getExpiryPocketsSQL -> the pockets an expiry may take from, main first, savings goals
+	// left out
+	getExpiryPocketsSQL = selectPocketSQL + `
+		WHERE
+			wallet_id = $1 AND
+			id NOT IN (SELECT pocket_id FROM goal)
+		ORDER BY
+			main DESC,
+			create_time
+	`
+)
+
+func scanBalanceBucket(scanner interface{ Scan(...interface{}) error }) (bucket BalanceBucket, err error) {
+	var expireTime sql.NullTime
+	err = scanner.Scan(
+		&bucket.ID,
+		&bucket.WalletID,
+		&bucket.Source,
+		&bucket.Amount,
+		&bucket.Remaining,
+		&expireTime,
+		&bucket.TransactionID,
+		&bucket.CreateTime,
+	)
+	bucket.ExpireTime = expireTime.Time
+
+	return
+}
+
+// queryBalanceBuckets -> the buckets of query in tx, read in full before any of them is changed
+func queryBalanceBuckets(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (buckets []BalanceBucket, err error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logError(ctx, "queryBalanceBuckets QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket BalanceBucket
+		bucket, err = scanBalanceBucket(rows)
+		if err != nil {
+			logError(ctx, "queryBalanceBuckets Scan", err)
+			return
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// insertBalanceBucket -> bucket in tx, for the credit transaction it was written with
+func insertBalanceBucket(ctx context.Context, tx *sql.Tx, bucket BalanceBucket) (err error) {
+	var expireTime sql.NullTime
+	if bucket.Expires() {
+		expireTime = sql.NullTime{Time: bucket.ExpireTime, Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertBalanceBucketSQL,
+		bucket.ID,
+		bucket.WalletID,
+		bucket.Source,
+		bucket.Amount,
+		bucket.Remaining,
+		expireTime,
+		bucket.TransactionID,
+		bucket.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertBalanceBucket ExecContext", err)
+	}
+
+	return
+}
+
+// useBalanceBuckets -> take up to amount from the buckets of the wallet in tx, soonest
+// expiry first. What the buckets do not cover is cash.
+func useBalanceBuckets(ctx context.Context, tx *sql.Tx, walletID string, amount int) (used int, err error) {
+	buckets, err := queryBalanceBuckets(ctx, tx, getBucketsToUseSQL, walletID)
+	if err != nil {
+		return
+	}
+
+	for _, bucket := range buckets {
+		if used == amount {
+			break
+		}
+
+		take := min(bucket.Remaining, amount-used)
+		_, err = tx.ExecContext(ctx, useBalanceBucketSQL, take, bucket.ID)
+		if err != nil {
+			logError(ctx, "useBalanceBuckets ExecContext", err)
+			return
+		}
+		used += take
+	}
+
+	return
+}
+
+// creditBalance -> credit bucket.Amount to the wallet as a transaction of the type of its
+// source, paid from the promotions system account, and keep it as a bucket, in one tx
+func creditBalance(ctx context.Context, db *sql.DB, bucket *BalanceBucket) (transaction WalletTransaction, err error) {
+	defer observeQuery("creditBalance", time.Now())
+	ctx, span := startQuerySpan(ctx, "creditBalance")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "creditBalance BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	transaction, event, err := applyBalanceChange(ctx, tx, bucket.WalletID, "", creditReferencePrefix+bucket.ID, bucket.Amount, creditTypes[bucket.Source])
+	if err != nil {
+		return
+	}
+	bucket.TransactionID = transaction.ID
+	bucket.CreateTime = transaction.CreateTime
+
+	err = insertBalanceBucket(ctx, tx, *bucket)
+	if err != nil {
+		return
+	}
+
+	entry := SystemEntry{
+		AccountID:     systemAccountPromotions,
+		Amount:        -bucket.Amount,
+		WalletID:      bucket.WalletID,
+		TransactionID: transaction.ID,
+		ReferenceID:   bucket.ID,
+		CreateTime:    transaction.CreateTime,
+	}
+	err = postSystemEntry(ctx, tx, &entry)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "creditBalance Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// fillMainPocket -> move money from the other pockets of the wallet that are not savings
+// goals into its main pocket in tx until the main pocket holds amount, or they are empty.
+// available is what the main pocket holds then.
+func fillMainPocket(ctx context.Context, tx *sql.Tx, walletID string, amount int) (available int, err error) {
+	rows, err := tx.QueryContext(ctx, getExpiryPocketsSQL, walletID)
+	if err != nil {
+		logError(ctx, "fillMainPocket QueryContext", err)
+		return
+	}
+
+	pockets, err := scanPockets(rows)
+	rows.Close()
+	if err != nil {
+		logError(ctx, "fillMainPocket Scan", err)
+		return
+	}
+
+	// main pocket first
+	available = pockets[0].Balance
+	for _, pocket := range pockets[1:] {
+		short := amount - available
+		if short <= 0 {
+			break
+		}
+
+		move := min(pocket.Balance, short)
+		if move <= 0 {
+			continue
+		}
+
+		_, _, err = movePocketBalanceTx(ctx, tx, pocket.ID, pockets[0].ID, move, "")
+		if err != nil {
+			return
+		}
+		available += move
+	}
+
+	return
+}
+
+// expireBuckets -> debit what is left of the expired buckets of one wallet into breakage,
+// one expiry transaction per bucket, in its own tx. The money is taken from the main pocket,
+// topped up from the others when they hold part of it. Savings goals are never taken from,
+// what only they hold is not expired.
+func expireBuckets(ctx context.Context, db *sql.DB, walletID string, now time.Time) (expired int, err error) {
+	defer observeQuery("expireBuckets", time.Now())
+	ctx, span := startQuerySpan(ctx, "expireBuckets")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "expireBuckets BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	buckets, err := queryBalanceBuckets(ctx, tx, getExpiredBucketsSQL, walletID, now)
+	if err != nil {
+		return
+	}
+
+	var events []walletEvent
+	for _, bucket := range buckets {
+		var balance int
+		err = tx.QueryRowContext(ctx, getWalletBalanceSQL, walletID).Scan(&balance)
+		if err != nil {
+			logError(ctx, "expireBuckets balance", err)
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, useBalanceBucketSQL, bucket.Remaining, bucket.ID)
+		if err != nil {
+			logError(ctx, "expireBuckets use bucket", err)
+			return
+		}
+
+		// debits use buckets first, so the balance holds them unless it was adjusted by hand
+		amount := min(bucket.Remaining, balance)
+		if amount <= 0 {
+			continue
+		}
+
+		var available int
+		available, err = fillMainPocket(ctx, tx, walletID, amount)
+		if err != nil {
+			return
+		}
+
+		amount = min(amount, available)
+		if amount <= 0 {
+			continue
+		}
+
+		var (
+			transaction WalletTransaction
+			event       walletEvent
+		)
+		transaction, event, err = applyBalanceChange(ctx, tx, walletID, "", expiryReferencePrefix+bucket.ID, amount, expiryType)
+		if err != nil {
+			return
+		}
+
+		entry := SystemEntry{
+			AccountID:     systemAccountBreakage,
+			Amount:        amount,
+			WalletID:      walletID,
+			TransactionID: transaction.ID,
+			ReferenceID:   bucket.ID,
+			CreateTime:    transaction.CreateTime,
+		}
+		err = postSystemEntry(ctx, tx, &entry)
+		if err != nil {
+			return
+		}
+
+		events = append(events, event)
+		expired += amount
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "expireBuckets Commit", err)
+		return
+	}
+
+	for _, event := range events {
+		publishWalletEvent(ctx, event)
+	}
+
+	return
+}
+
+func getWalletsWithExpiredBuckets(ctx context.Context, db *sql.DB, now time.Time) (walletIDs []string, err error) {
+	defer observeQuery("getWalletsWithExpiredBuckets", time.Now())
+	ctx, span := startQuerySpan(ctx, "getWalletsWithExpiredBuckets")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getWalletsWithExpiredBucketsSQL, now)
+	if err != nil {
+		logError(ctx, "getWalletsWithExpiredBuckets QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var walletID string
+		err = rows.Scan(&walletID)
+		if err != nil {
+			logError(ctx, "getWalletsWithExpiredBuckets Scan", err)
+			return
+		}
+
+		walletIDs = append(walletIDs, walletID)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// getBalanceBuckets -> the buckets of the wallet with money left, in the order debits use them
+func getBalanceBuckets(ctx context.Context, db *sql.DB, walletID string) (buckets []BalanceBucket, err error) {
+	defer observeQuery("getBalanceBuckets", time.Now())
+	ctx, span := startQuerySpan(ctx, "getBalanceBuckets")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getBucketsToUseSQL, walletID)
+	if err != nil {
+		logError(ctx, "getBalanceBuckets QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket BalanceBucket
+		bucket, err = scanBalanceBucket(rows)
+		if err != nil {
+			logError(ctx, "getBalanceBuckets Scan", err)
+			return
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// bucketExpiry -> sweeps the expired buckets of every wallet every poll
+type bucketExpiry struct {
+	clock clock
+	poll  time.Duration
+}
+
+func newBucketExpiry(c clock) *bucketExpiry {
+	return &bucketExpiry{clock: c, poll: bucketExpiryPoll}
+}
+
+var walletBucketExpiry = newBucketExpiry(systemClock{})
+
+// run -> sweep now and then every poll, until ctx is done
+func (e *bucketExpiry) run(ctx context.Context) {
+	for {
+		e.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(e.poll):
+		}
+	}
+}
+
+// sweep -> expire the buckets that expired by now, one wallet at a time
+func (e *bucketExpiry) sweep(ctx context.Context) {
+	ctx = withOperation(ctx, "bucket_expiry")
+	now := e.clock.Now()
+
+	walletIDs, err := getWalletsWithExpiredBuckets(ctx, database, now)
+	if err != nil {
+		logError(ctx, "bucketExpiry getWalletsWithExpiredBuckets", err)
+		return
+	}
+
+	for _, walletID := range walletIDs {
+		expired, err := expireBuckets(ctx, database, walletID, now)
+		if err != nil {
+			logError(ctx, "bucketExpiry expireBuckets", err)
+			continue
+		}
+
+		logInfo(ctx, "balance buckets expired", "wallet_id", walletID, "amount", expired)
+	}
+}
+
+// creditFromRequest -> the bucket of the request, or the fields that are wrong
+func creditFromRequest(req RequestCredit, now time.Time) (bucket BalanceBucket, errs validationErrors) {
+	errs = validationErrors{}
+
+	bucket = BalanceBucket{
+		ID:        generateUUID(),
+		Source:    req.Source,
+		Amount:    req.Amount,
+		Remaining: req.Amount,
+	}
+
+	if _, ok := creditTypes[bucket.Source]; !ok {
+		errs.add("source", "Must be promo or refund.")
+	}
+
+	if req.ExpiresAt != "" {
+		expireTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		switch {
+		case err != nil:
+			errs.add("expires_at", "Not a valid RFC 3339 time, e.g. 2026-12-31T23:59:59Z.")
+		case !expireTime.After(now):
+			errs.add("expires_at", "Must be in the future.")
+		}
+		bucket.ExpireTime = expireTime
+	}
+
+	return
+}
+
+// CreditWallet -> credit the enabled wallet of the user with bucket, as a promo or refund credit
+func CreditWallet(ctx context.Context, userID string, bucket BalanceBucket) (credited BalanceBucket, transaction WalletTransaction, err error) {
+	ctx = withOperation(ctx, "credit_wallet")
+	ctx, span := startSpan(ctx, "CreditWallet", spanKindInternal)
+	span.setAttribute("source", bucket.Source)
+	defer func() {
+		observeWalletResult("credit_wallet", transaction.Amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+	bucket.WalletID = wallet.ID
+
+	transaction, err = creditBalance(ctx, database, &bucket)
+	if err != nil {
+		return
+	}
+
+	return bucket, transaction, nil
+}
+
+// HandleCreditWallet -> Admin: credit a wallet with promo or refund money that may expire
+func HandleCreditWallet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestCredit
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	bucket, errs := creditFromRequest(req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	bucket, transaction, err := CreditWallet(r.Context(), ps.ByName("user_id"), bucket)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseCredit{
+		Deposit: ResponseDepositDetail{
+			ID:          transaction.ID,
+			DepositedBy: ps.ByName("user_id"),
+			Status:      statusSuccess,
+			DepositedAt: transaction.CreateTime,
+			Amount:      transaction.Amount,
+			ReferenceID: transaction.ReferenceID,
+		},
+		Type:   transaction.TypeName(),
+		Bucket: bucketResponse(bucket),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func bucketResponse(bucket BalanceBucket) ResponseBucketDetail {
+	detail := ResponseBucketDetail{
+		ID:            bucket.ID,
+		Source:        bucket.Source,
+		Amount:        bucket.Remaining,
+		TransactionID: bucket.TransactionID,
+	}
+	if bucket.Expires() {
+		detail.ExpiresAt = &bucket.ExpireTime
+	}
+
+	return detail
+}
+
+// bucketsResponse -> cash first, then the buckets in the order debits use them
+func bucketsResponse(balance int, buckets []BalanceBucket) []ResponseBucketDetail {
+	cash := balance
+	for _, bucket := range buckets {
+		cash -= bucket.Remaining
+	}
+
+	details := []ResponseBucketDetail{{Source: bucketSourceCash, Amount: max(cash, 0)}}
+	for _, bucket := range buckets {
+		details = append(details, bucketResponse(bucket))
+	}
+
+	return details
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestExpireBucketsSkipsGoals -> an expired credit is taken from the main pocket and the
+// plain pockets, never from a savings goal
+func TestExpireBucketsSkipsGoals(t *testing.T) {
+	ctx := context.Background()
+	userID := fundedWallet(t, 200)
+	now := time.Now()
+
+	credit, errs := creditFromRequest(RequestCredit{
+		Source:    bucketSourcePromo,
+		Amount:    500,
+		ExpiresAt: now.Add(time.Hour).Format(time.RFC3339),
+	}, now)
+	if len(errs) > 0 {
+		t.Fatalf("creditFromRequest: %v", errs)
+	}
+	_, _, err := CreditWallet(ctx, userID, credit)
+	if err != nil {
+		t.Fatalf("CreditWallet: %v", err)
+	}
+
+	goal, errs := goalFromRequest(RequestGoal{
+		Name:         "holiday",
+		TargetAmount: 1000,
+		TargetDate:   now.AddDate(1, 0, 0).Format(goalDateFormat),
+	}, now)
+	if len(errs) > 0 {
+		t.Fatalf("goalFromRequest: %v", errs)
+	}
+	goal, err = CreateGoal(ctx, userID, goal)
+	if err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+
+	spare, err := CreatePocket(ctx, userID, "spare")
+	if err != nil {
+		t.Fatalf("CreatePocket: %v", err)
+	}
+
+	// main 50, spare 50, goal 600 of the 700
+	for pocketID, amount := range map[string]int{goal.PocketID: 600, spare.ID: 50} {
+		_, _, err = MovePocketMoney(ctx, userID, mainPocketAlias, pocketID, amount)
+		if err != nil {
+			t.Fatalf("MovePocketMoney: %v", err)
+		}
+	}
+
+	wallet, _, _, err := ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+
+	expired, err := expireBuckets(ctx, database, wallet.ID, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("expireBuckets: %v", err)
+	}
+	if expired != 100 {
+		t.Errorf("expired %d, want the 100 outside the goal", expired)
+	}
+
+	wallet, pockets, _, err := ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+	if wallet.Balance != 600 {
+		t.Errorf("balance %d, want 600", wallet.Balance)
+	}
+	for _, pocket := range pockets {
+		want := 0
+		if pocket.ID == goal.PocketID {
+			want = 600
+		}
+		if pocket.Balance != want {
+			t.Errorf("pocket %s: balance %d, want %d", pocket.Name, pocket.Balance, want)
+		}
+	}
+}
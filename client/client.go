@@ -0,0 +1,1243 @@
+// Package client is the Go client of the wallet service.
+//
+//	c := client.New("http://localhost:8000")
+//	token, err := c.Init(ctx, "ea0212d3-abd6-406f-8c67-868e814a2436")
+//	c = c.Session(token)
+//	wallet, err := c.EnableWallet(ctx)
+//
+// Calls that change state send an Idempotency-Key, so they are retried on
+// network errors, 429 and 5xx without being applied twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 100 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+// Client -> wallet service client, safe for concurrent use
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option -> configures a Client in New
+type Option func(*Client)
+
+// WithToken -> session token from Init, ADMIN_TOKEN for the admin calls or the API key of a
+// merchant for the merchant calls
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient -> http client used for every call, http.DefaultClient by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries -> retry a failed call up to maxRetries times, waiting backoff, 2*backoff, ...
+// in between. Zero maxRetries disables retries.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// New -> client for the service at baseURL, e.g. "http://localhost:8000"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Session -> copy of c authorized with token
+func (c *Client) Session(token string) *Client {
+	session := *c
+	session.token = token
+
+	return &session
+}
+
+// Init -> create the account of customerXID and return its session token
+func (c *Client) Init(ctx context.Context, customerXID string) (token string, err error) {
+	var data struct {
+		Token string `json:"token"`
+	}
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/init", url.Values{"customer_xid": {customerXID}}, true, &data)
+	token = data.Token
+
+	return
+}
+
+// EnableWallet -> create or enable the wallet of the session
+func (c *Client) EnableWallet(ctx context.Context) (wallet *Wallet, err error) {
+	return c.wallet(ctx, http.MethodPost, nil)
+}
+
+// Balance -> the wallet of the session, fails with WALLET_DISABLED when it is disabled
+func (c *Client) Balance(ctx context.Context) (wallet *Wallet, err error) {
+	return c.wallet(ctx, http.MethodGet, nil)
+}
+
+// Disable -> disable the wallet of the session
+func (c *Client) Disable(ctx context.Context) (wallet *Wallet, err error) {
+	return c.wallet(ctx, http.MethodPatch, url.Values{"is_disabled": {"true"}})
+}
+
+func (c *Client) wallet(ctx context.Context, method string, form url.Values) (wallet *Wallet, err error) {
+	var data struct {
+		Wallet Wallet `json:"wallet"`
+	}
+
+	err = c.do(ctx, method, "/api/v1/wallet", form, method != http.MethodGet, &data)
+	if err != nil {
+		return
+	}
+	wallet = &data.Wallet
+
+	return
+}
+
+// Deposit -> add amount to the wallet, referenceID must be unique per wallet
+func (c *Client) Deposit(ctx context.Context, amount int, referenceID string) (deposit *Deposit, err error) {
+	var data struct {
+		Deposit Deposit `json:"deposit"`
+	}
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/deposits", balanceChange(amount, referenceID), true, &data)
+	if err != nil {
+		return
+	}
+	deposit = &data.Deposit
+
+	return
+}
+
+// Withdraw -> take amount from the wallet, referenceID must be unique per wallet
+func (c *Client) Withdraw(ctx context.Context, amount int, referenceID string) (withdrawal *Withdrawal, err error) {
+	var data struct {
+		Withdrawal Withdrawal `json:"withdrawal"`
+	}
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/withdrawals", balanceChange(amount, referenceID), true, &data)
+	if err != nil {
+		return
+	}
+	withdrawal = &data.Withdrawal
+
+	return
+}
+
+// Transfer -> send amount to the wallet of toUserID, referenceID must be unique across transfers
+func (c *Client) Transfer(ctx context.Context, toUserID string, amount int, referenceID string) (transfer *Transfer, err error) {
+	var data struct {
+		Transfer Transfer `json:"transfer"`
+	}
+
+	form := balanceChange(amount, referenceID)
+	form.Set("to_user_id", toUserID)
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/transfers", form, true, &data)
+	if err != nil {
+		return
+	}
+	transfer = &data.Transfer
+
+	return
+}
+
+// Transactions -> latest transactions of the wallet, newest first, limit 0 uses the server default
+func (c *Client) Transactions(ctx context.Context, limit int) (transactions []Transaction, err error) {
+	var data struct {
+		Transactions []Transaction `json:"transactions"`
+	}
+
+	path := "/api/v1/wallet/transactions"
+	if limit > 0 {
+		path += "?" + url.Values{"limit": {strconv.Itoa(limit)}}.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	transactions = data.Transactions
+
+	return
+}
+
+// QuoteFee -> the fee the wallet would pay now on amount, transactionType is "withdrawal"
+// or "transfer"
+func (c *Client) QuoteFee(ctx context.Context, transactionType string, amount int) (quote *FeeQuote, err error) {
+	var data FeeQuote
+
+	path := "/api/v1/wallet/fees/quote?" + url.Values{
+		"transaction_type": {transactionType},
+		"amount":           {strconv.Itoa(amount)},
+	}.Encode()
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	if err != nil {
+		return
+	}
+	quote = &data
+
+	return
+}
+
+// RedeemVoucher -> credit the amount of a voucher code to the wallet as a promo transaction,
+// IsCode(err, CodeVoucherUnavailable) once it was redeemed, expired or ran out of budget
+func (c *Client) RedeemVoucher(ctx context.Context, code string) (redemption *VoucherRedemption, err error) {
+	var data VoucherRedemption
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/vouchers/redeem", url.Values{"code": {code}}, true, &data)
+	if err != nil {
+		return
+	}
+	redemption = &data
+
+	return
+}
+
+// WithdrawAtMerchant -> Withdraw with the merchant category that picks the points rule
+func (c *Client) WithdrawAtMerchant(ctx context.Context, merchantCategory string, amount int, referenceID string) (withdrawal *Withdrawal, err error) {
+	var data struct {
+		Withdrawal Withdrawal `json:"withdrawal"`
+	}
+
+	form := balanceChange(amount, referenceID)
+	form.Set("merchant_category", merchantCategory)
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/withdrawals", form, true, &data)
+	if err != nil {
+		return
+	}
+	withdrawal = &data.Withdrawal
+
+	return
+}
+
+// Points -> points of the wallet and the latest entries, limit 0 uses the server default
+func (c *Client) Points(ctx context.Context, limit int) (points *Points, err error) {
+	var data Points
+
+	path := "/api/v1/wallet/points"
+	if limit > 0 {
+		path += "?" + url.Values{"limit": {strconv.Itoa(limit)}}.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	if err != nil {
+		return
+	}
+	points = &data
+
+	return
+}
+
+// RedeemPoints -> turn points into balance at the point value, as a cashback transaction
+func (c *Client) RedeemPoints(ctx context.Context, points int) (redemption *PointsRedemption, err error) {
+	var data PointsRedemption
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/points/redeem", url.Values{"points": {strconv.Itoa(points)}}, true, &data)
+	if err != nil {
+		return
+	}
+	redemption = &data
+
+	return
+}
+
+// RequestPayment -> ask other customers for a share each, e.g. to split a bill
+func (c *Client) RequestPayment(ctx context.Context, request NewPaymentRequest) (created *PaymentRequest, err error) {
+	payers := make([]string, 0, len(request.Payers))
+	for _, payer := range request.Payers {
+		payers = append(payers, payer.PayerID+":"+strconv.Itoa(payer.Amount))
+	}
+
+	form := url.Values{"payers": {strings.Join(payers, ",")}}
+	if request.Description != "" {
+		form.Set("description", request.Description)
+	}
+	if !request.ExpiresAt.IsZero() {
+		form.Set("expires_at", request.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	return c.paymentRequest(ctx, http.MethodPost, "/api/v1/wallet/payment-requests", form, true)
+}
+
+// PaymentRequests -> the latest payment requests the wallet owner sent, or was asked to pay
+// when received is set, limit 0 uses the server default
+func (c *Client) PaymentRequests(ctx context.Context, received bool, limit int) (requests []PaymentRequest, err error) {
+	var data struct {
+		Requests []PaymentRequest `json:"requests"`
+	}
+
+	query := url.Values{}
+	if received {
+		query.Set("role", "received")
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	path := "/api/v1/wallet/payment-requests"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	requests = data.Requests
+
+	return
+}
+
+// PaymentRequest -> a payment request with every share for its requester, with the share of
+// the wallet owner only for a payer
+func (c *Client) PaymentRequest(ctx context.Context, requestID string) (request *PaymentRequest, err error) {
+	return c.paymentRequest(ctx, http.MethodGet, paymentRequestPath(requestID), nil, false)
+}
+
+// AcceptPaymentRequest -> pay the share of the wallet owner as a transfer to the requester,
+// IsCode(err, CodePaymentUnavailable) once it was answered or the request is no longer open
+func (c *Client) AcceptPaymentRequest(ctx context.Context, requestID string) (request *PaymentRequest, transfer *Transfer, err error) {
+	var data struct {
+		Request  PaymentRequest `json:"request"`
+		Transfer Transfer       `json:"transfer"`
+	}
+
+	err = c.do(ctx, http.MethodPost, paymentRequestPath(requestID)+"/accept", nil, true, &data)
+	if err != nil {
+		return
+	}
+	request = &data.Request
+	transfer = &data.Transfer
+
+	return
+}
+
+// DeclinePaymentRequest -> turn down the share of the wallet owner
+func (c *Client) DeclinePaymentRequest(ctx context.Context, requestID string) (request *PaymentRequest, err error) {
+	return c.paymentRequest(ctx, http.MethodPost, paymentRequestPath(requestID)+"/decline", nil, false)
+}
+
+// CancelPaymentRequest -> withdraw an open payment request, the shares paid stay paid
+func (c *Client) CancelPaymentRequest(ctx context.Context, requestID string) (request *PaymentRequest, err error) {
+	return c.paymentRequest(ctx, http.MethodPost, paymentRequestPath(requestID)+"/cancel", nil, false)
+}
+
+func paymentRequestPath(requestID string) string {
+	return "/api/v1/wallet/payment-requests/" + url.PathEscape(requestID)
+}
+
+func (c *Client) paymentRequest(ctx context.Context, method, path string, form url.Values, withKey bool) (request *PaymentRequest, err error) {
+	var data struct {
+		Request PaymentRequest `json:"request"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	request = &data.Request
+
+	return
+}
+
+// CreateEscrow -> hold money of the wallet owner for a seller until it is released,
+// refunded or it expires after 14 days when ExpiresAt is zero
+func (c *Client) CreateEscrow(ctx context.Context, escrow NewEscrow) (created *Escrow, err error) {
+	form := url.Values{
+		"seller_id": {escrow.SellerID},
+		"amount":    {strconv.Itoa(escrow.Amount)},
+	}
+	if escrow.Description != "" {
+		form.Set("description", escrow.Description)
+	}
+	if !escrow.ExpiresAt.IsZero() {
+		form.Set("expires_at", escrow.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	return c.escrow(ctx, http.MethodPost, "/api/v1/wallet/escrows", form, true)
+}
+
+// Escrows -> the latest escrows the wallet owner buys, or sells when selling is set, limit 0
+// uses the server default
+func (c *Client) Escrows(ctx context.Context, selling bool, limit int) (escrows []Escrow, err error) {
+	var data struct {
+		Escrows []Escrow `json:"escrows"`
+	}
+
+	query := url.Values{}
+	if selling {
+		query.Set("role", "seller")
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	path := "/api/v1/wallet/escrows"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	escrows = data.Escrows
+
+	return
+}
+
+// Escrow -> an escrow the wallet owner buys or sells, with its history
+func (c *Client) Escrow(ctx context.Context, escrowID string) (escrow *Escrow, err error) {
+	return c.escrow(ctx, http.MethodGet, escrowPath(escrowID), nil, false)
+}
+
+// ReleaseEscrow -> as the buyer, pay the seller, IsCode(err, CodeEscrowUnavailable) once it
+// was released or refunded or while it is disputed
+func (c *Client) ReleaseEscrow(ctx context.Context, escrowID, note string) (escrow *Escrow, err error) {
+	return c.escrow(ctx, http.MethodPost, escrowPath(escrowID)+"/release", noteForm(note), true)
+}
+
+// RefundEscrow -> as the seller, give the money back to the buyer
+func (c *Client) RefundEscrow(ctx context.Context, escrowID, note string) (escrow *Escrow, err error) {
+	return c.escrow(ctx, http.MethodPost, escrowPath(escrowID)+"/refund", noteForm(note), true)
+}
+
+// DisputeEscrow -> hold a funded escrow for an admin to decide, for the reason given
+func (c *Client) DisputeEscrow(ctx context.Context, escrowID, reason string) (escrow *Escrow, err error) {
+	return c.escrow(ctx, http.MethodPost, escrowPath(escrowID)+"/dispute", noteForm(reason), false)
+}
+
+// ResolveEscrow -> admin: release a funded or disputed escrow to the seller, or refund it to
+// the buyer when refund is set, note is kept in its history
+func (c *Client) ResolveEscrow(ctx context.Context, escrowID string, refund bool, note string) (escrow *Escrow, err error) {
+	form := url.Values{"outcome": {"release"}, "note": {note}}
+	if refund {
+		form.Set("outcome", "refund")
+	}
+
+	return c.escrow(ctx, http.MethodPost, "/api/v1/admin/escrows/"+url.PathEscape(escrowID)+"/resolve", form, false)
+}
+
+func escrowPath(escrowID string) string {
+	return "/api/v1/wallet/escrows/" + url.PathEscape(escrowID)
+}
+
+func noteForm(note string) url.Values {
+	if note == "" {
+		return nil
+	}
+
+	return url.Values{"note": {note}}
+}
+
+func (c *Client) escrow(ctx context.Context, method, path string, form url.Values, withKey bool) (escrow *Escrow, err error) {
+	var data struct {
+		Escrow Escrow `json:"escrow"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	escrow = &data.Escrow
+
+	return
+}
+
+// OpenDispute -> contest a withdrawal or a fee of the wallet owner, for all of it when
+// Amount is zero
+func (c *Client) OpenDispute(ctx context.Context, dispute NewDispute) (opened *Dispute, err error) {
+	form := url.Values{
+		"transaction_id": {dispute.TransactionID},
+		"reason":         {dispute.Reason},
+	}
+	if dispute.Amount > 0 {
+		form.Set("amount", strconv.Itoa(dispute.Amount))
+	}
+	if dispute.Evidence != "" {
+		form.Set("evidence", dispute.Evidence)
+	}
+
+	return c.dispute(ctx, http.MethodPost, "/api/v1/wallet/disputes", form, true)
+}
+
+// Disputes -> the latest disputes of the wallet owner, limit 0 uses the server default
+func (c *Client) Disputes(ctx context.Context, limit int) (disputes []Dispute, err error) {
+	var data struct {
+		Disputes []Dispute `json:"disputes"`
+	}
+
+	path := "/api/v1/wallet/disputes"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	disputes = data.Disputes
+
+	return
+}
+
+// Dispute -> a dispute of the wallet owner with its notes
+func (c *Client) Dispute(ctx context.Context, disputeID string) (dispute *Dispute, err error) {
+	return c.dispute(ctx, http.MethodGet, disputePath(disputeID), nil, false)
+}
+
+// AddDisputeEvidence -> add a note to a dispute, it answers a request for information,
+// IsCode(err, CodeDisputeUnavailable) once it was resolved
+func (c *Client) AddDisputeEvidence(ctx context.Context, disputeID, note string) (dispute *Dispute, err error) {
+	return c.dispute(ctx, http.MethodPost, disputePath(disputeID)+"/notes", noteForm(note), false)
+}
+
+// WithdrawDispute -> drop a dispute, a provisional credit is taken back
+func (c *Client) WithdrawDispute(ctx context.Context, disputeID, note string) (dispute *Dispute, err error) {
+	return c.dispute(ctx, http.MethodPost, disputePath(disputeID)+"/withdraw", noteForm(note), true)
+}
+
+func disputePath(disputeID string) string {
+	return "/api/v1/wallet/disputes/" + url.PathEscape(disputeID)
+}
+
+func (c *Client) dispute(ctx context.Context, method, path string, form url.Values, withKey bool) (dispute *Dispute, err error) {
+	var data struct {
+		Dispute Dispute `json:"dispute"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	dispute = &data.Dispute
+
+	return
+}
+
+// WalletPayment -> a payment a merchant asked of the wallet owner
+func (c *Client) WalletPayment(ctx context.Context, paymentID string) (payment *WalletPayment, err error) {
+	return c.walletPayment(ctx, http.MethodGet, walletPaymentPath(paymentID), false)
+}
+
+// ApprovePayment -> pay a payment a merchant asked of the wallet owner from the main pocket,
+// IsCode(err, CodePaymentUnavailable) once it was paid, declined or expired
+func (c *Client) ApprovePayment(ctx context.Context, paymentID string) (payment *WalletPayment, err error) {
+	return c.walletPayment(ctx, http.MethodPost, walletPaymentPath(paymentID)+"/approve", true)
+}
+
+// DeclinePayment -> turn down a payment a merchant asked of the wallet owner
+func (c *Client) DeclinePayment(ctx context.Context, paymentID string) (payment *WalletPayment, err error) {
+	return c.walletPayment(ctx, http.MethodPost, walletPaymentPath(paymentID)+"/decline", false)
+}
+
+func walletPaymentPath(paymentID string) string {
+	return "/api/v1/wallet/payments/" + url.PathEscape(paymentID)
+}
+
+func (c *Client) walletPayment(ctx context.Context, method, path string, withKey bool) (payment *WalletPayment, err error) {
+	var data struct {
+		Payment WalletPayment `json:"payment"`
+	}
+
+	err = c.do(ctx, method, path, nil, withKey, &data)
+	if err != nil {
+		return
+	}
+	payment = &data.Payment
+
+	return
+}
+
+// Merchant -> the merchant of the API key the client was made WithToken, with its settlement
+// balance and webhook secret
+func (c *Client) Merchant(ctx context.Context) (merchant *Merchant, webhookSecret string, err error) {
+	var data struct {
+		Merchant      Merchant `json:"merchant"`
+		WebhookSecret string   `json:"webhook_secret"`
+	}
+
+	err = c.do(ctx, http.MethodGet, "/api/v1/merchant", nil, false, &data)
+	if err != nil {
+		return
+	}
+	merchant = &data.Merchant
+	webhookSecret = data.WebhookSecret
+
+	return
+}
+
+// CreatePayment -> ask a customer for a payment of an order, as a merchant.
+// IsCode(err, CodeDuplicateReference) when the order already has a payment.
+func (c *Client) CreatePayment(ctx context.Context, payment NewPayment) (created *Payment, err error) {
+	form := url.Values{
+		"amount":   {strconv.Itoa(payment.Amount)},
+		"order_id": {payment.OrderID},
+	}
+	if payment.Description != "" {
+		form.Set("description", payment.Description)
+	}
+	if payment.CustomerID != "" {
+		form.Set("customer_id", payment.CustomerID)
+	}
+	if !payment.ExpiresAt.IsZero() {
+		form.Set("expires_at", payment.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	return c.payment(ctx, http.MethodPost, "/api/v1/merchant/payments", form, true)
+}
+
+// MerchantPayment -> the status of a payment of the merchant and its refunds
+func (c *Client) MerchantPayment(ctx context.Context, paymentID string) (payment *Payment, err error) {
+	return c.payment(ctx, http.MethodGet, merchantPaymentPath(paymentID), nil, false)
+}
+
+// MerchantPayments -> the latest payments of the merchant, of one order when orderID is
+// set, limit 0 uses the server default
+func (c *Client) MerchantPayments(ctx context.Context, orderID string, limit int) (payments []Payment, err error) {
+	var data struct {
+		Payments []Payment `json:"payments"`
+	}
+
+	query := url.Values{}
+	if orderID != "" {
+		query.Set("order_id", orderID)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	path := "/api/v1/merchant/payments"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	payments = data.Payments
+
+	return
+}
+
+// RefundPayment -> give back amount of a paid payment out of the settlement wallet, the fee
+// is kept
+func (c *Client) RefundPayment(ctx context.Context, paymentID string, amount int, reason string) (refund *Refund, payment *Payment, err error) {
+	var data struct {
+		Refund  Refund  `json:"refund"`
+		Payment Payment `json:"payment"`
+	}
+
+	form := url.Values{"amount": {strconv.Itoa(amount)}}
+	if reason != "" {
+		form.Set("reason", reason)
+	}
+
+	err = c.do(ctx, http.MethodPost, merchantPaymentPath(paymentID)+"/refunds", form, true, &data)
+	if err != nil {
+		return
+	}
+	refund = &data.Refund
+	payment = &data.Payment
+
+	return
+}
+
+func merchantPaymentPath(paymentID string) string {
+	return "/api/v1/merchant/payments/" + url.PathEscape(paymentID)
+}
+
+func (c *Client) payment(ctx context.Context, method, path string, form url.Values, withKey bool) (payment *Payment, err error) {
+	var data struct {
+		Payment Payment `json:"payment"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	payment = &data.Payment
+
+	return
+}
+
+// Statement -> statement file of the wallet for month ("2006-01"), format "csv" or "pdf"
+func (c *Client) Statement(ctx context.Context, month, format string) (content []byte, err error) {
+	path := "/api/v1/wallet/statements?" + url.Values{"month": {month}, "format": {format}}.Encode()
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &content)
+	return
+}
+
+func balanceChange(amount int, referenceID string) url.Values {
+	return url.Values{
+		"amount":       {strconv.Itoa(amount)},
+		"reference_id": {referenceID},
+	}
+}
+
+// DepositToPocket -> add amount to a pocket of the wallet, pocketID may be "main"
+func (c *Client) DepositToPocket(ctx context.Context, pocketID string, amount int, referenceID string) (deposit *Deposit, err error) {
+	var data struct {
+		Deposit Deposit `json:"deposit"`
+	}
+
+	form := balanceChange(amount, referenceID)
+	form.Set("pocket_id", pocketID)
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/deposits", form, true, &data)
+	if err != nil {
+		return
+	}
+	deposit = &data.Deposit
+
+	return
+}
+
+// WithdrawFromPocket -> take amount from a pocket of the wallet, pocketID may be "main"
+func (c *Client) WithdrawFromPocket(ctx context.Context, pocketID string, amount int, referenceID string) (withdrawal *Withdrawal, err error) {
+	var data struct {
+		Withdrawal Withdrawal `json:"withdrawal"`
+	}
+
+	form := balanceChange(amount, referenceID)
+	form.Set("pocket_id", pocketID)
+
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/withdrawals", form, true, &data)
+	if err != nil {
+		return
+	}
+	withdrawal = &data.Withdrawal
+
+	return
+}
+
+// Pockets -> the pockets of the wallet, main first
+func (c *Client) Pockets(ctx context.Context) (pockets []Pocket, err error) {
+	var data struct {
+		Pockets []Pocket `json:"pockets"`
+	}
+
+	err = c.do(ctx, http.MethodGet, "/api/v1/wallet/pockets", nil, false, &data)
+	pockets = data.Pockets
+
+	return
+}
+
+// CreatePocket -> add an empty pocket named name to the wallet
+func (c *Client) CreatePocket(ctx context.Context, name string) (pocket *Pocket, err error) {
+	return c.pocket(ctx, http.MethodPost, "/api/v1/wallet/pockets", url.Values{"name": {name}}, true)
+}
+
+// DeletePocket -> delete a pocket, its balance goes back to the main pocket
+func (c *Client) DeletePocket(ctx context.Context, pocketID string) (pocket *Pocket, err error) {
+	return c.pocket(ctx, http.MethodDelete, pocketPath(pocketID), nil, false)
+}
+
+// MovePocketMoney -> move amount between two pockets of the wallet
+func (c *Client) MovePocketMoney(ctx context.Context, fromPocketID, toPocketID string, amount int) (move *PocketMove, err error) {
+	form := url.Values{
+		"from_pocket_id": {fromPocketID},
+		"to_pocket_id":   {toPocketID},
+		"amount":         {strconv.Itoa(amount)},
+	}
+
+	move = &PocketMove{}
+	err = c.do(ctx, http.MethodPost, "/api/v1/wallet/pockets/moves", form, true, move)
+	if err != nil {
+		move = nil
+	}
+
+	return
+}
+
+// PocketTransactions -> latest changes of a pocket, newest first, limit 0 uses the server default
+func (c *Client) PocketTransactions(ctx context.Context, pocketID string, limit int) (transactions []PocketTransaction, err error) {
+	var data struct {
+		Transactions []PocketTransaction `json:"transactions"`
+	}
+
+	path := pocketPath(pocketID) + "/transactions"
+	if limit > 0 {
+		path += "?" + url.Values{"limit": {strconv.Itoa(limit)}}.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	transactions = data.Transactions
+
+	return
+}
+
+func pocketPath(pocketID string) string {
+	return "/api/v1/wallet/pockets/" + url.PathEscape(pocketID)
+}
+
+func (c *Client) pocket(ctx context.Context, method, path string, form url.Values, withKey bool) (pocket *Pocket, err error) {
+	var data struct {
+		Pocket Pocket `json:"pocket"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	pocket = &data.Pocket
+
+	return
+}
+
+// CreateGoal -> start saving up for a goal, in a new pocket named after it
+func (c *Client) CreateGoal(ctx context.Context, goal NewGoal) (created *Goal, err error) {
+	form := url.Values{
+		"name":          {goal.Name},
+		"target_amount": {strconv.Itoa(goal.TargetAmount)},
+		"target_date":   {goal.TargetDate.Format("2006-01-02")},
+	}
+	if goal.RoundUpUnit > 0 {
+		form.Set("round_up_unit", strconv.Itoa(goal.RoundUpUnit))
+	}
+	if goal.DepositPercent > 0 {
+		form.Set("deposit_percent", strconv.Itoa(goal.DepositPercent))
+	}
+
+	return c.goal(ctx, http.MethodPost, "/api/v1/wallet/goals", form, true)
+}
+
+// Goals -> every savings goal of the wallet with its progress, active ones first
+func (c *Client) Goals(ctx context.Context) (goals []Goal, err error) {
+	var data struct {
+		Goals []Goal `json:"goals"`
+	}
+
+	err = c.do(ctx, http.MethodGet, "/api/v1/wallet/goals", nil, false, &data)
+	goals = data.Goals
+
+	return
+}
+
+// Goal -> a savings goal with its progress and projected completion
+func (c *Client) Goal(ctx context.Context, goalID string) (goal *Goal, err error) {
+	return c.goal(ctx, http.MethodGet, goalPath(goalID), nil, false)
+}
+
+// SetGoalRules -> replace the automatic contributions of a goal, 0 turns a rule off
+func (c *Client) SetGoalRules(ctx context.Context, goalID string, roundUpUnit, depositPercent int) (goal *Goal, err error) {
+	form := url.Values{
+		"round_up_unit":   {strconv.Itoa(roundUpUnit)},
+		"deposit_percent": {strconv.Itoa(depositPercent)},
+	}
+
+	return c.goal(ctx, http.MethodPut, goalPath(goalID)+"/rules", form, true)
+}
+
+// CancelGoal -> give up a goal, what it saved goes back to the main pocket
+func (c *Client) CancelGoal(ctx context.Context, goalID string) (goal *Goal, err error) {
+	return c.goal(ctx, http.MethodDelete, goalPath(goalID), nil, false)
+}
+
+// GoalHistory -> latest changes of a goal, newest first, limit 0 uses the server default
+func (c *Client) GoalHistory(ctx context.Context, goalID string, limit int) (history []GoalHistoryEntry, err error) {
+	var data struct {
+		History []GoalHistoryEntry `json:"history"`
+	}
+
+	path := goalPath(goalID) + "/history"
+	if limit > 0 {
+		path += "?" + url.Values{"limit": {strconv.Itoa(limit)}}.Encode()
+	}
+
+	err = c.do(ctx, http.MethodGet, path, nil, false, &data)
+	history = data.History
+
+	return
+}
+
+// Interest -> the interest accrued on the wallet and the monthly postings
+func (c *Client) Interest(ctx context.Context) (interest *Interest, err error) {
+	var data Interest
+
+	err = c.do(ctx, http.MethodGet, "/api/v1/wallet/interest", nil, false, &data)
+	if err != nil {
+		return
+	}
+	interest = &data
+
+	return
+}
+
+func goalPath(goalID string) string {
+	return "/api/v1/wallet/goals/" + url.PathEscape(goalID)
+}
+
+func (c *Client) goal(ctx context.Context, method, path string, form url.Values, withKey bool) (goal *Goal, err error) {
+	var data struct {
+		Goal Goal `json:"goal"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	goal = &data.Goal
+
+	return
+}
+
+// CreateSchedule -> create a standing order from the wallet
+func (c *Client) CreateSchedule(ctx context.Context, schedule NewSchedule) (created *Schedule, err error) {
+	form := url.Values{
+		"kind":   {schedule.Kind},
+		"amount": {strconv.Itoa(schedule.Amount)},
+	}
+	if schedule.ToUserID != "" {
+		form.Set("to_user_id", schedule.ToUserID)
+	}
+	if schedule.Cron != "" {
+		form.Set("cron", schedule.Cron)
+	}
+	if schedule.Interval > 0 {
+		form.Set("interval", schedule.Interval.String())
+	}
+	if !schedule.StartAt.IsZero() {
+		form.Set("start_at", schedule.StartAt.UTC().Format(time.RFC3339))
+	}
+	if schedule.OnInsufficientFunds != "" {
+		form.Set("on_insufficient_funds", schedule.OnInsufficientFunds)
+	}
+	if schedule.RetryInterval > 0 {
+		form.Set("retry_interval", schedule.RetryInterval.String())
+	}
+	if schedule.MaxRetries > 0 {
+		form.Set("max_retries", strconv.Itoa(schedule.MaxRetries))
+	}
+
+	return c.schedule(ctx, http.MethodPost, "/api/v1/wallet/schedules", form, true)
+}
+
+// Schedules -> every standing order of the wallet, cancelled ones included
+func (c *Client) Schedules(ctx context.Context) (schedules []Schedule, err error) {
+	var data struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+
+	err = c.do(ctx, http.MethodGet, "/api/v1/wallet/schedules", nil, false, &data)
+	schedules = data.Schedules
+
+	return
+}
+
+// Schedule -> a standing order with its latest runs
+func (c *Client) Schedule(ctx context.Context, scheduleID string) (schedule *Schedule, err error) {
+	return c.schedule(ctx, http.MethodGet, schedulePath(scheduleID), nil, false)
+}
+
+// PauseSchedule -> stop running a standing order until it is resumed
+func (c *Client) PauseSchedule(ctx context.Context, scheduleID string) (schedule *Schedule, err error) {
+	return c.schedule(ctx, http.MethodPost, schedulePath(scheduleID)+"/pause", nil, false)
+}
+
+// ResumeSchedule -> run a paused standing order again from its next occurrence
+func (c *Client) ResumeSchedule(ctx context.Context, scheduleID string) (schedule *Schedule, err error) {
+	return c.schedule(ctx, http.MethodPost, schedulePath(scheduleID)+"/resume", nil, false)
+}
+
+// CancelSchedule -> stop a standing order for good
+func (c *Client) CancelSchedule(ctx context.Context, scheduleID string) (schedule *Schedule, err error) {
+	return c.schedule(ctx, http.MethodDelete, schedulePath(scheduleID), nil, false)
+}
+
+func schedulePath(scheduleID string) string {
+	return "/api/v1/wallet/schedules/" + url.PathEscape(scheduleID)
+}
+
+func (c *Client) schedule(ctx context.Context, method, path string, form url.Values, withKey bool) (schedule *Schedule, err error) {
+	var data struct {
+		Schedule Schedule `json:"schedule"`
+	}
+
+	err = c.do(ctx, method, path, form, withKey, &data)
+	if err != nil {
+		return
+	}
+	schedule = &data.Schedule
+
+	return
+}
+
+// Watchers -> users allowed to watch the wallet over the watch websocket
+func (c *Client) Watchers(ctx context.Context) (watchers *Watchers, err error) {
+	return c.watchers(ctx, http.MethodGet, "/api/v1/wallet/watchers")
+}
+
+// GrantWatcher -> allow userID to watch the wallet, granting twice is a no-op
+func (c *Client) GrantWatcher(ctx context.Context, userID string) (watchers *Watchers, err error) {
+	return c.watchers(ctx, http.MethodPut, watchersPath(userID))
+}
+
+// RevokeWatcher -> stop userID from subscribing to the wallet
+func (c *Client) RevokeWatcher(ctx context.Context, userID string) (watchers *Watchers, err error) {
+	return c.watchers(ctx, http.MethodDelete, watchersPath(userID))
+}
+
+func watchersPath(userID string) string {
+	return "/api/v1/wallet/watchers/" + url.PathEscape(userID)
+}
+
+func (c *Client) watchers(ctx context.Context, method, path string) (watchers *Watchers, err error) {
+	watchers = &Watchers{}
+
+	err = c.do(ctx, method, path, nil, false, watchers)
+	if err != nil {
+		watchers = nil
+	}
+
+	return
+}
+
+// RateLimits -> admin: effective rate limits of userID
+func (c *Client) RateLimits(ctx context.Context, userID string) (limits *RateLimits, err error) {
+	return c.rateLimits(ctx, http.MethodGet, rateLimitsPath(userID), nil)
+}
+
+// SetRateLimit -> admin: override the limit of userID for a route group
+func (c *Client) SetRateLimit(ctx context.Context, userID, group string, rate float64, burst int) (limits *RateLimits, err error) {
+	return c.rateLimits(ctx, http.MethodPut, rateLimitsPath(userID), url.Values{
+		"group": {group},
+		"rate":  {strconv.FormatFloat(rate, 'f', -1, 64)},
+		"burst": {strconv.Itoa(burst)},
+	})
+}
+
+// DeleteRateLimit -> admin: drop the override of userID for a route group
+func (c *Client) DeleteRateLimit(ctx context.Context, userID, group string) (limits *RateLimits, err error) {
+	return c.rateLimits(ctx, http.MethodDelete, rateLimitsPath(userID)+"?"+url.Values{"group": {group}}.Encode(), nil)
+}
+
+func rateLimitsPath(userID string) string {
+	return "/api/v1/admin/rate-limits/" + url.PathEscape(userID)
+}
+
+func (c *Client) rateLimits(ctx context.Context, method, path string, form url.Values) (limits *RateLimits, err error) {
+	limits = &RateLimits{}
+
+	err = c.do(ctx, method, path, form, false, limits)
+	if err != nil {
+		limits = nil
+	}
+
+	return
+}
+
+// CreateBatch -> admin: upload a csv of customer_xid, amount, reference_id and type rows.
+// Every row is validated, the batch is "invalid" when any row is.
+func (c *Client) CreateBatch(ctx context.Context, file []byte) (batch *Batch, err error) {
+	return c.batch(ctx, http.MethodPost, "/api/v1/admin/batches", &payload{contentType: "text/csv", data: file})
+}
+
+// Batch -> admin: status of a batch and its rows counted by status
+func (c *Client) Batch(ctx context.Context, batchID string) (batch *Batch, err error) {
+	return c.batch(ctx, http.MethodGet, batchPath(batchID), nil)
+}
+
+// ApplyBatch -> admin: apply a validated batch in the background, calling it again resumes it
+func (c *Client) ApplyBatch(ctx context.Context, batchID string) (batch *Batch, err error) {
+	return c.batch(ctx, http.MethodPost, batchPath(batchID)+"/apply", nil)
+}
+
+// BatchResults -> admin: csv of every row of a batch with its status, transaction id and error
+func (c *Client) BatchResults(ctx context.Context, batchID string) (content []byte, err error) {
+	err = c.doPayload(ctx, http.MethodGet, batchPath(batchID)+"/results", nil, false, &content)
+	return
+}
+
+func batchPath(batchID string) string {
+	return "/api/v1/admin/batches/" + url.PathEscape(batchID)
+}
+
+func (c *Client) batch(ctx context.Context, method, path string, body *payload) (batch *Batch, err error) {
+	batch = &Batch{}
+
+	err = c.doPayload(ctx, method, path, body, false, batch)
+	if err != nil {
+		batch = nil
+	}
+
+	return
+}
+
+// envelope -> {"status": "success" | "fail", "data": ...}
+type envelope struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// payload -> a request body with its Content-Type
+type payload struct {
+	contentType string
+	data        []byte
+}
+
+// do -> send form, if any, as the request body, see doPayload
+func (c *Client) do(ctx context.Context, method, path string, form url.Values, withKey bool, out interface{}) (err error) {
+	var body *payload
+	if form != nil {
+		body = &payload{contentType: "application/x-www-form-urlencoded", data: []byte(form.Encode())}
+	}
+
+	return c.doPayload(ctx, method, path, body, withKey, out)
+}
+
+// doPayload -> send the request, retrying when it is safe to, and decode data into out.
+// With withKey every attempt carries the same Idempotency-Key, so the server applies it once.
+func (c *Client) doPayload(ctx context.Context, method, path string, body *payload, withKey bool, out interface{}) (err error) {
+	key := ""
+	if withKey {
+		key = uuid.New().String()
+	}
+
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = c.send(ctx, method, path, body, key, out)
+		if err == nil || attempt >= c.maxRetries || !retryable(err) {
+			return
+		}
+
+		wait := c.backoff << uint(attempt)
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body *payload, key string, out interface{}) (retryAfter time.Duration, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body.data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", body.contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Token "+c.token)
+	}
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		err = &transportError{err: err}
+		return
+	}
+	defer resp.Body.Close()
+
+	if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		err = &transportError{err: err}
+		return
+	}
+
+	// files are returned as they are, errors still come in the envelope
+	if file, ok := out.(*[]byte); ok && resp.StatusCode < http.StatusBadRequest {
+		*file = raw
+		return
+	}
+
+	var env envelope
+	if json.Unmarshal(raw, &env) != nil {
+		err = &Error{
+			StatusCode: resp.StatusCode,
+			Code:       CodeInternal,
+			Message:    fmt.Sprintf("unexpected response: %s", strings.TrimSpace(string(raw))),
+		}
+		return
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest || env.Status != "success" {
+		err = decodeError(resp.StatusCode, env.Data)
+		return
+	}
+
+	err = json.Unmarshal(env.Data, out)
+
+	return
+}
+
+// retryable -> network errors, rate limiting, a running duplicate and server errors are worth another try
+func retryable(err error) bool {
+	if _, ok := err.(*transportError); ok {
+		return true
+	}
+
+	e, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= http.StatusInternalServerError ||
+		e.Code == CodeIdempotencyInProgress
+}
+
+type transportError struct {
+	err error
+}
+
+func (t *transportError) Error() string {
+	return t.err.Error()
+}
+
+func (t *transportError) Unwrap() error {
+	return t.err
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Error codes returned by the service, see the errors section of the README
+const (
+	CodeInvalidInput          = "INVALID_INPUT"
+	CodeUnsupportedMediaType  = "UNSUPPORTED_MEDIA_TYPE"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeNotFound              = "NOT_FOUND"
+	CodeAccountExists         = "ACCOUNT_EXISTS"
+	CodeWalletDisabled        = "WALLET_DISABLED"
+	CodeWalletAlreadyEnabled  = "WALLET_ALREADY_ENABLED"
+	CodeWalletAlreadyDisabled = "WALLET_ALREADY_DISABLED"
+	CodeInsufficientFunds     = "INSUFFICIENT_FUNDS"
+	CodeDuplicateReference    = "DUPLICATE_REFERENCE"
+	CodeLimitExceeded         = "LIMIT_EXCEEDED"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	CodeBatchInvalid          = "BATCH_INVALID"
+	CodeVoucherUnavailable    = "VOUCHER_UNAVAILABLE"
+	CodePaymentUnavailable    = "PAYMENT_UNAVAILABLE"
+	CodeEscrowUnavailable     = "ESCROW_UNAVAILABLE"
+	CodeDisputeUnavailable    = "DISPUTE_UNAVAILABLE"
+	CodeInternal              = "INTERNAL_ERROR"
+)
+
+// Error -> failed response of the service
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+
+	// Fields -> field name to messages, set for INVALID_INPUT
+	Fields map[string][]string
+}
+
+func (e *Error) Error() string {
+	if e.RequestID == "" {
+		return fmt.Sprintf("wallet: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+	}
+
+	return fmt.Sprintf("wallet: %s (%d %s, request id %s)", e.Message, e.StatusCode, e.Code, e.RequestID)
+}
+
+// IsCode -> whether err is a service error with code, e.g. IsCode(err, client.CodeInsufficientFunds)
+func IsCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// decodeError -> {"error": "message" | {"field": ["message"]}, "code": "...", "request_id": "..."}
+func decodeError(statusCode int, data json.RawMessage) *Error {
+	var body struct {
+		Error     json.RawMessage `json:"error"`
+		Code      string          `json:"code"`
+		RequestID string          `json:"request_id"`
+	}
+	json.Unmarshal(data, &body)
+
+	e := &Error{
+		StatusCode: statusCode,
+		Code:       body.Code,
+		RequestID:  body.RequestID,
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(body.Error), []byte("{")) {
+		json.Unmarshal(body.Error, &e.Fields)
+		e.Message = "Invalid input"
+	} else {
+		json.Unmarshal(body.Error, &e.Message)
+	}
+
+	if e.Code == "" {
+		e.Code = CodeInternal
+	}
+	if e.Message == "" {
+		e.Message = "Request failed"
+	}
+
+	return e
+}
@@ -0,0 +1,505 @@
+package client
+
+import "time"
+
+// Wallet ...
+type Wallet struct {
+	ID         string     `json:"id"`
+	OwnedBy    string     `json:"owned_by"`
+	Status     string     `json:"status"`
+	EnabledAt  *time.Time `json:"enabled_at,omitempty"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	Balance    int        `json:"balance"`
+
+	// Pockets -> breakdown of Balance, only set by Balance
+	Pockets []Pocket `json:"pockets,omitempty"`
+
+	// Buckets -> Balance by source, cash first, only set by Balance
+	Buckets []BalanceBucket `json:"buckets,omitempty"`
+}
+
+// BalanceBucket -> cash, or a promo or refund credit that may expire
+type BalanceBucket struct {
+	ID            string     `json:"id,omitempty"`
+	Source        string     `json:"source"`
+	Amount        int        `json:"amount"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+}
+
+// Deposit ...
+type Deposit struct {
+	ID          string    `json:"id"`
+	DepositedBy string    `json:"deposited_by"`
+	Status      string    `json:"status"`
+	DepositedAt time.Time `json:"deposited_at"`
+	Amount      int       `json:"amount"`
+	ReferenceID string    `json:"reference_id"`
+}
+
+// Withdrawal ...
+type Withdrawal struct {
+	ID          string    `json:"id"`
+	WithdrawnBy string    `json:"withdrawn_by"`
+	Status      string    `json:"status"`
+	WithdrawnAt time.Time `json:"withdrawn_at"`
+	Amount      int       `json:"amount"`
+	ReferenceID string    `json:"reference_id"`
+	// Fee -> debited on top of Amount as the transaction FeeTransactionID
+	Fee              int    `json:"fee"`
+	FeeTransactionID string `json:"fee_transaction_id,omitempty"`
+}
+
+// Transfer ...
+type Transfer struct {
+	ID            string    `json:"id"`
+	TransferredBy string    `json:"transferred_by"`
+	ToUserID      string    `json:"to_user_id"`
+	Status        string    `json:"status"`
+	TransferredAt time.Time `json:"transferred_at"`
+	Amount        int       `json:"amount"`
+	ReferenceID   string    `json:"reference_id"`
+	WithdrawalID  string    `json:"withdrawal_id"`
+	DepositID     string    `json:"deposit_id"`
+	// Fee -> paid by the sender on top of Amount as the transaction FeeTransactionID
+	Fee              int    `json:"fee"`
+	FeeTransactionID string `json:"fee_transaction_id,omitempty"`
+}
+
+// FeeQuote -> the fee on an amount, FeeScheduleID is empty when no schedule applies
+type FeeQuote struct {
+	TransactionType string `json:"transaction_type"`
+	Amount          int    `json:"amount"`
+	Fee             int    `json:"fee"`
+	Total           int    `json:"total"`
+	FeeScheduleID   string `json:"fee_schedule_id,omitempty"`
+	KYCTier         string `json:"kyc_tier"`
+	Currency        string `json:"currency"`
+}
+
+// VoucherRedemption -> a redeemed voucher, the promo deposit it made and the bucket it is kept in
+type VoucherRedemption struct {
+	Deposit    Deposit       `json:"deposit"`
+	Type       string        `json:"type"`
+	Code       string        `json:"code"`
+	CampaignID string        `json:"campaign_id"`
+	Bucket     BalanceBucket `json:"bucket"`
+}
+
+// Points -> points of the wallet, Value is what they are worth when redeemed now
+type Points struct {
+	Balance      int           `json:"balance"`
+	Value        int           `json:"value"`
+	NextExpiring *PointsExpiry `json:"next_expiring,omitempty"`
+	Entries      []PointsEntry `json:"entries"`
+}
+
+// PointsExpiry -> points that expire on the day the first of them do
+type PointsExpiry struct {
+	Points    int       `json:"points"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PointsEntry -> an earn, redeem, expire or reverse, Points is negative when they were used
+type PointsEntry struct {
+	ID            string    `json:"id"`
+	Kind          string    `json:"kind"`
+	Points        int       `json:"points"`
+	Balance       int       `json:"balance"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PointsRedemption -> points redeemed and the cashback deposit they made
+type PointsRedemption struct {
+	Deposit       Deposit `json:"deposit"`
+	Type          string  `json:"type"`
+	Points        int     `json:"points"`
+	PointsBalance int     `json:"points_balance"`
+}
+
+// Transaction ...
+type Transaction struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Amount      int       `json:"amount"`
+	ReferenceID string    `json:"reference_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Pocket -> a named part of the balance of the wallet
+type Pocket struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Main      bool      `json:"main"`
+	Balance   int       `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PocketMove -> both pockets after a move
+type PocketMove struct {
+	Amount int    `json:"amount"`
+	From   Pocket `json:"from"`
+	To     Pocket `json:"to"`
+}
+
+// PocketTransaction -> one change of a pocket, Amount is negative when money left it
+type PocketTransaction struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	OtherPocketID string    `json:"other_pocket_id,omitempty"`
+	ReferenceID   string    `json:"reference_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewGoal -> a savings goal to create, rules left at 0 are off
+type NewGoal struct {
+	Name           string
+	TargetAmount   int
+	TargetDate     time.Time
+	RoundUpUnit    int
+	DepositPercent int
+}
+
+// Goal -> a savings goal with its progress, dates are "2006-01-02"
+type Goal struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	PocketID        string    `json:"pocket_id"`
+	TargetAmount    int       `json:"target_amount"`
+	TargetDate      string    `json:"target_date"`
+	RoundUpUnit     int       `json:"round_up_unit"`
+	DepositPercent  int       `json:"deposit_percent"`
+	Status          string    `json:"status"`
+	Saved           int       `json:"saved"`
+	Remaining       int       `json:"remaining"`
+	ProgressPercent int       `json:"progress_percent"`
+	Reached         bool      `json:"reached"`
+	OnTrack         bool      `json:"on_track"`
+	RequiredPerDay  int       `json:"required_per_day"`
+	ProjectedDate   string    `json:"projected_date,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// GoalHistoryEntry -> one change of a goal, Rule is set when a goal rule made it
+type GoalHistoryEntry struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Rule          string    `json:"rule,omitempty"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	OtherPocketID string    `json:"other_pocket_id,omitempty"`
+	ReferenceID   string    `json:"reference_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Interest -> interest accrued and not posted yet, as a decimal of the smallest unit
+type Interest struct {
+	Accrued        string            `json:"accrued"`
+	AccruedThrough string            `json:"accrued_through,omitempty"`
+	Postings       []InterestPosting `json:"postings"`
+	Accruals       []InterestAccrual `json:"accruals"`
+}
+
+// InterestPosting -> interest credited for a month
+type InterestPosting struct {
+	Month         string    `json:"month"`
+	Amount        int       `json:"amount"`
+	Due           string    `json:"due"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	PostedAt      time.Time `json:"posted_at"`
+}
+
+// InterestAccrual -> interest earned on one day
+type InterestAccrual struct {
+	Day      string `json:"day"`
+	Balance  int    `json:"balance"`
+	RateFrom string `json:"rate_from"`
+	Interest string `json:"interest"`
+}
+
+// NewSchedule -> a standing order to create, set either Cron or Interval
+type NewSchedule struct {
+	Kind     string // "transfer" or "withdrawal"
+	ToUserID string // transfers only
+	Amount   int
+
+	Cron     string        // five fields in UTC, e.g. "0 9 1 * *"
+	Interval time.Duration // at least a minute
+	StartAt  time.Time     // zero starts now
+
+	// OnInsufficientFunds -> "skip" (default) or "retry" every RetryInterval up to MaxRetries times
+	OnInsufficientFunds string
+	RetryInterval       time.Duration
+	MaxRetries          int
+}
+
+// Schedule ...
+type Schedule struct {
+	ID                  string        `json:"id"`
+	Kind                string        `json:"kind"`
+	ToUserID            string        `json:"to_user_id,omitempty"`
+	Amount              int           `json:"amount"`
+	Cron                string        `json:"cron,omitempty"`
+	Interval            string        `json:"interval,omitempty"`
+	StartAt             time.Time     `json:"start_at"`
+	OnInsufficientFunds string        `json:"on_insufficient_funds"`
+	RetryInterval       string        `json:"retry_interval"`
+	MaxRetries          int           `json:"max_retries"`
+	Status              string        `json:"status"`
+	Attempt             int           `json:"attempt"`
+	NextRunAt           *time.Time    `json:"next_run_at,omitempty"`
+	CreatedAt           time.Time     `json:"created_at"`
+	UpdatedAt           time.Time     `json:"updated_at"`
+	Runs                []ScheduleRun `json:"runs,omitempty"`
+}
+
+// ScheduleRun ...
+type ScheduleRun struct {
+	ID            string    `json:"id"`
+	DueAt         time.Time `json:"due_at"`
+	RanAt         time.Time `json:"ran_at"`
+	Attempt       int       `json:"attempt"`
+	Status        string    `json:"status"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Watchers ...
+type Watchers struct {
+	WalletID string    `json:"wallet_id"`
+	Watchers []Watcher `json:"watchers"`
+}
+
+// Watcher ...
+type Watcher struct {
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RateLimits ...
+type RateLimits struct {
+	UserID string      `json:"user_id"`
+	Limits []RateLimit `json:"limits"`
+}
+
+// RateLimit ...
+type RateLimit struct {
+	Group    string  `json:"group"`
+	Rate     float64 `json:"rate"`
+	Burst    int     `json:"burst"`
+	Override bool    `json:"override"`
+}
+
+// Batch -> an uploaded file of deposits and payouts, with its rows counted by status
+type Batch struct {
+	ID        string         `json:"id"`
+	Status    string         `json:"status"`
+	Rows      int            `json:"rows"`
+	Counts    map[string]int `json:"counts"`
+	Errors    []BatchError   `json:"errors"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// BatchError ...
+type BatchError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// NewPaymentRequest -> a payment request to send, it expires after 7 days when ExpiresAt is
+// zero
+type NewPaymentRequest struct {
+	Payers      []PaymentRequestShare
+	Description string
+	ExpiresAt   time.Time
+}
+
+// PaymentRequest -> Status is open, settled, closed, cancelled or expired, Paid sums the paid
+// Shares
+type PaymentRequest struct {
+	ID          string                `json:"id"`
+	RequestedBy string                `json:"requested_by"`
+	Description string                `json:"description,omitempty"`
+	Amount      int                   `json:"amount"`
+	Paid        int                   `json:"paid"`
+	Status      string                `json:"status"`
+	ExpiresAt   time.Time             `json:"expires_at"`
+	CreatedAt   time.Time             `json:"created_at"`
+	Shares      []PaymentRequestShare `json:"shares"`
+}
+
+// PaymentRequestShare -> Amount asked of PayerID, Status is pending, paid, declined,
+// cancelled or expired
+type PaymentRequestShare struct {
+	PayerID    string     `json:"payer_id"`
+	Amount     int        `json:"amount"`
+	Status     string     `json:"status,omitempty"`
+	TransferID string     `json:"transfer_id,omitempty"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty"`
+}
+
+// NewEscrow -> an escrow to fund, it expires after 14 days when ExpiresAt is zero
+type NewEscrow struct {
+	SellerID    string
+	Amount      int
+	Description string
+	ExpiresAt   time.Time
+}
+
+// Escrow -> Status is funded, disputed, released or refunded, Events are only set when a
+// single escrow is read
+type Escrow struct {
+	ID                  string        `json:"id"`
+	BuyerID             string        `json:"buyer_id"`
+	SellerID            string        `json:"seller_id"`
+	Amount              int           `json:"amount"`
+	Description         string        `json:"description,omitempty"`
+	Status              string        `json:"status"`
+	FundTransactionID   string        `json:"fund_transaction_id"`
+	SettleTransactionID string        `json:"settle_transaction_id,omitempty"`
+	ExpiresAt           time.Time     `json:"expires_at"`
+	CreatedAt           time.Time     `json:"created_at"`
+	UpdatedAt           time.Time     `json:"updated_at"`
+	Events              []EscrowEvent `json:"events,omitempty"`
+}
+
+// EscrowEvent -> a change of status of an escrow, Actor is buyer, seller, admin or system
+type EscrowEvent struct {
+	Type          string    `json:"type"`
+	Actor         string    `json:"actor"`
+	ActorID       string    `json:"actor_id,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewDispute -> a transaction to contest, Reason is unauthorized, not_received, duplicate,
+// incorrect_amount or other
+type NewDispute struct {
+	TransactionID string
+	Amount        int
+	Reason        string
+	Evidence      string
+}
+
+// Dispute -> Status is open, reviewing, needs_info, won, lost or withdrawn, DueAt is set
+// until it is resolved and Notes only when a single dispute is read
+type Dispute struct {
+	ID                       string        `json:"id"`
+	UserID                   string        `json:"user_id"`
+	WalletID                 string        `json:"wallet_id"`
+	TransactionID            string        `json:"transaction_id"`
+	Amount                   int           `json:"amount"`
+	Reason                   string        `json:"reason"`
+	Evidence                 string        `json:"evidence,omitempty"`
+	Status                   string        `json:"status"`
+	DueAt                    *time.Time    `json:"due_at,omitempty"`
+	Overdue                  bool          `json:"overdue"`
+	ProvisionalTransactionID string        `json:"provisional_transaction_id,omitempty"`
+	CreditTransactionID      string        `json:"credit_transaction_id,omitempty"`
+	ReversalTransactionID    string        `json:"reversal_transaction_id,omitempty"`
+	Uncollected              int           `json:"uncollected"`
+	CreatedAt                time.Time     `json:"created_at"`
+	UpdatedAt                time.Time     `json:"updated_at"`
+	ResolvedAt               *time.Time    `json:"resolved_at,omitempty"`
+	Notes                    []DisputeNote `json:"notes,omitempty"`
+}
+
+// DisputeNote -> a note on a dispute, Status is set when the dispute moved to it
+type DisputeNote struct {
+	Author        string    `json:"author"`
+	AuthorID      string    `json:"author_id,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	Internal      bool      `json:"internal"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Merchant -> an account that takes payments into its settlement wallet WalletID
+type Merchant struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Category   string    `json:"category,omitempty"`
+	WalletID   string    `json:"wallet_id"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	FeeBps     int       `json:"fee_bps"`
+	FeeFlat    int       `json:"fee_flat"`
+	Balance    *int      `json:"balance,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NewPayment -> a payment to ask for, anyone may pay it when CustomerID is empty and it
+// expires after 15 minutes when ExpiresAt is zero
+type NewPayment struct {
+	Amount      int
+	OrderID     string
+	Description string
+	CustomerID  string
+	ExpiresAt   time.Time
+}
+
+// Payment -> a payment as its merchant sees it, Status is pending, paid, declined, expired
+// or refunded
+type Payment struct {
+	ID                      string     `json:"id"`
+	OrderID                 string     `json:"order_id"`
+	Amount                  int        `json:"amount"`
+	Fee                     int        `json:"fee"`
+	Net                     int        `json:"net"`
+	Description             string     `json:"description,omitempty"`
+	CustomerID              string     `json:"customer_id,omitempty"`
+	Status                  string     `json:"status"`
+	Refunded                int        `json:"refunded"`
+	PaidBy                  string     `json:"paid_by,omitempty"`
+	SettlementTransactionID string     `json:"settlement_transaction_id,omitempty"`
+	ExpiresAt               time.Time  `json:"expires_at"`
+	PaidAt                  *time.Time `json:"paid_at,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	Refunds                 []Refund   `json:"refunds,omitempty"`
+}
+
+// Refund -> TransactionID debited the settlement wallet, RefundTransactionID credited the payer
+type Refund struct {
+	ID                  string    `json:"id"`
+	Amount              int       `json:"amount"`
+	Reason              string    `json:"reason,omitempty"`
+	TransactionID       string    `json:"transaction_id"`
+	RefundTransactionID string    `json:"refund_transaction_id"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// WalletPayment -> a payment as the customer sees it
+type WalletPayment struct {
+	ID            string     `json:"id"`
+	MerchantID    string     `json:"merchant_id"`
+	MerchantName  string     `json:"merchant_name"`
+	OrderID       string     `json:"order_id"`
+	Amount        int        `json:"amount"`
+	Description   string     `json:"description,omitempty"`
+	Status        string     `json:"status"`
+	Refunded      int        `json:"refunded"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// WebhookEvent -> the body of a webhook, Type is payment.paid, payment.declined,
+// payment.expired or payment.refunded
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      struct {
+		Payment Payment `json:"payment"`
+	} `json:"data"`
+}
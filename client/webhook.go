@@ -0,0 +1,69 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a webhook posted by the service
+const (
+	WebhookEventHeader     = "X-Wallet-Event"
+	WebhookDeliveryHeader  = "X-Wallet-Delivery"
+	WebhookSignatureHeader = "X-Wallet-Signature"
+)
+
+// ErrWebhookSignature -> the webhook was not signed with the secret, or too long ago
+var ErrWebhookSignature = errors.New("wallet: webhook signature does not match")
+
+// VerifyWebhook -> the event of a webhook body once its X-Wallet-Signature header checks out
+// against the webhook secret of the merchant. Signatures older than tolerance are refused so
+// a captured webhook cannot be replayed later, zero tolerance skips that check.
+//
+//	event, err := client.VerifyWebhook(secret, r.Header.Get(client.WebhookSignatureHeader), body, 5*time.Minute)
+func VerifyWebhook(secret, signature string, body []byte, tolerance time.Duration) (event *WebhookEvent, err error) {
+	var timestamp, v1 string
+	for _, part := range strings.Split(signature, ",") {
+		switch {
+		case strings.HasPrefix(part, "t="):
+			timestamp = strings.TrimPrefix(part, "t=")
+		case strings.HasPrefix(part, "v1="):
+			v1 = strings.TrimPrefix(part, "v1=")
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrWebhookSignature
+	}
+
+	want, err := hex.DecodeString(v1)
+	if err != nil {
+		return nil, ErrWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), want) {
+		return nil, ErrWebhookSignature
+	}
+
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return nil, ErrWebhookSignature
+	}
+
+	var data WebhookEvent
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return
+	}
+	event = &data
+
+	return
+}
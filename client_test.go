@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/azzafirdaus/wallet/client"
+)
+
+// newClientSession -> a client of the test server with the enabled wallet of customerXID
+func newClientSession(t *testing.T, customerXID string, opts ...client.Option) *client.Client {
+	t.Helper()
+	ctx := context.Background()
+
+	c := client.New(testServer.URL, opts...)
+	token, err := c.Init(ctx, customerXID)
+	if err != nil {
+		t.Fatalf("Init %s: %v", customerXID, err)
+	}
+
+	c = c.Session(token)
+	_, err = c.EnableWallet(ctx)
+	if err != nil {
+		t.Fatalf("EnableWallet %s: %v", customerXID, err)
+	}
+
+	return c
+}
+
+// clientError -> err as a service error, failing the test when it is something else
+func clientError(t *testing.T, err error) *client.Error {
+	t.Helper()
+
+	var e *client.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("err = %v, want a *client.Error", err)
+	}
+
+	return e
+}
+
+func TestClientMoney(t *testing.T) {
+	ctx := context.Background()
+	alice := newClientSession(t, "client-alice")
+	newClientSession(t, "client-bob")
+
+	deposit, err := alice.Deposit(ctx, 5000, "client-d1")
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if deposit.ID == "" || deposit.Amount != 5000 || deposit.ReferenceID != "client-d1" || deposit.Status != statusSuccess {
+		t.Errorf("Deposit = %+v", deposit)
+	}
+
+	withdrawal, err := alice.Withdraw(ctx, 1200, "client-w1")
+	if err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if withdrawal.ID == "" || withdrawal.Amount != 1200 || withdrawal.ReferenceID != "client-w1" {
+		t.Errorf("Withdraw = %+v", withdrawal)
+	}
+
+	transfer, err := alice.Transfer(ctx, "client-bob", 800, "client-t1")
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if transfer.ToUserID != "client-bob" || transfer.Amount != 800 || transfer.WithdrawalID == "" || transfer.DepositID == "" {
+		t.Errorf("Transfer = %+v", transfer)
+	}
+
+	wallet, err := alice.Balance(ctx)
+	if err != nil {
+		t.Fatalf("Balance: %v", err)
+	}
+	if wallet.Balance != 5000-1200-800 {
+		t.Errorf("Balance = %d, want %d", wallet.Balance, 5000-1200-800)
+	}
+
+	transactions, err := alice.Transactions(ctx, 10)
+	if err != nil {
+		t.Fatalf("Transactions: %v", err)
+	}
+	if len(transactions) != 3 {
+		t.Errorf("Transactions = %d, want 3", len(transactions))
+	}
+
+	wallet, err = alice.Disable(ctx)
+	if err != nil || wallet.Status != "disabled" {
+		t.Fatalf("Disable = %+v, %v", wallet, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	carol := newClientSession(t, "client-carol")
+
+	_, err := carol.Withdraw(ctx, 100, "client-w2")
+	if e := clientError(t, err); e.Code != client.CodeInsufficientFunds || e.StatusCode != http.StatusUnprocessableEntity || e.RequestID == "" {
+		t.Errorf("Withdraw from an empty wallet = %+v", e)
+	}
+	if !client.IsCode(err, client.CodeInsufficientFunds) {
+		t.Errorf("IsCode(%v, %s) = false", err, client.CodeInsufficientFunds)
+	}
+
+	_, err = carol.Deposit(ctx, -1, "client-d2")
+	if e := clientError(t, err); e.Code != client.CodeInvalidInput || e.StatusCode != http.StatusBadRequest || len(e.Fields["amount"]) == 0 {
+		t.Errorf("Deposit of a negative amount = %+v", e)
+	}
+
+	_, err = carol.Deposit(ctx, 100, "client-d3")
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	_, err = carol.Deposit(ctx, 100, "client-d3")
+	if !client.IsCode(err, client.CodeDuplicateReference) {
+		t.Errorf("Deposit with a used reference_id = %v, want %s", err, client.CodeDuplicateReference)
+	}
+
+	_, err = carol.Session("not-a-token").Balance(ctx)
+	if e := clientError(t, err); e.Code != client.CodeUnauthorized || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Balance with a bad token = %+v", e)
+	}
+
+	_, err = carol.EnableWallet(ctx)
+	if !client.IsCode(err, client.CodeWalletAlreadyEnabled) {
+		t.Errorf("EnableWallet twice = %v, want %s", err, client.CodeWalletAlreadyEnabled)
+	}
+
+	_, err = carol.Dispute(ctx, "client-missing")
+	if !client.IsCode(err, client.CodeNotFound) {
+		t.Errorf("Dispute of an unknown id = %v, want %s", err, client.CodeNotFound)
+	}
+
+	_, err = carol.Disable(ctx)
+	if err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	_, err = carol.Deposit(ctx, 100, "client-d4")
+	if !client.IsCode(err, client.CodeWalletDisabled) {
+		t.Errorf("Deposit to a disabled wallet = %v, want %s", err, client.CodeWalletDisabled)
+	}
+}
+
+// dropFirstResponse -> sends every request, but loses the response of the first deposit as
+// a network error would
+type dropFirstResponse struct {
+	dropped int32
+}
+
+func (d *dropFirstResponse) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && req.URL.Path == "/api/v1/wallet/deposits" && atomic.CompareAndSwapInt32(&d.dropped, 0, 1) {
+		resp.Body.Close()
+		return nil, errors.New("connection reset")
+	}
+
+	return resp, err
+}
+
+func TestClientRetry(t *testing.T) {
+	ctx := context.Background()
+	transport := &dropFirstResponse{}
+	dan := newClientSession(t, "client-dan", client.WithHTTPClient(&http.Client{Transport: transport}), client.WithRetries(2, time.Millisecond))
+
+	deposit, err := dan.Deposit(ctx, 700, "client-d5")
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if atomic.LoadInt32(&transport.dropped) != 1 {
+		t.Fatal("the first response was not dropped")
+	}
+
+	wallet, err := dan.Balance(ctx)
+	if err != nil {
+		t.Fatalf("Balance: %v", err)
+	}
+	if wallet.Balance != deposit.Amount || wallet.Balance != 700 {
+		t.Errorf("Balance after a retried deposit = %d, want 700", wallet.Balance)
+	}
+}
+
+func TestClientWebhook(t *testing.T) {
+	ctx := context.Background()
+	dave := newClientSession(t, "client-dave")
+	_, err := dave.Deposit(ctx, 3000, "client-d6")
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+
+	type delivery struct {
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan delivery, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{signature: r.Header.Get(client.WebhookSignatureHeader), body: body}
+	}))
+	defer receiver.Close()
+
+	apiKey := createTestMerchant(t, "Client Shop", receiver.URL)
+	shop := client.New(testServer.URL, client.WithToken(apiKey))
+	_, secret, err := shop.Merchant(ctx)
+	if err != nil {
+		t.Fatalf("Merchant: %v", err)
+	}
+
+	payment, err := shop.CreatePayment(ctx, client.NewPayment{Amount: 1000, OrderID: "client-o1", CustomerID: "client-dave"})
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+	_, err = dave.ApprovePayment(ctx, payment.ID)
+	if err != nil {
+		t.Fatalf("ApprovePayment: %v", err)
+	}
+
+	walletWebhooks.dispatch(ctx)
+
+	var got delivery
+	select {
+	case got = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+	}
+
+	event, err := client.VerifyWebhook(secret, got.signature, got.body, time.Minute)
+	if err != nil {
+		t.Fatalf("VerifyWebhook: %v", err)
+	}
+	if event.Data.Payment.ID != payment.ID || event.Data.Payment.Status != paymentStatusPaid {
+		t.Errorf("VerifyWebhook = %+v", event)
+	}
+
+	tampered := []byte(strings.Replace(string(got.body), `"amount":1000`, `"amount":9000`, 1))
+	for name, check := range map[string]func() error{
+		"wrong secret": func() error {
+			_, err := client.VerifyWebhook("not-the-secret", got.signature, got.body, time.Minute)
+			return err
+		},
+		"tampered body": func() error {
+			_, err := client.VerifyWebhook(secret, got.signature, tampered, time.Minute)
+			return err
+		},
+		"no signature": func() error {
+			_, err := client.VerifyWebhook(secret, "", got.body, time.Minute)
+			return err
+		},
+		"too old": func() error {
+			signature := webhookSignature(secret, time.Now().Add(-time.Hour), got.body)
+			_, err := client.VerifyWebhook(secret, signature, got.body, time.Minute)
+			return err
+		},
+	} {
+		if err := check(); err != client.ErrWebhookSignature {
+			t.Errorf("VerifyWebhook with %s = %v, want %v", name, err, client.ErrWebhookSignature)
+		}
+	}
+}
+
+// createTestMerchant -> the API key of a new merchant posting its webhooks to webhookURL
+func createTestMerchant(t *testing.T, name, webhookURL string) (apiKey string) {
+	t.Helper()
+
+	form := url.Values{"name": {name}, "category": {"groceries"}, "webhook_url": {webhookURL}}
+	req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/api/v1/admin/merchants", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", contentTypeForm)
+	req.Header.Set("Authorization", "Token "+testAdminToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("create merchant: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data struct {
+			APIKey string `json:"api_key"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusCreated || body.Data.APIKey == "" {
+		t.Fatalf("create merchant: status %d", resp.StatusCode)
+	}
+
+	return body.Data.APIKey
+}
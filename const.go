@@ -11,4 +11,15 @@ const (
 
 	depositType    = 1
 	withdrawalType = 2
+	interestType   = 3
+	feeType        = 4
+	promoType      = 5
+	cashbackType   = 6
+	expiryType     = 7
+
+	defaultTransactionLimit = 50
+	maxTransactionLimit     = 200
+
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
 )
@@ -0,0 +1,72 @@
+package main
+
+import "context"
+
+type contextKey int
+
+const (
+	requestInfoKey contextKey = iota
+	spanKey
+)
+
+// requestInfo -> request scoped values carried through context for logging
+type requestInfo struct {
+	RequestID string
+	UserID    string
+	WalletID  string
+	Operation string
+}
+
+func getRequestInfo(ctx context.Context) (info requestInfo) {
+	if p, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info = *p
+	}
+
+	return
+}
+
+// withRequestInfo -> derive a context carrying a copy of info, so later setters
+// on the derived context do not leak to the parent
+func withRequestInfo(ctx context.Context, update func(info *requestInfo)) context.Context {
+	info := getRequestInfo(ctx)
+	update(&info)
+
+	return context.WithValue(ctx, requestInfoKey, &info)
+}
+
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return withRequestInfo(ctx, func(info *requestInfo) {
+		info.RequestID = requestID
+	})
+}
+
+func withUserID(ctx context.Context, userID string) context.Context {
+	return withRequestInfo(ctx, func(info *requestInfo) {
+		info.UserID = userID
+	})
+}
+
+func withOperation(ctx context.Context, operation string) context.Context {
+	return withRequestInfo(ctx, func(info *requestInfo) {
+		info.Operation = operation
+	})
+}
+
+// setWalletID -> attach the wallet once it is known deeper in the call chain
+func setWalletID(ctx context.Context, walletID string) {
+	if p, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		p.WalletID = walletID
+	}
+
+	if s, ok := ctx.Value(spanKey).(*span); ok && walletID != "" {
+		s.setAttribute("wallet.id", walletID)
+	}
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	return getRequestInfo(ctx).RequestID
+}
+
+func userIDFromContext(ctx context.Context) string {
+	return getRequestInfo(ctx).UserID
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contract -> calls the test server and checks every response against the OpenAPI document
+type contract struct {
+	t       *testing.T
+	covered map[string]bool
+
+	// alice and bob -> session tokens of two enabled wallets with money on them
+	alice string
+	bob   string
+}
+
+// TestContract -> every documented route answers as the OpenAPI document says
+func TestContract(t *testing.T) {
+	c := &contract{t: t, covered: map[string]bool{}}
+
+	c.wallets()
+	c.transactions()
+	c.walletStream()
+	c.watchers()
+	c.statements()
+	c.batches()
+	c.transfers()
+	c.pockets()
+	c.goals()
+	c.interest()
+	c.fees()
+	c.vouchers()
+	c.points()
+	c.credits()
+	c.merchants()
+	c.paymentRequests()
+	c.escrows()
+	c.disputes()
+
+	var missing []string
+	for _, r := range registeredRoutes {
+		if !c.covered[r.Method+" "+r.Path] {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("routes not covered by the contract test: %v", missing)
+	}
+}
+
+// call -> send a form body, or none when form is nil, to path of the documented route and
+// return the status and the data of the response
+func (c *contract) call(method, route, path, token string, form url.Values) (status int, data map[string]interface{}) {
+	c.t.Helper()
+
+	var body io.Reader
+	contentType := ""
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+		contentType = contentTypeForm
+	}
+
+	return c.send(method, route, path, token, contentType, body)
+}
+
+// send -> call with any body
+func (c *contract) send(method, route, path, token, contentType string, body io.Reader) (status int, data map[string]interface{}) {
+	c.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, testServer.URL+path, body)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: read: %v", method, path, err)
+	}
+
+	c.covered[method+" "+route] = true
+	for _, violation := range validateOpenAPIResponse(method, route, resp.StatusCode, resp.Header.Get("Content-Type"), raw) {
+		c.t.Errorf("%s %s %d: %s", method, route, resp.StatusCode, violation)
+	}
+
+	var envelope struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(raw, &envelope)
+
+	return resp.StatusCode, envelope.Data
+}
+
+// expect -> call and fail the test unless it answered want
+func (c *contract) expect(want int, method, route, path, token string, form url.Values) (data map[string]interface{}) {
+	c.t.Helper()
+
+	status, data := c.call(method, route, path, token, form)
+	if status != want {
+		c.t.Fatalf("%s %s: status %d, want %d: %v", method, path, status, want, data)
+	}
+
+	return data
+}
+
+// formOf -> form of key, value pairs
+func formOf(pairs ...string) url.Values {
+	form := url.Values{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		form.Add(pairs[i], pairs[i+1])
+	}
+
+	return form
+}
+
+// field -> the string at the path of keys in data, "" when it is missing
+func field(data map[string]interface{}, keys ...string) string {
+	var value interface{} = data
+	for _, key := range keys {
+		object, _ := value.(map[string]interface{})
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+// wallets -> accounts, wallets, deposits, withdrawals and the admin rate limits
+func (c *contract) wallets() {
+	c.alice = field(c.expect(http.StatusCreated, "POST", "/api/v1/init", "/api/v1/init", "", formOf("customer_xid", "contract-alice")), "token")
+	c.bob = field(c.expect(http.StatusCreated, "POST", "/api/v1/init", "/api/v1/init", "", formOf("customer_xid", "contract-bob")), "token")
+	carol := field(c.expect(http.StatusCreated, "POST", "/api/v1/init", "/api/v1/init", "", formOf("customer_xid", "contract-carol")), "token")
+	c.expect(http.StatusBadRequest, "POST", "/api/v1/init", "/api/v1/init", "", formOf())
+
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet", "/api/v1/wallet", c.alice, formOf())
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet", "/api/v1/wallet", c.bob, formOf())
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet", "/api/v1/wallet", carol, formOf())
+	c.expect(http.StatusUnauthorized, "GET", "/api/v1/wallet", "/api/v1/wallet", "nope", nil)
+	wallet := c.expect(http.StatusOK, "GET", "/api/v1/wallet", "/api/v1/wallet", c.alice, nil)
+	if field(wallet, "wallet", "id") == "" {
+		c.t.Error("wallet without an id")
+	}
+	c.expect(http.StatusCreated, "PATCH", "/api/v1/wallet", "/api/v1/wallet", carol, formOf("is_disabled", "true"))
+
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/deposits", "/api/v1/wallet/deposits", c.alice, formOf("amount", "100000", "reference_id", "contract-d1"))
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/deposits", "/api/v1/wallet/deposits", c.bob, formOf("amount", "10000", "reference_id", "contract-d2"))
+	c.expect(http.StatusBadRequest, "POST", "/api/v1/wallet/deposits", "/api/v1/wallet/deposits", c.alice, formOf("amount", "x"))
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/withdrawals", "/api/v1/wallet/withdrawals", c.alice, formOf("amount", "1000", "reference_id", "contract-w1"))
+	c.call("POST", "/api/v1/wallet/withdrawals", "/api/v1/wallet/withdrawals", c.alice, formOf("amount", "100000000", "reference_id", "contract-w2"))
+
+	admin := testAdminToken
+	c.call("PUT", "/api/v1/admin/rate-limits/:user_id", "/api/v1/admin/rate-limits/contract-bob", admin, formOf("group", "wallet", "rate", "1000", "burst", "1000"))
+	c.call("GET", "/api/v1/admin/rate-limits/:user_id", "/api/v1/admin/rate-limits/contract-bob", admin, nil)
+	c.call("DELETE", "/api/v1/admin/rate-limits/:user_id", "/api/v1/admin/rate-limits/contract-bob?group=wallet", admin, nil)
+	c.expect(http.StatusUnauthorized, "GET", "/api/v1/admin/rate-limits/:user_id", "/api/v1/admin/rate-limits/contract-bob", c.alice, nil)
+
+	c.call("GET", "/api/v1/openapi.json", "/api/v1/openapi.json", "", nil)
+	c.call("GET", "/metrics", "/metrics", "", nil)
+}
+
+// transactions -> the history of a wallet
+func (c *contract) transactions() {
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/transactions", "/api/v1/wallet/transactions?limit=5", c.alice, nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/v1/wallet/transactions", "/api/v1/wallet/transactions?limit=x", c.alice, nil)
+}
+
+// walletStream -> server-sent events, checked up to their headers only
+func (c *contract) walletStream() {
+	c.t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	route := "/api/v1/wallet/stream"
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL+route, nil)
+	req.Header.Set("Authorization", "Token "+c.alice)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("GET %s: %v", route, err)
+	}
+	defer resp.Body.Close()
+
+	c.covered["GET "+route] = true
+	for _, violation := range validateOpenAPIResponse(http.MethodGet, route, resp.StatusCode, resp.Header.Get("Content-Type"), nil) {
+		c.t.Errorf("GET %s %d: %s", route, resp.StatusCode, violation)
+	}
+}
+
+// watchers -> who may watch my wallet, and the websocket without an upgrade
+func (c *contract) watchers() {
+	c.expect(http.StatusOK, "PUT", "/api/v1/wallet/watchers/:user_id", "/api/v1/wallet/watchers/contract-bob", c.alice, formOf())
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/watchers", "/api/v1/wallet/watchers", c.alice, nil)
+	c.expect(http.StatusOK, "DELETE", "/api/v1/wallet/watchers/:user_id", "/api/v1/wallet/watchers/contract-bob", c.alice, nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/v1/watch", "/api/v1/watch", c.alice, nil)
+}
+
+// statements -> the statement of this month
+func (c *contract) statements() {
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/statements", "/api/v1/wallet/statements?month="+time.Now().Format("2006-01"), c.alice, nil)
+	c.expect(http.StatusBadRequest, "GET", "/api/v1/wallet/statements", "/api/v1/wallet/statements?month=x", c.alice, nil)
+}
+
+// batches -> a csv upload applied and its results
+func (c *contract) batches() {
+	admin := testAdminToken
+	csv := "customer_xid,amount,reference_id,type\ncontract-bob,10,contract-b1,deposit\n"
+
+	c.expect(http.StatusUnsupportedMediaType, "POST", "/api/v1/admin/batches", "/api/v1/admin/batches", admin, formOf())
+	status, batch := c.send("POST", "/api/v1/admin/batches", "/api/v1/admin/batches", admin, contentTypeCSV, strings.NewReader(csv))
+	if status != http.StatusCreated {
+		c.t.Fatalf("POST /api/v1/admin/batches: status %d: %v", status, batch)
+	}
+	batchID := field(batch, "id")
+
+	c.expect(http.StatusAccepted, "POST", "/api/v1/admin/batches/:batch_id/apply", "/api/v1/admin/batches/"+batchID+"/apply", admin, formOf())
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/batches/:batch_id", "/api/v1/admin/batches/"+batchID, admin, nil)
+	c.call("GET", "/api/v1/admin/batches/:batch_id/results", "/api/v1/admin/batches/"+batchID+"/results", admin, nil)
+	c.expect(http.StatusNotFound, "GET", "/api/v1/admin/batches/:batch_id", "/api/v1/admin/batches/nope", admin, nil)
+}
+
+// transfers -> a transfer and a standing order through its states
+func (c *contract) transfers() {
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/transfers", "/api/v1/wallet/transfers", c.alice, formOf("to_user_id", "contract-bob", "amount", "100", "reference_id", "contract-t1"))
+	c.expect(http.StatusBadRequest, "POST", "/api/v1/wallet/transfers", "/api/v1/wallet/transfers", c.alice, formOf("to_user_id", "contract-alice", "amount", "100", "reference_id", "contract-t2"))
+
+	schedule := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/schedules", "/api/v1/wallet/schedules", c.alice, formOf("kind", "transfer", "to_user_id", "contract-bob", "amount", "1", "cron", "@monthly"))
+	path := "/api/v1/wallet/schedules/" + field(schedule, "schedule", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/schedules", "/api/v1/wallet/schedules", c.alice, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/schedules/:schedule_id", path, c.alice, nil)
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/schedules/:schedule_id/pause", path+"/pause", c.alice, formOf())
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/schedules/:schedule_id/resume", path+"/resume", c.alice, formOf())
+	c.expect(http.StatusOK, "DELETE", "/api/v1/wallet/schedules/:schedule_id", path, c.alice, nil)
+}
+
+// pockets -> a pocket filled, emptied and deleted
+func (c *contract) pockets() {
+	pocket := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/pockets", "/api/v1/wallet/pockets", c.alice, formOf("name", "Trips"))
+	pocketID := field(pocket, "pocket", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/pockets", "/api/v1/wallet/pockets", c.alice, nil)
+
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/pockets/moves", "/api/v1/wallet/pockets/moves", c.alice, formOf("from_pocket_id", "main", "to_pocket_id", pocketID, "amount", "10"))
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/pockets/:pocket_id/transactions", "/api/v1/wallet/pockets/"+pocketID+"/transactions", c.alice, nil)
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/pockets/moves", "/api/v1/wallet/pockets/moves", c.alice, formOf("from_pocket_id", pocketID, "to_pocket_id", "main", "amount", "10"))
+	c.expect(http.StatusOK, "DELETE", "/api/v1/wallet/pockets/:pocket_id", "/api/v1/wallet/pockets/"+pocketID, c.alice, nil)
+	c.expect(http.StatusNotFound, "DELETE", "/api/v1/wallet/pockets/:pocket_id", "/api/v1/wallet/pockets/"+pocketID, c.alice, nil)
+}
+
+// goals -> a savings goal with rules, cancelled
+func (c *contract) goals() {
+	goal := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/goals", "/api/v1/wallet/goals", c.alice, formOf("name", "Bike", "target_amount", "5000", "target_date", time.Now().AddDate(1, 0, 0).Format("2006-01-02")))
+	path := "/api/v1/wallet/goals/" + field(goal, "goal", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/goals", "/api/v1/wallet/goals", c.alice, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/goals/:goal_id", path, c.alice, nil)
+	c.expect(http.StatusOK, "PUT", "/api/v1/wallet/goals/:goal_id/rules", path+"/rules", c.alice, formOf("round_up_unit", "100"))
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/goals/:goal_id/history", path+"/history", c.alice, nil)
+	c.expect(http.StatusOK, "DELETE", "/api/v1/wallet/goals/:goal_id", path, c.alice, nil)
+}
+
+// interest -> a rate table, a run and the interest of a wallet
+func (c *contract) interest() {
+	admin := testAdminToken
+	c.expect(http.StatusOK, "PUT", "/api/v1/admin/interest/rates/:effective_from", "/api/v1/admin/interest/rates/2026-01-01", admin, formOf("tiers", "0:0"))
+	c.expect(http.StatusBadRequest, "PUT", "/api/v1/admin/interest/rates/:effective_from", "/api/v1/admin/interest/rates/x", admin, formOf("tiers", "0:0"))
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/interest/rates", "/api/v1/admin/interest/rates", admin, nil)
+	c.call("POST", "/api/v1/admin/interest/run", "/api/v1/admin/interest/run", admin, formOf())
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/interest", "/api/v1/wallet/interest", c.alice, nil)
+}
+
+// fees -> a fee schedule charged once into the revenue account, then removed
+func (c *contract) fees() {
+	admin := testAdminToken
+	schedule := formOf("name", "atm", "transaction_type", "withdrawal", "kind", "flat", "flat_amount", "10", "effective_from", time.Now().AddDate(0, 0, -1).Format("2006-01-02"))
+	fee := c.expect(http.StatusCreated, "POST", "/api/v1/admin/fees", "/api/v1/admin/fees", admin, schedule)
+	path := "/api/v1/admin/fees/" + field(fee, "fee_schedule", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/fees", "/api/v1/admin/fees", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/fees/:fee_schedule_id", path, admin, nil)
+	c.expect(http.StatusOK, "PUT", "/api/v1/admin/fees/:fee_schedule_id", path, admin, schedule)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/fees/quote", "/api/v1/wallet/fees/quote?transaction_type=withdrawal&amount=1000", c.alice, nil)
+
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/withdrawals", "/api/v1/wallet/withdrawals", c.alice, formOf("amount", "100", "reference_id", "contract-w3"))
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/accounts", "/api/v1/admin/accounts", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/accounts/:account_id/entries", "/api/v1/admin/accounts/revenue/entries", admin, nil)
+	c.expect(http.StatusNotFound, "GET", "/api/v1/admin/accounts/:account_id/entries", "/api/v1/admin/accounts/nope/entries", admin, nil)
+
+	c.expect(http.StatusOK, "DELETE", "/api/v1/admin/fees/:fee_schedule_id", path, admin, nil)
+}
+
+// vouchers -> a campaign and one of its codes redeemed
+func (c *contract) vouchers() {
+	admin := testAdminToken
+	campaign := c.expect(http.StatusCreated, "POST", "/api/v1/admin/vouchers", "/api/v1/admin/vouchers", admin, formOf("name", "launch", "amount", "100", "count", "2", "expires_at", time.Now().AddDate(1, 0, 0).UTC().Format(time.RFC3339)))
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/vouchers", "/api/v1/admin/vouchers", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/vouchers/:campaign_id", "/api/v1/admin/vouchers/"+field(campaign, "campaign", "id"), admin, nil)
+
+	code := ""
+	if codes, ok := campaign["codes"].([]interface{}); ok && len(codes) > 0 {
+		voucher, _ := codes[0].(map[string]interface{})
+		code = field(voucher, "code")
+	}
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/vouchers/redeem", "/api/v1/wallet/vouchers/redeem", c.alice, formOf("code", code))
+	c.expect(http.StatusConflict, "POST", "/api/v1/wallet/vouchers/redeem", "/api/v1/wallet/vouchers/redeem", c.bob, formOf("code", code))
+}
+
+// points -> the points program and rules, a redemption and a reversed withdrawal
+func (c *contract) points() {
+	admin := testAdminToken
+	c.expect(http.StatusOK, "PUT", "/api/v1/admin/points/program", "/api/v1/admin/points/program", admin, formOf("expiry_days", "365", "point_value", "1"))
+	c.expect(http.StatusOK, "PUT", "/api/v1/admin/points/rules/:category", "/api/v1/admin/points/rules/books", admin, formOf("spend_per_point", "100"))
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/points", "/api/v1/admin/points", admin, nil)
+	c.expect(http.StatusOK, "DELETE", "/api/v1/admin/points/rules/:category", "/api/v1/admin/points/rules/books", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/points", "/api/v1/wallet/points", c.alice, nil)
+	c.call("POST", "/api/v1/wallet/points/redeem", "/api/v1/wallet/points/redeem", c.alice, formOf("points", "1"))
+
+	withdrawal := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/withdrawals", "/api/v1/wallet/withdrawals", c.alice, formOf("amount", "500", "reference_id", "contract-w4"))
+	path := "/api/v1/admin/transactions/" + field(withdrawal, "withdrawal", "id") + "/reverse"
+	c.expect(http.StatusCreated, "POST", "/api/v1/admin/transactions/:transaction_id/reverse", path, admin, formOf("reason", "contract"))
+	c.expect(http.StatusConflict, "POST", "/api/v1/admin/transactions/:transaction_id/reverse", path, admin, formOf("reason", "contract"))
+}
+
+// credits -> a promo credit granted by an admin
+func (c *contract) credits() {
+	admin := testAdminToken
+	c.expect(http.StatusCreated, "POST", "/api/v1/admin/credits/:user_id", "/api/v1/admin/credits/contract-alice", admin, formOf("source", "promo", "amount", "100", "expires_at", time.Now().AddDate(0, 1, 0).UTC().Format(time.RFC3339)))
+	c.expect(http.StatusNotFound, "POST", "/api/v1/admin/credits/:user_id", "/api/v1/admin/credits/contract-nobody", admin, formOf("source", "promo", "amount", "100", "expires_at", time.Now().AddDate(0, 1, 0).UTC().Format(time.RFC3339)))
+}
+
+// merchants -> a merchant with its keys, a payment approved and refunded, one declined
+func (c *contract) merchants() {
+	admin := testAdminToken
+	settings := formOf("name", "Coffee", "category", "groceries", "webhook_url", "http://127.0.0.1:1/hook", "fee_flat", "10")
+	merchant := c.expect(http.StatusCreated, "POST", "/api/v1/admin/merchants", "/api/v1/admin/merchants", admin, settings)
+	path := "/api/v1/admin/merchants/" + field(merchant, "merchant", "id")
+	apiKey := field(merchant, "api_key")
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/merchants", "/api/v1/admin/merchants", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/merchants/:merchant_id", path, admin, nil)
+	c.expect(http.StatusOK, "PUT", "/api/v1/admin/merchants/:merchant_id", path, admin, settings)
+	key := c.expect(http.StatusCreated, "POST", "/api/v1/admin/merchants/:merchant_id/keys", path+"/keys", admin, formOf())
+	c.expect(http.StatusOK, "DELETE", "/api/v1/admin/merchants/:merchant_id/keys/:key_id", path+"/keys/"+field(key, "key", "id"), admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/merchant", "/api/v1/merchant", apiKey, nil)
+	c.expect(http.StatusUnauthorized, "GET", "/api/v1/merchant", "/api/v1/merchant", c.alice, nil)
+
+	payment := c.expect(http.StatusCreated, "POST", "/api/v1/merchant/payments", "/api/v1/merchant/payments", apiKey, formOf("amount", "1000", "order_id", "contract-o1", "customer_id", "contract-alice"))
+	paymentID := field(payment, "payment", "id")
+	declined := c.expect(http.StatusCreated, "POST", "/api/v1/merchant/payments", "/api/v1/merchant/payments", apiKey, formOf("amount", "1000", "order_id", "contract-o2"))
+	c.expect(http.StatusOK, "GET", "/api/v1/merchant/payments", "/api/v1/merchant/payments", apiKey, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/payments/:payment_id", "/api/v1/wallet/payments/"+paymentID, c.alice, nil)
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/payments/:payment_id/approve", "/api/v1/wallet/payments/"+paymentID+"/approve", c.alice, formOf())
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/payments/:payment_id/decline", "/api/v1/wallet/payments/"+field(declined, "payment", "id")+"/decline", c.alice, formOf())
+	c.expect(http.StatusCreated, "POST", "/api/v1/merchant/payments/:payment_id/refunds", "/api/v1/merchant/payments/"+paymentID+"/refunds", apiKey, formOf("amount", "100", "reason", "contract"))
+	c.expect(http.StatusOK, "GET", "/api/v1/merchant/payments/:payment_id", "/api/v1/merchant/payments/"+paymentID, apiKey, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/merchant/webhooks", "/api/v1/merchant/webhooks", apiKey, nil)
+}
+
+// paymentRequests -> requests accepted, declined and cancelled
+func (c *contract) paymentRequests() {
+	request := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/payment-requests", "/api/v1/wallet/payment-requests", c.alice, formOf("payers", "contract-bob:100", "description", "dinner"))
+	path := "/api/v1/wallet/payment-requests/" + field(request, "request", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/payment-requests", "/api/v1/wallet/payment-requests?role=received", c.bob, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/payment-requests/:request_id", path, c.bob, nil)
+	c.expect(http.StatusCreated, "POST", "/api/v1/wallet/payment-requests/:request_id/accept", path+"/accept", c.bob, formOf())
+
+	declined := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/payment-requests", "/api/v1/wallet/payment-requests", c.alice, formOf("payers", "contract-bob:100"))
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/payment-requests/:request_id/decline", "/api/v1/wallet/payment-requests/"+field(declined, "request", "id")+"/decline", c.bob, formOf())
+	cancelled := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/payment-requests", "/api/v1/wallet/payment-requests", c.alice, formOf("payers", "contract-bob:100"))
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/payment-requests/:request_id/cancel", "/api/v1/wallet/payment-requests/"+field(cancelled, "request", "id")+"/cancel", c.alice, formOf())
+}
+
+// escrows -> one escrow released, one disputed and refunded by an admin
+func (c *contract) escrows() {
+	admin := testAdminToken
+	escrow := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/escrows", "/api/v1/wallet/escrows", c.alice, formOf("seller_id", "contract-bob", "amount", "300", "description", "bike"))
+	path := "/api/v1/wallet/escrows/" + field(escrow, "escrow", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/escrows", "/api/v1/wallet/escrows?role=buyer", c.alice, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/escrows/:escrow_id", path, c.bob, nil)
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/escrows/:escrow_id/release", path+"/release", c.alice, formOf("note", "thanks"))
+	c.expect(http.StatusConflict, "POST", "/api/v1/wallet/escrows/:escrow_id/refund", path+"/refund", c.bob, formOf("note", "late"))
+
+	escrow = c.expect(http.StatusCreated, "POST", "/api/v1/wallet/escrows", "/api/v1/wallet/escrows", c.alice, formOf("seller_id", "contract-bob", "amount", "300"))
+	escrowID := field(escrow, "escrow", "id")
+	c.expect(http.StatusOK, "POST", "/api/v1/wallet/escrows/:escrow_id/dispute", "/api/v1/wallet/escrows/"+escrowID+"/dispute", c.alice, formOf("note", "broken"))
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/escrows", "/api/v1/admin/escrows?status=disputed", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/escrows/:escrow_id", "/api/v1/admin/escrows/"+escrowID, admin, nil)
+	c.expect(http.StatusOK, "POST", "/api/v1/admin/escrows/:escrow_id/resolve", "/api/v1/admin/escrows/"+escrowID+"/resolve", admin, formOf("outcome", "refund", "note", "broken"))
+}
+
+// disputes -> a dispute of a withdrawal reviewed, credited and withdrawn
+func (c *contract) disputes() {
+	admin := testAdminToken
+	spent := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/withdrawals", "/api/v1/wallet/withdrawals", c.alice, formOf("amount", "700", "reference_id", "contract-w5"))
+	dispute := c.expect(http.StatusCreated, "POST", "/api/v1/wallet/disputes", "/api/v1/wallet/disputes", c.alice, formOf("transaction_id", field(spent, "withdrawal", "id"), "reason", "unauthorized", "evidence", "not me"))
+	disputeID := field(dispute, "dispute", "id")
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/disputes", "/api/v1/wallet/disputes", c.alice, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/wallet/disputes/:dispute_id", "/api/v1/wallet/disputes/"+disputeID, c.alice, nil)
+	c.expect(http.StatusNotFound, "GET", "/api/v1/wallet/disputes/:dispute_id", "/api/v1/wallet/disputes/nope", c.alice, nil)
+	c.call("POST", "/api/v1/wallet/disputes/:dispute_id/notes", "/api/v1/wallet/disputes/"+disputeID+"/notes", c.alice, formOf("note", "receipt"))
+
+	path := "/api/v1/admin/disputes/" + disputeID
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/disputes", "/api/v1/admin/disputes", admin, nil)
+	c.expect(http.StatusOK, "GET", "/api/v1/admin/disputes/:dispute_id", path, admin, nil)
+	c.call("POST", "/api/v1/admin/disputes/:dispute_id/notes", path+"/notes", admin, formOf("note", "looking", "internal", "true"))
+	c.call("POST", "/api/v1/admin/disputes/:dispute_id/status", path+"/status", admin, formOf("status", "reviewing"))
+	c.call("POST", "/api/v1/admin/disputes/:dispute_id/provisional-credit", path+"/provisional-credit", admin, formOf("note", "goodwill"))
+	c.call("POST", "/api/v1/wallet/disputes/:dispute_id/withdraw", "/api/v1/wallet/disputes/"+disputeID+"/withdraw", c.alice, formOf())
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A five field cron expression, "minute hour day-of-month month day-of-week", evaluated
+// in UTC. Fields take *, numbers, ranges (1-5), lists (1,15) and steps (*/15, 0-30/10).
+// When both day fields are restricted a day matching either one matches, as in cron.
+
+// cronSearchLimit -> how far ahead next looks before giving up, e.g. for "0 0 30 2 *"
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronMacros -> the usual shorthands
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cronSchedule -> one bit per allowed value of each field
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar, dowStar -> the day fields were *, see dayMatches
+	domStar, dowStar bool
+}
+
+func parseCron(spec string) (schedule cronSchedule, err error) {
+	spec = strings.TrimSpace(spec)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		err = errors.New("expected 5 fields: minute hour day-of-month month day-of-week")
+		return
+	}
+
+	bits := make([]uint64, len(cronFields))
+	for i, field := range cronFields {
+		bits[i], err = parseCronField(parts[i], field)
+		if err != nil {
+			return
+		}
+	}
+
+	// 7 is sunday too
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	schedule = cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}
+
+	return
+}
+
+func parseCronField(part string, field cronField) (bits uint64, err error) {
+	max := field.max
+	if field.name == "day of week" {
+		max = 7
+	}
+
+	for _, item := range strings.Split(part, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			rangePart = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 {
+				err = fmt.Errorf("%s: invalid step in %q", field.name, item)
+				return
+			}
+		}
+
+		low, high := field.min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			low, err = strconv.Atoi(bounds[0])
+			if err == nil {
+				high, err = strconv.Atoi(bounds[1])
+			}
+		default:
+			low, err = strconv.Atoi(rangePart)
+			high = low
+			if err == nil && step > 1 {
+				high = max
+			}
+		}
+
+		if err != nil || low < field.min || high > max || low > high {
+			err = fmt.Errorf("%s: %q is not within %d-%d", field.name, item, field.min, max)
+			return
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return
+}
+
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// next -> the first minute after t that matches, zero when there is none within cronSearchLimit
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
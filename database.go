@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"database/sql"
-	"log"
 	"os"
 	"time"
 )
@@ -12,72 +11,117 @@ var (
 	database *sql.DB
 )
 
-func initDB() {
-	os.Remove("wallet.db") // I delete the file to avoid duplicated records.
+// initDB -> open wallet.db and create the tables it misses. The file is kept across restarts,
+// so interrupted batches resume and nothing is lost. RESET_DB=true starts from an empty one.
+func initDB(ctx context.Context) {
 	// SQLite is a file based database.
+	if os.Getenv("RESET_DB") == "true" {
+		logInfo(ctx, "Removing wallet.db...")
+		os.Remove("wallet.db")
+	}
 
-	log.Println("Creating wallet.db...")
-	file, err := os.Create("wallet.db") // Create SQLite file
-	if err != nil {
-		log.Fatal(err.Error())
+	if _, err := os.Stat("wallet.db"); os.IsNotExist(err) {
+		logInfo(ctx, "Creating wallet.db...")
+		file, err := os.Create("wallet.db") // Create SQLite file
+		if err != nil {
+			logFatal(ctx, "initDB Create", err)
+		}
+		file.Close()
+		logInfo(ctx, "wallet.db created")
 	}
-	file.Close()
-	log.Println("wallet.db created")
 
-	database, _ = sql.Open("sqlite3", "./wallet.db") // Open the created SQLite File
+	// Open the SQLite File, writers take the lock up front and wait for each other
+	database, _ = sql.Open("sqlite3", "./wallet.db?_busy_timeout=5000&_txlock=immediate")
 
-	createTable(database) // Create Database Tables
+	createTable(ctx, database) // Create Database Tables
 }
 
-func createTable(db *sql.DB) {
-	ctx := context.Background()
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		log.Println("Error createTable BeginTx: " + err.Error())
-		return
-	}
-
-	_, err = tx.ExecContext(ctx, createUserTable)
-	if err != nil {
-		tx.Rollback()
-		log.Println("Error createTable ExecContext: " + err.Error())
-		return
-	}
-
-	_, err = tx.ExecContext(ctx, createSessionTable)
-	if err != nil {
-		tx.Rollback()
-		log.Println("Error createTable ExecContext: " + err.Error())
-		return
-	}
+// tables -> schema created on startup when missing, in order
+var tables = []string{
+	createUserTable,
+	createSessionTable,
+	createWalletTable,
+	createTransactionTable,
+	createRateLimitOverrideTable,
+	createRateLimitBucketTable,
+	createIdempotencyKeyTable,
+	createWalletEventTable,
+	createWalletWatcherTable,
+	createStatementTable,
+	createBatchTable,
+	createBatchRowTable,
+	createTransferTable,
+	createScheduleTable,
+	createScheduleRunTable,
+	createPocketTable,
+	createPocketEntryTable,
+	createGoalTable,
+	createGoalContributionTable,
+	createInterestRateTable,
+	createInterestAccrualTable,
+	createInterestPostingTable,
+	createInterestStateTable,
+	createSystemAccountTable,
+	createSystemEntryTable,
+	createFeeScheduleTable,
+	createFeeChargeTable,
+	createVoucherCampaignTable,
+	createVoucherTable,
+	createPointsProgramTable,
+	createPointsRuleTable,
+	createPointsLotTable,
+	createPointsEntryTable,
+	createTransactionReversalTable,
+	createBalanceBucketTable,
+	createMerchantTable,
+	createMerchantKeyTable,
+	createPaymentTable,
+	createPaymentRefundTable,
+	createWebhookTable,
+	createPaymentRequestTable,
+	createPaymentRequestShareTable,
+	createEscrowTable,
+	createEscrowEventTable,
+	createEscrowSettledIndex,
+	createDisputeTable,
+	createDisputeNoteTable,
+}
 
-	_, err = tx.ExecContext(ctx, createWalletTable)
+func createTable(ctx context.Context, db *sql.DB) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
-		log.Println("Error createTable ExecContext: " + err.Error())
+		logError(ctx, "createTable BeginTx", err)
 		return
 	}
 
-	_, err = tx.ExecContext(ctx, createTransactionTable)
-	if err != nil {
-		tx.Rollback()
-		log.Println("Error createTable ExecContext: " + err.Error())
-		return
+	for _, table := range tables {
+		_, err = tx.ExecContext(ctx, table)
+		if err != nil {
+			tx.Rollback()
+			logError(ctx, "createTable ExecContext", err)
+			return
+		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		log.Println("Error createTable Commit: " + err.Error())
+		logError(ctx, "createTable Commit", err)
 		return
 	}
 
-	log.Println("table created")
+	logInfo(ctx, "table created")
 }
 
-func insertUser(db *sql.DB, ID string) (err error) {
-	statement, err := db.Prepare(insertUserSQL)
+func insertUser(ctx context.Context, db *sql.DB, ID string) (err error) {
+	defer observeQuery("insertUser", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertUser")
+	defer func() {
+		span.end(err)
+	}()
+
+	statement, err := db.PrepareContext(ctx, insertUserSQL)
 	if err != nil {
-		log.Println("Error insertUser Prepare: " + err.Error())
+		logError(ctx, "insertUser Prepare", err)
 		return
 	}
 
@@ -85,46 +129,87 @@ func insertUser(db *sql.DB, ID string) (err error) {
 		ID = generateUUID()
 	}
 
-	_, err = statement.Exec(ID)
+	_, err = statement.ExecContext(ctx, ID)
 	if err != nil {
-		log.Println("Error insertUser Exec: " + err.Error())
+		logError(ctx, "insertUser Exec", err)
 	}
 
 	return
 }
 
-func createSession(db *sql.DB, userID, sessionID string) (err error) {
-	statement, err := db.Prepare(insertSessionSQL)
+func createSession(ctx context.Context, db *sql.DB, userID, sessionID string) (err error) {
+	defer observeQuery("createSession", time.Now())
+	ctx, span := startQuerySpan(ctx, "createSession")
+	defer func() {
+		span.end(err)
+	}()
+
+	statement, err := db.PrepareContext(ctx, insertSessionSQL)
 	if err != nil {
-		log.Println("Error insertUser Prepare: " + err.Error())
+		logError(ctx, "insertUser Prepare", err)
 		return
 	}
 
-	_, err = statement.Exec(sessionID, userID, statusActive)
+	_, err = statement.ExecContext(ctx, sessionID, userID, statusActive)
 	if err != nil {
-		log.Println("Error insertUser Exec: " + err.Error())
+		logError(ctx, "insertUser Exec", err)
 	}
 
 	return
 }
 
-func getSession(db *sql.DB, sessionID string) (userID string, err error) {
-	row := db.QueryRow(
+func getSession(ctx context.Context, db *sql.DB, sessionID string) (userID string, err error) {
+	defer observeQuery("getSession", time.Now())
+	ctx, span := startQuerySpan(ctx, "getSession")
+	defer func() {
+		span.end(err)
+	}()
+
+	row := db.QueryRowContext(ctx,
 		checkSessionSQL,
 		sessionID,
 		statusActive,
 	)
 
 	err = row.Scan(&userID)
+	if err == sql.ErrNoRows {
+		// an unknown or inactive token is the caller's problem, not ours
+		logWarn(ctx, "getSession no active session")
+		return
+	}
+	if err != nil {
+		logError(ctx, "getSession Scan", err)
+	}
+
+	return
+}
+
+func userExists(ctx context.Context, db *sql.DB, userID string) (exists bool, err error) {
+	defer observeQuery("userExists", time.Now())
+	ctx, span := startQuerySpan(ctx, "userExists")
+	defer func() {
+		span.end(err)
+	}()
+
+	var count int
+	err = db.QueryRowContext(ctx, countUserSQL, userID).Scan(&count)
 	if err != nil {
-		log.Println("Error getSession Scan: " + err.Error())
+		logError(ctx, "userExists Scan", err)
+		return
 	}
 
+	exists = count > 0
 	return
 }
 
-func getWalletByUserID(db *sql.DB, userID string) (wallet Wallet, err error) {
-	row := db.QueryRow(
+func getWalletByUserID(ctx context.Context, db *sql.DB, userID string) (wallet Wallet, err error) {
+	defer observeQuery("getWalletByUserID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getWalletByUserID")
+	defer func() {
+		span.end(err)
+	}()
+
+	row := db.QueryRowContext(ctx,
 		getWalletByUserIDSQL,
 		userID,
 	)
@@ -137,57 +222,120 @@ func getWalletByUserID(db *sql.DB, userID string) (wallet Wallet, err error) {
 		&wallet.EnableTime,
 	)
 	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error getWalletByUserID Scan: " + err.Error())
+		logError(ctx, "getWalletByUserID Scan", err)
 	}
 
 	return
 }
 
-func updateWalletStatusByID(db *sql.DB, ID string, status int) (err error) {
-	statement, err := db.Prepare(updateWalletStatusByUserIDSQL)
+func updateWalletStatusByID(ctx context.Context, db *sql.DB, ID string, status int) (updateTime time.Time, err error) {
+	defer observeQuery("updateWalletStatusByID", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateWalletStatusByID")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("Error updateWalletStatusByID Prepare: " + err.Error())
+		logError(ctx, "updateWalletStatusByID BeginTx", err)
 		return
 	}
 
-	now := time.Now()
+	updateTime = time.Now()
+
+	_, err = tx.ExecContext(ctx, updateWalletStatusByIDSQL, status, updateTime, ID)
+	if err != nil {
+		tx.Rollback()
+		logError(ctx, "updateWalletStatusByID Exec", err)
+		return
+	}
 
-	_, err = statement.Exec(status, ID, now)
+	eventType := walletEventDisabled
+	if status == statusActive {
+		eventType = walletEventEnabled
+	}
+
+	event, err := recordWalletEvent(ctx, tx, ID, eventType, nil)
 	if err != nil {
-		log.Println("Error updateWalletStatusByID Exec: " + err.Error())
+		tx.Rollback()
+		return
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "updateWalletStatusByID Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
 	return
 }
 
-func createWallet(db *sql.DB, userID string, balance int) (wallet Wallet, err error) {
-	statement, err := db.Prepare(insertWalletSQL)
+func createWallet(ctx context.Context, db *sql.DB, userID string, balance int) (wallet Wallet, err error) {
+	defer observeQuery("createWallet", time.Now())
+	ctx, span := startQuerySpan(ctx, "createWallet")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("Error createWallet Prepare: " + err.Error())
+		logError(ctx, "createWallet BeginTx", err)
 		return
 	}
 
-	id := generateUUID()
+	wallet, event, err := insertWallet(ctx, tx, userID, balance)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
 
-	now := time.Now()
-	_, err = statement.Exec(id, userID, balance, statusActive, now)
+	err = tx.Commit()
 	if err != nil {
-		log.Println("Error createWallet Exec: " + err.Error())
+		logError(ctx, "createWallet Commit", err)
+		return
 	}
 
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// insertWallet -> an enabled wallet of userID with its main pocket in tx, the enabled event
+// is published by the caller once tx commits
+func insertWallet(ctx context.Context, tx *sql.Tx, userID string, balance int) (wallet Wallet, event walletEvent, err error) {
 	wallet = Wallet{
-		ID:         id,
+		ID:         generateUUID(),
 		UserID:     userID,
 		Balance:    balance,
 		Status:     statusActive,
-		EnableTime: now,
+		EnableTime: time.Now(),
+	}
+
+	_, err = tx.ExecContext(ctx, insertWalletSQL, wallet.ID, wallet.UserID, wallet.Balance, wallet.Status, wallet.EnableTime)
+	if err != nil {
+		logError(ctx, "createWallet Exec", err)
+		return
 	}
 
+	err = insertMainPocket(ctx, tx, wallet.ID, balance, wallet.EnableTime)
+	if err != nil {
+		return
+	}
+
+	event, err = recordWalletEvent(ctx, tx, wallet.ID, walletEventEnabled, nil)
 	return
 }
 
-func getTransactionByReferenceID(db *sql.DB, referenceID string, transactionType int) (transaction WalletTransaction, err error) {
-	row := db.QueryRow(
+func getTransactionByReferenceID(ctx context.Context, db *sql.DB, referenceID string, transactionType int) (transaction WalletTransaction, err error) {
+	defer observeQuery("getTransactionByReferenceID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getTransactionByReferenceID")
+	defer func() {
+		span.end(err)
+	}()
+
+	row := db.QueryRowContext(ctx,
 		getTransactionByReferenceIDSQL,
 		referenceID,
 		transactionType,
@@ -201,28 +349,158 @@ func getTransactionByReferenceID(db *sql.DB, referenceID string, transactionType
 		&transaction.ReferenceID,
 	)
 	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error getWalletByUserID Scan: " + err.Error())
+		logError(ctx, "getWalletByUserID Scan", err)
 	}
 
 	return
 }
 
-func updateBalance(db *sql.DB, walletID, referenceID string, amount, total, transactionType int) (transaction WalletTransaction, err error) {
-	ctx := context.Background()
+func getTransactionByID(ctx context.Context, db *sql.DB, transactionID string) (transaction WalletTransaction, err error) {
+	defer observeQuery("getTransactionByID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getTransactionByID")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getTransactionByIDSQL, transactionID).Scan(
+		&transaction.ID,
+		&transaction.WalletID,
+		&transaction.Type,
+		&transaction.Amount,
+		&transaction.ReferenceID,
+		&transaction.CreateTime,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getTransactionByID Scan", err)
+	}
+
+	return
+}
+
+func updateBalance(ctx context.Context, db *sql.DB, walletID, pocketID, referenceID string, amount, transactionType int) (transaction WalletTransaction, err error) {
+	defer observeQuery("updateBalance", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateBalance")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "updateBalance BeginTx", err)
+		return
+	}
+
+	transaction, event, err := applyBalanceChange(ctx, tx, walletID, pocketID, referenceID, amount, transactionType)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "updateBalance Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// updateBalanceForWithdrawal -> updateBalance for a withdrawal, in one tx with the fee it
+// pays and the points it earns by the rule of category. The fee is debited first, so the
+// goal round-up of the withdrawal cannot leave the pocket short of it.
+func updateBalanceForWithdrawal(ctx context.Context, db *sql.DB, walletID, pocketID, referenceID, category string, amount int, charge *FeeCharge) (transaction WalletTransaction, err error) {
+	defer observeQuery("updateBalanceForWithdrawal", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateBalanceForWithdrawal")
+	defer func() {
+		span.end(err)
+	}()
+
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("Error updateBalance BeginTx: " + err.Error())
+		logError(ctx, "updateBalanceForWithdrawal BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var feeEvent walletEvent
+	if charge.Amount > 0 {
+		feeEvent, err = applyFee(ctx, tx, charge, pocketID)
+		if err != nil {
+			return
+		}
+	}
+
+	transaction, event, err := applyBalanceChange(ctx, tx, walletID, pocketID, referenceID, amount, withdrawalType)
+	if err != nil {
+		return
+	}
+
+	if charge.Amount > 0 {
+		err = linkFee(ctx, tx, charge, transaction.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = earnPoints(ctx, tx, transaction, category)
+	if err != nil {
 		return
 	}
 
-	_, err = tx.ExecContext(ctx,
-		updateWalletBalanceByIDSQL,
-		total,
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "updateBalanceForWithdrawal Commit", err)
+		return
+	}
+
+	if charge.Amount > 0 {
+		publishWalletEvent(ctx, feeEvent)
+	}
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// applyBalanceChange -> add amount to the balance of the wallet, or take it for a debit, and
+// record the transaction, its pocket entry and its event in tx, the event is published by the
+// caller once tx commits. The balance changes relative to the one in tx, so concurrent changes
+// cannot overwrite each other, and a debit the wallet cannot cover is errInsufficientFunds.
+// The transaction goes to pocketID, or to the main pocket when it is empty, and the savings
+// goal rules it triggers move their share in the same tx. A debit spends the balance buckets
+// first, except an expiry that empties its own bucket.
+func applyBalanceChange(ctx context.Context, tx *sql.Tx, walletID, pocketID, referenceID string, amount, transactionType int) (transaction WalletTransaction, event walletEvent, err error) {
+	debit := WalletTransaction{Type: transactionType}.Debit()
+	query := addWalletBalanceSQL
+	if debit {
+		query = takeWalletBalanceSQL
+	}
+
+	stmtCtx, stmtSpan := startQuerySpan(ctx, "changeWalletBalanceByID")
+	result, err := tx.ExecContext(stmtCtx,
+		query,
+		amount,
 		walletID,
 	)
+	stmtSpan.end(err)
 	if err != nil {
-		tx.Rollback()
-		log.Println("Error updateBalance ExecContext: " + err.Error())
+		logError(ctx, "updateBalance ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "updateBalance RowsAffected", err)
+		return
+	}
+	if changed == 0 && debit {
+		err = errInsufficientFunds
+		return
+	}
+	if changed == 0 {
+		err = sql.ErrNoRows
+		logError(ctx, "updateBalance RowsAffected", err)
 		return
 	}
 
@@ -236,7 +514,8 @@ func updateBalance(db *sql.DB, walletID, referenceID string, amount, total, tran
 		CreateTime:  now,
 	}
 
-	_, err = tx.ExecContext(ctx,
+	stmtCtx, stmtSpan = startQuerySpan(ctx, "insertTransaction")
+	_, err = tx.ExecContext(stmtCtx,
 		insertTransactionSQL,
 		transaction.ID,
 		transaction.WalletID,
@@ -245,26 +524,104 @@ func updateBalance(db *sql.DB, walletID, referenceID string, amount, total, tran
 		transaction.ReferenceID,
 		transaction.CreateTime,
 	)
+	stmtSpan.end(err)
 
 	if err != nil {
-		tx.Rollback()
-		log.Println("Error updateBalance ExecContext: " + err.Error())
+		logError(ctx, "updateBalance ExecContext", err)
 		return
 	}
 
-	err = tx.Commit()
+	if transaction.Debit() && transactionType != expiryType {
+		_, err = useBalanceBuckets(ctx, tx, walletID, amount)
+		if err != nil {
+			return
+		}
+	}
+
+	entry, err := applyPocketTransaction(ctx, tx, pocketID, transaction)
 	if err != nil {
-		log.Println("Error updateBalance Commit: " + err.Error())
 		return
 	}
 
+	err = applyGoalRules(ctx, tx, walletID, entry)
+	if err != nil {
+		return
+	}
+
+	// transaction types are named like their events
+	event, err = recordWalletEvent(ctx, tx, walletID, transaction.TypeName(), &transaction)
 	return
 }
 
-func displayStudents(db *sql.DB) {
-	row, err := db.Query("SELECT * FROM student ORDER BY name")
+func getTransactionsByWalletID(ctx context.Context, db *sql.DB, walletID string, limit int) (transactions []WalletTransaction, err error) {
+	defer observeQuery("getTransactionsByWalletID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getTransactionsByWalletID")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx,
+		getTransactionsByWalletIDSQL,
+		walletID,
+		limit,
+	)
 	if err != nil {
-		log.Fatal(err)
+		logError(ctx, "getTransactionsByWalletID QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction WalletTransaction
+		err = rows.Scan(
+			&transaction.ID,
+			&transaction.WalletID,
+			&transaction.Type,
+			&transaction.Amount,
+			&transaction.ReferenceID,
+			&transaction.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "getTransactionsByWalletID Scan", err)
+			return
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		logError(ctx, "getTransactionsByWalletID Rows", err)
+	}
+
+	return
+}
+
+func countActive(ctx context.Context, db *sql.DB) (sessions, wallets int, err error) {
+	defer observeQuery("countActive", time.Now())
+	ctx, span := startQuerySpan(ctx, "countActive")
+	defer func() {
+		span.end(err)
+	}()
+
+	row := db.QueryRowContext(ctx,
+		countActiveSQL,
+		statusActive,
+	)
+
+	err = row.Scan(&sessions, &wallets)
+	if err != nil {
+		logError(ctx, "countActive Scan", err)
+	}
+
+	return
+}
+
+func displayStudents(ctx context.Context, db *sql.DB) {
+	row, err := db.QueryContext(ctx, "SELECT * FROM student ORDER BY name")
+	if err != nil {
+		logError(ctx, "displayStudents QueryContext", err)
+		return
 	}
 	defer row.Close()
 	for row.Next() { // Iterate and fetch the records from result cursor
@@ -273,6 +630,6 @@ func displayStudents(db *sql.DB) {
 		var name string
 		var program string
 		row.Scan(&id, &code, &name, &program)
-		log.Println("Student: ", code, " ", name, " ", program)
+		logInfo(ctx, "Student", "code", code, "name", name, "program", program)
 	}
 }
@@ -0,0 +1,1912 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// A dispute contests a withdrawal or a fee of a wallet. The customer opens it with a reason
+// and evidence, admins move it through reviewing and needs_info until it is won by the
+// customer, who keeps a final credit of the amount, or lost, when a provisional credit
+// placed in the meantime is taken back. Every state has a due time: a dispute waiting for an
+// admin past it is flagged once per state, one waiting for the customer past it is lost.
+// transaction_id is unique, so a transaction is disputed once, and the status changes with
+// its money in one tx, so a dispute is credited once however many admins try.
+
+const (
+	disputeStatusOpen      = "open"
+	disputeStatusReviewing = "reviewing"
+	disputeStatusNeedsInfo = "needs_info"
+	disputeStatusWon       = "won"
+	disputeStatusLost      = "lost"
+	disputeStatusWithdrawn = "withdrawn"
+
+	disputeAuthorCustomer = "customer"
+	disputeAuthorAdmin    = "admin"
+	disputeAuthorSystem   = "system"
+
+	disputeReferencePrefix = "dispute:"
+
+	// disputeReviewSLA -> an admin picks up an open dispute within this
+	disputeReviewSLA = 2 * 24 * time.Hour
+	// disputeResolveSLA -> a dispute is won or lost within this of being opened
+	disputeResolveSLA = 30 * 24 * time.Hour
+	// disputeAnswerSLA -> the customer answers a request for information within this
+	disputeAnswerSLA = 7 * 24 * time.Hour
+	// maxDisputeAge -> older transactions can no longer be disputed
+	maxDisputeAge = 120 * 24 * time.Hour
+
+	maxDisputeTextLen = 2000
+
+	// disputeSLAPoll -> how often disputes past their due time are looked at
+	disputeSLAPoll = time.Minute
+)
+
+// disputeReasons -> why a customer contests a transaction
+var disputeReasons = map[string]bool{
+	"unauthorized":     true,
+	"not_received":     true,
+	"duplicate":        true,
+	"incorrect_amount": true,
+	"other":            true,
+}
+
+// Dispute -> Amount of TransactionID contested by UserID. CreditTransactionID is the deposit
+// the customer keeps once it is won, the provisional one when it was placed before.
+// ReversalTransactionID took the provisional credit back once it was lost or withdrawn,
+// Uncollected is what the main pocket could not cover of it.
+type Dispute struct {
+	ID                       string    `db:"id"`
+	WalletID                 string    `db:"wallet_id"`
+	UserID                   string    `db:"user_id"`
+	TransactionID            string    `db:"transaction_id"`
+	Amount                   int       `db:"amount"`
+	Reason                   string    `db:"reason"`
+	Evidence                 string    `db:"evidence"`
+	Status                   string    `db:"status"`
+	DueTime                  time.Time `db:"due_time"`
+	BreachTime               time.Time `db:"breach_time"`
+	ProvisionalTransactionID string    `db:"provisional_transaction_id"`
+	CreditTransactionID      string    `db:"credit_transaction_id"`
+	ReversalTransactionID    string    `db:"reversal_transaction_id"`
+	Uncollected              int       `db:"uncollected"`
+	CreateTime               time.Time `db:"create_time"`
+	UpdateTime               time.Time `db:"update_time"`
+	ResolveTime              time.Time `db:"resolve_time"`
+
+	// Notes -> the history of the dispute when it was read, not stored
+	Notes []DisputeNote
+}
+
+// DisputeNote -> a note on a dispute, Status is set when the dispute moved to it and
+// TransactionID when money moved. Internal notes are only shown to admins.
+type DisputeNote struct {
+	ID            string    `db:"id"`
+	DisputeID     string    `db:"dispute_id"`
+	Author        string    `db:"author"`
+	AuthorID      string    `db:"author_id"`
+	Status        string    `db:"status"`
+	Body          string    `db:"body"`
+	Internal      bool      `db:"internal"`
+	TransactionID string    `db:"transaction_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// Resolved -> the dispute was won, lost or withdrawn
+func (d Dispute) Resolved() bool {
+	return d.Status == disputeStatusWon || d.Status == disputeStatusLost || d.Status == disputeStatusWithdrawn
+}
+
+// Overdue -> the dispute is still waiting past its due time
+func (d Dispute) Overdue(now time.Time) bool {
+	return !d.Resolved() && !now.Before(d.DueTime)
+}
+
+// disputeDueTime -> when a dispute entering status is due
+func disputeDueTime(status string, createTime, now time.Time) time.Time {
+	switch status {
+	case disputeStatusOpen:
+		return now.Add(disputeReviewSLA)
+	case disputeStatusNeedsInfo:
+		return now.Add(disputeAnswerSLA)
+	default:
+		return createTime.Add(disputeResolveSLA)
+	}
+}
+
+const (
+	createDisputeTable = `
+		CREATE TABLE IF NOT EXISTS dispute (
+			id TEXT NOT NULL PRIMARY KEY,
+			wallet_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			transaction_id TEXT NOT NULL UNIQUE,
+			amount INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			evidence TEXT NOT NULL,
+			status TEXT NOT NULL,
+			due_time DATETIME NOT NULL,
+			breach_time DATETIME,
+			provisional_transaction_id TEXT NOT NULL,
+			credit_transaction_id TEXT NOT NULL,
+			reversal_transaction_id TEXT NOT NULL,
+			uncollected INTEGER NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL,
+			resolve_time DATETIME
+		);
+	`
+
+	createDisputeNoteTable = `
+		CREATE TABLE IF NOT EXISTS dispute_note (
+			id TEXT NOT NULL PRIMARY KEY,
+			dispute_id TEXT NOT NULL,
+			author TEXT NOT NULL,
+			author_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			body TEXT NOT NULL,
+			internal INTEGER NOT NULL,
+			transaction_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertDisputeSQL = `
+		INSERT INTO dispute
+			(id, wallet_id, user_id, transaction_id, amount, reason, evidence, status, due_time, breach_time,
+			provisional_transaction_id, credit_transaction_id, reversal_transaction_id, uncollected,
+			create_time, update_time, resolve_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,NULL,'','','',0,?,?,NULL)
+		;
+	`
+
+	insertDisputeNoteSQL = `
+		INSERT INTO dispute_note
+			(id, dispute_id, author, author_id, status, body, internal, transaction_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	selectDisputeSQL = `
+		SELECT
+			id,
+			wallet_id,
+			user_id,
+			transaction_id,
+			amount,
+			reason,
+			evidence,
+			status,
+			due_time,
+			breach_time,
+			provisional_transaction_id,
+			credit_transaction_id,
+			reversal_transaction_id,
+			uncollected,
+			create_time,
+			update_time,
+			resolve_time
+		FROM
+			dispute
+	`
+
+	getDisputeSQL = selectDisputeSQL + `
+		WHERE
+			id = $1
+	`
+
+	getWalletDisputesSQL = selectDisputeSQL + `
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $2
+	`
+
+	// getDisputesSQL -> the latest disputes, of one status when $1 is set and only the ones
+	// waiting past their due time at $3 when $2 is set
+	getDisputesSQL = selectDisputeSQL + `
+		WHERE
+			($1 = '' OR status = $1) AND
+			(NOT $2 OR (
+				status IN ('open', 'reviewing', 'needs_info') AND
+				julianday(due_time) <= julianday($3)
+			))
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $4
+	`
+
+	// getDisputeNotesSQL -> the notes of a dispute, internal ones only when $2 is set
+	getDisputeNotesSQL = `
+		SELECT
+			id,
+			dispute_id,
+			author,
+			author_id,
+			status,
+			body,
+			internal,
+			transaction_id,
+			create_time
+		FROM
+			dispute_note
+		WHERE
+			dispute_id = $1 AND
+			(internal = 0 OR $2)
+		ORDER BY
+			create_time,
+			rowid
+	`
+
+	// getDueDisputesSQL -> disputes waiting for the customer past their due time, and the
+	// ones waiting for an admin that were not flagged yet
+	getDueDisputesSQL = `
+		SELECT
+			id,
+			status
+		FROM
+			dispute
+		WHERE
+			(status = 'needs_info' OR (status IN ('open', 'reviewing') AND breach_time IS NULL)) AND
+			julianday(due_time) <= julianday($1)
+		ORDER BY
+			due_time
+	`
+
+	getDisputeStatusSQL = `
+		SELECT
+			status
+		FROM
+			dispute
+		WHERE
+			id = $1
+	`
+
+	countDisputeReversalsSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			transaction_reversal
+		WHERE
+			transaction_id = $1
+	`
+
+	// countDisputeLegsSQL -> transactions of id written by a dispute, taking its credit back or
+	// charging it to a merchant
+	countDisputeLegsSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			wallet_transaction
+		WHERE
+			id = $1 AND
+			reference_id LIKE $2 || '%'
+	`
+
+	// countCreditedDisputesSQL -> disputes of a transaction that are or may still be credited
+	countCreditedDisputesSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			dispute
+		WHERE
+			transaction_id = $1 AND
+			status NOT IN ('lost', 'withdrawn')
+	`
+
+	// moveDisputeSQL -> move a dispute that is not resolved to another status that does not
+	// resolve it
+	moveDisputeSQL = `
+		UPDATE
+			dispute
+		SET
+			status = $1,
+			due_time = $2,
+			breach_time = NULL,
+			update_time = $3
+		WHERE
+			id = $4 AND
+			status IN ('open', 'reviewing', 'needs_info') AND
+			status <> $1
+	`
+
+	resolveDisputeSQL = `
+		UPDATE
+			dispute
+		SET
+			status = $1,
+			update_time = $2,
+			resolve_time = $2
+		WHERE
+			id = $3 AND
+			status IN ('open', 'reviewing', 'needs_info')
+	`
+
+	setDisputeTransactionsSQL = `
+		UPDATE
+			dispute
+		SET
+			credit_transaction_id = $1,
+			reversal_transaction_id = $2,
+			uncollected = $3
+		WHERE
+			id = $4
+	`
+
+	placeProvisionalCreditSQL = `
+		UPDATE
+			dispute
+		SET
+			provisional_transaction_id = $1,
+			update_time = $2
+		WHERE
+			id = $3 AND
+			provisional_transaction_id = '' AND
+			status IN ('open', 'reviewing', 'needs_info')
+	`
+
+	breachDisputeSQL = `
+		UPDATE
+			dispute
+		SET
+			breach_time = $1
+		WHERE
+			id = $2 AND
+			status = $3 AND
+			breach_time IS NULL AND
+			julianday(due_time) <= julianday($1)
+	`
+)
+
+func scanDispute(scanner interface{ Scan(...interface{}) error }) (dispute Dispute, err error) {
+	var breachTime, resolveTime sql.NullTime
+	err = scanner.Scan(
+		&dispute.ID,
+		&dispute.WalletID,
+		&dispute.UserID,
+		&dispute.TransactionID,
+		&dispute.Amount,
+		&dispute.Reason,
+		&dispute.Evidence,
+		&dispute.Status,
+		&dispute.DueTime,
+		&breachTime,
+		&dispute.ProvisionalTransactionID,
+		&dispute.CreditTransactionID,
+		&dispute.ReversalTransactionID,
+		&dispute.Uncollected,
+		&dispute.CreateTime,
+		&dispute.UpdateTime,
+		&resolveTime,
+	)
+	dispute.BreachTime = breachTime.Time
+	dispute.ResolveTime = resolveTime.Time
+
+	return
+}
+
+func queryDisputeNotes(ctx context.Context, q querier, disputeID string, internal bool) (notes []DisputeNote, err error) {
+	rows, err := q.QueryContext(ctx, getDisputeNotesSQL, disputeID, internal)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note DisputeNote
+		err = rows.Scan(
+			&note.ID,
+			&note.DisputeID,
+			&note.Author,
+			&note.AuthorID,
+			&note.Status,
+			&note.Body,
+			&note.Internal,
+			&note.TransactionID,
+			&note.CreateTime,
+		)
+		if err != nil {
+			return
+		}
+
+		notes = append(notes, note)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// queryDispute -> the dispute with its notes, internal ones only when internal is set, read
+// in tx when it is set
+func queryDispute(ctx context.Context, db *sql.DB, tx *sql.Tx, disputeID string, internal bool) (dispute Dispute, err error) {
+	if tx != nil {
+		dispute, err = scanDispute(tx.QueryRowContext(ctx, getDisputeSQL, disputeID))
+		if err != nil {
+			return
+		}
+
+		dispute.Notes, err = queryDisputeNotes(ctx, tx, disputeID, internal)
+		return
+	}
+
+	dispute, err = scanDispute(db.QueryRowContext(ctx, getDisputeSQL, disputeID))
+	if err != nil {
+		return
+	}
+
+	dispute.Notes, err = queryDisputeNotes(ctx, db, disputeID, internal)
+	return
+}
+
+func insertDisputeNote(ctx context.Context, tx *sql.Tx, note DisputeNote) (err error) {
+	_, err = tx.ExecContext(ctx,
+		insertDisputeNoteSQL,
+		note.ID,
+		note.DisputeID,
+		note.Author,
+		note.AuthorID,
+		note.Status,
+		note.Body,
+		note.Internal,
+		note.TransactionID,
+		note.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertDisputeNote ExecContext", err)
+	}
+
+	return
+}
+
+func getDispute(ctx context.Context, db *sql.DB, disputeID string, internal bool) (dispute Dispute, err error) {
+	defer observeQuery("getDispute", time.Now())
+	ctx, span := startQuerySpan(ctx, "getDispute")
+	defer func() {
+		span.end(err)
+	}()
+
+	dispute, err = queryDispute(ctx, db, nil, disputeID, internal)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getDispute Scan", err)
+	}
+
+	return
+}
+
+func queryDisputes(ctx context.Context, db *sql.DB, name, query string, args ...interface{}) (disputes []Dispute, err error) {
+	defer observeQuery(name, time.Now())
+	ctx, span := startQuerySpan(ctx, name)
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logError(ctx, name+" QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dispute Dispute
+		dispute, err = scanDispute(rows)
+		if err != nil {
+			logError(ctx, name+" Scan", err)
+			return
+		}
+
+		disputes = append(disputes, dispute)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// dueDispute -> the id and status of a dispute past its due time
+type dueDispute struct {
+	ID     string
+	Status string
+}
+
+func getDueDisputes(ctx context.Context, db *sql.DB, now time.Time) (disputes []dueDispute, err error) {
+	defer observeQuery("getDueDisputes", time.Now())
+	ctx, span := startQuerySpan(ctx, "getDueDisputes")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getDueDisputesSQL, now)
+	if err != nil {
+		logError(ctx, "getDueDisputes QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dispute dueDispute
+		err = rows.Scan(&dispute.ID, &dispute.Status)
+		if err != nil {
+			logError(ctx, "getDueDisputes Scan", err)
+			return
+		}
+
+		disputes = append(disputes, dispute)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// disputeLeg -> whether transactionID was written by a dispute, read in tx
+func disputeLeg(ctx context.Context, tx *sql.Tx, transactionID string) (leg bool, err error) {
+	var legs int
+	err = tx.QueryRowContext(ctx, countDisputeLegsSQL, transactionID, disputeReferencePrefix).Scan(&legs)
+	if err != nil {
+		logError(ctx, "disputeLeg Scan", err)
+		return
+	}
+	leg = legs > 0
+
+	return
+}
+
+// insertDispute -> record an open dispute with its first note in one tx, errAlreadyReversed
+// when the transaction was given back, errPaymentRefunded when it paid a payment the merchant
+// refunded, errEscrowNotDisputable when it funded an escrow, errTransferNotDisputable when it
+// sent a transfer, errDisputeLegNotDisputable when a dispute wrote it and errAlreadyDisputed
+// when it was disputed before
+func insertDispute(ctx context.Context, db *sql.DB, dispute *Dispute, note DisputeNote) (err error) {
+	defer observeQuery("insertDispute", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertDispute")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertDispute BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var reversals int
+	err = tx.QueryRowContext(ctx, countDisputeReversalsSQL, dispute.TransactionID).Scan(&reversals)
+	if err != nil {
+		logError(ctx, "insertDispute reversals", err)
+		return
+	}
+	if reversals > 0 {
+		err = errAlreadyReversed
+		return
+	}
+
+	leg, err := escrowLeg(ctx, tx, dispute.TransactionID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errEscrowNotDisputable
+		return
+	}
+
+	leg, err = transferLeg(ctx, tx, dispute.TransactionID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errTransferNotDisputable
+		return
+	}
+
+	leg, err = disputeLeg(ctx, tx, dispute.TransactionID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errDisputeLegNotDisputable
+		return
+	}
+
+	refunded, _, err := paymentByTransaction(ctx, tx, dispute.TransactionID)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = nil
+	if refunded > 0 {
+		err = errPaymentRefunded
+		return
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertDisputeSQL,
+		dispute.ID,
+		dispute.WalletID,
+		dispute.UserID,
+		dispute.TransactionID,
+		dispute.Amount,
+		dispute.Reason,
+		dispute.Evidence,
+		dispute.Status,
+		dispute.DueTime,
+		dispute.CreateTime,
+		dispute.UpdateTime,
+	)
+	if isUniqueViolation(err) {
+		err = errAlreadyDisputed
+		return
+	}
+	if err != nil {
+		logError(ctx, "insertDispute ExecContext", err)
+		return
+	}
+
+	err = insertDisputeNote(ctx, tx, note)
+	if err != nil {
+		return
+	}
+
+	*dispute, err = queryDispute(ctx, db, tx, dispute.ID, false)
+	if err != nil {
+		logError(ctx, "insertDispute Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertDispute Commit", err)
+	}
+
+	return
+}
+
+// disputeChangeError -> why a dispute that was not changed in tx could not be,
+// errDisputeResolved once it was won, lost or withdrawn
+func disputeChangeError(ctx context.Context, tx *sql.Tx, disputeID string) error {
+	var status string
+	err := tx.QueryRowContext(ctx, getDisputeStatusSQL, disputeID).Scan(&status)
+	if err != nil {
+		logError(ctx, "disputeChangeError Scan", err)
+		return err
+	}
+
+	if (Dispute{Status: status}).Resolved() {
+		return errDisputeResolved
+	}
+
+	return errDisputeInStatus
+}
+
+// moveDispute -> move a dispute that is not resolved to note.Status, which does not resolve
+// it, with the note in one tx
+func moveDispute(ctx context.Context, db *sql.DB, dispute *Dispute, note DisputeNote, internal bool) (err error) {
+	defer observeQuery("moveDispute", time.Now())
+	ctx, span := startQuerySpan(ctx, "moveDispute")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "moveDispute BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	dueTime := disputeDueTime(note.Status, dispute.CreateTime, note.CreateTime)
+	result, err := tx.ExecContext(ctx, moveDisputeSQL, note.Status, dueTime, note.CreateTime, dispute.ID)
+	if err != nil {
+		logError(ctx, "moveDispute ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "moveDispute RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = disputeChangeError(ctx, tx, dispute.ID)
+		return
+	}
+
+	err = insertDisputeNote(ctx, tx, note)
+	if err != nil {
+		return
+	}
+
+	*dispute, err = queryDispute(ctx, db, tx, dispute.ID, internal)
+	if err != nil {
+		logError(ctx, "moveDispute Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "moveDispute Commit", err)
+	}
+
+	return
+}
+
+// addDisputeNote -> add a note to a dispute that is not resolved, a note of the customer
+// while it needs information moves it back to reviewing in the same tx
+func addDisputeNote(ctx context.Context, db *sql.DB, dispute *Dispute, note DisputeNote, internal bool) (err error) {
+	defer observeQuery("addDisputeNote", time.Now())
+	ctx, span := startQuerySpan(ctx, "addDisputeNote")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "addDisputeNote BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := scanDispute(tx.QueryRowContext(ctx, getDisputeSQL, dispute.ID))
+	if err != nil {
+		logError(ctx, "addDisputeNote Scan", err)
+		return
+	}
+	if current.Resolved() {
+		err = errDisputeResolved
+		return
+	}
+
+	if note.Author == disputeAuthorCustomer && current.Status == disputeStatusNeedsInfo {
+		dueTime := disputeDueTime(disputeStatusReviewing, current.CreateTime, note.CreateTime)
+		_, err = tx.ExecContext(ctx, moveDisputeSQL, disputeStatusReviewing, dueTime, note.CreateTime, dispute.ID)
+		if err != nil {
+			logError(ctx, "addDisputeNote move", err)
+			return
+		}
+		note.Status = disputeStatusReviewing
+	}
+
+	err = insertDisputeNote(ctx, tx, note)
+	if err != nil {
+		return
+	}
+
+	*dispute, err = queryDispute(ctx, db, tx, dispute.ID, internal)
+	if err != nil {
+		logError(ctx, "addDisputeNote Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "addDisputeNote Commit", err)
+	}
+
+	return
+}
+
+// placeProvisionalCredit -> deposit the amount of a dispute that is not resolved to the main
+// pocket of its wallet from the disputes system account until it is decided, once
+func placeProvisionalCredit(ctx context.Context, db *sql.DB, dispute *Dispute, note DisputeNote) (err error) {
+	defer observeQuery("placeProvisionalCredit", time.Now())
+	ctx, span := startQuerySpan(ctx, "placeProvisionalCredit")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "placeProvisionalCredit BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	deposit, event, err := creditDispute(ctx, tx, *dispute)
+	if err != nil {
+		return
+	}
+
+	result, err := tx.ExecContext(ctx, placeProvisionalCreditSQL, deposit.ID, note.CreateTime, dispute.ID)
+	if err != nil {
+		logError(ctx, "placeProvisionalCredit ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "placeProvisionalCredit RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = disputeChangeError(ctx, tx, dispute.ID)
+		if err == errDisputeInStatus {
+			err = errProvisionalCreditPlaced
+		}
+		return
+	}
+
+	note.TransactionID = deposit.ID
+	err = insertDisputeNote(ctx, tx, note)
+	if err != nil {
+		return
+	}
+
+	*dispute, err = queryDispute(ctx, db, tx, dispute.ID, true)
+	if err != nil {
+		logError(ctx, "placeProvisionalCredit Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "placeProvisionalCredit Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// creditDispute -> deposit the amount of the dispute to the main pocket of its wallet from
+// the disputes system account in tx
+func creditDispute(ctx context.Context, tx *sql.Tx, dispute Dispute) (deposit WalletTransaction, event walletEvent, err error) {
+	reference := disputeReferencePrefix + dispute.ID
+	deposit, event, err = applyBalanceChange(ctx, tx, dispute.WalletID, "", reference, dispute.Amount, depositType)
+	if err != nil {
+		return
+	}
+
+	err = postSystemEntry(ctx, tx, &SystemEntry{
+		AccountID:     systemAccountDisputes,
+		Amount:        -dispute.Amount,
+		WalletID:      dispute.WalletID,
+		TransactionID: deposit.ID,
+		ReferenceID:   reference,
+		CreateTime:    deposit.CreateTime,
+	})
+
+	return
+}
+
+// takeBackProvisionalCredit -> withdraw the provisional credit of the dispute back to the
+// disputes system account in tx, as much of it as the main pocket holds. taken is zero and
+// no transaction is written when the main pocket is empty.
+func takeBackProvisionalCredit(ctx context.Context, tx *sql.Tx, dispute Dispute) (withdrawal WalletTransaction, event walletEvent, taken int, err error) {
+	return collectDispute(ctx, tx, dispute, dispute.WalletID)
+}
+
+// chargeMerchant -> withdraw the amount of a won dispute of a payment from the settlement
+// wallet of its merchant to the disputes system account in tx, as much of it as the main
+// pocket holds. charged is false and nothing is written when the dispute paid no payment.
+func chargeMerchant(ctx context.Context, tx *sql.Tx, dispute Dispute) (withdrawal WalletTransaction, event walletEvent, taken int, charged bool, err error) {
+	_, settlementWalletID, err := paymentByTransaction(ctx, tx, dispute.TransactionID)
+	if err == sql.ErrNoRows {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	charged = true
+
+	withdrawal, event, taken, err = collectDispute(ctx, tx, dispute, settlementWalletID)
+	return
+}
+
+// collectDispute -> withdraw the amount of the dispute from the main pocket of walletID to
+// the disputes system account in tx, as much of it as the main pocket holds. taken is zero
+// and no transaction is written when the main pocket is empty.
+func collectDispute(ctx context.Context, tx *sql.Tx, dispute Dispute, walletID string) (withdrawal WalletTransaction, event walletEvent, taken int, err error) {
+	var pocketID string
+	var available int
+	err = tx.QueryRowContext(ctx, getMainPocketIDSQL, walletID).Scan(&pocketID)
+	if err != nil {
+		logError(ctx, "collectDispute main pocket", err)
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, getPocketBalanceSQL, pocketID).Scan(&available)
+	if err != nil {
+		logError(ctx, "collectDispute pocket balance", err)
+		return
+	}
+
+	taken = min(dispute.Amount, max(available, 0))
+	if taken == 0 {
+		return
+	}
+
+	reference := disputeReferencePrefix + dispute.ID
+	withdrawal, event, err = applyBalanceChange(ctx, tx, walletID, pocketID, reference, taken, withdrawalType)
+	if err != nil {
+		return
+	}
+
+	err = postSystemEntry(ctx, tx, &SystemEntry{
+		AccountID:     systemAccountDisputes,
+		Amount:        taken,
+		WalletID:      walletID,
+		TransactionID: withdrawal.ID,
+		ReferenceID:   reference,
+		CreateTime:    withdrawal.CreateTime,
+	})
+
+	return
+}
+
+// resolveDispute -> win, lose or withdraw a dispute that is not resolved by note.Status with
+// its money in one tx. Winning keeps the provisional credit or credits the amount now, and
+// charges it to the merchant when the transaction paid a payment, with an internal note.
+// Losing or withdrawing takes the provisional credit back.
+func resolveDispute(ctx context.Context, db *sql.DB, dispute *Dispute, note DisputeNote, internal bool) (err error) {
+	defer observeQuery("resolveDispute", time.Now())
+	ctx, span := startQuerySpan(ctx, "resolveDispute")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "resolveDispute BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, resolveDisputeSQL, note.Status, note.CreateTime, dispute.ID)
+	if err != nil {
+		logError(ctx, "resolveDispute claim", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "resolveDispute RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errDisputeResolved
+		return
+	}
+
+	current, err := scanDispute(tx.QueryRowContext(ctx, getDisputeSQL, dispute.ID))
+	if err != nil {
+		logError(ctx, "resolveDispute Scan", err)
+		return
+	}
+
+	var events []walletEvent
+	switch {
+	case note.Status == disputeStatusWon && current.ProvisionalTransactionID != "":
+		current.CreditTransactionID = current.ProvisionalTransactionID
+	case note.Status == disputeStatusWon:
+		deposit, event, creditErr := creditDispute(ctx, tx, current)
+		if creditErr != nil {
+			err = creditErr
+			return
+		}
+		current.CreditTransactionID = deposit.ID
+		note.TransactionID = deposit.ID
+		events = append(events, event)
+	case current.ProvisionalTransactionID != "":
+		withdrawal, event, taken, takeErr := takeBackProvisionalCredit(ctx, tx, current)
+		if takeErr != nil {
+			err = takeErr
+			return
+		}
+		current.Uncollected = current.Amount - taken
+		if taken > 0 {
+			current.ReversalTransactionID = withdrawal.ID
+			note.TransactionID = withdrawal.ID
+			events = append(events, event)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		setDisputeTransactionsSQL,
+		current.CreditTransactionID,
+		current.ReversalTransactionID,
+		current.Uncollected,
+		dispute.ID,
+	)
+	if err != nil {
+		logError(ctx, "resolveDispute set transactions", err)
+		return
+	}
+
+	err = insertDisputeNote(ctx, tx, note)
+	if err != nil {
+		return
+	}
+
+	if note.Status == disputeStatusWon {
+		withdrawal, event, taken, charged, chargeErr := chargeMerchant(ctx, tx, current)
+		if chargeErr != nil {
+			err = chargeErr
+			return
+		}
+		if charged {
+			chargeNote := DisputeNote{
+				ID:         generateUUID(),
+				DisputeID:  dispute.ID,
+				Author:     disputeAuthorSystem,
+				Body:       "Charged " + strconv.Itoa(taken) + " of " + strconv.Itoa(current.Amount) + " to the merchant",
+				Internal:   true,
+				CreateTime: note.CreateTime,
+			}
+			if taken > 0 {
+				chargeNote.TransactionID = withdrawal.ID
+				events = append(events, event)
+			}
+			err = insertDisputeNote(ctx, tx, chargeNote)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	*dispute, err = queryDispute(ctx, db, tx, dispute.ID, internal)
+	if err != nil {
+		logError(ctx, "resolveDispute Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "resolveDispute Commit", err)
+		return
+	}
+
+	for _, event := range events {
+		publishWalletEvent(ctx, event)
+	}
+
+	return
+}
+
+// breachDispute -> flag a dispute still in status past its due time with a system note,
+// breached is false when it was flagged or moved on before
+func breachDispute(ctx context.Context, db *sql.DB, disputeID, status string, now time.Time) (breached bool, err error) {
+	defer observeQuery("breachDispute", time.Now())
+	ctx, span := startQuerySpan(ctx, "breachDispute")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "breachDispute BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, breachDisputeSQL, now, disputeID, status)
+	if err != nil {
+		logError(ctx, "breachDispute ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "breachDispute RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		return
+	}
+
+	err = insertDisputeNote(ctx, tx, DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  disputeID,
+		Author:     disputeAuthorSystem,
+		Body:       "Past its due time while " + status,
+		Internal:   true,
+		CreateTime: now,
+	})
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "breachDispute Commit", err)
+		return
+	}
+
+	return true, nil
+}
+
+// disputeFromRequest -> the dispute userID opens by req, or the fields that are wrong. The
+// wallet, the amount when it is not given and the due time are set once the transaction is
+// read.
+func disputeFromRequest(userID string, req RequestDispute, now time.Time) (dispute Dispute, errs validationErrors) {
+	errs = validationErrors{}
+
+	dispute = Dispute{
+		ID:            generateUUID(),
+		UserID:        userID,
+		TransactionID: strings.TrimSpace(req.TransactionID),
+		Amount:        req.Amount,
+		Reason:        req.Reason,
+		Evidence:      strings.TrimSpace(req.Evidence),
+		Status:        disputeStatusOpen,
+		DueTime:       disputeDueTime(disputeStatusOpen, now, now),
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+
+	if !disputeReasons[dispute.Reason] {
+		errs.add("reason", "Must be unauthorized, not_received, duplicate, incorrect_amount or other.")
+	}
+
+	if len(dispute.Evidence) > maxDisputeTextLen {
+		errs.add("evidence", "Must be at most 2000 characters.")
+	}
+
+	return
+}
+
+// disputeNoteFromRequest -> the trimmed text of a note, or why it is wrong
+func disputeNoteFromRequest(text string, required bool) (body string, errs validationErrors) {
+	errs = validationErrors{}
+
+	body = strings.TrimSpace(text)
+	switch {
+	case body == "" && required:
+		errs.add("note", msgRequired)
+	case len(body) > maxDisputeTextLen:
+		errs.add("note", "Must be at most 2000 characters.")
+	}
+
+	return
+}
+
+// OpenDispute -> contest a withdrawal or a fee of the wallet of the customer, for all of it
+// when no amount is given
+func OpenDispute(ctx context.Context, dispute Dispute) (opened Dispute, err error) {
+	ctx = withOperation(ctx, "open_dispute")
+	ctx, span := startSpan(ctx, "OpenDispute", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, dispute.UserID)
+	if err != nil {
+		return
+	}
+
+	transaction, err := getTransactionByID(ctx, database, dispute.TransactionID)
+	if err == sql.ErrNoRows || transaction.WalletID != wallet.ID {
+		err = errTransactionNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	if transaction.Type != withdrawalType && transaction.Type != feeType {
+		err = errNotDisputable
+		return
+	}
+
+	if dispute.CreateTime.Sub(transaction.CreateTime) > maxDisputeAge {
+		err = errDisputeTooOld
+		return
+	}
+
+	if dispute.Amount == 0 {
+		dispute.Amount = transaction.Amount
+	}
+	if dispute.Amount > transaction.Amount {
+		err = errDisputeTooLarge
+		return
+	}
+
+	dispute.WalletID = wallet.ID
+	err = insertDispute(ctx, database, &dispute, DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  dispute.ID,
+		Author:     disputeAuthorCustomer,
+		AuthorID:   dispute.UserID,
+		Status:     disputeStatusOpen,
+		CreateTime: dispute.CreateTime,
+	})
+	if err != nil {
+		return
+	}
+
+	return dispute, nil
+}
+
+// ListDisputes -> the latest disputes of the wallet of userID
+func ListDisputes(ctx context.Context, userID string, limit int) (disputes []Dispute, err error) {
+	ctx = withOperation(ctx, "list_disputes")
+	ctx, span := startSpan(ctx, "ListDisputes", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	disputes, err = queryDisputes(ctx, database, "getWalletDisputes", getWalletDisputesSQL, wallet.ID, limit)
+	return
+}
+
+// customerDispute -> a dispute of the wallet of userID without its internal notes,
+// errDisputeNotFound for everyone else
+func customerDispute(ctx context.Context, userID, disputeID string) (dispute Dispute, err error) {
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	dispute, err = getDispute(ctx, database, disputeID, false)
+	if err == sql.ErrNoRows || dispute.WalletID != wallet.ID {
+		err = errDisputeNotFound
+	}
+
+	return
+}
+
+// ViewDispute -> a dispute of the wallet of userID with its notes
+func ViewDispute(ctx context.Context, userID, disputeID string) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "view_dispute")
+	ctx, span := startSpan(ctx, "ViewDispute", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	dispute, err = customerDispute(ctx, userID, disputeID)
+	return
+}
+
+// AddDisputeEvidence -> the customer adds a note to their dispute, which answers a request
+// for information
+func AddDisputeEvidence(ctx context.Context, userID, disputeID, body string) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "add_dispute_evidence")
+	ctx, span := startSpan(ctx, "AddDisputeEvidence", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	dispute, err = customerDispute(ctx, userID, disputeID)
+	if err != nil {
+		return
+	}
+
+	err = addDisputeNote(ctx, database, &dispute, DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  dispute.ID,
+		Author:     disputeAuthorCustomer,
+		AuthorID:   userID,
+		Body:       body,
+		CreateTime: time.Now(),
+	}, false)
+
+	return
+}
+
+// WithdrawDispute -> the customer drops their dispute, a provisional credit is taken back
+func WithdrawDispute(ctx context.Context, userID, disputeID, body string) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "withdraw_dispute")
+	ctx, span := startSpan(ctx, "WithdrawDispute", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	dispute, err = customerDispute(ctx, userID, disputeID)
+	if err != nil {
+		return
+	}
+
+	if dispute.Resolved() {
+		err = errDisputeResolved
+		return
+	}
+
+	err = resolveDispute(ctx, database, &dispute, DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  dispute.ID,
+		Author:     disputeAuthorCustomer,
+		AuthorID:   userID,
+		Status:     disputeStatusWithdrawn,
+		Body:       body,
+		CreateTime: time.Now(),
+	}, false)
+	if err != nil && err != errDisputeResolved {
+		logError(ctx, "WithdrawDispute resolveDispute", err)
+	}
+
+	return
+}
+
+// AdminDisputes -> the latest disputes, of one status when status is set and only the ones
+// waiting past their due time when overdue is set
+func AdminDisputes(ctx context.Context, status string, overdue bool, limit int) (disputes []Dispute, err error) {
+	ctx = withOperation(ctx, "admin_disputes")
+	ctx, span := startSpan(ctx, "AdminDisputes", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	disputes, err = queryDisputes(ctx, database, "getDisputes", getDisputesSQL, status, overdue, time.Now(), limit)
+	return
+}
+
+// adminDispute -> any dispute with all its notes
+func adminDispute(ctx context.Context, disputeID string) (dispute Dispute, err error) {
+	dispute, err = getDispute(ctx, database, disputeID, true)
+	if err == sql.ErrNoRows {
+		err = errDisputeNotFound
+	}
+
+	return
+}
+
+// AdminDispute -> any dispute with all its notes
+func AdminDispute(ctx context.Context, disputeID string) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "admin_dispute")
+	ctx, span := startSpan(ctx, "AdminDispute", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	dispute, err = adminDispute(ctx, disputeID)
+	return
+}
+
+// MoveDispute -> an admin moves a dispute that is not resolved to reviewing or needs_info,
+// or resolves it as won or lost
+func MoveDispute(ctx context.Context, disputeID, status, body string) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "move_dispute")
+	ctx, span := startSpan(ctx, "MoveDispute", spanKindInternal)
+	span.setAttribute("status", status)
+	defer func() {
+		span.finish(err)
+	}()
+
+	dispute, err = adminDispute(ctx, disputeID)
+	if err != nil {
+		return
+	}
+	setWalletID(ctx, dispute.WalletID)
+
+	if dispute.Resolved() {
+		err = errDisputeResolved
+		return
+	}
+
+	note := DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  dispute.ID,
+		Author:     disputeAuthorAdmin,
+		Status:     status,
+		Body:       body,
+		CreateTime: time.Now(),
+	}
+
+	if status == disputeStatusWon || status == disputeStatusLost {
+		err = resolveDispute(ctx, database, &dispute, note, true)
+		observeWalletResult("resolve_dispute", dispute.Amount, err)
+	} else {
+		err = moveDispute(ctx, database, &dispute, note, true)
+	}
+	if err != nil && err != errDisputeResolved && err != errDisputeInStatus {
+		logError(ctx, "MoveDispute", err)
+	}
+
+	return
+}
+
+// PlaceProvisionalCredit -> an admin credits the amount of a dispute that is not resolved
+// until it is decided
+func PlaceProvisionalCredit(ctx context.Context, disputeID, body string) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "provisional_credit")
+	ctx, span := startSpan(ctx, "PlaceProvisionalCredit", spanKindInternal)
+	defer func() {
+		observeWalletResult("provisional_credit", dispute.Amount, err)
+		span.finish(err)
+	}()
+
+	dispute, err = adminDispute(ctx, disputeID)
+	if err != nil {
+		return
+	}
+	setWalletID(ctx, dispute.WalletID)
+
+	switch {
+	case dispute.Resolved():
+		err = errDisputeResolved
+		return
+	case dispute.ProvisionalTransactionID != "":
+		err = errProvisionalCreditPlaced
+		return
+	}
+
+	err = placeProvisionalCredit(ctx, database, &dispute, DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  dispute.ID,
+		Author:     disputeAuthorAdmin,
+		Body:       body,
+		CreateTime: time.Now(),
+	})
+	if err != nil && err != errDisputeResolved && err != errProvisionalCreditPlaced {
+		logError(ctx, "PlaceProvisionalCredit placeProvisionalCredit", err)
+	}
+
+	return
+}
+
+// AddAdminDisputeNote -> an admin adds a note to a dispute, internal ones are not shown to
+// the customer
+func AddAdminDisputeNote(ctx context.Context, disputeID, body string, internal bool) (dispute Dispute, err error) {
+	ctx = withOperation(ctx, "add_dispute_note")
+	ctx, span := startSpan(ctx, "AddAdminDisputeNote", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	dispute, err = adminDispute(ctx, disputeID)
+	if err != nil {
+		return
+	}
+
+	err = addDisputeNote(ctx, database, &dispute, DisputeNote{
+		ID:         generateUUID(),
+		DisputeID:  dispute.ID,
+		Author:     disputeAuthorAdmin,
+		Body:       body,
+		Internal:   internal,
+		CreateTime: time.Now(),
+	}, true)
+
+	return
+}
+
+// disputeSLA -> every poll, loses the disputes the customer did not answer in time and
+// flags the ones waiting for an admin past their due time
+type disputeSLA struct {
+	clock clock
+	poll  time.Duration
+}
+
+func newDisputeSLA(c clock) *disputeSLA {
+	return &disputeSLA{clock: c, poll: disputeSLAPoll}
+}
+
+var walletDisputeSLA = newDisputeSLA(systemClock{})
+
+// run -> sweep now and then every poll, until ctx is done
+func (s *disputeSLA) run(ctx context.Context) {
+	for {
+		s.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(s.poll):
+		}
+	}
+}
+
+// sweep -> handle the disputes past their due time by now, one at a time
+func (s *disputeSLA) sweep(ctx context.Context) {
+	ctx = withOperation(ctx, "dispute_sla")
+	now := s.clock.Now()
+
+	disputes, err := getDueDisputes(ctx, database, now)
+	if err != nil {
+		logError(ctx, "disputeSLA getDueDisputes", err)
+		return
+	}
+
+	for _, due := range disputes {
+		if due.Status != disputeStatusNeedsInfo {
+			breached, err := breachDispute(ctx, database, due.ID, due.Status, now)
+			if err != nil {
+				logError(ctx, "disputeSLA breachDispute", err)
+				continue
+			}
+			if breached {
+				logWarn(ctx, "dispute past its due time", "dispute_id", due.ID, "status", due.Status)
+			}
+			continue
+		}
+
+		dispute, err := getDispute(ctx, database, due.ID, true)
+		if err != nil {
+			continue
+		}
+
+		// answered, moved on or resolved since it was read
+		if dispute.Status != disputeStatusNeedsInfo || now.Before(dispute.DueTime) {
+			continue
+		}
+
+		err = resolveDispute(ctx, database, &dispute, DisputeNote{
+			ID:         generateUUID(),
+			DisputeID:  dispute.ID,
+			Author:     disputeAuthorSystem,
+			Status:     disputeStatusLost,
+			Body:       "No answer by " + dispute.DueTime.UTC().Format(time.RFC3339),
+			CreateTime: now,
+		}, true)
+		if err == errDisputeResolved {
+			continue
+		}
+		if err != nil {
+			logError(ctx, "disputeSLA resolveDispute", err)
+			continue
+		}
+
+		logInfo(ctx, "dispute lost without an answer", "dispute_id", dispute.ID, "wallet_id", dispute.WalletID)
+	}
+}
+
+// HandleOpenDispute -> contest a withdrawal or a fee of my wallet
+func HandleOpenDispute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestDispute
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	dispute, errs := disputeFromRequest(userIDFromContext(r.Context()), req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	dispute, err := OpenDispute(r.Context(), dispute)
+	switch err {
+	case nil:
+	case errNotDisputable, errEscrowNotDisputable, errTransferNotDisputable, errDisputeLegNotDisputable, errDisputeTooOld:
+		writeValidationError(w, r, &response, validationErrors{"transaction_id": {err.(*Error).Message + "."}})
+		return
+	case errDisputeTooLarge:
+		writeValidationError(w, r, &response, validationErrors{"amount": {errDisputeTooLarge.Message + "."}})
+		return
+	default:
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListDisputes -> the latest disputes of my wallet
+func HandleListDisputes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListDisputes
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	disputes, err := ListDisputes(r.Context(), userIDFromContext(r.Context()), req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = disputesResponse(disputes)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleViewDispute -> a dispute of my wallet with its notes
+func HandleViewDispute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	dispute, err := ViewDispute(r.Context(), userIDFromContext(r.Context()), ps.ByName("dispute_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleAddDisputeEvidence -> add a note to a dispute of my wallet
+func HandleAddDisputeEvidence(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleCustomerDisputeNote(w, r, ps, true, AddDisputeEvidence)
+}
+
+// HandleWithdrawDispute -> drop a dispute of my wallet, a provisional credit is taken back
+func HandleWithdrawDispute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleCustomerDisputeNote(w, r, ps, false, WithdrawDispute)
+}
+
+func handleCustomerDisputeNote(w http.ResponseWriter, r *http.Request, ps httprouter.Params, required bool, action func(ctx context.Context, userID, disputeID, body string) (Dispute, error)) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestDisputeNote
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	body, errs := disputeNoteFromRequest(req.Note, required)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	dispute, err := action(r.Context(), userIDFromContext(r.Context()), ps.ByName("dispute_id"), body)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleAdminDisputes -> Admin: the latest disputes, of one status or overdue
+func HandleAdminDisputes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestAdminDisputes
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	switch req.Status {
+	case "", disputeStatusOpen, disputeStatusReviewing, disputeStatusNeedsInfo, disputeStatusWon, disputeStatusLost, disputeStatusWithdrawn:
+	default:
+		writeValidationError(w, r, &response, validationErrors{"status": {"Must be open, reviewing, needs_info, won, lost or withdrawn."}})
+		return
+	}
+
+	disputes, err := AdminDisputes(r.Context(), req.Status, req.Overdue, req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = disputesResponse(disputes)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleAdminDispute -> Admin: a dispute with all its notes
+func HandleAdminDispute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	dispute, err := AdminDispute(r.Context(), ps.ByName("dispute_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleMoveDispute -> Admin: move a dispute to reviewing or needs_info, or resolve it as won
+// or lost
+func HandleMoveDispute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestMoveDispute
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	body, errs := disputeNoteFromRequest(req.Note, req.Status != disputeStatusReviewing)
+	switch req.Status {
+	case disputeStatusReviewing, disputeStatusNeedsInfo, disputeStatusWon, disputeStatusLost:
+	default:
+		errs.add("status", "Must be reviewing, needs_info, won or lost.")
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	dispute, err := MoveDispute(r.Context(), ps.ByName("dispute_id"), req.Status, body)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePlaceProvisionalCredit -> Admin: credit the amount of a dispute until it is decided
+func HandlePlaceProvisionalCredit(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestDisputeNote
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	body, errs := disputeNoteFromRequest(req.Note, false)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	dispute, err := PlaceProvisionalCredit(r.Context(), ps.ByName("dispute_id"), body)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleAddAdminDisputeNote -> Admin: add a note to a dispute, internal=true hides it from
+// the customer
+func HandleAddAdminDisputeNote(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestAdminDisputeNote
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	body, errs := disputeNoteFromRequest(req.Note, true)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	dispute, err := AddAdminDisputeNote(r.Context(), ps.ByName("dispute_id"), body, req.Internal)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseDispute{
+		Dispute: disputeResponse(dispute, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func disputesResponse(disputes []Dispute) ResponseDisputes {
+	now := time.Now()
+	data := ResponseDisputes{
+		Disputes: []ResponseDisputeDetail{},
+	}
+	for _, dispute := range disputes {
+		data.Disputes = append(data.Disputes, disputeResponse(dispute, now))
+	}
+
+	return data
+}
+
+// disputeResponse -> the dispute with the notes it was read with, lists leave them out
+func disputeResponse(dispute Dispute, now time.Time) ResponseDisputeDetail {
+	detail := ResponseDisputeDetail{
+		ID:                       dispute.ID,
+		UserID:                   dispute.UserID,
+		WalletID:                 dispute.WalletID,
+		TransactionID:            dispute.TransactionID,
+		Amount:                   dispute.Amount,
+		Reason:                   dispute.Reason,
+		Evidence:                 dispute.Evidence,
+		Status:                   dispute.Status,
+		Overdue:                  dispute.Overdue(now),
+		ProvisionalTransactionID: dispute.ProvisionalTransactionID,
+		CreditTransactionID:      dispute.CreditTransactionID,
+		ReversalTransactionID:    dispute.ReversalTransactionID,
+		Uncollected:              dispute.Uncollected,
+		CreatedAt:                dispute.CreateTime,
+		UpdatedAt:                dispute.UpdateTime,
+	}
+	if !dispute.Resolved() {
+		detail.DueAt = &dispute.DueTime
+	}
+	if !dispute.ResolveTime.IsZero() {
+		detail.ResolvedAt = &dispute.ResolveTime
+	}
+	for _, note := range dispute.Notes {
+		detail.Notes = append(detail.Notes, ResponseDisputeNote{
+			Author:        note.Author,
+			AuthorID:      note.AuthorID,
+			Status:        note.Status,
+			Note:          note.Body,
+			Internal:      note.Internal,
+			TransactionID: note.TransactionID,
+			CreatedAt:     note.CreateTime,
+		})
+	}
+
+	return detail
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// lostDisputeTakeBack -> withdraw 400 from the wallet of userID, dispute it, place a
+// provisional credit and lose the dispute, the id of the withdrawal taking the credit back
+func lostDisputeTakeBack(t *testing.T, userID string) (takeBackID string) {
+	t.Helper()
+	ctx := context.Background()
+
+	withdrawal, _, err := WithdrawFromPocket(ctx, userID, "", userID+"-withdrawal", "", 400)
+	if err != nil {
+		t.Fatalf("WithdrawFromPocket: %v", err)
+	}
+
+	dispute, errs := disputeFromRequest(userID, RequestDispute{TransactionID: withdrawal.ID, Reason: "not_received"}, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("disputeFromRequest: %v", errs)
+	}
+
+	dispute, err = OpenDispute(ctx, dispute)
+	if err != nil {
+		t.Fatalf("OpenDispute: %v", err)
+	}
+
+	_, err = PlaceProvisionalCredit(ctx, dispute.ID, "test")
+	if err != nil {
+		t.Fatalf("PlaceProvisionalCredit: %v", err)
+	}
+
+	dispute, err = MoveDispute(ctx, dispute.ID, disputeStatusLost, "test")
+	if err != nil {
+		t.Fatalf("MoveDispute: %v", err)
+	}
+	if dispute.ReversalTransactionID == "" {
+		t.Fatalf("lost dispute took nothing back")
+	}
+
+	return dispute.ReversalTransactionID
+}
+
+// TestDisputeTakeBack -> the withdrawal taking a provisional credit back is not disputed again
+func TestDisputeTakeBack(t *testing.T) {
+	ctx := context.Background()
+	userID := fundedWallet(t, 1000)
+	takeBackID := lostDisputeTakeBack(t, userID)
+
+	dispute, errs := disputeFromRequest(userID, RequestDispute{TransactionID: takeBackID, Reason: "not_received"}, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("disputeFromRequest: %v", errs)
+	}
+
+	_, err := OpenDispute(ctx, dispute)
+	if err != errDisputeLegNotDisputable {
+		t.Errorf("OpenDispute: %v, want %v", err, errDisputeLegNotDisputable)
+	}
+}
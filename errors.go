@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// errorCode -> stable machine readable error code, clients branch on it instead of the message
+type errorCode string
+
+const (
+	codeInvalidInput          errorCode = "INVALID_INPUT"
+	codeUnsupportedMediaType  errorCode = "UNSUPPORTED_MEDIA_TYPE"
+	codeUnauthorized          errorCode = "UNAUTHORIZED"
+	codeNotFound              errorCode = "NOT_FOUND"
+	codeAccountExists         errorCode = "ACCOUNT_EXISTS"
+	codeWalletDisabled        errorCode = "WALLET_DISABLED"
+	codeWalletAlreadyEnabled  errorCode = "WALLET_ALREADY_ENABLED"
+	codeWalletAlreadyDisabled errorCode = "WALLET_ALREADY_DISABLED"
+	codeInsufficientFunds     errorCode = "INSUFFICIENT_FUNDS"
+	codeDuplicateReference    errorCode = "DUPLICATE_REFERENCE"
+	codeLimitExceeded         errorCode = "LIMIT_EXCEEDED"
+	codeIdempotencyKeyReused  errorCode = "IDEMPOTENCY_KEY_REUSED"
+	codeIdempotencyInProgress errorCode = "IDEMPOTENCY_IN_PROGRESS"
+	codeSlowConsumer          errorCode = "SLOW_CONSUMER"
+	codeBatchInvalid          errorCode = "BATCH_INVALID"
+	codeVoucherUnavailable    errorCode = "VOUCHER_UNAVAILABLE"
+	codePaymentUnavailable    errorCode = "PAYMENT_UNAVAILABLE"
+	codeEscrowUnavailable     errorCode = "ESCROW_UNAVAILABLE"
+	codeDisputeUnavailable    errorCode = "DISPUTE_UNAVAILABLE"
+	codeInternal              errorCode = "INTERNAL_ERROR"
+)
+
+// errorStatus -> the one place error codes are mapped to http status
+var errorStatus = map[errorCode]int{
+	codeInvalidInput:          http.StatusBadRequest,
+	codeUnsupportedMediaType:  http.StatusUnsupportedMediaType,
+	codeUnauthorized:          http.StatusUnauthorized,
+	codeNotFound:              http.StatusNotFound,
+	codeAccountExists:         http.StatusConflict,
+	codeWalletDisabled:        http.StatusNotFound,
+	codeWalletAlreadyEnabled:  http.StatusConflict,
+	codeWalletAlreadyDisabled: http.StatusConflict,
+	codeInsufficientFunds:     http.StatusUnprocessableEntity,
+	codeDuplicateReference:    http.StatusConflict,
+	codeLimitExceeded:         http.StatusTooManyRequests,
+	codeIdempotencyKeyReused:  http.StatusUnprocessableEntity,
+	codeIdempotencyInProgress: http.StatusConflict,
+	codeSlowConsumer:          http.StatusTooManyRequests,
+	codeBatchInvalid:          http.StatusConflict,
+	codeVoucherUnavailable:    http.StatusConflict,
+	codePaymentUnavailable:    http.StatusConflict,
+	codeEscrowUnavailable:     http.StatusConflict,
+	codeDisputeUnavailable:    http.StatusConflict,
+	codeInternal:              http.StatusInternalServerError,
+}
+
+// Error -> domain error returned by usecases
+type Error struct {
+	Code    errorCode
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	errUnauthorized              = &Error{Code: codeUnauthorized, Message: "Authorization failed"}
+	errWalletNotFound            = &Error{Code: codeNotFound, Message: "Wallet not found"}
+	errUserNotFound              = &Error{Code: codeNotFound, Message: "User not found"}
+	errWatchOwnWallet            = &Error{Code: codeInvalidInput, Message: "Owners always watch their own wallet"}
+	errWebSocketUpgrade          = &Error{Code: codeInvalidInput, Message: "Expected a websocket upgrade request"}
+	errInvalidWatchMessage       = &Error{Code: codeInvalidInput, Message: "Expected a subscribe, unsubscribe or ack message"}
+	errTooManyWatchedWallets     = &Error{Code: codeInvalidInput, Message: "Too many wallets on one connection"}
+	errAccountExists             = &Error{Code: codeAccountExists, Message: "Account already exists"}
+	errWalletDisabled            = &Error{Code: codeWalletDisabled, Message: "Wallet disabled"}
+	errWalletAlreadyEnabled      = &Error{Code: codeWalletAlreadyEnabled, Message: "Already enabled"}
+	errWalletAlreadyDisabled     = &Error{Code: codeWalletAlreadyDisabled, Message: "Already disabled"}
+	errInsufficientFunds         = &Error{Code: codeInsufficientFunds, Message: "Insufficient balance"}
+	errDuplicateReference        = &Error{Code: codeDuplicateReference, Message: "Reference id must be unique"}
+	errLimitExceeded             = &Error{Code: codeLimitExceeded, Message: "Too many requests"}
+	errIdempotencyKeyReused      = &Error{Code: codeIdempotencyKeyReused, Message: "Idempotency-Key was used for a different request"}
+	errIdempotencyInProgress     = &Error{Code: codeIdempotencyInProgress, Message: "A request with this Idempotency-Key is still in progress"}
+	errSlowConsumer              = &Error{Code: codeSlowConsumer, Message: "Stream fell too far behind and was closed"}
+	errTransferToSelf            = &Error{Code: codeInvalidInput, Message: "Cannot transfer to your own wallet"}
+	errRecipientUnavailable      = &Error{Code: codeNotFound, Message: "Recipient wallet not found or disabled"}
+	errScheduleNotFound          = &Error{Code: codeNotFound, Message: "Schedule not found"}
+	errScheduleCancelled         = &Error{Code: codeInvalidInput, Message: "Schedule is cancelled"}
+	errPocketNotFound            = &Error{Code: codeNotFound, Message: "Pocket not found"}
+	errPocketExists              = &Error{Code: codeInvalidInput, Message: "A pocket with this name already exists"}
+	errTooManyPockets            = &Error{Code: codeInvalidInput, Message: "Too many pockets, a wallet has at most 20"}
+	errMainPocket                = &Error{Code: codeInvalidInput, Message: "The main pocket cannot be deleted"}
+	errSamePocket                = &Error{Code: codeInvalidInput, Message: "Cannot move money to the same pocket"}
+	errGoalNotFound              = &Error{Code: codeNotFound, Message: "Goal not found"}
+	errGoalCancelled             = &Error{Code: codeInvalidInput, Message: "Goal is cancelled"}
+	errGoalPocket                = &Error{Code: codeInvalidInput, Message: "The pocket belongs to a savings goal, cancel the goal instead"}
+	errFeeScheduleNotFound       = &Error{Code: codeNotFound, Message: "Fee schedule not found"}
+	errSystemAccountNotFound     = &Error{Code: codeNotFound, Message: "System account not found"}
+	errVoucherCampaignNotFound   = &Error{Code: codeNotFound, Message: "Voucher campaign not found"}
+	errVoucherNotFound           = &Error{Code: codeNotFound, Message: "Voucher code not found"}
+	errVoucherRedeemed           = &Error{Code: codeVoucherUnavailable, Message: "Voucher code was already redeemed"}
+	errVoucherExpired            = &Error{Code: codeVoucherUnavailable, Message: "Voucher code has expired"}
+	errVoucherBudgetSpent        = &Error{Code: codeVoucherUnavailable, Message: "The budget of this voucher campaign is used up"}
+	errVoucherCapReached         = &Error{Code: codeVoucherUnavailable, Message: "You already redeemed the most codes of this campaign"}
+	errPointsRuleNotFound        = &Error{Code: codeNotFound, Message: "Points rule not found"}
+	errInsufficientPoints        = &Error{Code: codeInsufficientFunds, Message: "Not enough points"}
+	errTransactionNotFound       = &Error{Code: codeNotFound, Message: "Transaction not found"}
+	errNotReversible             = &Error{Code: codeInvalidInput, Message: "Only withdrawals can be reversed"}
+	errAlreadyReversed           = &Error{Code: codeDuplicateReference, Message: "Transaction was already reversed"}
+	errPaymentNotReversible      = &Error{Code: codeInvalidInput, Message: "Payments are given back by a refund of the merchant"}
+	errMerchantNotFound          = &Error{Code: codeNotFound, Message: "Merchant not found"}
+	errMerchantKeyNotFound       = &Error{Code: codeNotFound, Message: "API key not found or already revoked"}
+	errPaymentNotFound           = &Error{Code: codeNotFound, Message: "Payment not found"}
+	errPaymentUnavailable        = &Error{Code: codePaymentUnavailable, Message: "Payment is no longer pending"}
+	errPaymentExpired            = &Error{Code: codePaymentUnavailable, Message: "Payment has expired"}
+	errPaymentNotPaid            = &Error{Code: codePaymentUnavailable, Message: "Only paid payments can be refunded"}
+	errRefundTooLarge            = &Error{Code: codeInvalidInput, Message: "Refund is more than what is left of the payment"}
+	errPaymentDisputed           = &Error{Code: codePaymentUnavailable, Message: "Payment was disputed by the customer, the dispute decides what is given back"}
+	errPaymentRequestNotFound    = &Error{Code: codeNotFound, Message: "Payment request not found"}
+	errPaymentRequestUnavailable = &Error{Code: codePaymentUnavailable, Message: "Payment request is no longer open"}
+	errPaymentRequestExpired     = &Error{Code: codePaymentUnavailable, Message: "Payment request has expired"}
+	errEscrowNotFound            = &Error{Code: codeNotFound, Message: "Escrow not found"}
+	errEscrowUnavailable         = &Error{Code: codeEscrowUnavailable, Message: "Escrow is no longer funded"}
+	errEscrowSettled             = &Error{Code: codeEscrowUnavailable, Message: "Escrow was already released or refunded"}
+	errEscrowDisputed            = &Error{Code: codeEscrowUnavailable, Message: "Escrow is disputed and waits for an admin"}
+	errEscrowNotAllowed          = &Error{Code: codeEscrowUnavailable, Message: "Only the buyer releases and only the seller refunds an escrow"}
+	errEscrowNotReversible       = &Error{Code: codeInvalidInput, Message: "Escrows are given back by a refund or a dispute of the escrow"}
+	errTransferNotReversible     = &Error{Code: codeInvalidInput, Message: "Transfers and payment request settlements cannot be reversed"}
+	errDisputeLegNotReversible   = &Error{Code: codeInvalidInput, Message: "Withdrawals of a dispute cannot be reversed"}
+	errDisputeNotFound           = &Error{Code: codeNotFound, Message: "Dispute not found"}
+	errNotDisputable             = &Error{Code: codeInvalidInput, Message: "Only withdrawals and fees can be disputed"}
+	errEscrowNotDisputable       = &Error{Code: codeInvalidInput, Message: "Escrows are disputed on the escrow itself"}
+	errTransferNotDisputable     = &Error{Code: codeInvalidInput, Message: "Transfers between wallets cannot be disputed"}
+	errDisputeLegNotDisputable   = &Error{Code: codeInvalidInput, Message: "Withdrawals of a dispute cannot be disputed again"}
+	errPaymentRefunded           = &Error{Code: codeDisputeUnavailable, Message: "Payment was already refunded by the merchant"}
+	errDisputeTooOld             = &Error{Code: codeInvalidInput, Message: "Transactions older than 120 days can no longer be disputed"}
+	errDisputeTooLarge           = &Error{Code: codeInvalidInput, Message: "Dispute is more than the amount of the transaction"}
+	errAlreadyDisputed           = &Error{Code: codeDisputeUnavailable, Message: "Transaction was already disputed"}
+	errTransactionDisputed       = &Error{Code: codeDisputeUnavailable, Message: "Transaction is disputed, decide the dispute instead"}
+	errDisputeResolved           = &Error{Code: codeDisputeUnavailable, Message: "Dispute was already resolved"}
+	errDisputeInStatus           = &Error{Code: codeDisputeUnavailable, Message: "Dispute is already in that status"}
+	errProvisionalCreditPlaced   = &Error{Code: codeDisputeUnavailable, Message: "A provisional credit was already placed"}
+	errBatchNotFound             = &Error{Code: codeNotFound, Message: "Batch not found"}
+	errBatchInvalid              = &Error{Code: codeBatchInvalid, Message: "Batch has invalid rows, fix the file and upload it again"}
+	errBatchMediaType            = &Error{Code: codeUnsupportedMediaType, Message: "Unsupported content type, upload the batch as " + contentTypeCSV + " or as the file field of multipart/form-data"}
+	errUnsupportedMediaType      = &Error{Code: codeUnsupportedMediaType, Message: "Unsupported content type, use " + contentTypeForm + " or " + contentTypeJSON}
+)
+
+// errorCodeOf -> code of a domain error, anything else is internal
+func errorCodeOf(err error) errorCode {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Code
+	}
+
+	return codeInternal
+}
+
+// errorReason -> metric label for a failed operation
+func errorReason(err error) string {
+	return strings.ToLower(string(errorCodeOf(err)))
+}
+
+func httpStatusOf(err error) int {
+	if status, ok := errorStatus[errorCodeOf(err)]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrConstraint
+	}
+
+	return false
+}
+
+// newResponseError -> error body for err, internal errors do not leak their message
+func newResponseError(ctx context.Context, err error) ResponseError {
+	code := errorCodeOf(err)
+
+	message := "Internal server error"
+	if code != codeInternal {
+		message = err.Error()
+	}
+
+	return ResponseError{
+		Error:     message,
+		Code:      string(code),
+		RequestID: requestIDFromContext(ctx),
+	}
+}
+
+// writeError -> fill a handler response for err and write its status
+func writeError(w http.ResponseWriter, r *http.Request, response *Response, err error) {
+	response.Status = statusFail
+	response.Data = newResponseError(r.Context(), err)
+	w.WriteHeader(httpStatusOf(err))
+}
+
+// abortError -> write a complete error response, for middlewares that stop the chain
+func abortError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response := Response{}
+	writeError(w, r, &response, err)
+	json.NewEncoder(w).Encode(response)
+}
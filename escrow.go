@@ -0,0 +1,1341 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// An escrow holds money of a buyer for a seller. Funding withdraws it from the main pocket
+// of the buyer into the escrow system account, releasing deposits it to the seller and
+// refunding deposits it back to the buyer. Either party may dispute a funded escrow, an
+// admin then decides it. Every change of status is a conditional update with its event in
+// one tx, and escrow_event takes at most one released or refunded event per escrow, so the
+// money leaves escrow once however many buyers, admins or sweeps try at the same time.
+
+const (
+	escrowStatusFunded   = "funded"
+	escrowStatusDisputed = "disputed"
+	escrowStatusReleased = "released"
+	escrowStatusRefunded = "refunded"
+
+	escrowActorBuyer  = "buyer"
+	escrowActorSeller = "seller"
+	escrowActorAdmin  = "admin"
+	escrowActorSystem = "system"
+
+	escrowReferencePrefix = "escrow:"
+
+	defaultEscrowExpiry = 14 * 24 * time.Hour
+	maxEscrowExpiry     = 90 * 24 * time.Hour
+	maxEscrowTextLen    = 500
+
+	// escrowTimeoutPoll -> how often funded escrows past their expiry are refunded
+	escrowTimeoutPoll = time.Minute
+)
+
+// Escrow -> Amount of BuyerID held for SellerID until it is released or refunded, or until
+// ExpireTime when a funded escrow is refunded. FundTransactionID withdrew it from the buyer,
+// SettleTransactionID deposited it to whoever got it.
+type Escrow struct {
+	ID                  string    `db:"id"`
+	BuyerID             string    `db:"buyer_id"`
+	BuyerWalletID       string    `db:"buyer_wallet_id"`
+	SellerID            string    `db:"seller_id"`
+	SellerWalletID      string    `db:"seller_wallet_id"`
+	Amount              int       `db:"amount"`
+	Description         string    `db:"description"`
+	Status              string    `db:"status"`
+	FundTransactionID   string    `db:"fund_transaction_id"`
+	SettleTransactionID string    `db:"settle_transaction_id"`
+	ExpireTime          time.Time `db:"expire_time"`
+	CreateTime          time.Time `db:"create_time"`
+	UpdateTime          time.Time `db:"update_time"`
+
+	// Events -> the history of the escrow when it was read, not stored
+	Events []EscrowEvent
+}
+
+// EscrowEvent -> a change of status of an escrow, Type is the status it moved to. Actor is
+// buyer, seller, admin or system, TransactionID is set when money moved.
+type EscrowEvent struct {
+	ID            string    `db:"id"`
+	EscrowID      string    `db:"escrow_id"`
+	Type          string    `db:"type"`
+	Actor         string    `db:"actor"`
+	ActorID       string    `db:"actor_id"`
+	Note          string    `db:"note"`
+	TransactionID string    `db:"transaction_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// RoleOf -> buyer or seller for the parties of the escrow, empty for everyone else
+func (e Escrow) RoleOf(userID string) string {
+	switch userID {
+	case e.BuyerID:
+		return escrowActorBuyer
+	case e.SellerID:
+		return escrowActorSeller
+	default:
+		return ""
+	}
+}
+
+// Settled -> the money left escrow
+func (e Escrow) Settled() bool {
+	return e.Status == escrowStatusReleased || e.Status == escrowStatusRefunded
+}
+
+const (
+	createEscrowTable = `
+		CREATE TABLE IF NOT EXISTS escrow (
+			id TEXT NOT NULL PRIMARY KEY,
+			buyer_id TEXT NOT NULL,
+			buyer_wallet_id TEXT NOT NULL,
+			seller_id TEXT NOT NULL,
+			seller_wallet_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			description TEXT NOT NULL,
+			status TEXT NOT NULL,
+			fund_transaction_id TEXT NOT NULL,
+			settle_transaction_id TEXT NOT NULL,
+			expire_time DATETIME NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createEscrowEventTable = `
+		CREATE TABLE IF NOT EXISTS escrow_event (
+			id TEXT NOT NULL PRIMARY KEY,
+			escrow_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			note TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	// createEscrowSettledIndex -> the money leaves an escrow once, whatever its status says
+	createEscrowSettledIndex = `
+		CREATE UNIQUE INDEX IF NOT EXISTS escrow_event_settled ON escrow_event (escrow_id)
+		WHERE type IN ('released', 'refunded');
+	`
+
+	insertEscrowSQL = `
+		INSERT INTO escrow
+			(id, buyer_id, buyer_wallet_id, seller_id, seller_wallet_id, amount, description, status,
+			fund_transaction_id, settle_transaction_id, expire_time, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,'',?,?,?)
+		;
+	`
+
+	insertEscrowEventSQL = `
+		INSERT INTO escrow_event
+			(id, escrow_id, type, actor, actor_id, note, transaction_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	selectEscrowSQL = `
+		SELECT
+			id,
+			buyer_id,
+			buyer_wallet_id,
+			seller_id,
+			seller_wallet_id,
+			amount,
+			description,
+			status,
+			fund_transaction_id,
+			settle_transaction_id,
+			expire_time,
+			create_time,
+			update_time
+		FROM
+			escrow
+	`
+
+	getEscrowSQL = selectEscrowSQL + `
+		WHERE
+			id = $1
+	`
+
+	// getUserEscrowsSQL -> the latest escrows $2 buys when $1 is buyer, or sells when $1 is
+	// seller
+	getUserEscrowsSQL = selectEscrowSQL + `
+		WHERE
+			($1 = 'buyer' AND buyer_id = $2) OR
+			($1 = 'seller' AND seller_id = $2)
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $3
+	`
+
+	// getEscrowsSQL -> the latest escrows, of one status when $1 is set
+	getEscrowsSQL = selectEscrowSQL + `
+		WHERE
+			$1 = '' OR status = $1
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $2
+	`
+
+	getEscrowEventsSQL = `
+		SELECT
+			id,
+			escrow_id,
+			type,
+			actor,
+			actor_id,
+			note,
+			transaction_id,
+			create_time
+		FROM
+			escrow_event
+		WHERE
+			escrow_id = $1
+		ORDER BY
+			create_time,
+			rowid
+	`
+
+	getTimedOutEscrowIDsSQL = `
+		SELECT
+			id
+		FROM
+			escrow
+		WHERE
+			status = 'funded' AND
+			julianday(expire_time) <= julianday($1)
+		ORDER BY
+			expire_time
+	`
+
+	disputeEscrowSQL = `
+		UPDATE
+			escrow
+		SET
+			status = 'disputed',
+			update_time = $1
+		WHERE
+			id = $2 AND
+			status = 'funded'
+	`
+
+	// settleEscrowSQL -> release or refund a funded escrow, or a disputed one when $4 is set,
+	// nothing changes once it was released or refunded
+	settleEscrowSQL = `
+		UPDATE
+			escrow
+		SET
+			status = $1,
+			update_time = $2
+		WHERE
+			id = $3 AND
+			(status = 'funded' OR (status = 'disputed' AND $4))
+	`
+
+	setEscrowSettleTransactionSQL = `
+		UPDATE
+			escrow
+		SET
+			settle_transaction_id = $1
+		WHERE
+			id = $2
+	`
+
+	countEscrowLegsSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			escrow
+		WHERE
+			fund_transaction_id = $1
+	`
+)
+
+func scanEscrow(scanner interface{ Scan(...interface{}) error }) (escrow Escrow, err error) {
+	err = scanner.Scan(
+		&escrow.ID,
+		&escrow.BuyerID,
+		&escrow.BuyerWalletID,
+		&escrow.SellerID,
+		&escrow.SellerWalletID,
+		&escrow.Amount,
+		&escrow.Description,
+		&escrow.Status,
+		&escrow.FundTransactionID,
+		&escrow.SettleTransactionID,
+		&escrow.ExpireTime,
+		&escrow.CreateTime,
+		&escrow.UpdateTime,
+	)
+
+	return
+}
+
+func queryEscrowEvents(ctx context.Context, q querier, escrowID string) (events []EscrowEvent, err error) {
+	rows, err := q.QueryContext(ctx, getEscrowEventsSQL, escrowID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event EscrowEvent
+		err = rows.Scan(
+			&event.ID,
+			&event.EscrowID,
+			&event.Type,
+			&event.Actor,
+			&event.ActorID,
+			&event.Note,
+			&event.TransactionID,
+			&event.CreateTime,
+		)
+		if err != nil {
+			return
+		}
+
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// queryEscrow -> the escrow with its events, read in tx when it is set
+func queryEscrow(ctx context.Context, db *sql.DB, tx *sql.Tx, escrowID string) (escrow Escrow, err error) {
+	if tx != nil {
+		escrow, err = scanEscrow(tx.QueryRowContext(ctx, getEscrowSQL, escrowID))
+		if err != nil {
+			return
+		}
+
+		escrow.Events, err = queryEscrowEvents(ctx, tx, escrowID)
+		return
+	}
+
+	escrow, err = scanEscrow(db.QueryRowContext(ctx, getEscrowSQL, escrowID))
+	if err != nil {
+		return
+	}
+
+	escrow.Events, err = queryEscrowEvents(ctx, db, escrowID)
+	return
+}
+
+func insertEscrowEvent(ctx context.Context, tx *sql.Tx, event EscrowEvent) (err error) {
+	_, err = tx.ExecContext(ctx,
+		insertEscrowEventSQL,
+		event.ID,
+		event.EscrowID,
+		event.Type,
+		event.Actor,
+		event.ActorID,
+		event.Note,
+		event.TransactionID,
+		event.CreateTime,
+	)
+	if isUniqueViolation(err) {
+		err = errEscrowSettled
+		return
+	}
+	if err != nil {
+		logError(ctx, "insertEscrowEvent ExecContext", err)
+	}
+
+	return
+}
+
+func getEscrow(ctx context.Context, db *sql.DB, escrowID string) (escrow Escrow, err error) {
+	defer observeQuery("getEscrow", time.Now())
+	ctx, span := startQuerySpan(ctx, "getEscrow")
+	defer func() {
+		span.end(err)
+	}()
+
+	escrow, err = queryEscrow(ctx, db, nil, escrowID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getEscrow Scan", err)
+	}
+
+	return
+}
+
+func queryEscrows(ctx context.Context, db *sql.DB, name, query string, args ...interface{}) (escrows []Escrow, err error) {
+	defer observeQuery(name, time.Now())
+	ctx, span := startQuerySpan(ctx, name)
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logError(ctx, name+" QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var escrow Escrow
+		escrow, err = scanEscrow(rows)
+		if err != nil {
+			logError(ctx, name+" Scan", err)
+			return
+		}
+
+		escrows = append(escrows, escrow)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getTimedOutEscrowIDs(ctx context.Context, db *sql.DB, now time.Time) (escrowIDs []string, err error) {
+	defer observeQuery("getTimedOutEscrowIDs", time.Now())
+	ctx, span := startQuerySpan(ctx, "getTimedOutEscrowIDs")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getTimedOutEscrowIDsSQL, now)
+	if err != nil {
+		logError(ctx, "getTimedOutEscrowIDs QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var escrowID string
+		err = rows.Scan(&escrowID)
+		if err != nil {
+			logError(ctx, "getTimedOutEscrowIDs Scan", err)
+			return
+		}
+
+		escrowIDs = append(escrowIDs, escrowID)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// fundEscrow -> withdraw the amount from the main pocket of the buyer into the escrow system
+// account and record the escrow with its funded event in one tx
+func fundEscrow(ctx context.Context, db *sql.DB, escrow *Escrow) (err error) {
+	defer observeQuery("fundEscrow", time.Now())
+	ctx, span := startQuerySpan(ctx, "fundEscrow")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "fundEscrow BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	reference := escrowReferencePrefix + escrow.ID
+	withdrawal, event, err := applyBalanceChange(ctx, tx, escrow.BuyerWalletID, "", reference, escrow.Amount, withdrawalType)
+	if err != nil {
+		return
+	}
+
+	err = postSystemEntry(ctx, tx, &SystemEntry{
+		AccountID:     systemAccountEscrow,
+		Amount:        escrow.Amount,
+		WalletID:      escrow.BuyerWalletID,
+		TransactionID: withdrawal.ID,
+		ReferenceID:   reference,
+		CreateTime:    withdrawal.CreateTime,
+	})
+	if err != nil {
+		return
+	}
+
+	escrow.FundTransactionID = withdrawal.ID
+	_, err = tx.ExecContext(ctx,
+		insertEscrowSQL,
+		escrow.ID,
+		escrow.BuyerID,
+		escrow.BuyerWalletID,
+		escrow.SellerID,
+		escrow.SellerWalletID,
+		escrow.Amount,
+		escrow.Description,
+		escrow.Status,
+		escrow.FundTransactionID,
+		escrow.ExpireTime,
+		escrow.CreateTime,
+		escrow.UpdateTime,
+	)
+	if err != nil {
+		logError(ctx, "fundEscrow insert", err)
+		return
+	}
+
+	err = insertEscrowEvent(ctx, tx, EscrowEvent{
+		ID:            generateUUID(),
+		EscrowID:      escrow.ID,
+		Type:          escrowStatusFunded,
+		Actor:         escrowActorBuyer,
+		ActorID:       escrow.BuyerID,
+		TransactionID: withdrawal.ID,
+		CreateTime:    escrow.CreateTime,
+	})
+	if err != nil {
+		return
+	}
+
+	*escrow, err = queryEscrow(ctx, db, tx, escrow.ID)
+	if err != nil {
+		logError(ctx, "fundEscrow Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "fundEscrow Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// disputeEscrow -> move a funded escrow to disputed with its event in one tx,
+// errEscrowUnavailable when it is not funded
+func disputeEscrow(ctx context.Context, db *sql.DB, escrow *Escrow, event EscrowEvent) (err error) {
+	defer observeQuery("disputeEscrow", time.Now())
+	ctx, span := startQuerySpan(ctx, "disputeEscrow")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "disputeEscrow BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, disputeEscrowSQL, event.CreateTime, escrow.ID)
+	if err != nil {
+		logError(ctx, "disputeEscrow ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "disputeEscrow RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errEscrowUnavailable
+		return
+	}
+
+	err = insertEscrowEvent(ctx, tx, event)
+	if err != nil {
+		return
+	}
+
+	*escrow, err = queryEscrow(ctx, db, tx, escrow.ID)
+	if err != nil {
+		logError(ctx, "disputeEscrow Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "disputeEscrow Commit", err)
+	}
+
+	return
+}
+
+// escrowLeg -> transactionID is the withdrawal that funded an escrow. The money of it is
+// given back by a refund or a dispute of the escrow only, a reversal or a dispute of the
+// withdrawal would pay the buyer while the escrow can still be released.
+func escrowLeg(ctx context.Context, tx *sql.Tx, transactionID string) (leg bool, err error) {
+	var legs int
+	err = tx.QueryRowContext(ctx, countEscrowLegsSQL, transactionID).Scan(&legs)
+	if err != nil {
+		logError(ctx, "escrowLeg Scan", err)
+		return
+	}
+	leg = legs > 0
+
+	return
+}
+
+// settleEscrow -> release the escrow to the seller or refund it to the buyer by event.Type,
+// moving the money out of the escrow system account with the event in one tx. Only an admin
+// settles a disputed escrow. errEscrowSettled when it was released or refunded before,
+// errEscrowDisputed when it waits for an admin.
+func settleEscrow(ctx context.Context, db *sql.DB, escrow *Escrow, event EscrowEvent) (err error) {
+	defer observeQuery("settleEscrow", time.Now())
+	ctx, span := startQuerySpan(ctx, "settleEscrow")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "settleEscrow BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, settleEscrowSQL, event.Type, event.CreateTime, escrow.ID, event.Actor == escrowActorAdmin)
+	if err != nil {
+		logError(ctx, "settleEscrow claim", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "settleEscrow RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errEscrowSettled
+		if current, _ := queryEscrow(ctx, db, tx, escrow.ID); current.Status == escrowStatusDisputed {
+			err = errEscrowDisputed
+		}
+		return
+	}
+
+	walletID := escrow.SellerWalletID
+	if event.Type == escrowStatusRefunded {
+		walletID = escrow.BuyerWalletID
+	}
+
+	reference := escrowReferencePrefix + escrow.ID
+	deposit, depositEvent, err := applyBalanceChange(ctx, tx, walletID, "", reference, escrow.Amount, depositType)
+	if err != nil {
+		return
+	}
+
+	err = postSystemEntry(ctx, tx, &SystemEntry{
+		AccountID:     systemAccountEscrow,
+		Amount:        -escrow.Amount,
+		WalletID:      walletID,
+		TransactionID: deposit.ID,
+		ReferenceID:   reference,
+		CreateTime:    deposit.CreateTime,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, setEscrowSettleTransactionSQL, deposit.ID, escrow.ID)
+	if err != nil {
+		logError(ctx, "settleEscrow set transaction", err)
+		return
+	}
+
+	event.TransactionID = deposit.ID
+	err = insertEscrowEvent(ctx, tx, event)
+	if err != nil {
+		return
+	}
+
+	*escrow, err = queryEscrow(ctx, db, tx, escrow.ID)
+	if err != nil {
+		logError(ctx, "settleEscrow Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "settleEscrow Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, depositEvent)
+
+	return
+}
+
+// escrowFromRequest -> the escrow userID funds by req, or the fields that are wrong
+func escrowFromRequest(userID string, req RequestEscrow, now time.Time) (escrow Escrow, errs validationErrors) {
+	errs = validationErrors{}
+
+	escrow = Escrow{
+		ID:          generateUUID(),
+		BuyerID:     userID,
+		SellerID:    strings.TrimSpace(req.SellerID),
+		Amount:      req.Amount,
+		Description: strings.TrimSpace(req.Description),
+		Status:      escrowStatusFunded,
+		ExpireTime:  now.Add(defaultEscrowExpiry),
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+
+	switch {
+	case escrow.SellerID == "":
+		errs.add("seller_id", msgRequired)
+	case escrow.SellerID == userID:
+		errs.add("seller_id", "Must not be yourself.")
+	case strings.HasPrefix(escrow.SellerID, merchantUserPrefix):
+		errs.add("seller_id", "Must be the id of a customer.")
+	}
+
+	if len(escrow.Description) > maxEscrowTextLen {
+		errs.add("description", "Must be at most 500 characters.")
+	}
+
+	if req.ExpiresAt != "" {
+		expireTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		switch {
+		case err != nil:
+			errs.add("expires_at", "Must be an RFC 3339 time.")
+		case !expireTime.After(now):
+			errs.add("expires_at", "Must be in the future.")
+		case expireTime.Sub(now) > maxEscrowExpiry:
+			errs.add("expires_at", "Must be within 90 days.")
+		default:
+			escrow.ExpireTime = expireTime
+		}
+	}
+
+	return
+}
+
+// partyEscrow -> an escrow of userID with the role they play in it, errEscrowNotFound for
+// everyone but its buyer and seller
+func partyEscrow(ctx context.Context, userID, escrowID string) (escrow Escrow, role string, err error) {
+	escrow, err = getEscrow(ctx, database, escrowID)
+	if err == sql.ErrNoRows {
+		err = errEscrowNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	role = escrow.RoleOf(userID)
+	if role == "" {
+		err = errEscrowNotFound
+	}
+
+	return
+}
+
+// escrowStateError -> why an escrow cannot be released, refunded or disputed by its parties
+func escrowStateError(escrow Escrow) error {
+	switch escrow.Status {
+	case escrowStatusFunded:
+		return nil
+	case escrowStatusDisputed:
+		return errEscrowDisputed
+	default:
+		return errEscrowSettled
+	}
+}
+
+// CreateEscrow -> fund an escrow for the seller from the main pocket of the buyer, the seller
+// needs an enabled wallet
+func CreateEscrow(ctx context.Context, escrow Escrow) (created Escrow, err error) {
+	ctx = withOperation(ctx, "create_escrow")
+	ctx, span := startSpan(ctx, "CreateEscrow", spanKindInternal)
+	span.setAttribute("amount", escrow.Amount)
+	defer func() {
+		observeWalletResult("create_escrow", escrow.Amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, escrow.BuyerID)
+	if err != nil {
+		return
+	}
+
+	seller, err := getWalletByUserID(ctx, database, escrow.SellerID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "CreateEscrow getWalletByUserID", err)
+		return
+	}
+	err = nil
+
+	if seller.ID == "" || seller.Status == statusInactive {
+		err = errRecipientUnavailable
+		return
+	}
+
+	main, err := pocketOf(ctx, wallet, "")
+	if err != nil {
+		return
+	}
+
+	if escrow.Amount > main.Balance {
+		err = errInsufficientFunds
+		return
+	}
+
+	escrow.BuyerWalletID = wallet.ID
+	escrow.SellerWalletID = seller.ID
+
+	err = fundEscrow(ctx, database, &escrow)
+	if err != nil {
+		if err != errInsufficientFunds {
+			logError(ctx, "CreateEscrow fundEscrow", err)
+		}
+		return
+	}
+
+	return escrow, nil
+}
+
+// ListEscrows -> the latest escrows userID buys, or sells when role is seller
+func ListEscrows(ctx context.Context, userID, role string, limit int) (escrows []Escrow, err error) {
+	ctx = withOperation(ctx, "list_escrows")
+	ctx, span := startSpan(ctx, "ListEscrows", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	escrows, err = queryEscrows(ctx, database, "getUserEscrows", getUserEscrowsSQL, role, userID, limit)
+	return
+}
+
+// ViewEscrow -> an escrow userID buys or sells, with its history
+func ViewEscrow(ctx context.Context, userID, escrowID string) (escrow Escrow, err error) {
+	ctx = withOperation(ctx, "view_escrow")
+	ctx, span := startSpan(ctx, "ViewEscrow", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	escrow, _, err = partyEscrow(ctx, userID, escrowID)
+	return
+}
+
+// ReleaseEscrow -> the buyer confirms and the money goes to the seller
+func ReleaseEscrow(ctx context.Context, userID, escrowID, note string) (escrow Escrow, err error) {
+	return settleEscrowBy(ctx, userID, escrowID, escrowActorBuyer, escrowStatusReleased, note)
+}
+
+// RefundEscrow -> the seller gives the money back to the buyer
+func RefundEscrow(ctx context.Context, userID, escrowID, note string) (escrow Escrow, err error) {
+	return settleEscrowBy(ctx, userID, escrowID, escrowActorSeller, escrowStatusRefunded, note)
+}
+
+// settleEscrowBy -> settle a funded escrow to status by the party that may do so
+func settleEscrowBy(ctx context.Context, userID, escrowID, actor, status, note string) (escrow Escrow, err error) {
+	operation := "release_escrow"
+	if status == escrowStatusRefunded {
+		operation = "refund_escrow"
+	}
+
+	ctx = withOperation(ctx, operation)
+	ctx, span := startSpan(ctx, "SettleEscrow", spanKindInternal)
+	span.setAttribute("status", status)
+	defer func() {
+		observeWalletResult(operation, escrow.Amount, err)
+		span.finish(err)
+	}()
+
+	escrow, role, err := partyEscrow(ctx, userID, escrowID)
+	if err != nil {
+		return
+	}
+
+	if role != actor {
+		err = errEscrowNotAllowed
+		return
+	}
+
+	err = escrowStateError(escrow)
+	if err != nil {
+		return
+	}
+
+	err = settleEscrow(ctx, database, &escrow, EscrowEvent{
+		ID:         generateUUID(),
+		EscrowID:   escrow.ID,
+		Type:       status,
+		Actor:      actor,
+		ActorID:    userID,
+		Note:       note,
+		CreateTime: time.Now(),
+	})
+	if err != nil && err != errEscrowSettled && err != errEscrowDisputed {
+		logError(ctx, "SettleEscrow settleEscrow", err)
+	}
+
+	return
+}
+
+// DisputeEscrow -> the buyer or the seller holds a funded escrow for an admin to decide, it
+// no longer times out
+func DisputeEscrow(ctx context.Context, userID, escrowID, reason string) (escrow Escrow, err error) {
+	ctx = withOperation(ctx, "dispute_escrow")
+	ctx, span := startSpan(ctx, "DisputeEscrow", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	escrow, role, err := partyEscrow(ctx, userID, escrowID)
+	if err != nil {
+		return
+	}
+
+	err = escrowStateError(escrow)
+	if err != nil {
+		return
+	}
+
+	err = disputeEscrow(ctx, database, &escrow, EscrowEvent{
+		ID:         generateUUID(),
+		EscrowID:   escrow.ID,
+		Type:       escrowStatusDisputed,
+		Actor:      role,
+		ActorID:    userID,
+		Note:       reason,
+		CreateTime: time.Now(),
+	})
+
+	return
+}
+
+// AdminEscrows -> the latest escrows, of one status when status is set
+func AdminEscrows(ctx context.Context, status string, limit int) (escrows []Escrow, err error) {
+	ctx = withOperation(ctx, "admin_escrows")
+	ctx, span := startSpan(ctx, "AdminEscrows", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	escrows, err = queryEscrows(ctx, database, "getEscrows", getEscrowsSQL, status, limit)
+	return
+}
+
+// AdminEscrow -> any escrow with its history
+func AdminEscrow(ctx context.Context, escrowID string) (escrow Escrow, err error) {
+	ctx = withOperation(ctx, "admin_escrow")
+	ctx, span := startSpan(ctx, "AdminEscrow", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	escrow, err = getEscrow(ctx, database, escrowID)
+	if err == sql.ErrNoRows {
+		err = errEscrowNotFound
+	}
+
+	return
+}
+
+// ResolveEscrow -> an admin releases or refunds a funded or disputed escrow
+func ResolveEscrow(ctx context.Context, escrowID, status, note string) (escrow Escrow, err error) {
+	ctx = withOperation(ctx, "resolve_escrow")
+	ctx, span := startSpan(ctx, "ResolveEscrow", spanKindInternal)
+	span.setAttribute("status", status)
+	defer func() {
+		observeWalletResult("resolve_escrow", escrow.Amount, err)
+		span.finish(err)
+	}()
+
+	escrow, err = getEscrow(ctx, database, escrowID)
+	if err == sql.ErrNoRows {
+		err = errEscrowNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	if escrow.Settled() {
+		err = errEscrowSettled
+		return
+	}
+
+	err = settleEscrow(ctx, database, &escrow, EscrowEvent{
+		ID:         generateUUID(),
+		EscrowID:   escrow.ID,
+		Type:       status,
+		Actor:      escrowActorAdmin,
+		Note:       note,
+		CreateTime: time.Now(),
+	})
+	if err != nil && err != errEscrowSettled {
+		logError(ctx, "ResolveEscrow settleEscrow", err)
+	}
+
+	return
+}
+
+// escrowTimeout -> refunds the funded escrows past their expiry every poll, disputed ones
+// wait for an admin
+type escrowTimeout struct {
+	clock clock
+	poll  time.Duration
+}
+
+func newEscrowTimeout(c clock) *escrowTimeout {
+	return &escrowTimeout{clock: c, poll: escrowTimeoutPoll}
+}
+
+var walletEscrowTimeout = newEscrowTimeout(systemClock{})
+
+// run -> sweep now and then every poll, until ctx is done
+func (e *escrowTimeout) run(ctx context.Context) {
+	for {
+		e.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(e.poll):
+		}
+	}
+}
+
+// sweep -> refund the escrows that timed out by now, one at a time
+func (e *escrowTimeout) sweep(ctx context.Context) {
+	ctx = withOperation(ctx, "escrow_timeout")
+	now := e.clock.Now()
+
+	escrowIDs, err := getTimedOutEscrowIDs(ctx, database, now)
+	if err != nil {
+		logError(ctx, "escrowTimeout getTimedOutEscrowIDs", err)
+		return
+	}
+
+	for _, escrowID := range escrowIDs {
+		escrow, err := getEscrow(ctx, database, escrowID)
+		if err != nil {
+			continue
+		}
+
+		err = settleEscrow(ctx, database, &escrow, EscrowEvent{
+			ID:         generateUUID(),
+			EscrowID:   escrow.ID,
+			Type:       escrowStatusRefunded,
+			Actor:      escrowActorSystem,
+			Note:       "Not released by " + escrow.ExpireTime.UTC().Format(time.RFC3339),
+			CreateTime: now,
+		})
+		// released, refunded or disputed since it was read
+		if err == errEscrowSettled || err == errEscrowDisputed {
+			continue
+		}
+		if err != nil {
+			logError(ctx, "escrowTimeout settleEscrow", err)
+			continue
+		}
+
+		logInfo(ctx, "escrow refunded on timeout", "escrow_id", escrow.ID, "wallet_id", escrow.BuyerWalletID)
+	}
+}
+
+// HandleCreateEscrow -> fund an escrow for a seller from my main pocket
+func HandleCreateEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestEscrow
+	if !bindRequest(w, r, &req, &response) {
+		observeWalletFailure("create_escrow", "invalid_input")
+		return
+	}
+
+	escrow, errs := escrowFromRequest(userIDFromContext(r.Context()), req, time.Now())
+	if len(errs) > 0 {
+		observeWalletFailure("create_escrow", "invalid_input")
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	escrow, err := CreateEscrow(r.Context(), escrow)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseEscrow{
+		Escrow: escrowResponse(escrow),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListEscrows -> the latest escrows I buy, or sell with role=seller
+func HandleListEscrows(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListEscrows
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	switch req.Role {
+	case "":
+		req.Role = escrowActorBuyer
+	case escrowActorBuyer, escrowActorSeller:
+	default:
+		writeValidationError(w, r, &response, validationErrors{"role": {"Must be buyer or seller."}})
+		return
+	}
+
+	escrows, err := ListEscrows(r.Context(), userIDFromContext(r.Context()), req.Role, req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = escrowsResponse(escrows)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleViewEscrow -> an escrow I buy or sell with its history
+func HandleViewEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	escrow, err := ViewEscrow(r.Context(), userIDFromContext(r.Context()), ps.ByName("escrow_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseEscrow{
+		Escrow: escrowResponse(escrow),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleReleaseEscrow -> as the buyer, confirm and pay the seller
+func HandleReleaseEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleEscrowAction(w, r, ps, ReleaseEscrow)
+}
+
+// HandleRefundEscrow -> as the seller, give the money back to the buyer
+func HandleRefundEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleEscrowAction(w, r, ps, RefundEscrow)
+}
+
+// HandleDisputeEscrow -> as the buyer or the seller, hold the escrow for an admin to decide
+func HandleDisputeEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleEscrowAction(w, r, ps, DisputeEscrow)
+}
+
+func handleEscrowAction(w http.ResponseWriter, r *http.Request, ps httprouter.Params, action func(ctx context.Context, userID, escrowID, note string) (Escrow, error)) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestEscrowNote
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	if len(req.Note) > maxEscrowTextLen {
+		writeValidationError(w, r, &response, validationErrors{"note": {"Must be at most 500 characters."}})
+		return
+	}
+
+	escrow, err := action(r.Context(), userIDFromContext(r.Context()), ps.ByName("escrow_id"), strings.TrimSpace(req.Note))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseEscrow{
+		Escrow: escrowResponse(escrow),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleAdminEscrows -> Admin: the latest escrows, of one status with status
+func HandleAdminEscrows(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestAdminEscrows
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	switch req.Status {
+	case "", escrowStatusFunded, escrowStatusDisputed, escrowStatusReleased, escrowStatusRefunded:
+	default:
+		writeValidationError(w, r, &response, validationErrors{"status": {"Must be funded, disputed, released or refunded."}})
+		return
+	}
+
+	escrows, err := AdminEscrows(r.Context(), req.Status, req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = escrowsResponse(escrows)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleAdminEscrow -> Admin: an escrow with its history
+func HandleAdminEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	escrow, err := AdminEscrow(r.Context(), ps.ByName("escrow_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseEscrow{
+		Escrow: escrowResponse(escrow),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleResolveEscrow -> Admin: decide an escrow, release pays the seller and refund the buyer
+func HandleResolveEscrow(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestResolveEscrow
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	errs := validationErrors{}
+	status := ""
+	switch req.Outcome {
+	case "release":
+		status = escrowStatusReleased
+	case "refund":
+		status = escrowStatusRefunded
+	default:
+		errs.add("outcome", "Must be release or refund.")
+	}
+
+	note := strings.TrimSpace(req.Note)
+	switch {
+	case note == "":
+		errs.add("note", msgRequired)
+	case len(note) > maxEscrowTextLen:
+		errs.add("note", "Must be at most 500 characters.")
+	}
+
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	escrow, err := ResolveEscrow(r.Context(), ps.ByName("escrow_id"), status, note)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseEscrow{
+		Escrow: escrowResponse(escrow),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func escrowsResponse(escrows []Escrow) ResponseEscrows {
+	data := ResponseEscrows{
+		Escrows: []ResponseEscrowDetail{},
+	}
+	for _, escrow := range escrows {
+		data.Escrows = append(data.Escrows, escrowResponse(escrow))
+	}
+
+	return data
+}
+
+// escrowResponse -> the escrow with the events it was read with, lists leave them out
+func escrowResponse(escrow Escrow) ResponseEscrowDetail {
+	detail := ResponseEscrowDetail{
+		ID:                  escrow.ID,
+		BuyerID:             escrow.BuyerID,
+		SellerID:            escrow.SellerID,
+		Amount:              escrow.Amount,
+		Description:         escrow.Description,
+		Status:              escrow.Status,
+		FundTransactionID:   escrow.FundTransactionID,
+		SettleTransactionID: escrow.SettleTransactionID,
+		ExpiresAt:           escrow.ExpireTime,
+		CreatedAt:           escrow.CreateTime,
+		UpdatedAt:           escrow.UpdateTime,
+	}
+	for _, event := range escrow.Events {
+		detail.Events = append(detail.Events, ResponseEscrowEvent{
+			Type:          event.Type,
+			Actor:         event.Actor,
+			ActorID:       event.ActorID,
+			Note:          event.Note,
+			TransactionID: event.TransactionID,
+			CreatedAt:     event.CreateTime,
+		})
+	}
+
+	return detail
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentEscrowFunding -> escrows funded from one wallet at the same time neither lose
+// an update nor overdraw the wallet, and the escrow account holds what went through
+func TestConcurrentEscrowFunding(t *testing.T) {
+	ctx := context.Background()
+	buyer := fundedWallet(t, 10000)
+	seller := fundedWallet(t, 0)
+
+	before, _ := getSystemAccount(ctx, database, systemAccountEscrow)
+
+	// 20 escrows of 600, the wallet covers 16 of them
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	funded := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			escrow, errs := escrowFromRequest(buyer, RequestEscrow{SellerID: seller, Amount: 600}, time.Now())
+			if len(errs) > 0 {
+				t.Errorf("escrow %d: %v", i, errs)
+				return
+			}
+
+			_, err := CreateEscrow(ctx, escrow)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				funded++
+			case !errors.Is(err, errInsufficientFunds):
+				t.Errorf("escrow %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if funded != 16 {
+		t.Errorf("%d escrows funded, want 16", funded)
+	}
+
+	wallet, _, _, err := ViewBalance(ctx, buyer)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+	if want := 10000 - funded*600; wallet.Balance != want {
+		t.Errorf("balance %d, want %d", wallet.Balance, want)
+	}
+
+	after, _ := getSystemAccount(ctx, database, systemAccountEscrow)
+	if got := after.Balance - before.Balance; got != funded*600 {
+		t.Errorf("escrow account grew by %d, want %d", got, funded*600)
+	}
+}
+
+// TestConcurrentEscrowSettlement -> an escrow released and refunded at the same time is
+// settled once, to one side, and the escrow account gives out its amount once
+func TestConcurrentEscrowSettlement(t *testing.T) {
+	ctx := context.Background()
+	buyer := fundedWallet(t, 1000)
+	seller := fundedWallet(t, 0)
+
+	before, _ := getSystemAccount(ctx, database, systemAccountEscrow)
+
+	escrow, errs := escrowFromRequest(buyer, RequestEscrow{SellerID: seller, Amount: 600}, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("escrowFromRequest: %v", errs)
+	}
+
+	escrow, err := CreateEscrow(ctx, escrow)
+	if err != nil {
+		t.Fatalf("CreateEscrow: %v", err)
+	}
+
+	// the buyer releases and the seller refunds, 10 times each
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var settled []string
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			settle, userID, status := ReleaseEscrow, buyer, escrowStatusReleased
+			if i%2 == 1 {
+				settle, userID, status = RefundEscrow, seller, escrowStatusRefunded
+			}
+
+			_, err := settle(ctx, userID, escrow.ID, "")
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				settled = append(settled, status)
+			case !errors.Is(err, errEscrowSettled):
+				t.Errorf("settlement %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(settled) != 1 {
+		t.Fatalf("escrow settled %d times (%v), want once", len(settled), settled)
+	}
+
+	wantBuyer, wantSeller := 400, 600
+	if settled[0] == escrowStatusRefunded {
+		wantBuyer, wantSeller = 1000, 0
+	}
+	for userID, want := range map[string]int{buyer: wantBuyer, seller: wantSeller} {
+		wallet, _, _, err := ViewBalance(ctx, userID)
+		if err != nil {
+			t.Fatalf("ViewBalance: %v", err)
+		}
+		if wallet.Balance != want {
+			t.Errorf("%s %s: balance %d, want %d", settled[0], userID, wallet.Balance, want)
+		}
+	}
+
+	after, _ := getSystemAccount(ctx, database, systemAccountEscrow)
+	if after.Balance != before.Balance {
+		t.Errorf("escrow account moved by %d, want 0", after.Balance-before.Balance)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+const (
+	walletEventEnabled    = "enabled"
+	walletEventDisabled   = "disabled"
+	walletEventDeposit    = "deposit"
+	walletEventWithdrawal = "withdrawal"
+	walletEventInterest   = "interest"
+	walletEventFee        = "fee"
+	walletEventPromo      = "promo"
+	walletEventCashback   = "cashback"
+	walletEventExpiry     = "expiry"
+
+	// walletEventBuffer -> events a subscriber may fall behind before it is dropped
+	walletEventBuffer = 64
+
+	// walletEventReplayLimit -> most events replayed to a resuming subscriber
+	walletEventReplayLimit = 1000
+)
+
+// walletEvent -> a committed change of a wallet with its state afterwards.
+// Sequence counts the events of one wallet from 1 and is the resume point of a stream.
+type walletEvent struct {
+	WalletID    string             `db:"wallet_id"`
+	Sequence    int64              `db:"sequence"`
+	Type        string             `db:"type"`
+	UserID      string             `db:"user_id"`
+	Status      int                `db:"status"`
+	Balance     int                `db:"balance"`
+	Transaction *WalletTransaction `db:"-"`
+	Time        time.Time          `db:"create_time"`
+}
+
+func userTopic(userID string) string {
+	return "user:" + userID
+}
+
+func walletTopic(walletID string) string {
+	return "wallet:" + walletID
+}
+
+// walletSubscription -> C is closed on unsubscribe, or when the subscriber fell behind
+type walletSubscription struct {
+	C      chan walletEvent
+	topics map[string]struct{}
+	lagged bool
+	closed bool
+}
+
+// walletBroker -> in process pub/sub of wallet events, by owner or by wallet topic
+type walletBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[*walletSubscription]struct{}
+}
+
+var walletEvents = &walletBroker{
+	subscribers: map[string]map[*walletSubscription]struct{}{},
+}
+
+func (b *walletBroker) subscribe(topics ...string) *walletSubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &walletSubscription{
+		C:      make(chan walletEvent, walletEventBuffer),
+		topics: map[string]struct{}{},
+	}
+	b.add(sub, topics)
+
+	return sub
+}
+
+// addTopics -> widen a live subscription, a no-op once it is closed
+func (b *walletBroker) addTopics(sub *walletSubscription, topics ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !sub.closed {
+		b.add(sub, topics)
+	}
+}
+
+// removeTopics -> narrow a live subscription, C stays open even without topics
+func (b *walletBroker) removeTopics(sub *walletSubscription, topics ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics {
+		b.drop(sub, topic)
+	}
+}
+
+// add -> caller holds b.mu
+func (b *walletBroker) add(sub *walletSubscription, topics []string) {
+	for _, topic := range topics {
+		if b.subscribers[topic] == nil {
+			b.subscribers[topic] = map[*walletSubscription]struct{}{}
+		}
+		b.subscribers[topic][sub] = struct{}{}
+		sub.topics[topic] = struct{}{}
+	}
+}
+
+// drop -> caller holds b.mu
+func (b *walletBroker) drop(sub *walletSubscription, topic string) {
+	delete(sub.topics, topic)
+	delete(b.subscribers[topic], sub)
+	if len(b.subscribers[topic]) == 0 {
+		delete(b.subscribers, topic)
+	}
+}
+
+func (b *walletBroker) unsubscribe(sub *walletSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// publish -> never blocks the writer, a subscriber with a full buffer is dropped
+func (b *walletBroker) publish(event walletEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// a subscriber on both topics gets the event once
+	subs := map[*walletSubscription]struct{}{}
+	for _, topic := range []string{userTopic(event.UserID), walletTopic(event.WalletID)} {
+		for sub := range b.subscribers[topic] {
+			subs[sub] = struct{}{}
+		}
+	}
+
+	for sub := range subs {
+		select {
+		case sub.C <- event:
+		default:
+			sub.lagged = true
+			b.remove(sub)
+		}
+	}
+}
+
+// remove -> caller holds b.mu
+func (b *walletBroker) remove(sub *walletSubscription) {
+	if sub.closed {
+		return
+	}
+
+	for topic := range sub.topics {
+		b.drop(sub, topic)
+	}
+
+	sub.closed = true
+	close(sub.C)
+}
+
+// isLagged -> whether C was closed because the subscriber fell behind
+func (b *walletBroker) isLagged(sub *walletSubscription) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return sub.lagged
+}
+
+// publishWalletEvent -> call once the transaction that recorded event is committed
+func publishWalletEvent(ctx context.Context, event walletEvent) {
+	logDebug(ctx, "publish wallet event", "event", event.Type, "sequence", event.Sequence, "balance", event.Balance)
+	walletEvents.publish(event)
+}
+
+// SubscribeWallet -> live events of the wallet of userID, plus the stored events after
+// lastSequence when a client resumes. Subscribing before reading the backlog means no
+// event is lost in between, callers skip live events at or below the last one sent.
+func SubscribeWallet(ctx context.Context, userID string, lastSequence int64) (wallet Wallet, backlog []walletEvent, sub *walletSubscription, err error) {
+	ctx = withOperation(ctx, "subscribe_wallet")
+	ctx, span := startSpan(ctx, "SubscribeWallet", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err = getWalletByUserID(ctx, database, userID)
+	setWalletID(ctx, wallet.ID)
+	if err == sql.ErrNoRows {
+		err = errWalletNotFound
+		return
+	}
+	if err != nil {
+		logError(ctx, "SubscribeWallet getWalletByUserID", err)
+		return
+	}
+
+	sub = walletEvents.subscribe(walletTopic(wallet.ID))
+
+	if lastSequence > 0 {
+		backlog, err = getWalletEventsAfter(ctx, database, wallet.ID, lastSequence)
+		if err != nil {
+			walletEvents.unsubscribe(sub)
+			sub = nil
+			logError(ctx, "SubscribeWallet getWalletEventsAfter", err)
+			return
+		}
+	}
+
+	return
+}
+
+const (
+	createWalletEventTable = `
+		CREATE TABLE IF NOT EXISTS wallet_event (
+			wallet_id TEXT NOT NULL,
+			sequence INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			balance INTEGER NOT NULL,
+			transaction_id TEXT,
+			amount INTEGER,
+			reference_id TEXT,
+			create_time DATETIME NOT NULL,
+			PRIMARY KEY (wallet_id, sequence)
+		);
+	`
+
+	getWalletStateSQL = `
+		SELECT
+			user_id,
+			status,
+			balance,
+			(SELECT COALESCE(MAX(sequence), 0) + 1 FROM wallet_event WHERE wallet_id = $1)
+		FROM
+			wallet
+		WHERE
+			id = $1
+	`
+
+	insertWalletEventSQL = `
+		INSERT INTO wallet_event
+			(wallet_id, sequence, type, user_id, status, balance, transaction_id, amount, reference_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getWalletEventsAfterSQL = `
+		SELECT
+			wallet_id,
+			sequence,
+			type,
+			user_id,
+			status,
+			balance,
+			transaction_id,
+			amount,
+			reference_id,
+			create_time
+		FROM
+			wallet_event
+		WHERE
+			wallet_id = $1 AND
+			sequence > $2
+		ORDER BY
+			sequence
+		LIMIT $3
+	`
+)
+
+// recordWalletEvent -> store the next event of walletID inside tx, with the wallet state
+// as tx sees it. Publish the returned event after tx commits.
+func recordWalletEvent(ctx context.Context, tx *sql.Tx, walletID, eventType string, transaction *WalletTransaction) (event walletEvent, err error) {
+	ctx, span := startQuerySpan(ctx, "recordWalletEvent")
+	defer func() {
+		span.end(err)
+	}()
+
+	event = walletEvent{
+		WalletID:    walletID,
+		Type:        eventType,
+		Transaction: transaction,
+		Time:        time.Now(),
+	}
+
+	err = tx.QueryRowContext(ctx, getWalletStateSQL, walletID).Scan(
+		&event.UserID,
+		&event.Status,
+		&event.Balance,
+		&event.Sequence,
+	)
+	if err != nil {
+		logError(ctx, "recordWalletEvent QueryRowContext", err)
+		return
+	}
+
+	var transactionID, referenceID sql.NullString
+	var amount sql.NullInt64
+	if transaction != nil {
+		event.Time = transaction.CreateTime
+		transactionID = sql.NullString{String: transaction.ID, Valid: true}
+		referenceID = sql.NullString{String: transaction.ReferenceID, Valid: true}
+		amount = sql.NullInt64{Int64: int64(transaction.Amount), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertWalletEventSQL,
+		event.WalletID,
+		event.Sequence,
+		event.Type,
+		event.UserID,
+		event.Status,
+		event.Balance,
+		transactionID,
+		amount,
+		referenceID,
+		event.Time,
+	)
+	if err != nil {
+		logError(ctx, "recordWalletEvent ExecContext", err)
+	}
+
+	return
+}
+
+func getWalletEventsAfter(ctx context.Context, db *sql.DB, walletID string, sequence int64) (events []walletEvent, err error) {
+	defer observeQuery("getWalletEventsAfter", time.Now())
+	ctx, span := startQuerySpan(ctx, "getWalletEventsAfter")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getWalletEventsAfterSQL, walletID, sequence, walletEventReplayLimit)
+	if err != nil {
+		logError(ctx, "getWalletEventsAfter QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event walletEvent
+		var transactionID, referenceID sql.NullString
+		var amount sql.NullInt64
+
+		err = rows.Scan(
+			&event.WalletID,
+			&event.Sequence,
+			&event.Type,
+			&event.UserID,
+			&event.Status,
+			&event.Balance,
+			&transactionID,
+			&amount,
+			&referenceID,
+			&event.Time,
+		)
+		if err != nil {
+			logError(ctx, "getWalletEventsAfter Scan", err)
+			return
+		}
+
+		if transactionID.Valid {
+			event.Transaction = &WalletTransaction{
+				ID:          transactionID.String,
+				WalletID:    event.WalletID,
+				Type:        depositType,
+				Amount:      int(amount.Int64),
+				ReferenceID: referenceID.String,
+				CreateTime:  event.Time,
+			}
+			switch event.Type {
+			case walletEventWithdrawal:
+				event.Transaction.Type = withdrawalType
+			case walletEventInterest:
+				event.Transaction.Type = interestType
+			case walletEventFee:
+				event.Transaction.Type = feeType
+			case walletEventPromo:
+				event.Transaction.Type = promoType
+			case walletEventCashback:
+				event.Transaction.Type = cashbackType
+			case walletEventExpiry:
+				event.Transaction.Type = expiryType
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,879 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Fees are charged on withdrawals and transfers by the fee schedule in effect that matches
+// the transaction type, the KYC tier and the currency of the wallet, the most specific one
+// winning. The fee is debited from the same pocket as a fee transaction, in the same tx as
+// the transaction it pays for, and credited to the revenue system account.
+
+const (
+	feeTransactionWithdrawal = "withdrawal"
+	feeTransactionTransfer   = "transfer"
+
+	// feeKindFlat -> FlatAmount
+	feeKindFlat = "flat"
+	// feeKindPercent -> FlatAmount plus PercentBps of the amount
+	feeKindPercent = "percent"
+	// feeKindTiered -> FlatAmount plus the rates of the tiers the amount spans
+	feeKindTiered = "tiered"
+
+	// defaultKYCTier, walletCurrency -> wallets have no KYC tier or currency of their own
+	// yet, schedules for other tiers or currencies never match until they do
+	defaultKYCTier = "basic"
+	walletCurrency = "IDR"
+
+	feeReferencePrefix = "fee:"
+
+	feeDateLayout = "2006-01-02"
+)
+
+var (
+	feeTransactionTypes = []string{feeTransactionWithdrawal, feeTransactionTransfer}
+	feeKinds            = []string{feeKindFlat, feeKindPercent, feeKindTiered}
+)
+
+// FeeSchedule -> a fee rule, in effect from EffectiveFrom until the day before EffectiveTo
+type FeeSchedule struct {
+	ID              string    `db:"id"`
+	Name            string    `db:"name"`
+	TransactionType string    `db:"transaction_type"`
+	KYCTier         string    `db:"kyc_tier"`
+	Currency        string    `db:"currency"`
+	Kind            string    `db:"kind"`
+	FlatAmount      int       `db:"flat_amount"`
+	PercentBps      int       `db:"percent_bps"`
+	Tiers           string    `db:"tiers"`
+	MinFee          int       `db:"min_fee"`
+	MaxFee          int       `db:"max_fee"`
+	EffectiveFrom   string    `db:"effective_from"`
+	EffectiveTo     string    `db:"effective_to"`
+	CreateTime      time.Time `db:"create_time"`
+	UpdateTime      time.Time `db:"update_time"`
+
+	tiers []RateTier
+}
+
+// fee -> the fee on amount, rounded half up and kept between MinFee and MaxFee
+func (s FeeSchedule) fee(amount int) int {
+	bps := new(big.Int)
+	switch s.Kind {
+	case feeKindPercent:
+		bps.Mul(big.NewInt(int64(amount)), big.NewInt(int64(s.PercentBps)))
+	case feeKindTiered:
+		bps = tieredBps(s.tiers, amount)
+	}
+
+	fee := s.FlatAmount + int(roundDiv(bps, big.NewInt(maxInterestRate), roundHalfUp))
+	fee = max(fee, s.MinFee)
+	if s.MaxFee > 0 {
+		fee = min(fee, s.MaxFee)
+	}
+
+	return fee
+}
+
+// specificity -> how many of the selectors name a value instead of matching any
+func (s FeeSchedule) specificity() int {
+	n := 0
+	if s.KYCTier != "" {
+		n++
+	}
+	if s.Currency != "" {
+		n++
+	}
+
+	return n
+}
+
+// FeeCharge -> a fee on one transaction, quoted or debited
+type FeeCharge struct {
+	ID                  string    `db:"id"`
+	ScheduleID          string    `db:"schedule_id"`
+	WalletID            string    `db:"wallet_id"`
+	TransactionType     string    `db:"transaction_type"`
+	Amount              int       `db:"amount"`
+	SourceTransactionID string    `db:"source_transaction_id"`
+	FeeTransactionID    string    `db:"fee_transaction_id"`
+	SystemEntryID       string    `db:"system_entry_id"`
+	CreateTime          time.Time `db:"create_time"`
+
+	// KYCTier, Currency -> what the schedule was selected by, not stored
+	KYCTier  string
+	Currency string
+}
+
+const (
+	createFeeScheduleTable = `
+		CREATE TABLE IF NOT EXISTS fee_schedule (
+			id TEXT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			transaction_type TEXT NOT NULL,
+			kyc_tier TEXT NOT NULL,
+			currency TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			flat_amount INTEGER NOT NULL,
+			percent_bps INTEGER NOT NULL,
+			tiers TEXT NOT NULL,
+			min_fee INTEGER NOT NULL,
+			max_fee INTEGER NOT NULL,
+			effective_from TEXT NOT NULL,
+			effective_to TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createFeeChargeTable = `
+		CREATE TABLE IF NOT EXISTS fee_charge (
+			id TEXT NOT NULL PRIMARY KEY,
+			schedule_id TEXT NOT NULL,
+			wallet_id TEXT NOT NULL,
+			transaction_type TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			source_transaction_id TEXT NOT NULL,
+			fee_transaction_id TEXT NOT NULL UNIQUE,
+			system_entry_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertFeeScheduleSQL = `
+		INSERT INTO fee_schedule
+			(id, name, transaction_type, kyc_tier, currency, kind, flat_amount, percent_bps, tiers, min_fee, max_fee, effective_from, effective_to, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	updateFeeScheduleSQL = `
+		UPDATE
+			fee_schedule
+		SET
+			name = $1,
+			transaction_type = $2,
+			kyc_tier = $3,
+			currency = $4,
+			kind = $5,
+			flat_amount = $6,
+			percent_bps = $7,
+			tiers = $8,
+			min_fee = $9,
+			max_fee = $10,
+			effective_from = $11,
+			effective_to = $12,
+			update_time = $13
+		WHERE
+			id = $14
+	`
+
+	deleteFeeScheduleSQL = `
+		DELETE FROM
+			fee_schedule
+		WHERE
+			id = $1
+	`
+
+	selectFeeScheduleSQL = `
+		SELECT
+			id,
+			name,
+			transaction_type,
+			kyc_tier,
+			currency,
+			kind,
+			flat_amount,
+			percent_bps,
+			tiers,
+			min_fee,
+			max_fee,
+			effective_from,
+			effective_to,
+			create_time,
+			update_time
+		FROM
+			fee_schedule
+	`
+
+	getFeeSchedulesSQL = selectFeeScheduleSQL + `
+		ORDER BY
+			transaction_type,
+			effective_from,
+			create_time
+	`
+
+	getFeeScheduleSQL = selectFeeScheduleSQL + `
+		WHERE
+			id = $1
+	`
+
+	// getFeeSchedulesInEffectSQL -> schedules for transaction type $1 in effect on day $2
+	getFeeSchedulesInEffectSQL = selectFeeScheduleSQL + `
+		WHERE
+			transaction_type = $1 AND
+			effective_from <= $2 AND
+			(effective_to = '' OR effective_to > $2)
+	`
+
+	insertFeeChargeSQL = `
+		INSERT INTO fee_charge
+			(id, schedule_id, wallet_id, transaction_type, amount, source_transaction_id, fee_transaction_id, system_entry_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?)
+		;
+	`
+)
+
+func scanFeeSchedules(ctx context.Context, rows *sql.Rows) (schedules []FeeSchedule, err error) {
+	defer rows.Close()
+
+	for rows.Next() {
+		var schedule FeeSchedule
+		err = rows.Scan(
+			&schedule.ID,
+			&schedule.Name,
+			&schedule.TransactionType,
+			&schedule.KYCTier,
+			&schedule.Currency,
+			&schedule.Kind,
+			&schedule.FlatAmount,
+			&schedule.PercentBps,
+			&schedule.Tiers,
+			&schedule.MinFee,
+			&schedule.MaxFee,
+			&schedule.EffectiveFrom,
+			&schedule.EffectiveTo,
+			&schedule.CreateTime,
+			&schedule.UpdateTime,
+		)
+		if err != nil {
+			logError(ctx, "scanFeeSchedules Scan", err)
+			return
+		}
+
+		if schedule.Kind == feeKindTiered {
+			schedule.tiers, err = parseRateTiers(schedule.Tiers)
+			if err != nil {
+				logError(ctx, "scanFeeSchedules tiers", err)
+				return
+			}
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func insertFeeSchedule(ctx context.Context, db *sql.DB, schedule FeeSchedule) (err error) {
+	defer observeQuery("insertFeeSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertFeeSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		insertFeeScheduleSQL,
+		schedule.ID,
+		schedule.Name,
+		schedule.TransactionType,
+		schedule.KYCTier,
+		schedule.Currency,
+		schedule.Kind,
+		schedule.FlatAmount,
+		schedule.PercentBps,
+		schedule.Tiers,
+		schedule.MinFee,
+		schedule.MaxFee,
+		schedule.EffectiveFrom,
+		schedule.EffectiveTo,
+		schedule.CreateTime,
+		schedule.UpdateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertFeeSchedule ExecContext", err)
+	}
+
+	return
+}
+
+func updateFeeSchedule(ctx context.Context, db *sql.DB, schedule FeeSchedule) (err error) {
+	defer observeQuery("updateFeeSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateFeeSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		updateFeeScheduleSQL,
+		schedule.Name,
+		schedule.TransactionType,
+		schedule.KYCTier,
+		schedule.Currency,
+		schedule.Kind,
+		schedule.FlatAmount,
+		schedule.PercentBps,
+		schedule.Tiers,
+		schedule.MinFee,
+		schedule.MaxFee,
+		schedule.EffectiveFrom,
+		schedule.EffectiveTo,
+		schedule.UpdateTime,
+		schedule.ID,
+	)
+	if err != nil {
+		logError(ctx, "updateFeeSchedule ExecContext", err)
+	}
+
+	return
+}
+
+func deleteFeeSchedule(ctx context.Context, db *sql.DB, scheduleID string) (err error) {
+	defer observeQuery("deleteFeeSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "deleteFeeSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, deleteFeeScheduleSQL, scheduleID)
+	if err != nil {
+		logError(ctx, "deleteFeeSchedule ExecContext", err)
+	}
+
+	return
+}
+
+func getFeeSchedules(ctx context.Context, db *sql.DB) (schedules []FeeSchedule, err error) {
+	defer observeQuery("getFeeSchedules", time.Now())
+	ctx, span := startQuerySpan(ctx, "getFeeSchedules")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getFeeSchedulesSQL)
+	if err != nil {
+		logError(ctx, "getFeeSchedules QueryContext", err)
+		return
+	}
+
+	return scanFeeSchedules(ctx, rows)
+}
+
+func getFeeSchedule(ctx context.Context, db *sql.DB, scheduleID string) (schedule FeeSchedule, err error) {
+	defer observeQuery("getFeeSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "getFeeSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getFeeScheduleSQL, scheduleID)
+	if err != nil {
+		logError(ctx, "getFeeSchedule QueryContext", err)
+		return
+	}
+
+	schedules, err := scanFeeSchedules(ctx, rows)
+	if err != nil {
+		return
+	}
+	if len(schedules) == 0 {
+		err = sql.ErrNoRows
+		return
+	}
+
+	return schedules[0], nil
+}
+
+func getFeeSchedulesInEffect(ctx context.Context, db *sql.DB, transactionType, day string) (schedules []FeeSchedule, err error) {
+	defer observeQuery("getFeeSchedulesInEffect", time.Now())
+	ctx, span := startQuerySpan(ctx, "getFeeSchedulesInEffect")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getFeeSchedulesInEffectSQL, transactionType, day)
+	if err != nil {
+		logError(ctx, "getFeeSchedulesInEffect QueryContext", err)
+		return
+	}
+
+	return scanFeeSchedules(ctx, rows)
+}
+
+// applyFee -> debit charge.Amount from pocketID of the wallet as a fee transaction and
+// credit it to the revenue account in tx. The fee goes first, so the savings goal rules of
+// the transaction it pays for cannot leave the pocket short of it.
+func applyFee(ctx context.Context, tx *sql.Tx, charge *FeeCharge, pocketID string) (event walletEvent, err error) {
+	charge.ID = generateUUID()
+
+	transaction, event, err := applyBalanceChange(ctx, tx, charge.WalletID, pocketID, feeReferencePrefix+charge.ID, charge.Amount, feeType)
+	if err != nil {
+		return
+	}
+	charge.FeeTransactionID = transaction.ID
+	charge.CreateTime = transaction.CreateTime
+
+	entry := SystemEntry{
+		AccountID:     systemAccountRevenue,
+		Amount:        charge.Amount,
+		WalletID:      charge.WalletID,
+		TransactionID: transaction.ID,
+		ReferenceID:   transaction.ReferenceID,
+		CreateTime:    transaction.CreateTime,
+	}
+	err = postSystemEntry(ctx, tx, &entry)
+	if err != nil {
+		return
+	}
+	charge.SystemEntryID = entry.ID
+
+	return
+}
+
+// linkFee -> record charge as the fee of sourceTransactionID in tx
+func linkFee(ctx context.Context, tx *sql.Tx, charge *FeeCharge, sourceTransactionID string) (err error) {
+	charge.SourceTransactionID = sourceTransactionID
+
+	_, err = tx.ExecContext(ctx,
+		insertFeeChargeSQL,
+		charge.ID,
+		charge.ScheduleID,
+		charge.WalletID,
+		charge.TransactionType,
+		charge.Amount,
+		charge.SourceTransactionID,
+		charge.FeeTransactionID,
+		charge.SystemEntryID,
+		charge.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "linkFee ExecContext", err)
+	}
+
+	return
+}
+
+// quoteFee -> the fee the wallet pays on amount for a transaction of transactionType now,
+// 0 without a ScheduleID when no schedule matches
+func quoteFee(ctx context.Context, wallet Wallet, transactionType string, amount int, now time.Time) (charge FeeCharge, err error) {
+	charge = FeeCharge{
+		WalletID:        wallet.ID,
+		TransactionType: transactionType,
+		KYCTier:         defaultKYCTier,
+		Currency:        walletCurrency,
+	}
+
+	schedules, err := getFeeSchedulesInEffect(ctx, database, transactionType, now.UTC().Format(feeDateLayout))
+	if err != nil {
+		return
+	}
+
+	var best *FeeSchedule
+	for i, schedule := range schedules {
+		if schedule.KYCTier != "" && schedule.KYCTier != charge.KYCTier {
+			continue
+		}
+		if schedule.Currency != "" && schedule.Currency != charge.Currency {
+			continue
+		}
+
+		// the most specific, then the latest to take effect, then the latest created
+		if best == nil ||
+			schedule.specificity() > best.specificity() ||
+			schedule.specificity() == best.specificity() && schedule.EffectiveFrom > best.EffectiveFrom ||
+			schedule.specificity() == best.specificity() && schedule.EffectiveFrom == best.EffectiveFrom && schedule.CreateTime.After(best.CreateTime) {
+			best = &schedules[i]
+		}
+	}
+
+	if best != nil {
+		charge.ScheduleID = best.ID
+		charge.Amount = best.fee(amount)
+	}
+
+	return
+}
+
+// feeScheduleFromRequest -> the schedule of the request, or the fields that are wrong
+func feeScheduleFromRequest(req RequestFeeSchedule, now time.Time) (schedule FeeSchedule, errs validationErrors) {
+	errs = validationErrors{}
+
+	schedule = FeeSchedule{
+		Name:            strings.TrimSpace(req.Name),
+		TransactionType: req.TransactionType,
+		KYCTier:         strings.TrimSpace(req.KYCTier),
+		Currency:        strings.ToUpper(strings.TrimSpace(req.Currency)),
+		Kind:            req.Kind,
+		FlatAmount:      req.FlatAmount,
+		PercentBps:      req.PercentBps,
+		Tiers:           strings.ReplaceAll(req.Tiers, " ", ""),
+		MinFee:          req.MinFee,
+		MaxFee:          req.MaxFee,
+		EffectiveFrom:   req.EffectiveFrom,
+		EffectiveTo:     req.EffectiveTo,
+		CreateTime:      now,
+		UpdateTime:      now,
+	}
+
+	if schedule.Name == "" {
+		errs.add("name", msgRequired)
+	}
+
+	if !containsString(feeTransactionTypes, schedule.TransactionType) {
+		errs.add("transaction_type", "Must be one of: "+strings.Join(feeTransactionTypes, ", ")+".")
+	}
+
+	switch schedule.Kind {
+	case feeKindFlat:
+		schedule.PercentBps, schedule.Tiers = 0, ""
+	case feeKindPercent:
+		schedule.Tiers = ""
+		if schedule.PercentBps > maxInterestRate {
+			errs.add("percent_bps", "Must be at most 10000.")
+		}
+	case feeKindTiered:
+		schedule.PercentBps = 0
+		var err error
+		schedule.tiers, err = parseRateTiers(schedule.Tiers)
+		if err != nil {
+			errs.add("tiers", "Not valid tiers: "+err.Error()+".")
+		}
+	default:
+		errs.add("kind", "Must be one of: "+strings.Join(feeKinds, ", ")+".")
+	}
+
+	if schedule.MaxFee > 0 && schedule.MaxFee < schedule.MinFee {
+		errs.add("max_fee", "Must be at least min_fee, or 0 for no cap.")
+	}
+
+	if _, err := time.Parse(feeDateLayout, schedule.EffectiveFrom); err != nil {
+		errs.add("effective_from", "Not a valid date, e.g. 2026-01-01.")
+	}
+	if schedule.EffectiveTo != "" {
+		if _, err := time.Parse(feeDateLayout, schedule.EffectiveTo); err != nil {
+			errs.add("effective_to", "Not a valid date, e.g. 2026-12-31.")
+		} else if schedule.EffectiveTo <= schedule.EffectiveFrom {
+			errs.add("effective_to", "Must be after effective_from.")
+		}
+	}
+
+	return
+}
+
+// CreateFeeSchedule -> store a new fee schedule
+func CreateFeeSchedule(ctx context.Context, schedule FeeSchedule) (created FeeSchedule, err error) {
+	ctx = withOperation(ctx, "create_fee_schedule")
+	ctx, span := startSpan(ctx, "CreateFeeSchedule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	schedule.ID = generateUUID()
+
+	err = insertFeeSchedule(ctx, database, schedule)
+	if err != nil {
+		return
+	}
+
+	return schedule, nil
+}
+
+// ListFeeSchedules -> every fee schedule by transaction type and effective date
+func ListFeeSchedules(ctx context.Context) (schedules []FeeSchedule, err error) {
+	ctx = withOperation(ctx, "list_fee_schedules")
+	ctx, span := startSpan(ctx, "ListFeeSchedules", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	return getFeeSchedules(ctx, database)
+}
+
+// GetFeeSchedule ...
+func GetFeeSchedule(ctx context.Context, scheduleID string) (schedule FeeSchedule, err error) {
+	ctx = withOperation(ctx, "get_fee_schedule")
+	ctx, span := startSpan(ctx, "GetFeeSchedule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	schedule, err = getFeeSchedule(ctx, database, scheduleID)
+	if err == sql.ErrNoRows {
+		err = errFeeScheduleNotFound
+	}
+
+	return
+}
+
+// UpdateFeeSchedule -> replace a fee schedule, fees charged before keep their amount
+func UpdateFeeSchedule(ctx context.Context, scheduleID string, schedule FeeSchedule) (updated FeeSchedule, err error) {
+	ctx = withOperation(ctx, "update_fee_schedule")
+	ctx, span := startSpan(ctx, "UpdateFeeSchedule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	existing, err := getFeeSchedule(ctx, database, scheduleID)
+	if err == sql.ErrNoRows {
+		err = errFeeScheduleNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	schedule.ID = existing.ID
+	schedule.CreateTime = existing.CreateTime
+
+	err = updateFeeSchedule(ctx, database, schedule)
+	if err != nil {
+		return
+	}
+
+	return schedule, nil
+}
+
+// DeleteFeeSchedule -> drop a fee schedule, fees charged before keep their amount
+func DeleteFeeSchedule(ctx context.Context, scheduleID string) (schedule FeeSchedule, err error) {
+	ctx = withOperation(ctx, "delete_fee_schedule")
+	ctx, span := startSpan(ctx, "DeleteFeeSchedule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	schedule, err = getFeeSchedule(ctx, database, scheduleID)
+	if err == sql.ErrNoRows {
+		err = errFeeScheduleNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	err = deleteFeeSchedule(ctx, database, scheduleID)
+	return
+}
+
+// QuoteFee -> the fee the enabled wallet would pay now on amount for transactionType
+func QuoteFee(ctx context.Context, userID, transactionType string, amount int) (charge FeeCharge, err error) {
+	ctx = withOperation(ctx, "quote_fee")
+	ctx, span := startSpan(ctx, "QuoteFee", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	return quoteFee(ctx, wallet, transactionType, amount, time.Now())
+}
+
+// HandleQuoteFee -> The fee I would pay now on a withdrawal or transfer
+func HandleQuoteFee(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestFeeQuote
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	if !containsString(feeTransactionTypes, req.TransactionType) {
+		writeValidationError(w, r, &response, validationErrors{"transaction_type": {"Must be one of: " + strings.Join(feeTransactionTypes, ", ") + "."}})
+		return
+	}
+
+	charge, err := QuoteFee(r.Context(), userIDFromContext(r.Context()), req.TransactionType, req.Amount)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseFeeQuote{
+		TransactionType: charge.TransactionType,
+		Amount:          req.Amount,
+		Fee:             charge.Amount,
+		Total:           req.Amount + charge.Amount,
+		FeeScheduleID:   charge.ScheduleID,
+		KYCTier:         charge.KYCTier,
+		Currency:        charge.Currency,
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleCreateFeeSchedule -> Admin: add a fee schedule
+func HandleCreateFeeSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestFeeSchedule
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	schedule, errs := feeScheduleFromRequest(req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	schedule, err := CreateFeeSchedule(r.Context(), schedule)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseFeeSchedule{
+		FeeSchedule: feeScheduleResponse(schedule),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListFeeSchedules -> Admin: every fee schedule
+func HandleListFeeSchedules(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	schedules, err := ListFeeSchedules(r.Context())
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseFeeSchedules{
+		FeeSchedules: []ResponseFeeScheduleDetail{},
+	}
+	for _, schedule := range schedules {
+		data.FeeSchedules = append(data.FeeSchedules, feeScheduleResponse(schedule))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGetFeeSchedule -> Admin: view a fee schedule
+func HandleGetFeeSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	schedule, err := GetFeeSchedule(r.Context(), ps.ByName("fee_schedule_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseFeeSchedule{
+		FeeSchedule: feeScheduleResponse(schedule),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleUpdateFeeSchedule -> Admin: replace a fee schedule
+func HandleUpdateFeeSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestFeeSchedule
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	schedule, errs := feeScheduleFromRequest(req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	schedule, err := UpdateFeeSchedule(r.Context(), ps.ByName("fee_schedule_id"), schedule)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseFeeSchedule{
+		FeeSchedule: feeScheduleResponse(schedule),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleDeleteFeeSchedule -> Admin: drop a fee schedule
+func HandleDeleteFeeSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	schedule, err := DeleteFeeSchedule(r.Context(), ps.ByName("fee_schedule_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseFeeSchedule{
+		FeeSchedule: feeScheduleResponse(schedule),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func feeScheduleResponse(schedule FeeSchedule) ResponseFeeScheduleDetail {
+	detail := ResponseFeeScheduleDetail{
+		ID:              schedule.ID,
+		Name:            schedule.Name,
+		TransactionType: schedule.TransactionType,
+		KYCTier:         schedule.KYCTier,
+		Currency:        schedule.Currency,
+		Kind:            schedule.Kind,
+		FlatAmount:      schedule.FlatAmount,
+		PercentBps:      schedule.PercentBps,
+		MinFee:          schedule.MinFee,
+		MaxFee:          schedule.MaxFee,
+		EffectiveFrom:   schedule.EffectiveFrom,
+		EffectiveTo:     schedule.EffectiveTo,
+		CreatedAt:       schedule.CreateTime,
+		UpdatedAt:       schedule.UpdateTime,
+	}
+	for _, tier := range schedule.tiers {
+		detail.Tiers = append(detail.Tiers, ResponseRateTier{From: tier.From, RateBps: tier.RateBps})
+	}
+
+	return detail
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentFeeWithdrawals -> withdrawals paying a fee at the same time neither lose an
+// update nor overdraw the wallet, and revenue gets the fee of every one that went through
+func TestConcurrentFeeWithdrawals(t *testing.T) {
+	ctx := context.Background()
+	userID := fundedWallet(t, 10000)
+
+	now := time.Now()
+	schedule, err := CreateFeeSchedule(ctx, FeeSchedule{
+		Name:            "concurrent withdrawals",
+		TransactionType: feeTransactionWithdrawal,
+		Kind:            feeKindFlat,
+		FlatAmount:      10,
+		EffectiveFrom:   now.UTC().AddDate(0, 0, -1).Format(feeDateLayout),
+		CreateTime:      now,
+		UpdateTime:      now,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeeSchedule: %v", err)
+	}
+	defer DeleteFeeSchedule(ctx, schedule.ID)
+
+	before, _ := getSystemAccount(ctx, database, systemAccountRevenue)
+
+	// 20 withdrawals of 600 + 10 fee, the wallet covers 16 of them
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, _, err := WithdrawFromPocket(ctx, userID, "", userID+"-"+strconv.Itoa(i), "", 600)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, errInsufficientFunds):
+				t.Errorf("withdrawal %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 16 {
+		t.Errorf("%d withdrawals went through, want 16", succeeded)
+	}
+
+	wallet, _, _, err := ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+	if want := 10000 - succeeded*610; wallet.Balance != want {
+		t.Errorf("balance %d, want %d", wallet.Balance, want)
+	}
+
+	after, _ := getSystemAccount(ctx, database, systemAccountRevenue)
+	if got := after.Balance - before.Balance; got != succeeded*10 {
+		t.Errorf("revenue grew by %d, want %d", got, succeeded*10)
+	}
+}
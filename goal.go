@@ -0,0 +1,1021 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// A savings goal saves up to a target amount by a target date in a pocket of its own. Its
+// rules move money into that pocket whenever the wallet has a deposit or a withdrawal, in the
+// same database transaction, taken from the pocket the deposit or withdrawal used.
+
+const (
+	goalActive    = "active"
+	goalCancelled = "cancelled"
+
+	// goalRuleRoundUp -> round every withdrawal up to a multiple of round_up_unit
+	goalRuleRoundUp = "round_up"
+	// goalRuleDepositPercent -> deposit_percent of every deposit
+	goalRuleDepositPercent = "deposit_percent"
+
+	goalDateFormat = "2006-01-02"
+
+	// goalProjectionWindow -> how far back projections look for the pace of saving
+	goalProjectionWindow = 30 * 24 * time.Hour
+)
+
+// Goal -> a target amount to save by a target date, in its own pocket
+type Goal struct {
+	ID             string    `db:"id"`
+	WalletID       string    `db:"wallet_id"`
+	PocketID       string    `db:"pocket_id"`
+	Name           string    `db:"name"`
+	TargetAmount   int       `db:"target_amount"`
+	TargetDate     time.Time `db:"target_date"`
+	RoundUpUnit    int       `db:"round_up_unit"`
+	DepositPercent int       `db:"deposit_percent"`
+	Status         string    `db:"status"`
+	CreateTime     time.Time `db:"create_time"`
+	UpdateTime     time.Time `db:"update_time"`
+
+	// Saved -> balance of the pocket, zero once cancelled, not stored
+	Saved int
+}
+
+// contribution -> what a rule moves to the goal for entry, before the target caps it
+func (g Goal) contribution(entry PocketEntry) (rule string, amount int) {
+	switch {
+	case entry.Kind == pocketEntryWithdrawal && g.RoundUpUnit > 0:
+		return goalRuleRoundUp, (g.RoundUpUnit - entry.Amount%g.RoundUpUnit) % g.RoundUpUnit
+	case entry.Kind == pocketEntryDeposit && g.DepositPercent > 0:
+		return goalRuleDepositPercent, entry.Amount * g.DepositPercent / 100
+	}
+
+	return "", 0
+}
+
+// GoalProgress -> how far a goal is and when it will get there at the recent pace
+type GoalProgress struct {
+	Saved          int
+	Remaining      int
+	Percent        int
+	Reached        bool
+	OnTrack        bool
+	RequiredPerDay int
+
+	// ProjectedDate -> zero when the goal is reached, cancelled or not growing
+	ProjectedDate time.Time
+}
+
+// progress -> progress of the goal, recent is what the pocket gained over the last
+// goalProjectionWindow, or since the goal was created when that is shorter
+func (g Goal) progress(recent int, now time.Time) (progress GoalProgress) {
+	progress.Saved = g.Saved
+	progress.Remaining = max(g.TargetAmount-g.Saved, 0)
+	progress.Percent = min(g.Saved*100/g.TargetAmount, 100)
+	progress.Reached = progress.Remaining == 0
+	progress.OnTrack = progress.Reached
+
+	if progress.Reached || g.Status != goalActive {
+		return
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	daysLeft := int(g.TargetDate.Sub(today) / (24 * time.Hour))
+	progress.RequiredPerDay = progress.Remaining
+	if daysLeft > 0 {
+		progress.RequiredPerDay = (progress.Remaining + daysLeft - 1) / daysLeft
+	}
+
+	window := min(now.Sub(g.CreateTime), goalProjectionWindow)
+	days := max(window.Hours()/24, 1)
+	perDay := float64(recent) / days
+	if perDay <= 0 {
+		return
+	}
+
+	daysToGo := int(float64(progress.Remaining)/perDay + 0.999999)
+	progress.ProjectedDate = today.AddDate(0, 0, daysToGo)
+	progress.OnTrack = !progress.ProjectedDate.After(g.TargetDate)
+
+	return
+}
+
+// GoalEntry -> a change of the pocket of a goal, Rule is set when a goal rule made it
+type GoalEntry struct {
+	PocketEntry
+
+	Rule string
+}
+
+const (
+	createGoalTable = `
+		CREATE TABLE IF NOT EXISTS goal (
+			id TEXT NOT NULL PRIMARY KEY,
+			wallet_id TEXT NOT NULL,
+			pocket_id TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			target_amount INTEGER NOT NULL,
+			target_date DATETIME NOT NULL,
+			round_up_unit INTEGER NOT NULL,
+			deposit_percent INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createGoalContributionTable = `
+		CREATE TABLE IF NOT EXISTS goal_contribution (
+			id TEXT NOT NULL PRIMARY KEY,
+			goal_id TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			transaction_id TEXT NOT NULL,
+			move_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertGoalSQL = `
+		INSERT INTO goal
+			(id, wallet_id, pocket_id, name, target_amount, target_date, round_up_unit, deposit_percent, status, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	selectGoalSQL = `
+		SELECT
+			g.id,
+			g.wallet_id,
+			g.pocket_id,
+			g.name,
+			g.target_amount,
+			g.target_date,
+			g.round_up_unit,
+			g.deposit_percent,
+			g.status,
+			g.create_time,
+			g.update_time,
+			COALESCE(p.balance, 0)
+		FROM
+			goal g
+			LEFT JOIN pocket p ON p.id = g.pocket_id
+	`
+
+	getGoalsByWalletIDSQL = selectGoalSQL + `
+		WHERE
+			g.wallet_id = $1
+		ORDER BY
+			g.status,
+			g.create_time
+	`
+
+	getGoalSQL = selectGoalSQL + `
+		WHERE
+			g.id = $1 AND
+			g.wallet_id = $2
+	`
+
+	getGoalByPocketIDSQL = selectGoalSQL + `
+		WHERE
+			g.pocket_id = $1 AND
+			g.status = '` + goalActive + `'
+	`
+
+	getGoalsWithRulesSQL = selectGoalSQL + `
+		WHERE
+			g.wallet_id = $1 AND
+			g.status = '` + goalActive + `'
+		ORDER BY
+			g.create_time
+	`
+
+	updateGoalRulesSQL = `
+		UPDATE
+			goal
+		SET
+			round_up_unit = $1,
+			deposit_percent = $2,
+			update_time = $3
+		WHERE
+			id = $4
+	`
+
+	updateGoalStatusSQL = `
+		UPDATE
+			goal
+		SET
+			status = $1,
+			update_time = $2
+		WHERE
+			id = $3
+	`
+
+	insertGoalContributionSQL = `
+		INSERT INTO goal_contribution
+			(id, goal_id, rule, amount, transaction_id, move_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?)
+		;
+	`
+
+	getPocketGainSQL = `
+		SELECT
+			COALESCE(SUM(CASE WHEN kind IN ('` + pocketEntryWithdrawal + `', '` + pocketEntryFee + `', '` + pocketEntryExpiry + `', '` + pocketEntryMoveOut + `') THEN -amount ELSE amount END), 0)
+		FROM
+			pocket_entry
+		WHERE
+			pocket_id = $1 AND
+			julianday(create_time) >= julianday($2)
+	`
+
+	getGoalEntriesSQL = `
+		SELECT
+			e.id,
+			e.pocket_id,
+			e.kind,
+			e.amount,
+			e.balance,
+			e.transaction_id,
+			e.move_id,
+			e.other_pocket_id,
+			e.reference_id,
+			e.create_time,
+			COALESCE(c.rule, '')
+		FROM
+			pocket_entry e
+			LEFT JOIN goal_contribution c ON c.goal_id = $1 AND e.move_id != '' AND c.move_id = e.move_id
+		WHERE
+			e.pocket_id = $2
+		ORDER BY
+			julianday(e.create_time) DESC,
+			e.rowid DESC
+		LIMIT $3
+	`
+)
+
+// insertGoal -> the goal and its empty pocket in one tx
+func insertGoal(ctx context.Context, db *sql.DB, goal Goal) (err error) {
+	defer observeQuery("insertGoal", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertGoal")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertGoal BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, insertPocketSQL, goal.PocketID, goal.WalletID, goal.Name, false, 0, goal.CreateTime)
+	if err != nil {
+		logError(ctx, "insertGoal insert pocket", err)
+		return
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertGoalSQL,
+		goal.ID,
+		goal.WalletID,
+		goal.PocketID,
+		goal.Name,
+		goal.TargetAmount,
+		goal.TargetDate,
+		goal.RoundUpUnit,
+		goal.DepositPercent,
+		goal.Status,
+		goal.CreateTime,
+		goal.UpdateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertGoal ExecContext", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertGoal Commit", err)
+	}
+
+	return
+}
+
+// querier -> *sql.DB or *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryGoals(ctx context.Context, db querier, query string, args ...interface{}) (goals []Goal, err error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logError(ctx, "queryGoals QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var goal Goal
+		err = rows.Scan(
+			&goal.ID,
+			&goal.WalletID,
+			&goal.PocketID,
+			&goal.Name,
+			&goal.TargetAmount,
+			&goal.TargetDate,
+			&goal.RoundUpUnit,
+			&goal.DepositPercent,
+			&goal.Status,
+			&goal.CreateTime,
+			&goal.UpdateTime,
+			&goal.Saved,
+		)
+		if err != nil {
+			logError(ctx, "queryGoals Scan", err)
+			return
+		}
+
+		goals = append(goals, goal)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getGoals(ctx context.Context, db *sql.DB, walletID string) (goals []Goal, err error) {
+	defer observeQuery("getGoals", time.Now())
+	ctx, span := startQuerySpan(ctx, "getGoals")
+	defer func() {
+		span.end(err)
+	}()
+
+	return queryGoals(ctx, db, getGoalsByWalletIDSQL, walletID)
+}
+
+func getGoal(ctx context.Context, db *sql.DB, goalID, walletID string) (goal Goal, err error) {
+	defer observeQuery("getGoal", time.Now())
+	ctx, span := startQuerySpan(ctx, "getGoal")
+	defer func() {
+		span.end(err)
+	}()
+
+	goals, err := queryGoals(ctx, db, getGoalSQL, goalID, walletID)
+	if err != nil {
+		return
+	}
+
+	if len(goals) == 0 {
+		err = sql.ErrNoRows
+		return
+	}
+	goal = goals[0]
+
+	return
+}
+
+// getGoalByPocketID -> the active goal saving in the pocket
+func getGoalByPocketID(ctx context.Context, db *sql.DB, pocketID string) (goal Goal, err error) {
+	defer observeQuery("getGoalByPocketID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getGoalByPocketID")
+	defer func() {
+		span.end(err)
+	}()
+
+	goals, err := queryGoals(ctx, db, getGoalByPocketIDSQL, pocketID)
+	if err != nil {
+		return
+	}
+
+	if len(goals) == 0 {
+		err = sql.ErrNoRows
+		return
+	}
+	goal = goals[0]
+
+	return
+}
+
+// applyGoalRules -> move the contributions the active goals of the wallet take from entry,
+// in the tx of its transaction. A contribution never takes a goal past its target and is
+// left out when the pocket of entry cannot pay it, the transaction itself always goes on.
+func applyGoalRules(ctx context.Context, tx *sql.Tx, walletID string, entry PocketEntry) (err error) {
+	goals, err := queryGoals(ctx, tx, getGoalsWithRulesSQL, walletID)
+	if err != nil {
+		return
+	}
+
+	// money coming in or going out of a goal does not feed the others
+	for _, goal := range goals {
+		if goal.PocketID == entry.PocketID {
+			return
+		}
+	}
+
+	for _, goal := range goals {
+		rule, amount := goal.contribution(entry)
+		amount = min(amount, goal.TargetAmount-goal.Saved)
+		if amount <= 0 {
+			continue
+		}
+
+		var in PocketEntry
+		_, in, err = movePocketBalanceTx(ctx, tx, entry.PocketID, goal.PocketID, amount, entry.TransactionID)
+		if err == errInsufficientFunds {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, insertGoalContributionSQL, generateUUID(), goal.ID, rule, amount, entry.TransactionID, in.MoveID, in.CreateTime)
+		if err != nil {
+			logError(ctx, "applyGoalRules insert contribution", err)
+			return
+		}
+	}
+
+	return
+}
+
+func updateGoalRules(ctx context.Context, db *sql.DB, goal Goal) (err error) {
+	defer observeQuery("updateGoalRules", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateGoalRules")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, updateGoalRulesSQL, goal.RoundUpUnit, goal.DepositPercent, goal.UpdateTime, goal.ID)
+	if err != nil {
+		logError(ctx, "updateGoalRules ExecContext", err)
+	}
+
+	return
+}
+
+// cancelGoal -> cancel the goal and delete its pocket, what it saved goes to mainID
+func cancelGoal(ctx context.Context, db *sql.DB, goal Goal, mainID string) (err error) {
+	defer observeQuery("cancelGoal", time.Now())
+	ctx, span := startQuerySpan(ctx, "cancelGoal")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "cancelGoal BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var pocketBalance int
+	err = tx.QueryRowContext(ctx, getPocketBalanceSQL, goal.PocketID).Scan(&pocketBalance)
+	if err != nil {
+		logError(ctx, "cancelGoal pocket balance", err)
+		return
+	}
+
+	err = deletePocketTx(ctx, tx, Pocket{ID: goal.PocketID, Balance: pocketBalance}, mainID)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, updateGoalStatusSQL, goalCancelled, goal.UpdateTime, goal.ID)
+	if err != nil {
+		logError(ctx, "cancelGoal ExecContext", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "cancelGoal Commit", err)
+	}
+
+	return
+}
+
+// getPocketGain -> net amount that went into the pocket since
+func getPocketGain(ctx context.Context, db *sql.DB, pocketID string, since time.Time) (gain int, err error) {
+	defer observeQuery("getPocketGain", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPocketGain")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getPocketGainSQL, pocketID, since).Scan(&gain)
+	if err != nil {
+		logError(ctx, "getPocketGain Scan", err)
+	}
+
+	return
+}
+
+func getGoalEntries(ctx context.Context, db *sql.DB, goal Goal, limit int) (entries []GoalEntry, err error) {
+	defer observeQuery("getGoalEntries", time.Now())
+	ctx, span := startQuerySpan(ctx, "getGoalEntries")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getGoalEntriesSQL, goal.ID, goal.PocketID, limit)
+	if err != nil {
+		logError(ctx, "getGoalEntries QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry GoalEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.PocketID,
+			&entry.Kind,
+			&entry.Amount,
+			&entry.Balance,
+			&entry.TransactionID,
+			&entry.MoveID,
+			&entry.OtherPocketID,
+			&entry.ReferenceID,
+			&entry.CreateTime,
+			&entry.Rule,
+		)
+		if err != nil {
+			logError(ctx, "getGoalEntries Scan", err)
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// validateGoalRules -> 0 turns a rule off
+func validateGoalRules(roundUpUnit, depositPercent int, errs validationErrors) {
+	if roundUpUnit == 1 {
+		errs.add("round_up_unit", "Must be 0 to turn round-up off or at least 2.")
+	}
+	if depositPercent > 100 {
+		errs.add("deposit_percent", "Must be between 0 and 100.")
+	}
+}
+
+// goalFromRequest -> a new goal, or the fields that are wrong
+func goalFromRequest(req RequestGoal, now time.Time) (goal Goal, errs validationErrors) {
+	errs = validationErrors{}
+
+	goal = Goal{
+		ID:             generateUUID(),
+		PocketID:       generateUUID(),
+		Name:           strings.TrimSpace(req.Name),
+		TargetAmount:   req.TargetAmount,
+		RoundUpUnit:    req.RoundUpUnit,
+		DepositPercent: req.DepositPercent,
+		Status:         goalActive,
+		CreateTime:     now,
+		UpdateTime:     now,
+	}
+
+	if goal.Name == "" || utf8.RuneCountInString(goal.Name) > maxPocketNameSize || strings.EqualFold(goal.Name, mainPocketAlias) {
+		errs.add("name", "Must be 1 to 50 characters and not main.")
+	}
+
+	targetDate, err := time.Parse(goalDateFormat, req.TargetDate)
+	switch {
+	case err != nil:
+		errs.add("target_date", "Not a valid date, e.g. 2026-12-31.")
+	case !targetDate.After(now.UTC()):
+		errs.add("target_date", "Must be in the future.")
+	}
+	goal.TargetDate = targetDate
+
+	validateGoalRules(goal.RoundUpUnit, goal.DepositPercent, errs)
+
+	return
+}
+
+// goalOf -> a goal of the enabled wallet, errGoalNotFound when it has no such goal
+func goalOf(ctx context.Context, wallet Wallet, goalID string) (goal Goal, err error) {
+	goal, err = getGoal(ctx, database, goalID, wallet.ID)
+	if err == sql.ErrNoRows {
+		err = errGoalNotFound
+	}
+
+	return
+}
+
+// goalProgressOf -> progress of the goal at the pace of its pocket lately
+func goalProgressOf(ctx context.Context, goal Goal, now time.Time) (progress GoalProgress, err error) {
+	if goal.Status != goalActive {
+		return goal.progress(0, now), nil
+	}
+
+	gain, err := getPocketGain(ctx, database, goal.PocketID, now.Add(-goalProjectionWindow))
+	if err != nil {
+		return
+	}
+
+	return goal.progress(gain, now), nil
+}
+
+// CreateGoal -> a new goal of the enabled wallet, with an empty pocket named after it
+func CreateGoal(ctx context.Context, userID string, goal Goal) (created Goal, err error) {
+	ctx = withOperation(ctx, "create_goal")
+	ctx, span := startSpan(ctx, "CreateGoal", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, pockets, err := ListPockets(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	err = checkNewPocket(pockets, goal.Name)
+	if err != nil {
+		return
+	}
+
+	goal.WalletID = wallet.ID
+	err = insertGoal(ctx, database, goal)
+	if err != nil {
+		return
+	}
+	created = goal
+
+	return
+}
+
+// ListGoals -> the goals of the enabled wallet with their progress, active ones first
+func ListGoals(ctx context.Context, userID string) (goals []Goal, progress []GoalProgress, err error) {
+	ctx = withOperation(ctx, "list_goals")
+	ctx, span := startSpan(ctx, "ListGoals", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	goals, err = getGoals(ctx, database, wallet.ID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, goal := range goals {
+		var goalProgress GoalProgress
+		goalProgress, err = goalProgressOf(ctx, goal, now)
+		if err != nil {
+			return
+		}
+
+		progress = append(progress, goalProgress)
+	}
+
+	return
+}
+
+// GetGoal -> a goal of the enabled wallet with its progress
+func GetGoal(ctx context.Context, userID, goalID string) (goal Goal, progress GoalProgress, err error) {
+	ctx = withOperation(ctx, "get_goal")
+	ctx, span := startSpan(ctx, "GetGoal", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	goal, err = goalOf(ctx, wallet, goalID)
+	if err != nil {
+		return
+	}
+
+	progress, err = goalProgressOf(ctx, goal, time.Now())
+	return
+}
+
+// SetGoalRules -> replace the rules of an active goal, 0 turns a rule off
+func SetGoalRules(ctx context.Context, userID, goalID string, roundUpUnit, depositPercent int) (goal Goal, progress GoalProgress, err error) {
+	ctx = withOperation(ctx, "set_goal_rules")
+	ctx, span := startSpan(ctx, "SetGoalRules", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	goal, err = goalOf(ctx, wallet, goalID)
+	if err != nil {
+		return
+	}
+
+	if goal.Status != goalActive {
+		err = errGoalCancelled
+		return
+	}
+
+	goal.RoundUpUnit = roundUpUnit
+	goal.DepositPercent = depositPercent
+	goal.UpdateTime = time.Now()
+
+	err = updateGoalRules(ctx, database, goal)
+	if err != nil {
+		return
+	}
+
+	progress, err = goalProgressOf(ctx, goal, goal.UpdateTime)
+	return
+}
+
+// CancelGoal -> stop a goal for good, what it saved goes back to the main pocket
+func CancelGoal(ctx context.Context, userID, goalID string) (goal Goal, progress GoalProgress, err error) {
+	ctx = withOperation(ctx, "cancel_goal")
+	ctx, span := startSpan(ctx, "CancelGoal", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	goal, err = goalOf(ctx, wallet, goalID)
+	if err != nil {
+		return
+	}
+
+	if goal.Status != goalActive {
+		err = errGoalCancelled
+		return
+	}
+
+	main, err := pocketOf(ctx, wallet, mainPocketAlias)
+	if err != nil {
+		return
+	}
+
+	goal.Status = goalCancelled
+	goal.UpdateTime = time.Now()
+
+	err = cancelGoal(ctx, database, goal, main.ID)
+	if err != nil {
+		return
+	}
+	goal.Saved = 0
+
+	progress = goal.progress(0, goal.UpdateTime)
+	return
+}
+
+// GoalHistory -> latest changes of the pocket of a goal, newest first
+func GoalHistory(ctx context.Context, userID, goalID string, limit int) (goal Goal, entries []GoalEntry, err error) {
+	ctx = withOperation(ctx, "goal_history")
+	ctx, span := startSpan(ctx, "GoalHistory", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	goal, err = goalOf(ctx, wallet, goalID)
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	entries, err = getGoalEntries(ctx, database, goal, limit)
+	return
+}
+
+// HandleCreateGoal -> Start saving up for a goal
+func HandleCreateGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestGoal
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	now := time.Now()
+	goal, errs := goalFromRequest(req, now)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	goal, err := CreateGoal(r.Context(), userIDFromContext(r.Context()), goal)
+	if err == errPocketExists || err == errTooManyPockets {
+		writeValidationError(w, r, &response, validationErrors{"name": {err.Error() + "."}})
+		return
+	}
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseGoal{Goal: goalResponse(goal, goal.progress(0, now))}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListGoals -> View my savings goals and how far they are
+func HandleListGoals(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	goals, progress, err := ListGoals(r.Context(), userIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseGoals{Goals: []ResponseGoalDetail{}}
+	for i, goal := range goals {
+		data.Goals = append(data.Goals, goalResponse(goal, progress[i]))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGetGoal -> View a savings goal with its progress and projected completion
+func HandleGetGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	goal, progress, err := GetGoal(r.Context(), userIDFromContext(r.Context()), ps.ByName("goal_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseGoal{Goal: goalResponse(goal, progress)}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleSetGoalRules -> Change the automatic contributions of a savings goal
+func HandleSetGoalRules(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestGoalRules
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	errs := validationErrors{}
+	validateGoalRules(req.RoundUpUnit, req.DepositPercent, errs)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	goal, progress, err := SetGoalRules(r.Context(), userIDFromContext(r.Context()), ps.ByName("goal_id"), req.RoundUpUnit, req.DepositPercent)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseGoal{Goal: goalResponse(goal, progress)}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleCancelGoal -> Give up a savings goal, what it saved goes back to the main pocket
+func HandleCancelGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	goal, progress, err := CancelGoal(r.Context(), userIDFromContext(r.Context()), ps.ByName("goal_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseGoal{Goal: goalResponse(goal, progress)}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGoalHistory -> View what went in and out of a savings goal, newest first
+func HandleGoalHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListTransactions
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	goal, entries, err := GoalHistory(r.Context(), userIDFromContext(r.Context()), ps.ByName("goal_id"), req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseGoalHistory{
+		GoalID:  goal.ID,
+		History: []ResponseGoalHistoryEntry{},
+	}
+	for _, entry := range entries {
+		data.History = append(data.History, ResponseGoalHistoryEntry{
+			ID:            entry.ID,
+			Type:          entry.Kind,
+			Rule:          entry.Rule,
+			Amount:        entry.SignedAmount(),
+			Balance:       entry.Balance,
+			TransactionID: entry.TransactionID,
+			OtherPocketID: entry.OtherPocketID,
+			ReferenceID:   entry.ReferenceID,
+			CreatedAt:     entry.CreateTime,
+		})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+func goalResponse(goal Goal, progress GoalProgress) ResponseGoalDetail {
+	detail := ResponseGoalDetail{
+		ID:              goal.ID,
+		Name:            goal.Name,
+		PocketID:        goal.PocketID,
+		TargetAmount:    goal.TargetAmount,
+		TargetDate:      goal.TargetDate.Format(goalDateFormat),
+		RoundUpUnit:     goal.RoundUpUnit,
+		DepositPercent:  goal.DepositPercent,
+		Status:          goal.Status,
+		Saved:           progress.Saved,
+		Remaining:       progress.Remaining,
+		ProgressPercent: progress.Percent,
+		Reached:         progress.Reached,
+		OnTrack:         progress.OnTrack,
+		RequiredPerDay:  progress.RequiredPerDay,
+		CreatedAt:       goal.CreateTime,
+		UpdatedAt:       goal.UpdateTime,
+	}
+
+	if !progress.ProjectedDate.IsZero() {
+		detail.ProjectedDate = progress.ProjectedDate.Format(goalDateFormat)
+	}
+
+	return detail
+}
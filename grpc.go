@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azzafirdaus/wallet/walletpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultGRPCAddr = ":9000"
+
+	grpcErrorCodeKey = "error-code"
+	grpcRequestIDKey = "x-request-id"
+	grpcTraceKey     = "traceparent"
+)
+
+// grpcMethodGroups -> rate limit group of every rpc, the same as its http route
+var grpcMethodGroups = map[string]string{
+	walletpb.Wallet_InitAccount_FullMethodName:      rateLimitGroupInit,
+	walletpb.Wallet_EnableWallet_FullMethodName:     rateLimitGroupWallet,
+	walletpb.Wallet_GetBalance_FullMethodName:       rateLimitGroupWallet,
+	walletpb.Wallet_DisableWallet_FullMethodName:    rateLimitGroupWallet,
+	walletpb.Wallet_ListTransactions_FullMethodName: rateLimitGroupWallet,
+	walletpb.Wallet_WatchBalance_FullMethodName:     rateLimitGroupWallet,
+	walletpb.Wallet_Deposit_FullMethodName:          rateLimitGroupTransaction,
+	walletpb.Wallet_Withdraw_FullMethodName:         rateLimitGroupTransaction,
+}
+
+// grpcCodes -> status code of every error code, the grpc counterpart of errorStatus
+var grpcCodes = map[errorCode]codes.Code{
+	codeInvalidInput:          codes.InvalidArgument,
+	codeUnsupportedMediaType:  codes.InvalidArgument,
+	codeUnauthorized:          codes.Unauthenticated,
+	codeNotFound:              codes.NotFound,
+	codeAccountExists:         codes.AlreadyExists,
+	codeWalletDisabled:        codes.FailedPrecondition,
+	codeWalletAlreadyEnabled:  codes.FailedPrecondition,
+	codeWalletAlreadyDisabled: codes.FailedPrecondition,
+	codeInsufficientFunds:     codes.FailedPrecondition,
+	codeDuplicateReference:    codes.AlreadyExists,
+	codeLimitExceeded:         codes.ResourceExhausted,
+	codeIdempotencyKeyReused:  codes.InvalidArgument,
+	codeIdempotencyInProgress: codes.Aborted,
+	codeSlowConsumer:          codes.ResourceExhausted,
+	codeInternal:              codes.Internal,
+}
+
+// serveGRPC -> GRPC_ADDR (default ":9000") serves the walletpb.Wallet service
+func serveGRPC(ctx context.Context) {
+	addr := os.Getenv("GRPC_ADDR")
+	if addr == "" {
+		addr = defaultGRPCAddr
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logFatal(ctx, "serveGRPC Listen", err)
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcUnaryInterceptor),
+		grpc.StreamInterceptor(grpcStreamInterceptor),
+	)
+	walletpb.RegisterWalletServer(server, &walletServer{})
+
+	logInfo(ctx, "starting wallet grpc service at "+addr)
+	logFatal(ctx, "serveGRPC Serve", server.Serve(listener))
+}
+
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	ctx, span := grpcStart(ctx, info.FullMethod)
+	defer func() {
+		span.setAttribute("rpc.grpc.status_code", int(status.Code(err)))
+		span.end(grpcSpanError(err))
+	}()
+
+	ctx, err = grpcAuthorize(ctx, info.FullMethod)
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+
+	return resp, grpcError(ctx, err)
+}
+
+func grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, span := grpcStart(ss.Context(), info.FullMethod)
+	defer func() {
+		span.setAttribute("rpc.grpc.status_code", int(status.Code(err)))
+		span.end(grpcSpanError(err))
+	}()
+
+	ctx, err = grpcAuthorize(ctx, info.FullMethod)
+	if err == nil {
+		err = handler(srv, &grpcServerStream{ServerStream: ss, ctx: ctx})
+	}
+
+	return grpcError(ctx, err)
+}
+
+// grpcServerStream -> a stream carrying the authorized context
+type grpcServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcStart -> request id and server span of a call, the grpc side of RequestID and Trace
+func grpcStart(ctx context.Context, fullMethod string) (context.Context, *span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := firstMetadata(md, grpcRequestIDKey)
+	if !validRequestID(requestID) {
+		requestID = generateUUID()
+	}
+	ctx = withRequestID(ctx, requestID)
+	grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, requestID))
+
+	if parent, ok := spanFromTraceparent(firstMetadata(md, grpcTraceKey)); ok {
+		ctx = context.WithValue(ctx, spanKey, parent)
+	}
+
+	ctx, s := startSpan(ctx, fullMethod, spanKindServer)
+	s.setAttribute("rpc.system", "grpc")
+	s.setAttribute("rpc.method", fullMethod)
+
+	return ctx, s
+}
+
+// grpcAuthorize -> the auth rate limit by ip, the session token from "authorization: Token
+// <token>" metadata, then the rate limit of the method
+func grpcAuthorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+
+	if fullMethod != walletpb.Wallet_InitAccount_FullMethodName {
+		err := grpcRateLimit(ctx, rateLimitGroupAuth, ip)
+		if err != nil {
+			return ctx, err
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		sessionID := getSessionByToken(firstMetadata(md, "authorization"))
+		userID, ok := checkSession(ctx, sessionID)
+		if !ok {
+			return ctx, errUnauthorized
+		}
+		ctx = withUserID(ctx, userID)
+	}
+
+	group, ok := grpcMethodGroups[fullMethod]
+	if !ok {
+		return ctx, nil
+	}
+
+	return ctx, grpcRateLimit(ctx, group, ip)
+}
+
+// grpcRateLimit -> spend a token of the group bucket of the user of ctx, or of ip when there
+// is none, errLimitExceeded with a retry-after trailer when it is empty
+func grpcRateLimit(ctx context.Context, group, ip string) error {
+	policy, result, err := limiter.take(ctx, group, userIDFromContext(ctx), ip)
+	if err != nil {
+		// fail open like the http middleware
+		logError(ctx, "grpcRateLimit take", err)
+		return nil
+	}
+
+	if !result.Allowed {
+		grpc.SetTrailer(ctx, metadata.Pairs("retry-after", fmt.Sprint(ceilSeconds(result.RetryAfter))))
+		logDebug(ctx, "grpc rate limited", "group", group, "burst", policy.Burst)
+		return errLimitExceeded
+	}
+
+	return nil
+}
+
+// grpcError -> status error for err, with the domain error code and request id in the trailer
+func grpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	body := newResponseError(ctx, err)
+	grpc.SetTrailer(ctx, metadata.Pairs(
+		grpcErrorCodeKey, body.Code,
+		grpcRequestIDKey, body.RequestID,
+	))
+
+	code, ok := grpcCodes[errorCode(body.Code)]
+	if !ok {
+		code = codes.Internal
+	}
+
+	return status.Error(code, body.Error)
+}
+
+// grpcSpanError -> like Trace, only server failures fail the span
+func grpcSpanError(err error) error {
+	switch status.Code(err) {
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		return err
+	}
+
+	return nil
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// invalidInput -> field level errors as one INVALID_INPUT error, "field: message; ..."
+func invalidInput(errs validationErrors) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var fields []string
+	for field, messages := range errs {
+		fields = append(fields, field+": "+strings.Join(messages, " "))
+	}
+	sort.Strings(fields)
+
+	return &Error{Code: codeInvalidInput, Message: strings.Join(fields, "; ")}
+}
+
+// walletServer -> walletpb.Wallet on top of the same usecases as the http handlers
+type walletServer struct {
+	walletpb.UnimplementedWalletServer
+}
+
+func (s *walletServer) InitAccount(ctx context.Context, req *walletpb.InitAccountRequest) (*walletpb.InitAccountResponse, error) {
+	errs := validationErrors{}
+	if req.GetCustomerXid() == "" {
+		errs.add("customer_xid", msgRequired)
+	}
+	if err := invalidInput(errs); err != nil {
+		return nil, err
+	}
+
+	token, err := InitAccount(ctx, req.GetCustomerXid())
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.InitAccountResponse{Token: token}, nil
+}
+
+func (s *walletServer) EnableWallet(ctx context.Context, req *walletpb.EnableWalletRequest) (*walletpb.WalletResponse, error) {
+	wallet, err := EnableWallet(ctx, userIDFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.WalletResponse{Wallet: toWalletDetail(wallet)}, nil
+}
+
+func (s *walletServer) GetBalance(ctx context.Context, req *walletpb.GetBalanceRequest) (*walletpb.WalletResponse, error) {
+	wallet, _, _, err := ViewBalance(ctx, userIDFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.WalletResponse{Wallet: toWalletDetail(wallet)}, nil
+}
+
+func (s *walletServer) DisableWallet(ctx context.Context, req *walletpb.DisableWalletRequest) (*walletpb.WalletResponse, error) {
+	wallet, err := DisableWallet(ctx, userIDFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.WalletResponse{Wallet: toWalletDetail(wallet)}, nil
+}
+
+func (s *walletServer) Deposit(ctx context.Context, req *walletpb.BalanceChangeRequest) (*walletpb.TransactionResponse, error) {
+	if err := validateBalanceChange(req); err != nil {
+		observeWalletFailure("deposit", "invalid_input")
+		return nil, err
+	}
+
+	tx, err := Deposit(ctx, userIDFromContext(ctx), req.GetReferenceId(), int(req.GetAmount()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.TransactionResponse{Transaction: toTransaction(tx)}, nil
+}
+
+func (s *walletServer) Withdraw(ctx context.Context, req *walletpb.BalanceChangeRequest) (*walletpb.TransactionResponse, error) {
+	if err := validateBalanceChange(req); err != nil {
+		observeWalletFailure("withdrawal", "invalid_input")
+		return nil, err
+	}
+
+	tx, err := Withdrawal(ctx, userIDFromContext(ctx), req.GetReferenceId(), int(req.GetAmount()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletpb.TransactionResponse{Transaction: toTransaction(tx)}, nil
+}
+
+func (s *walletServer) ListTransactions(ctx context.Context, req *walletpb.ListTransactionsRequest) (*walletpb.ListTransactionsResponse, error) {
+	errs := validationErrors{}
+	if req.GetLimit() < 0 {
+		errs.add("limit", fmt.Sprintf(msgMinimum, "1"))
+	}
+	if err := invalidInput(errs); err != nil {
+		return nil, err
+	}
+
+	transactions, err := ListTransactions(ctx, userIDFromContext(ctx), int(req.GetLimit()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &walletpb.ListTransactionsResponse{}
+	for _, tx := range transactions {
+		resp.Transactions = append(resp.Transactions, toTransaction(tx))
+	}
+
+	return resp, nil
+}
+
+// WatchBalance -> stream the wallet events of the caller until it goes away or falls behind
+func (s *walletServer) WatchBalance(req *walletpb.WatchBalanceRequest, stream walletpb.Wallet_WatchBalanceServer) error {
+	ctx := stream.Context()
+
+	sub := walletEvents.subscribe(userTopic(userIDFromContext(ctx)))
+	defer walletEvents.unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.C:
+			if !ok {
+				if walletEvents.isLagged(sub) {
+					return errSlowConsumer
+				}
+				return nil
+			}
+
+			err := stream.Send(toWalletEvent(event))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func validateBalanceChange(req *walletpb.BalanceChangeRequest) error {
+	errs := validationErrors{}
+	if req.GetAmount() < 0 {
+		errs.add("amount", fmt.Sprintf(msgMinimum, "0"))
+	}
+	if req.GetReferenceId() == "" {
+		errs.add("reference_id", msgRequired)
+	}
+
+	return invalidInput(errs)
+}
+
+func toWalletDetail(wallet Wallet) *walletpb.WalletDetail {
+	detail := &walletpb.WalletDetail{
+		Id:      wallet.ID,
+		OwnedBy: wallet.UserID,
+		Balance: int64(wallet.Balance),
+	}
+
+	if wallet.Status == statusActive {
+		detail.Status = "enabled"
+		detail.EnabledAt = toTimestamp(wallet.EnableTime)
+	} else {
+		detail.Status = "disabled"
+		detail.DisabledAt = toTimestamp(wallet.EnableTime)
+	}
+
+	return detail
+}
+
+func toTransaction(tx WalletTransaction) *walletpb.Transaction {
+	return &walletpb.Transaction{
+		Id:          tx.ID,
+		WalletId:    tx.WalletID,
+		Type:        tx.TypeName(),
+		Amount:      int64(tx.Amount),
+		ReferenceId: tx.ReferenceID,
+		CreatedAt:   toTimestamp(tx.CreateTime),
+	}
+}
+
+func toWalletEvent(event walletEvent) *walletpb.WalletEvent {
+	pb := &walletpb.WalletEvent{
+		Type:     event.Type,
+		WalletId: event.WalletID,
+		Status:   "disabled",
+		Balance:  int64(event.Balance),
+		Time:     toTimestamp(event.Time),
+	}
+
+	if event.Status == statusActive {
+		pb.Status = "enabled"
+	}
+	if event.Transaction != nil {
+		pb.Transaction = toTransaction(*event.Transaction)
+	}
+
+	return pb
+}
+
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -20,25 +20,20 @@ func HandleInitSession(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		json.NewEncoder(w).Encode(response)
 	}()
 
-	xid := r.FormValue("customer_xid")
-	if xid == "" {
-		response.Status = statusFail
-		response.Data = ResponseInitAccount{
-			Error: &ResponseInitAccountError{
-				CustomerXID: []string{"Missing data for required field."},
-			}}
-		w.WriteHeader(http.StatusBadRequest)
+	var req RequestInitAccount
+	if !bindRequest(w, r, &req, &response) {
 		return
 	}
 
-	sID, err := InitAccount(xid)
+	// merchants are users of their own, see merchantUserPrefix
+	if strings.HasPrefix(req.CustomerXID, merchantUserPrefix) {
+		writeValidationError(w, r, &response, validationErrors{"customer_xid": {"Must not start with " + merchantUserPrefix + "."}})
+		return
+	}
+
+	sID, err := InitAccount(r.Context(), req.CustomerXID)
 	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseInitAccount{
-			Error: &ResponseInitAccountError{
-				CustomerXID: []string{err.Error()},
-			}}
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, &response, err)
 		return
 	}
 
@@ -58,24 +53,11 @@ func HandleEnableWallet(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		json.NewEncoder(w).Encode(response)
 	}()
 
-	uID := r.FormValue("user_id")
+	uID := userIDFromContext(r.Context())
 
-	status, wallet, err := EnableWallet(uID)
+	wallet, err := EnableWallet(r.Context(), uID)
 	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: err.Error(),
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	if !status {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "Already enabled",
-		}
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, &response, err)
 		return
 	}
 
@@ -101,24 +83,11 @@ func HandleViewBalance(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		json.NewEncoder(w).Encode(response)
 	}()
 
-	uID := r.FormValue("user_id")
+	uID := userIDFromContext(r.Context())
 
-	status, wallet, err := ViewBalance(uID)
+	wallet, pockets, buckets, err := ViewBalance(r.Context(), uID)
 	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: err.Error(),
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	if !status {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "Disabled",
-		}
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, &response, err)
 		return
 	}
 
@@ -129,6 +98,8 @@ func HandleViewBalance(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 			Status:    "enabled",
 			EnabledAt: &wallet.EnableTime,
 			Balance:   wallet.Balance,
+			Pockets:   pocketsResponse(pockets),
+			Buckets:   bucketsResponse(wallet.Balance, buckets),
 		},
 	}
 	w.WriteHeader(http.StatusOK)
@@ -144,43 +115,17 @@ func HandleDeposits(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		json.NewEncoder(w).Encode(response)
 	}()
 
-	uID := r.FormValue("user_id")
-	referenceID := r.FormValue("reference_id")
-	amount, err := strconv.Atoi(r.FormValue("amount"))
-	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "error read amount: " + err.Error(),
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+	uID := userIDFromContext(r.Context())
 
-	if referenceID == "" || amount < 0 {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "incorrect input",
-		}
-		w.WriteHeader(http.StatusBadRequest)
+	var req RequestBalanceChange
+	if !bindRequest(w, r, &req, &response) {
+		observeWalletFailure("deposit", "invalid_input")
 		return
 	}
 
-	status, tx, err := Deposit(uID, referenceID, amount)
+	tx, err := DepositToPocket(r.Context(), uID, req.PocketID, req.ReferenceID, req.Amount)
 	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: err.Error(),
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	if !status {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "Wallet disabled",
-		}
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, &response, err)
 		return
 	}
 
@@ -191,6 +136,7 @@ func HandleDeposits(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 			Status:      statusSuccess,
 			DepositedAt: tx.CreateTime,
 			Amount:      tx.Amount,
+			ReferenceID: tx.ReferenceID,
 		},
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -206,53 +152,36 @@ func HandleWithdrawal(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		json.NewEncoder(w).Encode(response)
 	}()
 
-	uID := r.FormValue("user_id")
-	referenceID := r.FormValue("reference_id")
-	amount, err := strconv.Atoi(r.FormValue("amount"))
-	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "error read amount: " + err.Error(),
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+	uID := userIDFromContext(r.Context())
 
-	if referenceID == "" || amount < 0 {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "incorrect input",
-		}
-		w.WriteHeader(http.StatusBadRequest)
+	var req RequestWithdrawal
+	if !bindRequest(w, r, &req, &response) {
+		observeWalletFailure("withdrawal", "invalid_input")
 		return
 	}
 
-	status, tx, err := Withdrawal(uID, referenceID, amount)
-	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: err.Error(),
-		}
-		w.WriteHeader(http.StatusInternalServerError)
+	if !validMerchantCategory(req.MerchantCategory) {
+		observeWalletFailure("withdrawal", "invalid_input")
+		writeValidationError(w, r, &response, validationErrors{"merchant_category": {msgMerchantCategory}})
 		return
 	}
 
-	if !status {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "Wallet disabled",
-		}
-		w.WriteHeader(http.StatusBadRequest)
+	tx, charge, err := WithdrawFromPocket(r.Context(), uID, req.PocketID, req.ReferenceID, req.MerchantCategory, req.Amount)
+	if err != nil {
+		writeError(w, r, &response, err)
 		return
 	}
 
 	response.Data = ResponseWithdrawal{
 		Withdrawal: ResponseWithdrawalDetail{
-			ID:          tx.ID,
-			WithdrawnBy: uID,
-			Status:      statusSuccess,
-			WithdrawnAt: tx.CreateTime,
-			Amount:      tx.Amount,
+			ID:               tx.ID,
+			WithdrawnBy:      uID,
+			Status:           statusSuccess,
+			WithdrawnAt:      tx.CreateTime,
+			Amount:           tx.Amount,
+			ReferenceID:      tx.ReferenceID,
+			Fee:              charge.Amount,
+			FeeTransactionID: charge.FeeTransactionID,
 		},
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -268,24 +197,11 @@ func HandleDisableWallet(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		json.NewEncoder(w).Encode(response)
 	}()
 
-	uID := r.FormValue("user_id")
+	uID := userIDFromContext(r.Context())
 
-	status, wallet, err := DisableWallet(uID)
+	wallet, err := DisableWallet(r.Context(), uID)
 	if err != nil {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: err.Error(),
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	if !status {
-		response.Status = statusFail
-		response.Data = ResponseError{
-			Error: "Already disabled",
-		}
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, &response, err)
 		return
 	}
 
@@ -300,3 +216,43 @@ func HandleDisableWallet(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	}
 	w.WriteHeader(http.StatusCreated)
 }
+
+// HandleListTransactions -> View my wallet transactions
+func HandleListTransactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	var req RequestListTransactions
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	transactions, err := ListTransactions(r.Context(), uID, req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseTransactions{
+		Transactions: []ResponseTransactionDetail{},
+	}
+	for _, tx := range transactions {
+		data.Transactions = append(data.Transactions, ResponseTransactionDetail{
+			ID:          tx.ID,
+			Type:        tx.TypeName(),
+			Amount:      tx.Amount,
+			ReferenceID: tx.ReferenceID,
+			CreatedAt:   tx.CreateTime,
+		})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyKeyRetention   = 24 * time.Hour
+	msgIdempotencyKeyTooLong  = "Longer than maximum length 255."
+	idempotencyStatusInFlight = 0
+)
+
+// IdempotencyRecord -> stored outcome of a request sent with an Idempotency-Key.
+// Status stays 0 while the first request is still running.
+type IdempotencyRecord struct {
+	Scope       string    `db:"scope"`
+	Key         string    `db:"key"`
+	Fingerprint string    `db:"fingerprint"`
+	Status      int       `db:"status"`
+	ContentType string    `db:"content_type"`
+	Body        []byte    `db:"body"`
+	CreateTime  time.Time `db:"created_at"`
+}
+
+// Idempotent -> replay the stored response when a request is retried with the same Idempotency-Key.
+// Keys are scoped to the user behind Middleware, a key reused with another body is rejected.
+// Routes without a user, like /api/v1/init, scope them by the client address.
+// Server errors are not stored so the retry runs the handler again.
+func Idempotent(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r, ps)
+			return
+		}
+
+		ctx := r.Context()
+
+		if len(key) > maxIdempotencyKeyLength {
+			w.Header().Set("Content-Type", "application/json")
+
+			response := Response{}
+			writeValidationError(w, r, &response, validationErrors{idempotencyKeyHeader: {msgIdempotencyKeyTooLong}})
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+		if err != nil {
+			logError(ctx, "Idempotent ReadAll", err)
+			abortError(w, r, err)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		record := IdempotencyRecord{
+			Scope:       idempotencyScope(r),
+			Key:         key,
+			Fingerprint: requestFingerprint(r, body),
+			CreateTime:  time.Now(),
+		}
+
+		stored, claimed, err := claimIdempotencyKey(ctx, database, record)
+		if err != nil {
+			abortError(w, r, err)
+			return
+		}
+
+		if !claimed {
+			replayIdempotent(w, r, record, stored)
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r, ps)
+
+		if recorder.status >= http.StatusInternalServerError {
+			err = deleteIdempotencyKey(ctx, database, record.Scope, record.Key)
+			if err != nil {
+				logError(ctx, "Idempotent deleteIdempotencyKey", err)
+			}
+			return
+		}
+
+		record.Status = recorder.status
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.Body = recorder.body.Bytes()
+
+		err = completeIdempotencyKey(ctx, database, record)
+		if err != nil {
+			logError(ctx, "Idempotent completeIdempotencyKey", err)
+		}
+	}
+}
+
+func replayIdempotent(w http.ResponseWriter, r *http.Request, record, stored IdempotencyRecord) {
+	switch {
+	case stored.Fingerprint != record.Fingerprint:
+		abortError(w, r, errIdempotencyKeyReused)
+	case stored.Status == idempotencyStatusInFlight:
+		abortError(w, r, errIdempotencyInProgress)
+	default:
+		logInfo(r.Context(), "replaying idempotent response", "idempotency_key", record.Key, "code", stored.Status)
+
+		w.Header().Set("Content-Type", stored.ContentType)
+		w.Header().Set(idempotentReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// idempotencyScope -> the user of the request, or the client address of an anonymous one, so
+// anonymous callers never replay the response of another client
+func idempotencyScope(r *http.Request) string {
+	if userID := userIDFromContext(r.Context()); userID != "" {
+		return userID
+	}
+
+	return "anonymous:" + clientIP(r)
+}
+
+// requestFingerprint -> what makes two requests with one key the same request
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	io.WriteString(h, r.Header.Get("Content-Type")+"\n")
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+const (
+	createIdempotencyKeyTable = `
+		CREATE TABLE IF NOT EXISTS idempotency_key (
+			scope TEXT NOT NULL,
+			key TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			content_type TEXT NOT NULL,
+			body BLOB,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (scope, key)
+		);
+	`
+
+	getIdempotencyKeySQL = `
+		SELECT
+			fingerprint,
+			status,
+			content_type,
+			body,
+			created_at
+		FROM
+			idempotency_key
+		WHERE
+			scope = $1 AND
+			key = $2
+	`
+
+	insertIdempotencyKeySQL = `
+		INSERT INTO idempotency_key
+			(scope, key, fingerprint, status, content_type, created_at)
+		VALUES
+			(?,?,?,?,?,?)
+		;
+	`
+
+	completeIdempotencyKeySQL = `
+		UPDATE
+			idempotency_key
+		SET
+			status = $1,
+			content_type = $2,
+			body = $3
+		WHERE
+			scope = $4 AND
+			key = $5
+	`
+
+	deleteIdempotencyKeySQL = `
+		DELETE FROM
+			idempotency_key
+		WHERE
+			scope = $1 AND
+			key = $2
+	`
+)
+
+// claimIdempotencyKey -> insert record as in flight, or return the stored one when the key is taken.
+// Records past idempotencyKeyRetention are dropped and the key is claimed again.
+func claimIdempotencyKey(ctx context.Context, db *sql.DB, record IdempotencyRecord) (stored IdempotencyRecord, claimed bool, err error) {
+	defer observeQuery("claimIdempotencyKey", time.Now())
+	ctx, span := startQuerySpan(ctx, "claimIdempotencyKey")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "claimIdempotencyKey BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, getIdempotencyKeySQL, record.Scope, record.Key).Scan(
+		&stored.Fingerprint,
+		&stored.Status,
+		&stored.ContentType,
+		&stored.Body,
+		&stored.CreateTime,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "claimIdempotencyKey QueryRowContext", err)
+		return
+	}
+
+	if err == nil {
+		if record.CreateTime.Sub(stored.CreateTime) < idempotencyKeyRetention {
+			return
+		}
+
+		_, err = tx.ExecContext(ctx, deleteIdempotencyKeySQL, record.Scope, record.Key)
+		if err != nil {
+			logError(ctx, "claimIdempotencyKey delete ExecContext", err)
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertIdempotencyKeySQL,
+		record.Scope,
+		record.Key,
+		record.Fingerprint,
+		idempotencyStatusInFlight,
+		"",
+		record.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "claimIdempotencyKey insert ExecContext", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "claimIdempotencyKey Commit", err)
+		return
+	}
+	claimed = true
+
+	return
+}
+
+func completeIdempotencyKey(ctx context.Context, db *sql.DB, record IdempotencyRecord) (err error) {
+	defer observeQuery("completeIdempotencyKey", time.Now())
+	ctx, span := startQuerySpan(ctx, "completeIdempotencyKey")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		completeIdempotencyKeySQL,
+		record.Status,
+		record.ContentType,
+		record.Body,
+		record.Scope,
+		record.Key,
+	)
+	if err != nil {
+		logError(ctx, "completeIdempotencyKey ExecContext", err)
+	}
+
+	return
+}
+
+func deleteIdempotencyKey(ctx context.Context, db *sql.DB, scope, key string) (err error) {
+	defer observeQuery("deleteIdempotencyKey", time.Now())
+	ctx, span := startQuerySpan(ctx, "deleteIdempotencyKey")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, deleteIdempotencyKeySQL, scope, key)
+	if err != nil {
+		logError(ctx, "deleteIdempotencyKey ExecContext", err)
+	}
+
+	return
+}
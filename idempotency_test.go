@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestAnonymousIdempotencyKey -> /api/v1/init keys replay the same body and reject another one
+func TestAnonymousIdempotencyKey(t *testing.T) {
+	key := "init-" + generateUUID()
+
+	initAccount := func(customerXID string) (resp *http.Response, code string) {
+		t.Helper()
+
+		form := url.Values{"customer_xid": {customerXID}}
+		req, err := http.NewRequest("POST", testServer.URL+"/api/v1/init", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentTypeForm)
+		req.Header.Set(idempotencyKeyHeader, key)
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var body struct {
+			Data struct {
+				Code string `json:"code"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+
+		return resp, body.Data.Code
+	}
+
+	first := "idempotent-" + generateUUID()
+	resp, _ := initAccount(first)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("first init: status %d", resp.StatusCode)
+	}
+
+	resp, _ = initAccount(first)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("retried init: status %d, replayed %q", resp.StatusCode, resp.Header.Get(idempotentReplayedHeader))
+	}
+
+	resp, code := initAccount("idempotent-" + generateUUID())
+	if resp.StatusCode != http.StatusUnprocessableEntity || code != string(codeIdempotencyKeyReused) {
+		t.Errorf("init with another body: status %d, code %q", resp.StatusCode, code)
+	}
+}
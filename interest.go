@@ -0,0 +1,1268 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Interest accrues every day on the end of day balance of each wallet, rebuilt from
+// wallet_transaction, at the rate plan in effect that day. Accruals are kept apart from the
+// wallet, in millionths of the smallest unit, and posted once a month as an interest
+// transaction. Posting is cumulative: a month posts what was accrued up to its end minus what
+// was posted before, so a backdated rate change is settled by the next posting, and interest
+// that turns out to be too high is held back from later postings instead of taken back.
+
+const (
+	dayCountActual365    = "act/365"
+	dayCountActual360    = "act/360"
+	dayCountActualActual = "act/act"
+
+	// roundHalfUp, roundHalfEven -> to the nearest, halves away from zero or to even
+	roundHalfUp   = "half_up"
+	roundHalfEven = "half_even"
+	// roundDown, roundUp -> toward or away from zero
+	roundDown = "down"
+	roundUp   = "up"
+
+	interestDayLayout = "2006-01-02"
+
+	interestReferencePrefix = "interest:"
+
+	// interestMicro -> accruals are kept in millionths of the smallest unit
+	interestMicro = 1000000
+
+	// maxInterestRate -> 100% a year, in basis points
+	maxInterestRate = 10000
+
+	// interestJobDelay -> wait after midnight so transactions still in flight are committed
+	interestJobDelay = time.Minute
+
+	interestPostingsLimit = 12
+	interestAccrualsLimit = 31
+)
+
+var (
+	interestDayCounts = []string{dayCountActual365, dayCountActual360, dayCountActualActual}
+	interestRoundings = []string{roundHalfUp, roundHalfEven, roundDown, roundUp}
+)
+
+// RateTier -> RateBps on the part of an amount from From up to the next tier
+type RateTier struct {
+	From    int
+	RateBps int
+}
+
+// InterestPlan -> the rates from EffectiveFrom until the next plan
+type InterestPlan struct {
+	EffectiveFrom string    `db:"effective_from"`
+	Tiers         string    `db:"tiers"`
+	DayCount      string    `db:"day_count"`
+	Rounding      string    `db:"rounding"`
+	CreateTime    time.Time `db:"create_time"`
+
+	tiers []RateTier
+}
+
+// InterestAccrual -> interest of one wallet for one day
+type InterestAccrual struct {
+	WalletID string `db:"wallet_id"`
+	Day      string `db:"day"`
+	Balance  int    `db:"balance"`
+	RateFrom string `db:"rate_from"`
+	Micro    int64  `db:"micro"`
+}
+
+// InterestPosting -> interest of one wallet for one month, credited as TransactionID
+type InterestPosting struct {
+	WalletID      string    `db:"wallet_id"`
+	Month         string    `db:"month"`
+	Amount        int       `db:"amount"`
+	DueMicro      int64     `db:"due_micro"`
+	TransactionID string    `db:"transaction_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// interestState -> days accrued so far, and where a recalculation has to start
+type interestState struct {
+	AccruedThrough  string `db:"accrued_through"`
+	RecalculateFrom string `db:"recalculate_from"`
+}
+
+// InterestRun -> what one run of the engine did
+type InterestRun struct {
+	From     string
+	Through  string
+	Accruals int
+	Postings int
+	Posted   int
+}
+
+// parseRateTiers -> tiers from "from:rate_bps,...", e.g. "0:200,1000000:100"
+func parseRateTiers(s string) (tiers []RateTier, err error) {
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("%q is not from:rate_bps", part)
+		}
+
+		var tier RateTier
+		tier.From, err = strconv.Atoi(bounds[0])
+		if err == nil {
+			tier.RateBps, err = strconv.Atoi(bounds[1])
+		}
+		if err != nil || tier.From < 0 || tier.RateBps < 0 || tier.RateBps > maxInterestRate {
+			return nil, fmt.Errorf("%q needs a balance of at least 0 and a rate of 0 to %d", part, maxInterestRate)
+		}
+
+		if len(tiers) == 0 && tier.From != 0 {
+			return nil, fmt.Errorf("the first tier must start at 0")
+		}
+		if len(tiers) > 0 && tier.From <= tiers[len(tiers)-1].From {
+			return nil, fmt.Errorf("tiers must start at increasing balances")
+		}
+
+		tiers = append(tiers, tier)
+	}
+
+	return
+}
+
+func (p *InterestPlan) parse() (err error) {
+	p.tiers, err = parseRateTiers(p.Tiers)
+	return
+}
+
+// yearDays -> the days of the year of day under the day count convention
+func (p InterestPlan) yearDays(day time.Time) int64 {
+	switch p.DayCount {
+	case dayCountActual360:
+		return 360
+	case dayCountActualActual:
+		return int64(time.Date(day.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC).Sub(time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+	}
+
+	return 365
+}
+
+// tieredBps -> amount times the rates of its tiers, in basis points
+func tieredBps(tiers []RateTier, amount int) *big.Int {
+	total := new(big.Int)
+	for i, tier := range tiers {
+		upper := amount
+		if i+1 < len(tiers) {
+			upper = min(amount, tiers[i+1].From)
+		}
+		if upper <= tier.From {
+			break
+		}
+
+		portion := big.NewInt(int64(upper - tier.From))
+		total.Add(total, portion.Mul(portion, big.NewInt(int64(tier.RateBps))))
+	}
+
+	return total
+}
+
+// dailyMicro -> interest of one day on balance, in millionths
+func (p InterestPlan) dailyMicro(balance int, day time.Time) int64 {
+	yearly := tieredBps(p.tiers, balance)
+	yearly.Mul(yearly, big.NewInt(interestMicro))
+	return roundDiv(yearly, big.NewInt(maxInterestRate*p.yearDays(day)), p.Rounding)
+}
+
+// roundDiv -> num / den rounded with mode, den is positive
+func roundDiv(num, den *big.Int, mode string) int64 {
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient.Int64()
+	}
+
+	away := false
+	switch mode {
+	case roundUp:
+		away = true
+	case roundHalfUp, roundHalfEven:
+		twice := new(big.Int).Abs(remainder)
+		switch twice.Lsh(twice, 1).Cmp(den) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == roundHalfUp || quotient.Bit(0) == 1
+		}
+	}
+
+	if away {
+		quotient.Add(quotient, big.NewInt(int64(num.Sign())))
+	}
+
+	return quotient.Int64()
+}
+
+// planOn -> the plan in effect on day, plans are sorted by EffectiveFrom
+func planOn(plans []InterestPlan, day string) (plan InterestPlan, ok bool) {
+	i := sort.Search(len(plans), func(i int) bool { return plans[i].EffectiveFrom > day })
+	if i == 0 {
+		return
+	}
+
+	return plans[i-1], true
+}
+
+// interestDay -> midnight UTC of the day of t
+func interestDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// formatMicro -> millionths as a decimal, e.g. 1234567 is "1.234567"
+func formatMicro(micro int64) string {
+	sign := ""
+	if micro < 0 {
+		sign, micro = "-", -micro
+	}
+
+	return fmt.Sprintf("%s%d.%06d", sign, micro/interestMicro, micro%interestMicro)
+}
+
+const (
+	createInterestRateTable = `
+		CREATE TABLE IF NOT EXISTS interest_rate (
+			effective_from TEXT NOT NULL PRIMARY KEY,
+			tiers TEXT NOT NULL,
+			day_count TEXT NOT NULL,
+			rounding TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	createInterestAccrualTable = `
+		CREATE TABLE IF NOT EXISTS interest_accrual (
+			wallet_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			balance INTEGER NOT NULL,
+			rate_from TEXT NOT NULL,
+			micro INTEGER NOT NULL,
+			PRIMARY KEY (wallet_id, day)
+		);
+	`
+
+	createInterestPostingTable = `
+		CREATE TABLE IF NOT EXISTS interest_posting (
+			wallet_id TEXT NOT NULL,
+			month TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			due_micro INTEGER NOT NULL,
+			transaction_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			PRIMARY KEY (wallet_id, month)
+		);
+	`
+
+	createInterestStateTable = `
+		CREATE TABLE IF NOT EXISTS interest_state (
+			id INTEGER NOT NULL PRIMARY KEY CHECK (id = 1),
+			accrued_through TEXT NOT NULL,
+			recalculate_from TEXT NOT NULL
+		);
+	`
+
+	upsertInterestRateSQL = `
+		INSERT INTO interest_rate
+			(effective_from, tiers, day_count, rounding, create_time)
+		VALUES
+			(?,?,?,?,?)
+		ON CONFLICT (effective_from) DO UPDATE SET
+			tiers = excluded.tiers,
+			day_count = excluded.day_count,
+			rounding = excluded.rounding,
+			create_time = excluded.create_time
+		;
+	`
+
+	getInterestRatesSQL = `
+		SELECT
+			effective_from,
+			tiers,
+			day_count,
+			rounding,
+			create_time
+		FROM
+			interest_rate
+		ORDER BY
+			effective_from
+	`
+
+	getInterestStateSQL = `
+		SELECT
+			accrued_through,
+			recalculate_from
+		FROM
+			interest_state
+		WHERE
+			id = 1
+	`
+
+	upsertInterestStateSQL = `
+		INSERT INTO interest_state
+			(id, accrued_through, recalculate_from)
+		VALUES
+			(1,?,?)
+		ON CONFLICT (id) DO UPDATE SET
+			accrued_through = excluded.accrued_through,
+			recalculate_from = excluded.recalculate_from
+		;
+	`
+
+	deleteInterestAccrualsSQL = `
+		DELETE FROM
+			interest_accrual
+		WHERE
+			day >= $1 AND
+			day <= $2
+	`
+
+	insertInterestAccrualSQL = `
+		INSERT INTO interest_accrual
+			(wallet_id, day, balance, rate_from, micro)
+		VALUES
+			(?,?,?,?,?)
+		;
+	`
+
+	// getInterestMonthTotalsSQL -> accrued per wallet and month up to $1, in order
+	getInterestMonthTotalsSQL = `
+		SELECT
+			wallet_id,
+			substr(day, 1, 7) AS month,
+			SUM(micro)
+		FROM
+			interest_accrual
+		WHERE
+			substr(day, 1, 7) <= $1
+		GROUP BY
+			wallet_id,
+			month
+		ORDER BY
+			wallet_id,
+			month
+	`
+
+	getAllInterestPostingsSQL = `
+		SELECT
+			wallet_id,
+			month,
+			amount
+		FROM
+			interest_posting
+	`
+
+	insertInterestPostingSQL = `
+		INSERT INTO interest_posting
+			(wallet_id, month, amount, due_micro, transaction_id, create_time)
+		VALUES
+			(?,?,?,?,?,?)
+		;
+	`
+
+	getInterestAccruedSQL = `
+		SELECT
+			COALESCE((SELECT SUM(micro) FROM interest_accrual WHERE wallet_id = $1), 0) -
+			COALESCE((SELECT SUM(amount) FROM interest_posting WHERE wallet_id = $1), 0) * 1000000
+	`
+
+	getInterestPostingsSQL = `
+		SELECT
+			wallet_id,
+			month,
+			amount,
+			due_micro,
+			transaction_id,
+			create_time
+		FROM
+			interest_posting
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			month DESC
+		LIMIT $2
+	`
+
+	getInterestAccrualsSQL = `
+		SELECT
+			wallet_id,
+			day,
+			balance,
+			rate_from,
+			micro
+		FROM
+			interest_accrual
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			day DESC
+		LIMIT $2
+	`
+)
+
+// upsertInterestPlan -> store the plan, and when it takes effect on a day that was already
+// accrued, have the next run recalculate from there
+func upsertInterestPlan(ctx context.Context, db *sql.DB, plan InterestPlan) (state interestState, err error) {
+	defer observeQuery("upsertInterestPlan", time.Now())
+	ctx, span := startQuerySpan(ctx, "upsertInterestPlan")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "upsertInterestPlan BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, upsertInterestRateSQL, plan.EffectiveFrom, plan.Tiers, plan.DayCount, plan.Rounding, plan.CreateTime)
+	if err != nil {
+		logError(ctx, "upsertInterestPlan ExecContext", err)
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, getInterestStateSQL).Scan(&state.AccruedThrough, &state.RecalculateFrom)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		logError(ctx, "upsertInterestPlan state", err)
+		return
+	}
+
+	if state.AccruedThrough != "" && plan.EffectiveFrom <= state.AccruedThrough &&
+		(state.RecalculateFrom == "" || plan.EffectiveFrom < state.RecalculateFrom) {
+		state.RecalculateFrom = plan.EffectiveFrom
+
+		_, err = tx.ExecContext(ctx, upsertInterestStateSQL, state.AccruedThrough, state.RecalculateFrom)
+		if err != nil {
+			logError(ctx, "upsertInterestPlan update state", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "upsertInterestPlan Commit", err)
+	}
+
+	return
+}
+
+func getInterestPlans(ctx context.Context, db *sql.DB) (plans []InterestPlan, err error) {
+	defer observeQuery("getInterestPlans", time.Now())
+	ctx, span := startQuerySpan(ctx, "getInterestPlans")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getInterestRatesSQL)
+	if err != nil {
+		logError(ctx, "getInterestPlans QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var plan InterestPlan
+		err = rows.Scan(&plan.EffectiveFrom, &plan.Tiers, &plan.DayCount, &plan.Rounding, &plan.CreateTime)
+		if err != nil {
+			logError(ctx, "getInterestPlans Scan", err)
+			return
+		}
+
+		err = plan.parse()
+		if err != nil {
+			logError(ctx, "getInterestPlans parse", err)
+			return
+		}
+
+		plans = append(plans, plan)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getInterestState(ctx context.Context, db *sql.DB) (state interestState, err error) {
+	defer observeQuery("getInterestState", time.Now())
+	ctx, span := startQuerySpan(ctx, "getInterestState")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getInterestStateSQL).Scan(&state.AccruedThrough, &state.RecalculateFrom)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		logError(ctx, "getInterestState Scan", err)
+	}
+
+	return
+}
+
+// replaceInterestAccruals -> the accruals of the days from from through through, and state
+func replaceInterestAccruals(ctx context.Context, db *sql.DB, from, through string, accruals []InterestAccrual, state interestState) (err error) {
+	defer observeQuery("replaceInterestAccruals", time.Now())
+	ctx, span := startQuerySpan(ctx, "replaceInterestAccruals")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "replaceInterestAccruals BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, deleteInterestAccrualsSQL, from, through)
+	if err != nil {
+		logError(ctx, "replaceInterestAccruals delete", err)
+		return
+	}
+
+	stmt, err := tx.PrepareContext(ctx, insertInterestAccrualSQL)
+	if err != nil {
+		logError(ctx, "replaceInterestAccruals PrepareContext", err)
+		return
+	}
+	defer stmt.Close()
+
+	for _, accrual := range accruals {
+		_, err = stmt.ExecContext(ctx, accrual.WalletID, accrual.Day, accrual.Balance, accrual.RateFrom, accrual.Micro)
+		if err != nil {
+			logError(ctx, "replaceInterestAccruals insert", err)
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, upsertInterestStateSQL, state.AccruedThrough, state.RecalculateFrom)
+	if err != nil {
+		logError(ctx, "replaceInterestAccruals state", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "replaceInterestAccruals Commit", err)
+	}
+
+	return
+}
+
+// interestMonthTotal -> what a wallet accrued in one month
+type interestMonthTotal struct {
+	WalletID string
+	Month    string
+	Micro    int64
+}
+
+func getInterestMonthTotals(ctx context.Context, db *sql.DB, throughMonth string) (totals []interestMonthTotal, err error) {
+	defer observeQuery("getInterestMonthTotals", time.Now())
+	ctx, span := startQuerySpan(ctx, "getInterestMonthTotals")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getInterestMonthTotalsSQL, throughMonth)
+	if err != nil {
+		logError(ctx, "getInterestMonthTotals QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total interestMonthTotal
+		err = rows.Scan(&total.WalletID, &total.Month, &total.Micro)
+		if err != nil {
+			logError(ctx, "getInterestMonthTotals Scan", err)
+			return
+		}
+
+		totals = append(totals, total)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// getPostedInterest -> posted amount by wallet and month
+func getPostedInterest(ctx context.Context, db *sql.DB) (posted map[string]map[string]int, err error) {
+	defer observeQuery("getPostedInterest", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPostedInterest")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getAllInterestPostingsSQL)
+	if err != nil {
+		logError(ctx, "getPostedInterest QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	posted = map[string]map[string]int{}
+	for rows.Next() {
+		var walletID, month string
+		var amount int
+		err = rows.Scan(&walletID, &month, &amount)
+		if err != nil {
+			logError(ctx, "getPostedInterest Scan", err)
+			return
+		}
+
+		if posted[walletID] == nil {
+			posted[walletID] = map[string]int{}
+		}
+		posted[walletID][month] = amount
+	}
+
+	err = rows.Err()
+	return
+}
+
+// insertInterestPosting -> record the posting and credit its amount to the main pocket of
+// the wallet in one tx, nothing is credited for an amount of 0
+func insertInterestPosting(ctx context.Context, db *sql.DB, posting *InterestPosting) (err error) {
+	defer observeQuery("insertInterestPosting", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertInterestPosting")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertInterestPosting BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var event walletEvent
+	if posting.Amount > 0 {
+		var transaction WalletTransaction
+		transaction, event, err = applyBalanceChange(ctx, tx, posting.WalletID, "", interestReferencePrefix+posting.Month, posting.Amount, interestType)
+		if err != nil {
+			return
+		}
+		posting.TransactionID = transaction.ID
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertInterestPostingSQL,
+		posting.WalletID,
+		posting.Month,
+		posting.Amount,
+		posting.DueMicro,
+		posting.TransactionID,
+		posting.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertInterestPosting ExecContext", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertInterestPosting Commit", err)
+		return
+	}
+
+	if posting.Amount > 0 {
+		publishWalletEvent(ctx, event)
+	}
+
+	return
+}
+
+func getInterestAccount(ctx context.Context, db *sql.DB, walletID string) (accrued int64, postings []InterestPosting, accruals []InterestAccrual, err error) {
+	defer observeQuery("getInterestAccount", time.Now())
+	ctx, span := startQuerySpan(ctx, "getInterestAccount")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getInterestAccruedSQL, walletID).Scan(&accrued)
+	if err != nil {
+		logError(ctx, "getInterestAccount accrued", err)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, getInterestPostingsSQL, walletID, interestPostingsLimit)
+	if err != nil {
+		logError(ctx, "getInterestAccount postings", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var posting InterestPosting
+		err = rows.Scan(&posting.WalletID, &posting.Month, &posting.Amount, &posting.DueMicro, &posting.TransactionID, &posting.CreateTime)
+		if err != nil {
+			logError(ctx, "getInterestAccount postings Scan", err)
+			return
+		}
+
+		postings = append(postings, posting)
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	rows, err = db.QueryContext(ctx, getInterestAccrualsSQL, walletID, interestAccrualsLimit)
+	if err != nil {
+		logError(ctx, "getInterestAccount accruals", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var accrual InterestAccrual
+		err = rows.Scan(&accrual.WalletID, &accrual.Day, &accrual.Balance, &accrual.RateFrom, &accrual.Micro)
+		if err != nil {
+			logError(ctx, "getInterestAccount accruals Scan", err)
+			return
+		}
+
+		accruals = append(accruals, accrual)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// interestEngine -> the daily interest job. Runs only depend on the transactions, the rate
+// plans and the days asked for, so with a replayed clock they give the same accruals.
+type interestEngine struct {
+	clock clock
+
+	// mu -> one run at a time, the daily one or one asked for by an admin
+	mu sync.Mutex
+}
+
+func newInterestEngine(c clock) *interestEngine {
+	return &interestEngine{clock: c}
+}
+
+var walletInterest = newInterestEngine(systemClock{})
+
+// lastClosedDay -> the latest day that is over, with time for transactions in flight
+func (e *interestEngine) lastClosedDay() time.Time {
+	return interestDay(e.clock.Now().Add(-interestJobDelay)).AddDate(0, 0, -1)
+}
+
+// run -> accrue and post every day shortly after midnight UTC, until ctx is done
+func (e *interestEngine) run(ctx context.Context) {
+	for {
+		result, err := e.runThrough(ctx, time.Time{}, e.lastClosedDay())
+		if err != nil {
+			logError(ctx, "interestEngine run", err)
+		} else {
+			logInfo(ctx, "interest run", "from", result.From, "through", result.Through, "accruals", result.Accruals, "postings", result.Postings)
+		}
+
+		next := interestDay(e.clock.Now()).AddDate(0, 0, 1).Add(interestJobDelay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(next.Sub(e.clock.Now())):
+		}
+	}
+}
+
+// runThrough -> accrue the days from from through through, then post every month that is
+// fully accrued. A zero from carries on after the last accrued day, or from where a rate
+// change asked for a recalculation.
+func (e *interestEngine) runThrough(ctx context.Context, from, through time.Time) (result InterestRun, err error) {
+	ctx = withOperation(ctx, "interest_run")
+	ctx, span := startSpan(ctx, "InterestRun", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, err := getInterestState(ctx, database)
+	if err != nil {
+		return
+	}
+
+	wallets, err := getWallets(ctx, database)
+	if err != nil {
+		return
+	}
+
+	if from.IsZero() {
+		from = e.resumeDay(state, wallets, through)
+	}
+
+	result.From = from.Format(interestDayLayout)
+	result.Through = through.Format(interestDayLayout)
+
+	if !from.After(through) {
+		var plans []InterestPlan
+		plans, err = getInterestPlans(ctx, database)
+		if err != nil {
+			return
+		}
+
+		var accruals []InterestAccrual
+		for _, wallet := range wallets {
+			var walletAccruals []InterestAccrual
+			walletAccruals, err = accrueWallet(ctx, wallet, plans, from, through)
+			if err != nil {
+				return
+			}
+			accruals = append(accruals, walletAccruals...)
+		}
+
+		next := interestState{AccruedThrough: max(state.AccruedThrough, result.Through)}
+		if state.RecalculateFrom != "" && state.RecalculateFrom < result.From {
+			next.RecalculateFrom = state.RecalculateFrom
+		}
+		if result.Through < state.AccruedThrough && next.RecalculateFrom == "" {
+			// the days after through still have their old accruals
+			next.RecalculateFrom = through.AddDate(0, 0, 1).Format(interestDayLayout)
+		}
+
+		err = replaceInterestAccruals(ctx, database, result.From, result.Through, accruals, next)
+		if err != nil {
+			return
+		}
+		result.Accruals = len(accruals)
+		state = next
+	}
+
+	result.Postings, result.Posted, err = e.post(ctx, state)
+	return
+}
+
+// resumeDay -> the first day a run without an explicit start accrues
+func (e *interestEngine) resumeDay(state interestState, wallets []Wallet, through time.Time) time.Time {
+	if state.RecalculateFrom != "" {
+		day, _ := time.Parse(interestDayLayout, state.RecalculateFrom)
+		return day
+	}
+
+	if state.AccruedThrough != "" {
+		day, _ := time.Parse(interestDayLayout, state.AccruedThrough)
+		return day.AddDate(0, 0, 1)
+	}
+
+	// nothing accrued yet, start with the oldest wallet
+	first := through.AddDate(0, 0, 1)
+	for _, wallet := range wallets {
+		if day := interestDay(wallet.EnableTime); !wallet.EnableTime.IsZero() && day.Before(first) {
+			first = day
+		}
+	}
+
+	return first
+}
+
+// accrueWallet -> the accruals of a wallet for the days from from through through, on the
+// balance at the end of each day
+func accrueWallet(ctx context.Context, wallet Wallet, plans []InterestPlan, from, through time.Time) (accruals []InterestAccrual, err error) {
+	balance, err := getBalanceBefore(ctx, database, wallet.ID, from)
+	if err != nil {
+		return
+	}
+
+	transactions, err := getTransactionsBetween(ctx, database, wallet.ID, from, through.AddDate(0, 0, 1))
+	if err != nil {
+		return
+	}
+
+	i := 0
+	for day := from; !day.After(through); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+		for ; i < len(transactions) && transactions[i].CreateTime.Before(end); i++ {
+			balance += transactions[i].SignedAmount()
+		}
+
+		key := day.Format(interestDayLayout)
+		plan, ok := planOn(plans, key)
+		if !ok || balance <= 0 {
+			continue
+		}
+
+		micro := plan.dailyMicro(balance, day)
+		if micro == 0 {
+			continue
+		}
+
+		accruals = append(accruals, InterestAccrual{
+			WalletID: wallet.ID,
+			Day:      key,
+			Balance:  balance,
+			RateFrom: plan.EffectiveFrom,
+			Micro:    micro,
+		})
+	}
+
+	return
+}
+
+// post -> post every fully accrued month that was not posted yet, what was accrued up to its
+// end minus what was posted before, rounded with the plan in effect at its end
+func (e *interestEngine) post(ctx context.Context, state interestState) (postings, posted int, err error) {
+	if state.AccruedThrough == "" {
+		return
+	}
+
+	through, err := time.Parse(interestDayLayout, state.AccruedThrough)
+	if err != nil {
+		return
+	}
+	lastMonth := monthStart(through.AddDate(0, 0, 1)).AddDate(0, -1, 0).Format(statementMonthLayout)
+
+	plans, err := getInterestPlans(ctx, database)
+	if err != nil {
+		return
+	}
+
+	totals, err := getInterestMonthTotals(ctx, database, lastMonth)
+	if err != nil {
+		return
+	}
+
+	postedMonths, err := getPostedInterest(ctx, database)
+	if err != nil {
+		return
+	}
+
+	var walletID string
+	var accrued, paid int64
+	for _, total := range totals {
+		if total.WalletID != walletID {
+			walletID, accrued, paid = total.WalletID, 0, 0
+		}
+		accrued += total.Micro
+
+		if amount, ok := postedMonths[walletID][total.Month]; ok {
+			paid += int64(amount) * interestMicro
+			continue
+		}
+
+		month, _ := time.Parse(statementMonthLayout, total.Month)
+		rounding := roundDown
+		if plan, ok := planOn(plans, month.AddDate(0, 1, -1).Format(interestDayLayout)); ok {
+			rounding = plan.Rounding
+		}
+
+		posting := InterestPosting{
+			WalletID:   walletID,
+			Month:      total.Month,
+			DueMicro:   accrued - paid,
+			CreateTime: e.clock.Now(),
+		}
+		posting.Amount = max(int(roundDiv(big.NewInt(posting.DueMicro), big.NewInt(interestMicro), rounding)), 0)
+
+		err = insertInterestPosting(ctx, database, &posting)
+		if err != nil {
+			return
+		}
+
+		paid += int64(posting.Amount) * interestMicro
+		postings++
+		posted += posting.Amount
+	}
+
+	return
+}
+
+// interestPlanFromRequest -> a plan taking effect on effectiveFrom, or the fields that are wrong
+func interestPlanFromRequest(effectiveFrom string, req RequestInterestRate, now time.Time) (plan InterestPlan, errs validationErrors) {
+	errs = validationErrors{}
+
+	plan = InterestPlan{
+		EffectiveFrom: effectiveFrom,
+		Tiers:         strings.ReplaceAll(req.Tiers, " ", ""),
+		DayCount:      req.DayCount,
+		Rounding:      req.Rounding,
+		CreateTime:    now,
+	}
+
+	if _, err := time.Parse(interestDayLayout, effectiveFrom); err != nil {
+		errs.add("effective_from", "Not a valid date, e.g. 2026-01-01.")
+	}
+
+	if err := plan.parse(); err != nil {
+		errs.add("tiers", "Not valid tiers: "+err.Error()+".")
+	}
+
+	if plan.DayCount == "" {
+		plan.DayCount = dayCountActual365
+	}
+	if !containsString(interestDayCounts, plan.DayCount) {
+		errs.add("day_count", "Must be one of: "+strings.Join(interestDayCounts, ", ")+".")
+	}
+
+	if plan.Rounding == "" {
+		plan.Rounding = roundHalfEven
+	}
+	if !containsString(interestRoundings, plan.Rounding) {
+		errs.add("rounding", "Must be one of: "+strings.Join(interestRoundings, ", ")+".")
+	}
+
+	return
+}
+
+// SetInterestPlan -> store a rate plan, backdated plans recalculate on the next run
+func SetInterestPlan(ctx context.Context, plan InterestPlan) (recalculateFrom string, err error) {
+	ctx = withOperation(ctx, "set_interest_plan")
+	ctx, span := startSpan(ctx, "SetInterestPlan", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	state, err := upsertInterestPlan(ctx, database, plan)
+	if err != nil {
+		return
+	}
+
+	return state.RecalculateFrom, nil
+}
+
+// ListInterestPlans -> every rate plan, oldest first
+func ListInterestPlans(ctx context.Context) (plans []InterestPlan, state interestState, err error) {
+	ctx = withOperation(ctx, "list_interest_plans")
+	ctx, span := startSpan(ctx, "ListInterestPlans", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	plans, err = getInterestPlans(ctx, database)
+	if err != nil {
+		return
+	}
+
+	state, err = getInterestState(ctx, database)
+	return
+}
+
+// ViewInterest -> the interest account of the enabled wallet
+func ViewInterest(ctx context.Context, userID string) (accrued int64, state interestState, postings []InterestPosting, accruals []InterestAccrual, err error) {
+	ctx = withOperation(ctx, "view_interest")
+	ctx, span := startSpan(ctx, "ViewInterest", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	state, err = getInterestState(ctx, database)
+	if err != nil {
+		return
+	}
+
+	accrued, postings, accruals, err = getInterestAccount(ctx, database, wallet.ID)
+	return
+}
+
+// HandleViewInterest -> View the interest accrued on my wallet and what was posted
+func HandleViewInterest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	accrued, state, postings, accruals, err := ViewInterest(r.Context(), userIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseInterest{
+		Accrued:        formatMicro(accrued),
+		AccruedThrough: state.AccruedThrough,
+		Postings:       []ResponseInterestPosting{},
+		Accruals:       []ResponseInterestAccrual{},
+	}
+	for _, posting := range postings {
+		data.Postings = append(data.Postings, ResponseInterestPosting{
+			Month:         posting.Month,
+			Amount:        posting.Amount,
+			Due:           formatMicro(posting.DueMicro),
+			TransactionID: posting.TransactionID,
+			PostedAt:      posting.CreateTime,
+		})
+	}
+	for _, accrual := range accruals {
+		data.Accruals = append(data.Accruals, ResponseInterestAccrual{
+			Day:      accrual.Day,
+			Balance:  accrual.Balance,
+			RateFrom: accrual.RateFrom,
+			Interest: formatMicro(accrual.Micro),
+		})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleListInterestRates -> Admin: the interest rate plans and how far interest is accrued
+func HandleListInterestRates(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	plans, state, err := ListInterestPlans(r.Context())
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseInterestRates{
+		AccruedThrough:  state.AccruedThrough,
+		RecalculateFrom: state.RecalculateFrom,
+		Rates:           []ResponseInterestRate{},
+	}
+	for _, plan := range plans {
+		data.Rates = append(data.Rates, interestRateResponse(plan))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleSetInterestRate -> Admin: set the interest rates from a day on, backdating recalculates
+func HandleSetInterestRate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestInterestRate
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	plan, errs := interestPlanFromRequest(ps.ByName("effective_from"), req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	recalculateFrom, err := SetInterestPlan(r.Context(), plan)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseInterestRateSet{
+		Rate:            interestRateResponse(plan),
+		RecalculateFrom: recalculateFrom,
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleRunInterest -> Admin: accrue and post interest now, from a day to recalculate it
+func HandleRunInterest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestInterestRun
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	errs := validationErrors{}
+	lastClosed := walletInterest.lastClosedDay()
+
+	through := lastClosed
+	if req.Through != "" {
+		day, err := time.Parse(interestDayLayout, req.Through)
+		switch {
+		case err != nil:
+			errs.add("through", "Not a valid date, e.g. 2026-01-31.")
+		case day.After(lastClosed):
+			errs.add("through", "Must not be after "+lastClosed.Format(interestDayLayout)+", the last day that is over.")
+		}
+		through = day
+	}
+
+	var from time.Time
+	if req.From != "" {
+		day, err := time.Parse(interestDayLayout, req.From)
+		switch {
+		case err != nil:
+			errs.add("from", "Not a valid date, e.g. 2026-01-01.")
+		case day.After(through):
+			errs.add("from", "Must not be after through.")
+		}
+		from = day
+	}
+
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	result, err := walletInterest.runThrough(r.Context(), from, through)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseInterestRun{
+		From:     result.From,
+		Through:  result.Through,
+		Accruals: result.Accruals,
+		Postings: result.Postings,
+		Posted:   result.Posted,
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func interestRateResponse(plan InterestPlan) ResponseInterestRate {
+	rate := ResponseInterestRate{
+		EffectiveFrom: plan.EffectiveFrom,
+		DayCount:      plan.DayCount,
+		Rounding:      plan.Rounding,
+		Tiers:         []ResponseRateTier{},
+		CreatedAt:     plan.CreateTime,
+	}
+	for _, tier := range plan.tiers {
+		rate.Tiers = append(rate.Tiers, ResponseRateTier{From: tier.From, RateBps: tier.RateBps})
+	}
+
+	return rate
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestInterestRunTwice -> accruing and posting the same days again credits the month once
+func TestInterestRunTwice(t *testing.T) {
+	ctx := context.Background()
+	userID := fundedWallet(t, 1000000)
+
+	from := interestDay(time.Now())
+	through := monthStart(from).AddDate(0, 1, -1)
+	engine := newInterestEngine(&fakeClock{now: through.AddDate(0, 0, 2)})
+
+	plan, errs := interestPlanFromRequest(from.Format(interestDayLayout), RequestInterestRate{Tiers: "0:1000"}, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("interestPlanFromRequest: %v", errs)
+	}
+	_, err := SetInterestPlan(ctx, plan)
+	if err != nil {
+		t.Fatalf("SetInterestPlan: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = engine.runThrough(ctx, from, through)
+		if err != nil {
+			t.Fatalf("run %d: runThrough: %v", i, err)
+		}
+
+		_, _, postings, _, err := ViewInterest(ctx, userID)
+		if err != nil {
+			t.Fatalf("run %d: ViewInterest: %v", i, err)
+		}
+		if len(postings) != 1 || postings[0].Amount <= 0 {
+			t.Fatalf("run %d: postings %+v, want one credit", i, postings)
+		}
+
+		wallet, _, _, err := ViewBalance(ctx, userID)
+		if err != nil {
+			t.Fatalf("run %d: ViewBalance: %v", i, err)
+		}
+		if wallet.Balance != 1000000+postings[0].Amount {
+			t.Errorf("run %d: balance %d, want %d", i, wallet.Balance, 1000000+postings[0].Amount)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+var (
+	logMu       sync.Mutex
+	logOutput   = json.NewEncoder(os.Stderr)
+	logMinLevel = parseLogLevel(os.Getenv("LOG_LEVEL"))
+)
+
+func parseLogLevel(s string) logLevel {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level
+		}
+	}
+
+	return levelInfo
+}
+
+// logEntry -> one structured log line
+type logEntry struct {
+	Time      string                 `json:"time"`
+	Level     string                 `json:"level"`
+	Message   string                 `json:"msg"`
+	Caller    string                 `json:"caller,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	WalletID  string                 `json:"wallet_id,omitempty"`
+	Operation string                 `json:"operation,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	SpanID    string                 `json:"span_id,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+func logDebug(ctx context.Context, msg string, kv ...interface{}) {
+	writeLog(ctx, levelDebug, msg, nil, kv)
+}
+
+func logInfo(ctx context.Context, msg string, kv ...interface{}) {
+	writeLog(ctx, levelInfo, msg, nil, kv)
+}
+
+func logWarn(ctx context.Context, msg string, kv ...interface{}) {
+	writeLog(ctx, levelWarn, msg, nil, kv)
+}
+
+func logError(ctx context.Context, msg string, err error, kv ...interface{}) {
+	writeLog(ctx, levelError, msg, err, kv)
+}
+
+// logFatal -> log at error level and exit, only for startup failures
+func logFatal(ctx context.Context, msg string, err error) {
+	writeLog(ctx, levelError, msg, err, nil)
+	os.Exit(1)
+}
+
+func writeLog(ctx context.Context, level logLevel, msg string, err error, kv []interface{}) {
+	if level < logMinLevel {
+		return
+	}
+
+	info := getRequestInfo(ctx)
+	entry := logEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     levelNames[level],
+		Message:   msg,
+		RequestID: info.RequestID,
+		UserID:    info.UserID,
+		WalletID:  info.WalletID,
+		Operation: info.Operation,
+	}
+
+	entry.TraceID, entry.SpanID = traceIDs(ctx)
+
+	if _, file, line, ok := runtime.Caller(2); ok {
+		entry.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if len(kv) > 0 {
+		entry.Fields = map[string]interface{}{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			entry.Fields[fmt.Sprint(kv[i])] = kv[i+1]
+		}
+	}
+
+	logMu.Lock()
+	logOutput.Encode(entry)
+	logMu.Unlock()
+}
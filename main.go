@@ -1,31 +1,184 @@
 package main
 
 import (
-	"log"
+	"context"
 	"net/http"
+	"os"
 
 	"github.com/julienschmidt/httprouter"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	ctx := context.Background()
 
-	// init database
-	initDB()
+	// wallet batch ... is the command line client of the batch api
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		os.Exit(runBatchCommand(ctx, os.Args[2:]))
+	}
 
-	router := httprouter.New()
+	// init tracing and database
+	initTracing(ctx)
+	initDB(ctx)
+	initRateLimit(ctx)
 
-	// Routes from path to handler function.
-	router.POST("/api/v1/init", HandleInitSession)
-	router.POST("/api/v1/wallet", Middleware(HandleEnableWallet))
-	router.GET("/api/v1/wallet", Middleware(HandleViewBalance))
-	router.POST("/api/v1/wallet/deposits", Middleware(HandleDeposits))
-	router.POST("/api/v1/wallet/withdrawals", Middleware(HandleWithdrawal))
-	router.PATCH("/api/v1/wallet", Middleware(HandleDisableWallet))
+	router := newRouter()
+
+	// Fail fast when the spec and the router drift apart.
+	initOpenAPI(ctx)
+
+	// gRPC mirror of the routes above, on its own port
+	go serveGRPC(ctx)
+
+	// Month end statements
+	go runStatementJob(ctx)
+
+	// Standing orders
+	go walletScheduler.run(ctx)
+
+	// Daily interest accrual and monthly posting
+	go walletInterest.run(ctx)
+
+	// Expiry of loyalty points
+	go walletPointsExpiry.run(ctx)
+
+	// Expiry of promo and refund credits
+	go walletBucketExpiry.run(ctx)
+
+	// Expiry of merchant payments and delivery of their webhooks
+	go walletPaymentExpiry.run(ctx)
+	go walletWebhooks.run(ctx)
+
+	// Refund of escrows that were not released in time
+	go walletEscrowTimeout.run(ctx)
+
+	// Due times of disputes
+	go walletDisputeSLA.run(ctx)
 
-	log.Println("starting wallet service at port 8000")
+	// Batches interrupted while applying
+	resumeBatches(ctx)
+
+	logInfo(ctx, "starting wallet service at port 8000")
 
 	// Bind to a port and pass router
-	log.Fatal(http.ListenAndServe(":8000", router))
+	logFatal(ctx, "ListenAndServe", http.ListenAndServe(":8000", router))
+}
+
+// newRouter -> every route of the service, registered through handle
+func newRouter() (router *httprouter.Router) {
+	router = httprouter.New()
+
+	// Routes from path to handler function.
+	handle(router, http.MethodPost, "/api/v1/init", RateLimit(rateLimitGroupInit, Idempotent(HandleInitSession)))
+	handle(router, http.MethodPost, "/api/v1/wallet", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleEnableWallet)))))
+	handle(router, http.MethodGet, "/api/v1/wallet", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewBalance))))
+	handle(router, http.MethodPost, "/api/v1/wallet/deposits", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleDeposits)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/withdrawals", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleWithdrawal)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/transfers", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleTransfer)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/transactions", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListTransactions))))
+	handle(router, http.MethodGet, "/api/v1/wallet/statements", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleGetStatement))))
+	handle(router, http.MethodGet, "/api/v1/wallet/stream", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleWalletStream))))
+	handle(router, http.MethodPatch, "/api/v1/wallet", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleDisableWallet)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/watchers", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListWalletWatchers))))
+	handle(router, http.MethodPut, "/api/v1/wallet/watchers/:user_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleGrantWalletWatcher))))
+	handle(router, http.MethodDelete, "/api/v1/wallet/watchers/:user_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleRevokeWalletWatcher))))
+	handle(router, http.MethodGet, "/api/v1/wallet/pockets", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListPockets))))
+	handle(router, http.MethodPost, "/api/v1/wallet/pockets", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleCreatePocket)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/pockets/moves", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleMovePocketMoney)))))
+	handle(router, http.MethodDelete, "/api/v1/wallet/pockets/:pocket_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleDeletePocket))))
+	handle(router, http.MethodGet, "/api/v1/wallet/pockets/:pocket_id/transactions", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListPocketTransactions))))
+	handle(router, http.MethodPost, "/api/v1/wallet/goals", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleCreateGoal)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/goals", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListGoals))))
+	handle(router, http.MethodGet, "/api/v1/wallet/goals/:goal_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleGetGoal))))
+	handle(router, http.MethodPut, "/api/v1/wallet/goals/:goal_id/rules", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleSetGoalRules)))))
+	handle(router, http.MethodDelete, "/api/v1/wallet/goals/:goal_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleCancelGoal))))
+	handle(router, http.MethodGet, "/api/v1/wallet/goals/:goal_id/history", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleGoalHistory))))
+	handle(router, http.MethodGet, "/api/v1/wallet/interest", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewInterest))))
+	handle(router, http.MethodGet, "/api/v1/wallet/fees/quote", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleQuoteFee))))
+	handle(router, http.MethodPost, "/api/v1/wallet/vouchers/redeem", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleRedeemVoucher)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/points", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewPoints))))
+	handle(router, http.MethodPost, "/api/v1/wallet/points/redeem", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleRedeemPoints)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/schedules", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleCreateSchedule)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/schedules", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListSchedules))))
+	handle(router, http.MethodGet, "/api/v1/wallet/schedules/:schedule_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleGetSchedule))))
+	handle(router, http.MethodPost, "/api/v1/wallet/schedules/:schedule_id/pause", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandlePauseSchedule))))
+	handle(router, http.MethodPost, "/api/v1/wallet/schedules/:schedule_id/resume", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleResumeSchedule))))
+	handle(router, http.MethodDelete, "/api/v1/wallet/schedules/:schedule_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleCancelSchedule))))
+	handle(router, http.MethodGet, "/api/v1/wallet/payments/:payment_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewPayment))))
+	handle(router, http.MethodPost, "/api/v1/wallet/payments/:payment_id/approve", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleApprovePayment)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/payments/:payment_id/decline", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleDeclinePayment))))
+	handle(router, http.MethodPost, "/api/v1/wallet/payment-requests", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleCreatePaymentRequest)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/payment-requests", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListPaymentRequests))))
+	handle(router, http.MethodGet, "/api/v1/wallet/payment-requests/:request_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewPaymentRequest))))
+	handle(router, http.MethodPost, "/api/v1/wallet/payment-requests/:request_id/accept", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleAcceptPaymentRequest)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/payment-requests/:request_id/decline", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleDeclinePaymentRequest))))
+	handle(router, http.MethodPost, "/api/v1/wallet/payment-requests/:request_id/cancel", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleCancelPaymentRequest))))
+	handle(router, http.MethodPost, "/api/v1/wallet/escrows", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleCreateEscrow)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/escrows", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListEscrows))))
+	handle(router, http.MethodGet, "/api/v1/wallet/escrows/:escrow_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewEscrow))))
+	handle(router, http.MethodPost, "/api/v1/wallet/escrows/:escrow_id/release", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleReleaseEscrow)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/escrows/:escrow_id/refund", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleRefundEscrow)))))
+	handle(router, http.MethodPost, "/api/v1/wallet/escrows/:escrow_id/dispute", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleDisputeEscrow))))
+	handle(router, http.MethodPost, "/api/v1/wallet/disputes", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleOpenDispute)))))
+	handle(router, http.MethodGet, "/api/v1/wallet/disputes", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleListDisputes))))
+	handle(router, http.MethodGet, "/api/v1/wallet/disputes/:dispute_id", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleViewDispute))))
+	handle(router, http.MethodPost, "/api/v1/wallet/disputes/:dispute_id/notes", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleAddDisputeEvidence))))
+	handle(router, http.MethodPost, "/api/v1/wallet/disputes/:dispute_id/withdraw", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleWithdrawDispute)))))
+	handle(router, http.MethodGet, "/api/v1/watch", RateLimit(rateLimitGroupAuth, Middleware(RateLimit(rateLimitGroupWallet, HandleWatchWallets))))
+
+	// Admin routes, authorized by ADMIN_TOKEN.
+	handle(router, http.MethodGet, "/api/v1/admin/rate-limits/:user_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleGetRateLimits)))
+	handle(router, http.MethodPut, "/api/v1/admin/rate-limits/:user_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleSetRateLimit)))
+	handle(router, http.MethodDelete, "/api/v1/admin/rate-limits/:user_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleDeleteRateLimit)))
+	handle(router, http.MethodPost, "/api/v1/admin/batches", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleCreateBatch)))
+	handle(router, http.MethodGet, "/api/v1/admin/batches/:batch_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleGetBatch)))
+	handle(router, http.MethodPost, "/api/v1/admin/batches/:batch_id/apply", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleApplyBatch)))
+	handle(router, http.MethodGet, "/api/v1/admin/batches/:batch_id/results", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleGetBatchResults)))
+	handle(router, http.MethodGet, "/api/v1/admin/interest/rates", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleListInterestRates)))
+	handle(router, http.MethodPut, "/api/v1/admin/interest/rates/:effective_from", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleSetInterestRate)))
+	handle(router, http.MethodPost, "/api/v1/admin/interest/run", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleRunInterest)))
+	handle(router, http.MethodGet, "/api/v1/admin/fees", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleListFeeSchedules)))
+	handle(router, http.MethodPost, "/api/v1/admin/fees", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleCreateFeeSchedule)))
+	handle(router, http.MethodGet, "/api/v1/admin/fees/:fee_schedule_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleGetFeeSchedule)))
+	handle(router, http.MethodPut, "/api/v1/admin/fees/:fee_schedule_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleUpdateFeeSchedule)))
+	handle(router, http.MethodDelete, "/api/v1/admin/fees/:fee_schedule_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleDeleteFeeSchedule)))
+	handle(router, http.MethodGet, "/api/v1/admin/vouchers", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleListVoucherCampaigns)))
+	handle(router, http.MethodPost, "/api/v1/admin/vouchers", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleCreateVoucherCampaign)))
+	handle(router, http.MethodGet, "/api/v1/admin/vouchers/:campaign_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleGetVoucherCampaign)))
+	handle(router, http.MethodGet, "/api/v1/admin/points", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandlePointsSettings)))
+	handle(router, http.MethodPut, "/api/v1/admin/points/program", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleSetPointsProgram)))
+	handle(router, http.MethodPut, "/api/v1/admin/points/rules/:category", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleSetPointsRule)))
+	handle(router, http.MethodDelete, "/api/v1/admin/points/rules/:category", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleDeletePointsRule)))
+	handle(router, http.MethodPost, "/api/v1/admin/transactions/:transaction_id/reverse", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleReverseTransaction)))
+	handle(router, http.MethodPost, "/api/v1/admin/credits/:user_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleCreditWallet)))
+	handle(router, http.MethodGet, "/api/v1/admin/accounts", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleListSystemAccounts)))
+	handle(router, http.MethodGet, "/api/v1/admin/accounts/:account_id/entries", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleSystemAccountEntries)))
+
+	handle(router, http.MethodGet, "/api/v1/admin/merchants", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleListMerchants)))
+	handle(router, http.MethodPost, "/api/v1/admin/merchants", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleCreateMerchant)))
+	handle(router, http.MethodGet, "/api/v1/admin/merchants/:merchant_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleGetMerchant)))
+	handle(router, http.MethodPut, "/api/v1/admin/merchants/:merchant_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleUpdateMerchant)))
+	handle(router, http.MethodPost, "/api/v1/admin/merchants/:merchant_id/keys", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleCreateMerchantKey)))
+	handle(router, http.MethodDelete, "/api/v1/admin/merchants/:merchant_id/keys/:key_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleRevokeMerchantKey)))
+	handle(router, http.MethodGet, "/api/v1/admin/escrows", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleAdminEscrows)))
+	handle(router, http.MethodGet, "/api/v1/admin/escrows/:escrow_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleAdminEscrow)))
+	handle(router, http.MethodPost, "/api/v1/admin/escrows/:escrow_id/resolve", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleResolveEscrow)))
+	handle(router, http.MethodGet, "/api/v1/admin/disputes", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleAdminDisputes)))
+	handle(router, http.MethodGet, "/api/v1/admin/disputes/:dispute_id", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleAdminDispute)))
+	handle(router, http.MethodPost, "/api/v1/admin/disputes/:dispute_id/status", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleMoveDispute)))
+	handle(router, http.MethodPost, "/api/v1/admin/disputes/:dispute_id/provisional-credit", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandlePlaceProvisionalCredit)))
+	handle(router, http.MethodPost, "/api/v1/admin/disputes/:dispute_id/notes", RateLimit(rateLimitGroupAuth, AdminMiddleware(HandleAddAdminDisputeNote)))
+
+	// Merchant routes, authorized by the API key of a merchant.
+	handle(router, http.MethodGet, "/api/v1/merchant", RateLimit(rateLimitGroupAuth, MerchantMiddleware(RateLimit(rateLimitGroupWallet, HandleViewMerchant))))
+	handle(router, http.MethodPost, "/api/v1/merchant/payments", RateLimit(rateLimitGroupAuth, MerchantMiddleware(RateLimit(rateLimitGroupWallet, Idempotent(HandleCreatePayment)))))
+	handle(router, http.MethodGet, "/api/v1/merchant/payments", RateLimit(rateLimitGroupAuth, MerchantMiddleware(RateLimit(rateLimitGroupWallet, HandleListPayments))))
+	handle(router, http.MethodGet, "/api/v1/merchant/payments/:payment_id", RateLimit(rateLimitGroupAuth, MerchantMiddleware(RateLimit(rateLimitGroupWallet, HandleGetPayment))))
+	handle(router, http.MethodPost, "/api/v1/merchant/payments/:payment_id/refunds", RateLimit(rateLimitGroupAuth, MerchantMiddleware(RateLimit(rateLimitGroupTransaction, Idempotent(HandleRefundPayment)))))
+	handle(router, http.MethodGet, "/api/v1/merchant/webhooks", RateLimit(rateLimitGroupAuth, MerchantMiddleware(RateLimit(rateLimitGroupWallet, HandleListWebhooks))))
+
+	handle(router, http.MethodGet, "/api/v1/openapi.json", HandleOpenAPI)
+	handle(router, http.MethodGet, "/metrics", HandleMetrics)
+
+	return
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const testAdminToken = "test-admin-token"
+
+// testServer -> the real router over a database in a temporary directory, shared by the tests
+var testServer *httptest.Server
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+
+	dir, err := os.MkdirTemp("", "wallet-test")
+	if err != nil {
+		panic(err)
+	}
+
+	// wallet.db lives in the working directory
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("ADMIN_TOKEN", testAdminToken)
+	logOutput = json.NewEncoder(io.Discard)
+	for group := range defaultRateLimitPolicies {
+		defaultRateLimitPolicies[group] = rateLimitPolicy{Rate: 1000, Burst: 1000}
+	}
+
+	initDB(ctx)
+	initRateLimit(ctx)
+	router := newRouter()
+	initOpenAPI(ctx)
+
+	testServer = httptest.NewServer(router)
+	code := m.Run()
+	testServer.Close()
+	os.RemoveAll(dir)
+
+	os.Exit(code)
+}
+
+// fundedWallet -> init and enable the wallet of a new user with amount deposited on it
+func fundedWallet(t *testing.T, amount int) (userID string) {
+	t.Helper()
+	ctx := context.Background()
+	userID = t.Name() + "-" + generateUUID()
+
+	_, err := InitAccount(ctx, userID)
+	if err != nil {
+		t.Fatalf("InitAccount %s: %v", userID, err)
+	}
+
+	_, err = EnableWallet(ctx, userID)
+	if err != nil {
+		t.Fatalf("EnableWallet %s: %v", userID, err)
+	}
+
+	_, err = Deposit(ctx, userID, userID+"-funding", amount)
+	if err != nil {
+		t.Fatalf("Deposit %s: %v", userID, err)
+	}
+
+	return
+}
@@ -0,0 +1,917 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Merchants are accounts created by admins that accept payments from the wallets. Each one
+// is a user of its own, merchant:<id>, so no consumer can init an account with its id, and
+// owns the settlement wallet its payments are credited to. Merchants call the merchant api
+// with an API key in place of a session token, keys are stored as their sha256 only.
+
+const (
+	merchantUserPrefix = "merchant:"
+
+	// merchantKeyPrefix -> tells an API key from a session token at a glance
+	merchantKeyPrefix     = "mk_"
+	merchantKeyBytes      = 24
+	merchantKeyShownSize  = 11
+	webhookSecretPrefix   = "whsec_"
+	webhookSecretBytes    = 24
+	maxMerchantNameLen    = 100
+	maxMerchantFeeBps     = 10000
+	maxWebhookURLLen      = 500
+	merchantFeeRoundingBp = maxMerchantFeeBps / 2
+)
+
+// Merchant -> payments to it are credited to WalletID less FeeFlat and FeeBps of the amount
+type Merchant struct {
+	ID            string    `db:"id"`
+	Name          string    `db:"name"`
+	Category      string    `db:"category"`
+	WalletID      string    `db:"wallet_id"`
+	WebhookURL    string    `db:"webhook_url"`
+	WebhookSecret string    `db:"webhook_secret"`
+	FeeBps        int       `db:"fee_bps"`
+	FeeFlat       int       `db:"fee_flat"`
+	CreateTime    time.Time `db:"create_time"`
+	UpdateTime    time.Time `db:"update_time"`
+}
+
+// UserID -> the user that owns the settlement wallet
+func (m Merchant) UserID() string {
+	return merchantUserPrefix + m.ID
+}
+
+// Fee -> fee on a payment of amount, rounded half up and never more than the amount
+func (m Merchant) Fee(amount int) int {
+	fee := m.FeeFlat + (amount*m.FeeBps+merchantFeeRoundingBp)/maxMerchantFeeBps
+	return min(fee, amount)
+}
+
+// MerchantKey -> an API key of a merchant, Prefix is the part shown to tell keys apart
+type MerchantKey struct {
+	ID         string    `db:"id"`
+	MerchantID string    `db:"merchant_id"`
+	Prefix     string    `db:"prefix"`
+	KeyHash    string    `db:"key_hash"`
+	CreateTime time.Time `db:"create_time"`
+	RevokeTime time.Time `db:"revoke_time"`
+}
+
+// Revoked -> the key no longer authorizes
+func (k MerchantKey) Revoked() bool {
+	return !k.RevokeTime.IsZero()
+}
+
+const (
+	createMerchantTable = `
+		CREATE TABLE IF NOT EXISTS merchant (
+			id TEXT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			category TEXT NOT NULL,
+			wallet_id TEXT NOT NULL,
+			webhook_url TEXT NOT NULL,
+			webhook_secret TEXT NOT NULL,
+			fee_bps INTEGER NOT NULL,
+			fee_flat INTEGER NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createMerchantKeyTable = `
+		CREATE TABLE IF NOT EXISTS merchant_key (
+			id TEXT NOT NULL PRIMARY KEY,
+			merchant_id TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			create_time DATETIME NOT NULL,
+			revoke_time DATETIME
+		);
+	`
+
+	insertMerchantSQL = `
+		INSERT INTO merchant
+			(id, name, category, wallet_id, webhook_url, webhook_secret, fee_bps, fee_flat, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	updateMerchantSQL = `
+		UPDATE
+			merchant
+		SET
+			name = $1,
+			category = $2,
+			webhook_url = $3,
+			fee_bps = $4,
+			fee_flat = $5,
+			update_time = $6
+		WHERE
+			id = $7
+	`
+
+	selectMerchantSQL = `
+		SELECT
+			id,
+			name,
+			category,
+			wallet_id,
+			webhook_url,
+			webhook_secret,
+			fee_bps,
+			fee_flat,
+			create_time,
+			update_time
+		FROM
+			merchant
+	`
+
+	getMerchantsSQL = selectMerchantSQL + `
+		ORDER BY
+			create_time DESC
+	`
+
+	getMerchantSQL = selectMerchantSQL + `
+		WHERE
+			id = $1
+	`
+
+	insertMerchantKeySQL = `
+		INSERT INTO merchant_key
+			(id, merchant_id, prefix, key_hash, create_time)
+		VALUES
+			(?,?,?,?,?)
+		;
+	`
+
+	getMerchantKeysSQL = `
+		SELECT
+			id,
+			merchant_id,
+			prefix,
+			key_hash,
+			create_time,
+			revoke_time
+		FROM
+			merchant_key
+		WHERE
+			merchant_id = $1
+		ORDER BY
+			create_time
+	`
+
+	// getMerchantIDByKeySQL -> the merchant of a key that is not revoked
+	getMerchantIDByKeySQL = `
+		SELECT
+			merchant_id
+		FROM
+			merchant_key
+		WHERE
+			key_hash = $1 AND
+			revoke_time IS NULL
+	`
+
+	revokeMerchantKeySQL = `
+		UPDATE
+			merchant_key
+		SET
+			revoke_time = $1
+		WHERE
+			id = $2 AND
+			merchant_id = $3 AND
+			revoke_time IS NULL
+	`
+)
+
+// randomToken -> prefix and size random bytes in hex
+func randomToken(prefix string, size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+
+	return prefix + hex.EncodeToString(b)
+}
+
+func hashMerchantKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newMerchantKey -> a new key of the merchant and the key itself, which is not stored
+func newMerchantKey(merchantID string, now time.Time) (key MerchantKey, apiKey string) {
+	apiKey = randomToken(merchantKeyPrefix, merchantKeyBytes)
+	key = MerchantKey{
+		ID:         generateUUID(),
+		MerchantID: merchantID,
+		Prefix:     apiKey[:merchantKeyShownSize],
+		KeyHash:    hashMerchantKey(apiKey),
+		CreateTime: now,
+	}
+
+	return
+}
+
+func insertMerchantKey(ctx context.Context, tx *sql.Tx, key MerchantKey) (err error) {
+	_, err = tx.ExecContext(ctx, insertMerchantKeySQL, key.ID, key.MerchantID, key.Prefix, key.KeyHash, key.CreateTime)
+	if err != nil {
+		logError(ctx, "insertMerchantKey ExecContext", err)
+	}
+
+	return
+}
+
+// createMerchant -> the merchant, its user, its settlement wallet and its first key in one tx
+func createMerchant(ctx context.Context, db *sql.DB, merchant *Merchant, key MerchantKey) (err error) {
+	defer observeQuery("createMerchant", time.Now())
+	ctx, span := startQuerySpan(ctx, "createMerchant")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "createMerchant BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, insertUserSQL, merchant.UserID())
+	if err != nil {
+		logError(ctx, "createMerchant insert user", err)
+		return
+	}
+
+	wallet, event, err := insertWallet(ctx, tx, merchant.UserID(), defaultBalance)
+	if err != nil {
+		return
+	}
+	merchant.WalletID = wallet.ID
+
+	_, err = tx.ExecContext(ctx,
+		insertMerchantSQL,
+		merchant.ID,
+		merchant.Name,
+		merchant.Category,
+		merchant.WalletID,
+		merchant.WebhookURL,
+		merchant.WebhookSecret,
+		merchant.FeeBps,
+		merchant.FeeFlat,
+		merchant.CreateTime,
+		merchant.UpdateTime,
+	)
+	if err != nil {
+		logError(ctx, "createMerchant ExecContext", err)
+		return
+	}
+
+	err = insertMerchantKey(ctx, tx, key)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "createMerchant Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+func updateMerchant(ctx context.Context, db *sql.DB, merchant Merchant) (updated bool, err error) {
+	defer observeQuery("updateMerchant", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateMerchant")
+	defer func() {
+		span.end(err)
+	}()
+
+	result, err := db.ExecContext(ctx,
+		updateMerchantSQL,
+		merchant.Name,
+		merchant.Category,
+		merchant.WebhookURL,
+		merchant.FeeBps,
+		merchant.FeeFlat,
+		merchant.UpdateTime,
+		merchant.ID,
+	)
+	if err != nil {
+		logError(ctx, "updateMerchant ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "updateMerchant RowsAffected", err)
+		return
+	}
+	updated = changed > 0
+
+	return
+}
+
+func scanMerchant(scanner interface{ Scan(...interface{}) error }) (merchant Merchant, err error) {
+	err = scanner.Scan(
+		&merchant.ID,
+		&merchant.Name,
+		&merchant.Category,
+		&merchant.WalletID,
+		&merchant.WebhookURL,
+		&merchant.WebhookSecret,
+		&merchant.FeeBps,
+		&merchant.FeeFlat,
+		&merchant.CreateTime,
+		&merchant.UpdateTime,
+	)
+
+	return
+}
+
+func getMerchants(ctx context.Context, db *sql.DB) (merchants []Merchant, err error) {
+	defer observeQuery("getMerchants", time.Now())
+	ctx, span := startQuerySpan(ctx, "getMerchants")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getMerchantsSQL)
+	if err != nil {
+		logError(ctx, "getMerchants QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var merchant Merchant
+		merchant, err = scanMerchant(rows)
+		if err != nil {
+			logError(ctx, "getMerchants Scan", err)
+			return
+		}
+
+		merchants = append(merchants, merchant)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getMerchant(ctx context.Context, db *sql.DB, merchantID string) (merchant Merchant, err error) {
+	defer observeQuery("getMerchant", time.Now())
+	ctx, span := startQuerySpan(ctx, "getMerchant")
+	defer func() {
+		span.end(err)
+	}()
+
+	merchant, err = scanMerchant(db.QueryRowContext(ctx, getMerchantSQL, merchantID))
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getMerchant Scan", err)
+	}
+
+	return
+}
+
+func getMerchantKeys(ctx context.Context, db *sql.DB, merchantID string) (keys []MerchantKey, err error) {
+	defer observeQuery("getMerchantKeys", time.Now())
+	ctx, span := startQuerySpan(ctx, "getMerchantKeys")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getMerchantKeysSQL, merchantID)
+	if err != nil {
+		logError(ctx, "getMerchantKeys QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key        MerchantKey
+			revokeTime sql.NullTime
+		)
+		err = rows.Scan(&key.ID, &key.MerchantID, &key.Prefix, &key.KeyHash, &key.CreateTime, &revokeTime)
+		if err != nil {
+			logError(ctx, "getMerchantKeys Scan", err)
+			return
+		}
+		key.RevokeTime = revokeTime.Time
+
+		keys = append(keys, key)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func addMerchantKey(ctx context.Context, db *sql.DB, key MerchantKey) (err error) {
+	defer observeQuery("addMerchantKey", time.Now())
+	ctx, span := startQuerySpan(ctx, "addMerchantKey")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "addMerchantKey BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = insertMerchantKey(ctx, tx, key)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "addMerchantKey Commit", err)
+	}
+
+	return
+}
+
+func revokeMerchantKey(ctx context.Context, db *sql.DB, merchantID, keyID string, now time.Time) (revoked bool, err error) {
+	defer observeQuery("revokeMerchantKey", time.Now())
+	ctx, span := startQuerySpan(ctx, "revokeMerchantKey")
+	defer func() {
+		span.end(err)
+	}()
+
+	result, err := db.ExecContext(ctx, revokeMerchantKeySQL, now, keyID, merchantID)
+	if err != nil {
+		logError(ctx, "revokeMerchantKey ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "revokeMerchantKey RowsAffected", err)
+		return
+	}
+	revoked = changed > 0
+
+	return
+}
+
+// getMerchantIDByKey -> the merchant of apiKey, "" when it is unknown or revoked
+func getMerchantIDByKey(ctx context.Context, db *sql.DB, apiKey string) (merchantID string, err error) {
+	defer observeQuery("getMerchantIDByKey", time.Now())
+	ctx, span := startQuerySpan(ctx, "getMerchantIDByKey")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getMerchantIDByKeySQL, hashMerchantKey(apiKey)).Scan(&merchantID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		logError(ctx, "getMerchantIDByKey Scan", err)
+	}
+
+	return
+}
+
+// MerchantMiddleware -> http middleware for the merchant api, authorized by an API key sent
+// like a session token. The merchant is the user of the request, merchant:<id>.
+func MerchantMiddleware(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		apiKey := getSessionByToken(r.Header.Get("Authorization"))
+		if !strings.HasPrefix(apiKey, merchantKeyPrefix) {
+			abortError(w, r, errUnauthorized)
+			return
+		}
+
+		merchantID, err := getMerchantIDByKey(r.Context(), database, apiKey)
+		if err != nil || merchantID == "" {
+			abortError(w, r, errUnauthorized)
+			return
+		}
+		r = r.WithContext(withUserID(r.Context(), merchantUserPrefix+merchantID))
+
+		next(w, r, ps)
+	}
+}
+
+// merchantIDFromContext -> the merchant behind MerchantMiddleware
+func merchantIDFromContext(ctx context.Context) string {
+	return strings.TrimPrefix(userIDFromContext(ctx), merchantUserPrefix)
+}
+
+// validWebhookURL -> an absolute http or https url, or none
+func validWebhookURL(webhookURL string) bool {
+	if webhookURL == "" {
+		return true
+	}
+
+	u, err := url.Parse(webhookURL)
+	if err != nil || len(webhookURL) > maxWebhookURLLen {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// merchantFromRequest -> the settings of the request applied to merchant, or the fields
+// that are wrong
+func merchantFromRequest(req RequestMerchant, merchant Merchant) (Merchant, validationErrors) {
+	errs := validationErrors{}
+
+	merchant.Name = strings.TrimSpace(req.Name)
+	merchant.Category = req.Category
+	merchant.WebhookURL = strings.TrimSpace(req.WebhookURL)
+	merchant.FeeBps = req.FeeBps
+	merchant.FeeFlat = req.FeeFlat
+
+	switch {
+	case merchant.Name == "":
+		errs.add("name", msgRequired)
+	case len(merchant.Name) > maxMerchantNameLen:
+		errs.add("name", "Must be at most 100 characters.")
+	}
+
+	if !validMerchantCategory(merchant.Category) {
+		errs.add("category", msgMerchantCategory)
+	}
+
+	if !validWebhookURL(merchant.WebhookURL) {
+		errs.add("webhook_url", "Must be an absolute http or https URL of at most 500 characters.")
+	}
+
+	if merchant.FeeBps > maxMerchantFeeBps {
+		errs.add("fee_bps", "Must be at most 10000.")
+	}
+
+	return merchant, errs
+}
+
+// CreateMerchant -> store the merchant with its settlement wallet, apiKey is shown only now
+func CreateMerchant(ctx context.Context, merchant Merchant) (created Merchant, apiKey string, err error) {
+	ctx = withOperation(ctx, "create_merchant")
+	ctx, span := startSpan(ctx, "CreateMerchant", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	now := time.Now()
+	merchant.ID = generateUUID()
+	merchant.WebhookSecret = randomToken(webhookSecretPrefix, webhookSecretBytes)
+	merchant.CreateTime = now
+	merchant.UpdateTime = now
+
+	key, apiKey := newMerchantKey(merchant.ID, now)
+
+	err = createMerchant(ctx, database, &merchant, key)
+	if err != nil {
+		return
+	}
+	setWalletID(ctx, merchant.WalletID)
+
+	return merchant, apiKey, nil
+}
+
+// ListMerchants -> every merchant, newest first
+func ListMerchants(ctx context.Context) (merchants []Merchant, err error) {
+	ctx = withOperation(ctx, "list_merchants")
+	ctx, span := startSpan(ctx, "ListMerchants", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	return getMerchants(ctx, database)
+}
+
+// GetMerchant -> a merchant, its settlement wallet and its keys
+func GetMerchant(ctx context.Context, merchantID string) (merchant Merchant, wallet Wallet, keys []MerchantKey, err error) {
+	ctx = withOperation(ctx, "get_merchant")
+	ctx, span := startSpan(ctx, "GetMerchant", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	merchant, err = getMerchant(ctx, database, merchantID)
+	if err == sql.ErrNoRows {
+		err = errMerchantNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	wallet, err = getWalletByUserID(ctx, database, merchant.UserID())
+	setWalletID(ctx, wallet.ID)
+	if err != nil {
+		logError(ctx, "GetMerchant getWalletByUserID", err)
+		return
+	}
+
+	keys, err = getMerchantKeys(ctx, database, merchantID)
+	return
+}
+
+// UpdateMerchant -> replace the settings of a merchant, its wallet, keys and webhook secret stay
+func UpdateMerchant(ctx context.Context, merchant Merchant) (err error) {
+	ctx = withOperation(ctx, "update_merchant")
+	ctx, span := startSpan(ctx, "UpdateMerchant", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	merchant.UpdateTime = time.Now()
+
+	updated, err := updateMerchant(ctx, database, merchant)
+	if err == nil && !updated {
+		err = errMerchantNotFound
+	}
+
+	return
+}
+
+// CreateMerchantKey -> a new API key of the merchant, the old ones keep working until revoked
+func CreateMerchantKey(ctx context.Context, merchantID string) (key MerchantKey, apiKey string, err error) {
+	ctx = withOperation(ctx, "create_merchant_key")
+	ctx, span := startSpan(ctx, "CreateMerchantKey", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	_, err = getMerchant(ctx, database, merchantID)
+	if err == sql.ErrNoRows {
+		err = errMerchantNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	key, apiKey = newMerchantKey(merchantID, time.Now())
+	err = addMerchantKey(ctx, database, key)
+	return
+}
+
+// RevokeMerchantKey -> stop a key from authorizing, errMerchantKeyNotFound when it is not a
+// live key of the merchant
+func RevokeMerchantKey(ctx context.Context, merchantID, keyID string) (err error) {
+	ctx = withOperation(ctx, "revoke_merchant_key")
+	ctx, span := startSpan(ctx, "RevokeMerchantKey", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	revoked, err := revokeMerchantKey(ctx, database, merchantID, keyID, time.Now())
+	if err == nil && !revoked {
+		err = errMerchantKeyNotFound
+	}
+
+	return
+}
+
+// HandleCreateMerchant -> Admin: create a merchant with its settlement wallet and first API key
+func HandleCreateMerchant(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestMerchant
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	merchant, errs := merchantFromRequest(req, Merchant{})
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	merchant, apiKey, err := CreateMerchant(r.Context(), merchant)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseMerchant{
+		Merchant:      merchantResponse(merchant, nil, nil),
+		APIKey:        apiKey,
+		WebhookSecret: merchant.WebhookSecret,
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListMerchants -> Admin: every merchant
+func HandleListMerchants(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	merchants, err := ListMerchants(r.Context())
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseMerchants{
+		Merchants: []ResponseMerchantDetail{},
+	}
+	for _, merchant := range merchants {
+		data.Merchants = append(data.Merchants, merchantResponse(merchant, nil, nil))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGetMerchant -> Admin: a merchant with its settlement balance and API keys
+func HandleGetMerchant(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	merchant, wallet, keys, err := GetMerchant(r.Context(), ps.ByName("merchant_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseMerchant{
+		Merchant: merchantResponse(merchant, &wallet, keys),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleUpdateMerchant -> Admin: replace the name, category, webhook url and fees of a merchant
+func HandleUpdateMerchant(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestMerchant
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	merchant, errs := merchantFromRequest(req, Merchant{ID: ps.ByName("merchant_id")})
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	err := UpdateMerchant(r.Context(), merchant)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	merchant, wallet, keys, err := GetMerchant(r.Context(), merchant.ID)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseMerchant{
+		Merchant: merchantResponse(merchant, &wallet, keys),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleCreateMerchantKey -> Admin: issue another API key to a merchant
+func HandleCreateMerchantKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	key, apiKey, err := CreateMerchantKey(r.Context(), ps.ByName("merchant_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseMerchantKeyCreated{
+		Key:    merchantKeyResponse(key),
+		APIKey: apiKey,
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleRevokeMerchantKey -> Admin: revoke an API key of a merchant
+func HandleRevokeMerchantKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	err := RevokeMerchantKey(r.Context(), ps.ByName("merchant_id"), ps.ByName("key_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	merchant, wallet, keys, err := GetMerchant(r.Context(), ps.ByName("merchant_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseMerchant{
+		Merchant: merchantResponse(merchant, &wallet, keys),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleViewMerchant -> Merchant: my settings, settlement balance and webhook secret
+func HandleViewMerchant(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	merchant, wallet, _, err := GetMerchant(r.Context(), merchantIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseMerchant{
+		Merchant:      merchantResponse(merchant, &wallet, nil),
+		WebhookSecret: merchant.WebhookSecret,
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// merchantResponse -> the merchant, with its balance and keys when they were read
+func merchantResponse(merchant Merchant, wallet *Wallet, keys []MerchantKey) ResponseMerchantDetail {
+	detail := ResponseMerchantDetail{
+		ID:         merchant.ID,
+		Name:       merchant.Name,
+		Category:   merchant.Category,
+		WalletID:   merchant.WalletID,
+		WebhookURL: merchant.WebhookURL,
+		FeeBps:     merchant.FeeBps,
+		FeeFlat:    merchant.FeeFlat,
+		CreatedAt:  merchant.CreateTime,
+		UpdatedAt:  merchant.UpdateTime,
+	}
+	if wallet != nil {
+		detail.Balance = &wallet.Balance
+	}
+	for _, key := range keys {
+		detail.Keys = append(detail.Keys, merchantKeyResponse(key))
+	}
+
+	return detail
+}
+
+func merchantKeyResponse(key MerchantKey) ResponseMerchantKey {
+	detail := ResponseMerchantKey{
+		ID:        key.ID,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreateTime,
+	}
+	if key.Revoked() {
+		detail.RevokedAt = &key.RevokeTime
+	}
+
+	return detail
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultBuckets -> latency buckets in seconds, same as the prometheus client default
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	httpRequestsTotal = newCounterVec(
+		"wallet_http_requests_total",
+		"Total HTTP requests by route, method and status code.",
+		"route", "method", "code",
+	)
+	httpRequestDuration = newHistogramVec(
+		"wallet_http_request_duration_seconds",
+		"HTTP request latency by route, method and status code.",
+		"route", "method", "code",
+	)
+	walletOperationsTotal = newCounterVec(
+		"wallet_operations_total",
+		"Successful wallet balance operations by type.",
+		"operation",
+	)
+	walletOperationAmount = newCounterVec(
+		"wallet_operation_amount_total",
+		"Sum of amounts moved by successful wallet operations by type.",
+		"operation",
+	)
+	walletOperationFailures = newCounterVec(
+		"wallet_operation_failures_total",
+		"Failed wallet balance operations by type and reason.",
+		"operation", "reason",
+	)
+	dbQueryDuration = newHistogramVec(
+		"wallet_db_query_duration_seconds",
+		"Database query latency by query.",
+		"query",
+	)
+)
+
+// observeRequest -> record one served http request
+func observeRequest(route, method string, code int, start time.Time) {
+	status := strconv.Itoa(code)
+	httpRequestsTotal.add(1, route, method, status)
+	httpRequestDuration.observe(time.Since(start).Seconds(), route, method, status)
+}
+
+// observeWalletResult -> record a deposit or withdrawal, failures by error code
+func observeWalletResult(operation string, amount int, err error) {
+	if err != nil {
+		observeWalletFailure(operation, errorReason(err))
+		return
+	}
+
+	walletOperationsTotal.add(1, operation)
+	walletOperationAmount.add(float64(amount), operation)
+}
+
+// observeWalletFailure -> record a deposit or withdrawal that failed for reason
+func observeWalletFailure(operation, reason string) {
+	walletOperationFailures.add(1, operation, reason)
+}
+
+// observeQuery -> record database latency, meant to be deferred
+func observeQuery(query string, start time.Time) {
+	dbQueryDuration.observe(time.Since(start).Seconds(), query)
+}
+
+// Instrument -> wrap a route handler with request count and latency metrics
+func Instrument(method, route string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(recorder, r, ps)
+
+		observeRequest(route, method, recorder.status, start)
+	}
+}
+
+// handle -> register an instrumented route
+func handle(router *httprouter.Router, method, path string, next httprouter.Handle) {
+	registeredRoutes = append(registeredRoutes, route{Method: method, Path: path})
+
+	if openAPIValidate {
+		next = ValidateResponse(method, path, next)
+	}
+
+	router.Handle(method, path, Instrument(method, path, RequestID(Trace(method, path, next))))
+}
+
+// HandleMetrics -> Expose metrics in prometheus text format
+func HandleMetrics(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	httpRequestsTotal.write(w)
+	httpRequestDuration.write(w)
+	walletOperationsTotal.write(w)
+	walletOperationAmount.write(w)
+	walletOperationFailures.write(w)
+	contractViolations.write(w)
+	dbQueryDuration.write(w)
+
+	sessions, wallets, err := countActive(r.Context(), database)
+	if err != nil {
+		logError(r.Context(), "HandleMetrics countActive", err)
+		return
+	}
+
+	writeGauge(w, "wallet_active_sessions", "Sessions currently active.", sessions)
+	writeGauge(w, "wallet_active_wallets", "Wallets currently enabled.", wallets)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush -> keeps streaming handlers working behind the recorder
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack -> lets the websocket endpoint take over the connection, recorded as 101
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not a http.Hijacker", s.ResponseWriter)
+	}
+
+	s.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+type counterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+	}
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	key := formatLabels(c.labels, labelValues)
+
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type histogramVec struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: defaultBuckets,
+		values:  map[string]*histogram{},
+	}
+}
+
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	key := formatLabels(h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, key, formatFloat(bound), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, key, hist.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, key, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, key, hist.count)
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + "=" + strconv.Quote(value)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/subtle"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -16,28 +18,65 @@ func Middleware(next httprouter.Handle) httprouter.Handle {
 		token := r.Header.Get("Authorization")
 
 		sessionID := getSessionByToken(token)
-		userID, status := checkSession(sessionID)
+		userID, status := checkSession(r.Context(), sessionID)
 		if !status {
-			response := Response{
-				Status: statusFail,
-				Data: ResponseError{
-					Error: "Authorization failed",
-				},
-			}
+			abortError(w, r, errUnauthorized)
+			return
+		}
+		r = r.WithContext(withUserID(r.Context(), userID))
 
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(response)
+		next(w, r, ps)
+		return
+	}
+}
 
+// AdminMiddleware -> http middleware for the admin api, authorized by the ADMIN_TOKEN env
+func AdminMiddleware(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		token := getSessionByToken(r.Header.Get("Authorization"))
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			abortError(w, r, errUnauthorized)
 			return
 		}
-		r.ParseForm()
-		r.Form.Set("user_id", userID)
+
+		r = r.WithContext(withOperation(r.Context(), "admin"))
+
+		next(w, r, ps)
+	}
+}
+
+// RequestID -> attach a request id taken from X-Request-ID or generated, and echo it back
+func RequestID(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = generateUUID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		r = r.WithContext(withRequestID(r.Context(), requestID))
 
 		next(w, r, ps)
-		return
 	}
 }
 
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func getSessionByToken(token string) (sessionID string) {
 	arr := strings.Fields(token)
 	if len(arr) != 2 {
@@ -53,8 +92,8 @@ func getSessionByToken(token string) (sessionID string) {
 	return
 }
 
-func checkSession(sessionID string) (userID string, status bool) {
-	userID, err := getSession(database, sessionID)
+func checkSession(ctx context.Context, sessionID string) (userID string, status bool) {
+	userID, err := getSession(ctx, database, sessionID)
 	if err != nil {
 		return
 	}
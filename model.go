@@ -20,3 +20,37 @@ type WalletTransaction struct {
 	ReferenceID string    `db:"reference_id"`
 	CreateTime  time.Time `db:"create_time"`
 }
+
+// TypeName -> "deposit", "withdrawal", "interest", "fee", "promo", "cashback" or "expiry"
+func (t WalletTransaction) TypeName() string {
+	switch t.Type {
+	case withdrawalType:
+		return "withdrawal"
+	case interestType:
+		return "interest"
+	case feeType:
+		return "fee"
+	case promoType:
+		return "promo"
+	case cashbackType:
+		return "cashback"
+	case expiryType:
+		return "expiry"
+	}
+
+	return "deposit"
+}
+
+// Debit -> the transaction took money out of the wallet
+func (t WalletTransaction) Debit() bool {
+	return t.Type == withdrawalType || t.Type == feeType || t.Type == expiryType
+}
+
+// SignedAmount -> change of the balance, negative for withdrawals, fees and expiries
+func (t WalletTransaction) SignedAmount() int {
+	if t.Debit() {
+		return -t.Amount
+	}
+
+	return t.Amount
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// route -> a method and path registered through handle
+type route struct {
+	Method string
+	Path   string
+}
+
+var (
+	registeredRoutes []route
+	openAPIDoc       map[string]interface{}
+
+	// openAPIValidate -> OPENAPI_VALIDATE=true checks every response against the spec
+	openAPIValidate = os.Getenv("OPENAPI_VALIDATE") == "true"
+
+	contractViolations = newCounterVec(
+		"wallet_contract_violations_total",
+		"Responses that do not match the OpenAPI document, only counted with OPENAPI_VALIDATE=true.",
+		"route", "method", "code",
+	)
+)
+
+// initOpenAPI -> parse the spec and make sure it documents exactly the registered routes
+func initOpenAPI(ctx context.Context) {
+	err := json.Unmarshal([]byte(openAPISpec), &openAPIDoc)
+	if err != nil {
+		logFatal(ctx, "initOpenAPI Unmarshal", err)
+	}
+
+	missing, undocumented := diffOpenAPIRoutes(registeredRoutes)
+	if len(missing) > 0 || len(undocumented) > 0 {
+		logFatal(ctx, "initOpenAPI diffOpenAPIRoutes", fmt.Errorf(
+			"spec out of sync with router, undocumented routes: %v, documented but not registered: %v",
+			undocumented, missing,
+		))
+	}
+}
+
+// diffOpenAPIRoutes -> spec operations that are not registered, and registered routes not in the spec
+func diffOpenAPIRoutes(routes []route) (missing, undocumented []string) {
+	registered := map[string]bool{}
+	for _, r := range routes {
+		key := r.Method + " " + openAPIPath(r.Path)
+		registered[key] = true
+
+		if openAPIOperation(r.Method, r.Path) == nil {
+			undocumented = append(undocumented, key)
+		}
+	}
+
+	paths, _ := openAPIDoc["paths"].(map[string]interface{})
+	for path, item := range paths {
+		operations, _ := item.(map[string]interface{})
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+
+			key := strings.ToUpper(method) + " " + path
+			if !registered[key] {
+				missing = append(missing, key)
+			}
+		}
+	}
+
+	sort.Strings(missing)
+	sort.Strings(undocumented)
+
+	return
+}
+
+// openAPIPath -> httprouter "/x/:id" to openapi "/x/{id}"
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func openAPIOperation(method, path string) map[string]interface{} {
+	paths, _ := openAPIDoc["paths"].(map[string]interface{})
+	item, _ := paths[openAPIPath(path)].(map[string]interface{})
+	operation, _ := item[strings.ToLower(method)].(map[string]interface{})
+
+	return operation
+}
+
+// HandleOpenAPI -> Serve the OpenAPI document of this service
+func HandleOpenAPI(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(openAPISpec))
+}
+
+// ValidateResponse -> check the response of a route against its documented schema
+func ValidateResponse(method, path string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		recorder := &bodyRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(recorder, r, ps)
+
+		violations := validateOpenAPIResponse(method, path, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		if len(violations) == 0 {
+			return
+		}
+
+		contractViolations.add(1, path, method, strconv.Itoa(recorder.status))
+		logError(r.Context(), "ValidateResponse contract violation",
+			fmt.Errorf("%s", strings.Join(violations, "; ")),
+			"route", path, "method", method, "code", recorder.status,
+		)
+	}
+}
+
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bodyRecorder) WriteHeader(code int) {
+	b.status = code
+	b.ResponseWriter.WriteHeader(code)
+}
+
+func (b *bodyRecorder) Write(p []byte) (int, error) {
+	b.body.Write(p)
+	return b.ResponseWriter.Write(p)
+}
+
+func (b *bodyRecorder) Flush() {
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (b *bodyRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := b.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not a http.Hijacker", b.ResponseWriter)
+	}
+
+	b.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// validateOpenAPIResponse -> list of ways a response does not match the spec, empty when it does
+func validateOpenAPIResponse(method, path string, status int, contentType string, body []byte) (violations []string) {
+	operation := openAPIOperation(method, path)
+	if operation == nil {
+		return []string{"operation not documented"}
+	}
+
+	responses, _ := operation["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = responses["default"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("status %d not documented", status)}
+	}
+
+	content, _ := resolveRef(response)["content"].(map[string]interface{})
+	if content == nil && len(body) == 0 {
+		return
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("content type %q not documented for status %d", mediaType, status)}
+	}
+
+	schema, _ := media["schema"].(map[string]interface{})
+	if mediaType != contentTypeJSON || schema == nil {
+		return
+	}
+
+	var value interface{}
+	err := json.Unmarshal(body, &value)
+	if err != nil {
+		return []string{"body is not json: " + err.Error()}
+	}
+
+	return validateSchema(schema, value, "$")
+}
+
+// resolveRef -> follow a local "#/..." $ref, anything else is returned as is
+func resolveRef(node interface{}) map[string]interface{} {
+	m, _ := node.(map[string]interface{})
+	for depth := 0; m != nil && depth < 16; depth++ {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+
+		var target interface{} = openAPIDoc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			parent, _ := target.(map[string]interface{})
+			target = parent[part]
+		}
+		m, _ = target.(map[string]interface{})
+	}
+
+	return m
+}
+
+// validateSchema -> the subset of json schema the spec uses: type, enum, required,
+// properties, additionalProperties, items and minimum
+func validateSchema(node map[string]interface{}, value interface{}, at string) (violations []string) {
+	schema := resolveRef(node)
+	if schema == nil {
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		violations = append(violations, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(violations, at+": not an object")
+		}
+
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					violations = append(violations, fmt.Sprintf("%s: missing %s", at, name))
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, field := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				violations = append(violations, validateSchema(property, field, at+"."+name)...)
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					violations = append(violations, fmt.Sprintf("%s: unexpected %s", at, name))
+				}
+			case map[string]interface{}:
+				violations = append(violations, validateSchema(additional, field, at+"."+name)...)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(violations, at+": not an array")
+		}
+
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		for i, item := range items {
+			violations = append(violations, validateSchema(itemSchema, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			violations = append(violations, at+": not a string")
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return append(violations, at+": not a number")
+		}
+		if schema["type"] == "integer" && n != math.Trunc(n) {
+			violations = append(violations, at+": not an integer")
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			violations = append(violations, fmt.Sprintf("%s: %v is below %v", at, n, minimum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			violations = append(violations, at+": not a boolean")
+		}
+	}
+
+	return
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,3698 @@
+package main
+
+// openAPISpec -> OpenAPI 3 document for every route registered in main.go.
+// Routes are checked against it on startup, see initOpenAPI.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "wallet service",
+    "description": "Simple wallet backend service. Request bodies are application/x-www-form-urlencoded or application/json.",
+    "version": "1.0.0"
+  },
+  "servers": [{"url": "http://localhost:8000"}],
+  "security": [{"token": []}],
+  "paths": {
+    "/api/v1/init": {
+      "post": {
+        "summary": "Initialize my account for wallet",
+        "operationId": "initAccount",
+        "security": [],
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {"$ref": "#/components/requestBodies/InitAccount"},
+        "responses": {
+          "201": {"description": "Account created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InitAccountResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet": {
+      "post": {
+        "summary": "Enable my wallet",
+        "operationId": "enableWallet",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "responses": {
+          "201": {"$ref": "#/components/responses/Wallet"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "View my wallet balance",
+        "operationId": "viewBalance",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Wallet"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "patch": {
+        "summary": "Disable my wallet",
+        "operationId": "disableWallet",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "responses": {
+          "201": {"$ref": "#/components/responses/Wallet"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/deposits": {
+      "post": {
+        "summary": "Add virtual money to my wallet",
+        "operationId": "deposit",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {"$ref": "#/components/requestBodies/BalanceChange"},
+        "responses": {
+          "201": {"description": "Deposit done", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DepositResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/withdrawals": {
+      "post": {
+        "summary": "Use virtual money from my wallet",
+        "description": "The fee of the fee schedule in effect is debited from the same pocket as a separate fee transaction in the same database transaction, see GET /api/v1/wallet/fees/quote. The pocket must hold amount plus the fee. The withdrawal earns points by the rule of merchant_category, or the default rule, see GET /api/v1/wallet/points.",
+        "operationId": "withdraw",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/WithdrawalRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/WithdrawalRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Withdrawal done", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WithdrawalResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/transactions": {
+      "get": {
+        "summary": "View my wallet transactions, newest first",
+        "operationId": "listTransactions",
+        "parameters": [{"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}],
+        "responses": {
+          "200": {"description": "Transactions", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransactionsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/statements": {
+      "get": {
+        "summary": "Download the statement of my wallet for one month",
+        "description": "Opening balance, every transaction of the UTC month with the running balance, totals by type and the closing balance. Months that are over are generated once and stored, the running month is generated on every call.",
+        "operationId": "getStatement",
+        "parameters": [
+          {"name": "month", "in": "query", "required": true, "schema": {"type": "string", "pattern": "^[0-9]{4}-[0-9]{2}$"}, "example": "2026-09"},
+          {"name": "format", "in": "query", "required": false, "schema": {"type": "string", "enum": ["csv", "pdf"], "default": "csv"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Statement file, sent as an attachment",
+            "content": {
+              "text/csv": {"schema": {"type": "string"}},
+              "application/pdf": {"schema": {"type": "string", "format": "binary"}}
+            }
+          },
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/stream": {
+      "get": {
+        "summary": "Stream the changes of my wallet as server-sent events",
+        "description": "Every event carries its per wallet sequence as the SSE id, send it back in Last-Event-ID to resume. Comment lines are sent as heartbeats. A stream that falls behind gets an error event with code SLOW_CONSUMER and is closed.",
+        "operationId": "streamWallet",
+        "parameters": [{"name": "Last-Event-ID", "in": "header", "required": false, "schema": {"type": "integer", "minimum": 0}}],
+        "responses": {
+          "200": {"description": "text/event-stream of WalletEvent data", "content": {"text/event-stream": {"schema": {"type": "string"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/watchers": {
+      "get": {
+        "summary": "View who may watch my wallet",
+        "operationId": "listWalletWatchers",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletWatchers"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/watchers/{user_id}": {
+      "parameters": [{"name": "user_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "put": {
+        "summary": "Allow a user to watch my wallet over the watch websocket",
+        "operationId": "grantWalletWatcher",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletWatchers"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Stop a user from watching my wallet",
+        "description": "Applies to new subscriptions, a connection already watching the wallet keeps it until it unsubscribes or reconnects.",
+        "operationId": "revokeWalletWatcher",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletWatchers"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/transfers": {
+      "post": {
+        "summary": "Send virtual money from my wallet to the wallet of another user",
+        "description": "Written as a withdrawal from my wallet and a deposit to the recipient's, both with reference_id transfer:<transfer id>, in one database transaction. The sender pays the transfer fee in effect from the main pocket as a separate fee transaction in the same database transaction. reference_id is unique across transfers.",
+        "operationId": "transfer",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/TransferRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/TransferRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Transfer done", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TransferResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/pockets": {
+      "post": {
+        "summary": "Add a named pocket to my wallet",
+        "description": "Pockets split the balance of a wallet for budgeting. Every wallet has a main pocket that deposits, withdrawals and transfers use unless a deposit or withdrawal names another pocket_id. Names are unique per wallet ignoring case, a wallet has at most 20 pockets.",
+        "operationId": "createPocket",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/PocketRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/PocketRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Pocket"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "View the pockets of my wallet, main first",
+        "operationId": "listPockets",
+        "responses": {
+          "200": {"description": "Pockets", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PocketsResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/pockets/moves": {
+      "post": {
+        "summary": "Move money between two pockets of my wallet",
+        "description": "Takes effect at once and leaves the balance of the wallet as it is, so no wallet transaction or event is recorded. Both pockets list the move in their transactions.",
+        "operationId": "movePocketMoney",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/PocketMoveRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/PocketMoveRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Money moved", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PocketMoveResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/pockets/{pocket_id}": {
+      "parameters": [{"name": "pocket_id", "in": "path", "required": true, "schema": {"type": "string"}, "description": "Pocket id, or main"}],
+      "delete": {
+        "summary": "Delete a pocket, its balance goes back to the main pocket",
+        "operationId": "deletePocket",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Pocket"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/pockets/{pocket_id}/transactions": {
+      "parameters": [{"name": "pocket_id", "in": "path", "required": true, "schema": {"type": "string"}, "description": "Pocket id, or main"}],
+      "get": {
+        "summary": "View the changes of one pocket, newest first",
+        "operationId": "listPocketTransactions",
+        "parameters": [{"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}],
+        "responses": {
+          "200": {"description": "Pocket transactions", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PocketTransactionsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/goals": {
+      "post": {
+        "summary": "Start saving up for a goal",
+        "description": "A goal saves up to target_amount by target_date in a pocket of its own, named after it. With round_up_unit every withdrawal is rounded up to a multiple of it and the difference moved to the goal, with deposit_percent that share of every deposit is. Rules move money in the same database transaction as the deposit or withdrawal, from the pocket it used, never past the target, and are left out when that pocket cannot pay them. 0 turns a rule off.",
+        "operationId": "createGoal",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/GoalRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/GoalRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Goal"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "View my savings goals with their progress, active ones first",
+        "operationId": "listGoals",
+        "responses": {
+          "200": {"description": "Goals", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GoalsResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/goals/{goal_id}": {
+      "parameters": [{"name": "goal_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "View a savings goal with its progress and projected completion",
+        "operationId": "getGoal",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Goal"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Cancel a savings goal, what it saved goes back to the main pocket",
+        "operationId": "cancelGoal",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Goal"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/goals/{goal_id}/rules": {
+      "parameters": [{"name": "goal_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "put": {
+        "summary": "Replace the automatic contributions of a savings goal",
+        "operationId": "setGoalRules",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/GoalRulesRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/GoalRulesRequest"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Goal"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/goals/{goal_id}/history": {
+      "parameters": [{"name": "goal_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "View what went in and out of a savings goal, newest first",
+        "operationId": "goalHistory",
+        "parameters": [{"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}],
+        "responses": {
+          "200": {"description": "Goal history", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GoalHistoryResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/interest": {
+      "get": {
+        "summary": "View the interest accrued on my wallet and what was posted",
+        "description": "Interest accrues every day on the balance at the end of the day (UTC) and is posted to the main pocket once a month as an interest transaction. accrued is what is not posted yet, in fractions of the smallest unit; it is negative when a backdated rate cut lowered interest already posted, and is then held back from later postings. Accruals are the last 31 days that earned interest, postings the last 12 months.",
+        "operationId": "viewInterest",
+        "responses": {
+          "200": {"description": "Interest account", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InterestResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/fees/quote": {
+      "get": {
+        "summary": "The fee I would pay now on a withdrawal or transfer",
+        "description": "The fee schedule in effect today (UTC) for transaction_type that matches the KYC tier and currency of my wallet, the most specific one winning. Every wallet is kyc_tier basic and currency IDR for now. fee is 0 without fee_schedule_id when no schedule matches.",
+        "operationId": "quoteFee",
+        "parameters": [
+          {"name": "transaction_type", "in": "query", "required": true, "schema": {"type": "string", "enum": ["withdrawal", "transfer"]}},
+          {"name": "amount", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1}}
+        ],
+        "responses": {
+          "200": {"description": "Fee quote", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FeeQuoteResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/vouchers/redeem": {
+      "post": {
+        "summary": "Redeem a voucher code into my wallet",
+        "description": "Credits the amount of the campaign of code to my main pocket as a promo transaction. Case, spaces and dashes in code do not matter. A code is redeemed once, and VOUCHER_UNAVAILABLE is returned once it was redeemed, expired, the campaign budget is used up or I redeemed per_user_cap codes of the campaign.",
+        "operationId": "redeemVoucher",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/RedeemVoucherRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/RedeemVoucherRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Voucher redeemed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/VoucherRedemptionResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/points": {
+      "get": {
+        "summary": "View my points, what they are worth and the latest entries",
+        "description": "Withdrawals earn points that expire after the expiry of the program, the ones that expire first are used first. value is balance times the point value. next_expiring holds the points that expire on the day the first of them do.",
+        "operationId": "viewPoints",
+        "parameters": [{"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}],
+        "responses": {
+          "200": {"description": "Points", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PointsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/points/redeem": {
+      "post": {
+        "summary": "Turn my points into balance",
+        "description": "Credits points times the point value to my main pocket as a cashback transaction, using the points that expire first.",
+        "operationId": "redeemPoints",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/RedeemPointsRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/RedeemPointsRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Points redeemed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PointsRedemptionResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/schedules": {
+      "post": {
+        "summary": "Create a standing order from my wallet",
+        "description": "A withdrawal, or a transfer to to_user_id, of amount at every occurrence of cron (five fields, UTC) or every interval from start_at. When the balance is short a run is skipped, or with on_insufficient_funds retry tried again every retry_interval up to max_retries times, never past the next occurrence. Occurrences missed while the service is down are not made up for.",
+        "operationId": "createSchedule",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/ScheduleRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/ScheduleRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Schedule"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "View the standing orders of my wallet",
+        "operationId": "listSchedules",
+        "responses": {
+          "200": {"description": "Schedules, cancelled ones included", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SchedulesResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/schedules/{schedule_id}": {
+      "parameters": [{"name": "schedule_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "View a standing order with its latest 20 runs",
+        "operationId": "getSchedule",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Schedule"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Cancel a standing order for good",
+        "operationId": "cancelSchedule",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Schedule"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/schedules/{schedule_id}/pause": {
+      "parameters": [{"name": "schedule_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Stop running a standing order until it is resumed",
+        "operationId": "pauseSchedule",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Schedule"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/schedules/{schedule_id}/resume": {
+      "parameters": [{"name": "schedule_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Run a paused standing order again from its next occurrence",
+        "operationId": "resumeSchedule",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Schedule"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payments/{payment_id}": {
+      "parameters": [{"name": "payment_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "View a payment a merchant asked of me",
+        "description": "A payment is visible to the customer it asks for, or to anyone when it asks for no customer until someone approves or declines it.",
+        "operationId": "viewPayment",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletPayment"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payments/{payment_id}/approve": {
+      "parameters": [{"name": "payment_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Pay a payment a merchant asked of me from my main pocket",
+        "description": "Withdraws the amount from my main pocket with reference_id payment:<payment_id>, and earns points by the category of the merchant. PAYMENT_UNAVAILABLE once it was paid, declined or expired.",
+        "operationId": "approvePayment",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "responses": {
+          "201": {"$ref": "#/components/responses/WalletPayment"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payments/{payment_id}/decline": {
+      "parameters": [{"name": "payment_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Turn down a payment a merchant asked of me",
+        "operationId": "declinePayment",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletPayment"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payment-requests": {
+      "post": {
+        "summary": "Ask other customers for a share each, e.g. to split a bill",
+        "description": "payers lists user_id:amount pairs, e.g. alice:5000,bob:7500, at most 20 distinct customers with an enabled wallet, never myself. The request is open until every payer answered or until expires_at (default 7 days, at most 30 days).",
+        "operationId": "createPaymentRequest",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/NewPaymentRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/NewPaymentRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/WalletPaymentRequest"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "The latest payment requests I sent, or was asked to pay, newest first",
+        "description": "A request I was asked to pay lists my share only.",
+        "operationId": "listPaymentRequests",
+        "parameters": [
+          {"name": "role", "in": "query", "required": false, "schema": {"type": "string", "enum": ["sent", "received"], "default": "sent"}},
+          {"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Payment requests", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WalletPaymentRequestsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payment-requests/{request_id}": {
+      "parameters": [{"name": "request_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "A payment request I sent with the status of every payer, or my share of one I was asked to pay",
+        "operationId": "viewPaymentRequest",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletPaymentRequest"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payment-requests/{request_id}/accept": {
+      "parameters": [{"name": "request_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Pay my share of a payment request",
+        "description": "Transfers the share from my main pocket to the requester with reference_id payment_request:<share id>, the transfer fee is paid on top. The transfer, my answer and the status of the request are written together. PAYMENT_UNAVAILABLE once I answered or the request was settled, closed, cancelled or expired.",
+        "operationId": "acceptPaymentRequest",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "responses": {
+          "201": {"description": "My share and the transfer that paid it", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WalletPaymentRequestAcceptedResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payment-requests/{request_id}/decline": {
+      "parameters": [{"name": "request_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Turn down my share of a payment request",
+        "operationId": "declinePaymentRequest",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletPaymentRequest"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/payment-requests/{request_id}/cancel": {
+      "parameters": [{"name": "request_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Withdraw an open payment request I sent",
+        "description": "The pending shares are cancelled, the shares paid so far stay paid.",
+        "operationId": "cancelPaymentRequest",
+        "responses": {
+          "200": {"$ref": "#/components/responses/WalletPaymentRequest"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/escrows": {
+      "post": {
+        "summary": "Hold money for a seller until I release it",
+        "description": "Withdraws the amount from my main pocket into the escrow system account with reference_id escrow:<escrow_id>. The seller needs an enabled wallet and is never myself. A funded escrow is refunded to me once expires_at passes (default 14 days, at most 90 days) unless it was released, refunded or disputed before.",
+        "operationId": "createEscrow",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/NewEscrow"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/NewEscrow"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Escrow"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "The latest escrows I buy, or sell, newest first",
+        "operationId": "listEscrows",
+        "parameters": [
+          {"name": "role", "in": "query", "required": false, "schema": {"type": "string", "enum": ["buyer", "seller"], "default": "buyer"}},
+          {"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Escrows without their events", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/EscrowsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/escrows/{escrow_id}": {
+      "parameters": [{"name": "escrow_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "An escrow I buy or sell with its history",
+        "operationId": "viewEscrow",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Escrow"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/escrows/{escrow_id}/release": {
+      "parameters": [{"name": "escrow_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "As the buyer, confirm and pay the seller",
+        "description": "Deposits the amount from the escrow system account to the main pocket of the seller with reference_id escrow:<escrow_id>. An escrow is released or refunded once, ESCROW_UNAVAILABLE after that or while it is disputed.",
+        "operationId": "releaseEscrow",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {"$ref": "#/components/requestBodies/EscrowNote"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Escrow"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/escrows/{escrow_id}/refund": {
+      "parameters": [{"name": "escrow_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "As the seller, give the money back to the buyer",
+        "description": "Deposits the amount from the escrow system account to the main pocket of the buyer with reference_id escrow:<escrow_id>. An escrow is released or refunded once, ESCROW_UNAVAILABLE after that or while it is disputed.",
+        "operationId": "refundEscrow",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {"$ref": "#/components/requestBodies/EscrowNote"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Escrow"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/escrows/{escrow_id}/dispute": {
+      "parameters": [{"name": "escrow_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "As the buyer or the seller, hold a funded escrow for an admin to decide",
+        "description": "note is the reason. A disputed escrow no longer times out, only an admin releases or refunds it.",
+        "operationId": "disputeEscrow",
+        "requestBody": {"$ref": "#/components/requestBodies/EscrowNote"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Escrow"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/disputes": {
+      "post": {
+        "summary": "Contest a withdrawal or a fee of my wallet",
+        "description": "amount defaults to the whole transaction and is at most its amount. A transaction is disputed once, within 120 days, and not once it was reversed. The dispute is open until an admin picks it up, due within 2 days.",
+        "operationId": "openDispute",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/NewDispute"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/NewDispute"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Dispute"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "The latest disputes of my wallet, newest first",
+        "operationId": "listDisputes",
+        "parameters": [
+          {"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Disputes without their notes", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DisputesResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/disputes/{dispute_id}": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "A dispute of my wallet with its notes, internal notes of admins left out",
+        "operationId": "viewDispute",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Dispute"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/disputes/{dispute_id}/notes": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Add evidence to a dispute of my wallet",
+        "description": "A dispute that needs information is back in reviewing once I add a note. DISPUTE_UNAVAILABLE once it was resolved.",
+        "operationId": "addDisputeEvidence",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/RequiredDisputeNote"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/RequiredDisputeNote"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Dispute"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/wallet/disputes/{dispute_id}/withdraw": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Drop a dispute of my wallet",
+        "description": "A provisional credit is taken back from my main pocket, as much of it as the main pocket holds. DISPUTE_UNAVAILABLE once it was resolved.",
+        "operationId": "withdrawDispute",
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {"$ref": "#/components/requestBodies/DisputeNote"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Dispute"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/watch": {
+      "get": {
+        "summary": "Watch many wallets over one websocket",
+        "description": "Upgrades to a websocket of JSON text messages. Clients send WatchClientMessage and receive WatchServerMessage. Events carry the per wallet sequence: acknowledge them with an ack message, and resume after a reconnect by subscribing with the last sequence seen per wallet in after. At most 256 events are sent unacknowledged, a client that lets 4096 more pile up gets an error with code SLOW_CONSUMER and is closed with status 1008.",
+        "operationId": "watchWallets",
+        "parameters": [
+          {"name": "Upgrade", "in": "header", "required": true, "schema": {"type": "string", "enum": ["websocket"]}},
+          {"name": "Sec-WebSocket-Key", "in": "header", "required": true, "schema": {"type": "string"}},
+          {"name": "Sec-WebSocket-Version", "in": "header", "required": true, "schema": {"type": "string", "enum": ["13"]}}
+        ],
+        "responses": {
+          "101": {"description": "Switched to the websocket protocol"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/rate-limits/{user_id}": {
+      "parameters": [{"name": "user_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: view rate limits of a user",
+        "operationId": "getRateLimits",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/RateLimits"},
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Admin: override the rate limit of a user for one route group",
+        "operationId": "setRateLimit",
+        "security": [{"adminToken": []}],
+        "requestBody": {"$ref": "#/components/requestBodies/RateLimit"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/RateLimits"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Admin: drop a rate limit override",
+        "operationId": "deleteRateLimit",
+        "security": [{"adminToken": []}],
+        "parameters": [{"name": "group", "in": "query", "required": true, "schema": {"$ref": "#/components/schemas/RateLimitGroup"}}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/RateLimits"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/batches": {
+      "post": {
+        "summary": "Admin: upload a csv of deposits and payouts",
+        "description": "The file needs a header naming the columns customer_xid, amount, reference_id and type (deposit or payout), in any order. Every row is validated as a dry run against the current balances: a batch with any invalid row gets status invalid and cannot be applied. A reference_id already applied to the same wallet with the same amount is valid and skipped when applying, so a file can be uploaded again after a partial run.",
+        "operationId": "createBatch",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "text/csv": {"schema": {"type": "string"}},
+            "multipart/form-data": {"schema": {"type": "object", "required": ["file"], "properties": {"file": {"type": "string", "format": "binary"}}}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Batch"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/batches/{batch_id}": {
+      "parameters": [{"name": "batch_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: view a batch and its rows counted by status",
+        "operationId": "getBatch",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Batch"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/batches/{batch_id}/apply": {
+      "parameters": [{"name": "batch_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: apply a validated batch in the background",
+        "description": "Rows are applied in file order, in chunks of 100 whose results are saved together. A batch left applying by a crash is resumed on startup or by calling this again, rows are never applied twice because their reference_id is found already applied. Applying a completed batch does nothing.",
+        "operationId": "applyBatch",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "202": {"$ref": "#/components/responses/Batch"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/batches/{batch_id}/results": {
+      "parameters": [{"name": "batch_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: download every row of a batch with its result",
+        "description": "csv with the columns line, customer_xid, amount, reference_id, type, status (valid, invalid, applied, skipped or failed), transaction_id and error.",
+        "operationId": "getBatchResults",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "Result file, sent as an attachment", "content": {"text/csv": {"schema": {"type": "string"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/interest/rates": {
+      "get": {
+        "summary": "Admin: list the interest rate plans and how far interest is accrued",
+        "operationId": "listInterestRates",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "Interest rate plans, oldest first", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InterestRatesResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/interest/rates/{effective_from}": {
+      "parameters": [{"name": "effective_from", "in": "path", "required": true, "schema": {"type": "string", "format": "date"}}],
+      "put": {
+        "summary": "Admin: set the interest rates from a day on, until the next plan",
+        "description": "tiers are marginal bands as from:rate_bps separated by commas, e.g. 0:200,1000000:100 pays 2% a year on the first 1000000 and 1% on the rest; the first band starts at 0. A plan taking effect on a day already accrued makes the next run recalculate from that day, and the difference is settled by the next monthly posting.",
+        "operationId": "setInterestRate",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/InterestRateRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/InterestRateRequest"}}
+          }
+        },
+        "responses": {
+          "200": {"description": "Interest rate plan", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InterestRateSetResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/interest/run": {
+      "post": {
+        "summary": "Admin: accrue and post interest now",
+        "description": "Accrues the days from from through through (by default after the last accrued day, or from a pending recalculation, through the last day that is over), then posts every fully accrued month not posted yet. The daily job runs the same way shortly after midnight UTC; running the same days again gives the same accruals.",
+        "operationId": "runInterest",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": false,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/InterestRunRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/InterestRunRequest"}}
+          }
+        },
+        "responses": {
+          "200": {"description": "Interest run", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InterestRunResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/fees": {
+      "get": {
+        "summary": "Admin: list the fee schedules",
+        "operationId": "listFeeSchedules",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "Fee schedules by transaction type and effective date", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FeeSchedulesResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Admin: add a fee schedule",
+        "description": "A flat fee is flat_amount, a percent fee flat_amount plus percent_bps of the amount, a tiered fee flat_amount plus the rates of the tiers the amount spans (tiers like 0:100,1000000:50). The result is rounded half up and kept between min_fee and max_fee, max_fee 0 is no cap. kyc_tier and currency left empty match any wallet. The schedule is in effect from effective_from until the day before effective_to.",
+        "operationId": "createFeeSchedule",
+        "security": [{"adminToken": []}],
+        "requestBody": {"$ref": "#/components/requestBodies/FeeSchedule"},
+        "responses": {
+          "201": {"$ref": "#/components/responses/FeeSchedule"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/fees/{fee_schedule_id}": {
+      "parameters": [{"name": "fee_schedule_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: view a fee schedule",
+        "operationId": "getFeeSchedule",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/FeeSchedule"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Admin: replace a fee schedule, fees already charged keep their amount",
+        "operationId": "updateFeeSchedule",
+        "security": [{"adminToken": []}],
+        "requestBody": {"$ref": "#/components/requestBodies/FeeSchedule"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/FeeSchedule"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Admin: drop a fee schedule, fees already charged keep their amount",
+        "operationId": "deleteFeeSchedule",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/FeeSchedule"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/vouchers": {
+      "get": {
+        "summary": "Admin: list the voucher campaigns with their remaining budget",
+        "operationId": "listVoucherCampaigns",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "Voucher campaigns, newest first", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/VoucherCampaignsResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Admin: generate a campaign of voucher codes",
+        "description": "count codes (at most 10000) each worth amount, redeemable until expires_at. A user redeems at most per_user_cap codes of the campaign (default 1), and the campaign pays out at most budget (default amount times count). Vouchers are paid from the promotions system account. A redeemed code is a promo balance bucket that expires credit_days after the redemption, or never for 0.",
+        "operationId": "createVoucherCampaign",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/VoucherCampaignRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/VoucherCampaignRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/VoucherCampaign"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/vouchers/{campaign_id}": {
+      "parameters": [{"name": "campaign_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: view a voucher campaign and who redeemed its codes",
+        "operationId": "getVoucherCampaign",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/VoucherCampaign"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/points": {
+      "get": {
+        "summary": "Admin: the points program and the earn rules",
+        "operationId": "pointsSettings",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "Points program and rules", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PointsSettingsResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/points/program": {
+      "put": {
+        "summary": "Admin: set how long points last and what a point is worth",
+        "description": "Points earned from now on expire expiry_days after they were earned, points already earned keep their expiry. Redemptions pay point_value per point.",
+        "operationId": "setPointsProgram",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/PointsProgramRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/PointsProgramRequest"}}
+          }
+        },
+        "responses": {
+          "200": {"description": "Points program", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PointsProgramResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/points/rules/{category}": {
+      "parameters": [{"name": "category", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[a-z0-9_]{1,50}$"}, "description": "Merchant category, or default for withdrawals without a rule of their own"}],
+      "put": {
+        "summary": "Admin: add or replace the earn rule of a merchant category",
+        "description": "A withdrawal earns multiplier_pct percent of one point per spend_per_point spent, rounded down. multiplier_pct 0 is 100.",
+        "operationId": "setPointsRule",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/PointsRuleRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/PointsRuleRequest"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/PointsRule"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Admin: drop the earn rule of a merchant category",
+        "operationId": "deletePointsRule",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/PointsRule"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/transactions/{transaction_id}/reverse": {
+      "parameters": [{"name": "transaction_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: give a withdrawal back",
+        "description": "Deposits the amount of the withdrawal to the main pocket of its wallet and takes back the points it earned and that did not expire, from its own lot first and then from the points that expire first. The fee it paid is kept. A withdrawal is reversed once, DUPLICATE_REFERENCE after that, and DISPUTE_UNAVAILABLE while a dispute of it may still credit it.",
+        "operationId": "reverseTransaction",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": false,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/ReverseTransactionRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/ReverseTransactionRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Withdrawal reversed", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ReversalResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/credits/{user_id}": {
+      "parameters": [{"name": "user_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: credit a wallet with promo or refund money",
+        "description": "Credits amount to the main pocket of the enabled wallet of the user, paid from the promotions system account, as a promo transaction for source promo and a deposit for source refund. The credit is a balance bucket that debits spend before cash, soonest expiry first. What is left of it at expires_at is debited as an expiry transaction into the breakage system account.",
+        "operationId": "creditWallet",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/CreditRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/CreditRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Wallet credited", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CreditResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/accounts": {
+      "get": {
+        "summary": "Admin: the system accounts and their balances",
+        "description": "System accounts hold money that left the wallets or was paid to them, revenue holds the fees, promotions the vouchers and credits paid out and breakage the credits that expired unspent. An account appears with its first entry.",
+        "operationId": "listSystemAccounts",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "System accounts", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SystemAccountsResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/accounts/{account_id}/entries": {
+      "parameters": [{"name": "account_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: the latest entries of a system account, newest first",
+        "operationId": "systemAccountEntries",
+        "security": [{"adminToken": []}],
+        "parameters": [{"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}],
+        "responses": {
+          "200": {"description": "System account entries", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SystemEntriesResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/merchants": {
+      "get": {
+        "summary": "Admin: list the merchants",
+        "operationId": "listMerchants",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"description": "Merchants, newest first", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MerchantsResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Admin: create a merchant with its settlement wallet and first API key",
+        "description": "Payments to the merchant are credited to its settlement wallet less fee_flat plus fee_bps basis points of the amount, rounded half up and at most the amount, which go to the revenue system account. api_key and webhook_secret are only shown now.",
+        "operationId": "createMerchant",
+        "security": [{"adminToken": []}],
+        "requestBody": {"$ref": "#/components/requestBodies/Merchant"},
+        "responses": {
+          "201": {"$ref": "#/components/responses/Merchant"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/merchants/{merchant_id}": {
+      "parameters": [{"name": "merchant_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: view a merchant with its settlement balance and API keys",
+        "operationId": "getMerchant",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Merchant"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Admin: replace the name, category, webhook url and fees of a merchant",
+        "description": "New fees apply to the payments created after the change.",
+        "operationId": "updateMerchant",
+        "security": [{"adminToken": []}],
+        "requestBody": {"$ref": "#/components/requestBodies/Merchant"},
+        "responses": {
+          "200": {"$ref": "#/components/responses/Merchant"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/merchants/{merchant_id}/keys": {
+      "parameters": [{"name": "merchant_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: issue another API key to a merchant",
+        "description": "The older keys keep working until they are revoked, so keys can be rotated without downtime. api_key is only shown now.",
+        "operationId": "createMerchantKey",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "201": {"description": "API key created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MerchantKeyResponse"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/merchants/{merchant_id}/keys/{key_id}": {
+      "parameters": [
+        {"name": "merchant_id", "in": "path", "required": true, "schema": {"type": "string"}},
+        {"name": "key_id", "in": "path", "required": true, "schema": {"type": "string"}}
+      ],
+      "delete": {
+        "summary": "Admin: revoke an API key of a merchant",
+        "operationId": "revokeMerchantKey",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Merchant"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/escrows": {
+      "get": {
+        "summary": "Admin: the latest escrows, newest first",
+        "operationId": "listAdminEscrows",
+        "security": [{"adminToken": []}],
+        "parameters": [
+          {"name": "status", "in": "query", "required": false, "schema": {"type": "string", "enum": ["funded", "disputed", "released", "refunded"]}},
+          {"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Escrows without their events", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/EscrowsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/escrows/{escrow_id}": {
+      "parameters": [{"name": "escrow_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: an escrow with its history",
+        "operationId": "getAdminEscrow",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Escrow"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/escrows/{escrow_id}/resolve": {
+      "parameters": [{"name": "escrow_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: release a funded or disputed escrow to the seller, or refund it to the buyer",
+        "description": "The note is kept in the history of the escrow. ESCROW_UNAVAILABLE once it was released or refunded.",
+        "operationId": "resolveEscrow",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/EscrowResolution"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/EscrowResolution"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Escrow"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/disputes": {
+      "get": {
+        "summary": "Admin: the latest disputes, newest first",
+        "operationId": "listAdminDisputes",
+        "security": [{"adminToken": []}],
+        "parameters": [
+          {"name": "status", "in": "query", "required": false, "schema": {"type": "string", "enum": ["open", "reviewing", "needs_info", "won", "lost", "withdrawn"]}},
+          {"name": "overdue", "in": "query", "required": false, "schema": {"type": "boolean", "default": false}, "description": "Only the disputes waiting past their due time"},
+          {"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Disputes without their notes", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DisputesResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/disputes/{dispute_id}": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Admin: a dispute with all its notes",
+        "operationId": "getAdminDispute",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Dispute"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/disputes/{dispute_id}/status": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: move a dispute to reviewing or needs_info, or resolve it as won or lost",
+        "description": "note is required but for reviewing. reviewing is due 30 days after the dispute was opened, needs_info asks the customer for evidence due within 7 days. won keeps the provisional credit or credits the amount now, lost takes the provisional credit back. DISPUTE_UNAVAILABLE once it was resolved or when it is already in the status.",
+        "operationId": "moveDispute",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/DisputeStatusChange"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/DisputeStatusChange"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Dispute"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/disputes/{dispute_id}/provisional-credit": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: credit the amount of a dispute to the main pocket of its wallet until it is decided",
+        "description": "Deposits from the disputes system account with reference_id dispute:<dispute_id>, once per dispute. DISPUTE_UNAVAILABLE once it was placed or the dispute was resolved.",
+        "operationId": "placeProvisionalCredit",
+        "security": [{"adminToken": []}],
+        "requestBody": {"$ref": "#/components/requestBodies/DisputeNote"},
+        "responses": {
+          "201": {"$ref": "#/components/responses/Dispute"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/disputes/{dispute_id}/notes": {
+      "parameters": [{"name": "dispute_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Admin: add a note to a dispute that is not resolved, internal notes are not shown to the customer",
+        "operationId": "addAdminDisputeNote",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/AdminDisputeNote"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/AdminDisputeNote"}}
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Dispute"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/merchant": {
+      "get": {
+        "summary": "Merchant: my settings, settlement balance and webhook secret",
+        "operationId": "viewMerchant",
+        "security": [{"merchantKey": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Merchant"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/merchant/payments": {
+      "post": {
+        "summary": "Merchant: ask a customer for a payment of an order",
+        "description": "The payment is pending until a customer approves or declines it, or until expires_at (default 15 minutes, at most 7 days) when it expires. Only customer_id may pay it when it is set, anyone else when it is not. order_id is unique per merchant, DUPLICATE_REFERENCE otherwise. The fee is fixed now by the fees of the merchant.",
+        "operationId": "createPayment",
+        "security": [{"merchantKey": []}],
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/PaymentRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/PaymentRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"$ref": "#/components/responses/Payment"},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "get": {
+        "summary": "Merchant: my latest payments, newest first",
+        "operationId": "listPayments",
+        "security": [{"merchantKey": []}],
+        "parameters": [
+          {"name": "order_id", "in": "query", "required": false, "schema": {"type": "string"}},
+          {"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}
+        ],
+        "responses": {
+          "200": {"description": "Payments", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PaymentsResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/merchant/payments/{payment_id}": {
+      "parameters": [{"name": "payment_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "get": {
+        "summary": "Merchant: the status of a payment and its refunds",
+        "description": "Poll it for merchants that take no webhooks.",
+        "operationId": "getPayment",
+        "security": [{"merchantKey": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Payment"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/merchant/payments/{payment_id}/refunds": {
+      "parameters": [{"name": "payment_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+      "post": {
+        "summary": "Merchant: give back all or part of a paid payment",
+        "description": "Withdraws the amount from my settlement wallet and deposits it to the main pocket of the payer, both with reference_id refund:<refund id>. The fee is kept. Refunds add up to at most the amount, the last one makes the payment refunded and takes back the points it earned. PAYMENT_UNAVAILABLE when it is not paid.",
+        "operationId": "refundPayment",
+        "security": [{"merchantKey": []}],
+        "parameters": [{"$ref": "#/components/parameters/IdempotencyKey"}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/RefundRequest"}},
+            "application/json": {"schema": {"$ref": "#/components/schemas/RefundRequest"}}
+          }
+        },
+        "responses": {
+          "201": {"description": "Payment refunded", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RefundResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "415": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/merchant/webhooks": {
+      "get": {
+        "summary": "Merchant: my latest webhooks and how their delivery went, newest first",
+        "description": "Every change of a payment posts a WebhookEvent to the webhook url of the merchant, with headers X-Wallet-Event, X-Wallet-Delivery (the event id) and X-Wallet-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of \"<unix seconds>.<body>\" keyed by the webhook secret>. Anything but a 2xx answer is retried with a backoff doubling from 30 seconds up to an hour, 8 attempts in all.",
+        "operationId": "listWebhooks",
+        "security": [{"merchantKey": []}],
+        "parameters": [{"name": "limit", "in": "query", "required": false, "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 50}}],
+        "responses": {
+          "200": {"description": "Webhooks", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhooksResponse"}}}},
+          "400": {"$ref": "#/components/responses/ValidationError"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/openapi.json": {
+      "get": {
+        "summary": "This document",
+        "operationId": "openAPI",
+        "security": [],
+        "responses": {
+          "200": {"description": "OpenAPI document", "content": {"application/json": {"schema": {"type": "object"}}}}
+        }
+      }
+    },
+    "/metrics": {
+      "get": {
+        "summary": "Prometheus metrics",
+        "operationId": "metrics",
+        "security": [],
+        "responses": {
+          "200": {"description": "Metrics in prometheus text format", "content": {"text/plain": {"schema": {"type": "string"}}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "token": {"type": "apiKey", "in": "header", "name": "Authorization", "description": "Token <token from /api/v1/init>"},
+      "adminToken": {"type": "apiKey", "in": "header", "name": "Authorization", "description": "Token <ADMIN_TOKEN>"},
+      "merchantKey": {"type": "apiKey", "in": "header", "name": "Authorization", "description": "Token <API key of a merchant>"}
+    },
+    "parameters": {
+      "IdempotencyKey": {
+        "name": "Idempotency-Key",
+        "in": "header",
+        "required": false,
+        "description": "Retries with the same key replay the first response instead of running again, for 24 hours. Replayed responses carry Idempotent-Replayed: true.",
+        "schema": {"type": "string", "maxLength": 255}
+      }
+    },
+    "requestBodies": {
+      "InitAccount": {
+        "required": true,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/InitAccountRequest"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/InitAccountRequest"}}
+        }
+      },
+      "BalanceChange": {
+        "required": true,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/BalanceChangeRequest"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/BalanceChangeRequest"}}
+        }
+      },
+      "FeeSchedule": {
+        "required": true,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/FeeScheduleRequest"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/FeeScheduleRequest"}}
+        }
+      },
+      "Merchant": {
+        "required": true,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/MerchantRequest"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/MerchantRequest"}}
+        }
+      },
+      "RateLimit": {
+        "required": true,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/RateLimitRequest"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/RateLimitRequest"}}
+        }
+      },
+      "DisputeNote": {
+        "required": false,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/DisputeNote"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/DisputeNote"}}
+        }
+      },
+      "EscrowNote": {
+        "required": false,
+        "content": {
+          "application/x-www-form-urlencoded": {"schema": {"$ref": "#/components/schemas/EscrowNote"}},
+          "application/json": {"schema": {"$ref": "#/components/schemas/EscrowNote"}}
+        }
+      }
+    },
+    "responses": {
+      "Error": {"description": "Failure with a machine readable code", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ErrorResponse"}}}},
+      "ValidationError": {"description": "Field level validation errors", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ValidationErrorResponse"}}}},
+      "Wallet": {"description": "Wallet", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WalletResponse"}}}},
+      "RateLimits": {"description": "Effective rate limits of a user", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RateLimitsResponse"}}}},
+      "WalletWatchers": {"description": "Users allowed to watch my wallet", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WalletWatchersResponse"}}}},
+      "Pocket": {"description": "Pocket", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PocketResponse"}}}},
+      "Goal": {"description": "Savings goal", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GoalResponse"}}}},
+      "Schedule": {"description": "Standing order", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ScheduleResponse"}}}},
+      "Batch": {"description": "Batch import", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/BatchResponse"}}}},
+      "FeeSchedule": {"description": "Fee schedule", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FeeScheduleResponse"}}}},
+      "VoucherCampaign": {"description": "Voucher campaign and its codes", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/VoucherCampaignResponse"}}}},
+      "PointsRule": {"description": "Points earn rule", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PointsRuleResponse"}}}},
+      "Merchant": {"description": "Merchant", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/MerchantResponse"}}}},
+      "Payment": {"description": "Payment as its merchant sees it", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/PaymentResponse"}}}},
+      "WalletPayment": {"description": "Payment as the customer sees it", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WalletPaymentResponse"}}}},
+      "WalletPaymentRequest": {"description": "Payment request, with my share only when I was asked to pay it", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WalletPaymentRequestResponse"}}}},
+      "Escrow": {"description": "Escrow with its history", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/EscrowResponse"}}}},
+      "Dispute": {"description": "Dispute with its notes", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DisputeResponse"}}}}
+    },
+    "schemas": {
+      "InitAccountRequest": {
+        "type": "object",
+        "required": ["customer_xid"],
+        "additionalProperties": false,
+        "properties": {"customer_xid": {"type": "string"}}
+      },
+      "BalanceChangeRequest": {
+        "type": "object",
+        "required": ["amount", "reference_id"],
+        "additionalProperties": false,
+        "properties": {
+          "amount": {"type": "integer", "minimum": 0},
+          "reference_id": {"type": "string"},
+          "pocket_id": {"type": "string", "description": "Pocket of my wallet, or main, the main pocket by default"}
+        }
+      },
+      "WithdrawalRequest": {
+        "type": "object",
+        "required": ["amount", "reference_id"],
+        "additionalProperties": false,
+        "properties": {
+          "amount": {"type": "integer", "minimum": 0},
+          "reference_id": {"type": "string"},
+          "pocket_id": {"type": "string", "description": "Pocket of my wallet, or main, the main pocket by default"},
+          "merchant_category": {"type": "string", "pattern": "^[a-z0-9_]{1,50}$", "description": "Picks the points rule, the default rule when empty or without a rule"}
+        }
+      },
+      "TransferRequest": {
+        "type": "object",
+        "required": ["to_user_id", "amount", "reference_id"],
+        "additionalProperties": false,
+        "properties": {
+          "to_user_id": {"type": "string"},
+          "amount": {"type": "integer", "minimum": 1},
+          "reference_id": {"type": "string"}
+        }
+      },
+      "Transfer": {
+        "type": "object",
+        "required": ["id", "transferred_by", "to_user_id", "status", "transferred_at", "amount", "reference_id", "withdrawal_id", "deposit_id"],
+        "properties": {
+          "id": {"type": "string"},
+          "transferred_by": {"type": "string"},
+          "to_user_id": {"type": "string"},
+          "status": {"type": "string", "enum": ["success"]},
+          "transferred_at": {"type": "string", "format": "date-time"},
+          "amount": {"type": "integer"},
+          "reference_id": {"type": "string"},
+          "withdrawal_id": {"type": "string", "description": "Transaction of my wallet"},
+          "deposit_id": {"type": "string", "description": "Transaction of the recipient's wallet"},
+          "fee": {"type": "integer", "description": "Paid by me on top of amount"},
+          "fee_transaction_id": {"type": "string", "description": "Fee transaction of my wallet, not set without a fee"}
+        }
+      },
+      "TransferResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["transfer"],
+            "properties": {"transfer": {"$ref": "#/components/schemas/Transfer"}}
+          }
+        }
+      },
+      "PocketRequest": {
+        "type": "object",
+        "required": ["name"],
+        "additionalProperties": false,
+        "properties": {"name": {"type": "string", "minLength": 1, "maxLength": 50}}
+      },
+      "PocketMoveRequest": {
+        "type": "object",
+        "required": ["from_pocket_id", "to_pocket_id", "amount"],
+        "additionalProperties": false,
+        "properties": {
+          "from_pocket_id": {"type": "string", "description": "Pocket id, or main"},
+          "to_pocket_id": {"type": "string", "description": "Pocket id, or main"},
+          "amount": {"type": "integer", "minimum": 1}
+        }
+      },
+      "Pocket": {
+        "type": "object",
+        "required": ["id", "name", "main", "balance", "created_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "main": {"type": "boolean"},
+          "balance": {"type": "integer"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "PocketResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["pocket"],
+            "properties": {"pocket": {"$ref": "#/components/schemas/Pocket"}}
+          }
+        }
+      },
+      "PocketsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["pockets"],
+            "properties": {"pockets": {"type": "array", "items": {"$ref": "#/components/schemas/Pocket"}}}
+          }
+        }
+      },
+      "PocketMoveResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["amount", "from", "to"],
+            "properties": {
+              "amount": {"type": "integer"},
+              "from": {"$ref": "#/components/schemas/Pocket"},
+              "to": {"$ref": "#/components/schemas/Pocket"}
+            }
+          }
+        }
+      },
+      "PocketTransactionsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["pocket", "transactions"],
+            "properties": {
+              "pocket": {"$ref": "#/components/schemas/Pocket"},
+              "transactions": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["id", "type", "amount", "balance", "created_at"],
+                  "properties": {
+                    "id": {"type": "string"},
+                    "type": {"type": "string", "enum": ["deposit", "withdrawal", "interest", "fee", "promo", "cashback", "expiry", "move_in", "move_out"]},
+                    "amount": {"type": "integer", "description": "Negative when money left the pocket"},
+                    "balance": {"type": "integer", "description": "Balance of the pocket after the change"},
+                    "transaction_id": {"type": "string", "description": "Wallet transaction of a deposit or withdrawal, or the one that triggered a goal rule"},
+                    "other_pocket_id": {"type": "string", "description": "Other side of a move"},
+                    "reference_id": {"type": "string"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "GoalRequest": {
+        "type": "object",
+        "required": ["name", "target_amount", "target_date"],
+        "additionalProperties": false,
+        "properties": {
+          "name": {"type": "string", "minLength": 1, "maxLength": 50, "description": "Also the name of its pocket"},
+          "target_amount": {"type": "integer", "minimum": 1},
+          "target_date": {"type": "string", "format": "date"},
+          "round_up_unit": {"type": "integer", "minimum": 0, "default": 0, "description": "0 or at least 2"},
+          "deposit_percent": {"type": "integer", "minimum": 0, "maximum": 100, "default": 0}
+        }
+      },
+      "GoalRulesRequest": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "round_up_unit": {"type": "integer", "minimum": 0, "default": 0, "description": "0 or at least 2"},
+          "deposit_percent": {"type": "integer", "minimum": 0, "maximum": 100, "default": 0}
+        }
+      },
+      "Goal": {
+        "type": "object",
+        "required": ["id", "name", "pocket_id", "target_amount", "target_date", "round_up_unit", "deposit_percent", "status", "saved", "remaining", "progress_percent", "reached", "on_track", "required_per_day", "created_at", "updated_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "pocket_id": {"type": "string"},
+          "target_amount": {"type": "integer"},
+          "target_date": {"type": "string", "format": "date"},
+          "round_up_unit": {"type": "integer"},
+          "deposit_percent": {"type": "integer"},
+          "status": {"type": "string", "enum": ["active", "cancelled"]},
+          "saved": {"type": "integer", "description": "Balance of the pocket of the goal"},
+          "remaining": {"type": "integer"},
+          "progress_percent": {"type": "integer", "minimum": 0, "maximum": 100},
+          "reached": {"type": "boolean"},
+          "on_track": {"type": "boolean", "description": "Reached, or projected to be by target_date"},
+          "required_per_day": {"type": "integer", "description": "Saving needed per day from today to reach the target by target_date"},
+          "projected_date": {"type": "string", "format": "date", "description": "When the target is reached at the pace of the last 30 days, absent when the goal is not growing"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "GoalResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["goal"],
+            "properties": {"goal": {"$ref": "#/components/schemas/Goal"}}
+          }
+        }
+      },
+      "GoalsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["goals"],
+            "properties": {"goals": {"type": "array", "items": {"$ref": "#/components/schemas/Goal"}}}
+          }
+        }
+      },
+      "GoalHistoryResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["goal_id", "history"],
+            "properties": {
+              "goal_id": {"type": "string"},
+              "history": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["id", "type", "amount", "balance", "created_at"],
+                  "properties": {
+                    "id": {"type": "string"},
+                    "type": {"type": "string", "enum": ["deposit", "withdrawal", "interest", "fee", "promo", "cashback", "expiry", "move_in", "move_out"]},
+                    "rule": {"type": "string", "enum": ["round_up", "deposit_percent"], "description": "Set when a goal rule moved the money"},
+                    "amount": {"type": "integer", "description": "Negative when money left the goal"},
+                    "balance": {"type": "integer", "description": "Saved after the change"},
+                    "transaction_id": {"type": "string", "description": "Wallet transaction that triggered the rule, or of a deposit or withdrawal"},
+                    "other_pocket_id": {"type": "string"},
+                    "reference_id": {"type": "string"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "InterestResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["accrued", "postings", "accruals"],
+            "properties": {
+              "accrued": {"type": "string", "description": "Accrued and not posted yet, a decimal of the smallest unit"},
+              "accrued_through": {"type": "string", "format": "date"},
+              "postings": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["month", "amount", "due", "posted_at"],
+                  "properties": {
+                    "month": {"type": "string"},
+                    "amount": {"type": "integer"},
+                    "due": {"type": "string", "description": "Accrued through the month minus what was posted before, before rounding"},
+                    "transaction_id": {"type": "string", "description": "Not set when nothing was credited"},
+                    "posted_at": {"type": "string", "format": "date-time"}
+                  }
+                }
+              },
+              "accruals": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["day", "balance", "rate_from", "interest"],
+                  "properties": {
+                    "day": {"type": "string", "format": "date"},
+                    "balance": {"type": "integer", "description": "Balance at the end of the day"},
+                    "rate_from": {"type": "string", "format": "date", "description": "Effective date of the plan applied"},
+                    "interest": {"type": "string"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "InterestRateRequest": {
+        "type": "object",
+        "required": ["tiers"],
+        "additionalProperties": false,
+        "properties": {
+          "tiers": {"type": "string", "example": "0:200,1000000:100"},
+          "day_count": {"type": "string", "enum": ["act/365", "act/360", "act/act"], "default": "act/365"},
+          "rounding": {"type": "string", "enum": ["half_up", "half_even", "down", "up"], "default": "half_even"}
+        }
+      },
+      "InterestRate": {
+        "type": "object",
+        "required": ["effective_from", "day_count", "rounding", "tiers", "created_at"],
+        "properties": {
+          "effective_from": {"type": "string", "format": "date"},
+          "day_count": {"type": "string", "enum": ["act/365", "act/360", "act/act"]},
+          "rounding": {"type": "string", "enum": ["half_up", "half_even", "down", "up"]},
+          "tiers": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["from", "rate_bps"],
+              "properties": {
+                "from": {"type": "integer"},
+                "rate_bps": {"type": "integer", "description": "Yearly rate in basis points on the balance from from up to the next tier"}
+              }
+            }
+          },
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "InterestRatesResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["rates"],
+            "properties": {
+              "accrued_through": {"type": "string", "format": "date"},
+              "recalculate_from": {"type": "string", "format": "date", "description": "Set when a backdated plan waits for the next run"},
+              "rates": {"type": "array", "items": {"$ref": "#/components/schemas/InterestRate"}}
+            }
+          }
+        }
+      },
+      "InterestRateSetResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["rate"],
+            "properties": {
+              "rate": {"$ref": "#/components/schemas/InterestRate"},
+              "recalculate_from": {"type": "string", "format": "date"}
+            }
+          }
+        }
+      },
+      "InterestRunRequest": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "from": {"type": "string", "format": "date"},
+          "through": {"type": "string", "format": "date"}
+        }
+      },
+      "InterestRunResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["from", "through", "accruals", "postings", "posted"],
+            "properties": {
+              "from": {"type": "string", "format": "date"},
+              "through": {"type": "string", "format": "date"},
+              "accruals": {"type": "integer"},
+              "postings": {"type": "integer"},
+              "posted": {"type": "integer"}
+            }
+          }
+        }
+      },
+      "FeeQuoteResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["transaction_type", "amount", "fee", "total", "kyc_tier", "currency"],
+            "properties": {
+              "transaction_type": {"type": "string", "enum": ["withdrawal", "transfer"]},
+              "amount": {"type": "integer"},
+              "fee": {"type": "integer"},
+              "total": {"type": "integer", "description": "amount plus fee, what leaves the pocket"},
+              "fee_schedule_id": {"type": "string"},
+              "kyc_tier": {"type": "string"},
+              "currency": {"type": "string"}
+            }
+          }
+        }
+      },
+      "FeeScheduleRequest": {
+        "type": "object",
+        "required": ["name", "transaction_type", "kind", "effective_from"],
+        "additionalProperties": false,
+        "properties": {
+          "name": {"type": "string"},
+          "transaction_type": {"type": "string", "enum": ["withdrawal", "transfer"]},
+          "kyc_tier": {"type": "string", "description": "Empty matches any tier"},
+          "currency": {"type": "string", "description": "Empty matches any currency"},
+          "kind": {"type": "string", "enum": ["flat", "percent", "tiered"]},
+          "flat_amount": {"type": "integer", "minimum": 0},
+          "percent_bps": {"type": "integer", "minimum": 0, "maximum": 10000},
+          "tiers": {"type": "string", "example": "0:100,1000000:50"},
+          "min_fee": {"type": "integer", "minimum": 0},
+          "max_fee": {"type": "integer", "minimum": 0, "description": "0 is no cap"},
+          "effective_from": {"type": "string", "format": "date"},
+          "effective_to": {"type": "string", "format": "date", "description": "First day it is no longer in effect, empty for open ended"}
+        }
+      },
+      "FeeSchedule": {
+        "type": "object",
+        "required": ["id", "name", "transaction_type", "kind", "flat_amount", "percent_bps", "min_fee", "max_fee", "effective_from", "created_at", "updated_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "transaction_type": {"type": "string", "enum": ["withdrawal", "transfer"]},
+          "kyc_tier": {"type": "string"},
+          "currency": {"type": "string"},
+          "kind": {"type": "string", "enum": ["flat", "percent", "tiered"]},
+          "flat_amount": {"type": "integer"},
+          "percent_bps": {"type": "integer"},
+          "tiers": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["from", "rate_bps"],
+              "properties": {
+                "from": {"type": "integer"},
+                "rate_bps": {"type": "integer"}
+              }
+            }
+          },
+          "min_fee": {"type": "integer"},
+          "max_fee": {"type": "integer"},
+          "effective_from": {"type": "string", "format": "date"},
+          "effective_to": {"type": "string", "format": "date"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "FeeScheduleResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["fee_schedule"],
+            "properties": {"fee_schedule": {"$ref": "#/components/schemas/FeeSchedule"}}
+          }
+        }
+      },
+      "FeeSchedulesResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["fee_schedules"],
+            "properties": {"fee_schedules": {"type": "array", "items": {"$ref": "#/components/schemas/FeeSchedule"}}}
+          }
+        }
+      },
+      "VoucherCampaignRequest": {
+        "type": "object",
+        "required": ["name", "amount", "count", "expires_at"],
+        "additionalProperties": false,
+        "properties": {
+          "name": {"type": "string", "maxLength": 100},
+          "amount": {"type": "integer", "minimum": 1},
+          "count": {"type": "integer", "minimum": 1, "maximum": 10000},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "per_user_cap": {"type": "integer", "minimum": 0, "description": "0 is 1"},
+          "budget": {"type": "integer", "minimum": 0, "description": "0 is amount times count"},
+          "credit_days": {"type": "integer", "minimum": 0, "maximum": 3650, "description": "Days the credit of a redeemed code lasts, 0 is forever"}
+        }
+      },
+      "VoucherCampaign": {
+        "type": "object",
+        "required": ["id", "name", "amount", "per_user_cap", "budget", "spent", "remaining", "codes", "redeemed", "credit_days", "expires_at", "created_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "amount": {"type": "integer"},
+          "per_user_cap": {"type": "integer"},
+          "budget": {"type": "integer"},
+          "spent": {"type": "integer"},
+          "remaining": {"type": "integer", "description": "budget minus spent"},
+          "codes": {"type": "integer"},
+          "redeemed": {"type": "integer"},
+          "credit_days": {"type": "integer"},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "VoucherCampaignResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["campaign", "codes"],
+            "properties": {
+              "campaign": {"$ref": "#/components/schemas/VoucherCampaign"},
+              "codes": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["code"],
+                  "properties": {
+                    "code": {"type": "string", "example": "ABCD-EFGH-JKLM"},
+                    "redeemed_by": {"type": "string"},
+                    "transaction_id": {"type": "string"},
+                    "redeemed_at": {"type": "string", "format": "date-time"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "VoucherCampaignsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["campaigns"],
+            "properties": {"campaigns": {"type": "array", "items": {"$ref": "#/components/schemas/VoucherCampaign"}}}
+          }
+        }
+      },
+      "RedeemVoucherRequest": {
+        "type": "object",
+        "required": ["code"],
+        "additionalProperties": false,
+        "properties": {
+          "code": {"type": "string"}
+        }
+      },
+      "VoucherRedemptionResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["deposit", "type", "code", "campaign_id", "bucket"],
+            "properties": {
+              "deposit": {
+                "type": "object",
+                "required": ["id", "deposited_by", "status", "deposited_at", "amount", "reference_id"],
+                "properties": {
+                  "id": {"type": "string"},
+                  "deposited_by": {"type": "string"},
+                  "status": {"type": "string", "enum": ["success"]},
+                  "deposited_at": {"type": "string", "format": "date-time"},
+                  "amount": {"type": "integer"},
+                  "reference_id": {"type": "string", "example": "voucher:ABCDEFGHJKLM"}
+                }
+              },
+              "type": {"type": "string", "enum": ["promo"]},
+              "code": {"type": "string"},
+              "campaign_id": {"type": "string"},
+              "bucket": {"$ref": "#/components/schemas/BalanceBucket"}
+            }
+          }
+        }
+      },
+      "PointsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["balance", "value", "entries"],
+            "properties": {
+              "balance": {"type": "integer"},
+              "value": {"type": "integer", "description": "What balance is worth when redeemed now"},
+              "next_expiring": {
+                "type": "object",
+                "required": ["points", "expires_at"],
+                "properties": {
+                  "points": {"type": "integer"},
+                  "expires_at": {"type": "string", "format": "date-time"}
+                }
+              },
+              "entries": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["id", "kind", "points", "balance", "created_at"],
+                  "properties": {
+                    "id": {"type": "string"},
+                    "kind": {"type": "string", "enum": ["earn", "redeem", "expire", "reverse"]},
+                    "points": {"type": "integer", "description": "Negative when points were used"},
+                    "balance": {"type": "integer"},
+                    "transaction_id": {"type": "string", "description": "Withdrawal that earned or was reversed, or cashback of a redemption"},
+                    "created_at": {"type": "string", "format": "date-time"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "RedeemPointsRequest": {
+        "type": "object",
+        "required": ["points"],
+        "additionalProperties": false,
+        "properties": {
+          "points": {"type": "integer", "minimum": 1}
+        }
+      },
+      "PointsRedemptionResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["deposit", "type", "points", "points_balance"],
+            "properties": {
+              "deposit": {
+                "type": "object",
+                "required": ["id", "deposited_by", "status", "deposited_at", "amount", "reference_id"],
+                "properties": {
+                  "id": {"type": "string"},
+                  "deposited_by": {"type": "string"},
+                  "status": {"type": "string", "enum": ["success"]},
+                  "deposited_at": {"type": "string", "format": "date-time"},
+                  "amount": {"type": "integer"},
+                  "reference_id": {"type": "string"}
+                }
+              },
+              "type": {"type": "string", "enum": ["cashback"]},
+              "points": {"type": "integer"},
+              "points_balance": {"type": "integer"}
+            }
+          }
+        }
+      },
+      "PointsProgramRequest": {
+        "type": "object",
+        "required": ["expiry_days", "point_value"],
+        "additionalProperties": false,
+        "properties": {
+          "expiry_days": {"type": "integer", "minimum": 1, "maximum": 3650},
+          "point_value": {"type": "integer", "minimum": 1}
+        }
+      },
+      "PointsProgram": {
+        "type": "object",
+        "required": ["expiry_days", "point_value"],
+        "properties": {
+          "expiry_days": {"type": "integer"},
+          "point_value": {"type": "integer"},
+          "updated_at": {"type": "string", "format": "date-time", "description": "Missing while the defaults apply"}
+        }
+      },
+      "PointsProgramResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["program"],
+            "properties": {"program": {"$ref": "#/components/schemas/PointsProgram"}}
+          }
+        }
+      },
+      "PointsRuleRequest": {
+        "type": "object",
+        "required": ["spend_per_point"],
+        "additionalProperties": false,
+        "properties": {
+          "spend_per_point": {"type": "integer", "minimum": 1},
+          "multiplier_pct": {"type": "integer", "minimum": 0}
+        }
+      },
+      "PointsRule": {
+        "type": "object",
+        "required": ["category", "spend_per_point", "multiplier_pct", "updated_at"],
+        "properties": {
+          "category": {"type": "string"},
+          "spend_per_point": {"type": "integer"},
+          "multiplier_pct": {"type": "integer"},
+          "updated_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "PointsRuleResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["rule"],
+            "properties": {"rule": {"$ref": "#/components/schemas/PointsRule"}}
+          }
+        }
+      },
+      "PointsSettingsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["program", "rules"],
+            "properties": {
+              "program": {"$ref": "#/components/schemas/PointsProgram"},
+              "rules": {"type": "array", "items": {"$ref": "#/components/schemas/PointsRule"}}
+            }
+          }
+        }
+      },
+      "ReverseTransactionRequest": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "reason": {"type": "string"}
+        }
+      },
+      "CreditRequest": {
+        "type": "object",
+        "required": ["source", "amount"],
+        "additionalProperties": false,
+        "properties": {
+          "source": {"type": "string", "enum": ["promo", "refund"]},
+          "amount": {"type": "integer", "minimum": 1},
+          "expires_at": {"type": "string", "format": "date-time", "description": "Not set for a credit that does not expire"}
+        }
+      },
+      "CreditResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["deposit", "type", "bucket"],
+            "properties": {
+              "deposit": {
+                "type": "object",
+                "required": ["id", "deposited_by", "status", "deposited_at", "amount", "reference_id"],
+                "properties": {
+                  "id": {"type": "string"},
+                  "deposited_by": {"type": "string"},
+                  "status": {"type": "string", "enum": ["success"]},
+                  "deposited_at": {"type": "string", "format": "date-time"},
+                  "amount": {"type": "integer"},
+                  "reference_id": {"type": "string", "example": "credit:6f1c2a4e-0d3b-4c5e-9a7f-1b2c3d4e5f60"}
+                }
+              },
+              "type": {"type": "string", "enum": ["promo", "deposit"]},
+              "bucket": {"$ref": "#/components/schemas/BalanceBucket"}
+            }
+          }
+        }
+      },
+      "ReversalResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["reversal"],
+            "properties": {
+              "reversal": {
+                "type": "object",
+                "required": ["transaction_id", "reversal_transaction_id", "amount", "points_reversed", "created_at"],
+                "properties": {
+                  "transaction_id": {"type": "string"},
+                  "reversal_transaction_id": {"type": "string", "description": "Deposit that gave the amount back"},
+                  "amount": {"type": "integer"},
+                  "points_reversed": {"type": "integer"},
+                  "reason": {"type": "string"},
+                  "created_at": {"type": "string", "format": "date-time"}
+                }
+              }
+            }
+          }
+        }
+      },
+      "SystemAccount": {
+        "type": "object",
+        "required": ["id", "balance", "created_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "balance": {"type": "integer"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "SystemAccountsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["accounts"],
+            "properties": {"accounts": {"type": "array", "items": {"$ref": "#/components/schemas/SystemAccount"}}}
+          }
+        }
+      },
+      "SystemEntriesResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["account", "entries"],
+            "properties": {
+              "account": {"$ref": "#/components/schemas/SystemAccount"},
+              "entries": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["id", "amount", "balance", "wallet_id", "transaction_id", "reference_id", "created_at"],
+                  "properties": {
+                    "id": {"type": "string"},
+                    "amount": {"type": "integer", "description": "Negative when money left the account"},
+                    "balance": {"type": "integer"},
+                    "wallet_id": {"type": "string"},
+                    "transaction_id": {"type": "string", "description": "Wallet transaction on the other side"},
+                    "reference_id": {"type": "string"},
+                    "created_at": {"type": "string", "format": "date-time"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "ScheduleRequest": {
+        "type": "object",
+        "required": ["kind", "amount"],
+        "additionalProperties": false,
+        "properties": {
+          "kind": {"type": "string", "enum": ["transfer", "withdrawal"]},
+          "to_user_id": {"type": "string", "description": "transfer only"},
+          "amount": {"type": "integer", "minimum": 1},
+          "cron": {"type": "string", "description": "minute hour day-of-month month day-of-week in UTC, or @hourly, @daily, @weekly, @monthly, @yearly", "example": "0 9 1 * *"},
+          "interval": {"type": "string", "description": "Go duration of at least 1m, instead of cron", "example": "168h"},
+          "start_at": {"type": "string", "format": "date-time", "description": "First possible run, now by default"},
+          "on_insufficient_funds": {"type": "string", "enum": ["skip", "retry"], "default": "skip"},
+          "retry_interval": {"type": "string", "default": "1h0m0s"},
+          "max_retries": {"type": "integer", "minimum": 1, "default": 3}
+        }
+      },
+      "Schedule": {
+        "type": "object",
+        "required": ["id", "kind", "amount", "start_at", "on_insufficient_funds", "retry_interval", "max_retries", "status", "attempt", "created_at", "updated_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "kind": {"type": "string", "enum": ["transfer", "withdrawal"]},
+          "to_user_id": {"type": "string"},
+          "amount": {"type": "integer"},
+          "cron": {"type": "string"},
+          "interval": {"type": "string"},
+          "start_at": {"type": "string", "format": "date-time"},
+          "on_insufficient_funds": {"type": "string", "enum": ["skip", "retry"]},
+          "retry_interval": {"type": "string"},
+          "max_retries": {"type": "integer"},
+          "status": {"type": "string", "enum": ["active", "paused", "cancelled"]},
+          "attempt": {"type": "integer", "description": "Failed attempts at the next run's occurrence"},
+          "next_run_at": {"type": "string", "format": "date-time", "description": "Active schedules only"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"},
+          "runs": {
+            "type": "array",
+            "description": "Latest runs first, only when viewing one schedule",
+            "items": {
+              "type": "object",
+              "required": ["id", "due_at", "ran_at", "attempt", "status"],
+              "properties": {
+                "id": {"type": "string"},
+                "due_at": {"type": "string", "format": "date-time"},
+                "ran_at": {"type": "string", "format": "date-time"},
+                "attempt": {"type": "integer"},
+                "status": {"type": "string", "enum": ["succeeded", "retrying", "skipped", "failed"]},
+                "transaction_id": {"type": "string"},
+                "error": {"type": "string"}
+              }
+            }
+          }
+        }
+      },
+      "ScheduleResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["schedule"],
+            "properties": {"schedule": {"$ref": "#/components/schemas/Schedule"}}
+          }
+        }
+      },
+      "SchedulesResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["schedules"],
+            "properties": {"schedules": {"type": "array", "items": {"$ref": "#/components/schemas/Schedule"}}}
+          }
+        }
+      },
+      "RateLimitGroup": {"type": "string", "enum": ["wallet", "transaction"]},
+      "RateLimitRequest": {
+        "type": "object",
+        "required": ["group", "rate", "burst"],
+        "additionalProperties": false,
+        "properties": {
+          "group": {"$ref": "#/components/schemas/RateLimitGroup"},
+          "rate": {"type": "number", "minimum": 0},
+          "burst": {"type": "integer", "minimum": 1}
+        }
+      },
+      "MerchantRequest": {
+        "type": "object",
+        "required": ["name"],
+        "additionalProperties": false,
+        "properties": {
+          "name": {"type": "string", "maxLength": 100},
+          "category": {"type": "string", "pattern": "^[a-z0-9_]{1,50}$", "description": "Merchant category of its payments, picks the points earn rule"},
+          "webhook_url": {"type": "string", "format": "uri", "maxLength": 500, "description": "No webhooks when not set"},
+          "fee_bps": {"type": "integer", "minimum": 0, "maximum": 10000, "default": 0},
+          "fee_flat": {"type": "integer", "minimum": 0, "default": 0}
+        }
+      },
+      "MerchantKey": {
+        "type": "object",
+        "required": ["id", "prefix", "created_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "prefix": {"type": "string", "description": "Start of the key to tell keys apart"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "revoked_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Merchant": {
+        "type": "object",
+        "required": ["id", "name", "wallet_id", "fee_bps", "fee_flat", "created_at", "updated_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "category": {"type": "string"},
+          "wallet_id": {"type": "string", "description": "Settlement wallet"},
+          "webhook_url": {"type": "string"},
+          "fee_bps": {"type": "integer"},
+          "fee_flat": {"type": "integer"},
+          "balance": {"type": "integer", "description": "Of the settlement wallet, not set in lists"},
+          "keys": {"type": "array", "items": {"$ref": "#/components/schemas/MerchantKey"}, "description": "Only shown to admins viewing one merchant"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "MerchantResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["merchant"],
+            "properties": {
+              "merchant": {"$ref": "#/components/schemas/Merchant"},
+              "api_key": {"type": "string", "description": "Only when the merchant is created"},
+              "webhook_secret": {"type": "string", "description": "When the merchant is created, and to the merchant itself"}
+            }
+          }
+        }
+      },
+      "MerchantsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["merchants"],
+            "properties": {"merchants": {"type": "array", "items": {"$ref": "#/components/schemas/Merchant"}}}
+          }
+        }
+      },
+      "MerchantKeyResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["key", "api_key"],
+            "properties": {
+              "key": {"$ref": "#/components/schemas/MerchantKey"},
+              "api_key": {"type": "string"}
+            }
+          }
+        }
+      },
+      "PaymentRequest": {
+        "type": "object",
+        "required": ["amount", "order_id"],
+        "additionalProperties": false,
+        "properties": {
+          "amount": {"type": "integer", "minimum": 1},
+          "order_id": {"type": "string", "maxLength": 100},
+          "description": {"type": "string", "maxLength": 200},
+          "customer_id": {"type": "string", "description": "The only customer that may pay it, anyone when not set"},
+          "expires_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "PaymentStatus": {
+        "type": "string",
+        "enum": ["pending", "paid", "declined", "expired", "refunded"],
+        "description": "refunded once the refunds add up to the amount"
+      },
+      "Refund": {
+        "type": "object",
+        "required": ["id", "amount", "transaction_id", "refund_transaction_id", "created_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "amount": {"type": "integer"},
+          "reason": {"type": "string"},
+          "transaction_id": {"type": "string", "description": "Withdrawal from the settlement wallet"},
+          "refund_transaction_id": {"type": "string", "description": "Deposit to the payer"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Payment": {
+        "type": "object",
+        "required": ["id", "order_id", "amount", "fee", "net", "status", "refunded", "expires_at", "created_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "order_id": {"type": "string"},
+          "amount": {"type": "integer"},
+          "fee": {"type": "integer"},
+          "net": {"type": "integer", "description": "Credited to the settlement wallet, amount less fee"},
+          "description": {"type": "string"},
+          "customer_id": {"type": "string"},
+          "status": {"$ref": "#/components/schemas/PaymentStatus"},
+          "refunded": {"type": "integer"},
+          "paid_by": {"type": "string", "description": "Customer that paid or declined it"},
+          "settlement_transaction_id": {"type": "string", "description": "Deposit to the settlement wallet, not set when the fee took all of it"},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "paid_at": {"type": "string", "format": "date-time"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "refunds": {"type": "array", "items": {"$ref": "#/components/schemas/Refund"}}
+        }
+      },
+      "PaymentResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["payment"],
+            "properties": {"payment": {"$ref": "#/components/schemas/Payment"}}
+          }
+        }
+      },
+      "PaymentsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["payments"],
+            "properties": {"payments": {"type": "array", "items": {"$ref": "#/components/schemas/Payment"}}}
+          }
+        }
+      },
+      "RefundRequest": {
+        "type": "object",
+        "required": ["amount"],
+        "additionalProperties": false,
+        "properties": {
+          "amount": {"type": "integer", "minimum": 1},
+          "reason": {"type": "string", "maxLength": 200}
+        }
+      },
+      "RefundResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["refund", "payment"],
+            "properties": {
+              "refund": {"$ref": "#/components/schemas/Refund"},
+              "payment": {"$ref": "#/components/schemas/Payment"}
+            }
+          }
+        }
+      },
+      "WalletPaymentResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["payment"],
+            "properties": {
+              "payment": {
+                "type": "object",
+                "required": ["id", "merchant_id", "merchant_name", "order_id", "amount", "status", "refunded", "expires_at", "created_at"],
+                "properties": {
+                  "id": {"type": "string"},
+                  "merchant_id": {"type": "string"},
+                  "merchant_name": {"type": "string"},
+                  "order_id": {"type": "string"},
+                  "amount": {"type": "integer"},
+                  "description": {"type": "string"},
+                  "status": {"$ref": "#/components/schemas/PaymentStatus"},
+                  "refunded": {"type": "integer"},
+                  "transaction_id": {"type": "string", "description": "My withdrawal that paid it"},
+                  "expires_at": {"type": "string", "format": "date-time"},
+                  "paid_at": {"type": "string", "format": "date-time"},
+                  "created_at": {"type": "string", "format": "date-time"}
+                }
+              }
+            }
+          }
+        }
+      },
+      "WebhookEvent": {
+        "type": "object",
+        "description": "Body of a webhook, the payment as it was when the event happened",
+        "required": ["id", "type", "created_at", "data"],
+        "properties": {
+          "id": {"type": "string"},
+          "type": {"type": "string", "enum": ["payment.paid", "payment.declined", "payment.expired", "payment.refunded"]},
+          "created_at": {"type": "string", "format": "date-time"},
+          "data": {
+            "type": "object",
+            "required": ["payment"],
+            "properties": {"payment": {"$ref": "#/components/schemas/Payment"}}
+          }
+        }
+      },
+      "WebhooksResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["webhooks"],
+            "properties": {
+              "webhooks": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["id", "event", "payment_id", "status", "attempts", "created_at"],
+                  "properties": {
+                    "id": {"type": "string", "description": "id of the WebhookEvent"},
+                    "event": {"type": "string"},
+                    "payment_id": {"type": "string"},
+                    "status": {"type": "string", "enum": ["pending", "delivered", "failed"]},
+                    "attempts": {"type": "integer"},
+                    "last_error": {"type": "string"},
+                    "next_attempt_at": {"type": "string", "format": "date-time"},
+                    "delivered_at": {"type": "string", "format": "date-time"},
+                    "created_at": {"type": "string", "format": "date-time"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "ErrorCode": {
+        "type": "string",
+        "enum": [
+          "INVALID_INPUT", "UNSUPPORTED_MEDIA_TYPE", "UNAUTHORIZED", "NOT_FOUND", "ACCOUNT_EXISTS",
+          "WALLET_DISABLED", "WALLET_ALREADY_ENABLED", "WALLET_ALREADY_DISABLED", "INSUFFICIENT_FUNDS",
+          "DUPLICATE_REFERENCE", "LIMIT_EXCEEDED", "IDEMPOTENCY_KEY_REUSED", "IDEMPOTENCY_IN_PROGRESS", "SLOW_CONSUMER", "BATCH_INVALID", "VOUCHER_UNAVAILABLE", "PAYMENT_UNAVAILABLE", "ESCROW_UNAVAILABLE", "DISPUTE_UNAVAILABLE",
+          "INTERNAL_ERROR"
+        ]
+      },
+      "ErrorResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["fail"]},
+          "data": {
+            "type": "object",
+            "required": ["error", "code"],
+            "properties": {
+              "error": {"type": "string"},
+              "code": {"$ref": "#/components/schemas/ErrorCode"},
+              "request_id": {"type": "string"}
+            }
+          }
+        }
+      },
+      "ValidationErrorResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["fail"]},
+          "data": {
+            "type": "object",
+            "required": ["error", "code"],
+            "properties": {
+              "error": {"type": "object", "additionalProperties": {"type": "array", "items": {"type": "string"}}},
+              "code": {"type": "string", "enum": ["INVALID_INPUT"]},
+              "request_id": {"type": "string"}
+            }
+          }
+        }
+      },
+      "InitAccountResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["token"],
+            "properties": {"token": {"type": "string"}}
+          }
+        }
+      },
+      "WalletDetail": {
+        "type": "object",
+        "required": ["id", "owned_by", "status", "balance"],
+        "properties": {
+          "id": {"type": "string"},
+          "owned_by": {"type": "string"},
+          "status": {"type": "string", "enum": ["enabled", "disabled"]},
+          "enabled_at": {"type": "string", "format": "date-time"},
+          "disabled_at": {"type": "string", "format": "date-time"},
+          "balance": {"type": "integer"},
+          "pockets": {"type": "array", "description": "Breakdown of balance, main pocket first, only when viewing my wallet", "items": {"$ref": "#/components/schemas/Pocket"}},
+          "buckets": {"type": "array", "description": "Breakdown of balance by source, cash first and then credits in the order debits spend them, soonest expiry first, only when viewing my wallet", "items": {"$ref": "#/components/schemas/BalanceBucket"}}
+        }
+      },
+      "BalanceBucket": {
+        "type": "object",
+        "required": ["source", "amount"],
+        "properties": {
+          "id": {"type": "string", "description": "Not set for cash"},
+          "source": {"type": "string", "enum": ["cash", "promo", "refund"]},
+          "amount": {"type": "integer", "description": "Left to spend"},
+          "expires_at": {"type": "string", "format": "date-time", "description": "Not set when it does not expire"},
+          "transaction_id": {"type": "string", "description": "Credit that made the bucket"}
+        }
+      },
+      "WalletResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["wallet"],
+            "properties": {"wallet": {"$ref": "#/components/schemas/WalletDetail"}}
+          }
+        }
+      },
+      "DepositResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["deposit"],
+            "properties": {
+              "deposit": {
+                "type": "object",
+                "required": ["id", "deposited_by", "status", "deposited_at"],
+                "properties": {
+                  "id": {"type": "string"},
+                  "deposited_by": {"type": "string"},
+                  "status": {"type": "string", "enum": ["success"]},
+                  "deposited_at": {"type": "string", "format": "date-time"},
+                  "amount": {"type": "integer"},
+                  "reference_id": {"type": "string"}
+                }
+              }
+            }
+          }
+        }
+      },
+      "WithdrawalResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["withdrawal"],
+            "properties": {
+              "withdrawal": {
+                "type": "object",
+                "required": ["id", "withdrawn_by", "status", "withdrawn_at"],
+                "properties": {
+                  "id": {"type": "string"},
+                  "withdrawn_by": {"type": "string"},
+                  "status": {"type": "string", "enum": ["success"]},
+                  "withdrawn_at": {"type": "string", "format": "date-time"},
+                  "amount": {"type": "integer"},
+                  "reference_id": {"type": "string"},
+                  "fee": {"type": "integer", "description": "Debited on top of amount"},
+                  "fee_transaction_id": {"type": "string", "description": "Not set without a fee"}
+                }
+              }
+            }
+          }
+        }
+      },
+      "Transaction": {
+        "type": "object",
+        "required": ["id", "type", "amount", "reference_id", "created_at"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string"},
+          "type": {"type": "string", "enum": ["deposit", "withdrawal", "interest", "fee", "promo", "cashback", "expiry"]},
+          "amount": {"type": "integer"},
+          "reference_id": {"type": "string"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "TransactionsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["transactions"],
+            "properties": {
+              "transactions": {
+                "type": "array",
+                "items": {"$ref": "#/components/schemas/Transaction"}
+              }
+            }
+          }
+        }
+      },
+      "WalletEvent": {
+        "type": "object",
+        "required": ["sequence", "type", "wallet_id", "status", "balance", "time"],
+        "properties": {
+          "sequence": {"type": "integer", "minimum": 1},
+          "type": {"type": "string", "enum": ["enabled", "disabled", "deposit", "withdrawal", "interest", "fee", "promo", "cashback", "expiry"]},
+          "wallet_id": {"type": "string"},
+          "status": {"type": "string", "enum": ["enabled", "disabled"]},
+          "balance": {"type": "integer"},
+          "transaction": {"$ref": "#/components/schemas/Transaction"},
+          "time": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WalletWatchersResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["wallet_id", "watchers"],
+            "properties": {
+              "wallet_id": {"type": "string"},
+              "watchers": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["user_id", "created_at"],
+                  "properties": {
+                    "user_id": {"type": "string"},
+                    "created_at": {"type": "string", "format": "date-time"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "WatchClientMessage": {
+        "type": "object",
+        "required": ["type"],
+        "properties": {
+          "type": {"type": "string", "enum": ["subscribe", "unsubscribe", "ack"]},
+          "id": {"type": "string", "description": "Echoed in the subscribed, unsubscribed or error reply"},
+          "wallet_ids": {"type": "array", "items": {"type": "string"}},
+          "after": {"type": "object", "additionalProperties": {"type": "integer", "minimum": 0}, "description": "subscribe only, last sequence seen per wallet"},
+          "wallet_id": {"type": "string", "description": "ack only"},
+          "sequence": {"type": "integer", "description": "ack only, acknowledges every event of wallet_id up to it"}
+        }
+      },
+      "WatchServerMessage": {
+        "type": "object",
+        "required": ["type"],
+        "properties": {
+          "type": {"type": "string", "enum": ["subscribed", "unsubscribed", "event", "error"]},
+          "id": {"type": "string"},
+          "wallet_ids": {"type": "array", "items": {"type": "string"}, "description": "Wallets watched now, or the wallets refused on error"},
+          "event": {"$ref": "#/components/schemas/WalletEvent"},
+          "error": {
+            "type": "object",
+            "properties": {
+              "error": {"type": "string"},
+              "code": {"$ref": "#/components/schemas/ErrorCode"},
+              "request_id": {"type": "string"}
+            }
+          }
+        }
+      },
+      "RateLimitsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["user_id", "limits"],
+            "properties": {
+              "user_id": {"type": "string"},
+              "limits": {
+                "type": "array",
+                "items": {
+                  "type": "object",
+                  "required": ["group", "rate", "burst", "override"],
+                  "properties": {
+                    "group": {"$ref": "#/components/schemas/RateLimitGroup"},
+                    "rate": {"type": "number"},
+                    "burst": {"type": "integer"},
+                    "override": {"type": "boolean"}
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "BatchResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["id", "status", "rows", "counts", "errors", "created_at", "updated_at"],
+            "properties": {
+              "id": {"type": "string"},
+              "status": {"type": "string", "enum": ["validated", "invalid", "applying", "completed"]},
+              "rows": {"type": "integer"},
+              "counts": {
+                "type": "object",
+                "description": "Rows by status: valid (not applied yet), invalid, applied, skipped (reference_id applied before) and failed",
+                "properties": {
+                  "valid": {"type": "integer"},
+                  "invalid": {"type": "integer"},
+                  "applied": {"type": "integer"},
+                  "skipped": {"type": "integer"},
+                  "failed": {"type": "integer"}
+                }
+              },
+              "errors": {
+                "type": "array",
+                "description": "The first 100 invalid rows, the result file lists them all",
+                "items": {
+                  "type": "object",
+                  "required": ["line", "error"],
+                  "properties": {
+                    "line": {"type": "integer"},
+                    "error": {"type": "string"}
+                  }
+                }
+              },
+              "created_at": {"type": "string", "format": "date-time"},
+              "updated_at": {"type": "string", "format": "date-time"}
+            }
+          }
+        }
+      },
+      "NewPaymentRequest": {
+        "type": "object",
+        "required": ["payers"],
+        "additionalProperties": false,
+        "properties": {
+          "payers": {"type": "string", "description": "user_id:amount pairs, e.g. alice:5000,bob:7500"},
+          "description": {"type": "string", "maxLength": 200},
+          "expires_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "WalletPaymentRequest": {
+        "type": "object",
+        "required": ["id", "requested_by", "amount", "paid", "status", "expires_at", "created_at", "shares"],
+        "properties": {
+          "id": {"type": "string"},
+          "requested_by": {"type": "string"},
+          "description": {"type": "string"},
+          "amount": {"type": "integer", "description": "Sum of every share"},
+          "paid": {"type": "integer", "description": "Sum of the paid shares listed"},
+          "status": {"type": "string", "enum": ["open", "settled", "closed", "cancelled", "expired"], "description": "settled once every share was paid, closed once every payer answered and some declined"},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "shares": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["payer_id", "amount", "status"],
+              "properties": {
+                "payer_id": {"type": "string"},
+                "amount": {"type": "integer"},
+                "status": {"type": "string", "enum": ["pending", "paid", "declined", "cancelled", "expired"]},
+                "transfer_id": {"type": "string", "description": "Transfer that paid the share"},
+                "answered_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          }
+        }
+      },
+      "WalletPaymentRequestResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["request"],
+            "properties": {"request": {"$ref": "#/components/schemas/WalletPaymentRequest"}}
+          }
+        }
+      },
+      "WalletPaymentRequestsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["requests"],
+            "properties": {"requests": {"type": "array", "items": {"$ref": "#/components/schemas/WalletPaymentRequest"}}}
+          }
+        }
+      },
+      "WalletPaymentRequestAcceptedResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["request", "transfer"],
+            "properties": {
+              "request": {"$ref": "#/components/schemas/WalletPaymentRequest"},
+              "transfer": {"$ref": "#/components/schemas/Transfer"}
+            }
+          }
+        }
+      },
+      "NewEscrow": {
+        "type": "object",
+        "required": ["seller_id", "amount"],
+        "additionalProperties": false,
+        "properties": {
+          "seller_id": {"type": "string"},
+          "amount": {"type": "integer", "minimum": 1},
+          "description": {"type": "string", "maxLength": 500},
+          "expires_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "EscrowNote": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "note": {"type": "string", "maxLength": 500}
+        }
+      },
+      "EscrowResolution": {
+        "type": "object",
+        "required": ["outcome", "note"],
+        "additionalProperties": false,
+        "properties": {
+          "outcome": {"type": "string", "enum": ["release", "refund"]},
+          "note": {"type": "string", "minLength": 1, "maxLength": 500}
+        }
+      },
+      "Escrow": {
+        "type": "object",
+        "required": ["id", "buyer_id", "seller_id", "amount", "status", "fund_transaction_id", "expires_at", "created_at", "updated_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "buyer_id": {"type": "string"},
+          "seller_id": {"type": "string"},
+          "amount": {"type": "integer"},
+          "description": {"type": "string"},
+          "status": {"type": "string", "enum": ["funded", "disputed", "released", "refunded"]},
+          "fund_transaction_id": {"type": "string", "description": "Withdrawal from the buyer"},
+          "settle_transaction_id": {"type": "string", "description": "Deposit to the seller or back to the buyer"},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"},
+          "events": {
+            "type": "array",
+            "description": "Oldest first, only when a single escrow is read",
+            "items": {
+              "type": "object",
+              "required": ["type", "actor", "created_at"],
+              "properties": {
+                "type": {"type": "string", "enum": ["funded", "disputed", "released", "refunded"]},
+                "actor": {"type": "string", "enum": ["buyer", "seller", "admin", "system"]},
+                "actor_id": {"type": "string"},
+                "note": {"type": "string"},
+                "transaction_id": {"type": "string"},
+                "created_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          }
+        }
+      },
+      "EscrowResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["escrow"],
+            "properties": {"escrow": {"$ref": "#/components/schemas/Escrow"}}
+          }
+        }
+      },
+      "EscrowsResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["escrows"],
+            "properties": {"escrows": {"type": "array", "items": {"$ref": "#/components/schemas/Escrow"}}}
+          }
+        }
+      },
+      "NewDispute": {
+        "type": "object",
+        "required": ["transaction_id", "reason"],
+        "additionalProperties": false,
+        "properties": {
+          "transaction_id": {"type": "string", "description": "A withdrawal or a fee of my wallet"},
+          "amount": {"type": "integer", "minimum": 1, "description": "Defaults to the amount of the transaction"},
+          "reason": {"type": "string", "enum": ["unauthorized", "not_received", "duplicate", "incorrect_amount", "other"]},
+          "evidence": {"type": "string", "maxLength": 2000}
+        }
+      },
+      "DisputeNote": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "note": {"type": "string", "maxLength": 2000}
+        }
+      },
+      "RequiredDisputeNote": {
+        "type": "object",
+        "required": ["note"],
+        "additionalProperties": false,
+        "properties": {
+          "note": {"type": "string", "minLength": 1, "maxLength": 2000}
+        }
+      },
+      "AdminDisputeNote": {
+        "type": "object",
+        "required": ["note"],
+        "additionalProperties": false,
+        "properties": {
+          "note": {"type": "string", "minLength": 1, "maxLength": 2000},
+          "internal": {"type": "boolean", "default": false}
+        }
+      },
+      "DisputeStatusChange": {
+        "type": "object",
+        "required": ["status"],
+        "additionalProperties": false,
+        "properties": {
+          "status": {"type": "string", "enum": ["reviewing", "needs_info", "won", "lost"]},
+          "note": {"type": "string", "maxLength": 2000}
+        }
+      },
+      "Dispute": {
+        "type": "object",
+        "required": ["id", "user_id", "wallet_id", "transaction_id", "amount", "reason", "status", "overdue", "uncollected", "created_at", "updated_at"],
+        "properties": {
+          "id": {"type": "string"},
+          "user_id": {"type": "string"},
+          "wallet_id": {"type": "string"},
+          "transaction_id": {"type": "string"},
+          "amount": {"type": "integer"},
+          "reason": {"type": "string", "enum": ["unauthorized", "not_received", "duplicate", "incorrect_amount", "other"]},
+          "evidence": {"type": "string"},
+          "status": {"type": "string", "enum": ["open", "reviewing", "needs_info", "won", "lost", "withdrawn"], "description": "won and lost are the outcome for the customer"},
+          "due_at": {"type": "string", "format": "date-time", "description": "When the current status is due, until it is resolved"},
+          "overdue": {"type": "boolean"},
+          "provisional_transaction_id": {"type": "string", "description": "Deposit placed until the dispute is decided"},
+          "credit_transaction_id": {"type": "string", "description": "Deposit the customer keeps once it was won"},
+          "reversal_transaction_id": {"type": "string", "description": "Withdrawal that took the provisional credit back"},
+          "uncollected": {"type": "integer", "description": "Part of the provisional credit the main pocket could not cover when it was taken back"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"},
+          "resolved_at": {"type": "string", "format": "date-time"},
+          "notes": {
+            "type": "array",
+            "description": "Oldest first, only when a single dispute is read",
+            "items": {
+              "type": "object",
+              "required": ["author", "internal", "created_at"],
+              "properties": {
+                "author": {"type": "string", "enum": ["customer", "admin", "system"]},
+                "author_id": {"type": "string"},
+                "status": {"type": "string", "enum": ["open", "reviewing", "needs_info", "won", "lost", "withdrawn"], "description": "The status the dispute moved to"},
+                "note": {"type": "string"},
+                "internal": {"type": "boolean"},
+                "transaction_id": {"type": "string"},
+                "created_at": {"type": "string", "format": "date-time"}
+              }
+            }
+          }
+        }
+      },
+      "DisputeResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["dispute"],
+            "properties": {"dispute": {"$ref": "#/components/schemas/Dispute"}}
+          }
+        }
+      },
+      "DisputesResponse": {
+        "type": "object",
+        "required": ["status", "data"],
+        "properties": {
+          "status": {"type": "string", "enum": ["success"]},
+          "data": {
+            "type": "object",
+            "required": ["disputes"],
+            "properties": {"disputes": {"type": "array", "items": {"$ref": "#/components/schemas/Dispute"}}}
+          }
+        }
+      }
+    }
+  }
+}`
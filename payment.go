@@ -0,0 +1,1397 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// A payment is asked for by a merchant and approved or declined by a customer before it
+// expires. Approving moves the amount out of the main pocket of the customer, the amount
+// less the fee of the merchant into its settlement wallet and the fee into revenue, in one
+// tx. Refunds go the other way out of the settlement wallet, the fee is kept. Every change
+// of status is queued as a webhook of the merchant in the tx that made it.
+
+const (
+	paymentStatusPending  = "pending"
+	paymentStatusPaid     = "paid"
+	paymentStatusDeclined = "declined"
+	paymentStatusExpired  = "expired"
+	paymentStatusRefunded = "refunded"
+
+	paymentReferencePrefix = "payment:"
+	refundReferencePrefix  = "refund:"
+
+	defaultPaymentExpiry = 15 * time.Minute
+	maxPaymentExpiry     = 7 * 24 * time.Hour
+	maxPaymentOrderIDLen = 100
+	maxPaymentTextLen    = 200
+
+	// paymentExpiryPoll -> how often pending payments past their expiry are closed
+	paymentExpiryPoll = time.Minute
+)
+
+// Payment -> Amount asked by a merchant for OrderID, payable by CustomerID only when set.
+// Fee is fixed when it is created, Refunded is the part given back so far.
+type Payment struct {
+	ID                      string    `db:"id"`
+	MerchantID              string    `db:"merchant_id"`
+	OrderID                 string    `db:"order_id"`
+	Amount                  int       `db:"amount"`
+	Fee                     int       `db:"fee"`
+	Description             string    `db:"description"`
+	CustomerID              string    `db:"customer_id"`
+	Status                  string    `db:"status"`
+	Refunded                int       `db:"refunded"`
+	PayerID                 string    `db:"payer_id"`
+	PayerWalletID           string    `db:"payer_wallet_id"`
+	TransactionID           string    `db:"transaction_id"`
+	SettlementTransactionID string    `db:"settlement_transaction_id"`
+	ExpireTime              time.Time `db:"expire_time"`
+	PayTime                 time.Time `db:"pay_time"`
+	CreateTime              time.Time `db:"create_time"`
+	UpdateTime              time.Time `db:"update_time"`
+
+	// MerchantName -> shown to the customer, not stored
+	MerchantName string
+	// Refunds -> the refunds of the payment when they were read, not stored
+	Refunds []PaymentRefund
+}
+
+// StatusAt -> Status, or expired for a pending payment past its expiry the sweep did not
+// close yet
+func (p Payment) StatusAt(now time.Time) string {
+	if p.Status == paymentStatusPending && !now.Before(p.ExpireTime) {
+		return paymentStatusExpired
+	}
+
+	return p.Status
+}
+
+// PayableBy -> userID may see, approve or decline the payment
+func (p Payment) PayableBy(userID string) bool {
+	if p.PayerID != "" {
+		return p.PayerID == userID
+	}
+
+	return p.CustomerID == "" || p.CustomerID == userID
+}
+
+// PaymentRefund -> Amount of a payment given back, TransactionID debits the settlement wallet
+// and RefundTransactionID credits the payer
+type PaymentRefund struct {
+	ID                  string    `db:"id"`
+	PaymentID           string    `db:"payment_id"`
+	MerchantID          string    `db:"merchant_id"`
+	Amount              int       `db:"amount"`
+	Reason              string    `db:"reason"`
+	TransactionID       string    `db:"transaction_id"`
+	RefundTransactionID string    `db:"refund_transaction_id"`
+	CreateTime          time.Time `db:"create_time"`
+}
+
+const (
+	createPaymentTable = `
+		CREATE TABLE IF NOT EXISTS payment (
+			id TEXT NOT NULL PRIMARY KEY,
+			merchant_id TEXT NOT NULL,
+			order_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			fee INTEGER NOT NULL,
+			description TEXT NOT NULL,
+			customer_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			refunded INTEGER NOT NULL,
+			payer_id TEXT NOT NULL,
+			payer_wallet_id TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			settlement_transaction_id TEXT NOT NULL,
+			expire_time DATETIME NOT NULL,
+			pay_time DATETIME,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL,
+			UNIQUE (merchant_id, order_id)
+		);
+	`
+
+	createPaymentRefundTable = `
+		CREATE TABLE IF NOT EXISTS payment_refund (
+			id TEXT NOT NULL PRIMARY KEY,
+			payment_id TEXT NOT NULL,
+			merchant_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			refund_transaction_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertPaymentSQL = `
+		INSERT INTO payment
+			(id, merchant_id, order_id, amount, fee, description, customer_id, status, refunded,
+			payer_id, payer_wallet_id, transaction_id, settlement_transaction_id, expire_time, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,0,'','','','',?,?,?)
+		;
+	`
+
+	selectPaymentSQL = `
+		SELECT
+			p.id,
+			p.merchant_id,
+			p.order_id,
+			p.amount,
+			p.fee,
+			p.description,
+			p.customer_id,
+			p.status,
+			p.refunded,
+			p.payer_id,
+			p.payer_wallet_id,
+			p.transaction_id,
+			p.settlement_transaction_id,
+			p.expire_time,
+			p.pay_time,
+			p.create_time,
+			p.update_time,
+			m.name
+		FROM
+			payment p
+			JOIN merchant m ON m.id = p.merchant_id
+	`
+
+	getPaymentSQL = selectPaymentSQL + `
+		WHERE
+			p.id = $1
+	`
+
+	// getPaymentsSQL -> the latest payments of a merchant, of one order when $2 is set
+	getPaymentsSQL = selectPaymentSQL + `
+		WHERE
+			p.merchant_id = $1 AND
+			($2 = '' OR p.order_id = $2)
+		ORDER BY
+			p.create_time DESC,
+			p.rowid DESC
+		LIMIT $3
+	`
+
+	getExpiredPaymentIDsSQL = `
+		SELECT
+			id
+		FROM
+			payment
+		WHERE
+			status = 'pending' AND
+			julianday(expire_time) <= julianday($1)
+		ORDER BY
+			expire_time
+	`
+
+	// payPaymentSQL -> claim a pending payment for the payer, nothing changes once it was
+	// paid, declined or expired, or when it asks for another customer
+	payPaymentSQL = `
+		UPDATE
+			payment
+		SET
+			status = 'paid',
+			payer_id = $1,
+			payer_wallet_id = $2,
+			pay_time = $3,
+			update_time = $3
+		WHERE
+			id = $4 AND
+			status = 'pending' AND
+			julianday(expire_time) > julianday($3) AND
+			(customer_id = '' OR customer_id = $1)
+	`
+
+	setPaymentTransactionsSQL = `
+		UPDATE
+			payment
+		SET
+			transaction_id = $1,
+			settlement_transaction_id = $2
+		WHERE
+			id = $3
+	`
+
+	countPaymentLegsSQL = `
+		SELECT
+			(SELECT COUNT(*) FROM payment WHERE transaction_id = $1) +
+			(SELECT COUNT(*) FROM payment_refund WHERE transaction_id = $1)
+	`
+
+	getPaymentByTransactionIDSQL = `
+		SELECT
+			p.refunded,
+			m.wallet_id
+		FROM
+			payment p
+			JOIN merchant m ON m.id = p.merchant_id
+		WHERE
+			p.transaction_id = $1
+	`
+
+	declinePaymentSQL = `
+		UPDATE
+			payment
+		SET
+			status = 'declined',
+			payer_id = $1,
+			update_time = $2
+		WHERE
+			id = $3 AND
+			status = 'pending' AND
+			julianday(expire_time) > julianday($2) AND
+			(customer_id = '' OR customer_id = $1)
+	`
+
+	expirePaymentSQL = `
+		UPDATE
+			payment
+		SET
+			status = 'expired',
+			update_time = $1
+		WHERE
+			id = $2 AND
+			status = 'pending' AND
+			julianday(expire_time) <= julianday($1)
+	`
+
+	// refundPaymentSQL -> add a refund to a paid payment, nothing changes when it would give
+	// back more than the amount. The last refund makes it refunded.
+	refundPaymentSQL = `
+		UPDATE
+			payment
+		SET
+			refunded = refunded + $1,
+			status = CASE WHEN refunded + $1 = amount THEN 'refunded' ELSE status END,
+			update_time = $2
+		WHERE
+			id = $3 AND
+			status = 'paid' AND
+			refunded + $1 <= amount
+	`
+
+	insertPaymentRefundSQL = `
+		INSERT INTO payment_refund
+			(id, payment_id, merchant_id, amount, reason, transaction_id, refund_transaction_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getPaymentRefundsSQL = `
+		SELECT
+			id,
+			payment_id,
+			merchant_id,
+			amount,
+			reason,
+			transaction_id,
+			refund_transaction_id,
+			create_time
+		FROM
+			payment_refund
+		WHERE
+			payment_id = $1
+		ORDER BY
+			create_time,
+			rowid
+	`
+)
+
+func scanPayment(scanner interface{ Scan(...interface{}) error }) (payment Payment, err error) {
+	var payTime sql.NullTime
+	err = scanner.Scan(
+		&payment.ID,
+		&payment.MerchantID,
+		&payment.OrderID,
+		&payment.Amount,
+		&payment.Fee,
+		&payment.Description,
+		&payment.CustomerID,
+		&payment.Status,
+		&payment.Refunded,
+		&payment.PayerID,
+		&payment.PayerWalletID,
+		&payment.TransactionID,
+		&payment.SettlementTransactionID,
+		&payment.ExpireTime,
+		&payTime,
+		&payment.CreateTime,
+		&payment.UpdateTime,
+		&payment.MerchantName,
+	)
+	payment.PayTime = payTime.Time
+
+	return
+}
+
+// queryPayment -> the payment, read in tx when it is set so a webhook carries what tx wrote
+func queryPayment(ctx context.Context, db *sql.DB, tx *sql.Tx, paymentID string) (payment Payment, err error) {
+	if tx != nil {
+		return scanPayment(tx.QueryRowContext(ctx, getPaymentSQL, paymentID))
+	}
+
+	return scanPayment(db.QueryRowContext(ctx, getPaymentSQL, paymentID))
+}
+
+func insertPayment(ctx context.Context, db *sql.DB, payment Payment) (err error) {
+	defer observeQuery("insertPayment", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertPayment")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		insertPaymentSQL,
+		payment.ID,
+		payment.MerchantID,
+		payment.OrderID,
+		payment.Amount,
+		payment.Fee,
+		payment.Description,
+		payment.CustomerID,
+		payment.Status,
+		payment.ExpireTime,
+		payment.CreateTime,
+		payment.UpdateTime,
+	)
+	if isUniqueViolation(err) {
+		err = errDuplicateReference
+		return
+	}
+	if err != nil {
+		logError(ctx, "insertPayment ExecContext", err)
+	}
+
+	return
+}
+
+func getPayment(ctx context.Context, db *sql.DB, paymentID string) (payment Payment, err error) {
+	defer observeQuery("getPayment", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPayment")
+	defer func() {
+		span.end(err)
+	}()
+
+	payment, err = queryPayment(ctx, db, nil, paymentID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getPayment Scan", err)
+	}
+
+	return
+}
+
+func getPayments(ctx context.Context, db *sql.DB, merchantID, orderID string, limit int) (payments []Payment, err error) {
+	defer observeQuery("getPayments", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPayments")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPaymentsSQL, merchantID, orderID, limit)
+	if err != nil {
+		logError(ctx, "getPayments QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payment Payment
+		payment, err = scanPayment(rows)
+		if err != nil {
+			logError(ctx, "getPayments Scan", err)
+			return
+		}
+
+		payments = append(payments, payment)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getPaymentRefunds(ctx context.Context, db *sql.DB, paymentID string) (refunds []PaymentRefund, err error) {
+	defer observeQuery("getPaymentRefunds", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPaymentRefunds")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPaymentRefundsSQL, paymentID)
+	if err != nil {
+		logError(ctx, "getPaymentRefunds QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var refund PaymentRefund
+		err = rows.Scan(
+			&refund.ID,
+			&refund.PaymentID,
+			&refund.MerchantID,
+			&refund.Amount,
+			&refund.Reason,
+			&refund.TransactionID,
+			&refund.RefundTransactionID,
+			&refund.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "getPaymentRefunds Scan", err)
+			return
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getExpiredPaymentIDs(ctx context.Context, db *sql.DB, now time.Time) (paymentIDs []string, err error) {
+	defer observeQuery("getExpiredPaymentIDs", time.Now())
+	ctx, span := startQuerySpan(ctx, "getExpiredPaymentIDs")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getExpiredPaymentIDsSQL, now)
+	if err != nil {
+		logError(ctx, "getExpiredPaymentIDs QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var paymentID string
+		err = rows.Scan(&paymentID)
+		if err != nil {
+			logError(ctx, "getExpiredPaymentIDs Scan", err)
+			return
+		}
+
+		paymentIDs = append(paymentIDs, paymentID)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// payPayment -> debit the payer, credit the merchant less the fee and post the fee to
+// revenue in one tx, errPaymentUnavailable when the payment is no longer pending
+func payPayment(ctx context.Context, db *sql.DB, payment *Payment, merchant Merchant, wallet Wallet, userID string) (err error) {
+	defer observeQuery("payPayment", time.Now())
+	ctx, span := startQuerySpan(ctx, "payPayment")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "payPayment BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, payPaymentSQL, userID, wallet.ID, now, payment.ID)
+	if err != nil {
+		logError(ctx, "payPayment claim", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "payPayment RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errPaymentUnavailable
+		return
+	}
+
+	reference := paymentReferencePrefix + payment.ID
+
+	// payments are paid from the main pocket
+	withdrawal, withdrawalEvent, err := applyBalanceChange(ctx, tx, wallet.ID, "", reference, payment.Amount, withdrawalType)
+	if err != nil {
+		return
+	}
+
+	_, err = earnPoints(ctx, tx, withdrawal, merchant.Category)
+	if err != nil {
+		return
+	}
+
+	var (
+		deposit      WalletTransaction
+		depositEvent walletEvent
+	)
+	if net := payment.Amount - payment.Fee; net > 0 {
+		deposit, depositEvent, err = applyBalanceChange(ctx, tx, merchant.WalletID, "", reference, net, depositType)
+		if err != nil {
+			return
+		}
+	}
+
+	if payment.Fee > 0 {
+		err = postSystemEntry(ctx, tx, &SystemEntry{
+			AccountID:     systemAccountRevenue,
+			Amount:        payment.Fee,
+			WalletID:      wallet.ID,
+			TransactionID: withdrawal.ID,
+			ReferenceID:   reference,
+			CreateTime:    withdrawal.CreateTime,
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, setPaymentTransactionsSQL, withdrawal.ID, deposit.ID, payment.ID)
+	if err != nil {
+		logError(ctx, "payPayment set transactions", err)
+		return
+	}
+
+	*payment, err = queryPayment(ctx, db, tx, payment.ID)
+	if err != nil {
+		logError(ctx, "payPayment Scan", err)
+		return
+	}
+
+	err = enqueueWebhook(ctx, tx, merchant, webhookEventPaymentPaid, *payment)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "payPayment Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, withdrawalEvent)
+	if deposit.ID != "" {
+		publishWalletEvent(ctx, depositEvent)
+	}
+
+	return
+}
+
+// paymentLeg -> transactionID is the withdrawal that paid a payment or the one that refunded
+// it. Those legs are given back by a refund of the merchant only, a reversal of them would
+// pay the customer twice.
+func paymentLeg(ctx context.Context, tx *sql.Tx, transactionID string) (leg bool, err error) {
+	var legs int
+	err = tx.QueryRowContext(ctx, countPaymentLegsSQL, transactionID).Scan(&legs)
+	if err != nil {
+		logError(ctx, "paymentLeg Scan", err)
+		return
+	}
+	leg = legs > 0
+
+	return
+}
+
+// paymentByTransaction -> what was refunded of the payment paid by transactionID and the
+// settlement wallet of its merchant, read in tx. sql.ErrNoRows when it paid no payment.
+func paymentByTransaction(ctx context.Context, tx *sql.Tx, transactionID string) (refunded int, settlementWalletID string, err error) {
+	err = tx.QueryRowContext(ctx, getPaymentByTransactionIDSQL, transactionID).Scan(&refunded, &settlementWalletID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "paymentByTransaction Scan", err)
+	}
+
+	return
+}
+
+// closePayment -> move a pending payment to declined by userID, or to expired when userID
+// is empty, and queue its webhook in one tx. errPaymentUnavailable when it is not pending.
+func closePayment(ctx context.Context, db *sql.DB, payment *Payment, merchant Merchant, userID string, now time.Time) (err error) {
+	defer observeQuery("closePayment", time.Now())
+	ctx, span := startQuerySpan(ctx, "closePayment")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "closePayment BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	event := webhookEventPaymentDeclined
+	var result sql.Result
+	if userID != "" {
+		result, err = tx.ExecContext(ctx, declinePaymentSQL, userID, now, payment.ID)
+	} else {
+		event = webhookEventPaymentExpired
+		result, err = tx.ExecContext(ctx, expirePaymentSQL, now, payment.ID)
+	}
+	if err != nil {
+		logError(ctx, "closePayment ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "closePayment RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errPaymentUnavailable
+		return
+	}
+
+	*payment, err = queryPayment(ctx, db, tx, payment.ID)
+	if err != nil {
+		logError(ctx, "closePayment Scan", err)
+		return
+	}
+
+	err = enqueueWebhook(ctx, tx, merchant, event, *payment)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "closePayment Commit", err)
+	}
+
+	return
+}
+
+// refundPayment -> debit the settlement wallet, credit the payer and record the refund in
+// one tx. The last refund takes back the points the payment earned. errRefundTooLarge when
+// it would give back more than is left, errPaymentNotPaid when it is not paid and
+// errPaymentDisputed while a dispute of the customer may still credit it.
+func refundPayment(ctx context.Context, db *sql.DB, payment *Payment, merchant Merchant, refund *PaymentRefund) (err error) {
+	defer observeQuery("refundPayment", time.Now())
+	ctx, span := startQuerySpan(ctx, "refundPayment")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "refundPayment BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, refundPaymentSQL, refund.Amount, now, payment.ID)
+	if err != nil {
+		logError(ctx, "refundPayment claim", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "refundPayment RowsAffected", err)
+		return
+	}
+
+	// read again, a refund of another request may have landed since the usecase read it
+	*payment, err = queryPayment(ctx, db, tx, payment.ID)
+	if err != nil {
+		logError(ctx, "refundPayment Scan", err)
+		return
+	}
+	if changed == 0 {
+		err = errRefundTooLarge
+		if payment.Status != paymentStatusPaid {
+			err = errPaymentNotPaid
+		}
+		return
+	}
+
+	var disputes int
+	err = tx.QueryRowContext(ctx, countCreditedDisputesSQL, payment.TransactionID).Scan(&disputes)
+	if err != nil {
+		logError(ctx, "refundPayment disputes", err)
+		return
+	}
+	if disputes > 0 {
+		err = errPaymentDisputed
+		return
+	}
+
+	reference := refundReferencePrefix + refund.ID
+
+	withdrawal, withdrawalEvent, err := applyBalanceChange(ctx, tx, merchant.WalletID, "", reference, refund.Amount, withdrawalType)
+	if err != nil {
+		return
+	}
+
+	deposit, depositEvent, err := applyBalanceChange(ctx, tx, payment.PayerWalletID, "", reference, refund.Amount, depositType)
+	if err != nil {
+		return
+	}
+
+	if payment.Status == paymentStatusRefunded {
+		_, err = reversePoints(ctx, tx, payment.TransactionID, now)
+		if err != nil {
+			return
+		}
+	}
+
+	refund.TransactionID = withdrawal.ID
+	refund.RefundTransactionID = deposit.ID
+	refund.CreateTime = withdrawal.CreateTime
+
+	_, err = tx.ExecContext(ctx,
+		insertPaymentRefundSQL,
+		refund.ID,
+		refund.PaymentID,
+		refund.MerchantID,
+		refund.Amount,
+		refund.Reason,
+		refund.TransactionID,
+		refund.RefundTransactionID,
+		refund.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "refundPayment insert", err)
+		return
+	}
+
+	err = enqueueWebhook(ctx, tx, merchant, webhookEventPaymentRefunded, *payment)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "refundPayment Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, withdrawalEvent)
+	publishWalletEvent(ctx, depositEvent)
+
+	return
+}
+
+// paymentFromRequest -> the payment of the request, or the fields that are wrong
+func paymentFromRequest(req RequestPayment, now time.Time) (payment Payment, errs validationErrors) {
+	errs = validationErrors{}
+
+	payment = Payment{
+		ID:          generateUUID(),
+		OrderID:     strings.TrimSpace(req.OrderID),
+		Amount:      req.Amount,
+		Description: strings.TrimSpace(req.Description),
+		CustomerID:  strings.TrimSpace(req.CustomerID),
+		Status:      paymentStatusPending,
+		ExpireTime:  now.Add(defaultPaymentExpiry),
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+
+	switch {
+	case payment.OrderID == "":
+		errs.add("order_id", msgRequired)
+	case len(payment.OrderID) > maxPaymentOrderIDLen:
+		errs.add("order_id", "Must be at most 100 characters.")
+	}
+
+	if len(payment.Description) > maxPaymentTextLen {
+		errs.add("description", "Must be at most 200 characters.")
+	}
+
+	if strings.HasPrefix(payment.CustomerID, merchantUserPrefix) {
+		errs.add("customer_id", "Must be the id of a customer.")
+	}
+
+	if req.ExpiresAt != "" {
+		expireTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		switch {
+		case err != nil:
+			errs.add("expires_at", "Must be an RFC 3339 time.")
+		case !expireTime.After(now):
+			errs.add("expires_at", "Must be in the future.")
+		case expireTime.Sub(now) > maxPaymentExpiry:
+			errs.add("expires_at", "Must be within 7 days.")
+		default:
+			payment.ExpireTime = expireTime
+		}
+	}
+
+	return
+}
+
+// merchantOf -> the merchant behind the merchant api
+func merchantOf(ctx context.Context) (merchant Merchant, err error) {
+	merchant, err = getMerchant(ctx, database, merchantIDFromContext(ctx))
+	if err == sql.ErrNoRows {
+		err = errMerchantNotFound
+	}
+	setWalletID(ctx, merchant.WalletID)
+
+	return
+}
+
+// merchantPayment -> a payment of the merchant, errPaymentNotFound for the others
+func merchantPayment(ctx context.Context, merchant Merchant, paymentID string) (payment Payment, err error) {
+	payment, err = getPayment(ctx, database, paymentID)
+	if err == sql.ErrNoRows || (err == nil && payment.MerchantID != merchant.ID) {
+		err = errPaymentNotFound
+	}
+
+	return
+}
+
+// CreatePayment -> ask a customer for payment.Amount, payable until payment.ExpireTime
+func CreatePayment(ctx context.Context, payment Payment) (created Payment, err error) {
+	ctx = withOperation(ctx, "create_payment")
+	ctx, span := startSpan(ctx, "CreatePayment", spanKindInternal)
+	span.setAttribute("amount", payment.Amount)
+	defer func() {
+		span.finish(err)
+	}()
+
+	merchant, err := merchantOf(ctx)
+	if err != nil {
+		return
+	}
+
+	payment.MerchantID = merchant.ID
+	payment.MerchantName = merchant.Name
+	payment.Fee = merchant.Fee(payment.Amount)
+
+	err = insertPayment(ctx, database, payment)
+	if err != nil {
+		return
+	}
+
+	return payment, nil
+}
+
+// ListPayments -> the latest payments of the merchant, of one order when orderID is set
+func ListPayments(ctx context.Context, orderID string, limit int) (payments []Payment, err error) {
+	ctx = withOperation(ctx, "list_payments")
+	ctx, span := startSpan(ctx, "ListPayments", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	merchant, err := merchantOf(ctx)
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	payments, err = getPayments(ctx, database, merchant.ID, orderID, limit)
+	return
+}
+
+// GetPayment -> a payment of the merchant with its refunds
+func GetPayment(ctx context.Context, paymentID string) (payment Payment, err error) {
+	ctx = withOperation(ctx, "get_payment")
+	ctx, span := startSpan(ctx, "GetPayment", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	merchant, err := merchantOf(ctx)
+	if err != nil {
+		return
+	}
+
+	payment, err = merchantPayment(ctx, merchant, paymentID)
+	if err != nil {
+		return
+	}
+
+	payment.Refunds, err = getPaymentRefunds(ctx, database, payment.ID)
+	return
+}
+
+// RefundPayment -> give back amount of a paid payment out of the settlement wallet
+func RefundPayment(ctx context.Context, paymentID string, amount int, reason string) (payment Payment, refund PaymentRefund, err error) {
+	ctx = withOperation(ctx, "refund_payment")
+	ctx, span := startSpan(ctx, "RefundPayment", spanKindInternal)
+	span.setAttribute("amount", amount)
+	defer func() {
+		observeWalletResult("refund_payment", amount, err)
+		span.finish(err)
+	}()
+
+	merchant, err := merchantOf(ctx)
+	if err != nil {
+		return
+	}
+
+	payment, err = merchantPayment(ctx, merchant, paymentID)
+	if err != nil {
+		return
+	}
+
+	if payment.Status != paymentStatusPaid {
+		err = errPaymentNotPaid
+		return
+	}
+
+	if amount > payment.Amount-payment.Refunded {
+		err = errRefundTooLarge
+		return
+	}
+
+	refund = PaymentRefund{
+		ID:         generateUUID(),
+		PaymentID:  payment.ID,
+		MerchantID: merchant.ID,
+		Amount:     amount,
+		Reason:     reason,
+	}
+
+	err = refundPayment(ctx, database, &payment, merchant, &refund)
+	if err != nil {
+		return
+	}
+
+	payment.Refunds, err = getPaymentRefunds(ctx, database, payment.ID)
+	return
+}
+
+// customerPayment -> a payment userID may pay, with its merchant, errPaymentNotFound for
+// the others so their ids cannot be probed
+func customerPayment(ctx context.Context, userID, paymentID string) (payment Payment, merchant Merchant, err error) {
+	payment, err = getPayment(ctx, database, paymentID)
+	if err == sql.ErrNoRows || (err == nil && !payment.PayableBy(userID)) {
+		err = errPaymentNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	merchant, err = getMerchant(ctx, database, payment.MerchantID)
+	if err != nil {
+		logError(ctx, "customerPayment getMerchant", err)
+	}
+
+	return
+}
+
+// pendingError -> why a payment that is not pending at now cannot be approved or declined
+func pendingError(payment Payment, now time.Time) error {
+	switch payment.StatusAt(now) {
+	case paymentStatusPending:
+		return nil
+	case paymentStatusExpired:
+		return errPaymentExpired
+	default:
+		return errPaymentUnavailable
+	}
+}
+
+// ViewPayment -> a payment asked of the customer
+func ViewPayment(ctx context.Context, userID, paymentID string) (payment Payment, err error) {
+	ctx = withOperation(ctx, "view_payment")
+	ctx, span := startSpan(ctx, "ViewPayment", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	payment, _, err = customerPayment(ctx, userID, paymentID)
+	return
+}
+
+// ApprovePayment -> pay a pending payment from the main pocket of the enabled wallet. It
+// earns points by the category of the merchant.
+func ApprovePayment(ctx context.Context, userID, paymentID string) (payment Payment, err error) {
+	ctx = withOperation(ctx, "approve_payment")
+	ctx, span := startSpan(ctx, "ApprovePayment", spanKindInternal)
+	defer func() {
+		observeWalletResult("approve_payment", payment.Amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	payment, merchant, err := customerPayment(ctx, userID, paymentID)
+	if err != nil {
+		return
+	}
+
+	err = pendingError(payment, time.Now())
+	if err != nil {
+		return
+	}
+
+	main, err := pocketOf(ctx, wallet, "")
+	if err != nil {
+		return
+	}
+
+	if payment.Amount > main.Balance {
+		err = errInsufficientFunds
+		return
+	}
+
+	err = payPayment(ctx, database, &payment, merchant, wallet, userID)
+	if err != nil && err != errInsufficientFunds && err != errPaymentUnavailable {
+		logError(ctx, "ApprovePayment payPayment", err)
+	}
+
+	return
+}
+
+// DeclinePayment -> turn down a pending payment, it cannot be paid after
+func DeclinePayment(ctx context.Context, userID, paymentID string) (payment Payment, err error) {
+	ctx = withOperation(ctx, "decline_payment")
+	ctx, span := startSpan(ctx, "DeclinePayment", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	payment, merchant, err := customerPayment(ctx, userID, paymentID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	err = pendingError(payment, now)
+	if err != nil {
+		return
+	}
+
+	err = closePayment(ctx, database, &payment, merchant, userID, now)
+	return
+}
+
+// paymentExpiry -> closes the pending payments past their expiry every poll, so their
+// merchants hear of it
+type paymentExpiry struct {
+	clock clock
+	poll  time.Duration
+}
+
+func newPaymentExpiry(c clock) *paymentExpiry {
+	return &paymentExpiry{clock: c, poll: paymentExpiryPoll}
+}
+
+var walletPaymentExpiry = newPaymentExpiry(systemClock{})
+
+// run -> sweep now and then every poll, until ctx is done
+func (e *paymentExpiry) run(ctx context.Context) {
+	for {
+		e.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(e.poll):
+		}
+	}
+}
+
+// sweep -> expire the payments that expired by now, one at a time
+func (e *paymentExpiry) sweep(ctx context.Context) {
+	ctx = withOperation(ctx, "payment_expiry")
+	now := e.clock.Now()
+
+	paymentIDs, err := getExpiredPaymentIDs(ctx, database, now)
+	if err != nil {
+		logError(ctx, "paymentExpiry getExpiredPaymentIDs", err)
+		return
+	}
+
+	for _, paymentID := range paymentIDs {
+		payment, err := getPayment(ctx, database, paymentID)
+		if err != nil {
+			continue
+		}
+
+		merchant, err := getMerchant(ctx, database, payment.MerchantID)
+		if err != nil {
+			logError(ctx, "paymentExpiry getMerchant", err)
+			continue
+		}
+
+		// approved or declined since it was read
+		err = closePayment(ctx, database, &payment, merchant, "", now)
+		if err == errPaymentUnavailable {
+			continue
+		}
+		if err != nil {
+			logError(ctx, "paymentExpiry closePayment", err)
+			continue
+		}
+
+		logInfo(ctx, "payment expired", "payment_id", payment.ID, "merchant_id", merchant.ID)
+	}
+}
+
+// HandleCreatePayment -> Merchant: ask a customer for a payment of an order
+func HandleCreatePayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestPayment
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	payment, errs := paymentFromRequest(req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	payment, err := CreatePayment(r.Context(), payment)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePayment{
+		Payment: paymentResponse(payment, time.Now()),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListPayments -> Merchant: my latest payments, of one order with order_id
+func HandleListPayments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListPayments
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	payments, err := ListPayments(r.Context(), req.OrderID, req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	now := time.Now()
+	data := ResponsePayments{
+		Payments: []ResponsePaymentDetail{},
+	}
+	for _, payment := range payments {
+		data.Payments = append(data.Payments, paymentResponse(payment, now))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGetPayment -> Merchant: the status of a payment and its refunds
+func HandleGetPayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	payment, err := GetPayment(r.Context(), ps.ByName("payment_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePayment{
+		Payment: paymentResponse(payment, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleRefundPayment -> Merchant: give back all or part of a paid payment
+func HandleRefundPayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestRefund
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	if len(req.Reason) > maxPaymentTextLen {
+		writeValidationError(w, r, &response, validationErrors{"reason": {"Must be at most 200 characters."}})
+		return
+	}
+
+	payment, refund, err := RefundPayment(r.Context(), ps.ByName("payment_id"), req.Amount, req.Reason)
+	if err == errRefundTooLarge {
+		writeValidationError(w, r, &response, validationErrors{"amount": {errRefundTooLarge.Message + "."}})
+		return
+	}
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseRefund{
+		Refund:  refundResponse(refund),
+		Payment: paymentResponse(payment, time.Now()),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleViewPayment -> a payment a merchant asked of me
+func HandleViewPayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	payment, err := ViewPayment(r.Context(), userIDFromContext(r.Context()), ps.ByName("payment_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseWalletPayment{
+		Payment: walletPaymentResponse(payment, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleApprovePayment -> pay a payment a merchant asked of me from my main pocket
+func HandleApprovePayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	payment, err := ApprovePayment(r.Context(), userIDFromContext(r.Context()), ps.ByName("payment_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseWalletPayment{
+		Payment: walletPaymentResponse(payment, time.Now()),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleDeclinePayment -> turn down a payment a merchant asked of me
+func HandleDeclinePayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	payment, err := DeclinePayment(r.Context(), userIDFromContext(r.Context()), ps.ByName("payment_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseWalletPayment{
+		Payment: walletPaymentResponse(payment, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// paymentResponse -> the payment as its merchant sees it, with the fee
+func paymentResponse(payment Payment, now time.Time) ResponsePaymentDetail {
+	detail := ResponsePaymentDetail{
+		ID:                      payment.ID,
+		OrderID:                 payment.OrderID,
+		Amount:                  payment.Amount,
+		Fee:                     payment.Fee,
+		Net:                     payment.Amount - payment.Fee,
+		Description:             payment.Description,
+		CustomerID:              payment.CustomerID,
+		Status:                  payment.StatusAt(now),
+		Refunded:                payment.Refunded,
+		PaidBy:                  payment.PayerID,
+		SettlementTransactionID: payment.SettlementTransactionID,
+		ExpiresAt:               payment.ExpireTime,
+		CreatedAt:               payment.CreateTime,
+	}
+	if !payment.PayTime.IsZero() {
+		detail.PaidAt = &payment.PayTime
+	}
+	for _, refund := range payment.Refunds {
+		detail.Refunds = append(detail.Refunds, refundResponse(refund))
+	}
+
+	return detail
+}
+
+// walletPaymentResponse -> the payment as the customer sees it, without the fee
+func walletPaymentResponse(payment Payment, now time.Time) ResponseWalletPaymentDetail {
+	detail := ResponseWalletPaymentDetail{
+		ID:            payment.ID,
+		MerchantID:    payment.MerchantID,
+		MerchantName:  payment.MerchantName,
+		OrderID:       payment.OrderID,
+		Amount:        payment.Amount,
+		Description:   payment.Description,
+		Status:        payment.StatusAt(now),
+		Refunded:      payment.Refunded,
+		TransactionID: payment.TransactionID,
+		ExpiresAt:     payment.ExpireTime,
+		CreatedAt:     payment.CreateTime,
+	}
+	if !payment.PayTime.IsZero() {
+		detail.PaidAt = &payment.PayTime
+	}
+
+	return detail
+}
+
+func refundResponse(refund PaymentRefund) ResponseRefundDetail {
+	return ResponseRefundDetail{
+		ID:                  refund.ID,
+		Amount:              refund.Amount,
+		Reason:              refund.Reason,
+		TransactionID:       refund.TransactionID,
+		RefundTransactionID: refund.RefundTransactionID,
+		CreatedAt:           refund.CreateTime,
+	}
+}
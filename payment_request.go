@@ -0,0 +1,1184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// A payment request asks one or more customers for a share each, e.g. to split a bill.
+// Accepting a share transfers it from the main pocket of the payer to the requester,
+// declining turns it down. Every answer is written in one tx with the transfer and the
+// status of the request, so payers answering at once cannot pay a share twice or leave
+// the request open after the last answer.
+
+const (
+	paymentRequestStatusOpen      = "open"
+	paymentRequestStatusSettled   = "settled"
+	paymentRequestStatusClosed    = "closed"
+	paymentRequestStatusCancelled = "cancelled"
+	paymentRequestStatusExpired   = "expired"
+
+	shareStatusPending   = "pending"
+	shareStatusPaid      = "paid"
+	shareStatusDeclined  = "declined"
+	shareStatusCancelled = "cancelled"
+	shareStatusExpired   = "expired"
+
+	paymentRequestRoleSent     = "sent"
+	paymentRequestRoleReceived = "received"
+
+	// paymentRequestReferencePrefix -> reference_id of the transfer paying a share, followed
+	// by the id of the share
+	paymentRequestReferencePrefix = "payment_request:"
+
+	defaultPaymentRequestExpiry = 7 * 24 * time.Hour
+	maxPaymentRequestExpiry     = 30 * 24 * time.Hour
+	maxPaymentRequestPayers     = 20
+)
+
+// PaymentRequest -> Amount asked by RequesterID, split into a share per payer. Status is
+// open until every share was answered: settled when all of them were paid, closed
+// otherwise, or cancelled by the requester.
+type PaymentRequest struct {
+	ID          string    `db:"id"`
+	RequesterID string    `db:"requester_id"`
+	WalletID    string    `db:"wallet_id"`
+	Description string    `db:"description"`
+	Amount      int       `db:"amount"`
+	Status      string    `db:"status"`
+	ExpireTime  time.Time `db:"expire_time"`
+	CreateTime  time.Time `db:"create_time"`
+	UpdateTime  time.Time `db:"update_time"`
+
+	// Shares -> every share when it was read, not stored
+	Shares []PaymentRequestShare
+}
+
+// PaymentRequestShare -> Amount asked of PayerID, TransferID paid it once it is paid
+type PaymentRequestShare struct {
+	ID         string    `db:"id"`
+	RequestID  string    `db:"request_id"`
+	PayerID    string    `db:"payer_id"`
+	Amount     int       `db:"amount"`
+	Status     string    `db:"status"`
+	TransferID string    `db:"transfer_id"`
+	AnswerTime time.Time `db:"answer_time"`
+	CreateTime time.Time `db:"create_time"`
+}
+
+// StatusAt -> Status, or expired for an open request past its expiry
+func (r PaymentRequest) StatusAt(now time.Time) string {
+	if r.Status == paymentRequestStatusOpen && !now.Before(r.ExpireTime) {
+		return paymentRequestStatusExpired
+	}
+
+	return r.Status
+}
+
+// ShareStatusAt -> the status of share, or expired for a pending share of an expired request
+func (r PaymentRequest) ShareStatusAt(share PaymentRequestShare, now time.Time) string {
+	if share.Status == shareStatusPending && r.StatusAt(now) == paymentRequestStatusExpired {
+		return shareStatusExpired
+	}
+
+	return share.Status
+}
+
+// Paid -> the part of Amount paid so far
+func (r PaymentRequest) Paid() (paid int) {
+	for _, share := range r.Shares {
+		if share.Status == shareStatusPaid {
+			paid += share.Amount
+		}
+	}
+
+	return
+}
+
+// ShareOf -> the share asked of userID
+func (r PaymentRequest) ShareOf(userID string) (share PaymentRequestShare, ok bool) {
+	for _, share := range r.Shares {
+		if share.PayerID == userID {
+			return share, true
+		}
+	}
+
+	return
+}
+
+// VisibleTo -> the request as userID may see it, the requester sees every share and a payer
+// only their own. False for everyone else.
+func (r PaymentRequest) VisibleTo(userID string) (PaymentRequest, bool) {
+	if r.RequesterID == userID {
+		return r, true
+	}
+
+	share, ok := r.ShareOf(userID)
+	if !ok {
+		return r, false
+	}
+	r.Shares = []PaymentRequestShare{share}
+
+	return r, true
+}
+
+const (
+	createPaymentRequestTable = `
+		CREATE TABLE IF NOT EXISTS payment_request (
+			id TEXT NOT NULL PRIMARY KEY,
+			requester_id TEXT NOT NULL,
+			wallet_id TEXT NOT NULL,
+			description TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			expire_time DATETIME NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createPaymentRequestShareTable = `
+		CREATE TABLE IF NOT EXISTS payment_request_share (
+			id TEXT NOT NULL PRIMARY KEY,
+			request_id TEXT NOT NULL,
+			payer_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			transfer_id TEXT NOT NULL,
+			answer_time DATETIME,
+			create_time DATETIME NOT NULL,
+			UNIQUE (request_id, payer_id)
+		);
+	`
+
+	insertPaymentRequestSQL = `
+		INSERT INTO payment_request
+			(id, requester_id, wallet_id, description, amount, status, expire_time, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	insertPaymentRequestShareSQL = `
+		INSERT INTO payment_request_share
+			(id, request_id, payer_id, amount, status, transfer_id, create_time)
+		VALUES
+			(?,?,?,?,?,'',?)
+		;
+	`
+
+	selectPaymentRequestSQL = `
+		SELECT
+			id,
+			requester_id,
+			wallet_id,
+			description,
+			amount,
+			status,
+			expire_time,
+			create_time,
+			update_time
+		FROM
+			payment_request
+	`
+
+	getPaymentRequestSQL = selectPaymentRequestSQL + `
+		WHERE
+			id = $1
+	`
+
+	getSentPaymentRequestsSQL = selectPaymentRequestSQL + `
+		WHERE
+			requester_id = $1
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $2
+	`
+
+	getReceivedPaymentRequestsSQL = selectPaymentRequestSQL + `
+		WHERE
+			id IN (SELECT request_id FROM payment_request_share WHERE payer_id = $1)
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $2
+	`
+
+	selectPaymentRequestShareSQL = `
+		SELECT
+			id,
+			request_id,
+			payer_id,
+			amount,
+			status,
+			transfer_id,
+			answer_time,
+			create_time
+		FROM
+			payment_request_share
+	`
+
+	getPaymentRequestSharesSQL = selectPaymentRequestShareSQL + `
+		WHERE
+			request_id = $1
+		ORDER BY
+			rowid
+	`
+
+	// getSentPaymentRequestSharesSQL -> the shares of the requests of getSentPaymentRequestsSQL
+	getSentPaymentRequestSharesSQL = selectPaymentRequestShareSQL + `
+		WHERE
+			request_id IN (
+				SELECT id FROM payment_request
+				WHERE requester_id = $1
+				ORDER BY create_time DESC, rowid DESC
+				LIMIT $2
+			)
+		ORDER BY
+			rowid
+	`
+
+	// getReceivedPaymentRequestSharesSQL -> the shares of the requests of
+	// getReceivedPaymentRequestsSQL
+	getReceivedPaymentRequestSharesSQL = selectPaymentRequestShareSQL + `
+		WHERE
+			request_id IN (
+				SELECT id FROM payment_request
+				WHERE id IN (SELECT request_id FROM payment_request_share WHERE payer_id = $1)
+				ORDER BY create_time DESC, rowid DESC
+				LIMIT $2
+			)
+		ORDER BY
+			rowid
+	`
+
+	// answerShareSQL -> pay or decline a pending share, nothing changes once it was answered
+	// or its request is no longer open
+	answerShareSQL = `
+		UPDATE
+			payment_request_share
+		SET
+			status = $1,
+			transfer_id = $2,
+			answer_time = $3
+		WHERE
+			id = $4 AND
+			status = 'pending' AND
+			request_id IN (
+				SELECT id FROM payment_request
+				WHERE status = 'open' AND julianday(expire_time) > julianday($3)
+			)
+	`
+
+	// settlePaymentRequestSQL -> settled once every share is paid, closed once every share
+	// was answered and some were not paid, open while a share is pending
+	settlePaymentRequestSQL = `
+		UPDATE
+			payment_request
+		SET
+			status = CASE
+				WHEN EXISTS (SELECT 1 FROM payment_request_share WHERE request_id = $1 AND status = 'pending') THEN status
+				WHEN EXISTS (SELECT 1 FROM payment_request_share WHERE request_id = $1 AND status <> 'paid') THEN 'closed'
+				ELSE 'settled'
+			END,
+			update_time = $2
+		WHERE
+			id = $1
+	`
+
+	cancelPaymentRequestSQL = `
+		UPDATE
+			payment_request
+		SET
+			status = 'cancelled',
+			update_time = $1
+		WHERE
+			id = $2 AND
+			status = 'open' AND
+			julianday(expire_time) > julianday($1)
+	`
+
+	cancelPaymentRequestSharesSQL = `
+		UPDATE
+			payment_request_share
+		SET
+			status = 'cancelled',
+			answer_time = $1
+		WHERE
+			request_id = $2 AND
+			status = 'pending'
+	`
+)
+
+func scanPaymentRequest(scanner interface{ Scan(...interface{}) error }) (request PaymentRequest, err error) {
+	err = scanner.Scan(
+		&request.ID,
+		&request.RequesterID,
+		&request.WalletID,
+		&request.Description,
+		&request.Amount,
+		&request.Status,
+		&request.ExpireTime,
+		&request.CreateTime,
+		&request.UpdateTime,
+	)
+
+	return
+}
+
+func queryPaymentRequestShares(ctx context.Context, q querier, query string, args ...interface{}) (shares []PaymentRequestShare, err error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			share      PaymentRequestShare
+			answerTime sql.NullTime
+		)
+		err = rows.Scan(
+			&share.ID,
+			&share.RequestID,
+			&share.PayerID,
+			&share.Amount,
+			&share.Status,
+			&share.TransferID,
+			&answerTime,
+			&share.CreateTime,
+		)
+		if err != nil {
+			return
+		}
+		share.AnswerTime = answerTime.Time
+
+		shares = append(shares, share)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// queryPaymentRequest -> the request with every share, read in tx when it is set
+func queryPaymentRequest(ctx context.Context, db *sql.DB, tx *sql.Tx, requestID string) (request PaymentRequest, err error) {
+	if tx != nil {
+		request, err = scanPaymentRequest(tx.QueryRowContext(ctx, getPaymentRequestSQL, requestID))
+		if err != nil {
+			return
+		}
+
+		request.Shares, err = queryPaymentRequestShares(ctx, tx, getPaymentRequestSharesSQL, requestID)
+		return
+	}
+
+	request, err = scanPaymentRequest(db.QueryRowContext(ctx, getPaymentRequestSQL, requestID))
+	if err != nil {
+		return
+	}
+
+	request.Shares, err = queryPaymentRequestShares(ctx, db, getPaymentRequestSharesSQL, requestID)
+	return
+}
+
+// insertPaymentRequest -> the request and its shares in one tx
+func insertPaymentRequest(ctx context.Context, db *sql.DB, request PaymentRequest) (err error) {
+	defer observeQuery("insertPaymentRequest", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertPaymentRequest")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertPaymentRequest BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		insertPaymentRequestSQL,
+		request.ID,
+		request.RequesterID,
+		request.WalletID,
+		request.Description,
+		request.Amount,
+		request.Status,
+		request.ExpireTime,
+		request.CreateTime,
+		request.UpdateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertPaymentRequest request", err)
+		return
+	}
+
+	for _, share := range request.Shares {
+		_, err = tx.ExecContext(ctx,
+			insertPaymentRequestShareSQL,
+			share.ID,
+			share.RequestID,
+			share.PayerID,
+			share.Amount,
+			share.Status,
+			share.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "insertPaymentRequest share", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertPaymentRequest Commit", err)
+	}
+
+	return
+}
+
+func getPaymentRequest(ctx context.Context, db *sql.DB, requestID string) (request PaymentRequest, err error) {
+	defer observeQuery("getPaymentRequest", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPaymentRequest")
+	defer func() {
+		span.end(err)
+	}()
+
+	request, err = queryPaymentRequest(ctx, db, nil, requestID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getPaymentRequest Scan", err)
+	}
+
+	return
+}
+
+// getPaymentRequests -> the latest requests userID sent, or was asked to pay when role is
+// received, with every share
+func getPaymentRequests(ctx context.Context, db *sql.DB, userID, role string, limit int) (requests []PaymentRequest, err error) {
+	defer observeQuery("getPaymentRequests", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPaymentRequests")
+	defer func() {
+		span.end(err)
+	}()
+
+	requestsSQL, sharesSQL := getSentPaymentRequestsSQL, getSentPaymentRequestSharesSQL
+	if role == paymentRequestRoleReceived {
+		requestsSQL, sharesSQL = getReceivedPaymentRequestsSQL, getReceivedPaymentRequestSharesSQL
+	}
+
+	rows, err := db.QueryContext(ctx, requestsSQL, userID, limit)
+	if err != nil {
+		logError(ctx, "getPaymentRequests QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var request PaymentRequest
+		request, err = scanPaymentRequest(rows)
+		if err != nil {
+			logError(ctx, "getPaymentRequests Scan", err)
+			return
+		}
+
+		requests = append(requests, request)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		logError(ctx, "getPaymentRequests Rows", err)
+		return
+	}
+
+	shares, err := queryPaymentRequestShares(ctx, db, sharesSQL, userID, limit)
+	if err != nil {
+		logError(ctx, "getPaymentRequests shares", err)
+		return
+	}
+
+	index := map[string]int{}
+	for i, request := range requests {
+		index[request.ID] = i
+	}
+	for _, share := range shares {
+		if i, ok := index[share.RequestID]; ok {
+			requests[i].Shares = append(requests[i].Shares, share)
+		}
+	}
+
+	return
+}
+
+// answerShare -> pay share with transfer, or decline it when transfer is nil, and settle the
+// request in one tx. errPaymentRequestUnavailable when the share was already answered or
+// the request is no longer open.
+func answerShare(ctx context.Context, db *sql.DB, request *PaymentRequest, share PaymentRequestShare, transfer *Transfer) (err error) {
+	defer observeQuery("answerShare", time.Now())
+	ctx, span := startQuerySpan(ctx, "answerShare")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "answerShare BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	status, transferID := shareStatusDeclined, ""
+	if transfer != nil {
+		status, transferID = shareStatusPaid, transfer.ID
+	}
+
+	result, err := tx.ExecContext(ctx, answerShareSQL, status, transferID, now, share.ID)
+	if err != nil {
+		logError(ctx, "answerShare claim", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "answerShare RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errPaymentRequestUnavailable
+		return
+	}
+
+	var events []walletEvent
+	if transfer != nil {
+		events, err = applyTransfer(ctx, tx, transfer)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, settlePaymentRequestSQL, request.ID, now)
+	if err != nil {
+		logError(ctx, "answerShare settle", err)
+		return
+	}
+
+	*request, err = queryPaymentRequest(ctx, db, tx, request.ID)
+	if err != nil {
+		logError(ctx, "answerShare Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "answerShare Commit", err)
+		return
+	}
+
+	for _, event := range events {
+		publishWalletEvent(ctx, event)
+	}
+
+	return
+}
+
+// cancelPaymentRequest -> cancel an open request and its pending shares in one tx, the
+// shares paid so far stay paid. errPaymentRequestUnavailable when it is no longer open.
+func cancelPaymentRequest(ctx context.Context, db *sql.DB, request *PaymentRequest) (err error) {
+	defer observeQuery("cancelPaymentRequest", time.Now())
+	ctx, span := startQuerySpan(ctx, "cancelPaymentRequest")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "cancelPaymentRequest BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, cancelPaymentRequestSQL, now, request.ID)
+	if err != nil {
+		logError(ctx, "cancelPaymentRequest request", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "cancelPaymentRequest RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errPaymentRequestUnavailable
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, cancelPaymentRequestSharesSQL, now, request.ID)
+	if err != nil {
+		logError(ctx, "cancelPaymentRequest shares", err)
+		return
+	}
+
+	*request, err = queryPaymentRequest(ctx, db, tx, request.ID)
+	if err != nil {
+		logError(ctx, "cancelPaymentRequest Scan", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "cancelPaymentRequest Commit", err)
+	}
+
+	return
+}
+
+// parsePayers -> the shares of "user_id:amount,...", e.g. "alice:5000,bob:7500". A user id
+// may hold colons, the amount follows the last one.
+func parsePayers(s string) (shares []PaymentRequestShare, err error) {
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		i := strings.LastIndex(part, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not user_id:amount", part)
+		}
+
+		share := PaymentRequestShare{PayerID: strings.TrimSpace(part[:i])}
+		share.Amount, err = strconv.Atoi(part[i+1:])
+		if err != nil || share.Amount < 1 {
+			return nil, fmt.Errorf("%q needs an amount of at least 1", part)
+		}
+
+		if seen[share.PayerID] {
+			return nil, fmt.Errorf("%s is asked twice", share.PayerID)
+		}
+		seen[share.PayerID] = true
+
+		shares = append(shares, share)
+	}
+
+	if len(shares) > maxPaymentRequestPayers {
+		return nil, fmt.Errorf("at most %d payers", maxPaymentRequestPayers)
+	}
+
+	return
+}
+
+// paymentRequestFromRequest -> the payment request of userID in req, or the fields that are
+// wrong
+func paymentRequestFromRequest(userID string, req RequestPaymentRequest, now time.Time) (request PaymentRequest, errs validationErrors) {
+	errs = validationErrors{}
+
+	request = PaymentRequest{
+		ID:          generateUUID(),
+		RequesterID: userID,
+		Description: strings.TrimSpace(req.Description),
+		Status:      paymentRequestStatusOpen,
+		ExpireTime:  now.Add(defaultPaymentRequestExpiry),
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+
+	shares, err := parsePayers(req.Payers)
+	if err != nil {
+		errs.add("payers", "Not valid payers: "+err.Error()+".")
+	}
+	for _, share := range shares {
+		if share.PayerID == userID {
+			errs.add("payers", "Must not ask yourself.")
+			break
+		}
+		if strings.HasPrefix(share.PayerID, merchantUserPrefix) {
+			errs.add("payers", "Must be customers.")
+			break
+		}
+	}
+
+	for _, share := range shares {
+		share.ID = generateUUID()
+		share.RequestID = request.ID
+		share.Status = shareStatusPending
+		share.CreateTime = now
+
+		request.Amount += share.Amount
+		request.Shares = append(request.Shares, share)
+	}
+
+	if len(request.Description) > maxPaymentTextLen {
+		errs.add("description", "Must be at most 200 characters.")
+	}
+
+	if req.ExpiresAt != "" {
+		expireTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		switch {
+		case err != nil:
+			errs.add("expires_at", "Must be an RFC 3339 time.")
+		case !expireTime.After(now):
+			errs.add("expires_at", "Must be in the future.")
+		case expireTime.Sub(now) > maxPaymentRequestExpiry:
+			errs.add("expires_at", "Must be within 30 days.")
+		default:
+			request.ExpireTime = expireTime
+		}
+	}
+
+	return
+}
+
+// visiblePaymentRequest -> the request as userID may see it, errPaymentRequestNotFound for
+// everyone but the requester and its payers
+func visiblePaymentRequest(ctx context.Context, userID, requestID string) (request PaymentRequest, err error) {
+	request, err = getPaymentRequest(ctx, database, requestID)
+	if err == sql.ErrNoRows {
+		err = errPaymentRequestNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	request, ok := request.VisibleTo(userID)
+	if !ok {
+		err = errPaymentRequestNotFound
+	}
+
+	return
+}
+
+// pendingShare -> the share of userID in the request, while it can still be answered
+func pendingShare(ctx context.Context, userID, requestID string) (request PaymentRequest, share PaymentRequestShare, err error) {
+	request, err = visiblePaymentRequest(ctx, userID, requestID)
+	if err != nil {
+		return
+	}
+
+	share, ok := request.ShareOf(userID)
+	if !ok {
+		err = errPaymentRequestNotFound
+		return
+	}
+
+	switch request.ShareStatusAt(share, time.Now()) {
+	case shareStatusPending:
+	case shareStatusExpired:
+		err = errPaymentRequestExpired
+	default:
+		err = errPaymentRequestUnavailable
+	}
+
+	return
+}
+
+// CreatePaymentRequest -> ask every payer of request for their share, every payer needs an
+// enabled wallet
+func CreatePaymentRequest(ctx context.Context, request PaymentRequest) (created PaymentRequest, err error) {
+	ctx = withOperation(ctx, "create_payment_request")
+	ctx, span := startSpan(ctx, "CreatePaymentRequest", spanKindInternal)
+	span.setAttribute("amount", request.Amount)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, request.RequesterID)
+	if err != nil {
+		return
+	}
+	request.WalletID = wallet.ID
+
+	for _, share := range request.Shares {
+		var payer Wallet
+		payer, err = getWalletByUserID(ctx, database, share.PayerID)
+		if err != nil && err != sql.ErrNoRows {
+			logError(ctx, "CreatePaymentRequest getWalletByUserID", err)
+			return
+		}
+		err = nil
+
+		if payer.ID == "" || payer.Status == statusInactive {
+			err = &Error{Code: codeNotFound, Message: "Payer " + share.PayerID + " has no enabled wallet"}
+			return
+		}
+	}
+
+	err = insertPaymentRequest(ctx, database, request)
+	if err != nil {
+		return
+	}
+
+	return request, nil
+}
+
+// ListPaymentRequests -> the latest requests userID sent, or was asked to pay when role is
+// received, as userID may see them
+func ListPaymentRequests(ctx context.Context, userID, role string, limit int) (requests []PaymentRequest, err error) {
+	ctx = withOperation(ctx, "list_payment_requests")
+	ctx, span := startSpan(ctx, "ListPaymentRequests", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	requests, err = getPaymentRequests(ctx, database, userID, role, limit)
+	if err != nil {
+		return
+	}
+
+	for i := range requests {
+		requests[i], _ = requests[i].VisibleTo(userID)
+	}
+
+	return
+}
+
+// ViewPaymentRequest -> a request userID sent or was asked to pay
+func ViewPaymentRequest(ctx context.Context, userID, requestID string) (request PaymentRequest, err error) {
+	ctx = withOperation(ctx, "view_payment_request")
+	ctx, span := startSpan(ctx, "ViewPaymentRequest", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	request, err = visiblePaymentRequest(ctx, userID, requestID)
+	return
+}
+
+// AcceptPaymentRequest -> pay the share of userID as a transfer from the main pocket to the
+// requester, the transfer fee is paid on top
+func AcceptPaymentRequest(ctx context.Context, userID, requestID string) (request PaymentRequest, transfer Transfer, err error) {
+	ctx = withOperation(ctx, "accept_payment_request")
+	ctx, span := startSpan(ctx, "AcceptPaymentRequest", spanKindInternal)
+	defer func() {
+		observeWalletResult("accept_payment_request", transfer.Amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	request, share, err := pendingShare(ctx, userID, requestID)
+	if err != nil {
+		return
+	}
+
+	recipient, err := getWalletByUserID(ctx, database, request.RequesterID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "AcceptPaymentRequest getWalletByUserID", err)
+		return
+	}
+	err = nil
+
+	if recipient.ID == "" || recipient.Status == statusInactive {
+		err = errRecipientUnavailable
+		return
+	}
+
+	main, err := pocketOf(ctx, wallet, "")
+	if err != nil {
+		return
+	}
+
+	fee, err := quoteFee(ctx, wallet, feeTransactionTransfer, share.Amount, time.Now())
+	if err != nil {
+		return
+	}
+
+	if share.Amount+fee.Amount > main.Balance {
+		err = errInsufficientFunds
+		return
+	}
+
+	transfer = Transfer{
+		ID:           generateUUID(),
+		FromWalletID: wallet.ID,
+		ToWalletID:   recipient.ID,
+		ToUserID:     request.RequesterID,
+		Amount:       share.Amount,
+		ReferenceID:  paymentRequestReferencePrefix + share.ID,
+		Fee:          fee,
+	}
+
+	err = answerShare(ctx, database, &request, share, &transfer)
+	if err != nil {
+		if err != errInsufficientFunds && err != errPaymentRequestUnavailable {
+			logError(ctx, "AcceptPaymentRequest answerShare", err)
+		}
+		return
+	}
+
+	request, _ = request.VisibleTo(userID)
+	return
+}
+
+// DeclinePaymentRequest -> turn down the share of userID, it cannot be paid after
+func DeclinePaymentRequest(ctx context.Context, userID, requestID string) (request PaymentRequest, err error) {
+	ctx = withOperation(ctx, "decline_payment_request")
+	ctx, span := startSpan(ctx, "DeclinePaymentRequest", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	request, share, err := pendingShare(ctx, userID, requestID)
+	if err != nil {
+		return
+	}
+
+	err = answerShare(ctx, database, &request, share, nil)
+	if err != nil {
+		return
+	}
+
+	request, _ = request.VisibleTo(userID)
+	return
+}
+
+// CancelPaymentRequest -> withdraw an open request of userID, its pending shares cannot be
+// paid after
+func CancelPaymentRequest(ctx context.Context, userID, requestID string) (request PaymentRequest, err error) {
+	ctx = withOperation(ctx, "cancel_payment_request")
+	ctx, span := startSpan(ctx, "CancelPaymentRequest", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	request, err = visiblePaymentRequest(ctx, userID, requestID)
+	if err != nil {
+		return
+	}
+
+	if request.RequesterID != userID {
+		err = errPaymentRequestNotFound
+		return
+	}
+
+	switch request.StatusAt(time.Now()) {
+	case paymentRequestStatusOpen:
+	case paymentRequestStatusExpired:
+		err = errPaymentRequestExpired
+		return
+	default:
+		err = errPaymentRequestUnavailable
+		return
+	}
+
+	err = cancelPaymentRequest(ctx, database, &request)
+	return
+}
+
+// HandleCreatePaymentRequest -> ask other customers for a share each, e.g. to split a bill
+func HandleCreatePaymentRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestPaymentRequest
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	now := time.Now()
+	request, errs := paymentRequestFromRequest(userIDFromContext(r.Context()), req, now)
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	request, err := CreatePaymentRequest(r.Context(), request)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePaymentRequest{
+		Request: paymentRequestResponse(request, now),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListPaymentRequests -> the latest requests I sent, or was asked to pay with
+// role=received
+func HandleListPaymentRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListPaymentRequests
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	switch req.Role {
+	case "":
+		req.Role = paymentRequestRoleSent
+	case paymentRequestRoleSent, paymentRequestRoleReceived:
+	default:
+		writeValidationError(w, r, &response, validationErrors{"role": {"Must be sent or received."}})
+		return
+	}
+
+	requests, err := ListPaymentRequests(r.Context(), userIDFromContext(r.Context()), req.Role, req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	now := time.Now()
+	data := ResponsePaymentRequests{
+		Requests: []ResponsePaymentRequestDetail{},
+	}
+	for _, request := range requests {
+		data.Requests = append(data.Requests, paymentRequestResponse(request, now))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleViewPaymentRequest -> a request I sent with the status of every payer, or my share
+// of a request I was asked to pay
+func HandleViewPaymentRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	request, err := ViewPaymentRequest(r.Context(), userIDFromContext(r.Context()), ps.ByName("request_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePaymentRequest{
+		Request: paymentRequestResponse(request, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleAcceptPaymentRequest -> pay my share of a request from my main pocket
+func HandleAcceptPaymentRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	request, transfer, err := AcceptPaymentRequest(r.Context(), uID, ps.ByName("request_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePaymentRequestAccepted{
+		Request:  paymentRequestResponse(request, time.Now()),
+		Transfer: transferResponse(uID, transfer),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleDeclinePaymentRequest -> turn down my share of a request
+func HandleDeclinePaymentRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	request, err := DeclinePaymentRequest(r.Context(), userIDFromContext(r.Context()), ps.ByName("request_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePaymentRequest{
+		Request: paymentRequestResponse(request, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleCancelPaymentRequest -> withdraw an open request I sent
+func HandleCancelPaymentRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	request, err := CancelPaymentRequest(r.Context(), userIDFromContext(r.Context()), ps.ByName("request_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePaymentRequest{
+		Request: paymentRequestResponse(request, time.Now()),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// paymentRequestResponse -> the request with the shares it was read with, a payer only
+// reads their own
+func paymentRequestResponse(request PaymentRequest, now time.Time) ResponsePaymentRequestDetail {
+	detail := ResponsePaymentRequestDetail{
+		ID:          request.ID,
+		RequestedBy: request.RequesterID,
+		Description: request.Description,
+		Amount:      request.Amount,
+		Paid:        request.Paid(),
+		Status:      request.StatusAt(now),
+		ExpiresAt:   request.ExpireTime,
+		CreatedAt:   request.CreateTime,
+		Shares:      []ResponsePaymentRequestShare{},
+	}
+	for _, share := range request.Shares {
+		item := ResponsePaymentRequestShare{
+			PayerID:    share.PayerID,
+			Amount:     share.Amount,
+			Status:     request.ShareStatusAt(share, now),
+			TransferID: share.TransferID,
+		}
+		if !share.AnswerTime.IsZero() {
+			answerTime := share.AnswerTime
+			item.AnsweredAt = &answerTime
+		}
+
+		detail.Shares = append(detail.Shares, item)
+	}
+
+	return detail
+}
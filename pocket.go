@@ -0,0 +1,872 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Pockets split the balance of a wallet. Every wallet has a main pocket, created with it,
+// that deposits and withdrawals use unless they name another one, and the balance of the
+// wallet is always the sum of its pockets.
+
+const (
+	mainPocketName = "Main"
+
+	// mainPocketAlias -> accepted wherever a pocket id is, for the main pocket
+	mainPocketAlias = "main"
+
+	maxPockets        = 20
+	maxPocketNameSize = 50
+
+	pocketEntryDeposit    = "deposit"
+	pocketEntryWithdrawal = "withdrawal"
+	pocketEntryInterest   = "interest"
+	pocketEntryFee        = "fee"
+	pocketEntryPromo      = "promo"
+	pocketEntryCashback   = "cashback"
+	pocketEntryExpiry     = "expiry"
+	pocketEntryMoveIn     = "move_in"
+	pocketEntryMoveOut    = "move_out"
+)
+
+// Pocket -> a named part of the balance of a wallet
+type Pocket struct {
+	ID         string    `db:"id"`
+	WalletID   string    `db:"wallet_id"`
+	Name       string    `db:"name"`
+	Main       bool      `db:"main"`
+	Balance    int       `db:"balance"`
+	CreateTime time.Time `db:"create_time"`
+}
+
+// PocketEntry -> one change of the balance of a pocket, from a wallet transaction or a move
+type PocketEntry struct {
+	ID            string    `db:"id"`
+	PocketID      string    `db:"pocket_id"`
+	Kind          string    `db:"kind"`
+	Amount        int       `db:"amount"`
+	Balance       int       `db:"balance"`
+	TransactionID string    `db:"transaction_id"`
+	MoveID        string    `db:"move_id"`
+	OtherPocketID string    `db:"other_pocket_id"`
+	ReferenceID   string    `db:"reference_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// SignedAmount -> change of the pocket balance, negative when money left it
+func (e PocketEntry) SignedAmount() int {
+	if e.Kind == pocketEntryWithdrawal || e.Kind == pocketEntryFee || e.Kind == pocketEntryExpiry || e.Kind == pocketEntryMoveOut {
+		return -e.Amount
+	}
+
+	return e.Amount
+}
+
+const (
+	createPocketTable = `
+		CREATE TABLE IF NOT EXISTS pocket (
+			id TEXT NOT NULL PRIMARY KEY,
+			wallet_id TEXT NOT NULL,
+			name TEXT NOT NULL COLLATE NOCASE,
+			main INTEGER NOT NULL,
+			balance INTEGER NOT NULL,
+			create_time DATETIME NOT NULL,
+			UNIQUE (wallet_id, name)
+		);
+	`
+
+	createPocketEntryTable = `
+		CREATE TABLE IF NOT EXISTS pocket_entry (
+			id TEXT NOT NULL PRIMARY KEY,
+			pocket_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			balance INTEGER NOT NULL,
+			transaction_id TEXT NOT NULL,
+			move_id TEXT NOT NULL,
+			other_pocket_id TEXT NOT NULL,
+			reference_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertPocketSQL = `
+		INSERT INTO pocket
+			(id, wallet_id, name, main, balance, create_time)
+		VALUES
+			(?,?,?,?,?,?)
+		;
+	`
+
+	selectPocketSQL = `
+		SELECT
+			id,
+			wallet_id,
+			name,
+			main,
+			balance,
+			create_time
+		FROM
+			pocket
+	`
+
+	getPocketsByWalletIDSQL = selectPocketSQL + `
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			main DESC,
+			create_time
+	`
+
+	getPocketSQL = selectPocketSQL + `
+		WHERE
+			wallet_id = $1 AND
+			(id = $2 OR (main = 1 AND $2 = '` + mainPocketAlias + `'))
+	`
+
+	getMainPocketIDSQL = `
+		SELECT
+			id
+		FROM
+			pocket
+		WHERE
+			wallet_id = $1 AND
+			main = 1
+	`
+
+	addPocketBalanceSQL = `
+		UPDATE
+			pocket
+		SET
+			balance = balance + $1
+		WHERE
+			id = $2
+	`
+
+	takePocketBalanceSQL = `
+		UPDATE
+			pocket
+		SET
+			balance = balance - $1
+		WHERE
+			id = $2 AND
+			balance >= $1
+	`
+
+	getPocketBalanceSQL = `
+		SELECT
+			balance
+		FROM
+			pocket
+		WHERE
+			id = $1
+	`
+
+	deletePocketSQL = `
+		DELETE FROM
+			pocket
+		WHERE
+			id = $1 AND
+			main = 0
+	`
+
+	insertPocketEntrySQL = `
+		INSERT INTO pocket_entry
+			(id, pocket_id, kind, amount, balance, transaction_id, move_id, other_pocket_id, reference_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getPocketEntriesSQL = `
+		SELECT
+			id,
+			pocket_id,
+			kind,
+			amount,
+			balance,
+			transaction_id,
+			move_id,
+			other_pocket_id,
+			reference_id,
+			create_time
+		FROM
+			pocket_entry
+		WHERE
+			pocket_id = $1
+		ORDER BY
+			julianday(create_time) DESC,
+			rowid DESC
+		LIMIT $2
+	`
+)
+
+// insertMainPocket -> the main pocket of a new wallet, holding all of its balance
+func insertMainPocket(ctx context.Context, tx *sql.Tx, walletID string, balance int, now time.Time) (err error) {
+	_, err = tx.ExecContext(ctx, insertPocketSQL, generateUUID(), walletID, mainPocketName, true, balance, now)
+	if err != nil {
+		logError(ctx, "insertMainPocket ExecContext", err)
+	}
+
+	return
+}
+
+func insertPocket(ctx context.Context, db *sql.DB, pocket Pocket) (err error) {
+	defer observeQuery("insertPocket", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertPocket")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, insertPocketSQL, pocket.ID, pocket.WalletID, pocket.Name, pocket.Main, pocket.Balance, pocket.CreateTime)
+	if err != nil {
+		logError(ctx, "insertPocket ExecContext", err)
+	}
+
+	return
+}
+
+func scanPockets(rows *sql.Rows) (pockets []Pocket, err error) {
+	for rows.Next() {
+		var pocket Pocket
+		err = rows.Scan(&pocket.ID, &pocket.WalletID, &pocket.Name, &pocket.Main, &pocket.Balance, &pocket.CreateTime)
+		if err != nil {
+			return
+		}
+
+		pockets = append(pockets, pocket)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getPockets(ctx context.Context, db *sql.DB, walletID string) (pockets []Pocket, err error) {
+	defer observeQuery("getPockets", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPockets")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPocketsByWalletIDSQL, walletID)
+	if err != nil {
+		logError(ctx, "getPockets QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	pockets, err = scanPockets(rows)
+	if err != nil {
+		logError(ctx, "getPockets Scan", err)
+	}
+
+	return
+}
+
+// getPocket -> a pocket of the wallet by id, or its main pocket for "main"
+func getPocket(ctx context.Context, db *sql.DB, walletID, pocketID string) (pocket Pocket, err error) {
+	defer observeQuery("getPocket", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPocket")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPocketSQL, walletID, pocketID)
+	if err != nil {
+		logError(ctx, "getPocket QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	pockets, err := scanPockets(rows)
+	if err != nil {
+		logError(ctx, "getPocket Scan", err)
+		return
+	}
+
+	if len(pockets) == 0 {
+		err = sql.ErrNoRows
+		return
+	}
+	pocket = pockets[0]
+
+	return
+}
+
+// changePocketBalance -> add entry.SignedAmount to the pocket of entry in tx and record
+// the entry with the balance it left. Money only leaves a pocket that holds enough,
+// errInsufficientFunds otherwise, and errPocketNotFound when the pocket was deleted since it
+// was looked up.
+func changePocketBalance(ctx context.Context, tx *sql.Tx, entry *PocketEntry) (err error) {
+	query := addPocketBalanceSQL
+	if entry.SignedAmount() < 0 {
+		query = takePocketBalanceSQL
+	}
+
+	result, err := tx.ExecContext(ctx, query, entry.Amount, entry.PocketID)
+	if err != nil {
+		logError(ctx, "changePocketBalance ExecContext", err)
+		return
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		logError(ctx, "changePocketBalance RowsAffected", err)
+		return
+	}
+	if changed == 0 {
+		err = errInsufficientFunds
+		// a credit always matches a pocket that is still there
+		if entry.SignedAmount() >= 0 || tx.QueryRowContext(ctx, getPocketBalanceSQL, entry.PocketID).Scan(&entry.Balance) == sql.ErrNoRows {
+			err = errPocketNotFound
+		}
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, getPocketBalanceSQL, entry.PocketID).Scan(&entry.Balance)
+	if err != nil {
+		logError(ctx, "changePocketBalance Scan", err)
+		return
+	}
+
+	entry.ID = generateUUID()
+	_, err = tx.ExecContext(ctx,
+		insertPocketEntrySQL,
+		entry.ID,
+		entry.PocketID,
+		entry.Kind,
+		entry.Amount,
+		entry.Balance,
+		entry.TransactionID,
+		entry.MoveID,
+		entry.OtherPocketID,
+		entry.ReferenceID,
+		entry.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "changePocketBalance insert entry", err)
+	}
+
+	return
+}
+
+// applyPocketTransaction -> the pocket side of a wallet transaction, in the main pocket
+// when pocketID is empty
+func applyPocketTransaction(ctx context.Context, tx *sql.Tx, pocketID string, transaction WalletTransaction) (entry PocketEntry, err error) {
+	if pocketID == "" {
+		err = tx.QueryRowContext(ctx, getMainPocketIDSQL, transaction.WalletID).Scan(&pocketID)
+		if err != nil {
+			logError(ctx, "applyPocketTransaction main pocket", err)
+			return
+		}
+	}
+
+	// entries of wallet transactions are named like them
+	entry = PocketEntry{
+		PocketID:      pocketID,
+		Kind:          transaction.TypeName(),
+		Amount:        transaction.Amount,
+		TransactionID: transaction.ID,
+		ReferenceID:   transaction.ReferenceID,
+		CreateTime:    transaction.CreateTime,
+	}
+
+	err = changePocketBalance(ctx, tx, &entry)
+	return
+}
+
+// movePocketBalance -> move amount between two pockets of a wallet, the total is unchanged
+func movePocketBalance(ctx context.Context, db *sql.DB, fromID, toID string, amount int) (out, in PocketEntry, err error) {
+	defer observeQuery("movePocketBalance", time.Now())
+	ctx, span := startQuerySpan(ctx, "movePocketBalance")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "movePocketBalance BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	out, in, err = movePocketBalanceTx(ctx, tx, fromID, toID, amount, "")
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "movePocketBalance Commit", err)
+	}
+
+	return
+}
+
+// movePocketBalanceTx -> both entries of a move in tx, transactionID is set when a wallet
+// transaction caused the move
+func movePocketBalanceTx(ctx context.Context, tx *sql.Tx, fromID, toID string, amount int, transactionID string) (out, in PocketEntry, err error) {
+	moveID := generateUUID()
+	now := time.Now()
+
+	out = PocketEntry{PocketID: fromID, Kind: pocketEntryMoveOut, Amount: amount, TransactionID: transactionID, MoveID: moveID, OtherPocketID: toID, CreateTime: now}
+	err = changePocketBalance(ctx, tx, &out)
+	if err != nil {
+		return
+	}
+
+	in = PocketEntry{PocketID: toID, Kind: pocketEntryMoveIn, Amount: amount, TransactionID: transactionID, MoveID: moveID, OtherPocketID: fromID, CreateTime: now}
+	err = changePocketBalance(ctx, tx, &in)
+	return
+}
+
+// deletePocket -> move what is left in the pocket to mainID and delete it, its entries stay
+func deletePocket(ctx context.Context, db *sql.DB, pocket Pocket, mainID string) (err error) {
+	defer observeQuery("deletePocket", time.Now())
+	ctx, span := startQuerySpan(ctx, "deletePocket")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "deletePocket BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = deletePocketTx(ctx, tx, pocket, mainID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "deletePocket Commit", err)
+	}
+
+	return
+}
+
+func deletePocketTx(ctx context.Context, tx *sql.Tx, pocket Pocket, mainID string) (err error) {
+	if pocket.Balance > 0 {
+		_, _, err = movePocketBalanceTx(ctx, tx, pocket.ID, mainID, pocket.Balance, "")
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, deletePocketSQL, pocket.ID)
+	if err != nil {
+		logError(ctx, "deletePocket ExecContext", err)
+	}
+
+	return
+}
+
+func getPocketEntries(ctx context.Context, db *sql.DB, pocketID string, limit int) (entries []PocketEntry, err error) {
+	defer observeQuery("getPocketEntries", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPocketEntries")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPocketEntriesSQL, pocketID, limit)
+	if err != nil {
+		logError(ctx, "getPocketEntries QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry PocketEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.PocketID,
+			&entry.Kind,
+			&entry.Amount,
+			&entry.Balance,
+			&entry.TransactionID,
+			&entry.MoveID,
+			&entry.OtherPocketID,
+			&entry.ReferenceID,
+			&entry.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "getPocketEntries Scan", err)
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// pocketOf -> a pocket of the enabled wallet, errPocketNotFound when it has no such pocket
+func pocketOf(ctx context.Context, wallet Wallet, pocketID string) (pocket Pocket, err error) {
+	if pocketID == "" {
+		pocketID = mainPocketAlias
+	}
+
+	pocket, err = getPocket(ctx, database, wallet.ID, pocketID)
+	if err == sql.ErrNoRows {
+		err = errPocketNotFound
+	}
+
+	return
+}
+
+// ListPockets -> the pockets of the enabled wallet, main first
+func ListPockets(ctx context.Context, userID string) (wallet Wallet, pockets []Pocket, err error) {
+	ctx = withOperation(ctx, "list_pockets")
+	ctx, span := startSpan(ctx, "ListPockets", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err = viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	pockets, err = getPockets(ctx, database, wallet.ID)
+	return
+}
+
+// CreatePocket -> a new empty pocket, names are unique per wallet ignoring case
+func CreatePocket(ctx context.Context, userID, name string) (pocket Pocket, err error) {
+	ctx = withOperation(ctx, "create_pocket")
+	ctx, span := startSpan(ctx, "CreatePocket", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, pockets, err := ListPockets(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	err = checkNewPocket(pockets, name)
+	if err != nil {
+		return
+	}
+
+	pocket = Pocket{
+		ID:         generateUUID(),
+		WalletID:   wallet.ID,
+		Name:       name,
+		CreateTime: time.Now(),
+	}
+
+	err = insertPocket(ctx, database, pocket)
+	return
+}
+
+// checkNewPocket -> whether a pocket named name can be added next to pockets
+func checkNewPocket(pockets []Pocket, name string) error {
+	if len(pockets) >= maxPockets {
+		return errTooManyPockets
+	}
+
+	for _, other := range pockets {
+		if strings.EqualFold(other.Name, name) {
+			return errPocketExists
+		}
+	}
+
+	return nil
+}
+
+// DeletePocket -> delete a pocket, what is left in it goes back to the main pocket
+func DeletePocket(ctx context.Context, userID, pocketID string) (pocket Pocket, err error) {
+	ctx = withOperation(ctx, "delete_pocket")
+	ctx, span := startSpan(ctx, "DeletePocket", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	pocket, err = pocketOf(ctx, wallet, pocketID)
+	if err != nil {
+		return
+	}
+
+	if pocket.Main {
+		err = errMainPocket
+		return
+	}
+
+	goal, err := getGoalByPocketID(ctx, database, pocket.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = nil
+
+	if goal.ID != "" {
+		err = errGoalPocket
+		return
+	}
+
+	main, err := pocketOf(ctx, wallet, mainPocketAlias)
+	if err != nil {
+		return
+	}
+
+	err = deletePocket(ctx, database, pocket, main.ID)
+	return
+}
+
+// MovePocketMoney -> move amount between two pockets of the enabled wallet
+func MovePocketMoney(ctx context.Context, userID, fromID, toID string, amount int) (from, to Pocket, err error) {
+	ctx = withOperation(ctx, "move_pocket_money")
+	ctx, span := startSpan(ctx, "MovePocketMoney", spanKindInternal)
+	span.setAttribute("amount", amount)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	from, err = pocketOf(ctx, wallet, fromID)
+	if err != nil {
+		return
+	}
+
+	to, err = pocketOf(ctx, wallet, toID)
+	if err != nil {
+		return
+	}
+
+	if from.ID == to.ID {
+		err = errSamePocket
+		return
+	}
+
+	if amount > from.Balance {
+		err = errInsufficientFunds
+		return
+	}
+
+	out, in, err := movePocketBalance(ctx, database, from.ID, to.ID, amount)
+	if err != nil {
+		return
+	}
+	from.Balance = out.Balance
+	to.Balance = in.Balance
+
+	return
+}
+
+// ListPocketTransactions -> latest entries of a pocket, newest first
+func ListPocketTransactions(ctx context.Context, userID, pocketID string, limit int) (pocket Pocket, entries []PocketEntry, err error) {
+	ctx = withOperation(ctx, "list_pocket_transactions")
+	ctx, span := startSpan(ctx, "ListPocketTransactions", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	pocket, err = pocketOf(ctx, wallet, pocketID)
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	entries, err = getPocketEntries(ctx, database, pocket.ID, limit)
+	return
+}
+
+// HandleListPockets -> View the pockets of my wallet
+func HandleListPockets(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	_, pockets, err := ListPockets(r.Context(), userIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePockets{Pockets: pocketsResponse(pockets)}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleCreatePocket -> Add a named pocket to my wallet
+func HandleCreatePocket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestPocket
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxPocketNameSize || strings.EqualFold(name, mainPocketAlias) {
+		writeValidationError(w, r, &response, validationErrors{"name": {"Must be 1 to 50 characters and not main."}})
+		return
+	}
+
+	pocket, err := CreatePocket(r.Context(), userIDFromContext(r.Context()), name)
+	if err == errPocketExists || err == errTooManyPockets {
+		writeValidationError(w, r, &response, validationErrors{"name": {err.Error() + "."}})
+		return
+	}
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePocket{Pocket: pocketResponse(pocket)}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleDeletePocket -> Delete a pocket, its balance goes back to the main pocket
+func HandleDeletePocket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	pocket, err := DeletePocket(r.Context(), userIDFromContext(r.Context()), ps.ByName("pocket_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePocket{Pocket: pocketResponse(pocket)}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleMovePocketMoney -> Move money between two pockets of my wallet
+func HandleMovePocketMoney(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestPocketMove
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	from, to, err := MovePocketMoney(r.Context(), userIDFromContext(r.Context()), req.FromPocketID, req.ToPocketID, req.Amount)
+	if err == errSamePocket {
+		writeValidationError(w, r, &response, validationErrors{"to_pocket_id": {errSamePocket.Message + "."}})
+		return
+	}
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePocketMove{
+		Amount: req.Amount,
+		From:   pocketResponse(from),
+		To:     pocketResponse(to),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListPocketTransactions -> View the latest changes of one pocket
+func HandleListPocketTransactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListTransactions
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	pocket, entries, err := ListPocketTransactions(r.Context(), userIDFromContext(r.Context()), ps.ByName("pocket_id"), req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponsePocketTransactions{
+		Pocket:       pocketResponse(pocket),
+		Transactions: []ResponsePocketTransaction{},
+	}
+	for _, entry := range entries {
+		data.Transactions = append(data.Transactions, ResponsePocketTransaction{
+			ID:            entry.ID,
+			Type:          entry.Kind,
+			Amount:        entry.SignedAmount(),
+			Balance:       entry.Balance,
+			TransactionID: entry.TransactionID,
+			OtherPocketID: entry.OtherPocketID,
+			ReferenceID:   entry.ReferenceID,
+			CreatedAt:     entry.CreateTime,
+		})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+func pocketResponse(pocket Pocket) ResponsePocketDetail {
+	return ResponsePocketDetail{
+		ID:        pocket.ID,
+		Name:      pocket.Name,
+		Main:      pocket.Main,
+		Balance:   pocket.Balance,
+		CreatedAt: pocket.CreateTime,
+	}
+}
+
+func pocketsResponse(pockets []Pocket) []ResponsePocketDetail {
+	details := []ResponsePocketDetail{}
+	for _, pocket := range pockets {
+		details = append(details, pocketResponse(pocket))
+	}
+
+	return details
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestDepositToDeletedPocket -> a deposit or a move into a pocket deleted before it, or while
+// it runs, fails with errPocketNotFound and leaves the wallet as it was
+func TestDepositToDeletedPocket(t *testing.T) {
+	ctx := context.Background()
+	userID := fundedWallet(t, 1000)
+
+	pocket, err := CreatePocket(ctx, userID, "gone")
+	if err != nil {
+		t.Fatalf("CreatePocket: %v", err)
+	}
+	_, err = DeletePocket(ctx, userID, pocket.ID)
+	if err != nil {
+		t.Fatalf("DeletePocket: %v", err)
+	}
+
+	_, err = DepositToPocket(ctx, userID, pocket.ID, userID+"-deposit", 100)
+	if err != errPocketNotFound {
+		t.Errorf("DepositToPocket: %v, want %v", err, errPocketNotFound)
+	}
+
+	wallet, pockets, _, err := ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+
+	// deleted between the lookup and the update
+	_, err = updateBalance(ctx, database, wallet.ID, pocket.ID, userID+"-racing-deposit", 100, depositType)
+	if err != errPocketNotFound {
+		t.Errorf("updateBalance: %v, want %v", err, errPocketNotFound)
+	}
+
+	_, _, err = movePocketBalance(ctx, database, pockets[0].ID, pocket.ID, 100)
+	if err != errPocketNotFound {
+		t.Errorf("movePocketBalance: %v, want %v", err, errPocketNotFound)
+	}
+
+	wallet, pockets, _, err = ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+	if wallet.Balance != 1000 || len(pockets) != 1 || pockets[0].Balance != 1000 {
+		t.Errorf("balance %d, pockets %+v, want 1000 in the main pocket only", wallet.Balance, pockets)
+	}
+}
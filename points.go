@@ -0,0 +1,1315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Points are a ledger next to the balance. Withdrawals earn them by the rule of their merchant
+// category, or the default rule, into a lot that expires after the expiry of the program.
+// Lots are used oldest expiry first, by redemptions into cashback transactions, by the expiry
+// sweep and by reversals of the withdrawal that earned them. Every change is an entry with
+// the points balance after it, written in the same tx as the money it belongs to.
+
+const (
+	// pointsRuleDefault -> the rule of withdrawals whose category has no rule of its own
+	pointsRuleDefault = "default"
+
+	defaultPointsExpiryDays = 365
+	defaultPointValue       = 1
+	maxPointsExpiryDays     = 3650
+
+	// pointsMultiplierBase -> multiplier_pct of a rule that earns the plain rate
+	pointsMultiplierBase = 100
+
+	pointsEntryEarn    = "earn"
+	pointsEntryRedeem  = "redeem"
+	pointsEntryExpire  = "expire"
+	pointsEntryReverse = "reverse"
+
+	pointsReferencePrefix = "points:"
+
+	// pointsExpiryPoll -> how often expired lots are swept
+	pointsExpiryPoll = time.Hour
+)
+
+// merchantCategoryPattern -> lower case like "groceries" or "travel_air"
+var merchantCategoryPattern = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+const msgMerchantCategory = "Must be 1 to 50 lower case letters, digits or underscores."
+
+// PointsProgram -> how long points last and what a point is worth on redemption
+type PointsProgram struct {
+	ExpiryDays int       `db:"expiry_days"`
+	PointValue int       `db:"point_value"`
+	UpdateTime time.Time `db:"update_time"`
+}
+
+// PointsRule -> a withdrawal earns MultiplierPct percent of one point per SpendPerPoint spent
+type PointsRule struct {
+	Category      string    `db:"category"`
+	SpendPerPoint int       `db:"spend_per_point"`
+	MultiplierPct int       `db:"multiplier_pct"`
+	UpdateTime    time.Time `db:"update_time"`
+}
+
+// Points -> whole points a withdrawal of amount earns, rounded down
+func (r PointsRule) Points(amount int) int {
+	return amount * r.MultiplierPct / (r.SpendPerPoint * pointsMultiplierBase)
+}
+
+// PointsLot -> points earned by one withdrawal, Remaining of them are left to use
+type PointsLot struct {
+	ID            string    `db:"id"`
+	WalletID      string    `db:"wallet_id"`
+	TransactionID string    `db:"transaction_id"`
+	Category      string    `db:"category"`
+	Points        int       `db:"points"`
+	Remaining     int       `db:"remaining"`
+	ExpireTime    time.Time `db:"expire_time"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// PointsEntry -> a change of the points of a wallet, Points is negative when they were used
+type PointsEntry struct {
+	ID            string    `db:"id"`
+	WalletID      string    `db:"wallet_id"`
+	Kind          string    `db:"kind"`
+	Points        int       `db:"points"`
+	Balance       int       `db:"balance"`
+	LotID         string    `db:"lot_id"`
+	TransactionID string    `db:"transaction_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+// PointsBalance -> the points of a wallet and the ones that expire first
+type PointsBalance struct {
+	Balance      int
+	Value        int
+	NextExpiring int
+	NextExpiry   time.Time
+}
+
+// PointsRedemption -> points turned into a cashback transaction
+type PointsRedemption struct {
+	Points      int
+	Balance     int
+	Transaction WalletTransaction
+}
+
+const (
+	createPointsProgramTable = `
+		CREATE TABLE IF NOT EXISTS points_program (
+			id INTEGER NOT NULL PRIMARY KEY,
+			expiry_days INTEGER NOT NULL,
+			point_value INTEGER NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createPointsRuleTable = `
+		CREATE TABLE IF NOT EXISTS points_rule (
+			category TEXT NOT NULL PRIMARY KEY,
+			spend_per_point INTEGER NOT NULL,
+			multiplier_pct INTEGER NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createPointsLotTable = `
+		CREATE TABLE IF NOT EXISTS points_lot (
+			id TEXT NOT NULL PRIMARY KEY,
+			wallet_id TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			category TEXT NOT NULL,
+			points INTEGER NOT NULL,
+			remaining INTEGER NOT NULL,
+			expire_time DATETIME NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	createPointsEntryTable = `
+		CREATE TABLE IF NOT EXISTS points_entry (
+			id TEXT NOT NULL PRIMARY KEY,
+			wallet_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			points INTEGER NOT NULL,
+			balance INTEGER NOT NULL,
+			lot_id TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	// the program is one row, id 1
+	upsertPointsProgramSQL = `
+		INSERT INTO points_program
+			(id, expiry_days, point_value, update_time)
+		VALUES
+			(1,?,?,?)
+		ON CONFLICT (id) DO UPDATE SET
+			expiry_days = excluded.expiry_days,
+			point_value = excluded.point_value,
+			update_time = excluded.update_time
+		;
+	`
+
+	getPointsProgramSQL = `
+		SELECT
+			expiry_days,
+			point_value,
+			update_time
+		FROM
+			points_program
+		WHERE
+			id = 1
+	`
+
+	upsertPointsRuleSQL = `
+		INSERT INTO points_rule
+			(category, spend_per_point, multiplier_pct, update_time)
+		VALUES
+			(?,?,?,?)
+		ON CONFLICT (category) DO UPDATE SET
+			spend_per_point = excluded.spend_per_point,
+			multiplier_pct = excluded.multiplier_pct,
+			update_time = excluded.update_time
+		;
+	`
+
+	deletePointsRuleSQL = `
+		DELETE FROM
+			points_rule
+		WHERE
+			category = $1
+	`
+
+	getPointsRulesSQL = `
+		SELECT
+			category,
+			spend_per_point,
+			multiplier_pct,
+			update_time
+		FROM
+			points_rule
+		ORDER BY
+			category
+	`
+
+	getPointsRuleSQL = `
+		SELECT
+			category,
+			spend_per_point,
+			multiplier_pct,
+			update_time
+		FROM
+			points_rule
+		WHERE
+			category = $1
+	`
+
+	// getPointsRuleForSQL -> the rule of the category, else the default one
+	getPointsRuleForSQL = `
+		SELECT
+			category,
+			spend_per_point,
+			multiplier_pct,
+			update_time
+		FROM
+			points_rule
+		WHERE
+			category IN ($1, '` + pointsRuleDefault + `')
+		ORDER BY
+			category = '` + pointsRuleDefault + `'
+		LIMIT 1
+	`
+
+	insertPointsLotSQL = `
+		INSERT INTO points_lot
+			(id, wallet_id, transaction_id, category, points, remaining, expire_time, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	selectPointsLotSQL = `
+		SELECT
+			id,
+			wallet_id,
+			transaction_id,
+			category,
+			points,
+			remaining,
+			expire_time,
+			create_time
+		FROM
+			points_lot
+	`
+
+	// getPointsLotsToUseSQL -> lots with points left, oldest expiry first
+	getPointsLotsToUseSQL = selectPointsLotSQL + `
+		WHERE
+			wallet_id = $1 AND
+			remaining > 0
+		ORDER BY
+			julianday(expire_time),
+			julianday(create_time),
+			rowid
+	`
+
+	getExpiredPointsLotsSQL = selectPointsLotSQL + `
+		WHERE
+			wallet_id = $1 AND
+			remaining > 0 AND
+			julianday(expire_time) <= julianday($2)
+		ORDER BY
+			julianday(expire_time),
+			rowid
+	`
+
+	getPointsLotByTransactionSQL = selectPointsLotSQL + `
+		WHERE
+			transaction_id = $1
+	`
+
+	getWalletsWithExpiredPointsSQL = `
+		SELECT DISTINCT
+			wallet_id
+		FROM
+			points_lot
+		WHERE
+			remaining > 0 AND
+			julianday(expire_time) <= julianday($1)
+	`
+
+	usePointsLotSQL = `
+		UPDATE
+			points_lot
+		SET
+			remaining = remaining - $1
+		WHERE
+			id = $2
+	`
+
+	getPointsBalanceSQL = `
+		SELECT
+			COALESCE(SUM(remaining), 0)
+		FROM
+			points_lot
+		WHERE
+			wallet_id = $1
+	`
+
+	// getLivePointsLotsSQL -> lots not expired at $2, whether or not they were swept yet
+	getLivePointsLotsSQL = selectPointsLotSQL + `
+		WHERE
+			wallet_id = $1 AND
+			remaining > 0 AND
+			julianday(expire_time) > julianday($2)
+		ORDER BY
+			julianday(expire_time),
+			rowid
+	`
+
+	getExpiredLotPointsSQL = `
+		SELECT
+			COALESCE(SUM(-points), 0)
+		FROM
+			points_entry
+		WHERE
+			lot_id = $1 AND
+			kind = '` + pointsEntryExpire + `'
+	`
+
+	insertPointsEntrySQL = `
+		INSERT INTO points_entry
+			(id, wallet_id, kind, points, balance, lot_id, transaction_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getPointsEntriesSQL = `
+		SELECT
+			id,
+			wallet_id,
+			kind,
+			points,
+			balance,
+			lot_id,
+			transaction_id,
+			create_time
+		FROM
+			points_entry
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $2
+	`
+)
+
+func getPointsProgram(ctx context.Context, db *sql.DB) (program PointsProgram, err error) {
+	defer observeQuery("getPointsProgram", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPointsProgram")
+	defer func() {
+		span.end(err)
+	}()
+
+	program, err = scanPointsProgram(db.QueryRowContext(ctx, getPointsProgramSQL))
+	if err != nil {
+		logError(ctx, "getPointsProgram Scan", err)
+	}
+
+	return
+}
+
+// scanPointsProgram -> the program, or the defaults until an admin sets one
+func scanPointsProgram(row *sql.Row) (program PointsProgram, err error) {
+	err = row.Scan(&program.ExpiryDays, &program.PointValue, &program.UpdateTime)
+	if err == sql.ErrNoRows {
+		return PointsProgram{ExpiryDays: defaultPointsExpiryDays, PointValue: defaultPointValue}, nil
+	}
+
+	return
+}
+
+func upsertPointsProgram(ctx context.Context, db *sql.DB, program PointsProgram) (err error) {
+	defer observeQuery("upsertPointsProgram", time.Now())
+	ctx, span := startQuerySpan(ctx, "upsertPointsProgram")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, upsertPointsProgramSQL, program.ExpiryDays, program.PointValue, program.UpdateTime)
+	if err != nil {
+		logError(ctx, "upsertPointsProgram ExecContext", err)
+	}
+
+	return
+}
+
+func upsertPointsRule(ctx context.Context, db *sql.DB, rule PointsRule) (err error) {
+	defer observeQuery("upsertPointsRule", time.Now())
+	ctx, span := startQuerySpan(ctx, "upsertPointsRule")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, upsertPointsRuleSQL, rule.Category, rule.SpendPerPoint, rule.MultiplierPct, rule.UpdateTime)
+	if err != nil {
+		logError(ctx, "upsertPointsRule ExecContext", err)
+	}
+
+	return
+}
+
+func deletePointsRule(ctx context.Context, db *sql.DB, category string) (deleted bool, err error) {
+	defer observeQuery("deletePointsRule", time.Now())
+	ctx, span := startQuerySpan(ctx, "deletePointsRule")
+	defer func() {
+		span.end(err)
+	}()
+
+	result, err := db.ExecContext(ctx, deletePointsRuleSQL, category)
+	if err != nil {
+		logError(ctx, "deletePointsRule ExecContext", err)
+		return
+	}
+
+	changed, _ := result.RowsAffected()
+	deleted = changed > 0
+	return
+}
+
+func scanPointsRule(scanner interface{ Scan(...interface{}) error }) (rule PointsRule, err error) {
+	err = scanner.Scan(&rule.Category, &rule.SpendPerPoint, &rule.MultiplierPct, &rule.UpdateTime)
+	return
+}
+
+func getPointsRules(ctx context.Context, db *sql.DB) (rules []PointsRule, err error) {
+	defer observeQuery("getPointsRules", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPointsRules")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPointsRulesSQL)
+	if err != nil {
+		logError(ctx, "getPointsRules QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule PointsRule
+		rule, err = scanPointsRule(rows)
+		if err != nil {
+			logError(ctx, "getPointsRules Scan", err)
+			return
+		}
+
+		rules = append(rules, rule)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getPointsRule(ctx context.Context, db *sql.DB, category string) (rule PointsRule, err error) {
+	defer observeQuery("getPointsRule", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPointsRule")
+	defer func() {
+		span.end(err)
+	}()
+
+	rule, err = scanPointsRule(db.QueryRowContext(ctx, getPointsRuleSQL, category))
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getPointsRule Scan", err)
+	}
+
+	return
+}
+
+func scanPointsLot(scanner interface{ Scan(...interface{}) error }) (lot PointsLot, err error) {
+	err = scanner.Scan(
+		&lot.ID,
+		&lot.WalletID,
+		&lot.TransactionID,
+		&lot.Category,
+		&lot.Points,
+		&lot.Remaining,
+		&lot.ExpireTime,
+		&lot.CreateTime,
+	)
+
+	return
+}
+
+// queryPointsLots -> the lots of query in tx, read in full before any of them is changed
+func queryPointsLots(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (lots []PointsLot, err error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logError(ctx, "queryPointsLots QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var lot PointsLot
+		lot, err = scanPointsLot(rows)
+		if err != nil {
+			logError(ctx, "queryPointsLots Scan", err)
+			return
+		}
+
+		lots = append(lots, lot)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// insertPointsEntry -> record entry in tx with the points balance of its wallet after it
+func insertPointsEntry(ctx context.Context, tx *sql.Tx, entry *PointsEntry) (err error) {
+	err = tx.QueryRowContext(ctx, getPointsBalanceSQL, entry.WalletID).Scan(&entry.Balance)
+	if err != nil {
+		logError(ctx, "insertPointsEntry balance", err)
+		return
+	}
+
+	entry.ID = generateUUID()
+	_, err = tx.ExecContext(ctx,
+		insertPointsEntrySQL,
+		entry.ID,
+		entry.WalletID,
+		entry.Kind,
+		entry.Points,
+		entry.Balance,
+		entry.LotID,
+		entry.TransactionID,
+		entry.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertPointsEntry ExecContext", err)
+	}
+
+	return
+}
+
+// takePointsLot -> take points from lot in tx and record it as an entry of kind
+func takePointsLot(ctx context.Context, tx *sql.Tx, lot PointsLot, points int, kind, transactionID string, now time.Time) (err error) {
+	_, err = tx.ExecContext(ctx, usePointsLotSQL, points, lot.ID)
+	if err != nil {
+		logError(ctx, "takePointsLot ExecContext", err)
+		return
+	}
+
+	return insertPointsEntry(ctx, tx, &PointsEntry{
+		WalletID:      lot.WalletID,
+		Kind:          kind,
+		Points:        -points,
+		LotID:         lot.ID,
+		TransactionID: transactionID,
+		CreateTime:    now,
+	})
+}
+
+// sweepExpiredPoints -> expire what is left of the lots of the wallet that expired by now,
+// in tx, so the points used after it in the same tx are all live
+func sweepExpiredPoints(ctx context.Context, tx *sql.Tx, walletID string, now time.Time) (expired int, err error) {
+	lots, err := queryPointsLots(ctx, tx, getExpiredPointsLotsSQL, walletID, now)
+	if err != nil {
+		return
+	}
+
+	for _, lot := range lots {
+		err = takePointsLot(ctx, tx, lot, lot.Remaining, pointsEntryExpire, "", now)
+		if err != nil {
+			return
+		}
+		expired += lot.Remaining
+	}
+
+	return
+}
+
+// usePoints -> take up to points from the live lots of the wallet in tx, oldest expiry
+// first, one entry of kind per lot. taken is less than points when the wallet has fewer.
+func usePoints(ctx context.Context, tx *sql.Tx, walletID string, points int, kind, transactionID string, now time.Time) (taken int, err error) {
+	_, err = sweepExpiredPoints(ctx, tx, walletID, now)
+	if err != nil {
+		return
+	}
+
+	lots, err := queryPointsLots(ctx, tx, getPointsLotsToUseSQL, walletID)
+	if err != nil {
+		return
+	}
+
+	for _, lot := range lots {
+		if taken == points {
+			break
+		}
+
+		take := min(lot.Remaining, points-taken)
+		err = takePointsLot(ctx, tx, lot, take, kind, transactionID, now)
+		if err != nil {
+			return
+		}
+		taken += take
+	}
+
+	return
+}
+
+// earnPoints -> the lot a withdrawal earns by the rule of category, in the tx of the
+// withdrawal. Nothing is earned without a rule or when the amount earns less than a point.
+func earnPoints(ctx context.Context, tx *sql.Tx, transaction WalletTransaction, category string) (lot PointsLot, err error) {
+	rule, err := scanPointsRule(tx.QueryRowContext(ctx, getPointsRuleForSQL, category))
+	if err == sql.ErrNoRows {
+		return lot, nil
+	}
+	if err != nil {
+		logError(ctx, "earnPoints rule", err)
+		return
+	}
+
+	program, err := scanPointsProgram(tx.QueryRowContext(ctx, getPointsProgramSQL))
+	if err != nil {
+		logError(ctx, "earnPoints program", err)
+		return
+	}
+
+	points := rule.Points(transaction.Amount)
+	if points <= 0 {
+		return
+	}
+
+	lot = PointsLot{
+		ID:            generateUUID(),
+		WalletID:      transaction.WalletID,
+		TransactionID: transaction.ID,
+		Category:      rule.Category,
+		Points:        points,
+		Remaining:     points,
+		ExpireTime:    transaction.CreateTime.AddDate(0, 0, program.ExpiryDays),
+		CreateTime:    transaction.CreateTime,
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertPointsLotSQL,
+		lot.ID,
+		lot.WalletID,
+		lot.TransactionID,
+		lot.Category,
+		lot.Points,
+		lot.Remaining,
+		lot.ExpireTime,
+		lot.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "earnPoints insert lot", err)
+		return
+	}
+
+	err = insertPointsEntry(ctx, tx, &PointsEntry{
+		WalletID:      lot.WalletID,
+		Kind:          pointsEntryEarn,
+		Points:        points,
+		LotID:         lot.ID,
+		TransactionID: transaction.ID,
+		CreateTime:    lot.CreateTime,
+	})
+	return
+}
+
+// reversePoints -> take back in tx the points the transaction earned and did not expire.
+// What is left of its lot goes first, points of it already redeemed come out of the other
+// lots, oldest expiry first, as far as the wallet has any.
+func reversePoints(ctx context.Context, tx *sql.Tx, transactionID string, now time.Time) (reversed int, err error) {
+	lots, err := queryPointsLots(ctx, tx, getPointsLotByTransactionSQL, transactionID)
+	if err != nil || len(lots) == 0 {
+		return
+	}
+	lot := lots[0]
+
+	_, err = sweepExpiredPoints(ctx, tx, lot.WalletID, now)
+	if err != nil {
+		return
+	}
+
+	var expired int
+	err = tx.QueryRowContext(ctx, getExpiredLotPointsSQL, lot.ID).Scan(&expired)
+	if err != nil {
+		logError(ctx, "reversePoints expired", err)
+		return
+	}
+
+	// read again, the sweep may have expired the rest of it
+	lots, err = queryPointsLots(ctx, tx, getPointsLotByTransactionSQL, transactionID)
+	if err != nil {
+		return
+	}
+	lot = lots[0]
+
+	owed := lot.Points - expired
+	if lot.Remaining > 0 {
+		err = takePointsLot(ctx, tx, lot, lot.Remaining, pointsEntryReverse, transactionID, now)
+		if err != nil {
+			return
+		}
+		reversed = lot.Remaining
+	}
+
+	taken, err := usePoints(ctx, tx, lot.WalletID, owed-reversed, pointsEntryReverse, transactionID, now)
+	reversed += taken
+	return
+}
+
+// redeemPoints -> credit points at value each to the main pocket as a cashback transaction
+// and use the points for it, in one tx
+func redeemPoints(ctx context.Context, db *sql.DB, walletID string, points, value int, now time.Time) (redemption PointsRedemption, err error) {
+	defer observeQuery("redeemPoints", time.Now())
+	ctx, span := startQuerySpan(ctx, "redeemPoints")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "redeemPoints BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = sweepExpiredPoints(ctx, tx, walletID, now)
+	if err != nil {
+		return
+	}
+
+	var available int
+	err = tx.QueryRowContext(ctx, getPointsBalanceSQL, walletID).Scan(&available)
+	if err != nil {
+		logError(ctx, "redeemPoints available", err)
+		return
+	}
+	if points > available {
+		err = errInsufficientPoints
+		return
+	}
+
+	amount := points * value
+	transaction, event, err := applyBalanceChange(ctx, tx, walletID, "", pointsReferencePrefix+generateUUID(), amount, cashbackType)
+	if err != nil {
+		return
+	}
+
+	redemption.Points, err = usePoints(ctx, tx, walletID, points, pointsEntryRedeem, transaction.ID, now)
+	if err != nil {
+		return
+	}
+	redemption.Balance = available - redemption.Points
+	redemption.Transaction = transaction
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "redeemPoints Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// expirePoints -> sweep the expired lots of one wallet in its own tx
+func expirePoints(ctx context.Context, db *sql.DB, walletID string, now time.Time) (expired int, err error) {
+	defer observeQuery("expirePoints", time.Now())
+	ctx, span := startQuerySpan(ctx, "expirePoints")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "expirePoints BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	expired, err = sweepExpiredPoints(ctx, tx, walletID, now)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "expirePoints Commit", err)
+	}
+
+	return
+}
+
+func getWalletsWithExpiredPoints(ctx context.Context, db *sql.DB, now time.Time) (walletIDs []string, err error) {
+	defer observeQuery("getWalletsWithExpiredPoints", time.Now())
+	ctx, span := startQuerySpan(ctx, "getWalletsWithExpiredPoints")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getWalletsWithExpiredPointsSQL, now)
+	if err != nil {
+		logError(ctx, "getWalletsWithExpiredPoints QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var walletID string
+		err = rows.Scan(&walletID)
+		if err != nil {
+			logError(ctx, "getWalletsWithExpiredPoints Scan", err)
+			return
+		}
+
+		walletIDs = append(walletIDs, walletID)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// getPointsBalance -> the live points of the wallet, and the ones that expire on the day
+// the first of them does
+func getPointsBalance(ctx context.Context, db *sql.DB, walletID string, now time.Time) (balance PointsBalance, err error) {
+	defer observeQuery("getPointsBalance", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPointsBalance")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getLivePointsLotsSQL, walletID, now)
+	if err != nil {
+		logError(ctx, "getPointsBalance QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var lot PointsLot
+		lot, err = scanPointsLot(rows)
+		if err != nil {
+			logError(ctx, "getPointsBalance Scan", err)
+			return
+		}
+
+		balance.Balance += lot.Remaining
+		if balance.NextExpiry.IsZero() {
+			balance.NextExpiry = lot.ExpireTime
+		}
+		if lot.ExpireTime.UTC().Format(feeDateLayout) == balance.NextExpiry.UTC().Format(feeDateLayout) {
+			balance.NextExpiring += lot.Remaining
+		}
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getPointsEntries(ctx context.Context, db *sql.DB, walletID string, limit int) (entries []PointsEntry, err error) {
+	defer observeQuery("getPointsEntries", time.Now())
+	ctx, span := startQuerySpan(ctx, "getPointsEntries")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getPointsEntriesSQL, walletID, limit)
+	if err != nil {
+		logError(ctx, "getPointsEntries QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry PointsEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.WalletID,
+			&entry.Kind,
+			&entry.Points,
+			&entry.Balance,
+			&entry.LotID,
+			&entry.TransactionID,
+			&entry.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "getPointsEntries Scan", err)
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// pointsExpiry -> sweeps the expired lots of every wallet every poll
+type pointsExpiry struct {
+	clock clock
+	poll  time.Duration
+}
+
+func newPointsExpiry(c clock) *pointsExpiry {
+	return &pointsExpiry{clock: c, poll: pointsExpiryPoll}
+}
+
+var walletPointsExpiry = newPointsExpiry(systemClock{})
+
+// run -> sweep now and then every poll, until ctx is done
+func (e *pointsExpiry) run(ctx context.Context) {
+	for {
+		e.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(e.poll):
+		}
+	}
+}
+
+// sweep -> expire the lots that expired by now, one wallet at a time
+func (e *pointsExpiry) sweep(ctx context.Context) {
+	ctx = withOperation(ctx, "points_expiry")
+	now := e.clock.Now()
+
+	walletIDs, err := getWalletsWithExpiredPoints(ctx, database, now)
+	if err != nil {
+		logError(ctx, "pointsExpiry getWalletsWithExpiredPoints", err)
+		return
+	}
+
+	for _, walletID := range walletIDs {
+		expired, err := expirePoints(ctx, database, walletID, now)
+		if err != nil {
+			logError(ctx, "pointsExpiry expirePoints", err)
+			continue
+		}
+
+		logInfo(ctx, "points expired", "wallet_id", walletID, "points", expired)
+	}
+}
+
+// ViewPoints -> the points of the enabled wallet, the program and the latest entries
+func ViewPoints(ctx context.Context, userID string, limit int) (balance PointsBalance, entries []PointsEntry, err error) {
+	ctx = withOperation(ctx, "view_points")
+	ctx, span := startSpan(ctx, "ViewPoints", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	program, err := getPointsProgram(ctx, database)
+	if err != nil {
+		return
+	}
+
+	balance, err = getPointsBalance(ctx, database, wallet.ID, time.Now())
+	if err != nil {
+		return
+	}
+	balance.Value = balance.Balance * program.PointValue
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	entries, err = getPointsEntries(ctx, database, wallet.ID, limit)
+	return
+}
+
+// RedeemPoints -> turn points of the enabled wallet into balance at the point value
+func RedeemPoints(ctx context.Context, userID string, points int) (redemption PointsRedemption, err error) {
+	ctx = withOperation(ctx, "redeem_points")
+	ctx, span := startSpan(ctx, "RedeemPoints", spanKindInternal)
+	span.setAttribute("points", points)
+	defer func() {
+		observeWalletResult("redeem_points", redemption.Transaction.Amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	program, err := getPointsProgram(ctx, database)
+	if err != nil {
+		return
+	}
+
+	return redeemPoints(ctx, database, wallet.ID, points, program.PointValue, time.Now())
+}
+
+// PointsSettings -> the program and every earn rule
+func PointsSettings(ctx context.Context) (program PointsProgram, rules []PointsRule, err error) {
+	ctx = withOperation(ctx, "points_settings")
+	ctx, span := startSpan(ctx, "PointsSettings", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	program, err = getPointsProgram(ctx, database)
+	if err != nil {
+		return
+	}
+
+	rules, err = getPointsRules(ctx, database)
+	return
+}
+
+// SetPointsProgram -> points earned from now on expire after the new expiry, lots already
+// earned keep theirs
+func SetPointsProgram(ctx context.Context, program PointsProgram) (err error) {
+	ctx = withOperation(ctx, "set_points_program")
+	ctx, span := startSpan(ctx, "SetPointsProgram", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	return upsertPointsProgram(ctx, database, program)
+}
+
+// SetPointsRule -> add or replace the earn rule of a category
+func SetPointsRule(ctx context.Context, rule PointsRule) (err error) {
+	ctx = withOperation(ctx, "set_points_rule")
+	ctx, span := startSpan(ctx, "SetPointsRule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	return upsertPointsRule(ctx, database, rule)
+}
+
+// DeletePointsRule -> drop the earn rule of a category, its withdrawals earn by the default
+// rule again
+func DeletePointsRule(ctx context.Context, category string) (rule PointsRule, err error) {
+	ctx = withOperation(ctx, "delete_points_rule")
+	ctx, span := startSpan(ctx, "DeletePointsRule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	rule, err = getPointsRule(ctx, database, category)
+	if err == sql.ErrNoRows {
+		err = errPointsRuleNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	deleted, err := deletePointsRule(ctx, database, category)
+	if err == nil && !deleted {
+		err = errPointsRuleNotFound
+	}
+
+	return
+}
+
+// validMerchantCategory -> empty, or lower case letters, digits and underscores
+func validMerchantCategory(category string) bool {
+	return category == "" || merchantCategoryPattern.MatchString(category)
+}
+
+// HandleViewPoints -> My points, what they are worth, when the next ones expire and the
+// latest entries
+func HandleViewPoints(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListTransactions
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	balance, entries, err := ViewPoints(r.Context(), userIDFromContext(r.Context()), req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponsePoints{
+		Balance: balance.Balance,
+		Value:   balance.Value,
+		Entries: []ResponsePointsEntry{},
+	}
+	if balance.NextExpiring > 0 {
+		data.NextExpiring = &ResponsePointsExpiry{Points: balance.NextExpiring, ExpiresAt: balance.NextExpiry}
+	}
+	for _, entry := range entries {
+		data.Entries = append(data.Entries, ResponsePointsEntry{
+			ID:            entry.ID,
+			Kind:          entry.Kind,
+			Points:        entry.Points,
+			Balance:       entry.Balance,
+			TransactionID: entry.TransactionID,
+			CreatedAt:     entry.CreateTime,
+		})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleRedeemPoints -> Turn my points into balance
+func HandleRedeemPoints(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestRedeemPoints
+	if !bindRequest(w, r, &req, &response) {
+		observeWalletFailure("redeem_points", "invalid_input")
+		return
+	}
+
+	uID := userIDFromContext(r.Context())
+
+	redemption, err := RedeemPoints(r.Context(), uID, req.Points)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePointsRedemption{
+		Deposit: ResponseDepositDetail{
+			ID:          redemption.Transaction.ID,
+			DepositedBy: uID,
+			Status:      statusSuccess,
+			DepositedAt: redemption.Transaction.CreateTime,
+			Amount:      redemption.Transaction.Amount,
+			ReferenceID: redemption.Transaction.ReferenceID,
+		},
+		Type:          redemption.Transaction.TypeName(),
+		Points:        redemption.Points,
+		PointsBalance: redemption.Balance,
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandlePointsSettings -> Admin: the points program and the earn rules
+func HandlePointsSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	program, rules, err := PointsSettings(r.Context())
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponsePointsSettings{
+		Program: pointsProgramResponse(program),
+		Rules:   []ResponsePointsRule{},
+	}
+	for _, rule := range rules {
+		data.Rules = append(data.Rules, pointsRuleResponse(rule))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleSetPointsProgram -> Admin: set how long points last and what they are worth
+func HandleSetPointsProgram(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestPointsProgram
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	if req.ExpiryDays > maxPointsExpiryDays {
+		writeValidationError(w, r, &response, validationErrors{"expiry_days": {"Must be at most 3650."}})
+		return
+	}
+
+	program := PointsProgram{
+		ExpiryDays: req.ExpiryDays,
+		PointValue: req.PointValue,
+		UpdateTime: time.Now(),
+	}
+
+	err := SetPointsProgram(r.Context(), program)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePointsProgramSet{
+		Program: pointsProgramResponse(program),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleSetPointsRule -> Admin: add or replace the earn rule of a merchant category
+func HandleSetPointsRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestPointsRule
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	rule := PointsRule{
+		Category:      ps.ByName("category"),
+		SpendPerPoint: req.SpendPerPoint,
+		MultiplierPct: req.MultiplierPct,
+		UpdateTime:    time.Now(),
+	}
+	if rule.MultiplierPct == 0 {
+		rule.MultiplierPct = pointsMultiplierBase
+	}
+
+	if !merchantCategoryPattern.MatchString(rule.Category) {
+		writeValidationError(w, r, &response, validationErrors{"category": {msgMerchantCategory}})
+		return
+	}
+
+	err := SetPointsRule(r.Context(), rule)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePointsRuleSet{
+		Rule: pointsRuleResponse(rule),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleDeletePointsRule -> Admin: drop the earn rule of a merchant category
+func HandleDeletePointsRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	rule, err := DeletePointsRule(r.Context(), ps.ByName("category"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponsePointsRuleSet{
+		Rule: pointsRuleResponse(rule),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func pointsProgramResponse(program PointsProgram) ResponsePointsProgram {
+	data := ResponsePointsProgram{
+		ExpiryDays: program.ExpiryDays,
+		PointValue: program.PointValue,
+	}
+	if !program.UpdateTime.IsZero() {
+		data.UpdatedAt = &program.UpdateTime
+	}
+
+	return data
+}
+
+func pointsRuleResponse(rule PointsRule) ResponsePointsRule {
+	return ResponsePointsRule{
+		Category:      rule.Category,
+		SpendPerPoint: rule.SpendPerPoint,
+		MultiplierPct: rule.MultiplierPct,
+		UpdatedAt:     rule.UpdateTime,
+	}
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	rateLimitGroupInit        = "init"
+	rateLimitGroupAuth        = "auth"
+	rateLimitGroupWallet      = "wallet"
+	rateLimitGroupTransaction = "transaction"
+
+	// memory buckets are swept once the map grows past this size
+	maxMemoryBuckets = 10000
+)
+
+// rateLimitPolicy -> token bucket refilled at Rate tokens per second, holding at most Burst
+type rateLimitPolicy struct {
+	Rate  float64 `db:"rate"`
+	Burst int     `db:"burst"`
+}
+
+// defaultRateLimitPolicies -> /init and auth, taken in front of the session check, are keyed
+// by ip, every other group by user id
+var defaultRateLimitPolicies = map[string]rateLimitPolicy{
+	rateLimitGroupInit:        {Rate: 1, Burst: 5},
+	rateLimitGroupAuth:        {Rate: 20, Burst: 40},
+	rateLimitGroupWallet:      {Rate: 10, Burst: 20},
+	rateLimitGroupTransaction: {Rate: 2, Burst: 10},
+}
+
+type rateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type bucketState struct {
+	Tokens     float64
+	UpdateTime time.Time
+}
+
+// take -> refill the bucket up to now and spend one token if there is one
+func (b *bucketState) take(policy rateLimitPolicy, now time.Time) (result rateLimitResult) {
+	if b.UpdateTime.IsZero() {
+		b.Tokens = float64(policy.Burst)
+	} else if elapsed := now.Sub(b.UpdateTime).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(policy.Burst), b.Tokens+elapsed*policy.Rate)
+	}
+	b.UpdateTime = now
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else if policy.Rate > 0 {
+		result.RetryAfter = secondsToDuration((1 - b.Tokens) / policy.Rate)
+	} else {
+		result.RetryAfter = time.Hour
+	}
+
+	result.Remaining = int(math.Floor(b.Tokens))
+	if policy.Rate > 0 {
+		result.Reset = secondsToDuration((float64(policy.Burst) - b.Tokens) / policy.Rate)
+	}
+
+	return
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// bucketStore -> where token bucket state lives
+type bucketStore interface {
+	take(ctx context.Context, key string, policy rateLimitPolicy, now time.Time) (rateLimitResult, error)
+}
+
+type memoryBucketStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucketState
+}
+
+func newMemoryBucketStore() *memoryBucketStore {
+	return &memoryBucketStore{buckets: map[string]*bucketState{}}
+}
+
+func (m *memoryBucketStore) take(ctx context.Context, key string, policy rateLimitPolicy, now time.Time) (result rateLimitResult, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.buckets) > maxMemoryBuckets {
+		m.sweep(now)
+	}
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &bucketState{}
+		m.buckets[key] = bucket
+	}
+
+	result = bucket.take(policy, now)
+	return
+}
+
+// sweep -> drop buckets idle long enough that they would be full again anyway
+func (m *memoryBucketStore) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.UpdateTime) > time.Hour {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+type sqliteBucketStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteBucketStore) take(ctx context.Context, key string, policy rateLimitPolicy, now time.Time) (result rateLimitResult, err error) {
+	return takeRateLimitBucket(ctx, s.db, key, policy, now)
+}
+
+// rateLimiter -> bucket store plus per user policy overrides
+type rateLimiter struct {
+	store     bucketStore
+	mu        sync.RWMutex
+	overrides map[string]map[string]rateLimitPolicy
+}
+
+var limiter *rateLimiter
+
+// initRateLimit -> RATE_LIMIT_STORE selects "memory" (default) or "sqlite" bucket state
+func initRateLimit(ctx context.Context) {
+	limiter = &rateLimiter{
+		store:     newMemoryBucketStore(),
+		overrides: map[string]map[string]rateLimitPolicy{},
+	}
+
+	if os.Getenv("RATE_LIMIT_STORE") == "sqlite" {
+		limiter.store = &sqliteBucketStore{db: database}
+	}
+
+	overrides, err := getRateLimitOverrides(ctx, database)
+	if err != nil {
+		logError(ctx, "initRateLimit getRateLimitOverrides", err)
+		return
+	}
+
+	for _, override := range overrides {
+		limiter.setOverride(override.UserID, override.Group, override.Policy)
+	}
+}
+
+func (l *rateLimiter) policy(group, userID string) rateLimitPolicy {
+	policy, _ := l.lookup(group, userID)
+	return policy
+}
+
+// lookup -> effective policy and whether it comes from an override
+func (l *rateLimiter) lookup(group, userID string) (policy rateLimitPolicy, override bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if policy, override = l.overrides[userID][group]; override {
+		return
+	}
+
+	policy = defaultRateLimitPolicies[group]
+	return
+}
+
+func (l *rateLimiter) setOverride(userID, group string, policy rateLimitPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.overrides[userID] == nil {
+		l.overrides[userID] = map[string]rateLimitPolicy{}
+	}
+	l.overrides[userID][group] = policy
+}
+
+func (l *rateLimiter) deleteOverride(userID, group string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.overrides[userID], group)
+}
+
+// take -> spend a token of the group bucket, keyed by user id or by ip when there is no user
+func (l *rateLimiter) take(ctx context.Context, group, userID, ip string) (policy rateLimitPolicy, result rateLimitResult, err error) {
+	key := group + "|user:" + userID
+	if userID == "" {
+		key = group + "|ip:" + ip
+	}
+
+	policy = l.policy(group, userID)
+	result, err = l.store.take(ctx, key, policy, time.Now())
+
+	return
+}
+
+// RateLimit -> token bucket per route group, keyed by user id behind Middleware and by ip otherwise
+func RateLimit(group string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+
+		policy, result, err := limiter.take(ctx, group, userIDFromContext(ctx), clientIP(r))
+		if err != nil {
+			// fail open, a broken limiter store must not take the wallet down
+			logError(ctx, "RateLimit take", err)
+			next(w, r, ps)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			abortError(w, r, errLimitExceeded)
+			return
+		}
+
+		next(w, r, ps)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimitOverride ...
+type RateLimitOverride struct {
+	UserID string `db:"user_id"`
+	Group  string `db:"route_group"`
+	Policy rateLimitPolicy
+}
+
+const (
+	createRateLimitOverrideTable = `
+		CREATE TABLE IF NOT EXISTS rate_limit_override (
+			user_id TEXT NOT NULL,
+			route_group TEXT NOT NULL,
+			rate REAL NOT NULL,
+			burst INTEGER NOT NULL,
+			PRIMARY KEY (user_id, route_group)
+		);
+	`
+
+	createRateLimitBucketTable = `
+		CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+			key TEXT NOT NULL PRIMARY KEY,
+			tokens REAL NOT NULL,
+			update_time INTEGER NOT NULL
+		);
+	`
+
+	upsertRateLimitOverrideSQL = `
+		INSERT INTO rate_limit_override
+			(user_id, route_group, rate, burst)
+		VALUES
+			(?,?,?,?)
+		ON CONFLICT (user_id, route_group) DO UPDATE SET
+			rate = excluded.rate,
+			burst = excluded.burst
+		;
+	`
+
+	deleteRateLimitOverrideSQL = `
+		DELETE FROM
+			rate_limit_override
+		WHERE
+			user_id = $1 AND
+			route_group = $2
+	`
+
+	getRateLimitOverridesSQL = `
+		SELECT
+			user_id,
+			route_group,
+			rate,
+			burst
+		FROM
+			rate_limit_override
+	`
+
+	getRateLimitBucketSQL = `
+		SELECT
+			tokens,
+			update_time
+		FROM
+			rate_limit_bucket
+		WHERE
+			key = $1
+	`
+
+	upsertRateLimitBucketSQL = `
+		INSERT INTO rate_limit_bucket
+			(key, tokens, update_time)
+		VALUES
+			(?,?,?)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = excluded.tokens,
+			update_time = excluded.update_time
+		;
+	`
+)
+
+func upsertRateLimitOverride(ctx context.Context, db *sql.DB, override RateLimitOverride) (err error) {
+	defer observeQuery("upsertRateLimitOverride", time.Now())
+	ctx, span := startQuerySpan(ctx, "upsertRateLimitOverride")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		upsertRateLimitOverrideSQL,
+		override.UserID,
+		override.Group,
+		override.Policy.Rate,
+		override.Policy.Burst,
+	)
+	if err != nil {
+		logError(ctx, "upsertRateLimitOverride ExecContext", err)
+	}
+
+	return
+}
+
+func deleteRateLimitOverride(ctx context.Context, db *sql.DB, userID, group string) (err error) {
+	defer observeQuery("deleteRateLimitOverride", time.Now())
+	ctx, span := startQuerySpan(ctx, "deleteRateLimitOverride")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, deleteRateLimitOverrideSQL, userID, group)
+	if err != nil {
+		logError(ctx, "deleteRateLimitOverride ExecContext", err)
+	}
+
+	return
+}
+
+func getRateLimitOverrides(ctx context.Context, db *sql.DB) (overrides []RateLimitOverride, err error) {
+	defer observeQuery("getRateLimitOverrides", time.Now())
+	ctx, span := startQuerySpan(ctx, "getRateLimitOverrides")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getRateLimitOverridesSQL)
+	if err != nil {
+		logError(ctx, "getRateLimitOverrides QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var override RateLimitOverride
+		err = rows.Scan(
+			&override.UserID,
+			&override.Group,
+			&override.Policy.Rate,
+			&override.Policy.Burst,
+		)
+		if err != nil {
+			logError(ctx, "getRateLimitOverrides Scan", err)
+			return
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func takeRateLimitBucket(ctx context.Context, db *sql.DB, key string, policy rateLimitPolicy, now time.Time) (result rateLimitResult, err error) {
+	defer observeQuery("takeRateLimitBucket", time.Now())
+	ctx, span := startQuerySpan(ctx, "takeRateLimitBucket")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "takeRateLimitBucket BeginTx", err)
+		return
+	}
+
+	var (
+		bucket     bucketState
+		updateTime int64
+	)
+	err = tx.QueryRowContext(ctx, getRateLimitBucketSQL, key).Scan(&bucket.Tokens, &updateTime)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		logError(ctx, "takeRateLimitBucket Scan", err)
+		return
+	}
+	if err == nil {
+		bucket.UpdateTime = time.Unix(0, updateTime)
+	}
+
+	result = bucket.take(policy, now)
+
+	_, err = tx.ExecContext(ctx, upsertRateLimitBucketSQL, key, bucket.Tokens, bucket.UpdateTime.UnixNano())
+	if err != nil {
+		tx.Rollback()
+		logError(ctx, "takeRateLimitBucket ExecContext", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "takeRateLimitBucket Commit", err)
+	}
+
+	return
+}
+
+// HandleGetRateLimits -> Admin: view rate limit overrides of a user
+func HandleGetRateLimits(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	userID := ps.ByName("user_id")
+
+	response.Data = rateLimitResponse(userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleSetRateLimit -> Admin: override the rate limit of a user for one route group
+func HandleSetRateLimit(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	userID := ps.ByName("user_id")
+
+	var req RequestRateLimit
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	if _, ok := defaultRateLimitPolicies[req.Group]; !ok || req.Group == rateLimitGroupInit || req.Group == rateLimitGroupAuth {
+		writeValidationError(w, r, &response, validationErrors{
+			"group": {"Must be one of: wallet, transaction."},
+		})
+		return
+	}
+
+	override := RateLimitOverride{
+		UserID: userID,
+		Group:  req.Group,
+		Policy: rateLimitPolicy{Rate: req.Rate, Burst: req.Burst},
+	}
+
+	err := upsertRateLimitOverride(r.Context(), database, override)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	limiter.setOverride(userID, req.Group, override.Policy)
+
+	response.Data = rateLimitResponse(userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleDeleteRateLimit -> Admin: drop a rate limit override, back to the default policy
+func HandleDeleteRateLimit(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	userID := ps.ByName("user_id")
+
+	var req RequestRateLimitGroup
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	err := deleteRateLimitOverride(r.Context(), database, userID, req.Group)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	limiter.deleteOverride(userID, req.Group)
+
+	response.Data = rateLimitResponse(userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func rateLimitResponse(userID string) ResponseRateLimits {
+	response := ResponseRateLimits{
+		UserID: userID,
+	}
+
+	for _, group := range []string{rateLimitGroupWallet, rateLimitGroupTransaction} {
+		policy, override := limiter.lookup(group, userID)
+		response.Limits = append(response.Limits, ResponseRateLimit{
+			Group:    group,
+			Rate:     policy.Rate,
+			Burst:    policy.Burst,
+			Override: override,
+		})
+	}
+
+	return response
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAuthRateLimit -> requests with a wrong token are throttled by ip before the session
+// check, so tokens cannot be guessed at full speed
+func TestAuthRateLimit(t *testing.T) {
+	defaultPolicy := defaultRateLimitPolicies[rateLimitGroupAuth]
+	defaultRateLimitPolicies[rateLimitGroupAuth] = rateLimitPolicy{Rate: 0, Burst: 2}
+	defer func() {
+		defaultRateLimitPolicies[rateLimitGroupAuth] = defaultPolicy
+	}()
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i, status := range want {
+		r := httptest.NewRequest("GET", "/api/v1/wallet", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("Authorization", "Token guessed-"+generateUUID())
+
+		w := httptest.NewRecorder()
+		testServer.Config.Handler.ServeHTTP(w, r)
+
+		if w.Code != status {
+			t.Errorf("request %d: status %d, want %d", i, w.Code, status)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeForm = "application/x-www-form-urlencoded"
+	contentTypeJSON = "application/json"
+	contentTypeCSV  = "text/csv"
+
+	// maxRequestBody -> upper bound for a decoded request body
+	maxRequestBody = 1 << 20
+
+	msgRequired       = "Missing data for required field."
+	msgUnknownField   = "Unknown field."
+	msgInvalidInteger = "Not a valid integer."
+	msgInvalidNumber  = "Not a valid number."
+	msgInvalidString  = "Not a valid string."
+	msgInvalidBoolean = "Not a valid boolean."
+	msgInvalidBody    = "Invalid input type."
+	msgMinimum        = "Must be greater than or equal to %s."
+
+	// schemaField -> key for errors about the body as a whole
+	schemaField = "_schema"
+)
+
+// validationErrors -> field name to messages, e.g. {"customer_xid": ["Missing data for required field."]}
+type validationErrors map[string][]string
+
+func (v validationErrors) add(field, message string) {
+	v[field] = append(v[field], message)
+}
+
+// bindRequest -> decode req, on failure fill response and write the status.
+// Reports whether the handler should go on.
+func bindRequest(w http.ResponseWriter, r *http.Request, req interface{}, response *Response) bool {
+	errs, err := decodeRequest(r, req)
+	if err != nil {
+		writeError(w, r, response, err)
+		return false
+	}
+
+	if len(errs) > 0 {
+		writeValidationError(w, r, response, errs)
+		return false
+	}
+
+	return true
+}
+
+// writeValidationError -> fill a handler response with field level errors
+func writeValidationError(w http.ResponseWriter, r *http.Request, response *Response, errs validationErrors) {
+	response.Status = statusFail
+	response.Data = ResponseValidationError{
+		Error:     errs,
+		Code:      string(codeInvalidInput),
+		RequestID: requestIDFromContext(r.Context()),
+	}
+	w.WriteHeader(errorStatus[codeInvalidInput])
+}
+
+// decodeRequest -> fill req from a form or json body depending on Content-Type.
+// Fields are bound by their json tag, and `validate:"required"` / `validate:"min=N"`
+// are checked for both encodings. Unknown fields are only rejected for json.
+func decodeRequest(r *http.Request, req interface{}) (errs validationErrors, err error) {
+	errs = validationErrors{}
+
+	mediaType := contentTypeForm
+	if header := r.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err = mime.ParseMediaType(header)
+		if err != nil {
+			err = errUnsupportedMediaType
+			return
+		}
+	}
+
+	switch mediaType {
+	case contentTypeJSON:
+		decodeJSON(r, req, errs)
+	case contentTypeForm, "multipart/form-data":
+		decodeForm(r, req, errs)
+	default:
+		err = errUnsupportedMediaType
+	}
+
+	return
+}
+
+func decodeJSON(r *http.Request, req interface{}, errs validationErrors) {
+	raw := map[string]json.RawMessage{}
+
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	err := dec.Decode(&raw)
+	if err != nil && err != io.EOF {
+		errs.add(schemaField, msgInvalidBody)
+		return
+	}
+
+	// the body is one object, anything after it is not ours to ignore
+	if err == nil && dec.Decode(&json.RawMessage{}) != io.EOF {
+		errs.add(schemaField, msgInvalidBody)
+		return
+	}
+
+	known := map[string]bool{}
+	eachField(req, func(name string, field reflect.Value, rules fieldRules) {
+		known[name] = true
+
+		value, ok := raw[name]
+		if !ok || string(value) == "null" {
+			if rules.required {
+				errs.add(name, msgRequired)
+			}
+			return
+		}
+
+		if json.Unmarshal(value, field.Addr().Interface()) != nil {
+			errs.add(name, invalidMessage(field.Kind()))
+			return
+		}
+
+		// strings are trimmed like form values, so a blank one is missing too
+		if field.Kind() == reflect.String {
+			field.SetString(strings.TrimSpace(field.String()))
+			if field.String() == "" && rules.required {
+				errs.add(name, msgRequired)
+				return
+			}
+		}
+
+		rules.check(name, field, errs)
+	})
+
+	for name := range raw {
+		if !known[name] {
+			errs.add(name, msgUnknownField)
+		}
+	}
+}
+
+func decodeForm(r *http.Request, req interface{}, errs validationErrors) {
+	r.ParseMultipartForm(maxRequestBody)
+
+	eachField(req, func(name string, field reflect.Value, rules fieldRules) {
+		value := strings.TrimSpace(r.FormValue(name))
+		if value == "" {
+			if rules.required {
+				errs.add(name, msgRequired)
+			}
+			return
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs.add(name, msgInvalidInteger)
+				return
+			}
+			field.SetInt(n)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs.add(name, msgInvalidNumber)
+				return
+			}
+			field.SetFloat(f)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs.add(name, msgInvalidBoolean)
+				return
+			}
+			field.SetBool(b)
+		}
+
+		rules.check(name, field, errs)
+	})
+}
+
+type fieldRules struct {
+	required bool
+	min      *float64
+	minText  string
+}
+
+func (f fieldRules) check(name string, field reflect.Value, errs validationErrors) {
+	if f.min == nil {
+		return
+	}
+
+	var value float64
+	switch field.Kind() {
+	case reflect.Int, reflect.Int64:
+		value = float64(field.Int())
+	case reflect.Float64:
+		value = field.Float()
+	default:
+		return
+	}
+
+	if value < *f.min {
+		errs.add(name, fmt.Sprintf(msgMinimum, f.minText))
+	}
+}
+
+func parseRules(tag string) (rules fieldRules) {
+	for _, rule := range strings.Split(tag, ",") {
+		switch {
+		case rule == "required":
+			rules.required = true
+		case strings.HasPrefix(rule, "min="):
+			rules.minText = strings.TrimPrefix(rule, "min=")
+			if min, err := strconv.ParseFloat(rules.minText, 64); err == nil {
+				rules.min = &min
+			}
+		}
+	}
+
+	return
+}
+
+func eachField(req interface{}, fn func(name string, field reflect.Value, rules fieldRules)) {
+	v := reflect.ValueOf(req).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fn(name, v.Field(i), parseRules(t.Field(i).Tag.Get("validate")))
+	}
+}
+
+func invalidMessage(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int64:
+		return msgInvalidInteger
+	case reflect.Float64:
+		return msgInvalidNumber
+	case reflect.Bool:
+		return msgInvalidBoolean
+	default:
+		return msgInvalidString
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDecodeJSONRequired -> json strings are trimmed and a blank required one is missing,
+// like a form value
+func TestDecodeJSONRequired(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		req  interface{}
+		want interface{}
+		errs validationErrors
+	}{
+		{
+			name: "empty customer_xid",
+			body: `{"customer_xid":""}`,
+			req:  &RequestInitAccount{},
+			want: &RequestInitAccount{},
+			errs: validationErrors{"customer_xid": {msgRequired}},
+		},
+		{
+			name: "blank customer_xid",
+			body: `{"customer_xid":" \t "}`,
+			req:  &RequestInitAccount{},
+			want: &RequestInitAccount{},
+			errs: validationErrors{"customer_xid": {msgRequired}},
+		},
+		{
+			name: "padded customer_xid",
+			body: `{"customer_xid":" abc "}`,
+			req:  &RequestInitAccount{},
+			want: &RequestInitAccount{CustomerXID: "abc"},
+			errs: validationErrors{},
+		},
+		{
+			name: "empty reference_id",
+			body: `{"amount":100,"reference_id":""}`,
+			req:  &RequestBalanceChange{},
+			want: &RequestBalanceChange{Amount: 100},
+			errs: validationErrors{"reference_id": {msgRequired}},
+		},
+		{
+			name: "empty optional pocket_id",
+			body: `{"amount":100,"reference_id":"ref","pocket_id":""}`,
+			req:  &RequestBalanceChange{},
+			want: &RequestBalanceChange{Amount: 100, ReferenceID: "ref"},
+			errs: validationErrors{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", contentTypeJSON)
+
+			errs, err := decodeRequest(r, tt.req)
+			if err != nil {
+				t.Fatalf("decodeRequest: %v", err)
+			}
+			if !reflect.DeepEqual(errs, tt.errs) {
+				t.Errorf("errors %v, want %v", errs, tt.errs)
+			}
+			if !reflect.DeepEqual(tt.req, tt.want) {
+				t.Errorf("request %+v, want %+v", tt.req, tt.want)
+			}
+		})
+	}
+}
+
+// TestInitEmptyCustomerXID -> /api/v1/init with an empty json customer_xid is rejected every
+// time, no account is made for it
+func TestInitEmptyCustomerXID(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(testServer.URL+"/api/v1/init", contentTypeJSON, strings.NewReader(`{"customer_xid":""}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("init %d: status %d, want %d", i, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// A reversal gives a withdrawal back: its amount is deposited to the main pocket and the
+// points it earned are taken back, in one tx. The fee it paid is kept. transaction_reversal
+// is keyed by the withdrawal, so it is reversed once however many admins try. A withdrawal
+// with a dispute that may still credit it is decided by the dispute instead, the legs of a
+// payment are given back by a refund of the merchant and the funding of an escrow by the
+// escrow. The sending leg of a transfer, a payment request settlement too, is never reversed:
+// the money already is in the other wallet. Neither is a withdrawal written by a dispute, the
+// dispute already decided it.
+
+const reversalReferencePrefix = "reversal:"
+
+// Reversal -> a withdrawal given back by the deposit ReversalTransactionID
+type Reversal struct {
+	TransactionID         string    `db:"transaction_id"`
+	ReversalTransactionID string    `db:"reversal_transaction_id"`
+	WalletID              string    `db:"wallet_id"`
+	Amount                int       `db:"amount"`
+	PointsReversed        int       `db:"points_reversed"`
+	Reason                string    `db:"reason"`
+	CreateTime            time.Time `db:"create_time"`
+}
+
+const (
+	createTransactionReversalTable = `
+		CREATE TABLE IF NOT EXISTS transaction_reversal (
+			transaction_id TEXT NOT NULL PRIMARY KEY,
+			reversal_transaction_id TEXT NOT NULL,
+			wallet_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			points_reversed INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertTransactionReversalSQL = `
+		INSERT INTO transaction_reversal
+			(transaction_id, reversal_transaction_id, wallet_id, amount, points_reversed, reason, create_time)
+		VALUES
+			(?,?,?,?,?,?,?)
+		;
+	`
+)
+
+// insertReversal -> deposit the amount of the withdrawal back, take back its points and
+// record the reversal in one tx, errAlreadyReversed when it was reversed before,
+// errPaymentNotReversible for a leg of a payment, errEscrowNotReversible for the funding of
+// an escrow, errTransferNotReversible for the leg of a transfer, errDisputeLegNotReversible
+// for a withdrawal of a dispute and errTransactionDisputed while a dispute may credit it
+func insertReversal(ctx context.Context, db *sql.DB, withdrawal WalletTransaction, reversal *Reversal) (err error) {
+	defer observeQuery("insertReversal", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertReversal")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertReversal BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	leg, err := paymentLeg(ctx, tx, withdrawal.ID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errPaymentNotReversible
+		return
+	}
+
+	leg, err = escrowLeg(ctx, tx, withdrawal.ID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errEscrowNotReversible
+		return
+	}
+
+	leg, err = transferLeg(ctx, tx, withdrawal.ID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errTransferNotReversible
+		return
+	}
+
+	leg, err = disputeLeg(ctx, tx, withdrawal.ID)
+	if err != nil {
+		return
+	}
+	if leg {
+		err = errDisputeLegNotReversible
+		return
+	}
+
+	var disputes int
+	err = tx.QueryRowContext(ctx, countCreditedDisputesSQL, withdrawal.ID).Scan(&disputes)
+	if err != nil {
+		logError(ctx, "insertReversal disputes", err)
+		return
+	}
+	if disputes > 0 {
+		err = errTransactionDisputed
+		return
+	}
+
+	transaction, event, err := applyBalanceChange(ctx, tx, withdrawal.WalletID, "", reversalReferencePrefix+withdrawal.ID, withdrawal.Amount, depositType)
+	if err != nil {
+		return
+	}
+	reversal.ReversalTransactionID = transaction.ID
+	reversal.CreateTime = transaction.CreateTime
+
+	reversal.PointsReversed, err = reversePoints(ctx, tx, withdrawal.ID, reversal.CreateTime)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx,
+		insertTransactionReversalSQL,
+		reversal.TransactionID,
+		reversal.ReversalTransactionID,
+		reversal.WalletID,
+		reversal.Amount,
+		reversal.PointsReversed,
+		reversal.Reason,
+		reversal.CreateTime,
+	)
+	if isUniqueViolation(err) {
+		err = errAlreadyReversed
+		return
+	}
+	if err != nil {
+		logError(ctx, "insertReversal ExecContext", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertReversal Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// ReverseWithdrawal -> give a withdrawal back to its wallet, with the points it earned
+func ReverseWithdrawal(ctx context.Context, transactionID, reason string) (reversal Reversal, err error) {
+	ctx = withOperation(ctx, "reverse_withdrawal")
+	ctx, span := startSpan(ctx, "ReverseWithdrawal", spanKindInternal)
+	defer func() {
+		observeWalletResult("reverse_withdrawal", reversal.Amount, err)
+		span.finish(err)
+	}()
+
+	withdrawal, err := getTransactionByID(ctx, database, transactionID)
+	if err == sql.ErrNoRows {
+		err = errTransactionNotFound
+	}
+	if err != nil {
+		return
+	}
+	setWalletID(ctx, withdrawal.WalletID)
+
+	if withdrawal.Type != withdrawalType {
+		err = errNotReversible
+		return
+	}
+
+	reversal = Reversal{
+		TransactionID: withdrawal.ID,
+		WalletID:      withdrawal.WalletID,
+		Amount:        withdrawal.Amount,
+		Reason:        reason,
+	}
+
+	err = insertReversal(ctx, database, withdrawal, &reversal)
+	return
+}
+
+// HandleReverseTransaction -> Admin: give a withdrawal back, with the points it earned
+func HandleReverseTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestReverseTransaction
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	reversal, err := ReverseWithdrawal(r.Context(), ps.ByName("transaction_id"), req.Reason)
+	switch err {
+	case nil:
+	case errNotReversible, errPaymentNotReversible, errEscrowNotReversible, errTransferNotReversible, errDisputeLegNotReversible:
+		writeValidationError(w, r, &response, validationErrors{"transaction_id": {err.(*Error).Message + "."}})
+		return
+	default:
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseReversal{
+		Reversal: ResponseReversalDetail{
+			TransactionID:         reversal.TransactionID,
+			ReversalTransactionID: reversal.ReversalTransactionID,
+			Amount:                reversal.Amount,
+			PointsReversed:        reversal.PointsReversed,
+			Reason:                reversal.Reason,
+			CreatedAt:             reversal.CreateTime,
+		},
+	}
+	w.WriteHeader(http.StatusCreated)
+}
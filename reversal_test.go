@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// assertNotReversible -> reversing withdrawalID fails with want and leaves the wallet of
+// userID at balance
+func assertNotReversible(t *testing.T, userID, withdrawalID string, balance int, want error) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := ReverseWithdrawal(ctx, withdrawalID, "test")
+	if err != want {
+		t.Errorf("ReverseWithdrawal: %v, want %v", err, want)
+	}
+
+	wallet, _, _, err := ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+	if wallet.Balance != balance {
+		t.Errorf("balance %d, want %d", wallet.Balance, balance)
+	}
+}
+
+// TestReverseTransferLeg -> the sending leg of a transfer is not given back
+func TestReverseTransferLeg(t *testing.T) {
+	ctx := context.Background()
+	sender := fundedWallet(t, 1000)
+	recipient := fundedWallet(t, 0)
+
+	transfer, err := TransferMoney(ctx, sender, recipient, sender+"-transfer", 400)
+	if err != nil {
+		t.Fatalf("TransferMoney: %v", err)
+	}
+
+	assertNotReversible(t, sender, transfer.WithdrawalID, 600, errTransferNotReversible)
+}
+
+// TestReversePaymentRequestSettlement -> the transfer settling a share of a payment request
+// is not given back
+func TestReversePaymentRequestSettlement(t *testing.T) {
+	ctx := context.Background()
+	requester := fundedWallet(t, 0)
+	payer := fundedWallet(t, 1000)
+
+	request, errs := paymentRequestFromRequest(requester, RequestPaymentRequest{Payers: payer + ":300"}, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("paymentRequestFromRequest: %v", errs)
+	}
+
+	request, err := CreatePaymentRequest(ctx, request)
+	if err != nil {
+		t.Fatalf("CreatePaymentRequest: %v", err)
+	}
+
+	_, transfer, err := AcceptPaymentRequest(ctx, payer, request.ID)
+	if err != nil {
+		t.Fatalf("AcceptPaymentRequest: %v", err)
+	}
+
+	assertNotReversible(t, payer, transfer.WithdrawalID, 700, errTransferNotReversible)
+}
+
+// TestReverseDisputeTakeBack -> the withdrawal taking a provisional credit back is not given
+// back
+func TestReverseDisputeTakeBack(t *testing.T) {
+	userID := fundedWallet(t, 1000)
+	takeBackID := lostDisputeTakeBack(t, userID)
+
+	assertNotReversible(t, userID, takeBackID, 600, errDisputeLegNotReversible)
+}
@@ -0,0 +1,1038 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	scheduleKindTransfer   = "transfer"
+	scheduleKindWithdrawal = "withdrawal"
+
+	scheduleActive    = "active"
+	schedulePaused    = "paused"
+	scheduleCancelled = "cancelled"
+
+	// what a run does when the balance is short
+	onInsufficientSkip  = "skip"
+	onInsufficientRetry = "retry"
+
+	scheduleRunSucceeded = "succeeded"
+	scheduleRunRetrying  = "retrying"
+	scheduleRunSkipped   = "skipped"
+	scheduleRunFailed    = "failed"
+
+	minScheduleInterval          = time.Minute
+	defaultScheduleRetryInterval = time.Hour
+	defaultScheduleMaxRetries    = 3
+
+	// scheduleRunsLimit -> latest runs returned with a schedule
+	scheduleRunsLimit = 20
+
+	// schedulerBatch -> due schedules run per poll, the rest wait for the next one
+	schedulerBatch = 100
+	schedulerPoll  = time.Second
+)
+
+// Schedule -> a standing order of userID, run at every occurrence of Cron or Interval
+type Schedule struct {
+	ID                  string        `db:"id"`
+	UserID              string        `db:"user_id"`
+	Kind                string        `db:"kind"`
+	ToUserID            string        `db:"to_user_id"`
+	Amount              int           `db:"amount"`
+	Cron                string        `db:"cron"`
+	Interval            time.Duration `db:"interval_seconds"`
+	StartTime           time.Time     `db:"start_time"`
+	OnInsufficientFunds string        `db:"on_insufficient_funds"`
+	RetryInterval       time.Duration `db:"retry_interval_seconds"`
+	MaxRetries          int           `db:"max_retries"`
+	Status              string        `db:"status"`
+	DueTime             time.Time     `db:"due_time"`
+	Attempt             int           `db:"attempt"`
+	NextRunTime         time.Time     `db:"next_run_time"`
+	CreateTime          time.Time     `db:"create_time"`
+	UpdateTime          time.Time     `db:"update_time"`
+}
+
+// ScheduleRun -> one attempt at one occurrence of a schedule
+type ScheduleRun struct {
+	ID            string    `db:"id"`
+	ScheduleID    string    `db:"schedule_id"`
+	DueTime       time.Time `db:"due_time"`
+	RunTime       time.Time `db:"run_time"`
+	Attempt       int       `db:"attempt"`
+	Status        string    `db:"status"`
+	TransactionID string    `db:"transaction_id"`
+	Error         string    `db:"error"`
+}
+
+// scheduleSpec -> when a schedule is due
+type scheduleSpec interface {
+	// next -> the first occurrence after t, zero when there is none
+	next(t time.Time) time.Time
+}
+
+// intervalSpec -> start, start+every, start+2*every, ...
+type intervalSpec struct {
+	start time.Time
+	every time.Duration
+}
+
+func (i intervalSpec) next(t time.Time) time.Time {
+	if t.Before(i.start) {
+		return i.start
+	}
+
+	return i.start.Add((t.Sub(i.start)/i.every + 1) * i.every)
+}
+
+func (s Schedule) spec() (spec scheduleSpec, err error) {
+	if s.Cron != "" {
+		return parseCron(s.Cron)
+	}
+
+	return intervalSpec{start: s.StartTime, every: s.Interval}, nil
+}
+
+// referenceID -> the same for every attempt at an occurrence, so a run repeated after a
+// crash finds the money already moved
+func (s Schedule) referenceID() string {
+	return fmt.Sprintf("schedule:%s:%d", s.ID, s.DueTime.Unix())
+}
+
+// clock -> time source of the scheduler, tests swap in one they move by hand
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// scheduler -> runs the due schedules every poll
+type scheduler struct {
+	clock clock
+	poll  time.Duration
+}
+
+func newScheduler(c clock) *scheduler {
+	return &scheduler{clock: c, poll: schedulerPoll}
+}
+
+// walletScheduler -> the scheduler of the service, its clock also dates new schedules
+var walletScheduler = newScheduler(systemClock{})
+
+const (
+	createScheduleTable = `
+		CREATE TABLE IF NOT EXISTS schedule (
+			id TEXT NOT NULL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			to_user_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			cron TEXT NOT NULL,
+			interval_seconds INTEGER NOT NULL,
+			start_time DATETIME NOT NULL,
+			on_insufficient_funds TEXT NOT NULL,
+			retry_interval_seconds INTEGER NOT NULL,
+			max_retries INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			due_time DATETIME NOT NULL,
+			attempt INTEGER NOT NULL,
+			next_run_time DATETIME NOT NULL,
+			create_time DATETIME NOT NULL,
+			update_time DATETIME NOT NULL
+		);
+	`
+
+	createScheduleRunTable = `
+		CREATE TABLE IF NOT EXISTS schedule_run (
+			id TEXT NOT NULL PRIMARY KEY,
+			schedule_id TEXT NOT NULL,
+			due_time DATETIME NOT NULL,
+			run_time DATETIME NOT NULL,
+			attempt INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			error TEXT NOT NULL
+		);
+	`
+
+	insertScheduleSQL = `
+		INSERT INTO schedule
+			(id, user_id, kind, to_user_id, amount, cron, interval_seconds, start_time, on_insufficient_funds,
+			retry_interval_seconds, max_retries, status, due_time, attempt, next_run_time, create_time, update_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	selectScheduleSQL = `
+		SELECT
+			id,
+			user_id,
+			kind,
+			to_user_id,
+			amount,
+			cron,
+			interval_seconds,
+			start_time,
+			on_insufficient_funds,
+			retry_interval_seconds,
+			max_retries,
+			status,
+			due_time,
+			attempt,
+			next_run_time,
+			create_time,
+			update_time
+		FROM
+			schedule
+	`
+
+	getSchedulesByUserIDSQL = selectScheduleSQL + `
+		WHERE
+			user_id = $1
+		ORDER BY
+			create_time
+	`
+
+	getScheduleSQL = selectScheduleSQL + `
+		WHERE
+			id = $1 AND
+			user_id = $2
+	`
+
+	getDueSchedulesSQL = selectScheduleSQL + `
+		WHERE
+			status = $1 AND
+			julianday(next_run_time) <= julianday($2)
+		ORDER BY
+			julianday(next_run_time)
+		LIMIT $3
+	`
+
+	updateScheduleSQL = `
+		UPDATE
+			schedule
+		SET
+			status = $1,
+			due_time = $2,
+			attempt = $3,
+			next_run_time = $4,
+			update_time = $5
+		WHERE
+			id = $6
+	`
+
+	insertScheduleRunSQL = `
+		INSERT INTO schedule_run
+			(id, schedule_id, due_time, run_time, attempt, status, transaction_id, error)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getScheduleRunsSQL = `
+		SELECT
+			id,
+			schedule_id,
+			due_time,
+			run_time,
+			attempt,
+			status,
+			transaction_id,
+			error
+		FROM
+			schedule_run
+		WHERE
+			schedule_id = $1
+		ORDER BY
+			julianday(run_time) DESC
+		LIMIT $2
+	`
+)
+
+func insertSchedule(ctx context.Context, db *sql.DB, schedule Schedule) (err error) {
+	defer observeQuery("insertSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		insertScheduleSQL,
+		schedule.ID,
+		schedule.UserID,
+		schedule.Kind,
+		schedule.ToUserID,
+		schedule.Amount,
+		schedule.Cron,
+		int64(schedule.Interval/time.Second),
+		schedule.StartTime,
+		schedule.OnInsufficientFunds,
+		int64(schedule.RetryInterval/time.Second),
+		schedule.MaxRetries,
+		schedule.Status,
+		schedule.DueTime,
+		schedule.Attempt,
+		schedule.NextRunTime,
+		schedule.CreateTime,
+		schedule.UpdateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertSchedule ExecContext", err)
+	}
+
+	return
+}
+
+func scanSchedules(rows *sql.Rows) (schedules []Schedule, err error) {
+	for rows.Next() {
+		var schedule Schedule
+		var interval, retryInterval int64
+		err = rows.Scan(
+			&schedule.ID,
+			&schedule.UserID,
+			&schedule.Kind,
+			&schedule.ToUserID,
+			&schedule.Amount,
+			&schedule.Cron,
+			&interval,
+			&schedule.StartTime,
+			&schedule.OnInsufficientFunds,
+			&retryInterval,
+			&schedule.MaxRetries,
+			&schedule.Status,
+			&schedule.DueTime,
+			&schedule.Attempt,
+			&schedule.NextRunTime,
+			&schedule.CreateTime,
+			&schedule.UpdateTime,
+		)
+		if err != nil {
+			return
+		}
+
+		schedule.Interval = time.Duration(interval) * time.Second
+		schedule.RetryInterval = time.Duration(retryInterval) * time.Second
+		schedules = append(schedules, schedule)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getSchedulesByUserID(ctx context.Context, db *sql.DB, userID string) (schedules []Schedule, err error) {
+	defer observeQuery("getSchedulesByUserID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getSchedulesByUserID")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getSchedulesByUserIDSQL, userID)
+	if err != nil {
+		logError(ctx, "getSchedulesByUserID QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	schedules, err = scanSchedules(rows)
+	if err != nil {
+		logError(ctx, "getSchedulesByUserID Scan", err)
+	}
+
+	return
+}
+
+// getSchedule -> the schedule only when it belongs to userID
+func getSchedule(ctx context.Context, db *sql.DB, scheduleID, userID string) (schedule Schedule, err error) {
+	defer observeQuery("getSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "getSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getScheduleSQL, scheduleID, userID)
+	if err != nil {
+		logError(ctx, "getSchedule QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	schedules, err := scanSchedules(rows)
+	if err != nil {
+		logError(ctx, "getSchedule Scan", err)
+		return
+	}
+
+	if len(schedules) == 0 {
+		err = sql.ErrNoRows
+		return
+	}
+	schedule = schedules[0]
+
+	return
+}
+
+func getDueSchedules(ctx context.Context, db *sql.DB, now time.Time, limit int) (schedules []Schedule, err error) {
+	defer observeQuery("getDueSchedules", time.Now())
+	ctx, span := startQuerySpan(ctx, "getDueSchedules")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getDueSchedulesSQL, scheduleActive, now, limit)
+	if err != nil {
+		logError(ctx, "getDueSchedules QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	schedules, err = scanSchedules(rows)
+	if err != nil {
+		logError(ctx, "getDueSchedules Scan", err)
+	}
+
+	return
+}
+
+func updateSchedule(ctx context.Context, db *sql.DB, schedule Schedule) (err error) {
+	defer observeQuery("updateSchedule", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateSchedule")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx,
+		updateScheduleSQL,
+		schedule.Status,
+		schedule.DueTime,
+		schedule.Attempt,
+		schedule.NextRunTime,
+		schedule.UpdateTime,
+		schedule.ID,
+	)
+	if err != nil {
+		logError(ctx, "updateSchedule ExecContext", err)
+	}
+
+	return
+}
+
+// recordScheduleRun -> store the run and move the schedule on in one transaction
+func recordScheduleRun(ctx context.Context, db *sql.DB, schedule Schedule, run ScheduleRun) (err error) {
+	defer observeQuery("recordScheduleRun", time.Now())
+	ctx, span := startQuerySpan(ctx, "recordScheduleRun")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "recordScheduleRun BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		insertScheduleRunSQL,
+		run.ID,
+		run.ScheduleID,
+		run.DueTime,
+		run.RunTime,
+		run.Attempt,
+		run.Status,
+		run.TransactionID,
+		run.Error,
+	)
+	if err != nil {
+		logError(ctx, "recordScheduleRun insert run", err)
+		return
+	}
+
+	_, err = tx.ExecContext(ctx,
+		updateScheduleSQL,
+		schedule.Status,
+		schedule.DueTime,
+		schedule.Attempt,
+		schedule.NextRunTime,
+		schedule.UpdateTime,
+		schedule.ID,
+	)
+	if err != nil {
+		logError(ctx, "recordScheduleRun update schedule", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "recordScheduleRun Commit", err)
+	}
+
+	return
+}
+
+func getScheduleRuns(ctx context.Context, db *sql.DB, scheduleID string, limit int) (runs []ScheduleRun, err error) {
+	defer observeQuery("getScheduleRuns", time.Now())
+	ctx, span := startQuerySpan(ctx, "getScheduleRuns")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getScheduleRunsSQL, scheduleID, limit)
+	if err != nil {
+		logError(ctx, "getScheduleRuns QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run ScheduleRun
+		err = rows.Scan(
+			&run.ID,
+			&run.ScheduleID,
+			&run.DueTime,
+			&run.RunTime,
+			&run.Attempt,
+			&run.Status,
+			&run.TransactionID,
+			&run.Error,
+		)
+		if err != nil {
+			logError(ctx, "getScheduleRuns Scan", err)
+			return
+		}
+
+		runs = append(runs, run)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// scheduleFromRequest -> a new schedule of userID, or the fields that are wrong
+func scheduleFromRequest(userID string, req RequestSchedule, now time.Time) (schedule Schedule, errs validationErrors) {
+	errs = validationErrors{}
+
+	schedule = Schedule{
+		ID:                  generateUUID(),
+		UserID:              userID,
+		Kind:                req.Kind,
+		ToUserID:            req.ToUserID,
+		Amount:              req.Amount,
+		Cron:                strings.TrimSpace(req.Cron),
+		StartTime:           now,
+		OnInsufficientFunds: req.OnInsufficientFunds,
+		RetryInterval:       defaultScheduleRetryInterval,
+		MaxRetries:          req.MaxRetries,
+		Status:              scheduleActive,
+		CreateTime:          now,
+		UpdateTime:          now,
+	}
+
+	switch schedule.Kind {
+	case scheduleKindTransfer:
+		if schedule.ToUserID == "" {
+			errs.add("to_user_id", msgRequired)
+		}
+		if schedule.ToUserID == userID {
+			errs.add("to_user_id", errTransferToSelf.Message+".")
+		}
+	case scheduleKindWithdrawal:
+		if schedule.ToUserID != "" {
+			errs.add("to_user_id", "Only for transfers.")
+		}
+	default:
+		errs.add("kind", "Must be one of: transfer, withdrawal.")
+	}
+
+	switch {
+	case schedule.Cron != "" && req.Interval != "":
+		errs.add("interval", "Set either cron or interval, not both.")
+	case schedule.Cron != "":
+		if _, err := parseCron(schedule.Cron); err != nil {
+			errs.add("cron", "Not a valid cron expression: "+err.Error()+".")
+		}
+	case req.Interval != "":
+		interval, err := time.ParseDuration(req.Interval)
+		switch {
+		case err != nil:
+			errs.add("interval", "Not a valid duration, e.g. 24h or 90m.")
+		case interval < minScheduleInterval || interval%time.Second != 0:
+			errs.add("interval", "Must be whole seconds and at least 1m.")
+		}
+		schedule.Interval = interval
+	default:
+		errs.add("cron", "Set either cron or interval.")
+	}
+
+	if req.StartAt != "" {
+		start, err := time.Parse(time.RFC3339, req.StartAt)
+		if err != nil {
+			errs.add("start_at", "Not a valid RFC 3339 time.")
+		}
+		schedule.StartTime = start.UTC()
+	}
+
+	switch schedule.OnInsufficientFunds {
+	case "":
+		schedule.OnInsufficientFunds = onInsufficientSkip
+	case onInsufficientSkip, onInsufficientRetry:
+	default:
+		errs.add("on_insufficient_funds", "Must be one of: skip, retry.")
+	}
+
+	if req.RetryInterval != "" {
+		retryInterval, err := time.ParseDuration(req.RetryInterval)
+		if err != nil || retryInterval < time.Minute || retryInterval%time.Second != 0 {
+			errs.add("retry_interval", "Must be a duration of whole seconds and at least 1m.")
+		}
+		schedule.RetryInterval = retryInterval
+	}
+
+	if schedule.MaxRetries == 0 {
+		schedule.MaxRetries = defaultScheduleMaxRetries
+	}
+
+	if len(errs) > 0 {
+		return
+	}
+
+	// the first occurrence at or after the start
+	spec, _ := schedule.spec()
+	schedule.DueTime = spec.next(schedule.StartTime.Add(-time.Nanosecond))
+	if schedule.DueTime.IsZero() {
+		errs.add("cron", "Never matches.")
+	}
+	schedule.NextRunTime = schedule.DueTime
+
+	return
+}
+
+// CreateSchedule -> store a standing order, the first run is at its first occurrence
+func CreateSchedule(ctx context.Context, schedule Schedule) (err error) {
+	ctx = withOperation(ctx, "create_schedule")
+	ctx, span := startSpan(ctx, "CreateSchedule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	_, err = viewBalance(ctx, schedule.UserID)
+	if err != nil {
+		return
+	}
+
+	if schedule.Kind == scheduleKindTransfer {
+		if schedule.ToUserID == schedule.UserID {
+			err = errTransferToSelf
+			return
+		}
+
+		var exists bool
+		exists, err = userExists(ctx, database, schedule.ToUserID)
+		if err != nil {
+			return
+		}
+		if !exists {
+			err = errUserNotFound
+			return
+		}
+	}
+
+	err = insertSchedule(ctx, database, schedule)
+	return
+}
+
+// ListSchedules -> every schedule of userID, cancelled ones included
+func ListSchedules(ctx context.Context, userID string) (schedules []Schedule, err error) {
+	ctx = withOperation(ctx, "list_schedules")
+	ctx, span := startSpan(ctx, "ListSchedules", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	schedules, err = getSchedulesByUserID(ctx, database, userID)
+	return
+}
+
+// GetSchedule -> a schedule of userID with its latest runs
+func GetSchedule(ctx context.Context, userID, scheduleID string) (schedule Schedule, runs []ScheduleRun, err error) {
+	ctx = withOperation(ctx, "get_schedule")
+	ctx, span := startSpan(ctx, "GetSchedule", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	schedule, err = ownSchedule(ctx, userID, scheduleID)
+	if err != nil {
+		return
+	}
+
+	runs, err = getScheduleRuns(ctx, database, schedule.ID, scheduleRunsLimit)
+	if err == nil && runs == nil {
+		runs = []ScheduleRun{}
+	}
+
+	return
+}
+
+func ownSchedule(ctx context.Context, userID, scheduleID string) (schedule Schedule, err error) {
+	schedule, err = getSchedule(ctx, database, scheduleID, userID)
+	if err == sql.ErrNoRows {
+		err = errScheduleNotFound
+	}
+
+	return
+}
+
+// SetScheduleStatus -> pause, resume or cancel a schedule. Resuming starts again from the
+// next occurrence, the ones missed while paused do not run. Cancelling is final.
+func SetScheduleStatus(ctx context.Context, userID, scheduleID, status string) (schedule Schedule, err error) {
+	ctx = withOperation(ctx, "set_schedule_status")
+	ctx, span := startSpan(ctx, "SetScheduleStatus", spanKindInternal)
+	span.setAttribute("status", status)
+	defer func() {
+		span.finish(err)
+	}()
+
+	schedule, err = ownSchedule(ctx, userID, scheduleID)
+	if err != nil || schedule.Status == status {
+		return
+	}
+
+	if schedule.Status == scheduleCancelled {
+		err = errScheduleCancelled
+		return
+	}
+
+	now := walletScheduler.clock.Now()
+	if status == scheduleActive {
+		spec, specErr := schedule.spec()
+		if specErr != nil {
+			err = specErr
+			return
+		}
+
+		schedule.DueTime = spec.next(now)
+		schedule.NextRunTime = schedule.DueTime
+		schedule.Attempt = 0
+	}
+
+	schedule.Status = status
+	schedule.UpdateTime = now
+
+	err = updateSchedule(ctx, database, schedule)
+	return
+}
+
+// run -> run due schedules every poll until ctx is done
+func (s *scheduler) run(ctx context.Context) {
+	ctx = withOperation(ctx, "scheduler")
+
+	for {
+		_, err := s.runDue(ctx)
+		if err != nil {
+			logError(ctx, "scheduler runDue", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(s.poll):
+		}
+	}
+}
+
+// runDue -> run every schedule due by the clock, one at a time. A schedule whose run
+// hits an internal error is left as it is and tried again on the next call.
+func (s *scheduler) runDue(ctx context.Context) (runs int, err error) {
+	schedules, err := getDueSchedules(ctx, database, s.clock.Now(), schedulerBatch)
+	if err != nil {
+		return
+	}
+
+	for _, schedule := range schedules {
+		err = s.runSchedule(ctx, schedule)
+		if err != nil {
+			logError(ctx, "scheduler runSchedule", err, "schedule_id", schedule.ID)
+			continue
+		}
+		runs++
+	}
+
+	err = nil
+	return
+}
+
+// runSchedule -> move the money of the occurrence at schedule.DueTime, then record the run
+// and when the schedule is due again
+func (s *scheduler) runSchedule(ctx context.Context, schedule Schedule) (err error) {
+	ctx = withOperation(ctx, "run_schedule")
+	ctx, span := startSpan(ctx, "RunSchedule", spanKindInternal)
+	span.setAttribute("schedule_id", schedule.ID)
+	defer func() {
+		span.finish(err)
+	}()
+
+	spec, err := schedule.spec()
+	if err != nil {
+		return
+	}
+
+	run := ScheduleRun{
+		ID:         generateUUID(),
+		ScheduleID: schedule.ID,
+		DueTime:    schedule.DueTime,
+		Attempt:    schedule.Attempt + 1,
+	}
+
+	transactionID, err := executeSchedule(ctx, schedule)
+
+	now := s.clock.Now()
+	run.RunTime = now
+	schedule.UpdateTime = now
+
+	switch {
+	case err == nil:
+		run.Status = scheduleRunSucceeded
+		run.TransactionID = transactionID
+	case errorCodeOf(err) == codeInternal:
+		return
+	case errors.Is(err, errInsufficientFunds) && schedule.OnInsufficientFunds == onInsufficientSkip:
+		run.Status = scheduleRunSkipped
+	case errors.Is(err, errInsufficientFunds) && run.Attempt <= schedule.MaxRetries &&
+		now.Add(schedule.RetryInterval).Before(spec.next(schedule.DueTime)):
+		run.Status = scheduleRunRetrying
+	default:
+		run.Status = scheduleRunFailed
+	}
+	if err != nil {
+		run.Error = err.Error()
+		err = nil
+	}
+
+	if run.Status == scheduleRunRetrying {
+		schedule.Attempt = run.Attempt
+		schedule.NextRunTime = now.Add(schedule.RetryInterval)
+	} else {
+		// occurrences missed while the service was down are not made up for
+		after := schedule.DueTime
+		if now.After(after) {
+			after = now
+		}
+
+		schedule.Attempt = 0
+		schedule.DueTime = spec.next(after)
+		schedule.NextRunTime = schedule.DueTime
+		if schedule.DueTime.IsZero() {
+			schedule.Status = scheduleCancelled
+		}
+	}
+
+	err = recordScheduleRun(ctx, database, schedule, run)
+	return
+}
+
+// executeSchedule -> the withdrawal or transfer of the occurrence, through the same
+// usecases as the api. An occurrence already done, e.g. before a crash, is not done again.
+func executeSchedule(ctx context.Context, schedule Schedule) (transactionID string, err error) {
+	referenceID := schedule.referenceID()
+
+	if schedule.Kind == scheduleKindTransfer {
+		var transfer Transfer
+		transfer, err = getTransferByReferenceID(ctx, database, referenceID)
+		if err == sql.ErrNoRows {
+			transfer, err = TransferMoney(ctx, schedule.UserID, schedule.ToUserID, referenceID, schedule.Amount)
+		}
+		transactionID = transfer.WithdrawalID
+
+		return
+	}
+
+	transaction, err := getTransactionByReferenceID(ctx, database, referenceID, withdrawalType)
+	if err == sql.ErrNoRows {
+		transaction, err = Withdrawal(ctx, schedule.UserID, referenceID, schedule.Amount)
+	}
+	transactionID = transaction.ID
+
+	return
+}
+
+// HandleCreateSchedule -> Create a standing order from my wallet
+func HandleCreateSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	var req RequestSchedule
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	schedule, errs := scheduleFromRequest(uID, req, walletScheduler.clock.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	err := CreateSchedule(r.Context(), schedule)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseSchedule{
+		Schedule: scheduleResponse(schedule, nil),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListSchedules -> View the standing orders of my wallet
+func HandleListSchedules(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	schedules, err := ListSchedules(r.Context(), userIDFromContext(r.Context()))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseSchedules{Schedules: []ResponseScheduleDetail{}}
+	for _, schedule := range schedules {
+		data.Schedules = append(data.Schedules, scheduleResponse(schedule, nil))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGetSchedule -> View a standing order with its latest runs
+func HandleGetSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	schedule, runs, err := GetSchedule(r.Context(), userIDFromContext(r.Context()), ps.ByName("schedule_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseSchedule{
+		Schedule: scheduleResponse(schedule, runs),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePauseSchedule -> Stop running a standing order until it is resumed
+func HandlePauseSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleScheduleStatus(w, r, ps, schedulePaused)
+}
+
+// HandleResumeSchedule -> Run a paused standing order again from its next occurrence
+func HandleResumeSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleScheduleStatus(w, r, ps, scheduleActive)
+}
+
+// HandleCancelSchedule -> Stop a standing order for good
+func HandleCancelSchedule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	handleScheduleStatus(w, r, ps, scheduleCancelled)
+}
+
+func handleScheduleStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, status string) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	schedule, err := SetScheduleStatus(r.Context(), userIDFromContext(r.Context()), ps.ByName("schedule_id"), status)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseSchedule{
+		Schedule: scheduleResponse(schedule, nil),
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// scheduleResponse -> runs are only listed when they were loaded
+func scheduleResponse(schedule Schedule, runs []ScheduleRun) ResponseScheduleDetail {
+	detail := ResponseScheduleDetail{
+		ID:                  schedule.ID,
+		Kind:                schedule.Kind,
+		ToUserID:            schedule.ToUserID,
+		Amount:              schedule.Amount,
+		Cron:                schedule.Cron,
+		StartAt:             schedule.StartTime,
+		OnInsufficientFunds: schedule.OnInsufficientFunds,
+		RetryInterval:       schedule.RetryInterval.String(),
+		MaxRetries:          schedule.MaxRetries,
+		Status:              schedule.Status,
+		Attempt:             schedule.Attempt,
+		CreatedAt:           schedule.CreateTime,
+		UpdatedAt:           schedule.UpdateTime,
+	}
+
+	if schedule.Interval > 0 {
+		detail.Interval = schedule.Interval.String()
+	}
+
+	if schedule.Status == scheduleActive {
+		detail.NextRunAt = &schedule.NextRunTime
+	}
+
+	if runs != nil {
+		detail.Runs = []ResponseScheduleRun{}
+	}
+	for _, run := range runs {
+		detail.Runs = append(detail.Runs, ResponseScheduleRun{
+			ID:            run.ID,
+			DueAt:         run.DueTime,
+			RanAt:         run.RunTime,
+			Attempt:       run.Attempt,
+			Status:        run.Status,
+			TransactionID: run.TransactionID,
+			Error:         run.Error,
+		})
+	}
+
+	return detail
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock -> a clock that only moves when the test advances it
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeWaiter{at: f.now.Add(d), c: c})
+	return c
+}
+
+// advance -> move the clock by d, firing every After that is due by then
+func (f *fakeClock) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+
+	waiters := f.waiters[:0]
+	for _, waiter := range f.waiters {
+		if waiter.at.After(f.now) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		waiter.c <- f.now
+	}
+	f.waiters = waiters
+}
+
+// waitForAfter -> block until something waits on the clock
+func (f *fakeClock) waitForAfter(t *testing.T) {
+	t.Helper()
+
+	for i := 0; i < 500; i++ {
+		f.mu.Lock()
+		waiting := len(f.waiters)
+		f.mu.Unlock()
+		if waiting > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("nothing waits on the clock")
+}
+
+// TestSchedulerClock -> as the clock moves, only the schedules due by it run, once per
+// occurrence, and occurrences missed in a jump are not made up for
+func TestSchedulerClock(t *testing.T) {
+	ctx := context.Background()
+	userID := fundedWallet(t, 10000)
+
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	s := newScheduler(clock)
+
+	create := func(amount int, interval string, startAt time.Time) Schedule {
+		t.Helper()
+
+		schedule, errs := scheduleFromRequest(userID, RequestSchedule{
+			Kind:       scheduleKindWithdrawal,
+			Amount:     amount,
+			Interval:   interval,
+			StartAt:    startAt.Format(time.RFC3339),
+			MaxRetries: 1,
+		}, clock.Now())
+		if len(errs) > 0 {
+			t.Fatalf("scheduleFromRequest: %v", errs)
+		}
+
+		err := CreateSchedule(ctx, schedule)
+		if err != nil {
+			t.Fatalf("CreateSchedule: %v", err)
+		}
+
+		return schedule
+	}
+
+	hourly := create(100, "1h", start.Add(time.Hour))
+	everyThreeHours := create(1000, "3h", start.Add(2*time.Hour))
+
+	steps := []struct {
+		advance time.Duration
+		runs    int
+	}{
+		{0, 0},
+		{time.Hour, 1},                       // 01:00 hourly
+		{time.Hour, 2},                       // 02:00 hourly and every three hours
+		{30 * time.Minute, 0},                // 02:30 nothing due
+		{3 * time.Hour, 2},                   // 05:30 hourly once for 03:00 to 05:00, every three hours at 05:00
+		{30 * time.Minute, 1},                // 06:00 hourly
+		{59*time.Minute + 59*time.Second, 0}, // 06:59:59 nothing due
+	}
+	for i, step := range steps {
+		clock.advance(step.advance)
+
+		runs, err := s.runDue(ctx)
+		if err != nil {
+			t.Fatalf("step %d: runDue: %v", i, err)
+		}
+		if runs != step.runs {
+			t.Errorf("step %d at %s: %d runs, want %d", i, clock.Now().Format(time.TimeOnly), runs, step.runs)
+		}
+	}
+
+	wantDue := map[string][]time.Time{
+		hourly.ID: {
+			start.Add(6 * time.Hour),
+			start.Add(3 * time.Hour),
+			start.Add(2 * time.Hour),
+			start.Add(time.Hour),
+		},
+		everyThreeHours.ID: {
+			start.Add(5 * time.Hour),
+			start.Add(2 * time.Hour),
+		},
+	}
+	for scheduleID, want := range wantDue {
+		schedule, runs, err := GetSchedule(ctx, userID, scheduleID)
+		if err != nil {
+			t.Fatalf("GetSchedule: %v", err)
+		}
+		if len(runs) != len(want) {
+			t.Fatalf("schedule %s: %d runs, want %d", schedule.ID, len(runs), len(want))
+		}
+		for i, run := range runs {
+			if !run.DueTime.Equal(want[i]) || run.Status != scheduleRunSucceeded {
+				t.Errorf("schedule %s run %d: due %s status %s, want due %s succeeded", schedule.ID, i, run.DueTime, run.Status, want[i])
+			}
+		}
+	}
+
+	wallet, _, _, err := ViewBalance(ctx, userID)
+	if err != nil {
+		t.Fatalf("ViewBalance: %v", err)
+	}
+	if wallet.Balance != 10000-4*100-2*1000 {
+		t.Errorf("balance %d, want %d", wallet.Balance, 10000-4*100-2*1000)
+	}
+
+	// the run loop waits on the clock, not on the wall
+	loopCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.run(loopCtx)
+		close(done)
+	}()
+	clock.waitForAfter(t)
+	clock.advance(time.Hour) // 07:59:59, hourly at 07:00
+	clock.waitForAfter(t)
+	cancel()
+	<-done
+
+	_, runs, err := GetSchedule(ctx, userID, hourly.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule: %v", err)
+	}
+	if len(runs) != 5 {
+		t.Errorf("hourly after the loop: %d runs, want 5", len(runs))
+	}
+}
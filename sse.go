@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	lastEventIDHeader = "Last-Event-ID"
+
+	// sseHeartbeatInterval -> comment lines keep proxies from closing an idle stream
+	sseHeartbeatInterval = 15 * time.Second
+
+	// sseRetry -> reconnect delay suggested to EventSource clients, in milliseconds
+	sseRetry = 3000
+)
+
+// HandleWalletStream -> Stream the changes of my wallet as server-sent events
+func HandleWalletStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		abortError(w, r, fmt.Errorf("HandleWalletStream: %T is not a http.Flusher", w))
+		return
+	}
+
+	var lastSequence int64
+	if header := r.Header.Get(lastEventIDHeader); header != "" {
+		var err error
+		lastSequence, err = strconv.ParseInt(header, 10, 64)
+		if err != nil || lastSequence < 0 {
+			response := Response{}
+			writeValidationError(w, r, &response, validationErrors{lastEventIDHeader: {msgInvalidInteger}})
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	_, backlog, sub, err := SubscribeWallet(ctx, userIDFromContext(ctx), lastSequence)
+	if err != nil {
+		abortError(w, r, err)
+		return
+	}
+	defer walletEvents.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+
+	sent := lastSequence
+	send := func(event walletEvent) {
+		if event.Sequence <= sent {
+			return
+		}
+		sent = event.Sequence
+
+		data, _ := json.Marshal(newResponseWalletEvent(event))
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+	}
+
+	for _, event := range backlog {
+		send(event)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				if walletEvents.isLagged(sub) {
+					data, _ := json.Marshal(newResponseError(ctx, errSlowConsumer))
+					fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+					flusher.Flush()
+				}
+				return
+			}
+
+			send(event)
+			flusher.Flush()
+		}
+	}
+}
+
+func newResponseWalletEvent(event walletEvent) ResponseWalletEvent {
+	response := ResponseWalletEvent{
+		Sequence: event.Sequence,
+		Type:     event.Type,
+		WalletID: event.WalletID,
+		Status:   "disabled",
+		Balance:  event.Balance,
+		Time:     event.Time,
+	}
+
+	if event.Status == statusActive {
+		response.Status = "enabled"
+	}
+
+	if tx := event.Transaction; tx != nil {
+		response.Transaction = &ResponseTransactionDetail{
+			ID:          tx.ID,
+			Type:        tx.TypeName(),
+			Amount:      tx.Amount,
+			ReferenceID: tx.ReferenceID,
+			CreatedAt:   tx.CreateTime,
+		}
+	}
+
+	return response
+}
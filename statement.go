@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	statementFormatCSV = "csv"
+	statementFormatPDF = "pdf"
+
+	statementMonthLayout = "2006-01"
+
+	// statementJobDelay -> wait after month end so transactions still in flight are committed
+	statementJobDelay = time.Minute
+)
+
+var statementContentTypes = map[string]string{
+	statementFormatCSV: "text/csv; charset=utf-8",
+	statementFormatPDF: "application/pdf",
+}
+
+// Statement -> one month of a wallet, in UTC
+type Statement struct {
+	WalletID       string
+	UserID         string
+	Month          time.Time
+	OpeningBalance int
+	ClosingBalance int
+	Rows           []StatementRow
+	Totals         []StatementTotal
+}
+
+// StatementRow -> a transaction with the balance right after it
+type StatementRow struct {
+	Transaction WalletTransaction
+	Balance     int
+}
+
+// StatementTotal -> count and sum of the transactions of one type
+type StatementTotal struct {
+	Type   string
+	Count  int
+	Amount int
+}
+
+// monthStart -> first instant of the UTC month of t
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+const (
+	createStatementTable = `
+		CREATE TABLE IF NOT EXISTS statement (
+			wallet_id TEXT NOT NULL,
+			month TEXT NOT NULL,
+			format TEXT NOT NULL,
+			content BLOB NOT NULL,
+			create_time DATETIME NOT NULL,
+			PRIMARY KEY (wallet_id, month, format)
+		);
+	`
+
+	insertStatementSQL = `
+		INSERT INTO statement
+			(wallet_id, month, format, content, create_time)
+		VALUES
+			(?,?,?,?,?)
+		ON CONFLICT (wallet_id, month, format) DO NOTHING
+		;
+	`
+
+	getStatementSQL = `
+		SELECT
+			content
+		FROM
+			statement
+		WHERE
+			wallet_id = $1 AND
+			month = $2 AND
+			format = $3
+	`
+
+	getBalanceBeforeSQL = `
+		SELECT
+			COALESCE(SUM(CASE WHEN type IN ($1, $2, $3) THEN -amount ELSE amount END), 0)
+		FROM
+			wallet_transaction
+		WHERE
+			wallet_id = $4 AND
+			julianday(create_time) < julianday($5)
+	`
+
+	getTransactionsBetweenSQL = `
+		SELECT
+			id,
+			wallet_id,
+			type,
+			amount,
+			reference_id,
+			create_time
+		FROM
+			wallet_transaction
+		WHERE
+			wallet_id = $1 AND
+			julianday(create_time) >= julianday($2) AND
+			julianday(create_time) < julianday($3)
+		ORDER BY
+			julianday(create_time),
+			id
+	`
+
+	getWalletsSQL = `
+		SELECT
+			id,
+			user_id,
+			balance,
+			status,
+			enable_time
+		FROM
+			wallet
+		ORDER BY
+			id
+	`
+)
+
+func insertStatement(ctx context.Context, db *sql.DB, walletID, month, format string, content []byte) (err error) {
+	defer observeQuery("insertStatement", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertStatement")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, insertStatementSQL, walletID, month, format, content, time.Now())
+	if err != nil {
+		logError(ctx, "insertStatement ExecContext", err)
+	}
+
+	return
+}
+
+func getStatement(ctx context.Context, db *sql.DB, walletID, month, format string) (content []byte, err error) {
+	defer observeQuery("getStatement", time.Now())
+	ctx, span := startQuerySpan(ctx, "getStatement")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getStatementSQL, walletID, month, format).Scan(&content)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getStatement Scan", err)
+	}
+
+	return
+}
+
+// getBalanceBefore -> balance of walletID from the transactions before t
+func getBalanceBefore(ctx context.Context, db *sql.DB, walletID string, t time.Time) (balance int, err error) {
+	defer observeQuery("getBalanceBefore", time.Now())
+	ctx, span := startQuerySpan(ctx, "getBalanceBefore")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getBalanceBeforeSQL, withdrawalType, feeType, expiryType, walletID, t).Scan(&balance)
+	if err != nil {
+		logError(ctx, "getBalanceBefore Scan", err)
+	}
+
+	return
+}
+
+// getTransactionsBetween -> transactions of walletID in [from, to), oldest first
+func getTransactionsBetween(ctx context.Context, db *sql.DB, walletID string, from, to time.Time) (transactions []WalletTransaction, err error) {
+	defer observeQuery("getTransactionsBetween", time.Now())
+	ctx, span := startQuerySpan(ctx, "getTransactionsBetween")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getTransactionsBetweenSQL, walletID, from, to)
+	if err != nil {
+		logError(ctx, "getTransactionsBetween QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction WalletTransaction
+		err = rows.Scan(
+			&transaction.ID,
+			&transaction.WalletID,
+			&transaction.Type,
+			&transaction.Amount,
+			&transaction.ReferenceID,
+			&transaction.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "getTransactionsBetween Scan", err)
+			return
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getWallets(ctx context.Context, db *sql.DB) (wallets []Wallet, err error) {
+	defer observeQuery("getWallets", time.Now())
+	ctx, span := startQuerySpan(ctx, "getWallets")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getWalletsSQL)
+	if err != nil {
+		logError(ctx, "getWallets QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wallet Wallet
+		var enableTime sql.NullTime
+		err = rows.Scan(&wallet.ID, &wallet.UserID, &wallet.Balance, &wallet.Status, &enableTime)
+		if err != nil {
+			logError(ctx, "getWallets Scan", err)
+			return
+		}
+		wallet.EnableTime = enableTime.Time
+
+		wallets = append(wallets, wallet)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// buildStatement -> statement of wallet for the month starting at month
+func buildStatement(ctx context.Context, wallet Wallet, month time.Time) (statement Statement, err error) {
+	statement = Statement{
+		WalletID: wallet.ID,
+		UserID:   wallet.UserID,
+		Month:    month,
+		Totals: []StatementTotal{
+			{Type: WalletTransaction{Type: depositType}.TypeName()},
+			{Type: WalletTransaction{Type: withdrawalType}.TypeName()},
+		},
+	}
+
+	statement.OpeningBalance, err = getBalanceBefore(ctx, database, wallet.ID, month)
+	if err != nil {
+		return
+	}
+
+	transactions, err := getTransactionsBetween(ctx, database, wallet.ID, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return
+	}
+
+	balance := statement.OpeningBalance
+	for _, transaction := range transactions {
+		balance += transaction.SignedAmount()
+		statement.Rows = append(statement.Rows, StatementRow{Transaction: transaction, Balance: balance})
+		statement.addTotal(transaction)
+	}
+	statement.ClosingBalance = balance
+
+	return
+}
+
+func (s *Statement) addTotal(transaction WalletTransaction) {
+	for i := range s.Totals {
+		if s.Totals[i].Type == transaction.TypeName() {
+			s.Totals[i].Count++
+			s.Totals[i].Amount += transaction.Amount
+			return
+		}
+	}
+
+	s.Totals = append(s.Totals, StatementTotal{Type: transaction.TypeName(), Count: 1, Amount: transaction.Amount})
+}
+
+func renderStatement(statement Statement, format string) ([]byte, error) {
+	if format == statementFormatPDF {
+		return renderStatementPDF(statement), nil
+	}
+
+	return renderStatementCSV(statement)
+}
+
+// renderStatementCSV -> summary lines, a blank line, the transactions, a blank line, the totals
+func renderStatementCSV(statement Statement) ([]byte, error) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+
+	records := [][]string{
+		{"Wallet", statement.WalletID},
+		{"Owner", statement.UserID},
+		{"Period", statement.Month.Format("2006-01-02"), statement.Month.AddDate(0, 1, -1).Format("2006-01-02")},
+		{"Opening balance", strconv.Itoa(statement.OpeningBalance)},
+		{"Closing balance", strconv.Itoa(statement.ClosingBalance)},
+		{},
+		{"Date", "Transaction ID", "Reference ID", "Type", "Amount", "Balance"},
+	}
+
+	for _, row := range statement.Rows {
+		tx := row.Transaction
+		records = append(records, []string{
+			tx.CreateTime.UTC().Format(time.RFC3339),
+			tx.ID,
+			tx.ReferenceID,
+			tx.TypeName(),
+			strconv.Itoa(tx.SignedAmount()),
+			strconv.Itoa(row.Balance),
+		})
+	}
+
+	records = append(records, []string{}, []string{"Type", "Count", "Total"})
+	for _, total := range statement.Totals {
+		records = append(records, []string{total.Type, strconv.Itoa(total.Count), strconv.Itoa(total.Amount)})
+	}
+
+	err := w.WriteAll(records)
+	return out.Bytes(), err
+}
+
+// renderStatementPDF -> the same content as the csv, laid out on A4 pages
+func renderStatementPDF(statement Statement) []byte {
+	doc := newPDFDocument()
+
+	const (
+		rowHeight  = 14.0
+		fontSize   = 9.0
+		colDate    = pdfMargin
+		colRef     = pdfMargin + 110
+		colType    = pdfMargin + 300
+		colAmount  = pdfPageWidth - pdfMargin - 90
+		colBalance = pdfPageWidth - pdfMargin
+	)
+
+	y := 0.0
+	title := func() {
+		doc.addPage()
+		y = pdfPageHeight - pdfMargin
+		doc.text(pdfMargin, y, pdfBold, 16, "Wallet statement")
+		doc.textRight(colBalance, y, pdfRegular, 10, statement.Month.Format("January 2006"))
+		y -= 2 * rowHeight
+	}
+	columns := func() {
+		doc.text(colDate, y, pdfBold, fontSize, "Date")
+		doc.text(colRef, y, pdfBold, fontSize, "Reference ID")
+		doc.text(colType, y, pdfBold, fontSize, "Type")
+		doc.textRight(colAmount, y, pdfBold, fontSize, "Amount")
+		doc.textRight(colBalance, y, pdfBold, fontSize, "Balance")
+		doc.line(pdfMargin, y-4, colBalance, y-4)
+		y -= rowHeight
+	}
+	nextRow := func() {
+		y -= rowHeight
+		if y < pdfMargin {
+			title()
+			columns()
+		}
+	}
+
+	title()
+	summary := [][2]string{
+		{"Wallet", statement.WalletID},
+		{"Owner", statement.UserID},
+		{"Period", statement.Month.Format("2 January 2006") + " - " + statement.Month.AddDate(0, 1, -1).Format("2 January 2006") + " (UTC)"},
+		{"Opening balance", formatAmount(statement.OpeningBalance)},
+		{"Closing balance", formatAmount(statement.ClosingBalance)},
+	}
+	for _, line := range summary {
+		doc.text(pdfMargin, y, pdfBold, 10, line[0])
+		doc.text(pdfMargin+110, y, pdfRegular, 10, line[1])
+		y -= rowHeight
+	}
+	y -= rowHeight
+	columns()
+
+	doc.text(colDate, y, pdfRegular, fontSize, statement.Month.Format("2006-01-02"))
+	doc.text(colRef, y, pdfRegular, fontSize, "Opening balance")
+	doc.textRight(colBalance, y, pdfRegular, fontSize, formatAmount(statement.OpeningBalance))
+
+	for _, row := range statement.Rows {
+		nextRow()
+
+		tx := row.Transaction
+		doc.text(colDate, y, pdfRegular, fontSize, tx.CreateTime.UTC().Format("2006-01-02 15:04"))
+		doc.text(colRef, y, pdfRegular, fontSize, truncate(tx.ReferenceID, 36))
+		doc.text(colType, y, pdfRegular, fontSize, tx.TypeName())
+		doc.textRight(colAmount, y, pdfRegular, fontSize, formatAmount(tx.SignedAmount()))
+		doc.textRight(colBalance, y, pdfRegular, fontSize, formatAmount(row.Balance))
+	}
+
+	nextRow()
+	doc.line(pdfMargin, y+rowHeight-4, colBalance, y+rowHeight-4)
+	doc.text(colRef, y, pdfBold, fontSize, "Closing balance")
+	doc.textRight(colBalance, y, pdfBold, fontSize, formatAmount(statement.ClosingBalance))
+
+	nextRow()
+	nextRow()
+	doc.text(colDate, y, pdfBold, fontSize, "Totals")
+	for _, total := range statement.Totals {
+		nextRow()
+		doc.text(colDate, y, pdfRegular, fontSize, total.Type)
+		doc.text(colRef, y, pdfRegular, fontSize, fmt.Sprintf("%d transactions", total.Count))
+		doc.textRight(colAmount, y, pdfRegular, fontSize, formatAmount(total.Amount))
+	}
+
+	return doc.bytes()
+}
+
+// formatAmount -> amount with thousands separators, e.g. -1,250,000
+func formatAmount(amount int) string {
+	digits := strconv.Itoa(amount)
+	sign := ""
+	if amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+
+	return sign + digits
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+
+	return string(runes[:max-1]) + "..."
+}
+
+// GetStatement -> statement of my wallet for month in format. A month that is over is
+// generated once and stored, the running month is generated on every call.
+func GetStatement(ctx context.Context, userID string, month time.Time, format string) (content []byte, err error) {
+	ctx = withOperation(ctx, "get_statement")
+	ctx, span := startSpan(ctx, "GetStatement", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := ownWallet(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	if month.AddDate(0, 1, 0).After(time.Now()) {
+		statement, err := buildStatement(ctx, wallet, month)
+		if err != nil {
+			return nil, err
+		}
+		return renderStatement(statement, format)
+	}
+
+	return storedStatement(ctx, wallet, month, format)
+}
+
+// storedStatement -> the stored statement of a month that is over, generating it when missing
+func storedStatement(ctx context.Context, wallet Wallet, month time.Time, format string) (content []byte, err error) {
+	key := month.Format(statementMonthLayout)
+
+	content, err = getStatement(ctx, database, wallet.ID, key, format)
+	if err != sql.ErrNoRows {
+		return
+	}
+
+	statement, err := buildStatement(ctx, wallet, month)
+	if err != nil {
+		return
+	}
+
+	content, err = renderStatement(statement, format)
+	if err != nil {
+		logError(ctx, "storedStatement renderStatement", err)
+		return
+	}
+
+	err = insertStatement(ctx, database, wallet.ID, key, format, content)
+	return
+}
+
+// GenerateMonthStatements -> store the statements of every wallet for month, in every format
+func GenerateMonthStatements(ctx context.Context, month time.Time) (generated int, err error) {
+	ctx = withOperation(ctx, "generate_month_statements")
+	ctx, span := startSpan(ctx, "GenerateMonthStatements", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallets, err := getWallets(ctx, database)
+	if err != nil {
+		return
+	}
+
+	for _, wallet := range wallets {
+		for _, format := range []string{statementFormatCSV, statementFormatPDF} {
+			_, err = storedStatement(ctx, wallet, month, format)
+			if err != nil {
+				return
+			}
+			generated++
+		}
+	}
+
+	return
+}
+
+// runStatementJob -> generate last month's statements now, in case the service was down at
+// month end, then again shortly after every month end
+func runStatementJob(ctx context.Context) {
+	for {
+		month := monthStart(time.Now()).AddDate(0, -1, 0)
+
+		generated, err := GenerateMonthStatements(ctx, month)
+		if err != nil {
+			logError(ctx, "runStatementJob GenerateMonthStatements", err)
+		} else {
+			logInfo(ctx, "statements generated", "month", month.Format(statementMonthLayout), "statements", generated)
+		}
+
+		next := monthStart(time.Now()).AddDate(0, 1, 0).Add(statementJobDelay)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// HandleGetStatement -> Download the statement of my wallet for one month
+func HandleGetStatement(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	uID := userIDFromContext(r.Context())
+
+	var req RequestStatement
+	if !bindRequest(w, r, &req, &response) {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = statementFormatCSV
+	}
+
+	errs := validationErrors{}
+	month, err := time.Parse(statementMonthLayout, req.Month)
+	if err != nil {
+		errs["month"] = []string{"Not a valid month, use YYYY-MM."}
+	} else if month.After(time.Now()) {
+		errs["month"] = []string{"Must not be in the future."}
+	}
+	if _, ok := statementContentTypes[req.Format]; !ok {
+		errs["format"] = []string{"Must be one of: csv, pdf."}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	content, err := GetStatement(r.Context(), uID, month, req.Format)
+	if err != nil {
+		abortError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", statementContentTypes[req.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.%s"`, req.Month, req.Format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
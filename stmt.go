@@ -2,13 +2,13 @@ package main
 
 const (
 	createUserTable = `
-		CREATE TABLE user (
+		CREATE TABLE IF NOT EXISTS user (
 			id TEXT NOT NULL PRIMARY KEY
 		);
 	`
 
 	createSessionTable = `
-		CREATE TABLE session (
+		CREATE TABLE IF NOT EXISTS session (
 			id TEXT NOT NULL PRIMARY KEY,
 			user_id TEXT NOT NULL,
 			status INTEGER NOT NULL
@@ -16,7 +16,7 @@ const (
 	`
 
 	createWalletTable = `
-		CREATE TABLE wallet (
+		CREATE TABLE IF NOT EXISTS wallet (
 			id TEXT NOT NULL PRIMARY KEY,
 			user_id TEXT NOT NULL,
 			balance INTEGER NOT NULL,
@@ -25,7 +25,7 @@ const (
 		);
 	`
 	createTransactionTable = `
-		CREATE TABLE wallet_transaction (
+		CREATE TABLE IF NOT EXISTS wallet_transaction (
 			id TEXT NOT NULL PRIMARY KEY,
 			wallet_id TEXT NOT NULL,
 			type INTEGER NOT NULL,
@@ -97,30 +97,86 @@ const (
 			type = $2
 	`
 
+	getTransactionByIDSQL = `
+		SELECT
+			id,
+			wallet_id,
+			type,
+			amount,
+			reference_id,
+			create_time
+		FROM
+			wallet_transaction
+		WHERE
+			id = $1
+	`
+
 	insertTransactionSQL = `
 		INSERT INTO wallet_transaction 
-			(id, wallet_id, type, amount, reference_id) 
+			(id, wallet_id, type, amount, reference_id, create_time) 
 		VALUES 
-			(?,?,?,?,?)
+			(?,?,?,?,?,?)
 		;
 	`
 
-	updateWalletStatusByUserIDSQL = `
+	getTransactionsByWalletIDSQL = `
+		SELECT
+			id,
+			wallet_id,
+			type,
+			amount,
+			reference_id,
+			create_time
+		FROM
+			wallet_transaction
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			create_time DESC
+		LIMIT $2
+	`
+
+	updateWalletStatusByIDSQL = `
 		UPDATE
 			wallet
 		SET
 			status = $1,
 			enable_time = $2
 		WHERE
-			user_id = $3
+			id = $3
 	`
 
-	updateWalletBalanceByIDSQL = `
+	addWalletBalanceSQL = `
 		UPDATE
 			wallet
 		SET
-			balance = $1
+			balance = balance + $1
 		WHERE
 			id = $2
 	`
+
+	takeWalletBalanceSQL = `
+		UPDATE
+			wallet
+		SET
+			balance = balance - $1
+		WHERE
+			id = $2 AND
+			balance >= $1
+	`
+
+	countActiveSQL = `
+		SELECT
+			(SELECT COUNT(*) FROM session WHERE status = $1),
+			(SELECT COUNT(*) FROM wallet WHERE status = $1)
+	`
+
+	countUserSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			user
+		WHERE
+			id = $1
+	`
 )
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// System accounts hold money that left the wallets but is still owed or earned by the
+// service, e.g. the fees in revenue and the expired credits in breakage, or that the service
+// paid to them, e.g. the vouchers in promotions. Every change is an entry linked to the wallet transaction on the other
+// side, written in the same tx.
+
+const (
+	// systemAccountRevenue -> fees charged to wallets
+	systemAccountRevenue = "revenue"
+	// systemAccountPromotions -> vouchers and credits paid out to wallets, negative as it
+	// only pays out
+	systemAccountPromotions = "promotions"
+	// systemAccountBreakage -> credits that expired before they were spent
+	systemAccountBreakage = "breakage"
+	// systemAccountEscrow -> money of buyers held until it is released or refunded
+	systemAccountEscrow = "escrow"
+	// systemAccountDisputes -> credits of disputes and what was taken back of them
+	systemAccountDisputes = "disputes"
+)
+
+// SystemAccount ...
+type SystemAccount struct {
+	ID         string    `db:"id"`
+	Balance    int       `db:"balance"`
+	CreateTime time.Time `db:"create_time"`
+}
+
+// SystemEntry -> a change of a system account, Amount is negative when money left it
+type SystemEntry struct {
+	ID            string    `db:"id"`
+	AccountID     string    `db:"account_id"`
+	Amount        int       `db:"amount"`
+	Balance       int       `db:"balance"`
+	WalletID      string    `db:"wallet_id"`
+	TransactionID string    `db:"transaction_id"`
+	ReferenceID   string    `db:"reference_id"`
+	CreateTime    time.Time `db:"create_time"`
+}
+
+const (
+	createSystemAccountTable = `
+		CREATE TABLE IF NOT EXISTS system_account (
+			id TEXT NOT NULL PRIMARY KEY,
+			balance INTEGER NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	createSystemEntryTable = `
+		CREATE TABLE IF NOT EXISTS system_entry (
+			id TEXT NOT NULL PRIMARY KEY,
+			account_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			balance INTEGER NOT NULL,
+			wallet_id TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			reference_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	addSystemAccountBalanceSQL = `
+		INSERT INTO system_account
+			(id, balance, create_time)
+		VALUES
+			(?,?,?)
+		ON CONFLICT (id) DO UPDATE SET
+			balance = balance + excluded.balance
+		;
+	`
+
+	getSystemAccountBalanceSQL = `
+		SELECT
+			balance
+		FROM
+			system_account
+		WHERE
+			id = $1
+	`
+
+	insertSystemEntrySQL = `
+		INSERT INTO system_entry
+			(id, account_id, amount, balance, wallet_id, transaction_id, reference_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getSystemAccountsSQL = `
+		SELECT
+			id,
+			balance,
+			create_time
+		FROM
+			system_account
+		ORDER BY
+			id
+	`
+
+	getSystemAccountSQL = `
+		SELECT
+			id,
+			balance,
+			create_time
+		FROM
+			system_account
+		WHERE
+			id = $1
+	`
+
+	getSystemEntriesSQL = `
+		SELECT
+			id,
+			account_id,
+			amount,
+			balance,
+			wallet_id,
+			transaction_id,
+			reference_id,
+			create_time
+		FROM
+			system_entry
+		WHERE
+			account_id = $1
+		ORDER BY
+			create_time DESC,
+			rowid DESC
+		LIMIT $2
+	`
+)
+
+// postSystemEntry -> add entry.Amount to its account in tx and record the entry with the
+// balance after it, the account is created on its first entry
+func postSystemEntry(ctx context.Context, tx *sql.Tx, entry *SystemEntry) (err error) {
+	_, err = tx.ExecContext(ctx, addSystemAccountBalanceSQL, entry.AccountID, entry.Amount, entry.CreateTime)
+	if err != nil {
+		logError(ctx, "postSystemEntry add balance", err)
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, getSystemAccountBalanceSQL, entry.AccountID).Scan(&entry.Balance)
+	if err != nil {
+		logError(ctx, "postSystemEntry Scan", err)
+		return
+	}
+
+	entry.ID = generateUUID()
+	_, err = tx.ExecContext(ctx,
+		insertSystemEntrySQL,
+		entry.ID,
+		entry.AccountID,
+		entry.Amount,
+		entry.Balance,
+		entry.WalletID,
+		entry.TransactionID,
+		entry.ReferenceID,
+		entry.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "postSystemEntry insert", err)
+	}
+
+	return
+}
+
+func getSystemAccounts(ctx context.Context, db *sql.DB) (accounts []SystemAccount, err error) {
+	defer observeQuery("getSystemAccounts", time.Now())
+	ctx, span := startQuerySpan(ctx, "getSystemAccounts")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getSystemAccountsSQL)
+	if err != nil {
+		logError(ctx, "getSystemAccounts QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account SystemAccount
+		err = rows.Scan(&account.ID, &account.Balance, &account.CreateTime)
+		if err != nil {
+			logError(ctx, "getSystemAccounts Scan", err)
+			return
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getSystemAccount(ctx context.Context, db *sql.DB, accountID string) (account SystemAccount, err error) {
+	defer observeQuery("getSystemAccount", time.Now())
+	ctx, span := startQuerySpan(ctx, "getSystemAccount")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getSystemAccountSQL, accountID).Scan(&account.ID, &account.Balance, &account.CreateTime)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getSystemAccount Scan", err)
+	}
+
+	return
+}
+
+func getSystemEntries(ctx context.Context, db *sql.DB, accountID string, limit int) (entries []SystemEntry, err error) {
+	defer observeQuery("getSystemEntries", time.Now())
+	ctx, span := startQuerySpan(ctx, "getSystemEntries")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getSystemEntriesSQL, accountID, limit)
+	if err != nil {
+		logError(ctx, "getSystemEntries QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry SystemEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.AccountID,
+			&entry.Amount,
+			&entry.Balance,
+			&entry.WalletID,
+			&entry.TransactionID,
+			&entry.ReferenceID,
+			&entry.CreateTime,
+		)
+		if err != nil {
+			logError(ctx, "getSystemEntries Scan", err)
+			return
+		}
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// ListSystemAccounts -> every system account with its balance
+func ListSystemAccounts(ctx context.Context) (accounts []SystemAccount, err error) {
+	ctx = withOperation(ctx, "list_system_accounts")
+	ctx, span := startSpan(ctx, "ListSystemAccounts", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	return getSystemAccounts(ctx, database)
+}
+
+// SystemAccountEntries -> a system account and its latest entries, newest first
+func SystemAccountEntries(ctx context.Context, accountID string, limit int) (account SystemAccount, entries []SystemEntry, err error) {
+	ctx = withOperation(ctx, "system_account_entries")
+	ctx, span := startSpan(ctx, "SystemAccountEntries", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	account, err = getSystemAccount(ctx, database, accountID)
+	if err == sql.ErrNoRows {
+		err = errSystemAccountNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	entries, err = getSystemEntries(ctx, database, accountID, limit)
+	return
+}
+
+// HandleListSystemAccounts -> Admin: the system accounts and their balances
+func HandleListSystemAccounts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	accounts, err := ListSystemAccounts(r.Context())
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseSystemAccounts{
+		Accounts: []ResponseSystemAccount{},
+	}
+	for _, account := range accounts {
+		data.Accounts = append(data.Accounts, systemAccountResponse(account))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleSystemAccountEntries -> Admin: the latest entries of a system account
+func HandleSystemAccountEntries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListTransactions
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	account, entries, err := SystemAccountEntries(r.Context(), ps.ByName("account_id"), req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseSystemEntries{
+		Account: systemAccountResponse(account),
+		Entries: []ResponseSystemEntry{},
+	}
+	for _, entry := range entries {
+		data.Entries = append(data.Entries, ResponseSystemEntry{
+			ID:            entry.ID,
+			Amount:        entry.Amount,
+			Balance:       entry.Balance,
+			WalletID:      entry.WalletID,
+			TransactionID: entry.TransactionID,
+			ReferenceID:   entry.ReferenceID,
+			CreatedAt:     entry.CreateTime,
+		})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+func systemAccountResponse(account SystemAccount) ResponseSystemAccount {
+	return ResponseSystemAccount{
+		ID:        account.ID,
+		Balance:   account.Balance,
+		CreatedAt: account.CreateTime,
+	}
+}
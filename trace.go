@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	traceServiceName  = "wallet"
+
+	// span kinds as numbered by OTLP
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	// span status codes as numbered by OTLP
+	spanStatusOK    = 1
+	spanStatusError = 2
+)
+
+// span -> a single unit of work, exported in OTLP-JSON once ended
+type span struct {
+	mu         sync.Mutex
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	sampled    bool
+	name       string
+	kind       int
+	start      time.Time
+	attributes map[string]interface{}
+	ended      bool
+}
+
+// traceExporter -> writes ended spans as OTLP-JSON, one export request per line
+type traceExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var tracer *traceExporter
+
+// initTracing -> configure span export from TRACE_EXPORT: empty disables it,
+// "stdout" writes to standard output, anything else is a file path to append to
+func initTracing(ctx context.Context) {
+	target := os.Getenv("TRACE_EXPORT")
+	switch target {
+	case "":
+		return
+	case "stdout":
+		tracer = &traceExporter{w: os.Stdout}
+	default:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logFatal(ctx, "initTracing OpenFile", err)
+		}
+		tracer = &traceExporter{w: file}
+	}
+
+	logInfo(ctx, "trace export enabled", "target", target)
+}
+
+// startSpan -> start a child of the span in ctx, or a new trace when there is none
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	s := &span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		sampled:    true,
+		attributes: map[string]interface{}{},
+	}
+
+	if parent, ok := ctx.Value(spanKey).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+		s.sampled = parent.sampled
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// startQuerySpan -> start a client span around a database call
+func startQuerySpan(ctx context.Context, query string) (context.Context, *span) {
+	ctx, s := startSpan(ctx, "db "+query, spanKindClient)
+	s.setAttribute("db.system", "sqlite")
+	s.setAttribute("db.operation", query)
+
+	return ctx, s
+}
+
+// spanFromTraceparent -> a remote parent span parsed from a W3C traceparent header
+func spanFromTraceparent(header string) (parent *span, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 || isZero(traceID) {
+		return
+	}
+
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 || isZero(spanID) {
+		return
+	}
+
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || len(parts[3]) != 2 {
+		return
+	}
+
+	parent = &span{sampled: flags&1 == 1}
+	copy(parent.traceID[:], traceID)
+	copy(parent.spanID[:], spanID)
+	ok = true
+
+	return
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// traceIDs -> hex trace and span id of the span in ctx, for log correlation
+func traceIDs(ctx context.Context) (traceID, spanID string) {
+	if s, ok := ctx.Value(spanKey).(*span); ok {
+		traceID = hex.EncodeToString(s.traceID[:])
+		spanID = hex.EncodeToString(s.spanID[:])
+	}
+
+	return
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// finish -> tag a usecase span with its outcome and end it, domain errors are
+// rejections rather than span failures
+func (s *span) finish(err error) {
+	switch {
+	case err == nil:
+		s.setAttribute("outcome", "success")
+	case errorCodeOf(err) != codeInternal:
+		s.setAttribute("outcome", "rejected")
+		s.setAttribute("error.code", string(errorCodeOf(err)))
+		err = nil
+	default:
+		s.setAttribute("outcome", "error")
+	}
+
+	s.end(err)
+}
+
+// end -> finish the span and export it, sql.ErrNoRows is not treated as a failure
+func (s *span) end(err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+
+	if tracer == nil || !s.sampled {
+		return
+	}
+
+	status := otlpStatus{Code: spanStatusOK}
+	if err != nil && err != sql.ErrNoRows {
+		status = otlpStatus{Code: spanStatusError, Message: err.Error()}
+	}
+
+	tracer.export(s, time.Now(), status)
+}
+
+// Trace -> wrap a route handler in a server span, continuing an incoming traceparent
+func Trace(method, route string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+		if parent, ok := spanFromTraceparent(r.Header.Get(traceparentHeader)); ok {
+			ctx = context.WithValue(ctx, spanKey, parent)
+		}
+
+		ctx, s := startSpan(ctx, method+" "+route, spanKindServer)
+		s.setAttribute("http.method", method)
+		s.setAttribute("http.route", route)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r.WithContext(ctx), ps)
+
+		s.setAttribute("http.status_code", recorder.status)
+
+		var err error
+		if recorder.status >= http.StatusInternalServerError {
+			err = fmt.Errorf("http status %d", recorder.status)
+		}
+		s.end(err)
+	}
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExport struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func (e *traceExporter) export(s *span, end time.Time, status otlpStatus) {
+	s.mu.Lock()
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Status:            status,
+	}
+	for key, value := range s.attributes {
+		out.Attributes = append(out.Attributes, otlpAttribute{Key: key, Value: toOTLPValue(value)})
+	}
+	s.mu.Unlock()
+
+	if !isZero(s.parentID[:]) {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+
+	scope := otlpScopeSpans{Spans: []otlpSpan{out}}
+	scope.Scope.Name = traceServiceName
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{
+		{Key: "service.name", Value: toOTLPValue(traceServiceName)},
+	}
+
+	e.mu.Lock()
+	json.NewEncoder(e.w).Encode(otlpExport{ResourceSpans: []otlpResourceSpans{resource}})
+	e.mu.Unlock()
+}
+
+func toOTLPValue(value interface{}) (v otlpValue) {
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	case bool:
+		v.BoolValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+
+	return
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// transferReferencePrefix -> reference_id of both legs of a transfer, followed by its id.
+// The reference_id of the transfer itself is kept on the transfer, so it cannot collide
+// with the references of plain deposits and withdrawals.
+const transferReferencePrefix = "transfer:"
+
+// Transfer -> money moved from one wallet to another, as a withdrawal and a deposit
+// written in one database transaction
+type Transfer struct {
+	ID           string    `db:"id"`
+	FromWalletID string    `db:"from_wallet_id"`
+	ToWalletID   string    `db:"to_wallet_id"`
+	Amount       int       `db:"amount"`
+	ReferenceID  string    `db:"reference_id"`
+	WithdrawalID string    `db:"withdrawal_id"`
+	DepositID    string    `db:"deposit_id"`
+	CreateTime   time.Time `db:"create_time"`
+
+	// ToUserID -> owner of ToWalletID, not stored
+	ToUserID string
+	// Fee -> paid by the sender, linked to WithdrawalID, not stored on the transfer
+	Fee FeeCharge
+}
+
+const (
+	createTransferTable = `
+		CREATE TABLE IF NOT EXISTS transfer (
+			id TEXT NOT NULL PRIMARY KEY,
+			from_wallet_id TEXT NOT NULL,
+			to_wallet_id TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			reference_id TEXT NOT NULL UNIQUE,
+			withdrawal_id TEXT NOT NULL,
+			deposit_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertTransferSQL = `
+		INSERT INTO transfer
+			(id, from_wallet_id, to_wallet_id, amount, reference_id, withdrawal_id, deposit_id, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?)
+		;
+	`
+
+	getTransferByReferenceIDSQL = `
+		SELECT
+			id,
+			from_wallet_id,
+			to_wallet_id,
+			amount,
+			reference_id,
+			withdrawal_id,
+			deposit_id,
+			create_time
+		FROM
+			transfer
+		WHERE
+			reference_id = $1
+	`
+
+	countTransferLegsSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			transfer
+		WHERE
+			withdrawal_id = $1
+	`
+)
+
+func getTransferByReferenceID(ctx context.Context, db *sql.DB, referenceID string) (transfer Transfer, err error) {
+	defer observeQuery("getTransferByReferenceID", time.Now())
+	ctx, span := startQuerySpan(ctx, "getTransferByReferenceID")
+	defer func() {
+		span.end(err)
+	}()
+
+	err = db.QueryRowContext(ctx, getTransferByReferenceIDSQL, referenceID).Scan(
+		&transfer.ID,
+		&transfer.FromWalletID,
+		&transfer.ToWalletID,
+		&transfer.Amount,
+		&transfer.ReferenceID,
+		&transfer.WithdrawalID,
+		&transfer.DepositID,
+		&transfer.CreateTime,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getTransferByReferenceID Scan", err)
+	}
+
+	return
+}
+
+// transferLeg -> transactionID is the withdrawal of a transfer, the recipient already holds
+// its money
+func transferLeg(ctx context.Context, tx *sql.Tx, transactionID string) (leg bool, err error) {
+	var legs int
+	err = tx.QueryRowContext(ctx, countTransferLegsSQL, transactionID).Scan(&legs)
+	if err != nil {
+		logError(ctx, "transferLeg Scan", err)
+		return
+	}
+	leg = legs > 0
+
+	return
+}
+
+// insertTransfer -> move transfer.Amount between the wallets and debit transfer.Fee from the
+// sender, with every transaction, their events and the transfer in one tx. The balances change
+// by the amounts inside tx, so concurrent transfers of the scheduler cannot overwrite them.
+func insertTransfer(ctx context.Context, db *sql.DB, transfer *Transfer) (err error) {
+	defer observeQuery("insertTransfer", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertTransfer")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertTransfer BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	events, err := applyTransfer(ctx, tx, transfer)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertTransfer Commit", err)
+		return
+	}
+
+	for _, event := range events {
+		publishWalletEvent(ctx, event)
+	}
+
+	return
+}
+
+// applyTransfer -> write the fee, both legs and the transfer in tx, the events are published
+// by the caller once tx commits
+func applyTransfer(ctx context.Context, tx *sql.Tx, transfer *Transfer) (events []walletEvent, err error) {
+	legReference := transferReferencePrefix + transfer.ID
+
+	if transfer.Fee.Amount > 0 {
+		var feeEvent walletEvent
+		feeEvent, err = applyFee(ctx, tx, &transfer.Fee, "")
+		if err != nil {
+			return
+		}
+		events = append(events, feeEvent)
+	}
+
+	withdrawal, withdrawalEvent, err := applyBalanceChange(ctx, tx, transfer.FromWalletID, "", legReference, transfer.Amount, withdrawalType)
+	if err != nil {
+		return
+	}
+
+	if transfer.Fee.Amount > 0 {
+		err = linkFee(ctx, tx, &transfer.Fee, withdrawal.ID)
+		if err != nil {
+			return
+		}
+	}
+
+	deposit, depositEvent, err := applyBalanceChange(ctx, tx, transfer.ToWalletID, "", legReference, transfer.Amount, depositType)
+	if err != nil {
+		return
+	}
+	events = append(events, withdrawalEvent, depositEvent)
+
+	transfer.WithdrawalID = withdrawal.ID
+	transfer.DepositID = deposit.ID
+	transfer.CreateTime = withdrawal.CreateTime
+
+	_, err = tx.ExecContext(ctx,
+		insertTransferSQL,
+		transfer.ID,
+		transfer.FromWalletID,
+		transfer.ToWalletID,
+		transfer.Amount,
+		transfer.ReferenceID,
+		transfer.WithdrawalID,
+		transfer.DepositID,
+		transfer.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "applyTransfer ExecContext", err)
+	}
+
+	return
+}
+
+// TransferMoney -> move amount from the wallet of userID to the wallet of toUserID.
+// Both wallets must be enabled, referenceID is unique across transfers.
+func TransferMoney(ctx context.Context, userID, toUserID, referenceID string, amount int) (transfer Transfer, err error) {
+	ctx = withOperation(ctx, "transfer")
+	ctx, span := startSpan(ctx, "TransferMoney", spanKindInternal)
+	span.setAttribute("amount", amount)
+	defer func() {
+		observeWalletResult("transfer", amount, err)
+		span.finish(err)
+	}()
+
+	if toUserID == userID {
+		err = errTransferToSelf
+		return
+	}
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	recipient, err := getWalletByUserID(ctx, database, toUserID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "TransferMoney getWalletByUserID", err)
+		return
+	}
+	err = nil
+
+	if recipient.ID == "" || recipient.Status == statusInactive {
+		err = errRecipientUnavailable
+		return
+	}
+
+	// transfers and their fees are paid from the main pocket
+	main, err := pocketOf(ctx, wallet, "")
+	if err != nil {
+		return
+	}
+
+	fee, err := quoteFee(ctx, wallet, feeTransactionTransfer, amount, time.Now())
+	if err != nil {
+		return
+	}
+
+	if amount+fee.Amount > main.Balance {
+		err = errInsufficientFunds
+		return
+	}
+
+	transfer, err = getTransferByReferenceID(ctx, database, referenceID)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = nil
+
+	if transfer.ID != "" {
+		err = errDuplicateReference
+		return
+	}
+
+	transfer = Transfer{
+		ID:           generateUUID(),
+		FromWalletID: wallet.ID,
+		ToWalletID:   recipient.ID,
+		ToUserID:     toUserID,
+		Amount:       amount,
+		ReferenceID:  referenceID,
+		Fee:          fee,
+	}
+
+	err = insertTransfer(ctx, database, &transfer)
+	if err != nil {
+		if err != errInsufficientFunds {
+			logError(ctx, "TransferMoney insertTransfer", err)
+		}
+		return
+	}
+
+	return
+}
+
+// HandleTransfer -> Send virtual money from my wallet to the wallet of another user
+func HandleTransfer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	var req RequestTransfer
+	if !bindRequest(w, r, &req, &response) {
+		observeWalletFailure("transfer", "invalid_input")
+		return
+	}
+
+	if req.ToUserID == uID {
+		observeWalletFailure("transfer", "invalid_input")
+		writeValidationError(w, r, &response, validationErrors{"to_user_id": {errTransferToSelf.Message + "."}})
+		return
+	}
+
+	transfer, err := TransferMoney(r.Context(), uID, req.ToUserID, req.ReferenceID, req.Amount)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseTransfer{
+		Transfer: transferResponse(uID, transfer),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func transferResponse(userID string, transfer Transfer) ResponseTransferDetail {
+	return ResponseTransferDetail{
+		ID:            transfer.ID,
+		TransferredBy: userID,
+		ToUserID:      transfer.ToUserID,
+		Status:        statusSuccess,
+		TransferredAt: transfer.CreateTime,
+		Amount:        transfer.Amount,
+		ReferenceID:   transfer.ReferenceID,
+		WithdrawalID:  transfer.WithdrawalID,
+		DepositID:     transfer.DepositID,
+
+		Fee:              transfer.Fee.Amount,
+		FeeTransactionID: transfer.Fee.FeeTransactionID,
+	}
+}
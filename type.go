@@ -10,18 +10,312 @@ type Response struct {
 
 // ResponseError ...
 type ResponseError struct {
-	Error string `json:"error,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
-// ResponseInitAccount ...
-type ResponseInitAccount struct {
-	Token string                    `json:"token,omitempty"`
-	Error *ResponseInitAccountError `json:"error,omitempty"`
+// ResponseValidationError ...
+type ResponseValidationError struct {
+	Error     validationErrors `json:"error"`
+	Code      string           `json:"code,omitempty"`
+	RequestID string           `json:"request_id,omitempty"`
+}
+
+// RequestInitAccount ...
+type RequestInitAccount struct {
+	CustomerXID string `json:"customer_xid" validate:"required"`
+}
+
+// RequestBalanceChange ...
+type RequestBalanceChange struct {
+	Amount      int    `json:"amount" validate:"required,min=0"`
+	ReferenceID string `json:"reference_id" validate:"required"`
+	PocketID    string `json:"pocket_id"`
+}
+
+// RequestTransfer ...
+type RequestTransfer struct {
+	ToUserID    string `json:"to_user_id" validate:"required"`
+	Amount      int    `json:"amount" validate:"required,min=1"`
+	ReferenceID string `json:"reference_id" validate:"required"`
+}
+
+// RequestSchedule ...
+type RequestSchedule struct {
+	Kind                string `json:"kind" validate:"required"`
+	ToUserID            string `json:"to_user_id"`
+	Amount              int    `json:"amount" validate:"required,min=1"`
+	Cron                string `json:"cron"`
+	Interval            string `json:"interval"`
+	StartAt             string `json:"start_at"`
+	OnInsufficientFunds string `json:"on_insufficient_funds"`
+	RetryInterval       string `json:"retry_interval"`
+	MaxRetries          int    `json:"max_retries" validate:"min=1"`
+}
+
+// RequestPocket ...
+type RequestPocket struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// RequestPocketMove ...
+type RequestPocketMove struct {
+	FromPocketID string `json:"from_pocket_id" validate:"required"`
+	ToPocketID   string `json:"to_pocket_id" validate:"required"`
+	Amount       int    `json:"amount" validate:"required,min=1"`
+}
+
+// RequestGoal ...
+type RequestGoal struct {
+	Name           string `json:"name" validate:"required"`
+	TargetAmount   int    `json:"target_amount" validate:"required,min=1"`
+	TargetDate     string `json:"target_date" validate:"required"`
+	RoundUpUnit    int    `json:"round_up_unit" validate:"min=0"`
+	DepositPercent int    `json:"deposit_percent" validate:"min=0"`
+}
+
+// RequestGoalRules ...
+type RequestGoalRules struct {
+	RoundUpUnit    int `json:"round_up_unit" validate:"min=0"`
+	DepositPercent int `json:"deposit_percent" validate:"min=0"`
+}
+
+// RequestInterestRate ...
+type RequestInterestRate struct {
+	Tiers    string `json:"tiers" validate:"required"`
+	DayCount string `json:"day_count"`
+	Rounding string `json:"rounding"`
+}
+
+// RequestInterestRun ...
+type RequestInterestRun struct {
+	From    string `json:"from"`
+	Through string `json:"through"`
+}
+
+// RequestFeeSchedule ...
+type RequestFeeSchedule struct {
+	Name            string `json:"name" validate:"required"`
+	TransactionType string `json:"transaction_type" validate:"required"`
+	KYCTier         string `json:"kyc_tier"`
+	Currency        string `json:"currency"`
+	Kind            string `json:"kind" validate:"required"`
+	FlatAmount      int    `json:"flat_amount" validate:"min=0"`
+	PercentBps      int    `json:"percent_bps" validate:"min=0"`
+	Tiers           string `json:"tiers"`
+	MinFee          int    `json:"min_fee" validate:"min=0"`
+	MaxFee          int    `json:"max_fee" validate:"min=0"`
+	EffectiveFrom   string `json:"effective_from" validate:"required"`
+	EffectiveTo     string `json:"effective_to"`
+}
+
+// RequestFeeQuote ...
+type RequestFeeQuote struct {
+	TransactionType string `json:"transaction_type" validate:"required"`
+	Amount          int    `json:"amount" validate:"required,min=1"`
+}
+
+// RequestVoucherCampaign ...
+type RequestVoucherCampaign struct {
+	Name       string `json:"name" validate:"required"`
+	Amount     int    `json:"amount" validate:"required,min=1"`
+	Count      int    `json:"count" validate:"required,min=1"`
+	ExpiresAt  string `json:"expires_at" validate:"required"`
+	PerUserCap int    `json:"per_user_cap" validate:"min=0"`
+	Budget     int    `json:"budget" validate:"min=0"`
+	CreditDays int    `json:"credit_days" validate:"min=0"`
+}
+
+// RequestCredit ...
+type RequestCredit struct {
+	Source    string `json:"source" validate:"required"`
+	Amount    int    `json:"amount" validate:"required,min=1"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// RequestMerchant ...
+type RequestMerchant struct {
+	Name       string `json:"name" validate:"required"`
+	Category   string `json:"category"`
+	WebhookURL string `json:"webhook_url"`
+	FeeBps     int    `json:"fee_bps" validate:"min=0"`
+	FeeFlat    int    `json:"fee_flat" validate:"min=0"`
+}
+
+// RequestPayment ...
+type RequestPayment struct {
+	Amount      int    `json:"amount" validate:"required,min=1"`
+	OrderID     string `json:"order_id" validate:"required"`
+	Description string `json:"description"`
+	CustomerID  string `json:"customer_id"`
+	ExpiresAt   string `json:"expires_at"`
 }
 
-// ResponseInitAccountError ...
-type ResponseInitAccountError struct {
-	CustomerXID []string `json:"customer_xid,omitempty"`
+// RequestListPayments ...
+type RequestListPayments struct {
+	OrderID string `json:"order_id"`
+	Limit   int    `json:"limit" validate:"min=1"`
+}
+
+// RequestRefund ...
+type RequestRefund struct {
+	Amount int    `json:"amount" validate:"required,min=1"`
+	Reason string `json:"reason"`
+}
+
+// RequestPaymentRequest ...
+type RequestPaymentRequest struct {
+	Payers      string `json:"payers" validate:"required"`
+	Description string `json:"description"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// RequestListPaymentRequests ...
+type RequestListPaymentRequests struct {
+	Role  string `json:"role"`
+	Limit int    `json:"limit" validate:"min=1"`
+}
+
+// RequestEscrow ...
+type RequestEscrow struct {
+	SellerID    string `json:"seller_id" validate:"required"`
+	Amount      int    `json:"amount" validate:"required,min=1"`
+	Description string `json:"description"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// RequestListEscrows ...
+type RequestListEscrows struct {
+	Role  string `json:"role"`
+	Limit int    `json:"limit" validate:"min=1"`
+}
+
+// RequestEscrowNote -> the optional note of a release or refund, the reason of a dispute
+type RequestEscrowNote struct {
+	Note string `json:"note"`
+}
+
+// RequestAdminEscrows ...
+type RequestAdminEscrows struct {
+	Status string `json:"status"`
+	Limit  int    `json:"limit" validate:"min=1"`
+}
+
+// RequestResolveEscrow ...
+type RequestResolveEscrow struct {
+	Outcome string `json:"outcome" validate:"required"`
+	Note    string `json:"note" validate:"required"`
+}
+
+// RequestDispute ...
+type RequestDispute struct {
+	TransactionID string `json:"transaction_id" validate:"required"`
+	Amount        int    `json:"amount" validate:"min=1"`
+	Reason        string `json:"reason" validate:"required"`
+	Evidence      string `json:"evidence"`
+}
+
+// RequestListDisputes ...
+type RequestListDisputes struct {
+	Limit int `json:"limit" validate:"min=1"`
+}
+
+// RequestDisputeNote ...
+type RequestDisputeNote struct {
+	Note string `json:"note"`
+}
+
+// RequestAdminDisputes ...
+type RequestAdminDisputes struct {
+	Status  string `json:"status"`
+	Overdue bool   `json:"overdue"`
+	Limit   int    `json:"limit" validate:"min=1"`
+}
+
+// RequestMoveDispute ...
+type RequestMoveDispute struct {
+	Status string `json:"status" validate:"required"`
+	Note   string `json:"note"`
+}
+
+// RequestAdminDisputeNote ...
+type RequestAdminDisputeNote struct {
+	Note     string `json:"note" validate:"required"`
+	Internal bool   `json:"internal"`
+}
+
+// RequestRedeemVoucher ...
+type RequestRedeemVoucher struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// RequestWithdrawal ...
+type RequestWithdrawal struct {
+	Amount           int    `json:"amount" validate:"required,min=0"`
+	ReferenceID      string `json:"reference_id" validate:"required"`
+	PocketID         string `json:"pocket_id"`
+	MerchantCategory string `json:"merchant_category"`
+}
+
+// RequestRedeemPoints ...
+type RequestRedeemPoints struct {
+	Points int `json:"points" validate:"required,min=1"`
+}
+
+// RequestPointsProgram ...
+type RequestPointsProgram struct {
+	ExpiryDays int `json:"expiry_days" validate:"required,min=1"`
+	PointValue int `json:"point_value" validate:"required,min=1"`
+}
+
+// RequestPointsRule ...
+type RequestPointsRule struct {
+	SpendPerPoint int `json:"spend_per_point" validate:"required,min=1"`
+	MultiplierPct int `json:"multiplier_pct" validate:"min=0"`
+}
+
+// RequestReverseTransaction ...
+type RequestReverseTransaction struct {
+	Reason string `json:"reason"`
+}
+
+// RequestRateLimit ...
+type RequestRateLimit struct {
+	Group string  `json:"group" validate:"required"`
+	Rate  float64 `json:"rate" validate:"required,min=0"`
+	Burst int     `json:"burst" validate:"required,min=1"`
+}
+
+// RequestRateLimitGroup ...
+type RequestRateLimitGroup struct {
+	Group string `json:"group" validate:"required"`
+}
+
+// RequestListTransactions ...
+type RequestListTransactions struct {
+	Limit int `json:"limit" validate:"min=1"`
+}
+
+// RequestStatement ...
+type RequestStatement struct {
+	Month  string `json:"month" validate:"required"`
+	Format string `json:"format"`
+}
+
+// RequestWatch -> a client message on the watch websocket
+type RequestWatch struct {
+	Type      string           `json:"type"`
+	ID        string           `json:"id"`
+	WalletIDs []string         `json:"wallet_ids"`
+	After     map[string]int64 `json:"after"`
+	WalletID  string           `json:"wallet_id"`
+	Sequence  int64            `json:"sequence"`
+}
+
+// ResponseInitAccount ...
+type ResponseInitAccount struct {
+	Token string `json:"token,omitempty"`
 }
 
 // ResponseWallet ...
@@ -37,6 +331,28 @@ type ResponseWalletDetail struct {
 	EnabledAt  *time.Time `json:"enabled_at,omitempty"`
 	DisabledAt *time.Time `json:"disabled_at,omitempty"`
 	Balance    int        `json:"balance"`
+
+	// Pockets -> breakdown of the balance, only when viewing the balance
+	Pockets []ResponsePocketDetail `json:"pockets,omitempty"`
+
+	// Buckets -> the balance by source and expiry, only when viewing the balance
+	Buckets []ResponseBucketDetail `json:"buckets,omitempty"`
+}
+
+// ResponseBucketDetail ...
+type ResponseBucketDetail struct {
+	ID            string     `json:"id,omitempty"`
+	Source        string     `json:"source"`
+	Amount        int        `json:"amount"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+}
+
+// ResponseCredit ...
+type ResponseCredit struct {
+	Deposit ResponseDepositDetail `json:"deposit"`
+	Type    string                `json:"type"`
+	Bucket  ResponseBucketDetail  `json:"bucket"`
 }
 
 // ResponseDeposit ...
@@ -67,4 +383,737 @@ type ResponseWithdrawalDetail struct {
 	WithdrawnAt time.Time `json:"withdrawn_at,omitempty"`
 	Amount      int       `json:"amount,omitempty"`
 	ReferenceID string    `json:"reference_id,omitempty"`
+	// Fee -> debited on top of Amount as the transaction FeeTransactionID
+	Fee              int    `json:"fee"`
+	FeeTransactionID string `json:"fee_transaction_id,omitempty"`
+}
+
+// ResponseTransfer ...
+type ResponseTransfer struct {
+	Transfer ResponseTransferDetail `json:"transfer"`
+}
+
+// ResponseTransferDetail ...
+type ResponseTransferDetail struct {
+	ID            string    `json:"id"`
+	TransferredBy string    `json:"transferred_by"`
+	ToUserID      string    `json:"to_user_id"`
+	Status        string    `json:"status"`
+	TransferredAt time.Time `json:"transferred_at"`
+	Amount        int       `json:"amount"`
+	ReferenceID   string    `json:"reference_id"`
+	WithdrawalID  string    `json:"withdrawal_id"`
+	DepositID     string    `json:"deposit_id"`
+	// Fee -> paid by the sender on top of Amount as the transaction FeeTransactionID
+	Fee              int    `json:"fee"`
+	FeeTransactionID string `json:"fee_transaction_id,omitempty"`
+}
+
+// ResponseSchedules ...
+type ResponseSchedules struct {
+	Schedules []ResponseScheduleDetail `json:"schedules"`
+}
+
+// ResponseSchedule ...
+type ResponseSchedule struct {
+	Schedule ResponseScheduleDetail `json:"schedule"`
+}
+
+// ResponseScheduleDetail ...
+type ResponseScheduleDetail struct {
+	ID                  string                `json:"id"`
+	Kind                string                `json:"kind"`
+	ToUserID            string                `json:"to_user_id,omitempty"`
+	Amount              int                   `json:"amount"`
+	Cron                string                `json:"cron,omitempty"`
+	Interval            string                `json:"interval,omitempty"`
+	StartAt             time.Time             `json:"start_at"`
+	OnInsufficientFunds string                `json:"on_insufficient_funds"`
+	RetryInterval       string                `json:"retry_interval"`
+	MaxRetries          int                   `json:"max_retries"`
+	Status              string                `json:"status"`
+	Attempt             int                   `json:"attempt"`
+	NextRunAt           *time.Time            `json:"next_run_at,omitempty"`
+	CreatedAt           time.Time             `json:"created_at"`
+	UpdatedAt           time.Time             `json:"updated_at"`
+	Runs                []ResponseScheduleRun `json:"runs,omitempty"`
+}
+
+// ResponseScheduleRun ...
+type ResponseScheduleRun struct {
+	ID            string    `json:"id"`
+	DueAt         time.Time `json:"due_at"`
+	RanAt         time.Time `json:"ran_at"`
+	Attempt       int       `json:"attempt"`
+	Status        string    `json:"status"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// ResponsePockets ...
+type ResponsePockets struct {
+	Pockets []ResponsePocketDetail `json:"pockets"`
+}
+
+// ResponsePocket ...
+type ResponsePocket struct {
+	Pocket ResponsePocketDetail `json:"pocket"`
+}
+
+// ResponsePocketDetail ...
+type ResponsePocketDetail struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Main      bool      `json:"main"`
+	Balance   int       `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ResponsePocketMove ...
+type ResponsePocketMove struct {
+	Amount int                  `json:"amount"`
+	From   ResponsePocketDetail `json:"from"`
+	To     ResponsePocketDetail `json:"to"`
+}
+
+// ResponsePocketTransactions ...
+type ResponsePocketTransactions struct {
+	Pocket       ResponsePocketDetail        `json:"pocket"`
+	Transactions []ResponsePocketTransaction `json:"transactions"`
+}
+
+// ResponsePocketTransaction ...
+type ResponsePocketTransaction struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	OtherPocketID string    `json:"other_pocket_id,omitempty"`
+	ReferenceID   string    `json:"reference_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ResponseGoals ...
+type ResponseGoals struct {
+	Goals []ResponseGoalDetail `json:"goals"`
+}
+
+// ResponseGoal ...
+type ResponseGoal struct {
+	Goal ResponseGoalDetail `json:"goal"`
+}
+
+// ResponseGoalDetail ...
+type ResponseGoalDetail struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	PocketID        string    `json:"pocket_id"`
+	TargetAmount    int       `json:"target_amount"`
+	TargetDate      string    `json:"target_date"`
+	RoundUpUnit     int       `json:"round_up_unit"`
+	DepositPercent  int       `json:"deposit_percent"`
+	Status          string    `json:"status"`
+	Saved           int       `json:"saved"`
+	Remaining       int       `json:"remaining"`
+	ProgressPercent int       `json:"progress_percent"`
+	Reached         bool      `json:"reached"`
+	OnTrack         bool      `json:"on_track"`
+	RequiredPerDay  int       `json:"required_per_day"`
+	ProjectedDate   string    `json:"projected_date,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ResponseGoalHistory ...
+type ResponseGoalHistory struct {
+	GoalID  string                     `json:"goal_id"`
+	History []ResponseGoalHistoryEntry `json:"history"`
+}
+
+// ResponseGoalHistoryEntry ...
+type ResponseGoalHistoryEntry struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Rule          string    `json:"rule,omitempty"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	OtherPocketID string    `json:"other_pocket_id,omitempty"`
+	ReferenceID   string    `json:"reference_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ResponseInterest ...
+type ResponseInterest struct {
+	Accrued        string                    `json:"accrued"`
+	AccruedThrough string                    `json:"accrued_through,omitempty"`
+	Postings       []ResponseInterestPosting `json:"postings"`
+	Accruals       []ResponseInterestAccrual `json:"accruals"`
+}
+
+// ResponseInterestPosting ...
+type ResponseInterestPosting struct {
+	Month         string    `json:"month"`
+	Amount        int       `json:"amount"`
+	Due           string    `json:"due"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	PostedAt      time.Time `json:"posted_at"`
+}
+
+// ResponseInterestAccrual ...
+type ResponseInterestAccrual struct {
+	Day      string `json:"day"`
+	Balance  int    `json:"balance"`
+	RateFrom string `json:"rate_from"`
+	Interest string `json:"interest"`
+}
+
+// ResponseInterestRates ...
+type ResponseInterestRates struct {
+	AccruedThrough  string                 `json:"accrued_through,omitempty"`
+	RecalculateFrom string                 `json:"recalculate_from,omitempty"`
+	Rates           []ResponseInterestRate `json:"rates"`
+}
+
+// ResponseInterestRate ...
+type ResponseInterestRate struct {
+	EffectiveFrom string             `json:"effective_from"`
+	DayCount      string             `json:"day_count"`
+	Rounding      string             `json:"rounding"`
+	Tiers         []ResponseRateTier `json:"tiers"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// ResponseRateTier ...
+type ResponseRateTier struct {
+	From    int `json:"from"`
+	RateBps int `json:"rate_bps"`
+}
+
+// ResponseInterestRateSet ...
+type ResponseInterestRateSet struct {
+	Rate            ResponseInterestRate `json:"rate"`
+	RecalculateFrom string               `json:"recalculate_from,omitempty"`
+}
+
+// ResponseInterestRun ...
+type ResponseInterestRun struct {
+	From     string `json:"from"`
+	Through  string `json:"through"`
+	Accruals int    `json:"accruals"`
+	Postings int    `json:"postings"`
+	Posted   int    `json:"posted"`
+}
+
+// ResponseFeeQuote ...
+type ResponseFeeQuote struct {
+	TransactionType string `json:"transaction_type"`
+	Amount          int    `json:"amount"`
+	Fee             int    `json:"fee"`
+	Total           int    `json:"total"`
+	FeeScheduleID   string `json:"fee_schedule_id,omitempty"`
+	KYCTier         string `json:"kyc_tier"`
+	Currency        string `json:"currency"`
+}
+
+// ResponseFeeSchedules ...
+type ResponseFeeSchedules struct {
+	FeeSchedules []ResponseFeeScheduleDetail `json:"fee_schedules"`
+}
+
+// ResponseFeeSchedule ...
+type ResponseFeeSchedule struct {
+	FeeSchedule ResponseFeeScheduleDetail `json:"fee_schedule"`
+}
+
+// ResponseFeeScheduleDetail ...
+type ResponseFeeScheduleDetail struct {
+	ID              string             `json:"id"`
+	Name            string             `json:"name"`
+	TransactionType string             `json:"transaction_type"`
+	KYCTier         string             `json:"kyc_tier,omitempty"`
+	Currency        string             `json:"currency,omitempty"`
+	Kind            string             `json:"kind"`
+	FlatAmount      int                `json:"flat_amount"`
+	PercentBps      int                `json:"percent_bps"`
+	Tiers           []ResponseRateTier `json:"tiers,omitempty"`
+	MinFee          int                `json:"min_fee"`
+	MaxFee          int                `json:"max_fee"`
+	EffectiveFrom   string             `json:"effective_from"`
+	EffectiveTo     string             `json:"effective_to,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+}
+
+// ResponseSystemAccounts ...
+type ResponseSystemAccounts struct {
+	Accounts []ResponseSystemAccount `json:"accounts"`
+}
+
+// ResponseSystemAccount ...
+type ResponseSystemAccount struct {
+	ID        string    `json:"id"`
+	Balance   int       `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ResponseVoucherCampaigns ...
+type ResponseVoucherCampaigns struct {
+	Campaigns []ResponseVoucherCampaignDetail `json:"campaigns"`
+}
+
+// ResponseVoucherCampaign ...
+type ResponseVoucherCampaign struct {
+	Campaign ResponseVoucherCampaignDetail `json:"campaign"`
+	Codes    []ResponseVoucher             `json:"codes"`
+}
+
+// ResponseVoucherCampaignDetail ...
+type ResponseVoucherCampaignDetail struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Amount     int       `json:"amount"`
+	PerUserCap int       `json:"per_user_cap"`
+	Budget     int       `json:"budget"`
+	Spent      int       `json:"spent"`
+	Remaining  int       `json:"remaining"`
+	Codes      int       `json:"codes"`
+	Redeemed   int       `json:"redeemed"`
+	CreditDays int       `json:"credit_days"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ResponseVoucher ...
+type ResponseVoucher struct {
+	Code          string     `json:"code"`
+	RedeemedBy    string     `json:"redeemed_by,omitempty"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+	RedeemedAt    *time.Time `json:"redeemed_at,omitempty"`
+}
+
+// ResponseVoucherRedemption ...
+type ResponseVoucherRedemption struct {
+	Deposit    ResponseDepositDetail `json:"deposit"`
+	Type       string                `json:"type"`
+	Code       string                `json:"code"`
+	CampaignID string                `json:"campaign_id"`
+	Bucket     ResponseBucketDetail  `json:"bucket"`
+}
+
+// ResponseMerchants ...
+type ResponseMerchants struct {
+	Merchants []ResponseMerchantDetail `json:"merchants"`
+}
+
+// ResponseMerchant -> APIKey and WebhookSecret are only shown when they are created, and the
+// secret to the merchant itself
+type ResponseMerchant struct {
+	Merchant      ResponseMerchantDetail `json:"merchant"`
+	APIKey        string                 `json:"api_key,omitempty"`
+	WebhookSecret string                 `json:"webhook_secret,omitempty"`
+}
+
+// ResponseMerchantDetail ...
+type ResponseMerchantDetail struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	Category   string                `json:"category,omitempty"`
+	WalletID   string                `json:"wallet_id"`
+	WebhookURL string                `json:"webhook_url,omitempty"`
+	FeeBps     int                   `json:"fee_bps"`
+	FeeFlat    int                   `json:"fee_flat"`
+	Balance    *int                  `json:"balance,omitempty"`
+	Keys       []ResponseMerchantKey `json:"keys,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	UpdatedAt  time.Time             `json:"updated_at"`
+}
+
+// ResponseMerchantKey ...
+type ResponseMerchantKey struct {
+	ID        string     `json:"id"`
+	Prefix    string     `json:"prefix"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ResponseMerchantKeyCreated ...
+type ResponseMerchantKeyCreated struct {
+	Key    ResponseMerchantKey `json:"key"`
+	APIKey string              `json:"api_key"`
+}
+
+// ResponsePayments ...
+type ResponsePayments struct {
+	Payments []ResponsePaymentDetail `json:"payments"`
+}
+
+// ResponsePayment ...
+type ResponsePayment struct {
+	Payment ResponsePaymentDetail `json:"payment"`
+}
+
+// ResponsePaymentDetail -> a payment as its merchant sees it
+type ResponsePaymentDetail struct {
+	ID                      string                 `json:"id"`
+	OrderID                 string                 `json:"order_id"`
+	Amount                  int                    `json:"amount"`
+	Fee                     int                    `json:"fee"`
+	Net                     int                    `json:"net"`
+	Description             string                 `json:"description,omitempty"`
+	CustomerID              string                 `json:"customer_id,omitempty"`
+	Status                  string                 `json:"status"`
+	Refunded                int                    `json:"refunded"`
+	PaidBy                  string                 `json:"paid_by,omitempty"`
+	SettlementTransactionID string                 `json:"settlement_transaction_id,omitempty"`
+	ExpiresAt               time.Time              `json:"expires_at"`
+	PaidAt                  *time.Time             `json:"paid_at,omitempty"`
+	CreatedAt               time.Time              `json:"created_at"`
+	Refunds                 []ResponseRefundDetail `json:"refunds,omitempty"`
+}
+
+// ResponseWalletPayment ...
+type ResponseWalletPayment struct {
+	Payment ResponseWalletPaymentDetail `json:"payment"`
+}
+
+// ResponseWalletPaymentDetail -> a payment as the customer sees it
+type ResponseWalletPaymentDetail struct {
+	ID            string     `json:"id"`
+	MerchantID    string     `json:"merchant_id"`
+	MerchantName  string     `json:"merchant_name"`
+	OrderID       string     `json:"order_id"`
+	Amount        int        `json:"amount"`
+	Description   string     `json:"description,omitempty"`
+	Status        string     `json:"status"`
+	Refunded      int        `json:"refunded"`
+	TransactionID string     `json:"transaction_id,omitempty"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ResponseRefund ...
+type ResponseRefund struct {
+	Refund  ResponseRefundDetail  `json:"refund"`
+	Payment ResponsePaymentDetail `json:"payment"`
+}
+
+// ResponseRefundDetail ...
+type ResponseRefundDetail struct {
+	ID                  string    `json:"id"`
+	Amount              int       `json:"amount"`
+	Reason              string    `json:"reason,omitempty"`
+	TransactionID       string    `json:"transaction_id"`
+	RefundTransactionID string    `json:"refund_transaction_id"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// ResponseWebhooks ...
+type ResponseWebhooks struct {
+	Webhooks []ResponseWebhookDetail `json:"webhooks"`
+}
+
+// ResponseWebhookDetail ...
+type ResponseWebhookDetail struct {
+	ID            string     `json:"id"`
+	Event         string     `json:"event"`
+	PaymentID     string     `json:"payment_id"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ResponsePoints ...
+type ResponsePoints struct {
+	Balance      int                   `json:"balance"`
+	Value        int                   `json:"value"`
+	NextExpiring *ResponsePointsExpiry `json:"next_expiring,omitempty"`
+	Entries      []ResponsePointsEntry `json:"entries"`
+}
+
+// ResponsePointsExpiry ...
+type ResponsePointsExpiry struct {
+	Points    int       `json:"points"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ResponsePointsEntry ...
+type ResponsePointsEntry struct {
+	ID            string    `json:"id"`
+	Kind          string    `json:"kind"`
+	Points        int       `json:"points"`
+	Balance       int       `json:"balance"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ResponsePointsRedemption ...
+type ResponsePointsRedemption struct {
+	Deposit       ResponseDepositDetail `json:"deposit"`
+	Type          string                `json:"type"`
+	Points        int                   `json:"points"`
+	PointsBalance int                   `json:"points_balance"`
+}
+
+// ResponsePointsSettings ...
+type ResponsePointsSettings struct {
+	Program ResponsePointsProgram `json:"program"`
+	Rules   []ResponsePointsRule  `json:"rules"`
+}
+
+// ResponsePointsProgramSet ...
+type ResponsePointsProgramSet struct {
+	Program ResponsePointsProgram `json:"program"`
+}
+
+// ResponsePointsProgram ...
+type ResponsePointsProgram struct {
+	ExpiryDays int        `json:"expiry_days"`
+	PointValue int        `json:"point_value"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// ResponsePointsRuleSet ...
+type ResponsePointsRuleSet struct {
+	Rule ResponsePointsRule `json:"rule"`
+}
+
+// ResponsePointsRule ...
+type ResponsePointsRule struct {
+	Category      string    `json:"category"`
+	SpendPerPoint int       `json:"spend_per_point"`
+	MultiplierPct int       `json:"multiplier_pct"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ResponseReversal ...
+type ResponseReversal struct {
+	Reversal ResponseReversalDetail `json:"reversal"`
+}
+
+// ResponseReversalDetail ...
+type ResponseReversalDetail struct {
+	TransactionID         string    `json:"transaction_id"`
+	ReversalTransactionID string    `json:"reversal_transaction_id"`
+	Amount                int       `json:"amount"`
+	PointsReversed        int       `json:"points_reversed"`
+	Reason                string    `json:"reason,omitempty"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// ResponseSystemEntries ...
+type ResponseSystemEntries struct {
+	Account ResponseSystemAccount `json:"account"`
+	Entries []ResponseSystemEntry `json:"entries"`
+}
+
+// ResponseSystemEntry ...
+type ResponseSystemEntry struct {
+	ID            string    `json:"id"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+	WalletID      string    `json:"wallet_id"`
+	TransactionID string    `json:"transaction_id"`
+	ReferenceID   string    `json:"reference_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ResponseTransactions ...
+type ResponseTransactions struct {
+	Transactions []ResponseTransactionDetail `json:"transactions"`
+}
+
+// ResponseTransactionDetail ...
+type ResponseTransactionDetail struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Amount      int       `json:"amount"`
+	ReferenceID string    `json:"reference_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ResponseWalletEvent ...
+type ResponseWalletEvent struct {
+	Sequence    int64                      `json:"sequence"`
+	Type        string                     `json:"type"`
+	WalletID    string                     `json:"wallet_id"`
+	Status      string                     `json:"status"`
+	Balance     int                        `json:"balance"`
+	Transaction *ResponseTransactionDetail `json:"transaction,omitempty"`
+	Time        time.Time                  `json:"time"`
+}
+
+// ResponseWatchMessage -> a server message on the watch websocket
+type ResponseWatchMessage struct {
+	Type      string               `json:"type"`
+	ID        string               `json:"id,omitempty"`
+	WalletIDs []string             `json:"wallet_ids,omitempty"`
+	Event     *ResponseWalletEvent `json:"event,omitempty"`
+	Error     *ResponseError       `json:"error,omitempty"`
+}
+
+// ResponseWalletWatchers ...
+type ResponseWalletWatchers struct {
+	WalletID string                  `json:"wallet_id"`
+	Watchers []ResponseWalletWatcher `json:"watchers"`
+}
+
+// ResponseWalletWatcher ...
+type ResponseWalletWatcher struct {
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ResponseRateLimits ...
+type ResponseRateLimits struct {
+	UserID string              `json:"user_id"`
+	Limits []ResponseRateLimit `json:"limits"`
+}
+
+// ResponseRateLimit ...
+type ResponseRateLimit struct {
+	Group    string  `json:"group"`
+	Rate     float64 `json:"rate"`
+	Burst    int     `json:"burst"`
+	Override bool    `json:"override"`
+}
+
+// ResponseBatch ...
+type ResponseBatch struct {
+	ID        string               `json:"id"`
+	Status    string               `json:"status"`
+	Rows      int                  `json:"rows"`
+	Counts    map[string]int       `json:"counts"`
+	Errors    []ResponseBatchError `json:"errors"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// ResponseBatchError ...
+type ResponseBatchError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ResponsePaymentRequests ...
+type ResponsePaymentRequests struct {
+	Requests []ResponsePaymentRequestDetail `json:"requests"`
+}
+
+// ResponsePaymentRequest ...
+type ResponsePaymentRequest struct {
+	Request ResponsePaymentRequestDetail `json:"request"`
+}
+
+// ResponsePaymentRequestAccepted ...
+type ResponsePaymentRequestAccepted struct {
+	Request  ResponsePaymentRequestDetail `json:"request"`
+	Transfer ResponseTransferDetail       `json:"transfer"`
+}
+
+// ResponsePaymentRequestDetail -> a payment request, Paid sums the paid shares listed
+type ResponsePaymentRequestDetail struct {
+	ID          string                        `json:"id"`
+	RequestedBy string                        `json:"requested_by"`
+	Description string                        `json:"description,omitempty"`
+	Amount      int                           `json:"amount"`
+	Paid        int                           `json:"paid"`
+	Status      string                        `json:"status"`
+	ExpiresAt   time.Time                     `json:"expires_at"`
+	CreatedAt   time.Time                     `json:"created_at"`
+	Shares      []ResponsePaymentRequestShare `json:"shares"`
+}
+
+// ResponsePaymentRequestShare ...
+type ResponsePaymentRequestShare struct {
+	PayerID    string     `json:"payer_id"`
+	Amount     int        `json:"amount"`
+	Status     string     `json:"status"`
+	TransferID string     `json:"transfer_id,omitempty"`
+	AnsweredAt *time.Time `json:"answered_at,omitempty"`
+}
+
+// ResponseEscrows ...
+type ResponseEscrows struct {
+	Escrows []ResponseEscrowDetail `json:"escrows"`
+}
+
+// ResponseEscrow ...
+type ResponseEscrow struct {
+	Escrow ResponseEscrowDetail `json:"escrow"`
+}
+
+// ResponseEscrowDetail -> an escrow, Events only when a single escrow is read
+type ResponseEscrowDetail struct {
+	ID                  string                `json:"id"`
+	BuyerID             string                `json:"buyer_id"`
+	SellerID            string                `json:"seller_id"`
+	Amount              int                   `json:"amount"`
+	Description         string                `json:"description,omitempty"`
+	Status              string                `json:"status"`
+	FundTransactionID   string                `json:"fund_transaction_id"`
+	SettleTransactionID string                `json:"settle_transaction_id,omitempty"`
+	ExpiresAt           time.Time             `json:"expires_at"`
+	CreatedAt           time.Time             `json:"created_at"`
+	UpdatedAt           time.Time             `json:"updated_at"`
+	Events              []ResponseEscrowEvent `json:"events,omitempty"`
+}
+
+// ResponseEscrowEvent ...
+type ResponseEscrowEvent struct {
+	Type          string    `json:"type"`
+	Actor         string    `json:"actor"`
+	ActorID       string    `json:"actor_id,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ResponseDisputes ...
+type ResponseDisputes struct {
+	Disputes []ResponseDisputeDetail `json:"disputes"`
+}
+
+// ResponseDispute ...
+type ResponseDispute struct {
+	Dispute ResponseDisputeDetail `json:"dispute"`
+}
+
+// ResponseDisputeDetail -> a dispute, DueAt until it is resolved and Notes only when a single
+// dispute is read
+type ResponseDisputeDetail struct {
+	ID                       string                `json:"id"`
+	UserID                   string                `json:"user_id"`
+	WalletID                 string                `json:"wallet_id"`
+	TransactionID            string                `json:"transaction_id"`
+	Amount                   int                   `json:"amount"`
+	Reason                   string                `json:"reason"`
+	Evidence                 string                `json:"evidence,omitempty"`
+	Status                   string                `json:"status"`
+	DueAt                    *time.Time            `json:"due_at,omitempty"`
+	Overdue                  bool                  `json:"overdue"`
+	ProvisionalTransactionID string                `json:"provisional_transaction_id,omitempty"`
+	CreditTransactionID      string                `json:"credit_transaction_id,omitempty"`
+	ReversalTransactionID    string                `json:"reversal_transaction_id,omitempty"`
+	Uncollected              int                   `json:"uncollected"`
+	CreatedAt                time.Time             `json:"created_at"`
+	UpdatedAt                time.Time             `json:"updated_at"`
+	ResolvedAt               *time.Time            `json:"resolved_at,omitempty"`
+	Notes                    []ResponseDisputeNote `json:"notes,omitempty"`
+}
+
+// ResponseDisputeNote ...
+type ResponseDisputeNote struct {
+	Author        string    `json:"author"`
+	AuthorID      string    `json:"author_id,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	Internal      bool      `json:"internal"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
 }
@@ -1,26 +1,36 @@
 package main
 
 import (
+	"context"
 	"crypto/sha1"
 	"database/sql"
-	"errors"
 	"fmt"
-	"log"
+	"time"
 )
 
 // InitAccount ...
-func InitAccount(userID string) (sessionID string, err error) {
-	err = insertUser(database, userID)
+func InitAccount(ctx context.Context, userID string) (sessionID string, err error) {
+	ctx = withOperation(ctx, "init_account")
+	ctx, span := startSpan(ctx, "InitAccount", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	err = insertUser(ctx, database, userID)
+	if isUniqueViolation(err) {
+		err = errAccountExists
+		return
+	}
 	if err != nil {
-		log.Println("Error InitAccount insertUser: " + err.Error())
+		logError(ctx, "InitAccount insertUser", err)
 		return
 	}
 
 	sessionID = generateSessionID(userID)
 
-	err = createSession(database, userID, sessionID)
+	err = createSession(ctx, database, userID, sessionID)
 	if err != nil {
-		log.Println("Error InitAccount createSession: " + err.Error())
+		logError(ctx, "InitAccount createSession", err)
 		return
 	}
 
@@ -28,161 +38,251 @@ func InitAccount(userID string) (sessionID string, err error) {
 }
 
 // EnableWallet ...
-func EnableWallet(userID string) (status bool, wallet Wallet, err error) {
-	wallet, err = getWalletByUserID(database, userID)
+func EnableWallet(ctx context.Context, userID string) (wallet Wallet, err error) {
+	ctx = withOperation(ctx, "enable_wallet")
+	ctx, span := startSpan(ctx, "EnableWallet", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err = getWalletByUserID(ctx, database, userID)
+	setWalletID(ctx, wallet.ID)
 	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error EnableWallet getWalletByUserID: " + err.Error())
+		logError(ctx, "EnableWallet getWalletByUserID", err)
 		return
 	}
 	err = nil
 
 	if wallet.ID == "" {
-		wallet, err = createWallet(database, userID, defaultBalance)
+		wallet, err = createWallet(ctx, database, userID, defaultBalance)
+		setWalletID(ctx, wallet.ID)
 		if err != nil {
-			log.Println("Error EnableWallet createWallet: " + err.Error())
+			logError(ctx, "EnableWallet createWallet", err)
 			return
 		}
 	} else {
-		if wallet.Status == 1 {
-			log.Println("Info EnableWallet wallet already enabled")
+		if wallet.Status == statusActive {
+			err = errWalletAlreadyEnabled
 			return
 		}
 
-		err = updateWalletStatusByID(database, wallet.ID, statusActive)
+		wallet.EnableTime, err = updateWalletStatusByID(ctx, database, wallet.ID, statusActive)
 		if err != nil {
-			log.Println("Error EnableWallet updateWalletStatusByID: " + err.Error())
+			logError(ctx, "EnableWallet updateWalletStatusByID", err)
 			return
 		}
+		wallet.Status = statusActive
 	}
 
-	status = true
 	return
 }
 
-// ViewBalance ...
-func ViewBalance(userID string) (status bool, wallet Wallet, err error) {
-	return viewBalance(userID)
-}
+// ViewBalance -> the enabled wallet of a user with its pockets, main first, and its buckets
+func ViewBalance(ctx context.Context, userID string) (wallet Wallet, pockets []Pocket, buckets []BalanceBucket, err error) {
+	ctx = withOperation(ctx, "view_balance")
+	ctx, span := startSpan(ctx, "ViewBalance", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
 
-func viewBalance(userID string) (status bool, wallet Wallet, err error) {
-	wallet, err = getWalletByUserID(database, userID)
-	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error ViewBalance getWalletByUserID: " + err.Error())
+	wallet, err = viewBalance(ctx, userID)
+	if err != nil {
 		return
 	}
-	err = nil
 
-	if wallet.ID == "" || wallet.Status == 0 {
-		log.Println("Info wallet disabled")
+	pockets, err = getPockets(ctx, database, wallet.ID)
+	if err != nil {
 		return
 	}
 
-	status = true
+	buckets, err = getBalanceBuckets(ctx, database, wallet.ID)
 	return
 }
 
-// DisableWallet ...
-func DisableWallet(userID string) (status bool, wallet Wallet, err error) {
-	wallet, err = getWalletByUserID(database, userID)
+// viewBalance -> the enabled wallet of a user, errWalletDisabled otherwise
+func viewBalance(ctx context.Context, userID string) (wallet Wallet, err error) {
+	wallet, err = getWalletByUserID(ctx, database, userID)
+	setWalletID(ctx, wallet.ID)
 	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error DisableWallet getWalletByUserID: " + err.Error())
+		logError(ctx, "ViewBalance getWalletByUserID", err)
 		return
 	}
 	err = nil
 
-	if wallet.ID == "" {
-		log.Println("Wallet is disabled")
+	if wallet.ID == "" || wallet.Status == statusInactive {
+		err = errWalletDisabled
 		return
+	}
 
+	return
+}
+
+// DisableWallet ...
+func DisableWallet(ctx context.Context, userID string) (wallet Wallet, err error) {
+	ctx = withOperation(ctx, "disable_wallet")
+	ctx, span := startSpan(ctx, "DisableWallet", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err = getWalletByUserID(ctx, database, userID)
+	setWalletID(ctx, wallet.ID)
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "DisableWallet getWalletByUserID", err)
+		return
 	}
+	err = nil
 
-	if wallet.Status == 0 {
-		log.Println("Info DisableWallet wallet already enabled")
+	if wallet.ID == "" || wallet.Status == statusInactive {
+		err = errWalletAlreadyDisabled
 		return
 	}
 
-	err = updateWalletStatusByID(database, wallet.ID, statusInactive)
+	wallet.EnableTime, err = updateWalletStatusByID(ctx, database, wallet.ID, statusInactive)
 	if err != nil {
-		log.Println("Error DisableWallet updateWalletStatusByID: " + err.Error())
+		logError(ctx, "DisableWallet updateWalletStatusByID", err)
 		return
 	}
+	wallet.Status = statusInactive
 
-	status = true
 	return
 }
 
-// Deposit ...
-func Deposit(userID, referenceID string, amount int) (status bool, transaction WalletTransaction, err error) {
-	status, wallet, err := viewBalance(userID)
+// Deposit -> deposit to the main pocket
+func Deposit(ctx context.Context, userID, referenceID string, amount int) (transaction WalletTransaction, err error) {
+	return DepositToPocket(ctx, userID, "", referenceID, amount)
+}
+
+// DepositToPocket -> deposit to a pocket of the wallet, the main pocket when pocketID is empty
+func DepositToPocket(ctx context.Context, userID, pocketID, referenceID string, amount int) (transaction WalletTransaction, err error) {
+	ctx = withOperation(ctx, "deposit")
+	ctx, span := startSpan(ctx, "Deposit", spanKindInternal)
+	span.setAttribute("amount", amount)
+	defer func() {
+		observeWalletResult("deposit", amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
 	if err != nil {
-		log.Println("Error Deposit viewBalance: " + err.Error())
 		return
 	}
 
-	if !status {
+	pocket, err := pocketOf(ctx, wallet, pocketID)
+	if err != nil {
 		return
 	}
 
-	transaction, err = getTransactionByReferenceID(database, referenceID, depositType)
+	transaction, err = getTransactionByReferenceID(ctx, database, referenceID, depositType)
 	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error Deposit getTransactionByReferenceID: " + err.Error())
+		logError(ctx, "Deposit getTransactionByReferenceID", err)
 		return
 	}
 	err = nil
 
 	if transaction.ID != "" {
-		err = errors.New("Reference id must be unique")
+		err = errDuplicateReference
 		return
 	}
 
-	total := wallet.Balance + amount
-	transaction, err = updateBalance(database, wallet.ID, referenceID, amount, total, depositType)
+	transaction, err = updateBalance(ctx, database, wallet.ID, pocket.ID, referenceID, amount, depositType)
 	if err != nil {
-		log.Println("Error Deposit updateBalance: " + err.Error())
+		if errorCodeOf(err) == codeInternal {
+			logError(ctx, "Deposit updateBalance", err)
+		}
 		return
 	}
 
-	status = true
 	return
 }
 
-// Withdrawal ...
-func Withdrawal(userID, referenceID string, amount int) (status bool, transaction WalletTransaction, err error) {
-	status, wallet, err := viewBalance(userID)
+// Withdrawal -> withdraw from the main pocket
+func Withdrawal(ctx context.Context, userID, referenceID string, amount int) (transaction WalletTransaction, err error) {
+	transaction, _, err = WithdrawFromPocket(ctx, userID, "", referenceID, "", amount)
+	return
+}
+
+// WithdrawFromPocket -> withdraw from a pocket of the wallet, the main pocket when pocketID
+// is empty. Only the balance of that pocket can be withdrawn, and it pays the fee as well.
+// The withdrawal earns points by the rule of merchantCategory, or the default rule.
+func WithdrawFromPocket(ctx context.Context, userID, pocketID, referenceID, merchantCategory string, amount int) (transaction WalletTransaction, charge FeeCharge, err error) {
+	ctx = withOperation(ctx, "withdrawal")
+	ctx, span := startSpan(ctx, "Withdrawal", spanKindInternal)
+	span.setAttribute("amount", amount)
+	defer func() {
+		observeWalletResult("withdrawal", amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	pocket, err := pocketOf(ctx, wallet, pocketID)
 	if err != nil {
-		log.Println("Error Withdrawal viewBalance: " + err.Error())
 		return
 	}
 
-	if !status {
+	charge, err = quoteFee(ctx, wallet, feeTransactionWithdrawal, amount, time.Now())
+	if err != nil {
 		return
 	}
 
-	if amount > wallet.Balance {
-		err = errors.New("Insufficient balance")
+	if amount+charge.Amount > pocket.Balance {
+		err = errInsufficientFunds
 		return
 	}
 
-	transaction, err = getTransactionByReferenceID(database, referenceID, withdrawalType)
+	transaction, err = getTransactionByReferenceID(ctx, database, referenceID, withdrawalType)
 	if err != nil && err != sql.ErrNoRows {
-		log.Println("Error Withdrawal getTransactionByReferenceID: " + err.Error())
+		logError(ctx, "Withdrawal getTransactionByReferenceID", err)
 		return
 	}
 	err = nil
 
 	if transaction.ID != "" {
-		err = errors.New("Reference id must be unique")
+		err = errDuplicateReference
+		return
+	}
+
+	transaction, err = updateBalanceForWithdrawal(ctx, database, wallet.ID, pocket.ID, referenceID, merchantCategory, amount, &charge)
+	if err != nil {
+		if err != errInsufficientFunds {
+			logError(ctx, "Withdrawal updateBalance", err)
+		}
 		return
 	}
 
-	total := wallet.Balance - amount
-	transaction, err = updateBalance(database, wallet.ID, referenceID, amount, total, withdrawalType)
+	return
+}
+
+// ListTransactions -> latest transactions of the enabled wallet, newest first
+func ListTransactions(ctx context.Context, userID string, limit int) (transactions []WalletTransaction, err error) {
+	ctx = withOperation(ctx, "list_transactions")
+	ctx, span := startSpan(ctx, "ListTransactions", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	transactions, err = getTransactionsByWalletID(ctx, database, wallet.ID, limit)
 	if err != nil {
-		log.Println("Error Withdrawal updateBalance: " + err.Error())
+		logError(ctx, "ListTransactions getTransactionsByWalletID", err)
 		return
 	}
 
-	status = true
 	return
 }
 
@@ -0,0 +1,846 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Vouchers are codes generated by admins in campaigns. Redeeming one credits its amount to
+// the main pocket as a promo transaction, paid from the promotions system account, and keeps
+// it as a promo balance bucket that expires CreditDays after the redemption. A code
+// is redeemed once, a user redeems at most PerUserCap codes of a campaign, and a campaign
+// never pays more than its budget. The claim of the code, the caps and the credit are
+// checked and written in one tx, so concurrent redemptions cannot get past them.
+
+const (
+	voucherReferencePrefix = "voucher:"
+
+	// voucherAlphabet -> no 0/O or 1/I, codes are typed by hand
+	voucherAlphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	voucherCodeSize   = 12
+	voucherGroupSize  = 4
+	maxVouchersPerRun = 10000
+	maxVoucherNameLen = 100
+)
+
+// VoucherCampaign -> codes of Amount each, redeemable until ExpireTime while Spent stays
+// within Budget. CreditDays is 0 for credits that do not expire.
+type VoucherCampaign struct {
+	ID            string    `db:"id"`
+	Name          string    `db:"name"`
+	Amount        int       `db:"amount"`
+	PerUserCap    int       `db:"per_user_cap"`
+	Budget        int       `db:"budget"`
+	Spent         int       `db:"spent"`
+	Codes         int       `db:"codes"`
+	Redeemed      int       `db:"redeemed"`
+	CreditDays    int       `db:"credit_days"`
+	ExpireTime    time.Time `db:"expire_time"`
+	CreateTime    time.Time `db:"create_time"`
+	generatedCode []string
+}
+
+// Remaining -> budget not paid out yet
+func (c VoucherCampaign) Remaining() int {
+	return c.Budget - c.Spent
+}
+
+// Voucher -> one code, redeemed when RedeemedBy is set
+type Voucher struct {
+	Code          string    `db:"code"`
+	CampaignID    string    `db:"campaign_id"`
+	RedeemedBy    string    `db:"redeemed_by"`
+	TransactionID string    `db:"transaction_id"`
+	RedeemTime    time.Time `db:"redeem_time"`
+}
+
+// VoucherRedemption -> a redeemed voucher, the promo transaction it credited and its bucket
+type VoucherRedemption struct {
+	Code        string
+	Campaign    VoucherCampaign
+	Transaction WalletTransaction
+	Bucket      BalanceBucket
+}
+
+const (
+	createVoucherCampaignTable = `
+		CREATE TABLE IF NOT EXISTS voucher_campaign (
+			id TEXT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			per_user_cap INTEGER NOT NULL,
+			budget INTEGER NOT NULL,
+			spent INTEGER NOT NULL,
+			codes INTEGER NOT NULL,
+			redeemed INTEGER NOT NULL,
+			credit_days INTEGER NOT NULL,
+			expire_time DATETIME NOT NULL,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	createVoucherTable = `
+		CREATE TABLE IF NOT EXISTS voucher (
+			code TEXT NOT NULL PRIMARY KEY,
+			campaign_id TEXT NOT NULL,
+			redeemed_by TEXT NOT NULL,
+			transaction_id TEXT NOT NULL,
+			redeem_time DATETIME
+		);
+	`
+
+	insertVoucherCampaignSQL = `
+		INSERT INTO voucher_campaign
+			(id, name, amount, per_user_cap, budget, spent, codes, redeemed, credit_days, expire_time, create_time)
+		VALUES
+			(?,?,?,?,?,?,?,?,?,?,?)
+		;
+	`
+
+	insertVoucherSQL = `
+		INSERT INTO voucher
+			(code, campaign_id, redeemed_by, transaction_id)
+		VALUES
+			(?,?,'','')
+		;
+	`
+
+	selectVoucherCampaignSQL = `
+		SELECT
+			id,
+			name,
+			amount,
+			per_user_cap,
+			budget,
+			spent,
+			codes,
+			redeemed,
+			credit_days,
+			expire_time,
+			create_time
+		FROM
+			voucher_campaign
+	`
+
+	getVoucherCampaignsSQL = selectVoucherCampaignSQL + `
+		ORDER BY
+			create_time DESC
+	`
+
+	getVoucherCampaignSQL = selectVoucherCampaignSQL + `
+		WHERE
+			id = $1
+	`
+
+	getVoucherSQL = `
+		SELECT
+			code,
+			campaign_id,
+			redeemed_by,
+			transaction_id,
+			redeem_time
+		FROM
+			voucher
+		WHERE
+			code = $1
+	`
+
+	getVouchersSQL = `
+		SELECT
+			code,
+			campaign_id,
+			redeemed_by,
+			transaction_id,
+			redeem_time
+		FROM
+			voucher
+		WHERE
+			campaign_id = $1
+		ORDER BY
+			code
+	`
+
+	// claimVoucherSQL -> only the first of concurrent redemptions changes the row
+	claimVoucherSQL = `
+		UPDATE
+			voucher
+		SET
+			redeemed_by = $1,
+			redeem_time = $2
+		WHERE
+			code = $3 AND
+			redeemed_by = ''
+	`
+
+	setVoucherTransactionSQL = `
+		UPDATE
+			voucher
+		SET
+			transaction_id = $1
+		WHERE
+			code = $2
+	`
+
+	// spendVoucherBudgetSQL -> changes nothing once the budget cannot pay $1 more
+	spendVoucherBudgetSQL = `
+		UPDATE
+			voucher_campaign
+		SET
+			spent = spent + $1,
+			redeemed = redeemed + 1
+		WHERE
+			id = $2 AND
+			spent + $1 <= budget
+	`
+
+	countUserVouchersSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			voucher
+		WHERE
+			campaign_id = $1 AND
+			redeemed_by = $2
+	`
+)
+
+// newVoucherCode -> voucherCodeSize random characters of voucherAlphabet
+func newVoucherCode() string {
+	b := make([]byte, voucherCodeSize)
+	rand.Read(b)
+
+	for i := range b {
+		b[i] = voucherAlphabet[int(b[i])%len(voucherAlphabet)]
+	}
+
+	return string(b)
+}
+
+// normalizeVoucherCode -> the code as stored, whatever the case and separators it was typed with
+func normalizeVoucherCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ':
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// formatVoucherCode -> the code in groups of voucherGroupSize, e.g. ABCD-EFGH-JKLM
+func formatVoucherCode(code string) string {
+	var groups []string
+	for len(code) > voucherGroupSize {
+		groups = append(groups, code[:voucherGroupSize])
+		code = code[voucherGroupSize:]
+	}
+
+	return strings.Join(append(groups, code), "-")
+}
+
+// insertVoucherCampaign -> the campaign and count new codes in one tx, codes that happen
+// to be taken already are drawn again
+func insertVoucherCampaign(ctx context.Context, db *sql.DB, campaign *VoucherCampaign) (err error) {
+	defer observeQuery("insertVoucherCampaign", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertVoucherCampaign")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "insertVoucherCampaign BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		insertVoucherCampaignSQL,
+		campaign.ID,
+		campaign.Name,
+		campaign.Amount,
+		campaign.PerUserCap,
+		campaign.Budget,
+		campaign.Spent,
+		campaign.Codes,
+		campaign.Redeemed,
+		campaign.CreditDays,
+		campaign.ExpireTime,
+		campaign.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "insertVoucherCampaign ExecContext", err)
+		return
+	}
+
+	stmt, err := tx.PrepareContext(ctx, insertVoucherSQL)
+	if err != nil {
+		logError(ctx, "insertVoucherCampaign PrepareContext", err)
+		return
+	}
+	defer stmt.Close()
+
+	campaign.generatedCode = make([]string, 0, campaign.Codes)
+	for len(campaign.generatedCode) < campaign.Codes {
+		code := newVoucherCode()
+
+		_, err = stmt.ExecContext(ctx, code, campaign.ID)
+		if isUniqueViolation(err) {
+			continue
+		}
+		if err != nil {
+			logError(ctx, "insertVoucherCampaign insert code", err)
+			return
+		}
+
+		campaign.generatedCode = append(campaign.generatedCode, code)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "insertVoucherCampaign Commit", err)
+	}
+
+	return
+}
+
+func scanVoucherCampaign(scanner interface{ Scan(...interface{}) error }) (campaign VoucherCampaign, err error) {
+	err = scanner.Scan(
+		&campaign.ID,
+		&campaign.Name,
+		&campaign.Amount,
+		&campaign.PerUserCap,
+		&campaign.Budget,
+		&campaign.Spent,
+		&campaign.Codes,
+		&campaign.Redeemed,
+		&campaign.CreditDays,
+		&campaign.ExpireTime,
+		&campaign.CreateTime,
+	)
+
+	return
+}
+
+func getVoucherCampaigns(ctx context.Context, db *sql.DB) (campaigns []VoucherCampaign, err error) {
+	defer observeQuery("getVoucherCampaigns", time.Now())
+	ctx, span := startQuerySpan(ctx, "getVoucherCampaigns")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getVoucherCampaignsSQL)
+	if err != nil {
+		logError(ctx, "getVoucherCampaigns QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var campaign VoucherCampaign
+		campaign, err = scanVoucherCampaign(rows)
+		if err != nil {
+			logError(ctx, "getVoucherCampaigns Scan", err)
+			return
+		}
+
+		campaigns = append(campaigns, campaign)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getVoucherCampaign(ctx context.Context, db *sql.DB, campaignID string) (campaign VoucherCampaign, err error) {
+	defer observeQuery("getVoucherCampaign", time.Now())
+	ctx, span := startQuerySpan(ctx, "getVoucherCampaign")
+	defer func() {
+		span.end(err)
+	}()
+
+	campaign, err = scanVoucherCampaign(db.QueryRowContext(ctx, getVoucherCampaignSQL, campaignID))
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getVoucherCampaign Scan", err)
+	}
+
+	return
+}
+
+func scanVoucher(scanner interface{ Scan(...interface{}) error }) (voucher Voucher, err error) {
+	var redeemTime sql.NullTime
+	err = scanner.Scan(
+		&voucher.Code,
+		&voucher.CampaignID,
+		&voucher.RedeemedBy,
+		&voucher.TransactionID,
+		&redeemTime,
+	)
+	voucher.RedeemTime = redeemTime.Time
+
+	return
+}
+
+func getVoucher(ctx context.Context, db *sql.DB, code string) (voucher Voucher, err error) {
+	defer observeQuery("getVoucher", time.Now())
+	ctx, span := startQuerySpan(ctx, "getVoucher")
+	defer func() {
+		span.end(err)
+	}()
+
+	voucher, err = scanVoucher(db.QueryRowContext(ctx, getVoucherSQL, code))
+	if err != nil && err != sql.ErrNoRows {
+		logError(ctx, "getVoucher Scan", err)
+	}
+
+	return
+}
+
+func getVouchers(ctx context.Context, db *sql.DB, campaignID string) (vouchers []Voucher, err error) {
+	defer observeQuery("getVouchers", time.Now())
+	ctx, span := startQuerySpan(ctx, "getVouchers")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getVouchersSQL, campaignID)
+	if err != nil {
+		logError(ctx, "getVouchers QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var voucher Voucher
+		voucher, err = scanVoucher(rows)
+		if err != nil {
+			logError(ctx, "getVouchers Scan", err)
+			return
+		}
+
+		vouchers = append(vouchers, voucher)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// redeemVoucher -> claim the code for the wallet and credit the campaign amount as bucket in
+// one tx. The writes come first, so the tx holds the write lock before the per user cap is
+// counted.
+func redeemVoucher(ctx context.Context, db *sql.DB, wallet Wallet, campaign VoucherCampaign, code string, bucket *BalanceBucket, now time.Time) (transaction WalletTransaction, err error) {
+	defer observeQuery("redeemVoucher", time.Now())
+	ctx, span := startQuerySpan(ctx, "redeemVoucher")
+	defer func() {
+		span.end(err)
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logError(ctx, "redeemVoucher BeginTx", err)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, claimVoucherSQL, wallet.UserID, now, code)
+	if err != nil {
+		logError(ctx, "redeemVoucher claim", err)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		err = errVoucherRedeemed
+		return
+	}
+
+	result, err = tx.ExecContext(ctx, spendVoucherBudgetSQL, campaign.Amount, campaign.ID)
+	if err != nil {
+		logError(ctx, "redeemVoucher spend budget", err)
+		return
+	}
+	if changed, _ := result.RowsAffected(); changed == 0 {
+		err = errVoucherBudgetSpent
+		return
+	}
+
+	var redeemed int
+	err = tx.QueryRowContext(ctx, countUserVouchersSQL, campaign.ID, wallet.UserID).Scan(&redeemed)
+	if err != nil {
+		logError(ctx, "redeemVoucher count", err)
+		return
+	}
+	if redeemed > campaign.PerUserCap {
+		err = errVoucherCapReached
+		return
+	}
+
+	transaction, event, err := applyBalanceChange(ctx, tx, wallet.ID, "", voucherReferencePrefix+code, campaign.Amount, promoType)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, setVoucherTransactionSQL, transaction.ID, code)
+	if err != nil {
+		logError(ctx, "redeemVoucher set transaction", err)
+		return
+	}
+
+	bucket.TransactionID = transaction.ID
+	bucket.CreateTime = transaction.CreateTime
+	err = insertBalanceBucket(ctx, tx, *bucket)
+	if err != nil {
+		return
+	}
+
+	entry := SystemEntry{
+		AccountID:     systemAccountPromotions,
+		Amount:        -campaign.Amount,
+		WalletID:      wallet.ID,
+		TransactionID: transaction.ID,
+		ReferenceID:   campaign.ID,
+		CreateTime:    transaction.CreateTime,
+	}
+	err = postSystemEntry(ctx, tx, &entry)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logError(ctx, "redeemVoucher Commit", err)
+		return
+	}
+
+	publishWalletEvent(ctx, event)
+
+	return
+}
+
+// voucherCampaignFromRequest -> the campaign of the request, or the fields that are wrong
+func voucherCampaignFromRequest(req RequestVoucherCampaign, now time.Time) (campaign VoucherCampaign, errs validationErrors) {
+	errs = validationErrors{}
+
+	campaign = VoucherCampaign{
+		ID:         generateUUID(),
+		Name:       strings.TrimSpace(req.Name),
+		Amount:     req.Amount,
+		PerUserCap: req.PerUserCap,
+		Budget:     req.Budget,
+		Codes:      req.Count,
+		CreditDays: req.CreditDays,
+		CreateTime: now,
+	}
+
+	switch {
+	case campaign.Name == "":
+		errs.add("name", msgRequired)
+	case len(campaign.Name) > maxVoucherNameLen:
+		errs.add("name", "Must be at most 100 characters.")
+	}
+
+	if campaign.Codes > maxVouchersPerRun {
+		errs.add("count", "Must be at most 10000.")
+	}
+
+	if campaign.CreditDays > maxCreditDays {
+		errs.add("credit_days", "Must be at most 3650.")
+	}
+
+	if campaign.PerUserCap == 0 {
+		campaign.PerUserCap = 1
+	}
+
+	if campaign.Budget == 0 {
+		campaign.Budget = campaign.Amount * campaign.Codes
+	}
+	if campaign.Budget < campaign.Amount {
+		errs.add("budget", "Must pay for at least one code.")
+	}
+
+	expireTime, err := time.Parse(time.RFC3339, req.ExpiresAt)
+	switch {
+	case err != nil:
+		errs.add("expires_at", "Not a valid RFC 3339 time, e.g. 2026-12-31T23:59:59Z.")
+	case !expireTime.After(now):
+		errs.add("expires_at", "Must be in the future.")
+	}
+	campaign.ExpireTime = expireTime
+
+	return
+}
+
+// CreateVoucherCampaign -> store the campaign with its new codes
+func CreateVoucherCampaign(ctx context.Context, campaign VoucherCampaign) (created VoucherCampaign, codes []string, err error) {
+	ctx = withOperation(ctx, "create_voucher_campaign")
+	ctx, span := startSpan(ctx, "CreateVoucherCampaign", spanKindInternal)
+	span.setAttribute("codes", campaign.Codes)
+	defer func() {
+		span.finish(err)
+	}()
+
+	err = insertVoucherCampaign(ctx, database, &campaign)
+	if err != nil {
+		return
+	}
+
+	return campaign, campaign.generatedCode, nil
+}
+
+// ListVoucherCampaigns -> every campaign, newest first
+func ListVoucherCampaigns(ctx context.Context) (campaigns []VoucherCampaign, err error) {
+	ctx = withOperation(ctx, "list_voucher_campaigns")
+	ctx, span := startSpan(ctx, "ListVoucherCampaigns", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	return getVoucherCampaigns(ctx, database)
+}
+
+// GetVoucherCampaign -> a campaign and every code of it
+func GetVoucherCampaign(ctx context.Context, campaignID string) (campaign VoucherCampaign, vouchers []Voucher, err error) {
+	ctx = withOperation(ctx, "get_voucher_campaign")
+	ctx, span := startSpan(ctx, "GetVoucherCampaign", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	campaign, err = getVoucherCampaign(ctx, database, campaignID)
+	if err == sql.ErrNoRows {
+		err = errVoucherCampaignNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	vouchers, err = getVouchers(ctx, database, campaignID)
+	return
+}
+
+// RedeemVoucher -> credit the amount of code to the enabled wallet as a promo transaction
+func RedeemVoucher(ctx context.Context, userID, code string) (redemption VoucherRedemption, err error) {
+	ctx = withOperation(ctx, "redeem_voucher")
+	ctx, span := startSpan(ctx, "RedeemVoucher", spanKindInternal)
+	defer func() {
+		observeWalletResult("redeem_voucher", redemption.Transaction.Amount, err)
+		span.finish(err)
+	}()
+
+	wallet, err := viewBalance(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	redemption.Code = normalizeVoucherCode(code)
+
+	voucher, err := getVoucher(ctx, database, redemption.Code)
+	if err == sql.ErrNoRows {
+		err = errVoucherNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	redemption.Campaign, err = getVoucherCampaign(ctx, database, voucher.CampaignID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case voucher.RedeemedBy != "":
+		err = errVoucherRedeemed
+	case !now.Before(redemption.Campaign.ExpireTime):
+		err = errVoucherExpired
+	}
+	if err != nil {
+		return
+	}
+
+	redemption.Bucket = BalanceBucket{
+		ID:        generateUUID(),
+		WalletID:  wallet.ID,
+		Source:    bucketSourcePromo,
+		Amount:    redemption.Campaign.Amount,
+		Remaining: redemption.Campaign.Amount,
+	}
+	if redemption.Campaign.CreditDays > 0 {
+		redemption.Bucket.ExpireTime = now.AddDate(0, 0, redemption.Campaign.CreditDays)
+	}
+
+	redemption.Transaction, err = redeemVoucher(ctx, database, wallet, redemption.Campaign, redemption.Code, &redemption.Bucket, now)
+	if err != nil {
+		if errorCodeOf(err) == codeInternal {
+			logError(ctx, "RedeemVoucher redeemVoucher", err)
+		}
+		return
+	}
+
+	return
+}
+
+// HandleRedeemVoucher -> Redeem a voucher code into my wallet
+func HandleRedeemVoucher(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestRedeemVoucher
+	if !bindRequest(w, r, &req, &response) {
+		observeWalletFailure("redeem_voucher", "invalid_input")
+		return
+	}
+
+	uID := userIDFromContext(r.Context())
+
+	redemption, err := RedeemVoucher(r.Context(), uID, req.Code)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = ResponseVoucherRedemption{
+		Deposit: ResponseDepositDetail{
+			ID:          redemption.Transaction.ID,
+			DepositedBy: uID,
+			Status:      statusSuccess,
+			DepositedAt: redemption.Transaction.CreateTime,
+			Amount:      redemption.Transaction.Amount,
+			ReferenceID: redemption.Transaction.ReferenceID,
+		},
+		Type:       redemption.Transaction.TypeName(),
+		Code:       formatVoucherCode(redemption.Code),
+		CampaignID: redemption.Campaign.ID,
+		Bucket:     bucketResponse(redemption.Bucket),
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleCreateVoucherCampaign -> Admin: generate a campaign of voucher codes
+func HandleCreateVoucherCampaign(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestVoucherCampaign
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	campaign, errs := voucherCampaignFromRequest(req, time.Now())
+	if len(errs) > 0 {
+		writeValidationError(w, r, &response, errs)
+		return
+	}
+
+	campaign, codes, err := CreateVoucherCampaign(r.Context(), campaign)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseVoucherCampaign{
+		Campaign: voucherCampaignResponse(campaign),
+		Codes:    []ResponseVoucher{},
+	}
+	for _, code := range codes {
+		data.Codes = append(data.Codes, ResponseVoucher{Code: formatVoucherCode(code)})
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleListVoucherCampaigns -> Admin: every voucher campaign with its remaining budget
+func HandleListVoucherCampaigns(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	campaigns, err := ListVoucherCampaigns(r.Context())
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseVoucherCampaigns{
+		Campaigns: []ResponseVoucherCampaignDetail{},
+	}
+	for _, campaign := range campaigns {
+		data.Campaigns = append(data.Campaigns, voucherCampaignResponse(campaign))
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGetVoucherCampaign -> Admin: a voucher campaign and who redeemed its codes
+func HandleGetVoucherCampaign(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	campaign, vouchers, err := GetVoucherCampaign(r.Context(), ps.ByName("campaign_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseVoucherCampaign{
+		Campaign: voucherCampaignResponse(campaign),
+		Codes:    []ResponseVoucher{},
+	}
+	for _, voucher := range vouchers {
+		code := ResponseVoucher{
+			Code:          formatVoucherCode(voucher.Code),
+			RedeemedBy:    voucher.RedeemedBy,
+			TransactionID: voucher.TransactionID,
+		}
+		if !voucher.RedeemTime.IsZero() {
+			code.RedeemedAt = &voucher.RedeemTime
+		}
+		data.Codes = append(data.Codes, code)
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
+
+func voucherCampaignResponse(campaign VoucherCampaign) ResponseVoucherCampaignDetail {
+	return ResponseVoucherCampaignDetail{
+		ID:         campaign.ID,
+		Name:       campaign.Name,
+		Amount:     campaign.Amount,
+		PerUserCap: campaign.PerUserCap,
+		Budget:     campaign.Budget,
+		Spent:      campaign.Spent,
+		Remaining:  campaign.Remaining(),
+		Codes:      campaign.Codes,
+		Redeemed:   campaign.Redeemed,
+		CreditDays: campaign.CreditDays,
+		ExpiresAt:  campaign.ExpireTime,
+		CreatedAt:  campaign.CreateTime,
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentVoucherRedemption -> a code redeemed by many wallets at the same time is
+// credited to one of them, once
+func TestConcurrentVoucherRedemption(t *testing.T) {
+	ctx := context.Background()
+
+	campaign, errs := voucherCampaignFromRequest(RequestVoucherCampaign{
+		Name:      "concurrent redemption",
+		Amount:    500,
+		Count:     1,
+		ExpiresAt: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}, time.Now())
+	if len(errs) > 0 {
+		t.Fatalf("voucherCampaignFromRequest: %v", errs)
+	}
+
+	campaign, codes, err := CreateVoucherCampaign(ctx, campaign)
+	if err != nil {
+		t.Fatalf("CreateVoucherCampaign: %v", err)
+	}
+
+	users := make([]string, 10)
+	for i := range users {
+		users[i] = fundedWallet(t, 0)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var winners []string
+	for i, userID := range users {
+		wg.Add(1)
+		go func(i int, userID string) {
+			defer wg.Done()
+
+			_, err := RedeemVoucher(ctx, userID, codes[0])
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				winners = append(winners, userID)
+			case !errors.Is(err, errVoucherRedeemed):
+				t.Errorf("redemption %d: %v", i, err)
+			}
+		}(i, userID)
+	}
+	wg.Wait()
+
+	if len(winners) != 1 {
+		t.Fatalf("%d redemptions went through, want 1", len(winners))
+	}
+
+	total := 0
+	for _, userID := range users {
+		wallet, _, _, err := ViewBalance(ctx, userID)
+		if err != nil {
+			t.Fatalf("ViewBalance: %v", err)
+		}
+		total += wallet.Balance
+	}
+	if total != campaign.Amount {
+		t.Errorf("wallets got %d, want %d", total, campaign.Amount)
+	}
+
+	campaign, vouchers, err := GetVoucherCampaign(ctx, campaign.ID)
+	if err != nil {
+		t.Fatalf("GetVoucherCampaign: %v", err)
+	}
+	if campaign.Spent != campaign.Amount {
+		t.Errorf("campaign spent %d, want %d", campaign.Spent, campaign.Amount)
+	}
+	if len(vouchers) != 1 || vouchers[0].RedeemedBy != winners[0] {
+		t.Errorf("vouchers %+v, want redeemed by %s", vouchers, winners[0])
+	}
+}
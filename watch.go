@@ -0,0 +1,651 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	watchTypeSubscribe    = "subscribe"
+	watchTypeUnsubscribe  = "unsubscribe"
+	watchTypeAck          = "ack"
+	watchTypeSubscribed   = "subscribed"
+	watchTypeUnsubscribed = "unsubscribed"
+	watchTypeEvent        = "event"
+	watchTypeError        = "error"
+
+	// watchMaxWallets -> wallets one connection may watch at once
+	watchMaxWallets = 1000
+
+	// watchMaxUnacked -> events sent and not acknowledged yet, the send window of a client
+	watchMaxUnacked = 256
+
+	// watchMaxQueued -> events held back by a full window before the client counts as slow
+	watchMaxQueued = 4096
+)
+
+// WalletWatcher -> a user the owner allowed to watch their wallet, the owner always can
+type WalletWatcher struct {
+	WalletID   string    `db:"wallet_id"`
+	UserID     string    `db:"user_id"`
+	CreateTime time.Time `db:"create_time"`
+}
+
+const (
+	createWalletWatcherTable = `
+		CREATE TABLE IF NOT EXISTS wallet_watcher (
+			wallet_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			create_time DATETIME NOT NULL,
+			PRIMARY KEY (wallet_id, user_id)
+		);
+	`
+
+	insertWalletWatcherSQL = `
+		INSERT INTO wallet_watcher
+			(wallet_id, user_id, create_time)
+		VALUES
+			(?,?,?)
+		ON CONFLICT (wallet_id, user_id) DO NOTHING
+		;
+	`
+
+	deleteWalletWatcherSQL = `
+		DELETE FROM
+			wallet_watcher
+		WHERE
+			wallet_id = $1 AND
+			user_id = $2
+	`
+
+	getWalletWatchersSQL = `
+		SELECT
+			wallet_id,
+			user_id,
+			create_time
+		FROM
+			wallet_watcher
+		WHERE
+			wallet_id = $1
+		ORDER BY
+			create_time
+	`
+
+	canWatchWalletSQL = `
+		SELECT
+			COUNT(*)
+		FROM
+			wallet
+		WHERE
+			id = $1 AND
+			(
+				user_id = $2 OR
+				EXISTS (SELECT 1 FROM wallet_watcher WHERE wallet_id = $1 AND user_id = $2)
+			)
+	`
+)
+
+func insertWalletWatcher(ctx context.Context, db *sql.DB, watcher WalletWatcher) (err error) {
+	defer observeQuery("insertWalletWatcher", time.Now())
+	ctx, span := startQuerySpan(ctx, "insertWalletWatcher")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, insertWalletWatcherSQL, watcher.WalletID, watcher.UserID, watcher.CreateTime)
+	if err != nil {
+		logError(ctx, "insertWalletWatcher ExecContext", err)
+	}
+
+	return
+}
+
+func deleteWalletWatcher(ctx context.Context, db *sql.DB, walletID, userID string) (err error) {
+	defer observeQuery("deleteWalletWatcher", time.Now())
+	ctx, span := startQuerySpan(ctx, "deleteWalletWatcher")
+	defer func() {
+		span.end(err)
+	}()
+
+	_, err = db.ExecContext(ctx, deleteWalletWatcherSQL, walletID, userID)
+	if err != nil {
+		logError(ctx, "deleteWalletWatcher ExecContext", err)
+	}
+
+	return
+}
+
+func getWalletWatchers(ctx context.Context, db *sql.DB, walletID string) (watchers []WalletWatcher, err error) {
+	defer observeQuery("getWalletWatchers", time.Now())
+	ctx, span := startQuerySpan(ctx, "getWalletWatchers")
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, getWalletWatchersSQL, walletID)
+	if err != nil {
+		logError(ctx, "getWalletWatchers QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var watcher WalletWatcher
+		err = rows.Scan(&watcher.WalletID, &watcher.UserID, &watcher.CreateTime)
+		if err != nil {
+			logError(ctx, "getWalletWatchers Scan", err)
+			return
+		}
+
+		watchers = append(watchers, watcher)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func canWatchWallet(ctx context.Context, db *sql.DB, walletID, userID string) (allowed bool, err error) {
+	defer observeQuery("canWatchWallet", time.Now())
+	ctx, span := startQuerySpan(ctx, "canWatchWallet")
+	defer func() {
+		span.end(err)
+	}()
+
+	var count int
+	err = db.QueryRowContext(ctx, canWatchWalletSQL, walletID, userID).Scan(&count)
+	if err != nil {
+		logError(ctx, "canWatchWallet Scan", err)
+		return
+	}
+
+	allowed = count > 0
+	return
+}
+
+// ownWallet -> wallet of userID in any status, for settings that do not need it enabled
+func ownWallet(ctx context.Context, userID string) (wallet Wallet, err error) {
+	wallet, err = getWalletByUserID(ctx, database, userID)
+	setWalletID(ctx, wallet.ID)
+	if err == sql.ErrNoRows {
+		err = errWalletNotFound
+	}
+
+	return
+}
+
+// ListWalletWatchers -> users allowed to watch my wallet
+func ListWalletWatchers(ctx context.Context, userID string) (wallet Wallet, watchers []WalletWatcher, err error) {
+	ctx = withOperation(ctx, "list_wallet_watchers")
+	ctx, span := startSpan(ctx, "ListWalletWatchers", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err = ownWallet(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	watchers, err = getWalletWatchers(ctx, database, wallet.ID)
+	return
+}
+
+// GrantWalletWatcher -> let watcherID watch my wallet, granting twice is a no-op
+func GrantWalletWatcher(ctx context.Context, userID, watcherID string) (wallet Wallet, err error) {
+	ctx = withOperation(ctx, "grant_wallet_watcher")
+	ctx, span := startSpan(ctx, "GrantWalletWatcher", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	if watcherID == userID {
+		err = errWatchOwnWallet
+		return
+	}
+
+	wallet, err = ownWallet(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	exists, err := userExists(ctx, database, watcherID)
+	if err != nil {
+		return
+	}
+	if !exists {
+		err = errUserNotFound
+		return
+	}
+
+	err = insertWalletWatcher(ctx, database, WalletWatcher{
+		WalletID:   wallet.ID,
+		UserID:     watcherID,
+		CreateTime: time.Now(),
+	})
+	return
+}
+
+// RevokeWalletWatcher -> stop watcherID from subscribing to my wallet. Connections that
+// already watch it keep receiving events until they unsubscribe or reconnect.
+func RevokeWalletWatcher(ctx context.Context, userID, watcherID string) (wallet Wallet, err error) {
+	ctx = withOperation(ctx, "revoke_wallet_watcher")
+	ctx, span := startSpan(ctx, "RevokeWalletWatcher", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	wallet, err = ownWallet(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	err = deleteWalletWatcher(ctx, database, wallet.ID, watcherID)
+	return
+}
+
+// WatchWallets -> add walletIDs to sub once userID may watch all of them, then load the
+// stored events after the sequence a resuming client last saw. Unknown wallets and wallets
+// userID may not watch are reported the same way in denied, so ids cannot be probed.
+func WatchWallets(ctx context.Context, userID string, sub *walletSubscription, walletIDs []string, after map[string]int64) (denied []string, backlog []walletEvent, err error) {
+	ctx = withOperation(ctx, "watch_wallets")
+	ctx, span := startSpan(ctx, "WatchWallets", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	for _, walletID := range walletIDs {
+		var allowed bool
+		allowed, err = canWatchWallet(ctx, database, walletID, userID)
+		if err != nil {
+			return
+		}
+		if !allowed {
+			denied = append(denied, walletID)
+		}
+	}
+	if len(denied) > 0 {
+		err = errWalletNotFound
+		return
+	}
+
+	topics := make([]string, 0, len(walletIDs))
+	for _, walletID := range walletIDs {
+		topics = append(topics, walletTopic(walletID))
+	}
+	walletEvents.addTopics(sub, topics...)
+
+	for _, walletID := range walletIDs {
+		if after[walletID] <= 0 {
+			continue
+		}
+
+		var events []walletEvent
+		events, err = getWalletEventsAfter(ctx, database, walletID, after[walletID])
+		if err != nil {
+			logError(ctx, "WatchWallets getWalletEventsAfter", err)
+			return
+		}
+		backlog = append(backlog, events...)
+	}
+
+	return
+}
+
+// HandleListWalletWatchers -> View who may watch my wallet
+func HandleListWalletWatchers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	wallet, watchers, err := ListWalletWatchers(r.Context(), uID)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = walletWatchersResponse(wallet, watchers)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGrantWalletWatcher -> Allow a user to watch my wallet over the watch websocket
+func HandleGrantWalletWatcher(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	_, err := GrantWalletWatcher(r.Context(), uID, ps.ByName("user_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	wallet, watchers, err := ListWalletWatchers(r.Context(), uID)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = walletWatchersResponse(wallet, watchers)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleRevokeWalletWatcher -> Stop a user from watching my wallet
+func HandleRevokeWalletWatcher(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	uID := userIDFromContext(r.Context())
+
+	_, err := RevokeWalletWatcher(r.Context(), uID, ps.ByName("user_id"))
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	wallet, watchers, err := ListWalletWatchers(r.Context(), uID)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	response.Data = walletWatchersResponse(wallet, watchers)
+	w.WriteHeader(http.StatusOK)
+}
+
+func walletWatchersResponse(wallet Wallet, watchers []WalletWatcher) ResponseWalletWatchers {
+	response := ResponseWalletWatchers{
+		WalletID: wallet.ID,
+		Watchers: []ResponseWalletWatcher{},
+	}
+
+	for _, watcher := range watchers {
+		response.Watchers = append(response.Watchers, ResponseWalletWatcher{
+			UserID:    watcher.UserID,
+			CreatedAt: watcher.CreateTime,
+		})
+	}
+
+	return response
+}
+
+// watchSession -> state of one watch websocket, only touched by the handler goroutine
+type watchSession struct {
+	ctx    context.Context
+	ws     *wsConn
+	userID string
+	sub    *walletSubscription
+
+	// sent -> last sequence sent per watched wallet, live events at or below it are skipped
+	sent map[string]int64
+
+	// pending -> sequences sent per wallet and not acknowledged yet
+	pending map[string][]int64
+	unacked int
+
+	// queue -> events waiting for room in the window, oldest first
+	queue []walletEvent
+}
+
+// HandleWatchWallets -> Watch many wallets over one websocket.
+// Clients send subscribe, unsubscribe and ack messages, the server answers with
+// subscribed, unsubscribed, event and error messages. See README for the protocol.
+func HandleWatchWallets(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		abortError(w, r, err)
+		return
+	}
+	defer ws.Close()
+
+	s := &watchSession{
+		ctx:     ctx,
+		ws:      ws,
+		userID:  userIDFromContext(ctx),
+		sub:     walletEvents.subscribe(),
+		sent:    map[string]int64{},
+		pending: map[string][]int64{},
+	}
+	defer walletEvents.unsubscribe(s.sub)
+
+	logInfo(ctx, "watch connected")
+
+	requests := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			opcode, message, err := ws.readMessage()
+			if err == nil && opcode != wsOpText {
+				err = &wsCloseError{Code: wsCloseUnsupportedData, Reason: "text messages only"}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			case requests <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case err := <-readErr:
+			if code, reason := closeCode(err); code != 0 {
+				ws.writeClose(code, reason)
+			}
+			logInfo(ctx, "watch closed", "reason", err.Error())
+			return
+		case message := <-requests:
+			err = s.handle(message)
+		case event, ok := <-s.sub.C:
+			if !ok {
+				s.slowConsumer()
+				return
+			}
+			err = s.send(event)
+		case <-ping.C:
+			err = ws.writeFrame(wsOpPing, nil)
+		}
+
+		if err != nil {
+			logInfo(ctx, "watch closed", "reason", err.Error())
+			return
+		}
+
+		if len(s.queue) > watchMaxQueued {
+			s.slowConsumer()
+			return
+		}
+	}
+}
+
+func (s *watchSession) handle(message []byte) (err error) {
+	var req RequestWatch
+	err = json.Unmarshal(message, &req)
+	if err != nil {
+		return s.reply(ResponseWatchMessage{Type: watchTypeError, Error: s.errorOf(errInvalidWatchMessage)})
+	}
+
+	switch req.Type {
+	case watchTypeSubscribe:
+		return s.subscribe(req)
+	case watchTypeUnsubscribe:
+		return s.unsubscribe(req)
+	case watchTypeAck:
+		s.ack(req.WalletID, req.Sequence)
+		return s.flush()
+	default:
+		return s.reply(ResponseWatchMessage{Type: watchTypeError, ID: req.ID, Error: s.errorOf(errInvalidWatchMessage)})
+	}
+}
+
+func (s *watchSession) subscribe(req RequestWatch) (err error) {
+	var walletIDs []string
+	for _, walletID := range req.WalletIDs {
+		if _, ok := s.sent[walletID]; !ok && !containsString(walletIDs, walletID) {
+			walletIDs = append(walletIDs, walletID)
+		}
+	}
+
+	if len(req.WalletIDs) == 0 {
+		return s.reply(ResponseWatchMessage{Type: watchTypeError, ID: req.ID, Error: s.errorOf(errInvalidWatchMessage)})
+	}
+	if len(s.sent)+len(walletIDs) > watchMaxWallets {
+		return s.reply(ResponseWatchMessage{Type: watchTypeError, ID: req.ID, Error: s.errorOf(errTooManyWatchedWallets)})
+	}
+
+	denied, backlog, err := WatchWallets(s.ctx, s.userID, s.sub, walletIDs, req.After)
+	if err != nil {
+		return s.reply(ResponseWatchMessage{Type: watchTypeError, ID: req.ID, WalletIDs: denied, Error: s.errorOf(err)})
+	}
+
+	for _, walletID := range walletIDs {
+		s.sent[walletID] = req.After[walletID]
+	}
+
+	err = s.reply(ResponseWatchMessage{Type: watchTypeSubscribed, ID: req.ID, WalletIDs: s.watched()})
+	if err != nil {
+		return
+	}
+
+	s.queue = append(s.queue, backlog...)
+	return s.flush()
+}
+
+func (s *watchSession) unsubscribe(req RequestWatch) error {
+	topics := make([]string, 0, len(req.WalletIDs))
+	for _, walletID := range req.WalletIDs {
+		topics = append(topics, walletTopic(walletID))
+		s.unacked -= len(s.pending[walletID])
+		delete(s.pending, walletID)
+		delete(s.sent, walletID)
+	}
+	walletEvents.removeTopics(s.sub, topics...)
+
+	queue := s.queue[:0]
+	for _, event := range s.queue {
+		if _, ok := s.sent[event.WalletID]; ok {
+			queue = append(queue, event)
+		}
+	}
+	s.queue = queue
+
+	return s.reply(ResponseWatchMessage{Type: watchTypeUnsubscribed, ID: req.ID, WalletIDs: s.watched()})
+}
+
+// ack -> the client handled every event of walletID up to sequence
+func (s *watchSession) ack(walletID string, sequence int64) {
+	pending := s.pending[walletID]
+
+	n := sort.Search(len(pending), func(i int) bool { return pending[i] > sequence })
+	s.pending[walletID] = pending[n:]
+	s.unacked -= n
+}
+
+// send -> queue a live event behind anything still waiting, then fill the window
+func (s *watchSession) send(event walletEvent) error {
+	s.queue = append(s.queue, event)
+	return s.flush()
+}
+
+// flush -> write queued events while the window has room, skipping events of
+// wallets no longer watched and sequences the client already has
+func (s *watchSession) flush() (err error) {
+	for len(s.queue) > 0 && s.unacked < watchMaxUnacked {
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+
+		last, ok := s.sent[event.WalletID]
+		if !ok || event.Sequence <= last {
+			continue
+		}
+
+		s.sent[event.WalletID] = event.Sequence
+		s.pending[event.WalletID] = append(s.pending[event.WalletID], event.Sequence)
+		s.unacked++
+
+		data := newResponseWalletEvent(event)
+		err = s.reply(ResponseWatchMessage{Type: watchTypeEvent, Event: &data})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *watchSession) reply(message ResponseWatchMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return s.ws.writeText(data)
+}
+
+// slowConsumer -> tell the client why, then close with policy violation
+func (s *watchSession) slowConsumer() {
+	logWarn(s.ctx, "watch slow consumer", "unacked", s.unacked, "queued", len(s.queue))
+
+	s.reply(ResponseWatchMessage{Type: watchTypeError, Error: s.errorOf(errSlowConsumer)})
+	s.ws.writeClose(wsClosePolicyViolation, string(codeSlowConsumer))
+}
+
+func (s *watchSession) errorOf(err error) *ResponseError {
+	response := newResponseError(s.ctx, err)
+	return &response
+}
+
+func (s *watchSession) watched() []string {
+	walletIDs := []string{}
+	for walletID := range s.sent {
+		walletIDs = append(walletIDs, walletID)
+	}
+	sort.Strings(walletIDs)
+
+	return walletIDs
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Webhooks tell a merchant its payments changed. They are an outbox: queued in the tx that
+// changed the payment, with the payment as it was then, and posted by the dispatcher until
+// the webhook url answers 2xx or the attempts run out. Every post is signed with the webhook
+// secret of the merchant, see webhookSignature. Merchants that cannot take webhooks poll the
+// payment instead.
+
+const (
+	webhookEventPaymentPaid     = "payment.paid"
+	webhookEventPaymentDeclined = "payment.declined"
+	webhookEventPaymentExpired  = "payment.expired"
+	webhookEventPaymentRefunded = "payment.refunded"
+
+	webhookStatusPending   = "pending"
+	webhookStatusDelivered = "delivered"
+	webhookStatusFailed    = "failed"
+
+	webhookEventHeader     = "X-Wallet-Event"
+	webhookDeliveryHeader  = "X-Wallet-Delivery"
+	webhookSignatureHeader = "X-Wallet-Signature"
+
+	// webhookMaxAttempts -> posts of a webhook before it is failed, its backoff doubles from
+	// webhookRetryBase up to webhookRetryMax between them
+	webhookMaxAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = time.Hour
+	webhookTimeout     = 10 * time.Second
+	webhookBatchSize   = 50
+	maxWebhookErrorLen = 200
+
+	// webhookPoll -> how often due webhooks are posted
+	webhookPoll = 5 * time.Second
+)
+
+// Webhook -> Event of a payment to post to its merchant, Payload is the body as queued
+type Webhook struct {
+	ID              string    `db:"id"`
+	MerchantID      string    `db:"merchant_id"`
+	PaymentID       string    `db:"payment_id"`
+	Event           string    `db:"event"`
+	Payload         string    `db:"payload"`
+	Status          string    `db:"status"`
+	Attempts        int       `db:"attempts"`
+	LastError       string    `db:"last_error"`
+	NextAttemptTime time.Time `db:"next_attempt_time"`
+	DeliverTime     time.Time `db:"deliver_time"`
+	CreateTime      time.Time `db:"create_time"`
+
+	// URL and Secret -> of the merchant when it is posted, not stored
+	URL    string
+	Secret string
+}
+
+// Backoff -> the wait after the attempts made so far failed
+func (h Webhook) Backoff() time.Duration {
+	wait := webhookRetryBase
+	for i := 1; i < h.Attempts && wait < webhookRetryMax; i++ {
+		wait *= 2
+	}
+
+	return min(wait, webhookRetryMax)
+}
+
+// webhookPayload -> the body of a webhook
+type webhookPayload struct {
+	ID        string                `json:"id"`
+	Type      string                `json:"type"`
+	CreatedAt time.Time             `json:"created_at"`
+	Data      webhookPayloadPayment `json:"data"`
+}
+
+type webhookPayloadPayment struct {
+	Payment ResponsePaymentDetail `json:"payment"`
+}
+
+const (
+	createWebhookTable = `
+		CREATE TABLE IF NOT EXISTS merchant_webhook (
+			id TEXT NOT NULL PRIMARY KEY,
+			merchant_id TEXT NOT NULL,
+			payment_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			next_attempt_time DATETIME NOT NULL,
+			deliver_time DATETIME,
+			create_time DATETIME NOT NULL
+		);
+	`
+
+	insertWebhookSQL = `
+		INSERT INTO merchant_webhook
+			(id, merchant_id, payment_id, event, payload, status, attempts, last_error, next_attempt_time, create_time)
+		VALUES
+			(?,?,?,?,?,'pending',0,'',?,?)
+		;
+	`
+
+	selectWebhookSQL = `
+		SELECT
+			h.id,
+			h.merchant_id,
+			h.payment_id,
+			h.event,
+			h.payload,
+			h.status,
+			h.attempts,
+			h.last_error,
+			h.next_attempt_time,
+			h.deliver_time,
+			h.create_time,
+			m.webhook_url,
+			m.webhook_secret
+		FROM
+			merchant_webhook h
+			JOIN merchant m ON m.id = h.merchant_id
+	`
+
+	// getDueWebhooksSQL -> pending webhooks whose next attempt is due, oldest first so a
+	// payment's events go out in order
+	getDueWebhooksSQL = selectWebhookSQL + `
+		WHERE
+			h.status = 'pending' AND
+			julianday(h.next_attempt_time) <= julianday($1)
+		ORDER BY
+			h.create_time,
+			h.rowid
+		LIMIT $2
+	`
+
+	getWebhooksSQL = selectWebhookSQL + `
+		WHERE
+			h.merchant_id = $1
+		ORDER BY
+			h.create_time DESC,
+			h.rowid DESC
+		LIMIT $2
+	`
+
+	updateWebhookAttemptSQL = `
+		UPDATE
+			merchant_webhook
+		SET
+			status = $1,
+			attempts = $2,
+			last_error = $3,
+			next_attempt_time = $4,
+			deliver_time = $5
+		WHERE
+			id = $6
+	`
+)
+
+// enqueueWebhook -> queue event of payment for its merchant in tx, nothing when the merchant
+// has no webhook url
+func enqueueWebhook(ctx context.Context, tx *sql.Tx, merchant Merchant, event string, payment Payment) (err error) {
+	if merchant.WebhookURL == "" {
+		return
+	}
+
+	now := time.Now()
+	webhook := Webhook{
+		ID:              generateUUID(),
+		MerchantID:      merchant.ID,
+		PaymentID:       payment.ID,
+		Event:           event,
+		NextAttemptTime: now,
+		CreateTime:      now,
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		ID:        webhook.ID,
+		Type:      event,
+		CreatedAt: now,
+		Data:      webhookPayloadPayment{Payment: paymentResponse(payment, now)},
+	})
+	if err != nil {
+		logError(ctx, "enqueueWebhook Marshal", err)
+		return
+	}
+	webhook.Payload = string(payload)
+
+	_, err = tx.ExecContext(ctx,
+		insertWebhookSQL,
+		webhook.ID,
+		webhook.MerchantID,
+		webhook.PaymentID,
+		webhook.Event,
+		webhook.Payload,
+		webhook.NextAttemptTime,
+		webhook.CreateTime,
+	)
+	if err != nil {
+		logError(ctx, "enqueueWebhook ExecContext", err)
+	}
+
+	return
+}
+
+func scanWebhook(scanner interface{ Scan(...interface{}) error }) (webhook Webhook, err error) {
+	var deliverTime sql.NullTime
+	err = scanner.Scan(
+		&webhook.ID,
+		&webhook.MerchantID,
+		&webhook.PaymentID,
+		&webhook.Event,
+		&webhook.Payload,
+		&webhook.Status,
+		&webhook.Attempts,
+		&webhook.LastError,
+		&webhook.NextAttemptTime,
+		&deliverTime,
+		&webhook.CreateTime,
+		&webhook.URL,
+		&webhook.Secret,
+	)
+	webhook.DeliverTime = deliverTime.Time
+
+	return
+}
+
+func queryWebhooks(ctx context.Context, db *sql.DB, name, query string, args ...interface{}) (webhooks []Webhook, err error) {
+	defer observeQuery(name, time.Now())
+	ctx, span := startQuerySpan(ctx, name)
+	defer func() {
+		span.end(err)
+	}()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logError(ctx, name+" QueryContext", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook Webhook
+		webhook, err = scanWebhook(rows)
+		if err != nil {
+			logError(ctx, name+" Scan", err)
+			return
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func getDueWebhooks(ctx context.Context, db *sql.DB, now time.Time) (webhooks []Webhook, err error) {
+	return queryWebhooks(ctx, db, "getDueWebhooks", getDueWebhooksSQL, now, webhookBatchSize)
+}
+
+func getWebhooks(ctx context.Context, db *sql.DB, merchantID string, limit int) (webhooks []Webhook, err error) {
+	return queryWebhooks(ctx, db, "getWebhooks", getWebhooksSQL, merchantID, limit)
+}
+
+func updateWebhookAttempt(ctx context.Context, db *sql.DB, webhook Webhook) (err error) {
+	defer observeQuery("updateWebhookAttempt", time.Now())
+	ctx, span := startQuerySpan(ctx, "updateWebhookAttempt")
+	defer func() {
+		span.end(err)
+	}()
+
+	var deliverTime sql.NullTime
+	if !webhook.DeliverTime.IsZero() {
+		deliverTime = sql.NullTime{Time: webhook.DeliverTime, Valid: true}
+	}
+
+	_, err = db.ExecContext(ctx,
+		updateWebhookAttemptSQL,
+		webhook.Status,
+		webhook.Attempts,
+		webhook.LastError,
+		webhook.NextAttemptTime,
+		deliverTime,
+		webhook.ID,
+	)
+	if err != nil {
+		logError(ctx, "updateWebhookAttempt ExecContext", err)
+	}
+
+	return
+}
+
+// webhookSignature -> the X-Wallet-Signature of body posted at timestamp: t=<unix seconds>,
+// v1=<hex hmac-sha256 of "<unix seconds>.<body>" keyed by the webhook secret>
+func webhookSignature(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher -> posts the due webhooks every poll
+type webhookDispatcher struct {
+	clock  clock
+	poll   time.Duration
+	client *http.Client
+}
+
+func newWebhookDispatcher(c clock) *webhookDispatcher {
+	return &webhookDispatcher{clock: c, poll: webhookPoll, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+var walletWebhooks = newWebhookDispatcher(systemClock{})
+
+// run -> post now and then every poll, until ctx is done
+func (d *webhookDispatcher) run(ctx context.Context) {
+	for {
+		d.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(d.poll):
+		}
+	}
+}
+
+// dispatch -> post the webhooks due by now one at a time, oldest first
+func (d *webhookDispatcher) dispatch(ctx context.Context) {
+	ctx = withOperation(ctx, "webhook_dispatch")
+
+	webhooks, err := getDueWebhooks(ctx, database, d.clock.Now())
+	if err != nil {
+		logError(ctx, "webhookDispatcher getDueWebhooks", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		err = d.post(ctx, webhook)
+
+		now := d.clock.Now()
+		webhook.Attempts++
+		switch {
+		case err == nil:
+			webhook.Status = webhookStatusDelivered
+			webhook.LastError = ""
+			webhook.DeliverTime = now
+		case webhook.Attempts >= webhookMaxAttempts:
+			webhook.Status = webhookStatusFailed
+			webhook.LastError = truncate(err.Error(), maxWebhookErrorLen)
+		default:
+			webhook.LastError = truncate(err.Error(), maxWebhookErrorLen)
+			webhook.NextAttemptTime = now.Add(webhook.Backoff())
+		}
+
+		if updateWebhookAttempt(ctx, database, webhook) != nil {
+			continue
+		}
+
+		logInfo(ctx, "webhook attempted", "webhook_id", webhook.ID, "merchant_id", webhook.MerchantID,
+			"event", webhook.Event, "status", webhook.Status, "attempts", webhook.Attempts)
+	}
+}
+
+// post -> post webhook to the current url of its merchant, any answer but 2xx is an error
+func (d *webhookDispatcher) post(ctx context.Context, webhook Webhook) (err error) {
+	if webhook.URL == "" {
+		return fmt.Errorf("merchant has no webhook url")
+	}
+
+	body := []byte(webhook.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set(webhookEventHeader, webhook.Event)
+	req.Header.Set(webhookDeliveryHeader, webhook.ID)
+	req.Header.Set(webhookSignatureHeader, webhookSignature(webhook.Secret, d.clock.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxRequestBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook url answered %d", resp.StatusCode)
+	}
+
+	return
+}
+
+// ListWebhooks -> the latest webhooks of the merchant, newest first
+func ListWebhooks(ctx context.Context, limit int) (webhooks []Webhook, err error) {
+	ctx = withOperation(ctx, "list_webhooks")
+	ctx, span := startSpan(ctx, "ListWebhooks", spanKindInternal)
+	defer func() {
+		span.finish(err)
+	}()
+
+	merchant, err := merchantOf(ctx)
+	if err != nil {
+		return
+	}
+
+	if limit <= 0 {
+		limit = defaultTransactionLimit
+	}
+	if limit > maxTransactionLimit {
+		limit = maxTransactionLimit
+	}
+
+	webhooks, err = getWebhooks(ctx, database, merchant.ID, limit)
+	return
+}
+
+// HandleListWebhooks -> Merchant: my latest webhooks and how their delivery went
+func HandleListWebhooks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := Response{
+		Status: statusSuccess,
+	}
+
+	defer func() {
+		json.NewEncoder(w).Encode(response)
+	}()
+
+	var req RequestListTransactions
+	if !bindRequest(w, r, &req, &response) {
+		return
+	}
+
+	webhooks, err := ListWebhooks(r.Context(), req.Limit)
+	if err != nil {
+		writeError(w, r, &response, err)
+		return
+	}
+
+	data := ResponseWebhooks{
+		Webhooks: []ResponseWebhookDetail{},
+	}
+	for _, webhook := range webhooks {
+		detail := ResponseWebhookDetail{
+			ID:        webhook.ID,
+			Event:     webhook.Event,
+			PaymentID: webhook.PaymentID,
+			Status:    webhook.Status,
+			Attempts:  webhook.Attempts,
+			LastError: webhook.LastError,
+			CreatedAt: webhook.CreateTime,
+		}
+		switch webhook.Status {
+		case webhookStatusPending:
+			detail.NextAttemptAt = &webhook.NextAttemptTime
+		case webhookStatusDelivered:
+			detail.DeliveredAt = &webhook.DeliverTime
+		}
+
+		data.Webhooks = append(data.Webhooks, detail)
+	}
+
+	response.Data = data
+	w.WriteHeader(http.StatusOK)
+}
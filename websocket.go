@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 6455, only what the watch endpoint needs: text messages, ping/pong and close.
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsCloseNormal          = 1000
+	wsCloseProtocolError   = 1002
+	wsCloseUnsupportedData = 1003
+	wsClosePolicyViolation = 1008
+	wsCloseTooBig          = 1009
+	wsCloseInternalError   = 1011
+
+	// wsMaxMessage -> largest client message, after reassembling fragments
+	wsMaxMessage = 64 << 10
+
+	wsWriteTimeout = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+// wsCloseError -> the peer closed the connection, or the server has to with Code
+type wsCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed %d %s", e.Code, e.Reason)
+}
+
+// wsConn -> a hijacked connection speaking websocket frames
+type wsConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// upgradeWebSocket -> complete the handshake, on error nothing was written yet
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (ws *wsConn, err error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" ||
+		key == "" {
+		err = errWebSocketUpgrade
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		err = fmt.Errorf("upgradeWebSocket: %T is not a http.Hijacker", w)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	h := sha1.New()
+	io.WriteString(h, key+wsGUID)
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err = fmt.Fprintf(conn,
+		"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n%s: %s\r\n\r\n",
+		accept, requestIDHeader, requestIDFromContext(r.Context()),
+	)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	ws = &wsConn{conn: conn, br: rw.Reader}
+	return
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header[name] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readMessage -> next text or binary message, answering pings and closes on the way.
+// A *wsCloseError means the connection is done.
+func (c *wsConn) readMessage() (opcode byte, message []byte, err error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			err = c.writeFrame(wsOpPong, payload)
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			closeErr := &wsCloseError{Code: wsCloseNormal}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			c.writeClose(closeErr.Code, "")
+			return 0, nil, closeErr
+		case wsOpText, wsOpBinary:
+			if opcode != 0 {
+				return 0, nil, &wsCloseError{Code: wsCloseProtocolError, Reason: "expected continuation frame"}
+			}
+			opcode = op
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, &wsCloseError{Code: wsCloseProtocolError, Reason: "unexpected continuation frame"}
+			}
+		default:
+			return 0, nil, &wsCloseError{Code: wsCloseProtocolError, Reason: "unknown opcode"}
+		}
+
+		if len(message)+len(payload) > wsMaxMessage {
+			return 0, nil, &wsCloseError{Code: wsCloseTooBig, Reason: "message too big"}
+		}
+		message = append(message, payload...)
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	_, err = io.ReadFull(c.br, header[:])
+	if err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 || !masked {
+		err = &wsCloseError{Code: wsCloseProtocolError, Reason: "client frames must be masked and have no extensions"}
+		return
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return
+	}
+
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		err = &wsCloseError{Code: wsCloseProtocolError, Reason: "invalid control frame"}
+		return
+	}
+	if length > wsMaxMessage {
+		err = &wsCloseError{Code: wsCloseTooBig, Reason: "message too big"}
+		return
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(c.br, mask[:])
+	if err != nil {
+		return
+	}
+
+	payload = make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	if err != nil {
+		return
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return
+}
+
+// writeFrame -> one unfragmented frame, safe to call from several goroutines
+func (c *wsConn) writeFrame(opcode byte, payload []byte) (err error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err = c.conn.Write(frame)
+
+	return
+}
+
+func (c *wsConn) writeText(message []byte) error {
+	return c.writeFrame(wsOpText, message)
+}
+
+// writeClose -> send a close frame, the caller closes the connection afterwards
+func (c *wsConn) writeClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	return c.writeFrame(wsOpClose, payload)
+}
+
+// closeCode -> close code to send for a read error, 0 when the peer already closed
+func closeCode(err error) (code int, reason string) {
+	var closeErr *wsCloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case wsCloseProtocolError, wsCloseUnsupportedData, wsCloseTooBig:
+			return closeErr.Code, closeErr.Reason
+		}
+		return 0, ""
+	}
+
+	return wsCloseNormal, ""
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestConn -> the client side of /api/v1/watch, writing frames by hand
+type wsTestConn struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWatch -> a new user with an enabled wallet connected to /api/v1/watch, and the id of
+// that wallet
+func dialWatch(t *testing.T) (c *wsTestConn, walletID string) {
+	t.Helper()
+	ctx := context.Background()
+	userID := t.Name() + "-" + generateUUID()
+
+	token, err := InitAccount(ctx, userID)
+	if err != nil {
+		t.Fatalf("InitAccount: %v", err)
+	}
+	wallet, err := EnableWallet(ctx, userID)
+	if err != nil {
+		t.Fatalf("EnableWallet: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(testServer.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, testServer.URL+"/api/v1/watch", nil)
+	req.Header.Set("Authorization", "Token "+token)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	err = req.Write(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = &wsTestConn{t: t, conn: conn, br: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(c.br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake: status %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: Sec-WebSocket-Accept %q", accept)
+	}
+
+	return c, wallet.ID
+}
+
+// writeFrame -> one client frame, masked unless told otherwise
+func (c *wsTestConn) writeFrame(fin bool, opcode byte, payload []byte, masked bool) {
+	c.t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if masked {
+		mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.conn.Write(frame)
+	if err != nil {
+		c.t.Fatalf("write frame: %v", err)
+	}
+}
+
+// readFrame -> the next server frame, which is never masked
+func (c *wsTestConn) readFrame() (opcode byte, payload []byte) {
+	c.t.Helper()
+
+	var header [2]byte
+	_, err := io.ReadFull(c.br, header[:])
+	if err != nil {
+		c.t.Fatalf("read frame: %v", err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		c.t.Fatalf("frame header %x: want fin and no mask", header)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	payload = make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	if err != nil {
+		c.t.Fatalf("read payload: %v", err)
+	}
+
+	return header[0] & 0x0F, payload
+}
+
+// expectClose -> the server closes with code and then hangs up
+func (c *wsTestConn) expectClose(code int) {
+	c.t.Helper()
+
+	opcode, payload := c.readFrame()
+	if opcode != wsOpClose || len(payload) < 2 {
+		c.t.Fatalf("frame %x %q, want a close frame", opcode, payload)
+	}
+	if got := int(binary.BigEndian.Uint16(payload)); got != code {
+		c.t.Errorf("close code %d %q, want %d", got, payload[2:], code)
+	}
+
+	_, err := c.br.ReadByte()
+	if err != io.EOF {
+		c.t.Errorf("after close: %v, want EOF", err)
+	}
+}
+
+// TestWebSocketMaskedFrames -> a masked message split over fragments, with a ping between
+// them, is reassembled and answered, an unmasked frame closes with a protocol error
+func TestWebSocketMaskedFrames(t *testing.T) {
+	c, walletID := dialWatch(t)
+
+	message := `{"type":"subscribe","id":"1","wallet_ids":["` + walletID + `"]}`
+	c.writeFrame(false, wsOpText, []byte(message[:10]), true)
+	c.writeFrame(true, wsOpPing, []byte("are you there"), true)
+	c.writeFrame(true, wsOpContinuation, []byte(message[10:]), true)
+
+	opcode, payload := c.readFrame()
+	if opcode != wsOpPong || string(payload) != "are you there" {
+		t.Fatalf("frame %x %q, want the pong", opcode, payload)
+	}
+
+	opcode, payload = c.readFrame()
+	var reply ResponseWatchMessage
+	if opcode != wsOpText || json.Unmarshal(payload, &reply) != nil {
+		t.Fatalf("frame %x %q, want a json text message", opcode, payload)
+	}
+	if reply.Type != watchTypeSubscribed || reply.ID != "1" {
+		t.Errorf("reply %s, want subscribed to 1", payload)
+	}
+
+	c.writeFrame(true, wsOpText, []byte(`{"type":"ack"}`), false)
+	c.expectClose(wsCloseProtocolError)
+}
+
+// TestWebSocketOversize -> a message past wsMaxMessage closes with 1009, announced in one
+// frame or reassembled from fragments
+func TestWebSocketOversize(t *testing.T) {
+	t.Run("frame", func(t *testing.T) {
+		c, _ := dialWatch(t)
+
+		// the header alone is refused, the payload is never read
+		header := []byte{0x80 | wsOpText, 0x80 | 127}
+		header = binary.BigEndian.AppendUint64(header, wsMaxMessage+1)
+		_, err := c.conn.Write(append(header, 0x37, 0xfa, 0x21, 0x3d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.expectClose(wsCloseTooBig)
+	})
+
+	t.Run("fragments", func(t *testing.T) {
+		c, _ := dialWatch(t)
+
+		c.writeFrame(false, wsOpText, make([]byte, wsMaxMessage/2+1), true)
+		c.writeFrame(true, wsOpContinuation, make([]byte, wsMaxMessage/2), true)
+		c.expectClose(wsCloseTooBig)
+	})
+}
+
+// TestWebSocketClose -> a client close is echoed with its code, a binary message is closed
+// with 1003
+func TestWebSocketClose(t *testing.T) {
+	t.Run("client close", func(t *testing.T) {
+		c, _ := dialWatch(t)
+
+		payload := binary.BigEndian.AppendUint16(nil, wsCloseNormal)
+		c.writeFrame(true, wsOpClose, append(payload, "bye"...), true)
+		c.expectClose(wsCloseNormal)
+	})
+
+	t.Run("binary message", func(t *testing.T) {
+		c, _ := dialWatch(t)
+
+		c.writeFrame(true, wsOpBinary, []byte{1, 2, 3}, true)
+		c.expectClose(wsCloseUnsupportedData)
+	})
+}